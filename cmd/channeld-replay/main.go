@@ -0,0 +1,436 @@
+// channeld-replay pretty-prints the packet captures of channeld, and replays them against a channeld instance to reproduce the bugs.
+// The captures are started and stopped at runtime by the admin API, e.g. "channeldctl capture start --conn 3".
+//
+// Usage:
+//
+//	channeld-replay [-json] [-conn <connId>] [-channel <channelId>] <capture file>
+//	channeld-replay -replay [-sn tcp] [-sa localhost:11288] [-cn tcp] [-ca localhost:12108] [-speed 1] [-conn <connId>] [-channel <channelId>] <capture file>
+//
+// The messages are resolved like channeld does: the inbound messages by channeld.MessageMap, and the outbound messages by their
+// full names in the protobuf registry. The message body that can't be resolved, e.g. the user-space message from a client, is printed in base64.
+//
+// With -replay, the inbound messages are sent to the channeld at -sa or -ca (by the type of the captured connection), one connection
+// per captured connection over the network type of -sn or -cn (tcp, ws or kcp, as channeld's flags of the same names), at the captured pace scaled by -speed (0 = as fast as possible). The error results from channeld are printed.
+// The channel ids and the connection ids in the messages are sent as they are, so the capture should be replayed against
+// a fresh channeld that's started with the same settings, and the replay should start from the authentication of the connections.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/channeld"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/gorilla/websocket"
+	"github.com/xtaci/kcp-go"
+	"google.golang.org/protobuf/encoding/protojson"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+const usage = `Usage:
+  channeld-replay [-json] [-conn <connId>] [-channel <channelId>] <capture file>
+  channeld-replay -replay [-sn tcp] [-sa localhost:11288] [-cn tcp] [-ca localhost:12108] [-speed 1] [-conn <connId>] [-channel <channelId>] <capture file>
+
+Flags:
+`
+
+var errUsage = errors.New("invalid usage")
+
+type options struct {
+	json      bool
+	connId    uint
+	channelId int
+	replay    bool
+	speed     float64
+	// The network types and the addresses of channeld to replay the server and the client connections to.
+	serverNetwork string
+	serverAddr    string
+	clientNetwork string
+	clientAddr    string
+	// How long to wait for the responses after the last message is replayed.
+	wait time.Duration
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		if !errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "error:", err)
+			os.Exit(1)
+		}
+		os.Exit(2)
+	}
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("channeld-replay", flag.ContinueOnError)
+	var opts options
+	fs.BoolVar(&opts.json, "json", false, "print each record as a JSON object per line")
+	fs.UintVar(&opts.connId, "conn", 0, "only the messages of the connection, 0 = all connections")
+	fs.IntVar(&opts.channelId, "channel", -1, "only the messages in the channel, -1 = all channels")
+	fs.BoolVar(&opts.replay, "replay", false, "replay the inbound messages against channeld, instead of printing them")
+	fs.Float64Var(&opts.speed, "speed", 1, "the speed of the replay, e.g. 2 = twice as fast as captured, 0 = as fast as possible")
+	fs.StringVar(&opts.serverNetwork, "sn", "tcp", "the network type of channeld for the server connections: tcp, ws or kcp")
+	fs.StringVar(&opts.serverAddr, "sa", "localhost:11288", "the address of channeld for the server connections")
+	fs.StringVar(&opts.clientNetwork, "cn", "tcp", "the network type of channeld for the client connections: tcp, ws or kcp")
+	fs.StringVar(&opts.clientAddr, "ca", "localhost:12108", "the address of channeld for the client connections")
+	fs.DurationVar(&opts.wait, "wait", time.Second, "how long to wait for the responses after the last message is replayed")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() != 1 || opts.speed < 0 {
+		fs.Usage()
+		return errUsage
+	}
+
+	records, err := channeld.ReadCaptureFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	records = filterRecords(records, &opts)
+	if opts.replay {
+		return replay(ctx, records, &opts, out)
+	}
+	return printRecords(records, &opts, out)
+}
+
+func filterRecords(records []*proto.CaptureRecord, opts *options) []*proto.CaptureRecord {
+	filtered := make([]*proto.CaptureRecord, 0, len(records))
+	for _, record := range records {
+		if opts.connId != 0 && record.ConnId != uint32(opts.connId) {
+			continue
+		}
+		if opts.channelId >= 0 && record.Pack.ChannelId != uint32(opts.channelId) {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+	return filtered
+}
+
+func msgTypeName(msgType uint32) string {
+	if msgType >= uint32(proto.MessageType_USER_SPACE_START) {
+		return fmt.Sprintf("USER_SPACE(%d)", msgType)
+	}
+	if name, exists := proto.MessageType_name[int32(msgType)]; exists {
+		return name
+	}
+	return fmt.Sprintf("UNDEFINED(%d)", msgType)
+}
+
+// A record in the -json output.
+type jsonRecord struct {
+	Time      time.Time       `json:"time"`
+	Direction string          `json:"direction"`
+	ConnId    uint32          `json:"connId"`
+	ConnType  string          `json:"connType"`
+	ChannelId uint32          `json:"channelId"`
+	Broadcast string          `json:"broadcast,omitempty"`
+	StubId    uint32          `json:"stubId,omitempty"`
+	MsgType   string          `json:"msgType"`
+	MsgName   string          `json:"msgName,omitempty"`
+	Msg       json.RawMessage `json:"msg,omitempty"`     // The message in protojson, if resolved.
+	MsgBody   []byte          `json:"msgBody,omitempty"` // The message body in base64, if not resolved.
+	Error     string          `json:"error,omitempty"`   // Why the message can't be resolved.
+}
+
+func toJSONRecord(record *proto.CaptureRecord) jsonRecord {
+	r := jsonRecord{
+		Time:      time.Unix(0, record.Time),
+		Direction: record.Direction.String(),
+		ConnId:    record.ConnId,
+		ConnType:  record.ConnType.String(),
+		ChannelId: record.Pack.ChannelId,
+		StubId:    record.Pack.StubId,
+		MsgType:   msgTypeName(record.Pack.MsgType),
+	}
+	if record.Pack.Broadcast != proto.BroadcastType_NO_BROADCAST {
+		r.Broadcast = record.Pack.Broadcast.String()
+	}
+
+	msg, err := channeld.UnmarshalCapturedMessage(record)
+	if err == nil && msg != nil {
+		r.MsgName = string(msg.ProtoReflect().Descriptor().FullName())
+		// The Any fields, e.g. the channel data, are resolved by the protobuf registry as well.
+		r.Msg, err = protojson.Marshal(msg)
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	if r.Msg == nil {
+		r.MsgBody = record.Pack.MsgBody
+	}
+	return r
+}
+
+func printRecords(records []*proto.CaptureRecord, opts *options, out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	for _, record := range records {
+		r := toJSONRecord(record)
+		if opts.json {
+			if err := encoder.Encode(r); err != nil {
+				return err
+			}
+			continue
+		}
+
+		arrow := "->"
+		if record.Direction == proto.CaptureRecord_OUTBOUND {
+			arrow = "<-"
+		}
+		fmt.Fprintf(out, "%s %s %s %d ch=%d", r.Time.Local().Format("15:04:05.000000"), arrow, r.ConnType, r.ConnId, r.ChannelId)
+		if r.StubId != 0 {
+			fmt.Fprintf(out, " stub=%d", r.StubId)
+		}
+		if r.Broadcast != "" {
+			fmt.Fprintf(out, " broadcast=%s", r.Broadcast)
+		}
+		fmt.Fprintf(out, " %s", r.MsgType)
+		switch {
+		case r.Msg != nil:
+			fmt.Fprintf(out, " %s %s\n", r.MsgName, r.Msg)
+		case r.Error != "":
+			fmt.Fprintf(out, " (%s) %s\n", r.Error, base64.StdEncoding.EncodeToString(r.MsgBody))
+		default:
+			fmt.Fprintf(out, " %s\n", base64.StdEncoding.EncodeToString(r.MsgBody))
+		}
+	}
+	return nil
+}
+
+// Writes the packet with the same header as channeld does (see Connection.Flush), without compression.
+func writePacket(w io.Writer, p *proto.Packet) error {
+	bytes, err := protobuf.Marshal(p)
+	if err != nil {
+		return err
+	}
+	size := len(bytes)
+	if size >= 0xffffff {
+		return fmt.Errorf("packet is oversized: %d", size)
+	}
+	// 'CHNL' in ASCII
+	tag := []byte{67, 72, 78, 76, byte(proto.CompressionType_NO_COMPRESSION)}
+	tag[3] = byte(size & 0xff)
+	if size > 0xff {
+		tag[2] = byte((size >> 8) & 0xff)
+	}
+	if size > 0xffff {
+		tag[1] = byte((size >> 16) & 0xff)
+	}
+	_, err = w.Write(append(tag, bytes...))
+	return err
+}
+
+// Reads the packet sent by channeld (see Connection.ReceivePacket). channeld doesn't compress the packets as the replay doesn't.
+func readPacket(r io.Reader) (*proto.Packet, error) {
+	tag := make([]byte, 5)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return nil, err
+	}
+	if tag[0] != 67 {
+		return nil, fmt.Errorf("invalid tag: %v", tag)
+	}
+	size := int(tag[3])
+	if tag[1] != 72 {
+		size = size | int(tag[1])<<16 | int(tag[2])<<8
+	} else if tag[2] != 78 {
+		size = size | int(tag[2])<<8
+	}
+	bytes := make([]byte, size)
+	if _, err := io.ReadFull(r, bytes); err != nil {
+		return nil, err
+	}
+	p := &proto.Packet{}
+	if err := protobuf.Unmarshal(bytes, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Dials channeld over the network type that it listens on, like channeld.Server.listen does.
+func dial(network string, addr string) (net.Conn, error) {
+	switch network {
+	case "ws", "websocket":
+		if !strings.Contains(addr, "://") {
+			addr = "ws://" + addr
+		}
+		conn, _, err := websocket.DefaultDialer.Dial(addr, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &wsConn{Conn: conn}, nil
+	case "kcp":
+		return kcp.Dial(addr)
+	default:
+		return net.Dial(network, addr)
+	}
+}
+
+// The WebSocket connection as a stream. Each packet is written in a binary message, as channeld expects.
+type wsConn struct {
+	*websocket.Conn
+	reader io.Reader
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			_, reader, err := c.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			c.reader = reader
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			// The end of the message, but not of the connection.
+			c.reader = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.UnderlyingConn().SetDeadline(t)
+}
+
+// The connection to channeld that replays a captured connection.
+type replayConn struct {
+	net.Conn
+	capturedId uint32
+	sent       int
+	received   int
+	errors     int
+}
+
+// Prints the error results and counts the messages from channeld until the connection is closed.
+func (c *replayConn) receive(out io.Writer, outLock *sync.Mutex) {
+	reader := bufio.NewReader(c)
+	for {
+		p, err := readPacket(reader)
+		if err != nil {
+			return
+		}
+		outLock.Lock()
+		for _, mp := range p.Messages {
+			c.received++
+			if mp.MsgType != uint32(proto.MessageType_ERROR) {
+				continue
+			}
+			c.errors++
+			errMsg := &proto.ErrorResultMessage{}
+			if err := protobuf.Unmarshal(mp.MsgBody, errMsg); err == nil {
+				fmt.Fprintf(out, "conn %d: error result of %s (stub=%d): %s %s\n",
+					c.capturedId, msgTypeName(errMsg.MsgType), errMsg.StubId, errMsg.Code, errMsg.Message)
+			}
+		}
+		outLock.Unlock()
+	}
+}
+
+func replay(ctx context.Context, records []*proto.CaptureRecord, opts *options, out io.Writer) error {
+	conns := make(map[uint32]*replayConn)
+	var outLock sync.Mutex
+	var wg sync.WaitGroup
+	defer func() {
+		for _, c := range conns {
+			c.Close()
+		}
+		wg.Wait()
+	}()
+
+	var start time.Time
+	var firstTime int64
+	for _, record := range records {
+		if record.Direction != proto.CaptureRecord_INBOUND {
+			continue
+		}
+		if start.IsZero() {
+			start, firstTime = time.Now(), record.Time
+		}
+		if opts.speed > 0 {
+			due := start.Add(time.Duration(float64(record.Time-firstTime) / opts.speed))
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(time.Until(due)):
+			}
+		}
+
+		c, exists := conns[record.ConnId]
+		if !exists {
+			network, addr := opts.clientNetwork, opts.clientAddr
+			if record.ConnType == proto.ConnectionType_SERVER {
+				network, addr = opts.serverNetwork, opts.serverAddr
+			}
+			conn, err := dial(network, addr)
+			if err != nil {
+				return fmt.Errorf("failed to connect for conn %d: %w", record.ConnId, err)
+			}
+			c = &replayConn{Conn: conn, capturedId: record.ConnId}
+			conns[record.ConnId] = c
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				c.receive(out, &outLock)
+			}()
+		}
+		// One packet per message, so the timing is kept.
+		if err := writePacket(c, &proto.Packet{Messages: []*proto.MessagePack{record.Pack}}); err != nil {
+			return fmt.Errorf("failed to replay to conn %d: %w", record.ConnId, err)
+		}
+		c.sent++
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(opts.wait):
+	}
+	for _, c := range conns {
+		c.Close()
+	}
+	wg.Wait()
+
+	ids := make([]uint32, 0, len(conns))
+	for id := range conns {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	for _, id := range ids {
+		c := conns[id]
+		fmt.Fprintf(out, "conn %d: sent %d, received %d, errors %d\n", id, c.sent, c.received, c.errors)
+	}
+	return nil
+}
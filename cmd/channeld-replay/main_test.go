@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/xtaci/kcp-go"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func marshal(t *testing.T, msg protobuf.Message) []byte {
+	bytes, err := protobuf.Marshal(msg)
+	assert.NoError(t, err)
+	return bytes
+}
+
+// Writes the records in the format of the capture file.
+func writeCaptureFile(t *testing.T, records ...*proto.CaptureRecord) string {
+	path := filepath.Join(t.TempDir(), "test.capture")
+	var data []byte
+	for _, record := range records {
+		bytes := marshal(t, record)
+		size := make([]byte, binary.MaxVarintLen64)
+		n := binary.PutUvarint(size, uint64(len(bytes)))
+		data = append(append(data, size[:n]...), bytes...)
+	}
+	assert.NoError(t, os.WriteFile(path, data, 0644))
+	return path
+}
+
+func testRecords(t *testing.T) []*proto.CaptureRecord {
+	start := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC).UnixNano()
+	data, err := anypb.New(&proto.TestChannelDataMessage{Text: "hello"})
+	assert.NoError(t, err)
+	return []*proto.CaptureRecord{
+		{Time: start, ConnId: 1, ConnType: proto.ConnectionType_SERVER, Pack: &proto.MessagePack{
+			MsgType: uint32(proto.MessageType_AUTH), MsgBody: marshal(t, &proto.AuthMessage{PlayerIdentifierToken: "server", LoginToken: "token"}),
+		}},
+		{Time: start + int64(time.Millisecond), ConnId: 2, ConnType: proto.ConnectionType_CLIENT, Pack: &proto.MessagePack{
+			MsgType: uint32(proto.MessageType_AUTH), MsgBody: marshal(t, &proto.AuthMessage{PlayerIdentifierToken: "client", LoginToken: "token"}),
+		}},
+		{Time: start + 2*int64(time.Millisecond), ConnId: 1, ConnType: proto.ConnectionType_SERVER, Direction: proto.CaptureRecord_OUTBOUND,
+			MsgName: "channeld.ChannelDataUpdateMessage", Pack: &proto.MessagePack{
+				ChannelId: 1, MsgType: uint32(proto.MessageType_CHANNEL_DATA_UPDATE), MsgBody: marshal(t, &proto.ChannelDataUpdateMessage{Data: data}),
+			}},
+		{Time: start + 3*int64(time.Millisecond), ConnId: 2, ConnType: proto.ConnectionType_CLIENT, Pack: &proto.MessagePack{
+			ChannelId: 1, StubId: 5, Broadcast: proto.BroadcastType_ALL, MsgType: 100, MsgBody: []byte("hi"),
+		}},
+	}
+}
+
+func TestPrint(t *testing.T) {
+	path := writeCaptureFile(t, testRecords(t)...)
+	var out strings.Builder
+	assert.NoError(t, run(context.Background(), []string{path}, &out))
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if assert.Len(t, lines, 4) {
+		assert.Contains(t, lines[0], " -> SERVER 1 ch=0 AUTH channeld.AuthMessage {")
+		assert.Contains(t, lines[2], " <- SERVER 1 ch=1 CHANNEL_DATA_UPDATE channeld.ChannelDataUpdateMessage {")
+		// The channel data in the Any field is resolved as well.
+		assert.Contains(t, lines[2], "hello")
+		// The user-space message from a client is not deserialized.
+		assert.Contains(t, lines[3], " -> CLIENT 2 ch=1 stub=5 broadcast=ALL USER_SPACE(100) aGk=")
+	}
+
+	out.Reset()
+	assert.NoError(t, run(context.Background(), []string{"-json", "-conn", "1", path}, &out))
+	lines = strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if assert.Len(t, lines, 2) {
+		var r jsonRecord
+		assert.NoError(t, json.Unmarshal([]byte(lines[1]), &r))
+		assert.Equal(t, "OUTBOUND", r.Direction)
+		assert.Equal(t, "CHANNEL_DATA_UPDATE", r.MsgType)
+		assert.Equal(t, "channeld.ChannelDataUpdateMessage", r.MsgName)
+		assert.Contains(t, string(r.Msg), `"text":"hello"`)
+		assert.Nil(t, r.MsgBody)
+	}
+
+	out.Reset()
+	assert.NoError(t, run(context.Background(), []string{"-channel", "1", "-conn", "2", path}, &out))
+	assert.Equal(t, 1, strings.Count(out.String(), "\n"))
+
+	assert.True(t, errors.Is(run(context.Background(), []string{}, &out), errUsage))
+	assert.Error(t, run(context.Background(), []string{"no-such-file"}, &out))
+}
+
+// A fake channeld on the network type that records the received messages and replies an error to each user-space message.
+func listenFakeChanneld(t *testing.T, network string, received chan<- *proto.MessagePack) string {
+	serve := func(conn net.Conn) {
+		defer conn.Close()
+		reader := bufio.NewReader(conn)
+		for {
+			p, err := readPacket(reader)
+			if err != nil {
+				return
+			}
+			for _, mp := range p.Messages {
+				received <- mp
+				if mp.MsgType >= uint32(proto.MessageType_USER_SPACE_START) {
+					writePacket(conn, &proto.Packet{Messages: []*proto.MessagePack{{
+						MsgType: uint32(proto.MessageType_ERROR),
+						MsgBody: marshal(t, &proto.ErrorResultMessage{Code: proto.ErrorResultMessage_NO_CHANNEL_OWNER, MsgType: mp.MsgType, StubId: mp.StubId}),
+					}}})
+				}
+			}
+		}
+	}
+
+	var listener net.Listener
+	var err error
+	switch network {
+	case "ws":
+		listener, err = net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		var upgrader websocket.Upgrader
+		go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err == nil {
+				serve(&wsConn{Conn: conn})
+			}
+		}))
+	case "kcp":
+		listener, err = kcp.Listen("127.0.0.1:0")
+		assert.NoError(t, err)
+	default:
+		listener, err = net.Listen(network, "127.0.0.1:0")
+		assert.NoError(t, err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	if network != "ws" {
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go serve(conn)
+			}
+		}()
+	}
+	return listener.Addr().String()
+}
+
+func TestReplay(t *testing.T) {
+	path := writeCaptureFile(t, testRecords(t)...)
+	for _, network := range []string{"tcp", "ws", "kcp"} {
+		t.Run(network, func(t *testing.T) {
+			serverReceived := make(chan *proto.MessagePack, 10)
+			clientReceived := make(chan *proto.MessagePack, 10)
+			serverAddr := listenFakeChanneld(t, network, serverReceived)
+			clientAddr := listenFakeChanneld(t, network, clientReceived)
+
+			// KCP flushes every 100ms by default, so it takes longer to get the responses.
+			wait := "100ms"
+			if network == "kcp" {
+				wait = "1s"
+			}
+			var out strings.Builder
+			assert.NoError(t, run(context.Background(), []string{"-replay",
+				"-sn", network, "-sa", serverAddr, "-cn", network, "-ca", clientAddr, "-wait", wait, path}, &out))
+			assert.Contains(t, out.String(), "conn 2: error result of USER_SPACE(100) (stub=5): NO_CHANNEL_OWNER")
+			assert.Contains(t, out.String(), "conn 1: sent 1, received 0, errors 0\n")
+			assert.Contains(t, out.String(), "conn 2: sent 2, received 1, errors 1\n")
+
+			// Only the inbound messages are replayed, to the address of their connection type.
+			assert.Len(t, serverReceived, 1)
+			assert.Len(t, clientReceived, 2)
+			assert.EqualValues(t, proto.MessageType_AUTH, (<-serverReceived).MsgType)
+			assert.EqualValues(t, proto.MessageType_AUTH, (<-clientReceived).MsgType)
+			mp := <-clientReceived
+			assert.Equal(t, []byte("hi"), mp.MsgBody)
+			assert.Equal(t, proto.BroadcastType_ALL, mp.Broadcast)
+		})
+	}
+}
+
+func TestPacketHeader(t *testing.T) {
+	// The sizes that need 1, 2 and 3 bytes in the header.
+	for _, size := range []int{10, 0x1234, 0x123456} {
+		var buf strings.Builder
+		p := &proto.Packet{Messages: []*proto.MessagePack{{MsgBody: make([]byte, size)}}}
+		assert.NoError(t, writePacket(&buf, p))
+		read, err := readPacket(strings.NewReader(buf.String()))
+		assert.NoError(t, err)
+		assert.Len(t, read.Messages[0].MsgBody, size)
+	}
+}
@@ -0,0 +1,551 @@
+// channeldctl inspects and manages a running channeld via its admin HTTP API (see channeld.AdminHandler).
+//
+// Usage:
+//
+//	channeldctl [-addr http://localhost:8080] [-token <admin token>] <command> [arguments]
+//
+// Commands:
+//
+//	channels ls [--type SUBWORLD] [--json]             List the channels
+//	channels inspect <channelId> [--json]              Show the channel, its subscriptions and data
+//	channels rm <channelId>                            Remove the channel
+//	conns ls [--type client] [--state OPEN] [--json]   List the connections
+//	conns kick <connId>                                Kick the connection
+//	fsm show <connId> [--json]                         Show the current FSM state of the connection
+//	watch <channelId> [--json]                         Stream the channel data updates until interrupted
+//	capture ls [--json]                                List the running packet captures
+//	capture start --conn <connId> | --channel <id>     Start capturing the messages of the connection or the channel
+//	capture stop <captureId>                           Stop the packet capture, see channeld-replay for reading the file
+//
+// The address and the token can also be set by the CHANNELD_ADMIN_ADDR and CHANNELD_ADMIN_TOKEN environment variables.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"channeld.clewcat.com/channeld/pkg/channeld"
+)
+
+const usage = `Usage: channeldctl [-addr http://localhost:8080] [-token <admin token>] <command> [arguments]
+
+Commands:
+  channels ls [--type SUBWORLD] [--json]             List the channels
+  channels inspect <channelId> [--json]              Show the channel, its subscriptions and data
+  channels rm <channelId>                            Remove the channel
+  conns ls [--type client] [--state OPEN] [--json]   List the connections
+  conns kick <connId>                                Kick the connection
+  fsm show <connId> [--json]                         Show the current FSM state of the connection
+  watch <channelId> [--json]                         Stream the channel data updates until interrupted
+  capture ls [--json]                                List the running packet captures
+  capture start --conn <connId> | --channel <id>     Start capturing the messages of the connection or the channel
+  capture stop <captureId>                           Stop the packet capture, see channeld-replay for reading the file
+`
+
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdout); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func getenv(key string, defaultValue string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return defaultValue
+}
+
+type client struct {
+	addr  string
+	token string
+}
+
+type command struct {
+	*client
+	ctx  context.Context
+	out  io.Writer
+	args []string // The positional arguments
+	json bool
+	// The filters of the ls commands
+	typeFilter  string
+	stateFilter string
+	// The target of capture start
+	connId    string
+	channelId string
+}
+
+func run(ctx context.Context, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("channeldctl", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	c := &client{}
+	fs.StringVar(&c.addr, "addr", getenv("CHANNELD_ADMIN_ADDR", "http://localhost:8080"), "the address of channeld's HTTP server")
+	fs.StringVar(&c.token, "token", os.Getenv("CHANNELD_ADMIN_TOKEN"), "the admin token, as set by -admintoken of channeld")
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	args = fs.Args()
+	if len(args) < 1 {
+		return errUsage
+	}
+
+	name := args[0]
+	args = args[1:]
+	// The commands that have a verb
+	if name == "channels" || name == "conns" || name == "fsm" || name == "capture" {
+		if len(args) < 1 {
+			return errUsage
+		}
+		name += " " + args[0]
+		args = args[1:]
+	}
+
+	cmd := &command{client: c, ctx: ctx, out: out}
+	cmdFs := flag.NewFlagSet(name, flag.ContinueOnError)
+	cmdFs.SetOutput(io.Discard)
+	cmdFs.BoolVar(&cmd.json, "json", false, "print the result in JSON")
+	cmdFs.StringVar(&cmd.typeFilter, "type", "", "filter by the channel or connection type")
+	cmdFs.StringVar(&cmd.stateFilter, "state", "", "filter by the FSM state of the connection")
+	cmdFs.StringVar(&cmd.connId, "conn", "", "the connection to capture")
+	cmdFs.StringVar(&cmd.channelId, "channel", "", "the channel to capture")
+	var err error
+	if cmd.args, err = parseInterspersed(cmdFs, args); err != nil {
+		return errUsage
+	}
+
+	type handler struct {
+		f     func() error
+		nArgs int
+	}
+	handlers := map[string]handler{
+		"channels ls":      {cmd.listChannels, 0},
+		"channels inspect": {cmd.inspectChannel, 1},
+		"channels rm":      {cmd.removeChannel, 1},
+		"conns ls":         {cmd.listConnections, 0},
+		"conns kick":       {cmd.kickConnection, 1},
+		"fsm show":         {cmd.showFsm, 1},
+		"watch":            {cmd.watch, 1},
+		"capture ls":       {cmd.listCaptures, 0},
+		"capture start":    {cmd.startCapture, 0},
+		"capture stop":     {cmd.stopCapture, 1},
+	}
+	h, ok := handlers[name]
+	if !ok || len(cmd.args) != h.nArgs {
+		return errUsage
+	}
+	for _, arg := range cmd.args {
+		if _, err := strconv.ParseUint(arg, 10, 32); err != nil {
+			return fmt.Errorf("invalid id: %s", arg)
+		}
+	}
+	return h.f()
+}
+
+// Parses the flags that come before or after the positional arguments, e.g. "inspect 1 --json".
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+func (c *client) request(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(c.addr, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var result struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&result) != nil || result.Error == "" {
+			result.Error = resp.Status
+		}
+		return nil, &apiError{status: resp.StatusCode, message: result.Error}
+	}
+	return resp, nil
+}
+
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%s (%d)", e.message, e.status)
+}
+
+func (c *client) get(ctx context.Context, path string, result interface{}) error {
+	resp, err := c.request(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *client) post(ctx context.Context, path string, body interface{}, result interface{}) error {
+	bodyBytes, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := c.request(ctx, http.MethodPost, path, bytes.NewReader(bodyBytes))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *client) delete(ctx context.Context, path string) error {
+	resp, err := c.request(ctx, http.MethodDelete, path, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (cmd *command) printJSON(v interface{}) error {
+	encoder := json.NewEncoder(cmd.out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func (cmd *command) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(cmd.out, 0, 0, 2, ' ', 0)
+}
+
+func joinIds(ids []uint32) string {
+	strs := make([]string, len(ids))
+	for i, id := range ids {
+		strs[i] = strconv.FormatUint(uint64(id), 10)
+	}
+	return strings.Join(strs, ",")
+}
+
+func ownerString(connId uint32) string {
+	if connId == 0 {
+		return "-"
+	}
+	return strconv.FormatUint(uint64(connId), 10)
+}
+
+func (cmd *command) listChannels() error {
+	query := url.Values{}
+	if cmd.typeFilter != "" {
+		query.Set("type", strings.ToUpper(cmd.typeFilter))
+	}
+	var channels []channeld.AdminChannelInfo
+	if err := cmd.get(cmd.ctx, "/admin/channels?"+query.Encode(), &channels); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(channels)
+	}
+
+	w := cmd.table()
+	fmt.Fprintln(w, "ID\tTYPE\tOWNER\tSUBS\tTICK\tLAST TICK\tDATA\tMETADATA")
+	for _, ch := range channels {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%dms\t%.2fms\t%t\t%s\n",
+			ch.ChannelId, ch.ChannelType, ownerString(ch.OwnerConnId), len(ch.SubscriberConnIds),
+			ch.TickIntervalMs, ch.LastTickDurationMs, ch.HasData, ch.Metadata)
+	}
+	return w.Flush()
+}
+
+func (cmd *command) inspectChannel() error {
+	id := cmd.args[0]
+	var channel channeld.AdminChannelInfo
+	if err := cmd.get(cmd.ctx, "/admin/channels/"+id, &channel); err != nil {
+		return err
+	}
+	var data json.RawMessage
+	if err := cmd.get(cmd.ctx, "/admin/channels/"+id+"/data", &data); err != nil {
+		// The channel data is not initialized.
+		var apiErr *apiError
+		if !errors.As(err, &apiErr) || apiErr.status != http.StatusNotFound {
+			return err
+		}
+		data = nil
+	}
+
+	if cmd.json {
+		return cmd.printJSON(struct {
+			Channel channeld.AdminChannelInfo `json:"channel"`
+			Data    json.RawMessage           `json:"data"`
+		}{channel, data})
+	}
+
+	w := cmd.table()
+	fmt.Fprintf(w, "Channel:\t%d\n", channel.ChannelId)
+	fmt.Fprintf(w, "Type:\t%s\n", channel.ChannelType)
+	fmt.Fprintf(w, "Owner:\t%s\n", ownerString(channel.OwnerConnId))
+	fmt.Fprintf(w, "Metadata:\t%s\n", channel.Metadata)
+	fmt.Fprintf(w, "Tick:\t%dms, %d frames, last tick took %.2fms\n", channel.TickIntervalMs, channel.TickFrames, channel.LastTickDurationMs)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.out)
+	w = cmd.table()
+	fmt.Fprintln(w, "SUBSCRIBER\tOPTIONS")
+	for _, sub := range channel.Subscriptions {
+		fmt.Fprintf(w, "%d\t%s\n", sub.ConnId, sub.Options)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(cmd.out)
+	if data == nil {
+		fmt.Fprintln(cmd.out, "Data: not initialized")
+		return nil
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "Data:\n%s\n", indented.String())
+	return nil
+}
+
+func (cmd *command) removeChannel() error {
+	if err := cmd.delete(cmd.ctx, "/admin/channels/"+cmd.args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "removed channel %s\n", cmd.args[0])
+	return nil
+}
+
+func (cmd *command) listConnections() error {
+	query := url.Values{}
+	if cmd.typeFilter != "" {
+		query.Set("type", strings.ToUpper(cmd.typeFilter))
+	}
+	if cmd.stateFilter != "" {
+		query.Set("state", cmd.stateFilter)
+	}
+	var conns []channeld.AdminConnectionInfo
+	if err := cmd.get(cmd.ctx, "/admin/connections?"+query.Encode(), &conns); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(conns)
+	}
+
+	w := cmd.table()
+	fmt.Fprintln(w, "ID\tTYPE\tSTATE\tREMOTE ADDR\tRTT\tCHANNELS")
+	for _, conn := range conns {
+		state := conn.State
+		if conn.Detached {
+			state += " (detached)"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%.1fms\t%s\n",
+			conn.ConnId, conn.ConnType, state, conn.RemoteAddr, conn.RttMs, joinIds(conn.ChannelIds))
+	}
+	return w.Flush()
+}
+
+func (cmd *command) kickConnection() error {
+	if err := cmd.delete(cmd.ctx, "/admin/connections/"+cmd.args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "kicked connection %s\n", cmd.args[0])
+	return nil
+}
+
+func (cmd *command) showFsm() error {
+	var conn channeld.AdminConnectionInfo
+	if err := cmd.get(cmd.ctx, "/admin/connections/"+cmd.args[0], &conn); err != nil {
+		return err
+	}
+	if conn.Fsm == nil {
+		return fmt.Errorf("connection %d has no FSM", conn.ConnId)
+	}
+	if cmd.json {
+		return cmd.printJSON(conn.Fsm)
+	}
+
+	w := cmd.table()
+	fmt.Fprintf(w, "Connection:\t%d (%s)\n", conn.ConnId, conn.ConnType)
+	fmt.Fprintf(w, "State:\t%s\n", conn.Fsm.Name)
+	fmt.Fprintf(w, "Whitelist:\t%s\n", conn.Fsm.MsgTypeWhitelist)
+	fmt.Fprintf(w, "Blacklist:\t%s\n", conn.Fsm.MsgTypeBlacklist)
+	if conn.Fsm.TimeoutMs > 0 {
+		fmt.Fprintf(w, "Timeout:\t%dms -> %s\n", conn.Fsm.TimeoutMs, conn.Fsm.TimeoutState)
+	}
+	if conn.Fsm.Terminal {
+		fmt.Fprintf(w, "Terminal:\tyes\n")
+	}
+	return w.Flush()
+}
+
+func (cmd *command) watch() error {
+	resp, err := cmd.request(cmd.ctx, http.MethodGet, "/admin/channels/"+cmd.args[0]+"/watch", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	scanner := bufio.NewScanner(resp.Body)
+	// The data of a channel can be much larger than the default 64K.
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		if cmd.json {
+			fmt.Fprintln(cmd.out, scanner.Text())
+			continue
+		}
+		var event channeld.AdminDataEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return err
+		}
+		var from string
+		switch {
+		case event.Snapshot && event.Dropped > 0:
+			from = "resync (" + strconv.FormatUint(uint64(event.Dropped), 10) + " updates dropped)"
+		case event.Snapshot:
+			from = "snapshot"
+		case event.SenderConnId == 0:
+			from = "channeld"
+		default:
+			from = "conn " + strconv.FormatUint(uint64(event.SenderConnId), 10)
+		}
+		fmt.Fprintf(cmd.out, "%s %s %s\n", event.Time.Local().Format("15:04:05.000"), from, sortedJSON(event.Data))
+	}
+	// Interrupted by the user
+	if cmd.ctx.Err() != nil {
+		return nil
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "channel %s is removed\n", cmd.args[0])
+	return nil
+}
+
+// Re-encodes the JSON object with sorted keys, so the updates are easier to compare by eye.
+func sortedJSON(data json.RawMessage) string {
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return string(data)
+	}
+	// encoding/json sorts the keys of the maps.
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return string(data)
+	}
+	return string(bytes)
+}
+
+func (cmd *command) listCaptures() error {
+	var captures []channeld.CaptureInfo
+	if err := cmd.get(cmd.ctx, "/admin/captures", &captures); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(captures)
+	}
+
+	w := cmd.table()
+	fmt.Fprintln(w, "ID\tTARGET\tSTARTED\tRECORDS\tPATH")
+	for _, capture := range captures {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\n",
+			capture.CaptureId, captureTargetString(capture.CaptureTarget), capture.StartTime.Local().Format("2006-01-02 15:04:05"), capture.Records, capture.Path)
+	}
+	return w.Flush()
+}
+
+func captureTargetString(target channeld.CaptureTarget) string {
+	if target.ConnId != nil {
+		return fmt.Sprintf("conn %d", *target.ConnId)
+	}
+	if target.ChannelId != nil {
+		return fmt.Sprintf("channel %d", *target.ChannelId)
+	}
+	return "-"
+}
+
+func parseId(s string) (*uint32, error) {
+	id, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id: %s", s)
+	}
+	id32 := uint32(id)
+	return &id32, nil
+}
+
+func (cmd *command) startCapture() error {
+	if (cmd.connId == "") == (cmd.channelId == "") {
+		return errUsage
+	}
+	var target channeld.CaptureTarget
+	var err error
+	if cmd.connId != "" {
+		target.ConnId, err = parseId(cmd.connId)
+	} else {
+		target.ChannelId, err = parseId(cmd.channelId)
+	}
+	if err != nil {
+		return err
+	}
+
+	var capture channeld.CaptureInfo
+	if err := cmd.post(cmd.ctx, "/admin/captures", target, &capture); err != nil {
+		return err
+	}
+	if cmd.json {
+		return cmd.printJSON(capture)
+	}
+	fmt.Fprintf(cmd.out, "started capture %d of %s to %s\n", capture.CaptureId, captureTargetString(capture.CaptureTarget), capture.Path)
+	return nil
+}
+
+func (cmd *command) stopCapture() error {
+	resp, err := cmd.request(cmd.ctx, http.MethodDelete, "/admin/captures/"+cmd.args[0], nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var capture channeld.CaptureInfo
+	if err := json.NewDecoder(resp.Body).Decode(&capture); err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.out, "stopped capture %d with %d records in %s\n", capture.CaptureId, capture.Records, capture.Path)
+	return nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// A fake admin API that returns the canned responses and records the requests.
+type fakeAdminAPI struct {
+	responses map[string]string // "METHOD path" -> JSON
+	requests  []string
+	bodies    []string
+}
+
+func (f *fakeAdminAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + r.URL.Path
+	f.requests = append(f.requests, r.Method+" "+r.URL.RequestURI())
+	if body, _ := io.ReadAll(r.Body); len(body) > 0 {
+		f.bodies = append(f.bodies, string(body))
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"error": "invalid admin token"}`)
+		return
+	}
+	resp, ok := f.responses[key]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"error": "not found"}`)
+		return
+	}
+	if resp == "" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	fmt.Fprint(w, resp)
+}
+
+func runTest(t *testing.T, api *fakeAdminAPI, args ...string) (string, error) {
+	server := httptest.NewServer(api)
+	defer server.Close()
+	var out strings.Builder
+	err := run(context.Background(), append([]string{"-addr", server.URL, "-token", "test-token"}, args...), &out)
+	return out.String(), err
+}
+
+func TestUsage(t *testing.T) {
+	api := &fakeAdminAPI{}
+	for _, args := range [][]string{
+		{},
+		{"channels"},
+		{"channels", "blah"},
+		{"channels", "inspect"},
+		{"channels", "rm", "1", "2"},
+		{"watch"},
+		{"conns", "ls", "--blah"},
+	} {
+		_, err := runTest(t, api, args...)
+		assert.True(t, errors.Is(err, errUsage), args)
+	}
+	_, err := runTest(t, api, "conns", "kick", "abc")
+	assert.Error(t, err)
+	assert.Empty(t, api.requests)
+}
+
+func TestListChannels(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"GET /admin/channels": `[
+			{"channelId": 0, "channelType": "GLOBAL", "ownerConnId": 1, "subscriberConnIds": [1], "tickIntervalMs": 10, "lastTickDurationMs": 0.5},
+			{"channelId": 1, "channelType": "SUBWORLD", "metadata": "room", "subscriberConnIds": [], "tickIntervalMs": 50, "hasData": true}
+		]`,
+	}}
+	out, err := runTest(t, api, "channels", "ls", "--type", "subworld")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /admin/channels?type=SUBWORLD"}, api.requests)
+	assert.Equal(t, `ID  TYPE      OWNER  SUBS  TICK  LAST TICK  DATA   METADATA
+0   GLOBAL    1      1     10ms  0.50ms     false  
+1   SUBWORLD  -      0     50ms  0.00ms     true   room
+`, out)
+
+	out, err = runTest(t, api, "channels", "ls", "--json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"channelType": "SUBWORLD"`)
+}
+
+func TestInspectChannel(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"GET /admin/channels/1":      `{"channelId": 1, "channelType": "SUBWORLD", "ownerConnId": 2, "tickIntervalMs": 50, "tickFrames": 100, "subscriptions": [{"connId": 2, "options": {"CanUpdateData": true}}]}`,
+		"GET /admin/channels/1/data": `{"text": "hello"}`,
+		"GET /admin/channels/2":      `{"channelId": 2, "channelType": "SUBWORLD"}`,
+	}}
+	out, err := runTest(t, api, "channels", "inspect", "1")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Owner:     2\n")
+	assert.Contains(t, out, "2           {\"CanUpdateData\": true}\n")
+	assert.Contains(t, out, "Data:\n{\n  \"text\": \"hello\"\n}\n")
+
+	out, err = runTest(t, api, "channels", "inspect", "1", "--json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"data": {`)
+	assert.Contains(t, out, `"text": "hello"`)
+
+	// The channel data is not initialized.
+	out, err = runTest(t, api, "channels", "inspect", "2")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Data: not initialized\n")
+	out, err = runTest(t, api, "channels", "inspect", "2", "--json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"data": null`)
+
+	_, err = runTest(t, api, "channels", "inspect", "3")
+	assert.EqualError(t, err, "not found (404)")
+}
+
+func TestMutations(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"DELETE /admin/channels/1":    "",
+		"DELETE /admin/connections/2": "",
+	}}
+	out, err := runTest(t, api, "channels", "rm", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "removed channel 1\n", out)
+	out, err = runTest(t, api, "conns", "kick", "2")
+	assert.NoError(t, err)
+	assert.Equal(t, "kicked connection 2\n", out)
+	assert.Equal(t, []string{"DELETE /admin/channels/1", "DELETE /admin/connections/2"}, api.requests)
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+	err = run(context.Background(), []string{"-addr", server.URL, "-token", "wrong-token", "channels", "rm", "1"}, &strings.Builder{})
+	assert.EqualError(t, err, "invalid admin token (401)")
+}
+
+func TestListConnections(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"GET /admin/connections": `[
+			{"connId": 3, "connType": "CLIENT", "state": "OPEN", "remoteAddr": "127.0.0.1:5000", "rttMs": 12.5, "channelIds": [0, 1]},
+			{"connId": 4, "connType": "CLIENT", "state": "OPEN", "remoteAddr": "127.0.0.1:5001", "detached": true, "channelIds": []}
+		]`,
+	}}
+	out, err := runTest(t, api, "conns", "ls", "--type", "client", "--state", "OPEN")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"GET /admin/connections?state=OPEN&type=CLIENT"}, api.requests)
+	assert.Equal(t, `ID  TYPE    STATE            REMOTE ADDR     RTT     CHANNELS
+3   CLIENT  OPEN             127.0.0.1:5000  12.5ms  0,1
+4   CLIENT  OPEN (detached)  127.0.0.1:5001  0.0ms   
+`, out)
+}
+
+func TestShowFsm(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"GET /admin/connections/3": `{"connId": 3, "connType": "CLIENT", "state": "INIT", "fsm": {"name": "INIT", "msgTypeWhitelist": "1", "timeoutMs": 10000, "timeoutState": "KICKED"}}`,
+	}}
+	out, err := runTest(t, api, "fsm", "show", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, `Connection:  3 (CLIENT)
+State:       INIT
+Whitelist:   1
+Blacklist:   
+Timeout:     10000ms -> KICKED
+`, out)
+
+	out, err = runTest(t, api, "fsm", "show", "3", "--json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `"timeoutState": "KICKED"`)
+}
+
+func TestWatch(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"GET /admin/channels/1/watch": `{"time": "2022-01-01T00:00:00Z", "snapshot": true, "data": {"text": "hello", "num": 1}}
+{"time": "2022-01-01T00:00:01Z", "senderConnId": 2, "data": {"num": 2}}
+{"time": "2022-01-01T00:00:02Z", "snapshot": true, "dropped": 3, "data": {"text": "hello", "num": 5}}
+{"time": "2022-01-01T00:00:03Z", "data": {"num": 6}}
+`,
+	}}
+	out, err := runTest(t, api, "watch", "1")
+	assert.NoError(t, err)
+	lines := strings.Split(out, "\n")
+	if assert.Len(t, lines, 6) {
+		assert.True(t, strings.HasSuffix(lines[0], ` snapshot {"num":1,"text":"hello"}`), lines[0])
+		assert.True(t, strings.HasSuffix(lines[1], ` conn 2 {"num":2}`), lines[1])
+		assert.True(t, strings.HasSuffix(lines[2], ` resync (3 updates dropped) {"num":5,"text":"hello"}`), lines[2])
+		assert.True(t, strings.HasSuffix(lines[3], ` channeld {"num":6}`), lines[3])
+		assert.Equal(t, "channel 1 is removed", lines[4])
+	}
+
+	out, err = runTest(t, api, "watch", "1", "--json")
+	assert.NoError(t, err)
+	assert.Contains(t, out, `{"time": "2022-01-01T00:00:01Z", "senderConnId": 2, "data": {"num": 2}}`)
+}
+
+func TestCapture(t *testing.T) {
+	api := &fakeAdminAPI{responses: map[string]string{
+		"POST /admin/captures":     `{"captureId": 1, "connId": 3, "path": "captures/conn-3.capture", "startTime": "2022-01-01T00:00:00Z"}`,
+		"GET /admin/captures":      `[{"captureId": 1, "connId": 3, "path": "captures/conn-3.capture", "startTime": "2022-01-01T00:00:00Z", "records": 10}, {"captureId": 2, "channelId": 0, "path": "captures/channel-0.capture", "startTime": "2022-01-01T00:00:00Z"}]`,
+		"DELETE /admin/captures/1": `{"captureId": 1, "connId": 3, "path": "captures/conn-3.capture", "startTime": "2022-01-01T00:00:00Z", "records": 12}`,
+	}}
+	for _, args := range [][]string{
+		{"capture", "start"},
+		{"capture", "start", "--conn", "3", "--channel", "0"},
+	} {
+		_, err := runTest(t, api, args...)
+		assert.True(t, errors.Is(err, errUsage), args)
+	}
+	_, err := runTest(t, api, "capture", "start", "--conn", "abc")
+	assert.EqualError(t, err, "invalid id: abc")
+	assert.Empty(t, api.requests)
+
+	out, err := runTest(t, api, "capture", "start", "--conn", "3")
+	assert.NoError(t, err)
+	assert.Equal(t, "started capture 1 of conn 3 to captures/conn-3.capture\n", out)
+	_, err = runTest(t, api, "capture", "start", "--channel", "0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{`{"connId":3}`, `{"channelId":0}`}, api.bodies)
+
+	out, err = runTest(t, api, "capture", "ls")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "ID  TARGET     STARTED")
+	assert.Contains(t, out, "conn 3")
+	assert.Contains(t, out, "channel 0")
+	assert.Contains(t, out, "10       captures/conn-3.capture\n")
+
+	out, err = runTest(t, api, "capture", "stop", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "stopped capture 1 with 12 records in captures/conn-3.capture\n", out)
+}
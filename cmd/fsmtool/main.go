@@ -0,0 +1,75 @@
+// fsmtool validates the connection FSM configs of channeld, and prints them as Graphviz DOT graphs for reviewing.
+//
+// Usage:
+//
+//	fsmtool [-dot] [-o output.dot] config/client_non_authoratative_fsm.json [more FSM configs...]
+//
+// Each config is validated as channeld does with -strictfsm. The errors are printed to stderr, and the exit code is 1 if any config is invalid.
+// With -dot, the graph of each valid config is printed (or written to the -o file if there's only one config):
+//
+//	fsmtool -dot config/server_authoratative_fsm.json | dot -Tsvg > server_fsm.svg
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"channeld.clewcat.com/channeld/pkg/channeld"
+	"channeld.clewcat.com/channeld/pkg/fsm"
+)
+
+func main() {
+	printDot := flag.Bool("dot", false, "print the DOT graph of the valid FSM configs")
+	output := flag.String("o", "", "the file to write the DOT graph to, empty = stdout. Only works with a single FSM config")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [-dot] [-o output.dot] <FSM config>...\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 || (*output != "" && flag.NArg() > 1) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	var w io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	invalid := false
+	for _, path := range flag.Args() {
+		m, err := validate(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", path, err)
+			invalid = true
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "%s: OK\n", path)
+		if *printDot {
+			if err := m.WriteDOT(w, channeld.FsmOptions); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(1)
+			}
+		}
+	}
+	if invalid {
+		os.Exit(1)
+	}
+}
+
+func validate(path string) (fsm.FiniteStateMachine, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fsm.FiniteStateMachine{}, err
+	}
+	return fsm.LoadStrict(bytes, channeld.FsmOptions)
+}
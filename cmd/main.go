@@ -1,55 +1,81 @@
-package main
-
-import (
-	"fmt"
-	"net/http"
-
-	"channeld.clewcat.com/channeld/pkg/channeld"
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-)
-
-func main() {
-
-	/*
-		getopt.Aliases(
-			"sn", "serverNetwork",
-			"sa", "serverAddress",
-			"sfsm", "serverConnFSM",
-
-			"cn", "clientNetwork",
-			"ca", "clientAddress",
-			"cfsm", "clientConnFSM",
-
-			// "cs", "connSize",
-		)
-
-		sn := flag.String("sn", "tcp", "the network type for the server connections")
-		sa := flag.String("sa", ":11288", "the network address for the server connections")
-		sfsm := flag.String("sfsm", "../config/server_authoratative_fsm.json", "the path to the server FSM config")
-		cn := flag.String("cn", "tcp", "the network type for the client connections")
-		ca := flag.String("ca", ":12108", "the network address for the client connections")
-		cfsm := flag.String("cfsm", "../config/client_non_authoratative_fsm.json", "the path to the client FSM config")
-		ct := flag.Uint("ct", 0, "The compression type, 0 = No, 1 = Snappy")
-
-		//getopt.Parse()
-		flag.Parse()
-	*/
-
-	if err := channeld.GlobalSettings.ParseFlag(); err != nil {
-		fmt.Printf("error parsing CLI flag: %v\n", err)
-	}
-	channeld.StartProfiling()
-	channeld.InitLogsAndMetrics()
-	channeld.InitConnections(channeld.GlobalSettings.ServerFSM, channeld.GlobalSettings.ClientFSM)
-	channeld.InitChannels()
-
-	// Setup Prometheus
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(":8080", nil)
-
-	go channeld.StartListening(proto.ConnectionType_SERVER, channeld.GlobalSettings.ServerNetwork, channeld.GlobalSettings.ServerAddress)
-	// FIXME: After all the server connections are established, the client connection should be listened.*/
-	channeld.StartListening(proto.ConnectionType_CLIENT, channeld.GlobalSettings.ClientNetwork, channeld.GlobalSettings.ClientAddress)
-
-}
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/channeld"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func main() {
+
+	/*
+		getopt.Aliases(
+			"sn", "serverNetwork",
+			"sa", "serverAddress",
+			"sfsm", "serverConnFSM",
+
+			"cn", "clientNetwork",
+			"ca", "clientAddress",
+			"cfsm", "clientConnFSM",
+
+			// "cs", "connSize",
+		)
+
+		sn := flag.String("sn", "tcp", "the network type for the server connections")
+		sa := flag.String("sa", ":11288", "the network address for the server connections")
+		sfsm := flag.String("sfsm", "../config/server_authoratative_fsm.json", "the path to the server FSM config")
+		cn := flag.String("cn", "tcp", "the network type for the client connections")
+		ca := flag.String("ca", ":12108", "the network address for the client connections")
+		cfsm := flag.String("cfsm", "../config/client_non_authoratative_fsm.json", "the path to the client FSM config")
+		ct := flag.Uint("ct", 0, "The compression type, 0 = No, 1 = Snappy")
+
+		//getopt.Parse()
+		flag.Parse()
+	*/
+
+	if err := channeld.GlobalSettings.ParseFlag(); err != nil {
+		fmt.Printf("error parsing CLI flag: %v\n", err)
+	}
+	channeld.StartProfiling()
+	defer channeld.StopProfiling()
+	channeld.InitLogsAndMetrics()
+
+	// The profile used to be saved on SIGQUIT as well, so SIGQUIT also shuts down gracefully.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGQUIT)
+	defer stop()
+
+	server := channeld.DefaultServer()
+	if err := server.Start(ctx); err != nil {
+		fmt.Printf("error starting channeld: %v\n", err)
+		// os.Exit skips the deferred calls, so the profile is saved first.
+		channeld.StopProfiling()
+		os.Exit(1)
+	}
+
+	// Setup Prometheus
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", channeld.HandleHealthz)
+	http.HandleFunc("/readyz", channeld.HandleReadyz)
+	if channeld.GlobalSettings.AdminToken != "" {
+		http.Handle("/admin/", channeld.AdminHandler(channeld.GlobalSettings.AdminToken))
+	}
+	go http.ListenAndServe(":8080", nil)
+
+	<-ctx.Done()
+	// Another signal terminates the process immediately.
+	stop()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(channeld.GlobalSettings.ShutdownTimeoutMs)*time.Millisecond)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		fmt.Printf("error shutting down channeld: %v\n", err)
+		channeld.StopProfiling()
+		os.Exit(1)
+	}
+}
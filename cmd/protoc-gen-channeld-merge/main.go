@@ -0,0 +1,374 @@
+// protoc-gen-channeld-merge generates the Merge method of the MergeableChannelData interface for the channel data messages,
+// so channeld doesn't fall back to the reflection-based merge, which is more than 10 times slower.
+//
+// Usage:
+//
+//	protoc --go_out=. --channeld-merge_out=. --channeld-merge_opt=messages=TankGameChannelData:ChatChannelData example.proto
+//
+// Parameters:
+//
+//	messages             The names of the top-level messages to generate the Merge method for, separated by ':'. Empty = all.
+//	options_import_path  The Go import path of ChannelDataMergeOptions. Empty = the same package as the generated file.
+//
+// The generated Merge behaves like channeld's reflection-based merge:
+//   - The fields are merged as proto.Merge does. The message fields are merged recursively, and the list elements,
+//     the map values and the bytes are deep copied.
+//   - The top-level lists are replaced if ShouldReplaceList is set and the source has the list,
+//     and then truncated to ListSizeLimit, from the top if TruncateTop is set.
+//   - If ShouldCheckRemovableMapField is set, the entries of the top-level maps with 'removed = true' in the source are deleted.
+//     Unlike the reflection-based merge, the removed entries that are already in the destination are not checked.
+//   - The unknown fields and the extensions are not merged.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+const (
+	errorsPackage   = protogen.GoImportPath("errors")
+	protobufPackage = protogen.GoImportPath("google.golang.org/protobuf/proto")
+)
+
+type params struct {
+	messages          string
+	optionsImportPath string
+}
+
+func main() {
+	var flags flag.FlagSet
+	p := &params{}
+	flags.StringVar(&p.messages, "messages", "", "the names of the top-level messages to generate the Merge method for, separated by ':'")
+	flags.StringVar(&p.optionsImportPath, "options_import_path", "", "the Go import path of ChannelDataMergeOptions")
+
+	protogen.Options{ParamFunc: flags.Set}.Run(func(gen *protogen.Plugin) error {
+		return generate(gen, p)
+	})
+}
+
+func generate(gen *protogen.Plugin, p *params) error {
+	targets := make(map[string]bool)
+	for _, name := range strings.Split(p.messages, ":") {
+		if name != "" {
+			targets[name] = true
+		}
+	}
+
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		messages := make([]*protogen.Message, 0)
+		for _, m := range f.Messages {
+			if len(targets) == 0 || targets[string(m.Desc.Name())] {
+				messages = append(messages, m)
+			}
+		}
+		if len(messages) == 0 {
+			continue
+		}
+
+		optionsImportPath := f.GoImportPath
+		if p.optionsImportPath != "" {
+			optionsImportPath = protogen.GoImportPath(p.optionsImportPath)
+		}
+		fg := &fileGenerator{
+			g:            gen.NewGeneratedFile(f.GeneratedFilenamePrefix+"_merge.pb.go", f.GoImportPath),
+			file:         f,
+			optionsIdent: optionsImportPath.Ident("ChannelDataMergeOptions"),
+			helpers:      make(map[*protogen.Message]bool),
+		}
+		fg.generate(messages)
+	}
+	return nil
+}
+
+type fileGenerator struct {
+	g            *protogen.GeneratedFile
+	file         *protogen.File
+	optionsIdent protogen.GoIdent
+	// The messages in the file that the merge and clone functions are generated for, as they are referred by the fields.
+	helpers     map[*protogen.Message]bool
+	helperQueue []*protogen.Message
+}
+
+func (fg *fileGenerator) generate(messages []*protogen.Message) {
+	g := fg.g
+	g.P("// Code generated by protoc-gen-channeld-merge. DO NOT EDIT.")
+	g.P("// source: ", fg.file.Desc.Path())
+	g.P()
+	g.P("package ", fg.file.GoPackageName)
+	g.P()
+
+	for _, m := range messages {
+		fg.generateMerge(m)
+	}
+	// Generating a helper may require more helpers.
+	for len(fg.helperQueue) > 0 {
+		m := fg.helperQueue[0]
+		fg.helperQueue = fg.helperQueue[1:]
+		fg.generateHelpers(m)
+	}
+}
+
+func (fg *fileGenerator) generateMerge(m *protogen.Message) {
+	g := fg.g
+	g.P("func (dst *", m.GoIdent.GoName, ") Merge(src ", protobufPackage.Ident("Message"), ", options *", fg.optionsIdent, ") error {")
+	g.P("srcMsg, ok := src.(*", m.GoIdent.GoName, ")")
+	g.P("if !ok {")
+	g.P("return ", errorsPackage.Ident("New"), "(\"src is not a ", m.GoIdent.GoName, "\")")
+	g.P("}")
+	g.P()
+	fg.generateFields(m, "srcMsg", true)
+	g.P()
+	g.P("return nil")
+	g.P("}")
+	g.P()
+}
+
+func (fg *fileGenerator) generateHelpers(m *protogen.Message) {
+	g := fg.g
+	g.P("func ", fg.mergeFuncName(m), "(dst, src *", m.GoIdent.GoName, ") {")
+	g.P("if src == nil {")
+	g.P("return")
+	g.P("}")
+	g.P()
+	fg.generateFields(m, "src", false)
+	g.P("}")
+	g.P()
+	// The nil list element or map value becomes an empty message, as proto.Merge does.
+	g.P("func ", fg.cloneFuncName(m), "(src *", m.GoIdent.GoName, ") *", m.GoIdent.GoName, " {")
+	g.P("dst := &", m.GoIdent.GoName, "{}")
+	g.P(fg.mergeFuncName(m), "(dst, src)")
+	g.P("return dst")
+	g.P("}")
+	g.P()
+}
+
+func (fg *fileGenerator) mergeFuncName(m *protogen.Message) string {
+	return "merge" + m.GoIdent.GoName
+}
+
+func (fg *fileGenerator) cloneFuncName(m *protogen.Message) string {
+	return "clone" + m.GoIdent.GoName
+}
+
+// Only the messages in the same file have the generated helpers. The others are merged by proto.Merge.
+func (fg *fileGenerator) hasHelpers(m *protogen.Message) bool {
+	if m.Desc.ParentFile().Path() != fg.file.Desc.Path() {
+		return false
+	}
+	if !fg.helpers[m] {
+		fg.helpers[m] = true
+		fg.helperQueue = append(fg.helperQueue, m)
+	}
+	return true
+}
+
+// Returns the expression that merges the src message into the dst message. Both are not nil.
+func (fg *fileGenerator) mergeMessageExpr(m *protogen.Message, dst string, src string) string {
+	if fg.hasHelpers(m) {
+		return fmt.Sprintf("%s(%s, %s)", fg.mergeFuncName(m), dst, src)
+	}
+	return fmt.Sprintf("%s(%s, %s)", fg.g.QualifiedGoIdent(protobufPackage.Ident("Merge")), dst, src)
+}
+
+// Returns the expression of the deep copy of the value of the field (or the list element, or the map value).
+func (fg *fileGenerator) cloneExpr(field *protogen.Field, v string) string {
+	switch field.Desc.Kind() {
+	case protoreflect.BytesKind:
+		return fmt.Sprintf("append([]byte{}, %s...)", v)
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		if fg.hasHelpers(field.Message) {
+			return fmt.Sprintf("%s(%s)", fg.cloneFuncName(field.Message), v)
+		}
+		return fmt.Sprintf("%s(%s).(*%s)", fg.g.QualifiedGoIdent(protobufPackage.Ident("Clone")), v, fg.g.QualifiedGoIdent(field.Message.GoIdent))
+	default:
+		return v
+	}
+}
+
+func (fg *fileGenerator) goType(field *protogen.Field) string {
+	switch field.Desc.Kind() {
+	case protoreflect.BoolKind:
+		return "bool"
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return "int32"
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return "uint32"
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return "int64"
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return "uint64"
+	case protoreflect.FloatKind:
+		return "float32"
+	case protoreflect.DoubleKind:
+		return "float64"
+	case protoreflect.StringKind:
+		return "string"
+	case protoreflect.BytesKind:
+		return "[]byte"
+	case protoreflect.EnumKind:
+		return fg.g.QualifiedGoIdent(field.Enum.GoIdent)
+	default:
+		return "*" + fg.g.QualifiedGoIdent(field.Message.GoIdent)
+	}
+}
+
+func isRemovable(m *protogen.Message) bool {
+	for _, field := range m.Fields {
+		if field.Desc.Name() == "removed" && field.Desc.Kind() == protoreflect.BoolKind && !field.Desc.IsList() {
+			return true
+		}
+	}
+	return false
+}
+
+func (fg *fileGenerator) generateFields(m *protogen.Message, src string, topLevel bool) {
+	for i, field := range m.Fields {
+		if field.Oneof != nil && !field.Oneof.Desc.IsSynthetic() && field.Oneof.Fields[0] != field {
+			// The oneof is generated once
+			continue
+		}
+		if i > 0 {
+			fg.g.P()
+		}
+		if field.Oneof != nil && !field.Oneof.Desc.IsSynthetic() {
+			fg.generateOneof(field.Oneof, src)
+		} else if field.Desc.IsMap() {
+			fg.generateMap(field, src, topLevel)
+		} else if field.Desc.IsList() {
+			fg.generateList(field, src, topLevel)
+		} else {
+			fg.generateSingular(field, src)
+		}
+	}
+}
+
+func (fg *fileGenerator) generateSingular(field *protogen.Field, src string) {
+	g := fg.g
+	dstField := "dst." + field.GoName
+	srcField := src + "." + field.GoName
+	switch {
+	case field.Message != nil:
+		g.P("if ", srcField, " != nil {")
+		g.P("if ", dstField, " == nil {")
+		g.P(dstField, " = &", field.Message.GoIdent, "{}")
+		g.P("}")
+		g.P(fg.mergeMessageExpr(field.Message, dstField, srcField))
+		g.P("}")
+	case field.Desc.Kind() == protoreflect.BytesKind:
+		if field.Desc.HasPresence() {
+			g.P("if ", srcField, " != nil {")
+		} else {
+			g.P("if len(", srcField, ") > 0 {")
+		}
+		g.P(dstField, " = ", fg.cloneExpr(field, srcField))
+		g.P("}")
+	case field.Desc.HasPresence():
+		// The optional scalar is a pointer.
+		g.P("if ", srcField, " != nil {")
+		g.P("v := *", srcField)
+		g.P(dstField, " = &v")
+		g.P("}")
+	case field.Desc.Kind() == protoreflect.BoolKind:
+		g.P("if ", srcField, " {")
+		g.P(dstField, " = true")
+		g.P("}")
+	case field.Desc.Kind() == protoreflect.StringKind:
+		g.P("if ", srcField, " != \"\" {")
+		g.P(dstField, " = ", srcField)
+		g.P("}")
+	default:
+		g.P("if ", srcField, " != 0 {")
+		g.P(dstField, " = ", srcField)
+		g.P("}")
+	}
+}
+
+func (fg *fileGenerator) generateList(field *protogen.Field, src string, topLevel bool) {
+	g := fg.g
+	dstField := "dst." + field.GoName
+	srcField := src + "." + field.GoName
+	elemType := fg.goType(field)
+	deepCopy := field.Message != nil || field.Desc.Kind() == protoreflect.BytesKind
+
+	appendElements := func() {
+		if deepCopy {
+			g.P("for _, v := range ", srcField, " {")
+			g.P(dstField, " = append(", dstField, ", ", fg.cloneExpr(field, "v"), ")")
+			g.P("}")
+		} else {
+			g.P(dstField, " = append(", dstField, ", ", srcField, "...)")
+		}
+	}
+
+	if !topLevel {
+		appendElements()
+		return
+	}
+
+	// The list is kept if src doesn't have the list.
+	g.P("if options.ShouldReplaceList && len(", srcField, ") > 0 {")
+	if deepCopy {
+		g.P(dstField, " = make([]", elemType, ", 0, len(", srcField, "))")
+		appendElements()
+	} else {
+		g.P(dstField, " = append([]", elemType, "{}, ", srcField, "...)")
+	}
+	g.P("} else {")
+	appendElements()
+	g.P("}")
+	g.P("if options.ListSizeLimit > 0 && len(", dstField, ") > int(options.ListSizeLimit) {")
+	g.P("if options.TruncateTop {")
+	g.P(dstField, " = ", dstField, "[len(", dstField, ")-int(options.ListSizeLimit):]")
+	g.P("} else {")
+	g.P(dstField, " = ", dstField, "[:options.ListSizeLimit]")
+	g.P("}")
+	g.P("}")
+}
+
+func (fg *fileGenerator) generateMap(field *protogen.Field, src string, topLevel bool) {
+	g := fg.g
+	dstField := "dst." + field.GoName
+	srcField := src + "." + field.GoName
+	keyField := field.Message.Fields[0]
+	valueField := field.Message.Fields[1]
+
+	g.P("if ", dstField, " == nil && len(", srcField, ") > 0 {")
+	g.P(dstField, " = make(map[", fg.goType(keyField), "]", fg.goType(valueField), ", len(", srcField, "))")
+	g.P("}")
+	g.P("for k, v := range ", srcField, " {")
+	if topLevel && valueField.Message != nil && isRemovable(valueField.Message) {
+		g.P("if options.ShouldCheckRemovableMapField && v.GetRemoved() {")
+		g.P("delete(", dstField, ", k)")
+		g.P("continue")
+		g.P("}")
+	}
+	g.P(dstField, "[k] = ", fg.cloneExpr(valueField, "v"))
+	g.P("}")
+}
+
+func (fg *fileGenerator) generateOneof(oneof *protogen.Oneof, src string) {
+	g := fg.g
+	dstField := "dst." + oneof.GoName
+	g.P("switch s := ", src, ".", oneof.GoName, ".(type) {")
+	for _, field := range oneof.Fields {
+		g.P("case *", field.GoIdent, ":")
+		if field.Message != nil {
+			// Merge if the same field of the oneof is set, otherwise replace.
+			g.P("if d, ok := ", dstField, ".(*", field.GoIdent, "); ok && d.", field.GoName, " != nil && s.", field.GoName, " != nil {")
+			g.P(fg.mergeMessageExpr(field.Message, "d."+field.GoName, "s."+field.GoName))
+			g.P("} else {")
+			g.P(dstField, " = &", field.GoIdent, "{", field.GoName, ": ", fg.cloneExpr(field, "s."+field.GoName), "}")
+			g.P("}")
+		} else {
+			g.P(dstField, " = &", field.GoIdent, "{", field.GoName, ": ", fg.cloneExpr(field, "s."+field.GoName), "}")
+		}
+	}
+	g.P("}")
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/compiler/protogen"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+const goldenFile = "../../proto/test_codegen_merge.pb.go"
+
+// The generated code is checked in as proto/test_codegen_merge.pb.go, and compared with reflectMerge in pkg/channeld.
+// Run `go test ./cmd/protoc-gen-channeld-merge -update` to regenerate it.
+func TestGolden(t *testing.T) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{proto.File_test_codegen_proto.Path()},
+		Parameter:      protobuf.String("messages=TestCodegenMessage"),
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(anypb.File_google_protobuf_any_proto),
+			protodesc.ToFileDescriptorProto(proto.File_test_codegen_proto),
+		},
+	}
+
+	var flags flag.FlagSet
+	p := &params{}
+	flags.StringVar(&p.messages, "messages", "", "")
+	flags.StringVar(&p.optionsImportPath, "options_import_path", "", "")
+	gen, err := protogen.Options{ParamFunc: flags.Set}.New(req)
+	assert.NoError(t, err)
+	assert.NoError(t, generate(gen, p))
+	resp := gen.Response()
+	assert.Nil(t, resp.Error)
+	assert.Len(t, resp.File, 1)
+	content := resp.File[0].GetContent()
+
+	if *update {
+		assert.NoError(t, ioutil.WriteFile(goldenFile, []byte(content), 0644))
+		return
+	}
+	golden, err := ioutil.ReadFile(goldenFile)
+	assert.NoError(t, err)
+	assert.Equal(t, strings.ReplaceAll(string(golden), "\r\n", "\n"), content)
+}
+
+func TestMessagesParam(t *testing.T) {
+	req := &pluginpb.CodeGeneratorRequest{
+		FileToGenerate: []string{proto.File_test_codegen_proto.Path()},
+		ProtoFile: []*descriptorpb.FileDescriptorProto{
+			protodesc.ToFileDescriptorProto(anypb.File_google_protobuf_any_proto),
+			protodesc.ToFileDescriptorProto(proto.File_test_codegen_proto),
+		},
+	}
+	gen, err := protogen.Options{}.New(req)
+	assert.NoError(t, err)
+	// No message matches
+	assert.NoError(t, generate(gen, &params{messages: "Foo:Bar"}))
+	assert.Empty(t, gen.Response().File)
+
+	gen, _ = protogen.Options{}.New(req)
+	assert.NoError(t, generate(gen, &params{optionsImportPath: "example.com/channeld/proto"}))
+	assert.Len(t, gen.Response().File, 1)
+	content := gen.Response().File[0].GetContent()
+	assert.Contains(t, content, "options *proto1.ChannelDataMergeOptions")
+	assert.Contains(t, content, "proto1 \"example.com/channeld/proto\"")
+}
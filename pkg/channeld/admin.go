@@ -0,0 +1,684 @@
+package channeld
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// How long the admin API waits for a channel's goroutine to run the query or the mutation.
+const adminChannelTimeout = time.Second
+
+// The reason in the DISCONNECT notice that is sent to the connection kicked by the admin API.
+const KickedReason = "kicked by the admin"
+
+type AdminChannelInfo struct {
+	ChannelId          uint32   `json:"channelId"`
+	ChannelType        string   `json:"channelType"`
+	OwnerConnId        uint32   `json:"ownerConnId"` // 0 = no owner
+	Metadata           string   `json:"metadata"`
+	SubscriberConnIds  []uint32 `json:"subscriberConnIds"`
+	TickIntervalMs     int64    `json:"tickIntervalMs"`
+	TickFrames         int      `json:"tickFrames"`
+	LastTickDurationMs float64  `json:"lastTickDurationMs"`
+	HasData            bool     `json:"hasData"`
+	// Only in the channel detail.
+	Subscriptions []AdminSubscriptionInfo `json:"subscriptions,omitempty"`
+}
+
+type AdminSubscriptionInfo struct {
+	ConnId  uint32          `json:"connId"`
+	Options json.RawMessage `json:"options"` // The ChannelSubscriptionOptions in protojson
+}
+
+// A line of the newline-delimited JSON stream of watching the channel data.
+type AdminDataEvent struct {
+	Time     time.Time `json:"time"`
+	Snapshot bool      `json:"snapshot,omitempty"` // The first event is the whole data, if the data is initialized.
+	// The number of the updates that were dropped as the watcher was too slow. Only set in the snapshot that resyncs the watcher.
+	// The snapshot doesn't include the update in the next event yet.
+	Dropped      uint32          `json:"dropped,omitempty"`
+	SenderConnId uint32          `json:"senderConnId,omitempty"` // 0 = the update is made by channeld
+	Data         json.RawMessage `json:"data"`                   // The update message (or the whole data) in protojson
+}
+
+type AdminFsmStateInfo struct {
+	Name             string `json:"name"`
+	MsgTypeWhitelist string `json:"msgTypeWhitelist"`
+	MsgTypeBlacklist string `json:"msgTypeBlacklist"`
+	TimeoutMs        uint32 `json:"timeoutMs"`
+	TimeoutState     string `json:"timeoutState"`
+	Terminal         bool   `json:"terminal"`
+}
+
+type AdminConnectionInfo struct {
+	ConnId     uint32   `json:"connId"`
+	ConnType   string   `json:"connType"`
+	State      string   `json:"state"` // The name of the current FSM state
+	RemoteAddr string   `json:"remoteAddr"`
+	Detached   bool     `json:"detached"`
+	RttMs      float64  `json:"rttMs"`
+	ChannelIds []uint32 `json:"channelIds"` // The subscribed channels
+	// Only in the connection detail.
+	Fsm *AdminFsmStateInfo `json:"fsm,omitempty"`
+}
+
+// Returns the handler of the admin HTTP API, which requires the token in the "Authorization: Bearer <token>" header:
+//
+//	GET    /admin/channels                          List the channels. Filters: ?type=SUBWORLD
+//	GET    /admin/channels/{id}                     Get the channel and its subscriptions
+//	GET    /admin/channels/{id}/data                Dump the channel data in protojson
+//	GET    /admin/channels/{id}/watch               Stream the channel data updates as AdminDataEvents in newline-delimited JSON
+//	DELETE /admin/channels/{id}                     Remove the channel
+//	PATCH  /admin/channels/{id}/subs/{connId}       Set the ChannelSubscriptionOptions fields present in the body (protojson) to the subscription
+//	GET    /admin/connections                       List the connections. Filters: ?type=CLIENT&state=OPEN
+//	GET    /admin/connections/{id}                  Get the connection and its FSM state
+//	DELETE /admin/connections/{id}                  Kick the connection
+//	GET    /admin/captures                          List the running packet captures
+//	POST   /admin/captures                          Start capturing the connection or the channel in the body, e.g. {"connId": 3}
+//	DELETE /admin/captures/{id}                     Stop the packet capture
+//
+// The channels are only read and changed in their own goroutines, via the inMsgQueue.
+func AdminHandler(token string) http.Handler {
+	return defaultServer.AdminHandler(token)
+}
+
+func (s *Server) AdminHandler(token string) http.Handler {
+	return &adminHandler{server: s, token: []byte(token)}
+}
+
+type adminHandler struct {
+	server *Server
+	token  []byte
+}
+
+type adminError struct {
+	status  int
+	message string
+}
+
+func (e *adminError) Error() string {
+	return e.message
+}
+
+var errAdminChannelTimeout = &adminError{http.StatusServiceUnavailable, "the channel didn't respond in time"}
+
+const (
+	adminMutationPending int32 = iota
+	adminMutationStarted
+	adminMutationCancelled
+)
+
+// Runs the mutation in the channel's goroutine and waits for it. Unlike executeAndWait, the mutation is cancelled
+// if it hasn't started when the wait times out, so the timeout response always means nothing has been changed.
+// Once started, the mutation is waited for until it's done.
+func adminMutate(ch *Channel, f func(ch *Channel)) bool {
+	phase := adminMutationPending
+	done := make(chan struct{})
+	ch.executeAndWait(func(ch *Channel) {
+		if !atomic.CompareAndSwapInt32(&phase, adminMutationPending, adminMutationStarted) {
+			return
+		}
+		defer close(done)
+		f(ch)
+	}, adminChannelTimeout)
+	if atomic.CompareAndSwapInt32(&phase, adminMutationPending, adminMutationCancelled) {
+		return false
+	}
+	<-done
+	return true
+}
+
+// The result that writes the response by itself, e.g. the stream of watching the channel data.
+type adminStream func(w http.ResponseWriter)
+
+func (h *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), h.token) != 1 {
+		writeAdminResult(w, nil, &adminError{http.StatusUnauthorized, "invalid admin token"})
+		return
+	}
+
+	result, err := h.route(r)
+	if err != nil {
+		h.server.logger.Warn("failed to handle the admin request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+			zap.Error(err),
+		)
+	} else if r.Method != http.MethodGet {
+		h.server.logger.Info("handled the admin request", zap.String("method", r.Method), zap.String("path", r.URL.Path))
+	}
+	writeAdminResult(w, result, err)
+}
+
+func (h *adminHandler) route(r *http.Request) (interface{}, error) {
+	s := h.server
+	segs := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin"), "/"), "/")
+	notFound := &adminError{http.StatusNotFound, "no such API: " + r.Method + " " + r.URL.Path}
+
+	switch segs[0] {
+	case "channels":
+		if len(segs) == 1 {
+			if r.Method != http.MethodGet {
+				return nil, notFound
+			}
+			return s.adminListChannels(r.URL.Query().Get("type"))
+		}
+		ch, err := s.adminGetChannel(segs[1])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(segs) == 2 && r.Method == http.MethodGet:
+			return adminChannelDetail(ch)
+		case len(segs) == 2 && r.Method == http.MethodDelete:
+			return nil, adminRemoveChannel(ch)
+		case len(segs) == 3 && segs[2] == "data" && r.Method == http.MethodGet:
+			return adminChannelData(ch)
+		case len(segs) == 3 && segs[2] == "watch" && r.Method == http.MethodGet:
+			return adminWatchChannelData(r.Context(), ch)
+		case len(segs) == 4 && segs[2] == "subs" && r.Method == http.MethodPatch:
+			return adminUpdateSubOptions(ch, segs[3], r.Body)
+		}
+	case "connections":
+		if len(segs) == 1 {
+			if r.Method != http.MethodGet {
+				return nil, notFound
+			}
+			query := r.URL.Query()
+			return s.adminListConnections(query.Get("type"), query.Get("state"))
+		}
+		c, err := s.adminGetConnection(segs[1])
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case len(segs) == 2 && r.Method == http.MethodGet:
+			return adminConnectionDetail(c)
+		case len(segs) == 2 && r.Method == http.MethodDelete:
+			return nil, adminKickConnection(c)
+		}
+	case "captures":
+		switch {
+		case len(segs) == 1 && r.Method == http.MethodGet:
+			return s.ListCaptures(), nil
+		case len(segs) == 1 && r.Method == http.MethodPost:
+			return s.adminStartCapture(r.Body)
+		case len(segs) == 2 && r.Method == http.MethodDelete:
+			return s.adminStopCapture(segs[1])
+		}
+	}
+	return nil, notFound
+}
+
+func writeAdminResult(w http.ResponseWriter, result interface{}, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		var adminErr *adminError
+		if errors.As(err, &adminErr) {
+			status = adminErr.status
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if stream, ok := result.(adminStream); ok {
+		stream(w)
+		return
+	}
+	json.NewEncoder(w).Encode(result)
+}
+
+func (s *Server) adminGetChannel(idStr string) (*Channel, error) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid channel id: " + idStr}
+	}
+	ch := s.GetChannel(ChannelId(id))
+	if ch == nil || ch.IsRemoving() {
+		return nil, &adminError{http.StatusNotFound, "channel not found: " + idStr}
+	}
+	return ch, nil
+}
+
+func (s *Server) adminGetConnection(idStr string) (*Connection, error) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid connection id: " + idStr}
+	}
+	c := s.GetConnection(ConnectionId(id))
+	if c == nil {
+		return nil, &adminError{http.StatusNotFound, "connection not found: " + idStr}
+	}
+	return c, nil
+}
+
+// Called in the channel's goroutine.
+func (ch *Channel) adminInfo() AdminChannelInfo {
+	info := AdminChannelInfo{
+		ChannelId:          uint32(ch.id),
+		ChannelType:        ch.channelType.String(),
+		Metadata:           ch.metadata,
+		SubscriberConnIds:  make([]uint32, 0, len(ch.subscribedConnections)),
+		TickIntervalMs:     ch.getTickInterval().Milliseconds(),
+		TickFrames:         ch.tickFrames,
+		LastTickDurationMs: float64(atomic.LoadInt64(&ch.lastTickDuration)) / float64(time.Millisecond),
+		HasData:            ch.data != nil && ch.data.msg != nil,
+	}
+	if ch.ownerConnection != nil {
+		info.OwnerConnId = uint32(ch.ownerConnection.id)
+	}
+	for connId := range ch.subscribedConnections {
+		info.SubscriberConnIds = append(info.SubscriberConnIds, uint32(connId))
+	}
+	sort.Slice(info.SubscriberConnIds, func(i, j int) bool {
+		return info.SubscriberConnIds[i] < info.SubscriberConnIds[j]
+	})
+	return info
+}
+
+// Collects the info of all the channels in their goroutines. The channels that don't respond within the timeout are left out.
+func (s *Server) adminChannelInfos() []AdminChannelInfo {
+	channels := make([]*Channel, 0)
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		if ch := v.(*Channel); !ch.IsRemoving() {
+			channels = append(channels, ch)
+		}
+		return true
+	})
+
+	results := make(chan AdminChannelInfo, len(channels))
+	for _, ch := range channels {
+		ch.execute(func(ch *Channel) {
+			results <- ch.adminInfo()
+		})
+	}
+	infos := make([]AdminChannelInfo, 0, len(channels))
+	timeout := time.After(adminChannelTimeout)
+	for len(infos) < len(channels) {
+		select {
+		case info := <-results:
+			infos = append(infos, info)
+		case <-timeout:
+			s.logger.Warn("some channels didn't respond to the admin API in time", zap.Int("missing", len(channels)-len(infos)))
+			return infos
+		}
+	}
+	return infos
+}
+
+func (s *Server) adminListChannels(typeFilter string) (interface{}, error) {
+	infos := make([]AdminChannelInfo, 0)
+	for _, info := range s.adminChannelInfos() {
+		if typeFilter == "" || strings.EqualFold(typeFilter, info.ChannelType) {
+			infos = append(infos, info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ChannelId < infos[j].ChannelId
+	})
+	return infos, nil
+}
+
+func adminChannelDetail(ch *Channel) (interface{}, error) {
+	var info AdminChannelInfo
+	var err error
+	if !ch.executeAndWait(func(ch *Channel) {
+		info = ch.adminInfo()
+		info.Subscriptions = make([]AdminSubscriptionInfo, 0, len(ch.subscribedConnections))
+		for _, connId := range info.SubscriberConnIds {
+			var options []byte
+			options, err = protojson.Marshal(&ch.subscribedConnections[ConnectionId(connId)].options)
+			if err != nil {
+				return
+			}
+			info.Subscriptions = append(info.Subscriptions, AdminSubscriptionInfo{ConnId: connId, Options: options})
+		}
+	}, adminChannelTimeout) {
+		return nil, errAdminChannelTimeout
+	}
+	return info, err
+}
+
+func adminChannelData(ch *Channel) (interface{}, error) {
+	var data []byte
+	var err error
+	if !ch.executeAndWait(func(ch *Channel) {
+		if ch.data == nil || ch.data.msg == nil {
+			err = &adminError{http.StatusNotFound, "the channel data is not initialized"}
+			return
+		}
+		data, err = protojson.Marshal(ch.data.msg)
+	}, adminChannelTimeout) {
+		return nil, errAdminChannelTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(data), nil
+}
+
+// Fills the time and the data of the event, and marshals it into a line of the stream.
+func marshalAdminDataEvent(event AdminDataEvent, msg Message) ([]byte, error) {
+	data, err := protojson.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	event.Time = time.Now()
+	event.Data = data
+	return json.Marshal(event)
+}
+
+// Sends the update to the admin API clients that are watching the channel data. Called in the channel's goroutine, before the update is merged.
+// The channel's goroutine never blocks for a slow watcher. The updates are dropped instead, and once the watcher catches up,
+// it's resynced with a snapshot that has the number of the dropped updates.
+func (ch *Channel) notifyDataWatchers(sender *Connection, updateMsg Message) {
+	if len(ch.dataWatchers) == 0 {
+		return
+	}
+	updateEvent := AdminDataEvent{}
+	if sender != nil {
+		updateEvent.SenderConnId = uint32(sender.id)
+	}
+	event, err := marshalAdminDataEvent(updateEvent, updateMsg)
+	if err != nil {
+		ch.Logger().Error("failed to marshal the channel data update for the watchers", zap.Error(err))
+		return
+	}
+	for watcher, dropped := range ch.dataWatchers {
+		if dropped > 0 && cap(watcher)-len(watcher) >= 2 && ch.data != nil && ch.data.msg != nil {
+			resync, err := marshalAdminDataEvent(AdminDataEvent{Snapshot: true, Dropped: dropped}, ch.data.msg)
+			if err != nil {
+				ch.Logger().Error("failed to marshal the channel data for the watchers", zap.Error(err))
+				continue
+			}
+			// Only the channel's goroutine sends to the watcher, so the free space checked above can't be taken.
+			watcher <- resync
+			ch.dataWatchers[watcher] = 0
+			dropped = 0
+		}
+		if dropped > 0 {
+			ch.dataWatchers[watcher]++
+			continue
+		}
+		select {
+		case watcher <- event:
+		default:
+			ch.Logger().Debug("dropped the channel data update as the watcher is too slow")
+			ch.dataWatchers[watcher] = 1
+		}
+	}
+}
+
+func adminWatchChannelData(ctx context.Context, ch *Channel) (interface{}, error) {
+	watcher := make(chan []byte, 256)
+	var snapshot []byte
+	var err error
+	if !ch.executeAndWait(func(ch *Channel) {
+		if ch.data != nil && ch.data.msg != nil {
+			if snapshot, err = marshalAdminDataEvent(AdminDataEvent{Snapshot: true}, ch.data.msg); err != nil {
+				return
+			}
+		}
+		if ch.dataWatchers == nil {
+			ch.dataWatchers = make(map[chan<- []byte]uint32)
+		}
+		ch.dataWatchers[watcher] = 0
+	}, adminChannelTimeout) {
+		ch.execute(func(ch *Channel) {
+			delete(ch.dataWatchers, watcher)
+		})
+		return nil, errAdminChannelTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return adminStream(func(w http.ResponseWriter) {
+		defer ch.execute(func(ch *Channel) {
+			delete(ch.dataWatchers, watcher)
+		})
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		write := func(event []byte) bool {
+			if _, err := w.Write(append(event, '\n')); err != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return true
+		}
+		if snapshot != nil && !write(snapshot) {
+			return
+		}
+
+		// The stream ends when the client goes away or the channel is removed.
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event := <-watcher:
+				if !write(event) {
+					return
+				}
+			case <-ch.removed:
+				return
+			}
+		}
+	}), nil
+}
+
+func adminRemoveChannel(ch *Channel) error {
+	s := ch.server
+	if ch == s.globalChannel {
+		return &adminError{http.StatusBadRequest, "the GLOBAL channel can't be removed"}
+	}
+	if !adminMutate(ch, func(ch *Channel) {
+		// Notify the subscribers like handleRemoveChannel does.
+		for connId := range ch.subscribedConnections {
+			if c := s.GetConnection(connId); c != nil {
+				c.Send(MessageContext{
+					MsgType:   proto.MessageType_REMOVE_CHANNEL,
+					Msg:       &proto.RemoveChannelMessage{ChannelId: uint32(ch.id)},
+					Channel:   s.globalChannel,
+					ChannelId: uint32(GlobalChannelId),
+				})
+			}
+		}
+		RemoveChannel(ch)
+		ch.Logger().Info("removed channel by the admin API", zap.Int("subs", len(ch.subscribedConnections)))
+	}) {
+		return errAdminChannelTimeout
+	}
+	return nil
+}
+
+func adminUpdateSubOptions(ch *Channel, connIdStr string, body io.Reader) (interface{}, error) {
+	connId, err := strconv.ParseUint(connIdStr, 10, 32)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid connection id: " + connIdStr}
+	}
+	bytes, err := io.ReadAll(body)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, err.Error()}
+	}
+	options := &proto.ChannelSubscriptionOptions{}
+	if err := protojson.Unmarshal(bytes, options); err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid ChannelSubscriptionOptions: " + err.Error()}
+	}
+	// The proto3 fields have no presence, so the JSON keys tell which fields to set, including the zero values.
+	var presentKeys map[string]json.RawMessage
+	if err := json.Unmarshal(bytes, &presentKeys); err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid ChannelSubscriptionOptions: " + err.Error()}
+	}
+	var presentFields []protoreflect.FieldDescriptor
+	fields := options.ProtoReflect().Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		_, hasJSONName := presentKeys[fd.JSONName()]
+		_, hasName := presentKeys[string(fd.Name())]
+		if hasJSONName || hasName {
+			presentFields = append(presentFields, fd)
+		}
+	}
+
+	var result []byte
+	if !adminMutate(ch, func(ch *Channel) {
+		cs, exists := ch.subscribedConnections[ConnectionId(connId)]
+		if !exists {
+			err = &adminError{http.StatusNotFound, "the connection is not subscribed to the channel"}
+			return
+		}
+		// Same as re-subscribing by the channel owner, the write permissions can also be changed.
+		// Unlike protobuf.Merge, the zero values are set, and the repeated fields are replaced instead of appended.
+		dst, src := cs.options.ProtoReflect(), options.ProtoReflect()
+		for _, fd := range presentFields {
+			if src.Has(fd) {
+				dst.Set(fd, src.Get(fd))
+			} else {
+				dst.Clear(fd)
+			}
+		}
+		result, err = protojson.Marshal(&cs.options)
+	}) {
+		return nil, errAdminChannelTimeout
+	}
+	if err != nil {
+		return nil, err
+	}
+	return AdminSubscriptionInfo{ConnId: uint32(connId), Options: result}, nil
+}
+
+func (c *Connection) adminInfo(channelIds []uint32) AdminConnectionInfo {
+	info := AdminConnectionInfo{
+		ConnId:     uint32(c.id),
+		ConnType:   c.connectionType.String(),
+		Detached:   c.isDetached(),
+		RttMs:      float64(c.RTT()) / float64(time.Millisecond),
+		ChannelIds: channelIds,
+	}
+	if state := c.fsmState(); state != nil {
+		info.State = state.Name
+	}
+	if addr := c.getTransport().conn.RemoteAddr(); addr != nil {
+		info.RemoteAddr = addr.String()
+	}
+	if info.ChannelIds == nil {
+		info.ChannelIds = make([]uint32, 0)
+	}
+	return info
+}
+
+// Returns the ids of the channels that each connection subscribes to.
+func (s *Server) adminSubscribedChannelIds() map[ConnectionId][]uint32 {
+	channelIds := make(map[ConnectionId][]uint32)
+	infos := s.adminChannelInfos()
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ChannelId < infos[j].ChannelId
+	})
+	for _, info := range infos {
+		for _, connId := range info.SubscriberConnIds {
+			channelIds[ConnectionId(connId)] = append(channelIds[ConnectionId(connId)], info.ChannelId)
+		}
+	}
+	return channelIds
+}
+
+func (s *Server) adminListConnections(typeFilter string, stateFilter string) (interface{}, error) {
+	channelIds := s.adminSubscribedChannelIds()
+	infos := make([]AdminConnectionInfo, 0)
+	s.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		c := v.(*Connection)
+		if c.IsRemoving() {
+			return true
+		}
+		info := c.adminInfo(channelIds[c.id])
+		if (typeFilter == "" || strings.EqualFold(typeFilter, info.ConnType)) &&
+			(stateFilter == "" || strings.EqualFold(stateFilter, info.State)) {
+			infos = append(infos, info)
+		}
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ConnId < infos[j].ConnId
+	})
+	return infos, nil
+}
+
+func adminConnectionDetail(c *Connection) (interface{}, error) {
+	info := c.adminInfo(c.server.adminSubscribedChannelIds()[c.id])
+	if state := c.fsmState(); state != nil {
+		info.Fsm = &AdminFsmStateInfo{
+			Name:             state.Name,
+			MsgTypeWhitelist: state.MsgTypeWhitelist,
+			MsgTypeBlacklist: state.MsgTypeBlacklist,
+			TimeoutMs:        state.TimeoutMs,
+			TimeoutState:     state.TimeoutState,
+			Terminal:         state.Terminal,
+		}
+	}
+	return info, nil
+}
+
+func adminKickConnection(c *Connection) error {
+	// Kicked in the GLOBAL channel's goroutine like handleDisconnect does.
+	// The subscribed channels unsub the connection in their next tick after it's removed.
+	if !adminMutate(c.server.globalChannel, func(_ *Channel) {
+		c.Logger().Info("kicked by the admin API")
+		c.disconnectWithNotice(KickedReason, "")
+	}) {
+		return errAdminChannelTimeout
+	}
+	return nil
+}
+
+func (s *Server) adminStartCapture(body io.Reader) (interface{}, error) {
+	var target CaptureTarget
+	if err := json.NewDecoder(body).Decode(&target); err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid capture target: " + err.Error()}
+	}
+	info, err := s.StartCapture(target)
+	switch {
+	case errors.Is(err, errInvalidCaptureTarget):
+		return nil, &adminError{http.StatusBadRequest, err.Error()}
+	case errors.Is(err, errCaptureTargetNotFound):
+		return nil, &adminError{http.StatusNotFound, err.Error()}
+	case err != nil:
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *Server) adminStopCapture(idStr string) (interface{}, error) {
+	id, err := strconv.ParseUint(idStr, 10, 32)
+	if err != nil {
+		return nil, &adminError{http.StatusBadRequest, "invalid capture id: " + idStr}
+	}
+	info, err := s.StopCapture(uint32(id))
+	if errors.Is(err, errCaptureNotFound) {
+		return nil, &adminError{http.StatusNotFound, err.Error()}
+	}
+	return info, err
+}
@@ -0,0 +1,369 @@
+package channeld
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method string, path string, body string, result interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer test-token")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if result != nil && w.Code == http.StatusOK {
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), result))
+	}
+	return w.Code
+}
+
+func TestAdminAPI(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	h := AdminHandler("test-token")
+
+	r := httptest.NewRequest(http.MethodGet, "/admin/channels", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	r.Header.Set("Authorization", "Bearer wrong-token")
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	testFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "3-8"}]}`))
+	assert.NoError(t, err)
+	serverTestFsm, clientTestFsm := testFsm, testFsm
+	server.setFsm(&serverTestFsm)
+	client.setFsm(&clientTestFsm)
+	server.fsm.MoveToNextState()
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	executeAndWait(ch, func(ch *Channel) {
+		ch.metadata = "test"
+		ch.InitData(&proto.TestChannelDataMessage{Text: "hello"}, nil)
+		server.SubscribeToChannel(ch, nil)
+		client.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 100})
+	})
+
+	var channels []AdminChannelInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/channels", "", &channels))
+	if assert.Len(t, channels, 2) {
+		assert.Equal(t, "GLOBAL", channels[0].ChannelType)
+		assert.EqualValues(t, ch.id, channels[1].ChannelId)
+		assert.EqualValues(t, server.id, channels[1].OwnerConnId)
+		assert.Equal(t, "test", channels[1].Metadata)
+		assert.ElementsMatch(t, []uint32{uint32(server.id), uint32(client.id)}, channels[1].SubscriberConnIds)
+		assert.True(t, channels[1].HasData)
+	}
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/channels?type=GLOBAL", "", &channels))
+	assert.Len(t, channels, 1)
+
+	chPath := "/admin/channels/" + strconv.Itoa(int(ch.id))
+	var channel AdminChannelInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, chPath, "", &channel))
+	if assert.Len(t, channel.Subscriptions, 2) {
+		assert.JSONEq(t, `{"FanOutIntervalMs": 100}`, string(channel.Subscriptions[1].Options))
+	}
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/admin/channels/999", "", nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodGet, "/admin/channels/abc", "", nil))
+
+	var data map[string]interface{}
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, chPath+"/data", "", &data))
+	assert.Equal(t, "hello", data["text"])
+
+	var sub AdminSubscriptionInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPatch, chPath+"/subs/"+strconv.Itoa(int(client.id)), `{"FanOutIntervalMs": 200, "DataFieldMasks": ["text"]}`, &sub))
+	assert.JSONEq(t, `{"FanOutIntervalMs": 200, "DataFieldMasks": ["text"]}`, string(sub.Options))
+	executeAndWait(ch, func(ch *Channel) {
+		assert.EqualValues(t, 200, ch.subscribedConnections[client.id].options.FanOutIntervalMs)
+	})
+	// The fields present in the body are set, including the zero values. The lists are replaced, and the absent fields are kept.
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPatch, chPath+"/subs/"+strconv.Itoa(int(client.id)), `{"CanUpdateData": true, "DataFieldMasks": ["text", "num"]}`, &sub))
+	assert.JSONEq(t, `{"CanUpdateData": true, "FanOutIntervalMs": 200, "DataFieldMasks": ["text", "num"]}`, string(sub.Options))
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPatch, chPath+"/subs/"+strconv.Itoa(int(client.id)), `{"CanUpdateData": false, "FanOutIntervalMs": 0, "DataFieldMasks": []}`, &sub))
+	assert.JSONEq(t, `{}`, string(sub.Options))
+	executeAndWait(ch, func(ch *Channel) {
+		assert.False(t, ch.subscribedConnections[client.id].options.CanUpdateData)
+		assert.Empty(t, ch.subscribedConnections[client.id].options.DataFieldMasks)
+	})
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodPatch, chPath+"/subs/"+strconv.Itoa(int(client.id)), `{"blah": 1}`, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPatch, chPath+"/subs/999", `{}`, nil))
+
+	var conns []AdminConnectionInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/connections?type=client&state=init", "", &conns))
+	found := false
+	for _, info := range conns {
+		assert.Equal(t, "CLIENT", info.ConnType)
+		assert.Equal(t, "INIT", info.State)
+		if info.ConnId == uint32(client.id) {
+			found = true
+			assert.Equal(t, []uint32{uint32(ch.id)}, info.ChannelIds)
+		}
+	}
+	assert.True(t, found)
+
+	var conn AdminConnectionInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/connections/"+strconv.Itoa(int(server.id)), "", &conn))
+	assert.Equal(t, "SERVER", conn.ConnType)
+	assert.Equal(t, "OPEN", conn.State)
+	if assert.NotNil(t, conn.Fsm) {
+		assert.Equal(t, "OPEN", conn.Fsm.Name)
+		assert.Equal(t, "3-8", conn.Fsm.MsgTypeWhitelist)
+	}
+
+	// Kick the client. It's notified, and removed after the notice is flushed.
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, h, http.MethodDelete, "/admin/connections/"+strconv.Itoa(int(client.id)), "", nil))
+	notice, ok := client.latestMsg().(*proto.DisconnectMessage)
+	if assert.True(t, ok) {
+		assert.EqualValues(t, client.id, notice.ConnId)
+		assert.Equal(t, KickedReason, notice.Reason)
+	}
+	assert.True(t, client.isClosing())
+	// The test connection has no goroutine to flush the send queue.
+	RemoveConnection(client)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/admin/connections/"+strconv.Itoa(int(client.id)), "", nil))
+
+	// Remove the channel
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodDelete, "/admin/channels/0", "", nil))
+	assert.Equal(t, http.StatusNoContent, adminRequest(t, h, http.MethodDelete, chPath, "", nil))
+	assert.Nil(t, GetChannel(ch.id))
+	// The subscribers are notified.
+	notified := false
+	for _, msg := range server.testQueue() {
+		if removeMsg, ok := msg.(*proto.RemoveChannelMessage); ok && removeMsg.ChannelId == uint32(ch.id) {
+			notified = true
+		}
+	}
+	assert.True(t, notified)
+
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/admin/channels", "", nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodGet, "/admin/blah", "", nil))
+}
+
+func TestAdminChannelTimeout(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	h := AdminHandler("test-token")
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, nil)
+	// Block the channel's goroutine
+	blocked := make(chan struct{})
+	ch.execute(func(ch *Channel) {
+		<-blocked
+	})
+	time.Sleep(50 * time.Millisecond)
+
+	assert.Equal(t, http.StatusServiceUnavailable, adminRequest(t, h, http.MethodGet, "/admin/channels/"+strconv.Itoa(int(ch.id)), "", nil))
+	// The blocked channel is left out.
+	var channels []AdminChannelInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/channels", "", &channels))
+	assert.Len(t, channels, 1)
+
+	// The mutation that times out before it starts is cancelled, so the channel is not removed after it's unblocked.
+	assert.Equal(t, http.StatusServiceUnavailable, adminRequest(t, h, http.MethodDelete, "/admin/channels/"+strconv.Itoa(int(ch.id)), "", nil))
+	close(blocked)
+	executeAndWait(ch, func(ch *Channel) {})
+	assert.False(t, ch.IsRemoving())
+	assert.Equal(t, ch, GetChannel(ch.id))
+}
+
+func TestAdminConnectionWhileMoving(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	h := AdminHandler("test-token")
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	testFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "3-8"}]}`))
+	assert.NoError(t, err)
+	c.setFsm(&testFsm)
+
+	// The FSM is moved in another goroutine (e.g. by the authentication) while the admin API reads it.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.withFsm(func(f *fsm.FiniteStateMachine) {
+				if !f.MoveToNextState() {
+					f.ChangeState("INIT")
+				}
+			})
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		var conn AdminConnectionInfo
+		assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/connections/"+strconv.Itoa(int(c.id)), "", &conn))
+		assert.Contains(t, []string{"INIT", "OPEN"}, conn.State)
+	}
+	<-done
+}
+
+func TestAdminWatchChannelData(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	httpServer := httptest.NewServer(AdminHandler("test-token"))
+	defer httpServer.Close()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	executeAndWait(ch, func(ch *Channel) {
+		ch.InitData(&proto.TestChannelDataMessage{Text: "hello"}, nil)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r, _ := http.NewRequestWithContext(ctx, http.MethodGet, httpServer.URL+"/admin/channels/"+strconv.Itoa(int(ch.id))+"/watch", nil)
+	r.Header.Set("Authorization", "Bearer test-token")
+	resp, err := http.DefaultClient.Do(r)
+	if !assert.NoError(t, err) {
+		cancel()
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	decoder := json.NewDecoder(resp.Body)
+
+	var event AdminDataEvent
+	assert.NoError(t, decoder.Decode(&event))
+	assert.True(t, event.Snapshot)
+	assert.JSONEq(t, `{"text": "hello"}`, string(event.Data))
+
+	dataAny, _ := anypb.New(&proto.TestChannelDataMessage{Num: 1})
+	executeAndWait(ch, func(ch *Channel) {
+		handleChannelDataUpdate(MessageContext{
+			MsgType:    proto.MessageType_CHANNEL_DATA_UPDATE,
+			Msg:        &proto.ChannelDataUpdateMessage{Data: dataAny},
+			Connection: server,
+			Channel:    ch,
+		})
+	})
+	event = AdminDataEvent{}
+	assert.NoError(t, decoder.Decode(&event))
+	assert.False(t, event.Snapshot)
+	assert.EqualValues(t, server.id, event.SenderConnId)
+	assert.JSONEq(t, `{"num": 1}`, string(event.Data))
+
+	// The watcher is removed after the client goes away.
+	cancel()
+	assert.Eventually(t, func() bool {
+		watchers := -1
+		executeAndWait(ch, func(ch *Channel) {
+			watchers = len(ch.dataWatchers)
+		})
+		return watchers == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// The stream ends as soon as the channel is removed.
+	r, _ = http.NewRequest(http.MethodGet, httpServer.URL+"/admin/channels/"+strconv.Itoa(int(ch.id))+"/watch", nil)
+	r.Header.Set("Authorization", "Bearer test-token")
+	resp2, err := http.DefaultClient.Do(r)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer resp2.Body.Close()
+	decoder = json.NewDecoder(resp2.Body)
+	assert.NoError(t, decoder.Decode(&event))
+	start := time.Now()
+	RemoveChannel(ch)
+	assert.Equal(t, io.EOF, decoder.Decode(&event))
+	assert.Less(t, int64(time.Since(start)), int64(500*time.Millisecond))
+}
+
+func TestAdminWatchSlowWatcher(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	freezeTestChannel(ch)
+	ch.InitData(&proto.TestChannelDataMessage{}, nil)
+	watcher := make(chan []byte, 3)
+	ch.dataWatchers = map[chan<- []byte]uint32{watcher: 0}
+
+	readEvent := func() AdminDataEvent {
+		var event AdminDataEvent
+		assert.NoError(t, json.Unmarshal(<-watcher, &event))
+		return event
+	}
+
+	for i := 1; i <= 5; i++ {
+		ch.applyDataUpdate(server, &proto.TestChannelDataMessage{Num: uint32(i)})
+	}
+	assert.EqualValues(t, 2, ch.dataWatchers[watcher])
+	for i := 1; i <= 3; i++ {
+		assert.JSONEq(t, `{"num": `+strconv.Itoa(i)+`}`, string(readEvent().Data))
+	}
+
+	// The watcher is resynced with the whole data once it catches up, then receives the update.
+	ch.applyDataUpdate(server, &proto.TestChannelDataMessage{Num: 6})
+	resync := readEvent()
+	assert.True(t, resync.Snapshot)
+	assert.EqualValues(t, 2, resync.Dropped)
+	assert.JSONEq(t, `{"num": 5}`, string(resync.Data))
+	update := readEvent()
+	assert.False(t, update.Snapshot)
+	assert.EqualValues(t, server.id, update.SenderConnId)
+	assert.JSONEq(t, `{"num": 6}`, string(update.Data))
+	assert.EqualValues(t, 0, ch.dataWatchers[watcher])
+
+	// The update made by channeld has no sender, and is not a snapshot.
+	ch.applyDataUpdate(nil, &proto.TestChannelDataMessage{Num: 7})
+	update = readEvent()
+	assert.False(t, update.Snapshot)
+	assert.EqualValues(t, 0, update.SenderConnId)
+}
+
+func TestAdminCapture(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	oldCaptureDir := GlobalSettings.CaptureDir
+	defer func() {
+		GlobalSettings.CaptureDir = oldCaptureDir
+	}()
+	GlobalSettings.CaptureDir = t.TempDir()
+	h := AdminHandler("test-token")
+
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodPost, "/admin/captures", `{}`, nil))
+	assert.Equal(t, http.StatusBadRequest, adminRequest(t, h, http.MethodPost, "/admin/captures", `{"connId": 1, "channelId": 0}`, nil))
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodPost, "/admin/captures", `{"connId": 999999}`, nil))
+
+	var info CaptureInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/admin/captures", `{"connId": `+strconv.Itoa(int(client.id))+`}`, &info))
+	assert.EqualValues(t, client.id, *info.ConnId)
+	assert.Nil(t, info.ChannelId)
+	var globalInfo CaptureInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodPost, "/admin/captures", `{"channelId": 0}`, &globalInfo))
+	assert.EqualValues(t, GlobalChannelId, *globalInfo.ChannelId)
+
+	var infos []CaptureInfo
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/captures", "", &infos))
+	if assert.Len(t, infos, 2) {
+		assert.Equal(t, info.CaptureId, infos[0].CaptureId)
+		assert.Equal(t, info.Path, infos[0].Path)
+	}
+
+	client.capture(proto.CaptureRecord_INBOUND, &proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)}, nil)
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodDelete, "/admin/captures/"+strconv.Itoa(int(info.CaptureId)), "", &info))
+	assert.EqualValues(t, 1, info.Records)
+	assert.Equal(t, http.StatusNotFound, adminRequest(t, h, http.MethodDelete, "/admin/captures/"+strconv.Itoa(int(info.CaptureId)), "", nil))
+
+	// The capture is stopped when the connection is removed.
+	RemoveConnection(client)
+	assert.Equal(t, http.StatusOK, adminRequest(t, h, http.MethodGet, "/admin/captures", "", &infos))
+	assert.Len(t, infos, 1)
+	_, err := StopCapture(globalInfo.CaptureId)
+	assert.NoError(t, err)
+}
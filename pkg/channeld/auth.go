@@ -0,0 +1,315 @@
+package channeld
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+type AuthResult = proto.AuthResultMessage_AuthResult
+
+// The verified identity of a connection. It's attached to the Connection after the authentication succeeded.
+type AuthClaims struct {
+	UserId string
+	Roles  []string
+	// All the claims the authenticator verified, e.g. the payload of a JWT.
+	Values map[string]interface{}
+}
+
+func (c *AuthClaims) HasRole(role string) bool {
+	if c == nil {
+		return false
+	}
+	for _, r := range c.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies the tokens in the AuthMessage.
+// Authenticate is called in its own goroutine, so it can block (e.g. waiting for a remote verdict) without stalling the GLOBAL channel.
+// The returned claims are only used if the result is SUCCESSFUL.
+type Authenticator interface {
+	Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error)
+}
+
+func SetAuthenticator(a Authenticator) {
+	defaultServer.SetAuthenticator(a)
+}
+
+func (s *Server) SetAuthenticator(a Authenticator) {
+	s.authenticator = a
+}
+
+func SetServerAuthenticator(a Authenticator) {
+	defaultServer.SetServerAuthenticator(a)
+}
+
+// Sets the authenticator of the server connections. Nil means the server connections use the same authenticator as the clients.
+func (s *Server) SetServerAuthenticator(a Authenticator) {
+	s.serverAuthenticator = a
+}
+
+func (s *Server) getAuthenticator(t proto.ConnectionType) Authenticator {
+	if t == proto.ConnectionType_SERVER && s.serverAuthenticator != nil {
+		return s.serverAuthenticator
+	}
+	return s.authenticator
+}
+
+// Create the authenticators of the default server from GlobalSettings.AuthProvider and GlobalSettings.ServerAuthProvider.
+func InitAuthenticator() error {
+	return defaultServer.InitAuthenticator()
+}
+
+func (s *Server) InitAuthenticator() error {
+	// The GLOBAL owner that the authentication is delegated to is a server, so the servers can't be delegated themselves.
+	if s.Settings.ServerAuthProvider == "delegate" {
+		return errors.New("the server connections can't use the delegate provider")
+	}
+	if s.Settings.AuthProvider == "delegate" && s.Settings.ServerAuthProvider == "" {
+		return errors.New("the delegate provider requires the provider of the server connections")
+	}
+
+	a, err := s.newAuthenticator(s.Settings.AuthProvider)
+	if err != nil {
+		return err
+	}
+	var serverAuthenticator Authenticator
+	if s.Settings.ServerAuthProvider != "" {
+		if serverAuthenticator, err = s.newAuthenticator(s.Settings.ServerAuthProvider); err != nil {
+			return fmt.Errorf("failed to create the authenticator of the server connections: %w", err)
+		}
+	}
+	s.authenticator = a
+	s.serverAuthenticator = serverAuthenticator
+	s.logger.Info("initialized authenticator", zap.String("provider", s.Settings.AuthProvider), zap.String("serverProvider", s.Settings.ServerAuthProvider))
+	return nil
+}
+
+func (s *Server) newAuthenticator(provider string) (Authenticator, error) {
+	switch provider {
+	case "", "none":
+		return &noAuthenticator{}, nil
+	case "static":
+		return loadStaticTokenAuthenticator(s.Settings.AuthFile)
+	case "hmac":
+		if s.Settings.AuthSecret == "" {
+			return nil, errors.New("the HMAC authenticator requires a secret")
+		}
+		return &hmacAuthenticator{secret: []byte(s.Settings.AuthSecret)}, nil
+	case "delegate":
+		return s.newDelegatingAuthenticator(time.Duration(s.Settings.AuthTimeoutMs) * time.Millisecond), nil
+	case "jwt":
+		return s.newJWTAuthenticator(s.Settings.JWKSFile, s.Settings.JWTAudience, s.Settings.JWTIssuer)
+	default:
+		return nil, fmt.Errorf("unknown auth provider: %s", provider)
+	}
+}
+
+// Accepts any token. This is the default behavior.
+type noAuthenticator struct{}
+
+func (a *noAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	return proto.AuthResultMessage_SUCCESSFUL, &AuthClaims{UserId: pit}, nil
+}
+
+// Looks up the login token by the player identifier token in a JSON file, e.g. {"player1": "token1"}
+type staticTokenAuthenticator struct {
+	tokens map[string]string
+}
+
+func loadStaticTokenAuthenticator(path string) (*staticTokenAuthenticator, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the token file: %w", err)
+	}
+	a := &staticTokenAuthenticator{}
+	if err := json.Unmarshal(bytes, &a.tokens); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the token file: %w", err)
+	}
+	return a, nil
+}
+
+func (a *staticTokenAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	token, exists := a.tokens[pit]
+	if !exists {
+		return proto.AuthResultMessage_INVALID_PIT, nil, nil
+	}
+	if !hmac.Equal([]byte(token), []byte(lt)) {
+		return proto.AuthResultMessage_INVALID_LT, nil, nil
+	}
+	return proto.AuthResultMessage_SUCCESSFUL, &AuthClaims{UserId: pit}, nil
+}
+
+// The login token should be the hex-encoded HMAC-SHA256 of the player identifier token, signed with the shared secret.
+type hmacAuthenticator struct {
+	secret []byte
+}
+
+func SignHMACToken(secret []byte, pit string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(pit))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (a *hmacAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	if pit == "" {
+		return proto.AuthResultMessage_INVALID_PIT, nil, nil
+	}
+	if !hmac.Equal([]byte(SignHMACToken(a.secret, pit)), []byte(lt)) {
+		return proto.AuthResultMessage_INVALID_LT, nil, nil
+	}
+	return proto.AuthResultMessage_SUCCESSFUL, &AuthClaims{UserId: pit}, nil
+}
+
+// Forwards the tokens to the GLOBAL channel owner and waits for its verdict.
+type delegatingAuthenticator struct {
+	server  *Server
+	timeout time.Duration
+	pending sync.Map // map[ConnectionId]chan AuthResult
+}
+
+func (s *Server) newDelegatingAuthenticator(timeout time.Duration) *delegatingAuthenticator {
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	return &delegatingAuthenticator{server: s, timeout: timeout}
+}
+
+func (a *delegatingAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	// The owner is only changed in the GLOBAL channel's goroutine.
+	var owner *Connection
+	if !a.server.globalChannel.executeAndWait(func(ch *Channel) {
+		owner = ch.ownerConnection
+	}, a.timeout) || owner == nil {
+		return proto.AuthResultMessage_INVALID_LT, nil, errors.New("the GLOBAL channel has no owner to delegate the authentication to")
+	}
+
+	// The verdict only has the connection id, so there can't be two pending authentications of the same connection.
+	verdict := make(chan AuthResult, 1)
+	if _, exists := a.pending.LoadOrStore(connId, verdict); exists {
+		return proto.AuthResultMessage_INVALID_LT, nil, errors.New("the previous authentication of the connection is still pending")
+	}
+	defer a.pending.Delete(connId)
+
+	owner.Send(MessageContext{
+		MsgType: proto.MessageType_AUTH_DELEGATION,
+		Msg: &proto.AuthDelegationMessage{
+			ConnId:                uint32(connId),
+			PlayerIdentifierToken: pit,
+			LoginToken:            lt,
+		},
+		Channel:   a.server.globalChannel,
+		ChannelId: uint32(GlobalChannelId),
+	})
+
+	select {
+	case result := <-verdict:
+		return result, &AuthClaims{UserId: pit}, nil
+	case <-time.After(a.timeout):
+		return proto.AuthResultMessage_INVALID_LT, nil, errors.New("timed out waiting for the delegated authentication")
+	}
+}
+
+func (a *delegatingAuthenticator) resolve(connId ConnectionId, result AuthResult) bool {
+	v, ok := a.pending.Load(connId)
+	if !ok {
+		return false
+	}
+	select {
+	case v.(chan AuthResult) <- result:
+		return true
+	default:
+		// Duplicate verdict
+		return false
+	}
+}
+
+func handleAuthDelegationResult(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel || ctx.Connection != s.globalChannel.ownerConnection {
+		ctx.Connection.Logger().Error("illegal attempt to send the auth delegation result as the connection is not the GLOBAL channel owner")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the GLOBAL owner can send the auth delegation result")
+		return
+	}
+	msg, ok := ctx.Msg.(*proto.AuthDelegationResultMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a AuthDelegationResultMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a AuthDelegationResultMessage")
+		return
+	}
+	a, ok := s.authenticator.(*delegatingAuthenticator)
+	if !ok || !a.resolve(ConnectionId(msg.ConnId), msg.Result) {
+		ctx.Connection.Logger().Warn("no pending delegated authentication for the connection", zap.Uint32("targetConnId", msg.ConnId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_REQUEST_EXPIRED, "no pending delegated authentication for the connection")
+	}
+}
+
+// Called in the GLOBAL channel's goroutine after Authenticator.Authenticate returns.
+func onAuthenticated(ctx MessageContext, result AuthResult, claims *AuthClaims) {
+	c := ctx.Connection
+	s := c.server
+	atomic.StoreInt32(&c.authPending, 0)
+	if c.IsRemoving() {
+		return
+	}
+
+	if result == proto.AuthResultMessage_SUCCESSFUL {
+		c.authFailures = 0
+		c.setClaims(claims)
+		c.withFsm(func(f *fsm.FiniteStateMachine) {
+			f.MoveToNextState()
+		})
+	} else {
+		c.authFailures++
+	}
+
+	resultMsg := &proto.AuthResultMessage{
+		Result:          result,
+		ConnId:          uint32(c.id),
+		CompressionType: s.Settings.CompressionType,
+	}
+	if result == proto.AuthResultMessage_SUCCESSFUL && c.canResume() {
+		resultMsg.ResumeToken = c.issueResumeToken()
+	}
+	ctx.Msg = resultMsg
+	c.Send(ctx)
+
+	if result != proto.AuthResultMessage_SUCCESSFUL {
+		c.Logger().Warn("failed to authenticate",
+			zap.String("result", result.String()),
+			zap.Uint32("failures", c.authFailures),
+		)
+		if s.Settings.MaxAuthFailures > 0 && c.authFailures >= s.Settings.MaxAuthFailures {
+			c.Logger().Warn("too many authentication failures, the connection will be closed")
+			c.closeAfterFlush()
+		}
+		return
+	}
+
+	// Also send the respond to The GLOBAL channel owner (to handle the client's subscription if it doesn't have the authority to).
+	// The resume token is only for the connection itself.
+	if s.globalChannel.ownerConnection != nil {
+		ctx.StubId = 0
+		ctx.Msg = &proto.AuthResultMessage{
+			Result:          resultMsg.Result,
+			ConnId:          resultMsg.ConnId,
+			CompressionType: resultMsg.CompressionType,
+		}
+		s.globalChannel.ownerConnection.Send(ctx)
+	}
+}
@@ -0,0 +1,280 @@
+package channeld
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+// How often the JWKS file is checked for changes.
+const jwksPollInterval = time.Second
+
+var jwtValidMethods = []string{"HS256", "RS256", "ES256"}
+
+// A key in the JWKS file. See https://datatracker.ietf.org/doc/html/rfc7517
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	// Symmetric key (kty = oct)
+	K string `json:"k"`
+	// RSA public key (kty = RSA)
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC public key (kty = EC)
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwtKey struct {
+	alg string // Empty means the key can be used with any algorithm of its type.
+	key interface{}
+}
+
+// Verifies the login token as a JWT signed with one of the keys in the JWKS file.
+// The JWKS file is reloaded when it's modified, so the keys can be rotated without restarting channeld.
+type jwtAuthenticator struct {
+	jwksPath    string
+	audience    string
+	issuer      string
+	userIdClaim string
+	rolesClaim  string
+	parser      *jwt.Parser
+	keysLock    sync.RWMutex
+	keys        map[string]*jwtKey // Indexed by kid
+	jwksModTime time.Time
+	stopPolling chan struct{}
+	logger      *zap.Logger
+}
+
+func (s *Server) newJWTAuthenticator(jwksPath string, audience string, issuer string) (*jwtAuthenticator, error) {
+	a := &jwtAuthenticator{
+		jwksPath:    jwksPath,
+		audience:    audience,
+		issuer:      issuer,
+		userIdClaim: s.Settings.JWTUserIdClaim,
+		rolesClaim:  s.Settings.JWTRolesClaim,
+		parser:      jwt.NewParser(jwt.WithValidMethods(jwtValidMethods)),
+		stopPolling: make(chan struct{}),
+		logger:      s.logger,
+	}
+	if a.userIdClaim == "" {
+		a.userIdClaim = "sub"
+	}
+	if a.rolesClaim == "" {
+		a.rolesClaim = "roles"
+	}
+	if err := a.loadJWKS(); err != nil {
+		return nil, err
+	}
+	go a.pollJWKS(jwksPollInterval, a.stopPolling)
+	return a, nil
+}
+
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func (k *jsonWebKey) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeBase64URL(k.K)
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+
+	case "RSA":
+		n, err := decodeBase64URL(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBase64URL(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve: %s", k.Crv)
+		}
+		x, err := decodeBase64URL(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBase64URL(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type: %s", k.Kty)
+	}
+}
+
+func parseJWKS(bytes []byte) (map[string]*jwtKey, error) {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(bytes, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]*jwtKey, len(jwks.Keys))
+	for i := range jwks.Keys {
+		jwk := &jwks.Keys[i]
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid key '%s': %w", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = &jwtKey{alg: jwk.Alg, key: key}
+	}
+	return keys, nil
+}
+
+func (a *jwtAuthenticator) loadJWKS() error {
+	info, err := os.Stat(a.jwksPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the JWKS file: %w", err)
+	}
+	bytes, err := os.ReadFile(a.jwksPath)
+	if err != nil {
+		return fmt.Errorf("failed to read the JWKS file: %w", err)
+	}
+	keys, err := parseJWKS(bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse the JWKS file: %w", err)
+	}
+
+	a.keysLock.Lock()
+	a.keys = keys
+	a.jwksModTime = info.ModTime()
+	a.keysLock.Unlock()
+	return nil
+}
+
+// The interval and the stop channel are passed by value, so the polling can be restarted without racing with the previous goroutine.
+func (a *jwtAuthenticator) pollJWKS(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(a.jwksPath)
+			if err != nil {
+				continue
+			}
+			a.keysLock.RLock()
+			modified := !info.ModTime().Equal(a.jwksModTime)
+			a.keysLock.RUnlock()
+			if !modified {
+				continue
+			}
+			// Keep using the old keys if the new file is invalid.
+			if err := a.loadJWKS(); err != nil {
+				a.logger.Error("failed to reload the JWKS file", zap.String("path", a.jwksPath), zap.Error(err))
+			} else {
+				a.logger.Info("reloaded the JWKS file", zap.String("path", a.jwksPath))
+			}
+		}
+	}
+}
+
+func (a *jwtAuthenticator) Close() {
+	close(a.stopPolling)
+}
+
+func (a *jwtAuthenticator) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	a.keysLock.RLock()
+	defer a.keysLock.RUnlock()
+	key, exists := a.keys[kid]
+	if !exists && kid == "" && len(a.keys) == 1 {
+		// The token doesn't specify the key, but there is only one.
+		for _, k := range a.keys {
+			key = k
+		}
+		exists = true
+	}
+	if !exists {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
+
+	alg := token.Method.Alg()
+	if key.alg != "" && key.alg != alg {
+		return nil, fmt.Errorf("the key '%s' can't be used with %s", kid, alg)
+	}
+	// Prevent the algorithm confusion attack, e.g. verifying a HS256 token with the RSA public key as the secret.
+	switch key.key.(type) {
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("the symmetric key '%s' can't be used with %s", kid, alg)
+		}
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return nil, fmt.Errorf("the RSA key '%s' can't be used with %s", kid, alg)
+		}
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			return nil, fmt.Errorf("the EC key '%s' can't be used with %s", kid, alg)
+		}
+	}
+	return key.key, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	claims := jwt.MapClaims{}
+	// Parse() also verifies 'exp' and 'nbf' if they exist.
+	_, err := a.parser.ParseWithClaims(lt, claims, a.keyFunc)
+	if err != nil {
+		return proto.AuthResultMessage_INVALID_LT, nil, err
+	}
+	if _, exists := claims["exp"]; !exists {
+		return proto.AuthResultMessage_INVALID_LT, nil, errors.New("the token has no expiration time")
+	}
+	if a.audience != "" && !claims.VerifyAudience(a.audience, true) {
+		return proto.AuthResultMessage_INVALID_LT, nil, fmt.Errorf("the token is not issued for the audience: %s", a.audience)
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return proto.AuthResultMessage_INVALID_LT, nil, fmt.Errorf("the token is not issued by: %s", a.issuer)
+	}
+
+	authClaims := &AuthClaims{Values: claims}
+	authClaims.UserId, _ = claims[a.userIdClaim].(string)
+	// The player identifier token, if provided, should match the user id in the token.
+	if pit != "" && pit != authClaims.UserId {
+		return proto.AuthResultMessage_INVALID_PIT, nil, nil
+	}
+
+	switch roles := claims[a.rolesClaim].(type) {
+	case []interface{}:
+		for _, role := range roles {
+			if s, ok := role.(string); ok {
+				authClaims.Roles = append(authClaims.Roles, s)
+			}
+		}
+	case string:
+		// Space-delimited, like the OAuth 'scope' claim.
+		authClaims.Roles = strings.Fields(roles)
+	}
+
+	return proto.AuthResultMessage_SUCCESSFUL, authClaims, nil
+}
@@ -0,0 +1,167 @@
+package channeld
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeBase64URL(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func writeTestJWKS(t *testing.T, path string, keys ...jsonWebKey) {
+	bytes, err := json.Marshal(map[string][]jsonWebKey{"keys": keys})
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(path, bytes, 0644))
+}
+
+func signTestJWT(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return s
+}
+
+func TestJWTAuthenticator(t *testing.T) {
+	InitLogsAndMetrics()
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	hmacSecret := []byte("secret")
+
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksPath,
+		jsonWebKey{Kty: "RSA", Kid: "rsa1", N: encodeBase64URL(rsaKey.N.Bytes()), E: encodeBase64URL(big.NewInt(int64(rsaKey.E)).Bytes())},
+		jsonWebKey{Kty: "EC", Kid: "ec1", Crv: "P-256", X: encodeBase64URL(ecKey.X.Bytes()), Y: encodeBase64URL(ecKey.Y.Bytes())},
+		jsonWebKey{Kty: "oct", Kid: "hmac1", Alg: "HS256", K: encodeBase64URL(hmacSecret)},
+	)
+
+	a, err := defaultServer.newJWTAuthenticator(jwksPath, "channeld", "")
+	assert.NoError(t, err)
+	defer a.Close()
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   "player1",
+			"aud":   "channeld",
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"roles": []string{"admin", "tester"},
+		}
+	}
+
+	result, claims, err := a.Authenticate(1, "player1", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+	assert.Equal(t, "player1", claims.UserId)
+	assert.True(t, claims.HasRole("admin"))
+	assert.False(t, claims.HasRole("gm"))
+
+	result, _, err = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodES256, "ec1", ecKey, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+
+	result, _, err = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "hmac1", hmacSecret, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+
+	// The PIT doesn't match the subject
+	result, _, _ = a.Authenticate(1, "player2", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, validClaims()))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_PIT, result)
+
+	// Expired
+	expiredClaims := validClaims()
+	expiredClaims["exp"] = time.Now().Add(-time.Minute).Unix()
+	result, _, err = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, expiredClaims))
+	assert.Error(t, err)
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// No expiration time
+	noExpClaims := validClaims()
+	delete(noExpClaims, "exp")
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, noExpClaims))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Not valid yet
+	nbfClaims := validClaims()
+	nbfClaims["nbf"] = time.Now().Add(time.Minute).Unix()
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, nbfClaims))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Wrong audience
+	audClaims := validClaims()
+	audClaims["aud"] = "another service"
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", rsaKey, audClaims))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Unknown key id
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa2", rsaKey, validClaims()))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Signed by another key
+	anotherRSAKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodRS256, "rsa1", anotherRSAKey, validClaims()))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Algorithm confusion: the EC key can't verify a HS256 token
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "ec1", hmacSecret, validClaims()))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// Unsupported algorithm
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS512, "hmac1", hmacSecret, validClaims()))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	InitLogsAndMetrics()
+	oldSecret := []byte("old secret")
+	newSecret := []byte("new secret")
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, jwksPath, jsonWebKey{Kty: "oct", Kid: "key1", K: encodeBase64URL(oldSecret)})
+
+	a, err := defaultServer.newJWTAuthenticator(jwksPath, "", "")
+	assert.NoError(t, err)
+	a.Close()
+	// Restart polling with a shorter interval
+	a.stopPolling = make(chan struct{})
+	go a.pollJWKS(10*time.Millisecond, a.stopPolling)
+	defer a.Close()
+
+	claims := jwt.MapClaims{"sub": "player1", "exp": time.Now().Add(time.Hour).Unix()}
+	result, _, _ := a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "key1", oldSecret, claims))
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+
+	writeTestJWKS(t, jwksPath, jsonWebKey{Kty: "oct", Kid: "key2", K: encodeBase64URL(newSecret)})
+	// Make sure the modification time changes on the file systems with low time resolution.
+	os.Chtimes(jwksPath, time.Now(), time.Now().Add(time.Second))
+
+	assert.Eventually(t, func() bool {
+		result, _, _ := a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "key2", newSecret, claims))
+		return result == proto.AuthResultMessage_SUCCESSFUL
+	}, time.Second, 10*time.Millisecond)
+
+	// The old key is rotated out
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "key1", oldSecret, claims))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	// An invalid JWKS file doesn't replace the current keys
+	assert.NoError(t, os.WriteFile(jwksPath, []byte("{"), 0644))
+	os.Chtimes(jwksPath, time.Now(), time.Now().Add(2*time.Second))
+	time.Sleep(50 * time.Millisecond)
+	result, _, _ = a.Authenticate(1, "", signTestJWT(t, jwt.SigningMethodHS256, "key2", newSecret, claims))
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+}
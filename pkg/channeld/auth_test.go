@@ -0,0 +1,256 @@
+package channeld
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func TestStaticTokenAuthenticator(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"player1": "token1"}`), 0644))
+
+	a, err := loadStaticTokenAuthenticator(path)
+	assert.NoError(t, err)
+
+	result, _, _ := a.Authenticate(1, "player1", "token1")
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+	result, _, _ = a.Authenticate(1, "player1", "token2")
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+	result, _, _ = a.Authenticate(1, "player2", "token1")
+	assert.Equal(t, proto.AuthResultMessage_INVALID_PIT, result)
+
+	_, err = loadStaticTokenAuthenticator(filepath.Join(t.TempDir(), "not_exist.json"))
+	assert.Error(t, err)
+}
+
+func TestHMACAuthenticator(t *testing.T) {
+	secret := []byte("secret")
+	a := &hmacAuthenticator{secret: secret}
+
+	result, _, _ := a.Authenticate(1, "player1", SignHMACToken(secret, "player1"))
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, result)
+	result, _, _ = a.Authenticate(1, "player2", SignHMACToken(secret, "player1"))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+	result, _, _ = a.Authenticate(1, "player1", SignHMACToken([]byte("another secret"), "player1"))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+	result, _, _ = a.Authenticate(1, "", SignHMACToken(secret, ""))
+	assert.Equal(t, proto.AuthResultMessage_INVALID_PIT, result)
+}
+
+func TestDelegatingAuthenticator(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	a := defaultServer.newDelegatingAuthenticator(time.Second)
+	SetAuthenticator(a)
+	defer SetAuthenticator(&noAuthenticator{})
+
+	// No GLOBAL owner to delegate to
+	result, _, err := a.Authenticate(1, "player1", "token1")
+	assert.Error(t, err)
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+
+	owner := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(defaultServer.globalChannel, owner)
+
+	resultChan := make(chan AuthResult)
+	go func() {
+		result, _, _ := a.Authenticate(100, "player1", "token1")
+		resultChan <- result
+	}()
+
+	assert.Eventually(t, func() bool {
+		msg, ok := owner.latestMsg().(*proto.AuthDelegationMessage)
+		return ok && msg.ConnId == 100
+	}, time.Second, 10*time.Millisecond)
+
+	// Only the GLOBAL owner can send the verdict
+	handleAuthDelegationResult(MessageContext{
+		Msg:        &proto.AuthDelegationResultMessage{ConnId: 100, Result: proto.AuthResultMessage_SUCCESSFUL},
+		Connection: addTestConnection(proto.ConnectionType_SERVER),
+		Channel:    defaultServer.globalChannel,
+	})
+	handleAuthDelegationResult(MessageContext{
+		Msg:        &proto.AuthDelegationResultMessage{ConnId: 100, Result: proto.AuthResultMessage_INVALID_PIT},
+		Connection: owner,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Equal(t, proto.AuthResultMessage_INVALID_PIT, <-resultChan)
+
+	// The second authentication of the same connection is rejected while the first one is pending.
+	go func() {
+		result, _, _ := a.Authenticate(101, "player1", "token1")
+		resultChan <- result
+	}()
+	assert.Eventually(t, func() bool {
+		msg, ok := owner.latestMsg().(*proto.AuthDelegationMessage)
+		return ok && msg.ConnId == 101
+	}, time.Second, 10*time.Millisecond)
+	result, _, err = a.Authenticate(101, "player1", "token2")
+	assert.Error(t, err)
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, result)
+	handleAuthDelegationResult(MessageContext{
+		Msg:        &proto.AuthDelegationResultMessage{ConnId: 101, Result: proto.AuthResultMessage_SUCCESSFUL},
+		Connection: owner,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, <-resultChan)
+}
+
+func TestRejectConcurrentAuth(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	// Blocks until the test lets it return.
+	release := make(chan struct{})
+	SetAuthenticator(&blockingAuthenticator{release: release})
+	defer SetAuthenticator(&noAuthenticator{})
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	auth := func() {
+		handleAuth(MessageContext{
+			MsgType:    proto.MessageType_AUTH,
+			Msg:        &proto.AuthMessage{PlayerIdentifierToken: "player1", LoginToken: "token1"},
+			Connection: c,
+			Channel:    defaultServer.globalChannel,
+		})
+	}
+	auth()
+	// The second AUTH is dropped. No error is replied as the connection is not authenticated yet.
+	auth()
+	assert.Empty(t, c.testQueue())
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		msg, ok := c.latestMsg().(*proto.AuthResultMessage)
+		return ok && msg.Result == proto.AuthResultMessage_SUCCESSFUL
+	}, time.Second, 10*time.Millisecond)
+	// Only one result for the two AUTH messages.
+	assert.Len(t, c.testQueue(), 1)
+
+	// Can authenticate again after the result.
+	auth()
+	assert.Eventually(t, func() bool { return len(c.testQueue()) == 2 }, time.Second, 10*time.Millisecond)
+	_, ok := c.latestMsg().(*proto.AuthResultMessage)
+	assert.True(t, ok)
+	// Wait for onAuthenticated to return before the next test resets the channels.
+	defaultServer.globalChannel.executeAndWait(func(ch *Channel) {}, time.Second)
+}
+
+type blockingAuthenticator struct {
+	release chan struct{}
+}
+
+func (a *blockingAuthenticator) Authenticate(connId ConnectionId, pit string, lt string) (AuthResult, *AuthClaims, error) {
+	<-a.release
+	return proto.AuthResultMessage_SUCCESSFUL, &AuthClaims{UserId: pit}, nil
+}
+
+func TestHandleAuthFailures(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	SetAuthenticator(&staticTokenAuthenticator{tokens: map[string]string{"player1": "token1"}})
+	defer SetAuthenticator(&noAuthenticator{})
+	GlobalSettings.MaxAuthFailures = 2
+	defer func() { GlobalSettings.MaxAuthFailures = 0 }()
+
+	latestResult := func(c *Connection) *proto.AuthResultMessage {
+		msg, _ := c.latestMsg().(*proto.AuthResultMessage)
+		return msg
+	}
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	handleAuth(MessageContext{
+		Msg:        &proto.AuthMessage{PlayerIdentifierToken: "player1", LoginToken: "token1"},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool { return latestResult(c) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, latestResult(c).Result)
+	assert.EqualValues(t, c.id, latestResult(c).ConnId)
+	assert.Equal(t, "player1", c.Claims().UserId)
+
+	c = addTestConnection(proto.ConnectionType_CLIENT)
+	handleAuth(MessageContext{
+		Msg:        &proto.AuthMessage{PlayerIdentifierToken: "player2", LoginToken: "token1"},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool { return latestResult(c) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.AuthResultMessage_INVALID_PIT, latestResult(c).Result)
+	assert.False(t, c.isClosing())
+	assert.Nil(t, c.Claims())
+
+	handleAuth(MessageContext{
+		Msg:        &proto.AuthMessage{PlayerIdentifierToken: "player1", LoginToken: "token2"},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool { return len(c.testQueue()) == 2 }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.AuthResultMessage_INVALID_LT, latestResult(c).Result)
+	// Reached the max failures
+	assert.True(t, c.isClosing())
+}
+
+func TestDelegatedAuthBootstrap(t *testing.T) {
+	InitLogsAndMetrics()
+	settings := newTestServerSettings()
+	settings.AuthProvider = "delegate"
+	s := NewServer(settings, zap.NewNop())
+	// The servers have to be authenticated by another provider.
+	assert.Error(t, s.InitAuthenticator())
+	settings.ServerAuthProvider = "delegate"
+	assert.Error(t, s.InitAuthenticator())
+	settings.ServerAuthProvider = "static"
+	settings.AuthFile = filepath.Join(t.TempDir(), "tokens.json")
+	assert.NoError(t, os.WriteFile(settings.AuthFile, []byte(`{"server1": "token1"}`), 0644))
+	assert.NoError(t, s.InitConnections(settings.ServerFSM, settings.ClientFSM))
+	assert.NoError(t, s.InitAuthenticator())
+	s.InitChannels()
+
+	addConnection := func(t proto.ConnectionType) *Connection {
+		conn, _ := net.Pipe()
+		c := s.AddConnection(conn, t)
+		c.sender = &testQueuedMessageSender{}
+		return c
+	}
+	receive := func(c *Connection, msgType proto.MessageType, msg Message) {
+		body, err := protobuf.Marshal(msg)
+		assert.NoError(t, err)
+		c.receiveMessage(&proto.MessagePack{ChannelId: uint32(GlobalChannelId), MsgType: uint32(msgType), MsgBody: body})
+	}
+	authResult := func(c *Connection, connId ConnectionId) *proto.AuthResultMessage {
+		for _, msg := range c.testQueue() {
+			if result, ok := msg.(*proto.AuthResultMessage); ok && result.ConnId == uint32(connId) {
+				return result
+			}
+		}
+		return nil
+	}
+
+	// The first server is authenticated without the GLOBAL owner, then owns the GLOBAL channel.
+	server := addConnection(proto.ConnectionType_SERVER)
+	receive(server, proto.MessageType_AUTH, &proto.AuthMessage{PlayerIdentifierToken: "server1", LoginToken: "token1"})
+	assert.Eventually(t, func() bool { return authResult(server, server.id) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, authResult(server, server.id).Result)
+	receive(server, proto.MessageType_CREATE_CHANNEL, &proto.CreateChannelMessage{ChannelType: proto.ChannelType_GLOBAL})
+	assert.Eventually(t, func() bool { return s.globalChannel.getOwner() == server }, time.Second, 10*time.Millisecond)
+
+	// The client's authentication is delegated to the GLOBAL owner.
+	client := addConnection(proto.ConnectionType_CLIENT)
+	receive(client, proto.MessageType_AUTH, &proto.AuthMessage{PlayerIdentifierToken: "player1", LoginToken: "token2"})
+	assert.Eventually(t, func() bool {
+		msg, ok := server.latestMsg().(*proto.AuthDelegationMessage)
+		return ok && msg.ConnId == uint32(client.id) && msg.LoginToken == "token2"
+	}, time.Second, 10*time.Millisecond)
+	receive(server, proto.MessageType_AUTH_DELEGATION, &proto.AuthDelegationResultMessage{ConnId: uint32(client.id), Result: proto.AuthResultMessage_SUCCESSFUL})
+	assert.Eventually(t, func() bool { return authResult(client, client.id) != nil }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.AuthResultMessage_SUCCESSFUL, authResult(client, client.id).Result)
+	assert.Equal(t, "player1", client.Claims().UserId)
+}
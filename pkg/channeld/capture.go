@@ -0,0 +1,281 @@
+package channeld
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+// Exactly one of the ids should be set.
+type CaptureTarget struct {
+	ConnId    *uint32 `json:"connId,omitempty"`
+	ChannelId *uint32 `json:"channelId,omitempty"`
+}
+
+func (t CaptureTarget) String() string {
+	if t.ConnId != nil {
+		return fmt.Sprintf("conn-%d", *t.ConnId)
+	}
+	return fmt.Sprintf("channel-%d", *t.ChannelId)
+}
+
+type CaptureInfo struct {
+	CaptureId uint32 `json:"captureId"`
+	CaptureTarget
+	Path      string    `json:"path"`
+	StartTime time.Time `json:"startTime"`
+	Records   uint64    `json:"records"`
+}
+
+type packetCapture struct {
+	info   CaptureInfo
+	file   *os.File
+	logger *zap.Logger
+	// The receiving and flushing goroutines of the connections write concurrently. Also guards info.Records.
+	lock sync.Mutex
+}
+
+var errInvalidCaptureTarget = errors.New("either connId or channelId should be set")
+var errCaptureTargetNotFound = errors.New("the connection or the channel to capture doesn't exist")
+var errCaptureNotFound = errors.New("capture not found")
+
+// Starts capturing the messages for debugging, e.g. when a client reports a desync. The capture records every MessagePack received from
+// or sent to the connection, or every MessagePack whose channelId is the channel, into a new file under -capturedir.
+// The file is a sequence of size-prefixed CaptureRecords (the same format as the write-ahead log), which can be printed and replayed by channeld-replay.
+// The capture runs until StopCapture is called, or the connection or the channel is removed.
+// NOTE: the file has everything over the wire, including the login tokens.
+func StartCapture(target CaptureTarget) (CaptureInfo, error) {
+	return defaultServer.StartCapture(target)
+}
+
+func (s *Server) StartCapture(target CaptureTarget) (CaptureInfo, error) {
+	if (target.ConnId == nil) == (target.ChannelId == nil) {
+		return CaptureInfo{}, errInvalidCaptureTarget
+	}
+	if target.ConnId != nil && s.GetConnection(ConnectionId(*target.ConnId)) == nil {
+		return CaptureInfo{}, fmt.Errorf("%w: connection %d", errCaptureTargetNotFound, *target.ConnId)
+	}
+	if target.ChannelId != nil && s.GetChannel(ChannelId(*target.ChannelId)) == nil {
+		return CaptureInfo{}, fmt.Errorf("%w: channel %d", errCaptureTargetNotFound, *target.ChannelId)
+	}
+
+	if err := os.MkdirAll(s.Settings.CaptureDir, 0700); err != nil {
+		return CaptureInfo{}, fmt.Errorf("failed to create the capture directory: %w", err)
+	}
+	pc := &packetCapture{info: CaptureInfo{
+		CaptureId:     atomic.AddUint32(&s.nextCaptureId, 1),
+		CaptureTarget: target,
+		StartTime:     time.Now(),
+	}, logger: s.logger}
+	pc.info.Path = filepath.Join(s.Settings.CaptureDir,
+		fmt.Sprintf("%s-%s-%d.capture", target, pc.info.StartTime.Format("20060102150405"), pc.info.CaptureId))
+	// The captured payloads can carry the auth tokens and the user data, so only the owner can read them.
+	var err error
+	if pc.file, err = os.OpenFile(pc.info.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600); err != nil {
+		return CaptureInfo{}, err
+	}
+
+	s.capturesLock.Lock()
+	s.captures[pc.info.CaptureId] = pc
+	atomic.StoreInt32(&s.activeCaptures, int32(len(s.captures)))
+	s.capturesLock.Unlock()
+
+	s.logger.Info("started capture", zap.Uint32("captureId", pc.info.CaptureId), zap.Stringer("target", target), zap.String("path", pc.info.Path))
+	return pc.info, nil
+}
+
+// Stops the capture and closes its file.
+func StopCapture(captureId uint32) (CaptureInfo, error) {
+	return defaultServer.StopCapture(captureId)
+}
+
+func (s *Server) StopCapture(captureId uint32) (CaptureInfo, error) {
+	stopped := s.stopCaptures(func(pc *packetCapture) bool {
+		return pc.info.CaptureId == captureId
+	})
+	if len(stopped) == 0 {
+		return CaptureInfo{}, fmt.Errorf("%w: %d", errCaptureNotFound, captureId)
+	}
+	return stopped[0], nil
+}
+
+// Returns the running captures, ordered by the id.
+func ListCaptures() []CaptureInfo {
+	return defaultServer.ListCaptures()
+}
+
+func (s *Server) ListCaptures() []CaptureInfo {
+	s.capturesLock.RLock()
+	defer s.capturesLock.RUnlock()
+	infos := make([]CaptureInfo, 0, len(s.captures))
+	for _, pc := range s.captures {
+		infos = append(infos, pc.getInfo())
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].CaptureId < infos[j].CaptureId
+	})
+	return infos
+}
+
+func (pc *packetCapture) getInfo() CaptureInfo {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	return pc.info
+}
+
+func (s *Server) stopCaptures(filter func(pc *packetCapture) bool) []CaptureInfo {
+	s.capturesLock.Lock()
+	var stopped []*packetCapture
+	for id, pc := range s.captures {
+		if filter(pc) {
+			stopped = append(stopped, pc)
+			delete(s.captures, id)
+		}
+	}
+	atomic.StoreInt32(&s.activeCaptures, int32(len(s.captures)))
+	s.capturesLock.Unlock()
+
+	infos := make([]CaptureInfo, 0, len(stopped))
+	for _, pc := range stopped {
+		pc.lock.Lock()
+		if err := pc.file.Close(); err != nil {
+			s.logger.Error("failed to close the capture file", zap.String("path", pc.info.Path), zap.Error(err))
+		}
+		infos = append(infos, pc.info)
+		pc.lock.Unlock()
+		s.logger.Info("stopped capture", zap.Uint32("captureId", pc.info.CaptureId), zap.Stringer("target", pc.info.CaptureTarget), zap.Uint64("records", pc.info.Records))
+	}
+	return infos
+}
+
+func (s *Server) stopConnectionCaptures(connId ConnectionId) {
+	if atomic.LoadInt32(&s.activeCaptures) == 0 {
+		return
+	}
+	s.stopCaptures(func(pc *packetCapture) bool {
+		return pc.info.ConnId != nil && *pc.info.ConnId == uint32(connId)
+	})
+}
+
+func (s *Server) stopChannelCaptures(channelId ChannelId) {
+	if atomic.LoadInt32(&s.activeCaptures) == 0 {
+		return
+	}
+	s.stopCaptures(func(pc *packetCapture) bool {
+		return pc.info.ChannelId != nil && *pc.info.ChannelId == uint32(channelId)
+	})
+}
+
+func (pc *packetCapture) matches(connId ConnectionId, mp *proto.MessagePack) bool {
+	if pc.info.ConnId != nil {
+		return *pc.info.ConnId == uint32(connId)
+	}
+	return *pc.info.ChannelId == mp.ChannelId
+}
+
+func (pc *packetCapture) write(bytes []byte) {
+	pc.lock.Lock()
+	defer pc.lock.Unlock()
+	if err := writeSizePrefixed(pc.file, bytes); err != nil {
+		pc.logger.Error("failed to write the capture record", zap.String("path", pc.info.Path), zap.Error(err))
+		return
+	}
+	pc.info.Records++
+}
+
+// Writes the MessagePack to the captures that match it. msg is the outbound message before marshalling, or nil for the inbound message.
+// Called in the receiving goroutine (inbound) or the flush goroutine (outbound) of the connection.
+func (c *Connection) capture(direction proto.CaptureRecord_Direction, mp *proto.MessagePack, msg Message) {
+	s := c.server
+	if atomic.LoadInt32(&s.activeCaptures) == 0 {
+		return
+	}
+
+	s.capturesLock.RLock()
+	defer s.capturesLock.RUnlock()
+	var bytes []byte
+	for _, pc := range s.captures {
+		if !pc.matches(c.id, mp) {
+			continue
+		}
+		// Marshal once for all the matching captures.
+		if bytes == nil {
+			record := &proto.CaptureRecord{
+				Time:      time.Now().UnixNano(),
+				Direction: direction,
+				ConnId:    uint32(c.id),
+				ConnType:  c.connectionType,
+				Pack:      mp,
+			}
+			if msg != nil {
+				record.MsgName = string(msg.ProtoReflect().Descriptor().FullName())
+			}
+			var err error
+			if bytes, err = protobuf.Marshal(record); err != nil {
+				c.Logger().Error("failed to marshal the capture record", zap.Error(err))
+				return
+			}
+		}
+		pc.write(bytes)
+	}
+}
+
+// Reads the records of the capture file in order.
+func ReadCaptureFile(path string) ([]*proto.CaptureRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]*proto.CaptureRecord, 0)
+	err = readSizePrefixed(f, func(bytes []byte) error {
+		record := &proto.CaptureRecord{}
+		if err := protobuf.Unmarshal(bytes, record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+// Unmarshals the message body of the captured MessagePack, resolving the type like channeld does:
+// the inbound message by MessageMap (the user-space message from a server is a ServerForwardMessage),
+// and the outbound message by its full name in the protobuf registry.
+// Returns nil if the type can't be resolved, e.g. the user-space message from a client is not deserialized by channeld.
+func UnmarshalCapturedMessage(record *proto.CaptureRecord) (Message, error) {
+	var msg Message
+	if record.Direction == proto.CaptureRecord_OUTBOUND {
+		if record.MsgName == "" {
+			return nil, nil
+		}
+		msgType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(record.MsgName))
+		if err != nil {
+			return nil, err
+		}
+		msg = msgType.New().Interface()
+	} else if entry := MessageMap[proto.MessageType(record.Pack.MsgType)]; entry != nil {
+		msg = protobuf.Clone(entry.msg)
+	} else if record.Pack.MsgType >= uint32(proto.MessageType_USER_SPACE_START) && record.ConnType == proto.ConnectionType_SERVER {
+		msg = &proto.ServerForwardMessage{}
+	} else {
+		return nil, nil
+	}
+
+	if err := protobuf.Unmarshal(record.Pack.MsgBody, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
@@ -0,0 +1,114 @@
+package channeld
+
+import (
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"testing"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func TestCapture(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	oldCaptureDir := GlobalSettings.CaptureDir
+	defer func() {
+		GlobalSettings.CaptureDir = oldCaptureDir
+	}()
+	GlobalSettings.CaptureDir = t.TempDir()
+
+	_, err := StartCapture(CaptureTarget{})
+	assert.ErrorIs(t, err, errInvalidCaptureTarget)
+	missingId := uint32(999999)
+	_, err = StartCapture(CaptureTarget{ConnId: &missingId})
+	assert.ErrorIs(t, err, errCaptureTargetNotFound)
+	_, err = StartCapture(CaptureTarget{ChannelId: &missingId})
+	assert.ErrorIs(t, err, errCaptureTargetNotFound)
+
+	// Use the real sender, so the outbound messages are captured when flushed.
+	conn1, conn2 := net.Pipe()
+	go io.Copy(io.Discard, conn2)
+	client := AddConnection(conn1, proto.ConnectionType_CLIENT)
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	clientTestFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}]}`))
+	assert.NoError(t, err)
+	serverTestFsm, err := fsm.Load([]byte(`{"States": [{"Name": "OPEN", "MsgTypeWhitelist": "1-200"}]}`))
+	assert.NoError(t, err)
+	client.setFsm(&clientTestFsm)
+	client.setClaims(&AuthClaims{UserId: "player1"})
+	server.setFsm(&serverTestFsm)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+
+	clientId, channelId := uint32(client.id), uint32(ch.id)
+	connCapture, err := StartCapture(CaptureTarget{ConnId: &clientId})
+	assert.NoError(t, err)
+	channelCapture, err := StartCapture(CaptureTarget{ChannelId: &channelId})
+	assert.NoError(t, err)
+	assert.Len(t, ListCaptures(), 2)
+	if runtime.GOOS != "windows" {
+		stat, err := os.Stat(connCapture.Path)
+		assert.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+	}
+
+	// The rejected message is also captured, and so is the ErrorResultMessage in the response.
+	listMsg, _ := protobuf.Marshal(&proto.ListChannelMessage{TypeFilter: proto.ChannelType_TEST})
+	client.receiveMessage(&proto.MessagePack{ChannelId: 0, StubId: 1, MsgType: uint32(proto.MessageType_LIST_CHANNEL), MsgBody: listMsg})
+	client.Flush()
+	// The user-space message from the server is a ServerForwardMessage.
+	forwardMsg, _ := protobuf.Marshal(&proto.ServerForwardMessage{ClientConnId: clientId, Payload: []byte("hi")})
+	server.receiveMessage(&proto.MessagePack{ChannelId: channelId, Broadcast: proto.BroadcastType_SINGLE_CONNECTION, MsgType: 100, MsgBody: forwardMsg})
+	// Not in the captured connection or channel.
+	server.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)})
+
+	info, err := StopCapture(connCapture.CaptureId)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 2, info.Records)
+	_, err = StopCapture(connCapture.CaptureId)
+	assert.ErrorIs(t, err, errCaptureNotFound)
+
+	records, err := ReadCaptureFile(connCapture.Path)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.Equal(t, proto.CaptureRecord_INBOUND, records[0].Direction)
+		assert.Equal(t, clientId, records[0].ConnId)
+		assert.Equal(t, proto.ConnectionType_CLIENT, records[0].ConnType)
+		assert.EqualValues(t, 1, records[0].Pack.StubId)
+		msg, err := UnmarshalCapturedMessage(records[0])
+		assert.NoError(t, err)
+		assert.True(t, protobuf.Equal(&proto.ListChannelMessage{TypeFilter: proto.ChannelType_TEST}, msg))
+
+		// The outbound message is resolved by its name, as the response can be of another type than the request.
+		assert.Equal(t, proto.CaptureRecord_OUTBOUND, records[1].Direction)
+		assert.EqualValues(t, proto.MessageType_ERROR, records[1].Pack.MsgType)
+		assert.Equal(t, "channeld.ErrorResultMessage", records[1].MsgName)
+		msg, err = UnmarshalCapturedMessage(records[1])
+		assert.NoError(t, err)
+		assert.Equal(t, proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, msg.(*proto.ErrorResultMessage).Code)
+		assert.GreaterOrEqual(t, records[1].Time, records[0].Time)
+	}
+
+	// The capture is stopped when the channel is removed.
+	executeAndWait(ch, func(ch *Channel) {
+		RemoveChannel(ch)
+	})
+	assert.Empty(t, ListCaptures())
+	records, err = ReadCaptureFile(channelCapture.Path)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.Equal(t, uint32(server.id), records[0].ConnId)
+		msg, err := UnmarshalCapturedMessage(records[0])
+		assert.NoError(t, err)
+		assert.Equal(t, []byte("hi"), msg.(*proto.ServerForwardMessage).Payload)
+	}
+
+	// The user-space message from a client is not deserialized by channeld.
+	msg, err := UnmarshalCapturedMessage(&proto.CaptureRecord{ConnType: proto.ConnectionType_CLIENT, Pack: &proto.MessagePack{MsgType: 100}})
+	assert.NoError(t, err)
+	assert.Nil(t, msg)
+}
@@ -1,232 +1,387 @@
-package channeld
-
-import (
-	"container/list"
-	"errors"
-	"fmt"
-	"sync"
-	"sync/atomic"
-	"time"
-
-	"channeld.clewcat.com/channeld/proto"
-	"go.uber.org/zap"
-)
-
-type ChannelState uint8
-
-const (
-	INIT     ChannelState = 0
-	OPEN     ChannelState = 1
-	HANDOVER ChannelState = 2
-)
-
-type ChannelId uint32
-
-// ChannelTime is the relative time since the channel created.
-type ChannelTime int64 // time.Duration
-
-func (t ChannelTime) AddMs(ms uint32) ChannelTime {
-	return t + ChannelTime(uint32(time.Millisecond)*ms)
-}
-
-type channelMessage struct {
-	ctx     MessageContext
-	handler MessageHandlerFunc
-}
-
-type Channel struct {
-	id                    ChannelId
-	channelType           proto.ChannelType
-	state                 ChannelState
-	ownerConnection       *Connection
-	subscribedConnections map[ConnectionId]*ChannelSubscription
-	metadata              string // Read-only property, e.g. name
-	data                  *ChannelData
-	inMsgQueue            chan channelMessage
-	fanOutQueue           *list.List
-	startTime             time.Time // Time since channel created
-	tickInterval          time.Duration
-	tickFrames            int
-	enableClientBroadcast bool
-	logger                *zap.Logger
-	removing              int32
-}
-
-const (
-	GlobalChannelId ChannelId = 0
-)
-
-var nextChannelId ChannelId = GlobalChannelId
-var allChannels sync.Map //map[ChannelId]*Channel
-var globalChannel *Channel
-
-func InitChannels() {
-	globalChannel, _ = CreateChannel(proto.ChannelType_GLOBAL, nil)
-	allChannels.Store(GlobalChannelId, globalChannel)
-}
-
-func GetChannel(id ChannelId) *Channel {
-	ch, ok := allChannels.Load(id)
-	if ok {
-		return ch.(*Channel)
-	} else {
-		return nil
-	}
-}
-
-func CreateChannel(t proto.ChannelType, owner *Connection) (*Channel, error) {
-	if t == proto.ChannelType_GLOBAL && globalChannel != nil {
-		return nil, errors.New("failed to create WORLD channel as it already exists")
-	}
-
-	ch := &Channel{
-		id:                    nextChannelId,
-		channelType:           t,
-		ownerConnection:       owner,
-		subscribedConnections: make(map[ConnectionId]*ChannelSubscription),
-		/* Channel data is not created by default. See handleCreateChannel().
-		data:                  ReflectChannelData(t, nil),
-		*/
-		inMsgQueue:   make(chan channelMessage, 1024),
-		fanOutQueue:  list.New(),
-		startTime:    time.Now(),
-		tickInterval: time.Duration(GlobalSettings.GetChannelSettings(t).TickIntervalMs) * time.Millisecond,
-		tickFrames:   0,
-		logger: logger.With(
-			zap.String("channelType", t.String()),
-			zap.Uint32("channelId", uint32(nextChannelId)),
-		),
-		removing: 0,
-	}
-	if owner == nil {
-		ch.state = INIT
-	} else {
-		ch.state = OPEN
-	}
-	allChannels.Store(nextChannelId, ch)
-	nextChannelId += 1
-	go ch.Tick()
-
-	channelNum.WithLabelValues(ch.channelType.String()).Inc()
-
-	return ch, nil
-}
-
-func RemoveChannel(ch *Channel) {
-	atomic.AddInt32(&ch.removing, 1)
-	close(ch.inMsgQueue)
-	allChannels.Delete(ch.id)
-
-	channelNum.WithLabelValues(ch.channelType.String()).Dec()
-}
-
-func (ch *Channel) IsRemoving() bool {
-	return ch.removing > 0
-}
-
-func (ch *Channel) PutMessage(msg Message, handler MessageHandlerFunc, conn *Connection, pack *proto.MessagePack) {
-	if ch.IsRemoving() {
-		return
-	}
-	ch.inMsgQueue <- channelMessage{ctx: MessageContext{
-		MsgType:    proto.MessageType(pack.MsgType),
-		Msg:        msg,
-		Connection: conn,
-		Channel:    ch,
-		Broadcast:  pack.Broadcast,
-		StubId:     pack.StubId,
-		ChannelId:  pack.ChannelId,
-	}, handler: handler}
-}
-
-func (ch *Channel) GetTime() ChannelTime {
-	return ChannelTime(time.Since(ch.startTime))
-}
-
-func (ch *Channel) Tick() {
-	for {
-		if ch.IsRemoving() {
-			return
-		}
-
-		// Tick connections
-		if ch.ownerConnection != nil {
-			if ch.ownerConnection.IsRemoving() {
-				ch.ownerConnection = nil
-			}
-		}
-		for connId := range ch.subscribedConnections {
-			conn := GetConnection(connId)
-			if conn == nil || conn.IsRemoving() {
-				// Unsub the connection from the channel
-				delete(ch.subscribedConnections, connId)
-				if ch.ownerConnection != nil {
-					if ch.ownerConnection == conn {
-						// Reset the owner if it unsubscribed
-						ch.ownerConnection = nil
-					} else if conn != nil {
-						ch.ownerConnection.sendUnsubscribed(MessageContext{}, ch, conn, 0)
-					}
-				}
-			}
-		}
-
-		tickStart := time.Now()
-		ch.tickFrames++
-
-		for len(ch.inMsgQueue) > 0 {
-			cm := <-ch.inMsgQueue
-			if cm.ctx.Connection == nil {
-				ch.Logger().Warn("drops message as the sender is lost", zap.Uint32("msgType", uint32(cm.ctx.MsgType)))
-				continue
-			}
-			cm.handler(cm.ctx)
-			if ch.tickInterval > 0 && time.Since(tickStart) >= ch.tickInterval {
-				ch.Logger().Warn("spent too long handling messages, will delay the left to the next tick",
-					zap.Duration("duration", time.Since(tickStart)),
-					zap.Int("remaining", len(ch.inMsgQueue)),
-				)
-				break
-			}
-		}
-		ch.tickData(ch.GetTime())
-
-		tickDuration := time.Since(tickStart)
-		channelTickDuration.WithLabelValues(ch.channelType.String()).Set(float64(tickDuration) / float64(time.Millisecond))
-
-		time.Sleep(ch.tickInterval - tickDuration)
-	}
-}
-
-func (ch *Channel) Broadcast(ctx MessageContext) {
-	for connId := range ctx.Channel.subscribedConnections {
-		c := GetConnection(connId)
-		if c == nil {
-			continue
-		}
-		if ctx.Broadcast == proto.BroadcastType_ALL_BUT_SENDER && c == ctx.Connection {
-			continue
-		}
-		c.Send(ctx)
-	}
-}
-
-// Return true if the connection can 1)remove; 2)sub/unsub another connection to/from; the channel.
-func (c *Connection) HasAuthorityOver(ch *Channel) bool {
-	// The global owner has authority over everything.
-	if globalChannel.ownerConnection == c {
-		return true
-	}
-	if ch.ownerConnection == c {
-		return true
-	}
-	return false
-}
-
-func (ch *Channel) String() string {
-	return fmt.Sprintf("Channel(%s %d)", ch.channelType.String(), ch.id)
-}
-
-func (ch *Channel) Logger() *zap.Logger {
-	return ch.logger
-}
+package channeld
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+type ChannelState uint8
+
+const (
+	INIT     ChannelState = 0
+	OPEN     ChannelState = 1
+	HANDOVER ChannelState = 2
+)
+
+type ChannelId uint32
+
+// ChannelTime is the relative time since the channel created.
+type ChannelTime int64 // time.Duration
+
+func (t ChannelTime) AddMs(ms uint32) ChannelTime {
+	return t + ChannelTime(uint32(time.Millisecond)*ms)
+}
+
+type channelMessage struct {
+	ctx     MessageContext
+	handler MessageHandlerFunc
+	// Queued by channeld itself (see execute()), so there's no sender connection.
+	internal bool
+}
+
+type Channel struct {
+	id                    ChannelId
+	channelType           proto.ChannelType
+	state                 ChannelState
+	ownerConnection       *Connection  // Only accessed in the channel's goroutine. Use getOwner() in the other goroutines.
+	ownerSnapshot         atomic.Value // *Connection. See assignOwner().
+	subscribedConnections map[ConnectionId]*ChannelSubscription
+	metadata              string // Read-only property, e.g. name
+	data                  *ChannelData
+	inMsgQueue            chan channelMessage // Never closed, as the senders may be in any goroutine. See removed.
+	fanOutQueue           *list.List
+	startTime             time.Time // Time since channel created
+	tickInterval          int64     // time.Duration. Set in the channel's goroutine, and read by the health check.
+	tickFrames            int
+	enableClientBroadcast bool
+	logger                *zap.Logger
+	removing              int32
+	removed               chan struct{}               // Closed when the channel is removed, to wake up the channel's goroutine.
+	lastTickTime          int64                       // UnixNano. For detecting the stalled tick goroutine.
+	handoverEntities      map[uint32]*spatialHandover // The entities that are being handed over to other channels.
+	channelHandover       *spatialHandover            // Set if the whole channel is being handed over to another server.
+	lastTickDuration      int64                       // time.Duration. For the spatial load balancing.
+	spatialEntityNum      int32                       // The number of the entities in the SPATIAL channel data. For the spatial load balancing.
+	standbyOwners         []ConnectionId              // In the order of priority. The first one that is still connected becomes the owner when the owner is lost.
+	ownerlessMessages     []channelMessage            // The messages to the owner that arrived while the channel had no owner.
+	lastSnapshotTime      time.Time
+	lastSnapshotSeq       uint64                   // The next sequence number of the update message buffer when the last snapshot was taken.
+	dataKeyClaimed        bool                     // Is the channel the only one that saves to and restores from its data key?
+	dataKeyRejected       bool                     // Did the channel fail to claim the data key?
+	dataWatchers          map[chan<- []byte]uint32 // The admin API clients that are watching the channel data updates, and the number of the updates dropped for each.
+	server                *Server
+}
+
+const (
+	GlobalChannelId ChannelId = 0
+)
+
+// Creates the GLOBAL channel of the default server.
+func InitChannels() {
+	defaultServer.InitChannels()
+}
+
+func (s *Server) InitChannels() {
+	// InitChannels can be called multiple times (e.g. in the tests), so clear the previous channels first.
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		RemoveChannel(v.(*Channel))
+		return true
+	})
+	// The goroutines of the removed channels may still refer to the GLOBAL channel.
+	s.channelsRunning.Wait()
+	// The spatial servers are registered when they create the SPATIAL channels, which have just been removed.
+	s.spatialServers.Range(func(k interface{}, _ interface{}) bool {
+		s.spatialServers.Delete(k)
+		return true
+	})
+	s.nextChannelId = GlobalChannelId
+	s.globalChannel = nil
+
+	s.globalChannel, _ = s.CreateChannel(proto.ChannelType_GLOBAL, nil)
+	s.allChannels.Store(GlobalChannelId, s.globalChannel)
+}
+
+func GetChannel(id ChannelId) *Channel {
+	return defaultServer.GetChannel(id)
+}
+
+func (s *Server) GetChannel(id ChannelId) *Channel {
+	ch, ok := s.allChannels.Load(id)
+	if ok {
+		return ch.(*Channel)
+	} else {
+		return nil
+	}
+}
+
+func CreateChannel(t proto.ChannelType, owner *Connection) (*Channel, error) {
+	return defaultServer.CreateChannel(t, owner)
+}
+
+func (s *Server) CreateChannel(t proto.ChannelType, owner *Connection) (*Channel, error) {
+	return s.createChannel(t, owner, "")
+}
+
+// The metadata is set before the channel's goroutine starts, so it can be read in any goroutine.
+// The channels are only created in the GLOBAL channel's goroutine, or at startup before it ticks,
+// as nextChannelId and globalChannel are not guarded.
+func (s *Server) createChannel(t proto.ChannelType, owner *Connection, metadata string) (*Channel, error) {
+	if t == proto.ChannelType_GLOBAL && s.globalChannel != nil {
+		return nil, errors.New("failed to create WORLD channel as it already exists")
+	}
+
+	ch := &Channel{
+		id:                    s.nextChannelId,
+		channelType:           t,
+		metadata:              metadata,
+		ownerConnection:       owner,
+		subscribedConnections: make(map[ConnectionId]*ChannelSubscription),
+		/* Channel data is not created by default. See handleCreateChannel().
+		data:                  ReflectChannelData(t, nil),
+		*/
+		inMsgQueue:   make(chan channelMessage, 1024),
+		fanOutQueue:  list.New(),
+		startTime:    time.Now(),
+		lastTickTime: time.Now().UnixNano(),
+		tickInterval: int64(time.Duration(s.GetChannelSettings(t).TickIntervalMs) * time.Millisecond),
+		tickFrames:   0,
+		logger: s.logger.With(
+			zap.String("channelType", t.String()),
+			zap.Uint32("channelId", uint32(s.nextChannelId)),
+		),
+		removing: 0,
+		removed:  make(chan struct{}),
+		server:   s,
+	}
+	ch.assignOwner(owner)
+	if owner == nil {
+		ch.state = INIT
+	} else {
+		ch.state = OPEN
+	}
+	s.allChannels.Store(s.nextChannelId, ch)
+	s.nextChannelId += 1
+	s.channelsRunning.Add(1)
+	go func() {
+		defer s.channelsRunning.Done()
+		ch.Tick()
+	}()
+
+	channelNum.WithLabelValues(ch.channelType.String()).Inc()
+
+	return ch, nil
+}
+
+func RemoveChannel(ch *Channel) {
+	if !atomic.CompareAndSwapInt32(&ch.removing, 0, 1) {
+		return
+	}
+	close(ch.removed)
+	ch.server.allChannels.Delete(ch.id)
+	ch.server.stopChannelCaptures(ch.id)
+
+	channelNum.WithLabelValues(ch.channelType.String()).Dec()
+}
+
+func (ch *Channel) IsRemoving() bool {
+	return atomic.LoadInt32(&ch.removing) > 0
+}
+
+func (ch *Channel) PutMessage(msg Message, handler MessageHandlerFunc, conn *Connection, pack *proto.MessagePack) {
+	ch.putMessageContext(MessageContext{
+		MsgType:    proto.MessageType(pack.MsgType),
+		Msg:        msg,
+		Connection: conn,
+		Channel:    ch,
+		Broadcast:  pack.Broadcast,
+		StubId:     pack.StubId,
+		ChannelId:  pack.ChannelId,
+	}, handler)
+}
+
+// Queue the handler to be called in the channel's goroutine, e.g. when an asynchronous operation is completed.
+func (ch *Channel) putMessageContext(ctx MessageContext, handler MessageHandlerFunc) {
+	if ch.IsRemoving() {
+		return
+	}
+	select {
+	case ch.inMsgQueue <- channelMessage{ctx: ctx, handler: handler}:
+	case <-ch.removed:
+	}
+}
+
+// Queue the function to be called in the channel's goroutine. Unlike putMessageContext(), no sender connection is required.
+func (ch *Channel) execute(f func(ch *Channel)) {
+	ch.executeContext(context.Background(), f)
+}
+
+// Like execute(), but gives up queueing the function when the context is done. Returns false if the function is not queued.
+func (ch *Channel) executeContext(ctx context.Context, f func(ch *Channel)) bool {
+	if ch.IsRemoving() {
+		return false
+	}
+	select {
+	case ch.inMsgQueue <- ch.internalMessage(f):
+		return true
+	case <-ch.removed:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (ch *Channel) internalMessage(f func(ch *Channel)) channelMessage {
+	return channelMessage{
+		ctx:      MessageContext{Channel: ch, ChannelId: uint32(ch.id)},
+		handler:  func(ctx MessageContext) { f(ctx.Channel) },
+		internal: true,
+	}
+}
+
+// Runs the function in the channel's goroutine and waits for it to return. Returns false if the channel doesn't run it within the timeout.
+// The timeout also covers queueing the function, so a stuck channel with a full queue doesn't block the caller.
+func (ch *Channel) executeAndWait(f func(ch *Channel), timeout time.Duration) bool {
+	if ch.IsRemoving() {
+		return false
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	done := make(chan struct{})
+	select {
+	case ch.inMsgQueue <- ch.internalMessage(func(ch *Channel) {
+		f(ch)
+		close(done)
+	}):
+	case <-ch.removed:
+		return false
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-done:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Called in the channel's goroutine, or before the goroutine starts.
+func (ch *Channel) assignOwner(owner *Connection) {
+	ch.ownerConnection = owner
+	ch.ownerSnapshot.Store(owner)
+}
+
+// Returns the owner of the channel in any goroutine. The owner may have changed when it's used.
+func (ch *Channel) getOwner() *Connection {
+	owner, _ := ch.ownerSnapshot.Load().(*Connection)
+	return owner
+}
+
+func (ch *Channel) getTickInterval() time.Duration {
+	return time.Duration(atomic.LoadInt64(&ch.tickInterval))
+}
+
+func (ch *Channel) GetTime() ChannelTime {
+	return ChannelTime(time.Since(ch.startTime))
+}
+
+func (ch *Channel) Tick() {
+	for {
+		if ch.IsRemoving() {
+			// Take the final snapshot, so the channel can be restored when it's re-created.
+			if ch.isPersistent() {
+				ch.takeSnapshot(time.Now())
+				ch.server.queuePersistenceTask(persistenceTask{key: ch.dataKey(), closeLog: true})
+			}
+			ch.releaseDataKey()
+			return
+		}
+
+		// Tick connections
+		if ch.ownerConnection != nil {
+			if ch.ownerConnection.IsRemoving() {
+				ch.onOwnerLost()
+			}
+		}
+		for _, cs := range ch.subscribedConnections {
+			// The connection is removed by disconnecting, failing to resume, or being idle.
+			if cs.conn.IsRemoving() {
+				// Unsub the connection from the channel
+				cs.conn.UnsubscribeFromChannel(ch)
+				if ch.ownerConnection != nil {
+					if ch.ownerConnection == cs.conn {
+						// Reset the owner if it unsubscribed
+						ch.onOwnerLost()
+					} else {
+						ch.ownerConnection.sendUnsubscribed(MessageContext{}, ch, cs.conn, 0)
+					}
+				}
+			}
+		}
+
+		tickStart := time.Now()
+		atomic.StoreInt64(&ch.lastTickTime, tickStart.UnixNano())
+		ch.tickFrames++
+
+		for len(ch.inMsgQueue) > 0 {
+			cm := <-ch.inMsgQueue
+			if cm.ctx.Connection == nil && !cm.internal {
+				ch.Logger().Warn("drops message as the sender is lost", zap.Uint32("msgType", uint32(cm.ctx.MsgType)))
+				continue
+			}
+			cm.handler(cm.ctx)
+			if tickInterval := ch.getTickInterval(); tickInterval > 0 && time.Since(tickStart) >= tickInterval {
+				ch.Logger().Warn("spent too long handling messages, will delay the left to the next tick",
+					zap.Duration("duration", time.Since(tickStart)),
+					zap.Int("remaining", len(ch.inMsgQueue)),
+				)
+				break
+			}
+		}
+		ch.tickData(ch.GetTime())
+
+		ch.tickSnapshot(tickStart)
+
+		ch.updateSpatialLoad()
+
+		tickDuration := time.Since(tickStart)
+		atomic.StoreInt64(&ch.lastTickDuration, int64(tickDuration))
+		channelTickDuration.WithLabelValues(ch.channelType.String()).Set(float64(tickDuration) / float64(time.Millisecond))
+
+		select {
+		case <-ch.removed:
+		case <-time.After(ch.getTickInterval() - tickDuration):
+		}
+	}
+}
+
+func (ch *Channel) Broadcast(ctx MessageContext) {
+	for connId := range ctx.Channel.subscribedConnections {
+		c := ch.server.GetConnection(connId)
+		if c == nil {
+			continue
+		}
+		if ctx.Broadcast == proto.BroadcastType_ALL_BUT_SENDER && c == ctx.Connection {
+			continue
+		}
+		c.Send(ctx)
+	}
+}
+
+// Return true if the connection can 1)remove; 2)sub/unsub another connection to/from; the channel.
+func (c *Connection) HasAuthorityOver(ch *Channel) bool {
+	// The global owner has authority over everything.
+	if c.server.globalChannel.getOwner() == c {
+		return true
+	}
+	// The channel can be any channel, not only the one of the current goroutine.
+	if ch.getOwner() == c {
+		return true
+	}
+	return false
+}
+
+func (ch *Channel) String() string {
+	return fmt.Sprintf("Channel(%s %d)", ch.channelType.String(), ch.id)
+}
+
+func (ch *Channel) Logger() *zap.Logger {
+	return ch.logger
+}
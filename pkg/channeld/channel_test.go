@@ -1,54 +1,115 @@
-package channeld
-
-import (
-	"log"
-	"sync"
-	"testing"
-	"time"
-
-	"channeld.clewcat.com/channeld/proto"
-)
-
-func TestConcurrentAccessChannels(t *testing.T) {
-	InitLogsAndMetrics()
-	InitChannels()
-	wg := sync.WaitGroup{}
-
-	wg.Add(1)
-	go func() {
-		for i := 0; i < 100; i++ {
-			CreateChannel(proto.ChannelType_SUBWORLD, nil)
-			time.Sleep(1 * time.Millisecond)
-		}
-		wg.Done()
-	}()
-
-	// Read-Write ratio = 100:1
-	for i := 0; i < 100; i++ {
-		wg.Add(1)
-		go func() {
-			counter := 0
-			for i := 0; i < 100; i++ {
-				if GetChannel(ChannelId(i)) != nil {
-					counter++
-				}
-				time.Sleep(1 * time.Millisecond)
-			}
-			log.Println(counter)
-			wg.Done()
-		}()
-	}
-
-	wg.Add(1)
-	go func() {
-		for i := 0; i < 100; i++ {
-			allChannels.Range(func(k interface{}, v interface{}) bool {
-				return true
-			})
-			time.Sleep(1 * time.Millisecond)
-		}
-		wg.Done()
-	}()
-
-	wg.Wait()
-}
+package channeld
+
+import (
+	"context"
+	"log"
+	"sync"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentAccessChannels(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	wg := sync.WaitGroup{}
+
+	wg.Add(1)
+	go func() {
+		for i := 0; i < 100; i++ {
+			CreateChannel(proto.ChannelType_SUBWORLD, nil)
+			time.Sleep(1 * time.Millisecond)
+		}
+		wg.Done()
+	}()
+
+	// Read-Write ratio = 100:1
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			counter := 0
+			for i := 0; i < 100; i++ {
+				if GetChannel(ChannelId(i)) != nil {
+					counter++
+				}
+				time.Sleep(1 * time.Millisecond)
+			}
+			log.Println(counter)
+			wg.Done()
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		for i := 0; i < 100; i++ {
+			defaultServer.allChannels.Range(func(k interface{}, v interface{}) bool {
+				return true
+			})
+			time.Sleep(1 * time.Millisecond)
+		}
+		wg.Done()
+	}()
+
+	wg.Wait()
+}
+
+func TestExecuteAndWaitFullQueue(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, nil)
+	freezeTestChannel(ch)
+	// Fill the queue of the stuck channel.
+	for full := false; !full; {
+		select {
+		case ch.inMsgQueue <- ch.internalMessage(func(ch *Channel) {}):
+		default:
+			full = true
+		}
+	}
+
+	start := time.Now()
+	assert.False(t, ch.executeAndWait(func(ch *Channel) {}, 50*time.Millisecond))
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+}
+
+func TestExecuteFullQueue(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, nil)
+	freezeTestChannel(ch)
+	for full := false; !full; {
+		select {
+		case ch.inMsgQueue <- ch.internalMessage(func(ch *Channel) {}):
+		default:
+			full = true
+		}
+	}
+
+	// Gives up queueing when the context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.False(t, ch.executeContext(ctx, func(ch *Channel) {}))
+
+	// The blocked senders return when the channel is removed, instead of sending to a closed queue.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			ch.execute(func(ch *Channel) {})
+		}()
+		go func() {
+			defer wg.Done()
+			ch.putMessageContext(MessageContext{Channel: ch}, func(ctx MessageContext) {})
+		}()
+	}
+	RemoveChannel(ch)
+	// Removing again is a no-op.
+	RemoveChannel(ch)
+	wg.Wait()
+	assert.False(t, ch.executeContext(context.Background(), func(ch *Channel) {}))
+}
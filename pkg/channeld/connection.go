@@ -1,495 +1,754 @@
-package channeld
-
-import (
-	"bufio"
-	"encoding/binary"
-	"fmt"
-	"io"
-	"net"
-	"os"
-	"sync"
-	"sync/atomic"
-	"time"
-
-	"channeld.clewcat.com/channeld/pkg/fsm"
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/golang/snappy"
-	"github.com/gorilla/websocket"
-	"github.com/xtaci/kcp-go"
-	"go.uber.org/zap"
-	protobuf "google.golang.org/protobuf/proto"
-)
-
-type ConnectionId uint32
-
-// Add an interface before the underlying network layer for the test purpose.
-type MessageSender interface {
-	Send(c *Connection, ctx MessageContext) //(c *Connection, channelId ChannelId, msgType proto.MessageType, msg Message)
-}
-
-type queuedMessageSender struct {
-	MessageSender
-}
-
-func (s *queuedMessageSender) Send(c *Connection, ctx MessageContext) {
-	c.sendQueue <- ctx
-}
-
-type Connection struct {
-	id              ConnectionId
-	connectionType  proto.ConnectionType
-	compressionType proto.CompressionType
-	conn            net.Conn
-	reader          *bufio.Reader
-	writer          *bufio.Writer
-	sender          MessageSender
-	sendQueue       chan MessageContext
-	fsm             *fsm.FiniteStateMachine
-	logger          *zap.Logger
-	removing        int32 // Don't put the removing state into the FSM as 1) the FSM's states are user-defined. 2) the FSM doesn't have the race condition.
-}
-
-var allConnections sync.Map // map[ConnectionId]*Connection
-var nextConnectionId uint64 = 0
-var serverFsm fsm.FiniteStateMachine
-var clientFsm fsm.FiniteStateMachine
-
-func InitConnections(serverFsmPath string, clientFsmPath string) {
-	bytes, err := os.ReadFile(serverFsmPath)
-	if err == nil {
-		serverFsm, err = fsm.Load(bytes)
-	}
-	if err != nil {
-		logger.Panic("failed to read server FSM",
-			zap.Error(err),
-		)
-	} else {
-		logger.Info("loaded server FSM",
-			zap.String("path", serverFsmPath),
-			zap.String("currentState", serverFsm.CurrentState().Name),
-		)
-	}
-
-	bytes, err = os.ReadFile(clientFsmPath)
-	if err == nil {
-		clientFsm, err = fsm.Load(bytes)
-	}
-	if err != nil {
-		logger.Panic("failed to read client FSM", zap.Error(err))
-	} else {
-		logger.Info("loaded client FSM",
-			zap.String("path", clientFsmPath),
-			zap.String("currentState", clientFsm.CurrentState().Name),
-		)
-	}
-
-	/* Split each Connection.Flush into a goroutine (see AddConnection)
-	go func() {
-		for {
-			t := time.Now()
-			for _, c := range allConnections {
-				if !<-c.removing {
-					c.Flush()
-				}
-			}
-			time.Sleep(FlushInterval - time.Since(t))
-		}
-	}()
-	*/
-}
-
-func GetConnection(id ConnectionId) *Connection {
-	v, ok := allConnections.Load(id)
-	if ok {
-		c := v.(*Connection)
-		if c.IsRemoving() {
-			return nil
-		}
-		return c
-	} else {
-		return nil
-	}
-}
-
-func startGoroutines(connection *Connection) {
-	go func() {
-		for !connection.IsRemoving() {
-			connection.ReceivePacket()
-		}
-	}()
-
-	go func() {
-		for !connection.IsRemoving() {
-			connection.Flush()
-			time.Sleep(time.Millisecond)
-		}
-	}()
-}
-
-func StartListening(t proto.ConnectionType, network string, address string) {
-	logger.Info("start listenning",
-		zap.String("connType", t.String()),
-		zap.String("network", network),
-		zap.String("address", address),
-	)
-
-	var listener net.Listener
-	var err error
-	switch network {
-	case "ws", "websocket":
-		startWebSocketServer(t, address)
-		return
-	case "kcp":
-		listener, err = kcp.Listen(address)
-	default:
-		listener, err = net.Listen(network, address)
-	}
-
-	if err != nil {
-		logger.Panic("failed to listen", zap.Error(err))
-		return
-	}
-
-	defer listener.Close()
-
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			logger.Error("failed to accept connection", zap.Error(err))
-		} else {
-			connection := AddConnection(conn, t)
-			connection.Logger().Debug("accepted connection")
-			startGoroutines(connection)
-		}
-	}
-}
-
-func AddConnection(c net.Conn, t proto.ConnectionType) *Connection {
-	atomic.AddUint64(&nextConnectionId, 1)
-	connection := &Connection{
-		id:              ConnectionId(nextConnectionId),
-		connectionType:  t,
-		compressionType: proto.CompressionType_NO_COMPRESSION,
-		conn:            c,
-		reader:          bufio.NewReader(c),
-		writer:          bufio.NewWriter(c),
-		sender:          &queuedMessageSender{},
-		sendQueue:       make(chan MessageContext, 128),
-		logger: logger.With(
-			zap.String("connType", t.String()),
-			zap.Uint32("connId", uint32(nextConnectionId)),
-		),
-		removing: 0,
-	}
-	// IMPORTANT: always make a value copy
-	var fsm fsm.FiniteStateMachine
-	switch t {
-	case proto.ConnectionType_SERVER:
-		fsm = serverFsm
-	case proto.ConnectionType_CLIENT:
-		fsm = clientFsm
-	}
-
-	connection.fsm = &fsm
-	if connection.fsm == nil {
-		logger.Panic("cannot set the FSM for connection", zap.String("connType", t.String()))
-	}
-
-	allConnections.Store(connection.id, connection)
-
-	connectionNum.WithLabelValues(t.String()).Inc()
-
-	return connection
-}
-
-func RemoveConnection(c *Connection) {
-	defer func() {
-		recover()
-	}()
-	atomic.AddInt32(&c.removing, 1)
-	c.conn.Close()
-	close(c.sendQueue)
-	allConnections.Delete(c.id)
-
-	connectionNum.WithLabelValues(c.connectionType.String()).Dec()
-}
-
-func (c *Connection) IsRemoving() bool {
-	return c.removing > 0
-}
-
-type closeError struct {
-	source error
-}
-
-func (e *closeError) Error() string {
-	return e.source.Error()
-}
-
-func readBytes(c *Connection, len uint) ([]byte, error) {
-	bytes := make([]byte, len)
-	if _, err := io.ReadFull(c.reader, bytes); err != nil {
-		switch err := err.(type) {
-		case *net.OpError:
-			c.Logger().Warn("read bytes",
-				zap.String("op", err.Op),
-				zap.String("remoteAddr", c.conn.RemoteAddr().String()),
-				zap.Error(err),
-			)
-			RemoveConnection(c)
-			return nil, &closeError{err}
-		case *websocket.CloseError:
-			c.Logger().Info("disconnected",
-				zap.String("remoteAddr", c.conn.RemoteAddr().String()),
-			)
-			RemoveConnection(c)
-			return nil, &closeError{err}
-		}
-
-		if err == io.EOF {
-			c.Logger().Info("disconnected",
-				zap.String("remoteAddr", c.conn.RemoteAddr().String()),
-			)
-			RemoveConnection(c)
-			return nil, &closeError{err}
-		}
-		return nil, err
-	}
-	return bytes, nil
-}
-
-func _(c *Connection) (uint32, error) {
-	bytes, err := readBytes(c, 4)
-	if err != nil {
-		return 0, err
-	} else {
-		return binary.BigEndian.Uint32(bytes), nil
-	}
-}
-
-func (c *Connection) ReceivePacket() {
-	// FIXME: read all bytes once into a buffer
-	tag, err := readBytes(c, 5)
-	if err != nil {
-		return
-	}
-	if tag[0] != 67 {
-		c.Logger().Warn("invalid tag, the packet will be dropped",
-			zap.ByteString("tag", tag),
-			zap.Error(err),
-		)
-		_, isClosed := err.(*closeError)
-		if !isClosed {
-			// Drop the packet. Avoid the allocation.
-			//ioutil.ReadAll(c.reader)
-			io.Copy(io.Discard, c.reader)
-		}
-		return
-	}
-
-	packetSize := int(tag[3])
-	if tag[1] != 72 {
-		packetSize = packetSize | int(tag[1])<<16 | int(tag[2])<<8
-	} else if tag[2] != 78 {
-		packetSize = packetSize | int(tag[2])<<8
-	}
-
-	bytes := make([]byte, packetSize)
-	if _, err := io.ReadFull(c.reader, bytes); err != nil {
-		c.Logger().Error("reading packet", zap.Error(err))
-		return
-	}
-
-	bytesReceived.WithLabelValues(c.connectionType.String()).Add(float64(packetSize + 4))
-
-	// Apply the decompression from the 5th byte in the header
-	ct := tag[4]
-	_, valid := proto.CompressionType_name[int32(ct)]
-	if valid && ct != 0 {
-		c.compressionType = proto.CompressionType(ct)
-		if c.compressionType == proto.CompressionType_SNAPPY {
-			len, err := snappy.DecodedLen(bytes)
-			if err != nil {
-				c.Logger().Error("snappy.DecodedLen", zap.Error(err))
-				return
-			}
-			dst := make([]byte, len)
-			bytes, err = snappy.Decode(dst, bytes)
-			if err != nil {
-				c.Logger().Error("snappy.Decode", zap.Error(err))
-				return
-			}
-		}
-	}
-
-	var p proto.Packet
-	if err := protobuf.Unmarshal(bytes, &p); err != nil {
-		c.Logger().Error("unmarshalling packet", zap.Error(err))
-		return
-	}
-
-	for _, mp := range p.Messages {
-		c.receiveMessage(mp)
-	}
-
-	//c.Logger().Debug("received packet", zap.Int("size", packetSize))
-	packetReceived.WithLabelValues(c.connectionType.String()).Inc()
-}
-
-func (c *Connection) receiveMessage(mp *proto.MessagePack) {
-	channel := GetChannel(ChannelId(mp.ChannelId))
-	if channel == nil {
-		c.Logger().Warn("can't find channel",
-			zap.Uint32("channelId", mp.ChannelId),
-			zap.Uint32("msgType", mp.MsgType),
-		)
-		return
-	}
-
-	entry := MessageMap[proto.MessageType(mp.MsgType)]
-	if entry == nil && mp.MsgType < uint32(proto.MessageType_USER_SPACE_START) {
-		c.Logger().Error("undefined message type", zap.Uint32("msgType", mp.MsgType))
-		return
-	}
-
-	if !c.fsm.IsAllowed(mp.MsgType) {
-		c.Logger().Warn("message is not allowed for current state",
-			zap.Uint32("msgType", mp.MsgType),
-			zap.String("connState", c.fsm.CurrentState().Name),
-		)
-		return
-	}
-
-	var msg Message
-	var handler MessageHandlerFunc
-	if mp.MsgType >= uint32(proto.MessageType_USER_SPACE_START) && entry == nil {
-		// client -> channeld -> server
-		if c.connectionType == proto.ConnectionType_CLIENT {
-			// User-space message without handler won't be deserialized.
-			msg = &proto.ServerForwardMessage{ClientConnId: uint32(c.id), Payload: mp.MsgBody}
-			handler = handleClientToServerUserMessage
-		} else {
-			// server -> channeld -> client
-			msg = &proto.ServerForwardMessage{}
-			protobuf.Unmarshal(mp.MsgBody, msg)
-			handler = handleServerToClientUserMessage
-		}
-	} else {
-		handler = entry.handler
-		// Always make a clone!
-		msg = protobuf.Clone(entry.msg)
-		err := protobuf.Unmarshal(mp.MsgBody, msg)
-		if err != nil {
-			c.Logger().Error("unmarshalling message", zap.Error(err))
-			return
-		}
-	}
-
-	c.fsm.OnReceived(mp.MsgType)
-
-	channel.PutMessage(msg, handler, c, mp)
-
-	c.Logger().Debug("received message", zap.Uint32("msgType", mp.MsgType), zap.Int("size", len(mp.MsgBody)))
-
-	msgReceived.WithLabelValues(c.connectionType.String()).Inc() /*.WithLabelValues(
-		strconv.FormatUint(uint64(p.ChannelId), 10),
-		strconv.FormatUint(uint64(p.MsgType), 10),
-	)*/
-}
-
-func (c *Connection) Send(ctx MessageContext) {
-	if c.IsRemoving() {
-		return
-	}
-
-	c.sender.Send(c, ctx)
-}
-
-// Should NOT be called outside the flush goroutine!
-func (c *Connection) Flush() {
-	if len(c.sendQueue) == 0 {
-		return
-	}
-
-	p := proto.Packet{Messages: make([]*proto.MessagePack, 0, len(c.sendQueue))}
-	size := 0
-
-	// TODO: should we limit the message numbers per packet?
-	for len(c.sendQueue) > 0 {
-		mc := <-c.sendQueue
-		// The packet size should not exceed the capacity of 3 bytes
-		if size+protobuf.Size(mc.Msg) >= 0xfffff0 {
-			c.Logger().Warn("packet is going to be oversized")
-			break
-		}
-		msgBody, err := protobuf.Marshal(mc.Msg)
-		if err != nil {
-			c.Logger().Error("error marshalling message", zap.Error(err))
-			continue
-		}
-		p.Messages = append(p.Messages, &proto.MessagePack{
-			ChannelId: mc.ChannelId,
-			Broadcast: mc.Broadcast,
-			StubId:    mc.StubId,
-			MsgType:   uint32(mc.MsgType),
-			MsgBody:   msgBody,
-		})
-		size = protobuf.Size(&p)
-
-		c.Logger().Debug("sent message", zap.Uint32("msgType", uint32(mc.MsgType)), zap.Int("size", len(msgBody)))
-
-		msgSent.WithLabelValues(c.connectionType.String()).Inc() /*.WithLabelValues(
-			strconv.FormatUint(uint64(e.Channel.id), 10),
-			strconv.FormatUint(uint64(e.MsgType), 10),
-		)*/
-	}
-
-	bytes, err := protobuf.Marshal(&p)
-	if err != nil {
-		c.Logger().Error("error marshalling packet", zap.Error(err))
-		return
-	}
-
-	// Apply the compression
-	if c.compressionType == proto.CompressionType_SNAPPY {
-		dst := make([]byte, snappy.MaxEncodedLen(len(bytes)))
-		bytes = snappy.Encode(dst, bytes)
-	}
-
-	// 'CHNL' in ASCII
-	tag := []byte{67, 72, 78, 76, byte(c.compressionType)}
-	len := len(bytes)
-	tag[3] = byte(len & 0xff)
-	if len > 0xff {
-		tag[2] = byte((len >> 8) & 0xff)
-	}
-	if len > 0xffff {
-		tag[1] = byte((len >> 16) & 0xff)
-	}
-
-	/* Avoid writing multple times. With WebSocket, every Write() sends a message.
-	writer.Write(tag)
-	*/
-	_, err = c.writer.Write(append(tag, bytes...))
-	if err != nil {
-		c.Logger().Error("error writing packet", zap.Error(err))
-		return
-	}
-
-	c.writer.Flush()
-
-	packetSent.WithLabelValues(c.connectionType.String()).Inc()
-	bytesSent.WithLabelValues(c.connectionType.String()).Add(float64(len))
-}
-
-func (c *Connection) Disconnect() error {
-	return c.conn.Close()
-}
-
-func (c *Connection) String() string {
-	return fmt.Sprintf("Connection(%s %d %s)", c.connectionType, c.id, c.fsm.CurrentState().Name)
-}
-
-func (c *Connection) Logger() *zap.Logger {
-	return c.logger
-}
+package channeld
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/golang/snappy"
+	"github.com/gorilla/websocket"
+	"github.com/xtaci/kcp-go"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+type ConnectionId uint32
+
+// Add an interface before the underlying network layer for the test purpose.
+type MessageSender interface {
+	Send(c *Connection, ctx MessageContext) //(c *Connection, channelId ChannelId, msgType proto.MessageType, msg Message)
+}
+
+type queuedMessageSender struct {
+	MessageSender
+}
+
+func (s *queuedMessageSender) Send(c *Connection, ctx MessageContext) {
+	if c.isDetached() {
+		// Nobody flushes the queue until the connection is resumed, so don't block the sender.
+		select {
+		case c.sendQueue <- ctx:
+		default:
+		}
+		return
+	}
+	// Don't block on the full queue of the connection that is removed, as nobody flushes it any more.
+	select {
+	case c.sendQueue <- ctx:
+	case <-c.removed:
+	}
+}
+
+type Connection struct {
+	id              ConnectionId
+	connectionType  proto.ConnectionType
+	compressionType proto.CompressionType
+	conn            net.Conn
+	reader          *bufio.Reader
+	writer          *bufio.Writer
+	sender          MessageSender
+	sendQueue       chan MessageContext // Never closed, as the senders may be in any goroutine. See removed.
+	fsm             *fsm.FiniteStateMachine
+	fsmLock         sync.Mutex // Guards fsm. See withFsm().
+	logger          *zap.Logger
+	removed         chan struct{} // Closed when the connection is removed.
+	removing        int32         // Don't put the removing state into the FSM as 1) the FSM's states are user-defined. 2) the FSM doesn't have the race condition.
+	closing         int32         // Set by closeAfterFlush()
+	authFailures    uint32
+	authPending     int32       // Set while the AUTH is being authenticated. See handleAuth().
+	claims          *AuthClaims // Set in the GLOBAL channel's goroutine, and read by the receive goroutine for the FSM's RoleRules.
+	claimsLock      sync.RWMutex
+	resumeToken     string
+	resumeTokenLock sync.Mutex
+	transportLock   sync.RWMutex            // Guards conn, reader, writer, and compressionType, which are replaced when the connection is resumed. See getTransport().
+	detached        int32                   // The transport has dropped and the connection is waiting to be resumed.
+	transportEpoch  uint32                  // Increased every time the connection is detached, to stop the goroutines of the dropped transport.
+	lastRecvTime    int64                   // UnixNano. Updated whenever a packet is received.
+	rtt             int64                   // Smoothed round-trip time in nanoseconds. 0 = not measured yet.
+	spatialInterest *spatialInterest        // Only accessed in the GLOBAL channel's goroutine.
+	pendingFsm      *fsm.FiniteStateMachine // The reloaded FSM to migrate to. See applyPendingFsm().
+	pendingFsmLock  sync.Mutex
+	fsmTimer        *time.Timer // The timer of the current state's timeout. Guarded by fsmLock.
+	fsmStateSeq     uint32      // Increased every time the FSM state changes, to ignore the timer of the previous state. Guarded by fsmLock.
+	errorReplyLock  sync.Mutex
+	errorReplySec   int64 // The second (Unix time) that errorReplies counts in. See allowErrorReply().
+	errorReplies    uint
+	server          *Server
+}
+
+// Describes the message types of channeld to the FSM configs.
+var FsmOptions = fsm.Options{
+	MsgTypeName: func(msgType uint32) string {
+		if msgType >= uint32(proto.MessageType_USER_SPACE_START) {
+			return "USER_SPACE"
+		}
+		if msgType == uint32(proto.MessageType_INVALID) {
+			return ""
+		}
+		return proto.MessageType_name[int32(msgType)]
+	},
+	// Successful authentication moves the connection to the next state.
+	NextStateMsgTypes: []uint32{uint32(proto.MessageType_AUTH)},
+}
+
+// Loads the FSM config. If strict is false, the errors in the config are logged and ignored. See fsm.LoadStrict().
+func loadFsm(path string, strict bool) (fsm.FiniteStateMachine, error) {
+	bytes, err := os.ReadFile(path)
+	if err != nil {
+		return fsm.FiniteStateMachine{}, err
+	}
+	if strict {
+		return fsm.LoadStrict(bytes, FsmOptions)
+	}
+	return fsm.Load(bytes)
+}
+
+// Loads the FSM templates of the default server. Panics if any of them fails to load.
+func InitConnections(serverFsmPath string, clientFsmPath string) {
+	if err := defaultServer.InitConnections(serverFsmPath, clientFsmPath); err != nil {
+		defaultServer.logger.Panic("failed to init connections", zap.Error(err))
+	}
+}
+
+func (s *Server) InitConnections(serverFsmPath string, clientFsmPath string) error {
+	serverFsm, err := loadFsm(serverFsmPath, s.Settings.StrictFSM)
+	if err != nil {
+		return fmt.Errorf("failed to read server FSM: %w", err)
+	}
+	s.logger.Info("loaded server FSM",
+		zap.String("path", serverFsmPath),
+		zap.String("currentState", serverFsm.CurrentState().Name),
+	)
+
+	clientFsm, err := loadFsm(clientFsmPath, s.Settings.StrictFSM)
+	if err != nil {
+		return fmt.Errorf("failed to read client FSM: %w", err)
+	}
+	s.logger.Info("loaded client FSM",
+		zap.String("path", clientFsmPath),
+		zap.String("currentState", clientFsm.CurrentState().Name),
+	)
+
+	s.fsmTemplatesLock.Lock()
+	s.serverFsm = serverFsm
+	s.clientFsm = clientFsm
+	s.fsmTemplatesLock.Unlock()
+
+	/* Split each Connection.Flush into a goroutine (see AddConnection)
+	go func() {
+		for {
+			t := time.Now()
+			for _, c := range allConnections {
+				if !<-c.removing {
+					c.Flush()
+				}
+			}
+			time.Sleep(FlushInterval - time.Since(t))
+		}
+	}()
+	*/
+	return nil
+}
+
+func GetConnection(id ConnectionId) *Connection {
+	return defaultServer.GetConnection(id)
+}
+
+func (s *Server) GetConnection(id ConnectionId) *Connection {
+	v, ok := s.allConnections.Load(id)
+	if ok {
+		c := v.(*Connection)
+		if c.IsRemoving() {
+			return nil
+		}
+		return c
+	} else {
+		return nil
+	}
+}
+
+// The underlying transport of the connection.
+type transport struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+}
+
+// Returns the current transport. The goroutines of a transport should only use the transport they started with,
+// so they never read from or write to the transport that replaces it.
+func (c *Connection) getTransport() transport {
+	c.transportLock.RLock()
+	defer c.transportLock.RUnlock()
+	return transport{conn: c.conn, reader: c.reader, writer: c.writer}
+}
+
+func (c *Connection) getCompressionType() proto.CompressionType {
+	c.transportLock.RLock()
+	defer c.transportLock.RUnlock()
+	return c.compressionType
+}
+
+func startGoroutines(connection *Connection) {
+	epoch := atomic.LoadUint32(&connection.transportEpoch)
+	t := connection.getTransport()
+	isRunning := func() bool {
+		return !connection.IsRemoving() && atomic.LoadUint32(&connection.transportEpoch) == epoch
+	}
+
+	go func() {
+		for isRunning() {
+			connection.receivePacket(t)
+		}
+	}()
+
+	go func() {
+		for isRunning() {
+			connection.flush(t)
+			if connection.isClosing() && len(connection.sendQueue) == 0 {
+				RemoveConnection(connection)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+}
+
+// Listens and accepts the connections of the type for the default server. Blocks until the listener is closed.
+func StartListening(t proto.ConnectionType, network string, address string) {
+	listener, err := defaultServer.listen(context.Background(), t, network, address)
+	if err != nil {
+		defaultServer.logger.Panic("failed to listen", zap.Error(err))
+		return
+	}
+	defaultServer.serve(t, network, listener)
+}
+
+func (s *Server) listen(ctx context.Context, t proto.ConnectionType, network string, address string) (net.Listener, error) {
+	s.logger.Info("start listenning",
+		zap.String("connType", t.String()),
+		zap.String("network", network),
+		zap.String("address", address),
+	)
+
+	var listener net.Listener
+	var err error
+	switch network {
+	case "ws", "websocket":
+		listener, err = listenWebSocket(ctx, address)
+	case "kcp":
+		listener, err = kcp.Listen(address)
+	default:
+		var lc net.ListenConfig
+		listener, err = lc.Listen(ctx, network, address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.listenersLock.Lock()
+	s.listeners[t] = listener
+	s.listenersLock.Unlock()
+	return listener, nil
+}
+
+// Accepts the connections until the listener is closed.
+func (s *Server) serve(t proto.ConnectionType, network string, listener net.Listener) {
+	defer listener.Close()
+	s.setListening(t, true)
+	defer s.setListening(t, false)
+
+	if network == "ws" || network == "websocket" {
+		s.serveWebSocket(t, listener)
+		return
+	}
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if s.isShuttingDown() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			s.logger.Error("failed to accept connection", zap.Error(err))
+		} else {
+			connection := s.AddConnection(conn, t)
+			connection.Logger().Debug("accepted connection")
+			startGoroutines(connection)
+		}
+	}
+}
+
+func AddConnection(c net.Conn, t proto.ConnectionType) *Connection {
+	return defaultServer.AddConnection(c, t)
+}
+
+func (s *Server) AddConnection(c net.Conn, t proto.ConnectionType) *Connection {
+	id := ConnectionId(atomic.AddUint64(&s.nextConnectionId, 1))
+	connection := &Connection{
+		id:              id,
+		connectionType:  t,
+		compressionType: proto.CompressionType_NO_COMPRESSION,
+		conn:            c,
+		reader:          bufio.NewReader(c),
+		writer:          bufio.NewWriter(c),
+		sender:          &queuedMessageSender{},
+		sendQueue:       make(chan MessageContext, 128),
+		removed:         make(chan struct{}),
+		logger: s.logger.With(
+			zap.String("connType", t.String()),
+			zap.Uint32("connId", uint32(id)),
+		),
+		removing:     0,
+		lastRecvTime: time.Now().UnixNano(),
+		server:       s,
+	}
+	// IMPORTANT: always make a value copy
+	var fsm fsm.FiniteStateMachine
+	s.fsmTemplatesLock.RLock()
+	switch t {
+	case proto.ConnectionType_SERVER:
+		fsm = s.serverFsm
+	case proto.ConnectionType_CLIENT:
+		fsm = s.clientFsm
+	}
+	s.fsmTemplatesLock.RUnlock()
+
+	connection.setFsm(&fsm)
+	if connection.fsm == nil {
+		s.logger.Panic("cannot set the FSM for connection", zap.String("connType", t.String()))
+	}
+
+	s.allConnections.Store(connection.id, connection)
+
+	connectionNum.WithLabelValues(t.String()).Inc()
+
+	return connection
+}
+
+func RemoveConnection(c *Connection) {
+	if !c.markRemoving() {
+		return
+	}
+	if conn := c.getTransport().conn; conn != nil {
+		conn.Close()
+	}
+	c.server.allConnections.Delete(c.id)
+	c.resumeTokenLock.Lock()
+	if c.resumeToken != "" {
+		c.server.resumeTokens.Delete(c.resumeToken)
+	}
+	c.resumeTokenLock.Unlock()
+
+	c.server.stopConnectionCaptures(c.id)
+
+	c.fsmLock.Lock()
+	c.stopFsmTimer()
+	c.fsmLock.Unlock()
+
+	connectionNum.WithLabelValues(c.connectionType.String()).Dec()
+}
+
+// Returns false if the connection has already been removed.
+func (c *Connection) markRemoving() bool {
+	if !atomic.CompareAndSwapInt32(&c.removing, 0, 1) {
+		return false
+	}
+	close(c.removed)
+	return true
+}
+
+func (c *Connection) IsRemoving() bool {
+	return atomic.LoadInt32(&c.removing) > 0
+}
+
+// Remove the connection once the messages in the send queue are flushed, so the last response (e.g. the AuthResultMessage) can still reach the peer.
+func (c *Connection) closeAfterFlush() {
+	atomic.StoreInt32(&c.closing, 1)
+}
+
+// Sends the DISCONNECT notice with the reason, and removes the connection once the notice is flushed.
+func (c *Connection) disconnectWithNotice(reason string, reconnectAddress string) {
+	c.sendDisconnectNotice(reason, reconnectAddress)
+	c.closeGracefully()
+}
+
+// Nothing is sent to the detached connection, as it's removed rather than flushed.
+func (c *Connection) sendDisconnectNotice(reason string, reconnectAddress string) {
+	if c.isDetached() {
+		return
+	}
+	c.Send(MessageContext{
+		MsgType:   proto.MessageType_DISCONNECT,
+		Msg:       &proto.DisconnectMessage{ConnId: uint32(c.id), Reason: reason, ReconnectAddress: reconnectAddress},
+		ChannelId: uint32(GlobalChannelId),
+	})
+}
+
+// Removes the connection once the send queue is flushed. The detached connection is removed immediately, as there's no transport to flush to.
+func (c *Connection) closeGracefully() {
+	if c.isDetached() {
+		RemoveConnection(c)
+		return
+	}
+	c.closeAfterFlush()
+}
+
+func (c *Connection) isClosing() bool {
+	return atomic.LoadInt32(&c.closing) > 0
+}
+
+type closeError struct {
+	source error
+}
+
+func (e *closeError) Error() string {
+	return e.source.Error()
+}
+
+func readBytes(c *Connection, t transport, len uint) ([]byte, error) {
+	bytes := make([]byte, len)
+	// The transport can be replaced by resuming while reading, so only the transport being read is closed.
+	conn := t.conn
+	if _, err := io.ReadFull(t.reader, bytes); err != nil {
+		switch err := err.(type) {
+		case *net.OpError:
+			c.Logger().Warn("read bytes",
+				zap.String("op", err.Op),
+				zap.String("remoteAddr", conn.RemoteAddr().String()),
+				zap.Error(err),
+			)
+			c.onTransportClosed(conn)
+			return nil, &closeError{err}
+		case *websocket.CloseError:
+			c.Logger().Info("disconnected",
+				zap.String("remoteAddr", conn.RemoteAddr().String()),
+			)
+			c.onTransportClosed(conn)
+			return nil, &closeError{err}
+		}
+
+		if err == io.EOF {
+			c.Logger().Info("disconnected",
+				zap.String("remoteAddr", conn.RemoteAddr().String()),
+			)
+			c.onTransportClosed(conn)
+			return nil, &closeError{err}
+		}
+		return nil, err
+	}
+	return bytes, nil
+}
+
+func _(c *Connection) (uint32, error) {
+	bytes, err := readBytes(c, c.getTransport(), 4)
+	if err != nil {
+		return 0, err
+	} else {
+		return binary.BigEndian.Uint32(bytes), nil
+	}
+}
+
+func (c *Connection) ReceivePacket() {
+	c.receivePacket(c.getTransport())
+}
+
+func (c *Connection) receivePacket(t transport) {
+	// FIXME: read all bytes once into a buffer
+	tag, err := readBytes(c, t, 5)
+	if err != nil {
+		return
+	}
+	if tag[0] != 67 {
+		c.Logger().Warn("invalid tag, the packet will be dropped",
+			zap.ByteString("tag", tag),
+			zap.Error(err),
+		)
+		_, isClosed := err.(*closeError)
+		if !isClosed {
+			// Drop the packet. Avoid the allocation.
+			//ioutil.ReadAll(t.reader)
+			io.Copy(io.Discard, t.reader)
+		}
+		return
+	}
+
+	packetSize := int(tag[3])
+	if tag[1] != 72 {
+		packetSize = packetSize | int(tag[1])<<16 | int(tag[2])<<8
+	} else if tag[2] != 78 {
+		packetSize = packetSize | int(tag[2])<<8
+	}
+
+	bytes := make([]byte, packetSize)
+	if _, err := io.ReadFull(t.reader, bytes); err != nil {
+		c.Logger().Error("reading packet", zap.Error(err))
+		return
+	}
+
+	bytesReceived.WithLabelValues(c.connectionType.String()).Add(float64(packetSize + 4))
+	atomic.StoreInt64(&c.lastRecvTime, time.Now().UnixNano())
+
+	// Apply the decompression from the 5th byte in the header
+	ct := tag[4]
+	_, valid := proto.CompressionType_name[int32(ct)]
+	if valid && ct != 0 {
+		c.transportLock.Lock()
+		c.compressionType = proto.CompressionType(ct)
+		c.transportLock.Unlock()
+		if proto.CompressionType(ct) == proto.CompressionType_SNAPPY {
+			len, err := snappy.DecodedLen(bytes)
+			if err != nil {
+				c.Logger().Error("snappy.DecodedLen", zap.Error(err))
+				return
+			}
+			dst := make([]byte, len)
+			bytes, err = snappy.Decode(dst, bytes)
+			if err != nil {
+				c.Logger().Error("snappy.Decode", zap.Error(err))
+				return
+			}
+		}
+	}
+
+	var p proto.Packet
+	if err := protobuf.Unmarshal(bytes, &p); err != nil {
+		c.Logger().Error("unmarshalling packet", zap.Error(err))
+		return
+	}
+
+	for _, mp := range p.Messages {
+		// The connection could be retired by a RESUME message in the same packet.
+		if c.IsRemoving() {
+			break
+		}
+		c.receiveMessage(mp)
+	}
+
+	//c.Logger().Debug("received packet", zap.Int("size", packetSize))
+	packetReceived.WithLabelValues(c.connectionType.String()).Inc()
+}
+
+func (c *Connection) receiveMessage(mp *proto.MessagePack) {
+	// Captured before any check, so the rejected messages are also recorded.
+	c.capture(proto.CaptureRecord_INBOUND, mp, nil)
+
+	// The connection being closed, e.g. drained by the shutdown or kicked, doesn't take any more messages.
+	if c.isClosing() {
+		c.Logger().Debug("dropped the message as the connection is closing", zap.Uint32("msgType", mp.MsgType))
+		return
+	}
+
+	c.applyPendingFsm()
+
+	// The context for replying the error if the message is rejected.
+	errCtx := MessageContext{MsgType: proto.MessageType(mp.MsgType), Connection: c, StubId: mp.StubId, ChannelId: mp.ChannelId}
+
+	channel := c.server.GetChannel(ChannelId(mp.ChannelId))
+	if channel == nil {
+		c.Logger().Warn("can't find channel",
+			zap.Uint32("channelId", mp.ChannelId),
+			zap.Uint32("msgType", mp.MsgType),
+		)
+		c.sendError(errCtx, proto.ErrorResultMessage_CHANNEL_NOT_FOUND, "can't find the channel")
+		return
+	}
+	errCtx.Channel = channel
+
+	entry := MessageMap[proto.MessageType(mp.MsgType)]
+	if entry == nil && mp.MsgType < uint32(proto.MessageType_USER_SPACE_START) {
+		c.Logger().Error("undefined message type", zap.Uint32("msgType", mp.MsgType))
+		c.sendError(errCtx, proto.ErrorResultMessage_UNDEFINED_MESSAGE_TYPE, "undefined message type")
+		return
+	}
+
+	claims := c.Claims()
+	var allowed bool
+	var stateName string
+	c.withFsm(func(f *fsm.FiniteStateMachine) {
+		allowed = f.IsAllowedFor(mp.MsgType, claims)
+		stateName = f.CurrentState().Name
+	})
+	if !allowed {
+		c.Logger().Warn("message is not allowed for current state",
+			zap.Uint32("msgType", mp.MsgType),
+			zap.String("connState", stateName),
+		)
+		c.sendError(errCtx, proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, "message is not allowed for the current state: "+stateName)
+		return
+	}
+
+	var msg Message
+	var handler MessageHandlerFunc
+	if mp.MsgType >= uint32(proto.MessageType_USER_SPACE_START) && entry == nil {
+		// client -> channeld -> server
+		if c.connectionType == proto.ConnectionType_CLIENT {
+			// User-space message without handler won't be deserialized.
+			msg = &proto.ServerForwardMessage{ClientConnId: uint32(c.id), Payload: mp.MsgBody}
+			handler = handleClientToServerUserMessage
+		} else {
+			// server -> channeld -> client
+			msg = &proto.ServerForwardMessage{}
+			if err := protobuf.Unmarshal(mp.MsgBody, msg); err != nil {
+				c.Logger().Error("unmarshalling ServerForwardMessage", zap.Error(err))
+				c.sendError(errCtx, proto.ErrorResultMessage_INVALID_MESSAGE, "failed to unmarshal ServerForwardMessage")
+				return
+			}
+			handler = handleServerToClientUserMessage
+		}
+	} else {
+		handler = entry.handler
+		// Always make a clone!
+		msg = protobuf.Clone(entry.msg)
+		err := protobuf.Unmarshal(mp.MsgBody, msg)
+		if err != nil {
+			c.Logger().Error("unmarshalling message", zap.Error(err))
+			c.sendError(errCtx, proto.ErrorResultMessage_INVALID_MESSAGE, "failed to unmarshal the message")
+			return
+		}
+	}
+
+	if mp.MsgType == uint32(proto.MessageType_RESUME) {
+		// Resuming swaps the transport, so it must be done before the next packet is read.
+		handler(MessageContext{MsgType: proto.MessageType_RESUME, Msg: msg, Connection: c, Channel: channel, StubId: mp.StubId, ChannelId: mp.ChannelId})
+		return
+	}
+
+	c.withFsm(func(f *fsm.FiniteStateMachine) {
+		f.OnReceived(mp.MsgType)
+	})
+
+	channel.PutMessage(msg, handler, c, mp)
+
+	c.Logger().Debug("received message", zap.Uint32("msgType", mp.MsgType), zap.Int("size", len(mp.MsgBody)))
+
+	msgReceived.WithLabelValues(c.connectionType.String()).Inc() /*.WithLabelValues(
+		strconv.FormatUint(uint64(p.ChannelId), 10),
+		strconv.FormatUint(uint64(p.MsgType), 10),
+	)*/
+}
+
+func (c *Connection) Send(ctx MessageContext) {
+	if c.IsRemoving() {
+		return
+	}
+
+	c.sender.Send(c, ctx)
+}
+
+// Should NOT be called outside the flush goroutine!
+func (c *Connection) Flush() {
+	c.flush(c.getTransport())
+}
+
+func (c *Connection) flush(t transport) {
+	if len(c.sendQueue) == 0 {
+		return
+	}
+
+	p := proto.Packet{Messages: make([]*proto.MessagePack, 0, len(c.sendQueue))}
+	size := 0
+
+	// TODO: should we limit the message numbers per packet?
+	for len(c.sendQueue) > 0 {
+		mc := <-c.sendQueue
+		// The packet size should not exceed the capacity of 3 bytes
+		if size+protobuf.Size(mc.Msg) >= 0xfffff0 {
+			c.Logger().Warn("packet is going to be oversized")
+			break
+		}
+		msgBody, err := protobuf.Marshal(mc.Msg)
+		if err != nil {
+			c.Logger().Error("error marshalling message", zap.Error(err))
+			continue
+		}
+		mp := &proto.MessagePack{
+			ChannelId: mc.ChannelId,
+			Broadcast: mc.Broadcast,
+			StubId:    mc.StubId,
+			MsgType:   uint32(mc.MsgType),
+			MsgBody:   msgBody,
+		}
+		p.Messages = append(p.Messages, mp)
+		size = protobuf.Size(&p)
+		c.capture(proto.CaptureRecord_OUTBOUND, mp, mc.Msg)
+
+		c.Logger().Debug("sent message", zap.Uint32("msgType", uint32(mc.MsgType)), zap.Int("size", len(msgBody)))
+
+		msgSent.WithLabelValues(c.connectionType.String()).Inc() /*.WithLabelValues(
+			strconv.FormatUint(uint64(e.Channel.id), 10),
+			strconv.FormatUint(uint64(e.MsgType), 10),
+		)*/
+	}
+
+	bytes, err := protobuf.Marshal(&p)
+	if err != nil {
+		c.Logger().Error("error marshalling packet", zap.Error(err))
+		return
+	}
+
+	// Apply the compression
+	compressionType := c.getCompressionType()
+	if compressionType == proto.CompressionType_SNAPPY {
+		dst := make([]byte, snappy.MaxEncodedLen(len(bytes)))
+		bytes = snappy.Encode(dst, bytes)
+	}
+
+	// 'CHNL' in ASCII
+	tag := []byte{67, 72, 78, 76, byte(compressionType)}
+	len := len(bytes)
+	tag[3] = byte(len & 0xff)
+	if len > 0xff {
+		tag[2] = byte((len >> 8) & 0xff)
+	}
+	if len > 0xffff {
+		tag[1] = byte((len >> 16) & 0xff)
+	}
+
+	/* Avoid writing multple times. With WebSocket, every Write() sends a message.
+	writer.Write(tag)
+	*/
+	_, err = t.writer.Write(append(tag, bytes...))
+	if err != nil {
+		c.Logger().Error("error writing packet", zap.Error(err))
+		return
+	}
+
+	t.writer.Flush()
+
+	packetSent.WithLabelValues(c.connectionType.String()).Inc()
+	bytesSent.WithLabelValues(c.connectionType.String()).Add(float64(len))
+}
+
+func (c *Connection) Disconnect() error {
+	return c.getTransport().conn.Close()
+}
+
+func (c *Connection) String() string {
+	return fmt.Sprintf("Connection(%s %d %s)", c.connectionType, c.id, c.fsmState().Name)
+}
+
+// The verified identity of the connection. Returns nil if the connection hasn't been authenticated.
+func (c *Connection) Claims() *AuthClaims {
+	c.claimsLock.RLock()
+	defer c.claimsLock.RUnlock()
+	return c.claims
+}
+
+func (c *Connection) setClaims(claims *AuthClaims) {
+	c.claimsLock.Lock()
+	c.claims = claims
+	c.claimsLock.Unlock()
+}
+
+func (c *Connection) Logger() *zap.Logger {
+	return c.logger
+}
@@ -0,0 +1,92 @@
+package channeld
+
+import (
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"go.uber.org/zap"
+)
+
+// Runs f with the FSM of the connection locked. The FSM is used by the receiving goroutine, the GLOBAL channel's goroutine
+// (e.g. by the authentication) and the timer of the current state, and replaced when migrating to the reloaded FSM.
+// f must not call withFsm or fsmState.
+func (c *Connection) withFsm(f func(f *fsm.FiniteStateMachine)) {
+	c.fsmLock.Lock()
+	defer c.fsmLock.Unlock()
+	f(c.fsm)
+}
+
+// Returns the current state of the FSM. Can be called in any goroutine.
+func (c *Connection) fsmState() *fsm.State {
+	c.fsmLock.Lock()
+	defer c.fsmLock.Unlock()
+	return c.fsm.CurrentState()
+}
+
+// Sets the FSM of the connection, and starts the timer of the current state.
+func (c *Connection) setFsm(f *fsm.FiniteStateMachine) {
+	c.fsmLock.Lock()
+	defer c.fsmLock.Unlock()
+	c.replaceFsm(f)
+	if f.CurrentState() != nil {
+		c.onFsmStateChanged(f.CurrentState())
+	}
+}
+
+// Replaces the FSM without touching the timer of the current state. Should be called with fsmLock held.
+func (c *Connection) replaceFsm(f *fsm.FiniteStateMachine) {
+	f.SetOnStateChanged(func(_ *fsm.State, newState *fsm.State) {
+		c.onFsmStateChanged(newState)
+	})
+	c.fsm = f
+}
+
+// Starts the timer if the new state has a timeout, or closes the connection if the new state is terminal.
+// Called with fsmLock held.
+func (c *Connection) onFsmStateChanged(state *fsm.State) {
+	c.stopFsmTimer()
+	// Invalidates the timer of the previous state, in case it has fired but is waiting for the lock.
+	c.fsmStateSeq++
+	seq := c.fsmStateSeq
+
+	if state.Terminal {
+		c.Logger().Info("closing the connection as the FSM enters the terminal state", zap.String("connState", state.Name))
+		c.closeAfterFlush()
+		return
+	}
+
+	if timeout := state.Timeout(); timeout > 0 && !c.IsRemoving() {
+		c.fsmTimer = time.AfterFunc(timeout, func() {
+			c.onFsmTimeout(seq)
+		})
+	}
+}
+
+// Called with fsmLock held.
+func (c *Connection) stopFsmTimer() {
+	if c.fsmTimer != nil {
+		c.fsmTimer.Stop()
+		c.fsmTimer = nil
+	}
+}
+
+// Called in the timer's goroutine.
+func (c *Connection) onFsmTimeout(seq uint32) {
+	c.fsmLock.Lock()
+	defer c.fsmLock.Unlock()
+	// The state has been changed (or the connection removed) since the timer fired, but before the lock was acquired.
+	if c.fsmStateSeq != seq || c.IsRemoving() {
+		return
+	}
+	c.fsmTimer = nil
+	state := c.fsm.CurrentState()
+	if state.TimeoutState == "" {
+		return
+	}
+	c.Logger().Info("FSM state timed out",
+		zap.String("connState", state.Name),
+		zap.String("timeoutState", state.TimeoutState),
+	)
+	connectionFsmTimeouts.WithLabelValues(c.connectionType.String(), state.Name).Inc()
+	c.fsm.OnTimeout()
+}
@@ -0,0 +1,149 @@
+package channeld
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFsmTimeout(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	oldClientFsm := defaultServer.clientFsm
+	defer func() {
+		defaultServer.clientFsm = oldClientFsm
+	}()
+	var err error
+	defaultServer.clientFsm, err = fsm.Load([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1", "TimeoutMs": 50, "TimeoutState": "KICKED"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-10"},
+			{"Name": "KICKED", "Terminal": true}
+		]
+	}`))
+	assert.NoError(t, err)
+
+	client1 := addTestConnection(proto.ConnectionType_CLIENT)
+	client2 := addTestConnection(proto.ConnectionType_CLIENT)
+	// client2 leaves the INIT state before the timeout, e.g. by authenticating.
+	client2.withFsm(func(f *fsm.FiniteStateMachine) {
+		f.MoveToNextState()
+	})
+
+	assert.Eventually(t, func() bool {
+		return client1.isClosing()
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "KICKED", client1.fsmState().Name)
+	assert.Equal(t, "OPEN", client2.fsmState().Name)
+	assert.False(t, client2.isClosing())
+
+	// Entering the terminal state by ChangeState also closes the connection.
+	client3 := addTestConnection(proto.ConnectionType_CLIENT)
+	client3.withFsm(func(f *fsm.FiniteStateMachine) {
+		assert.NoError(t, f.ChangeState("KICKED"))
+	})
+	assert.True(t, client3.isClosing())
+
+	// The timer is stopped when the connection is removed.
+	client4 := addTestConnection(proto.ConnectionType_CLIENT)
+	RemoveConnection(client4)
+	client4.withFsm(func(f *fsm.FiniteStateMachine) {
+		assert.Nil(t, client4.fsmTimer)
+	})
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, "INIT", client4.fsmState().Name)
+}
+
+func TestFsmTimeoutAfterMigration(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	oldFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1", "TimeoutMs": 100, "TimeoutState": "KICKED"}, {"Name": "KICKED", "Terminal": true}]}`))
+	assert.NoError(t, err)
+	newFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1,12", "TimeoutMs": 100, "TimeoutState": "KICKED"}, {"Name": "KICKED", "Terminal": true}]}`))
+	assert.NoError(t, err)
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	c.setFsm(&oldFsm)
+	var timer *time.Timer
+	c.withFsm(func(f *fsm.FiniteStateMachine) {
+		timer = c.fsmTimer
+	})
+	assert.NotNil(t, timer)
+
+	c.pendingFsmLock.Lock()
+	c.pendingFsm = &newFsm
+	c.pendingFsmLock.Unlock()
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)})
+
+	// Migrated without re-arming the timer, so the timeout is not extended.
+	c.withFsm(func(f *fsm.FiniteStateMachine) {
+		assert.Same(t, &newFsm, f)
+		assert.Same(t, timer, c.fsmTimer)
+	})
+	assert.Eventually(t, func() bool {
+		return c.isClosing()
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, "KICKED", c.fsmState().Name)
+}
+
+func TestFsmRoleRules(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	oldClientFsm := defaultServer.clientFsm
+	defer func() {
+		defaultServer.clientFsm = oldClientFsm
+	}()
+	var err error
+	defaultServer.clientFsm, err = fsm.LoadStrict([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-10", "RoleRules": [{"MsgTypes": "5", "Role": "admin"}]}
+		]
+	}`), FsmOptions)
+	assert.NoError(t, err)
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	executeAndWait(defaultServer.globalChannel, func(_ *Channel) {
+		c.fsm.MoveToNextState()
+	})
+
+	listChannel := &proto.MessagePack{ChannelId: 0, StubId: 1, MsgType: uint32(proto.MessageType_LIST_CHANNEL)}
+	// Rejected without any reply, as the connection is not authenticated.
+	c.receiveMessage(listChannel)
+	assert.Empty(t, c.testQueue())
+
+	c.setClaims(&AuthClaims{UserId: "player1", Roles: []string{"player"}})
+	c.receiveMessage(listChannel)
+	errMsg, ok := c.latestMsg().(*proto.ErrorResultMessage)
+	if assert.True(t, ok) {
+		assert.Equal(t, proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, errMsg.Code)
+	}
+	assert.Len(t, c.testQueue(), 1)
+
+	c.setClaims(&AuthClaims{UserId: "admin1", Roles: []string{"admin"}})
+	c.receiveMessage(listChannel)
+	assert.Eventually(t, func() bool {
+		_, ok := c.latestMsg().(*proto.ListChannelResultMessage)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestConfigFsmsAreValid(t *testing.T) {
+	paths, err := filepath.Glob("../../config/*_fsm*.json")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, paths)
+	for _, path := range paths {
+		bytes, err := os.ReadFile(path)
+		assert.NoError(t, err)
+		_, err = fsm.LoadStrict(bytes, FsmOptions)
+		assert.NoError(t, err, path)
+	}
+}
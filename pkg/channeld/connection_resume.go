@@ -0,0 +1,156 @@
+package channeld
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+func init() {
+	// Registered here as handleResume restarts the receiving goroutine, which refers to MessageMap.
+	MessageMap[proto.MessageType_RESUME] = &messageMapEntry{&proto.ResumeMessage{}, handleResume}
+}
+
+func newResumeToken() string {
+	bytes := make([]byte, 16)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
+
+// Only the client connections can be resumed. Server connections should use the owner failover instead.
+func (c *Connection) canResume() bool {
+	return c.connectionType == proto.ConnectionType_CLIENT && c.server.Settings.ResumeGracePeriodMs > 0
+}
+
+// Issue a new resume token and invalidate the old one.
+func (c *Connection) issueResumeToken() string {
+	c.resumeTokenLock.Lock()
+	defer c.resumeTokenLock.Unlock()
+	if c.resumeToken != "" {
+		c.server.resumeTokens.Delete(c.resumeToken)
+	}
+	c.resumeToken = newResumeToken()
+	c.server.resumeTokens.Store(c.resumeToken, c)
+	return c.resumeToken
+}
+
+func (c *Connection) getResumeToken() string {
+	c.resumeTokenLock.Lock()
+	defer c.resumeTokenLock.Unlock()
+	return c.resumeToken
+}
+
+func (c *Connection) isDetached() bool {
+	return atomic.LoadInt32(&c.detached) > 0
+}
+
+// Called when the underlying transport is closed by the peer or the network.
+// The connection is removed, or detached if it can be resumed within the grace period.
+func (c *Connection) onTransportClosed(conn net.Conn) {
+	if c.getResumeToken() == "" || !c.canResume() {
+		RemoveConnection(c)
+		return
+	}
+
+	s := c.server
+	s.resumeLock.Lock()
+	defer s.resumeLock.Unlock()
+	// Ignore the transport that has already been dropped and replaced.
+	if c.IsRemoving() || c.isDetached() || c.getTransport().conn != conn {
+		return
+	}
+
+	// Stop the goroutines of the current transport. The subscriptions are kept, but no data will be fanned out until resumed.
+	epoch := atomic.AddUint32(&c.transportEpoch, 1)
+	atomic.StoreInt32(&c.detached, 1)
+	conn.Close()
+
+	gracePeriod := time.Duration(s.Settings.ResumeGracePeriodMs) * time.Millisecond
+	c.Logger().Info("detached, waiting for resume", zap.Duration("gracePeriod", gracePeriod))
+	connectionDetachedNum.WithLabelValues(c.connectionType.String()).Inc()
+
+	time.AfterFunc(gracePeriod, func() {
+		s.resumeLock.Lock()
+		defer s.resumeLock.Unlock()
+		// Make sure the connection hasn't been resumed and detached again since.
+		if c.isDetached() && atomic.LoadUint32(&c.transportEpoch) == epoch {
+			c.Logger().Info("the connection was not resumed within the grace period")
+			atomic.StoreInt32(&c.detached, 0)
+			connectionDetachedNum.WithLabelValues(c.connectionType.String()).Dec()
+			RemoveConnection(c)
+		}
+	})
+}
+
+// Move the transport of the new connection to the detached connection that the token was issued to.
+// Returns the resumed connection, or nil if the token is invalid or the connection is no longer detached.
+func resumeConnection(newConn *Connection, token string) *Connection {
+	s := newConn.server
+	v, ok := s.resumeTokens.Load(token)
+	if !ok {
+		return nil
+	}
+	c := v.(*Connection)
+
+	s.resumeLock.Lock()
+	defer s.resumeLock.Unlock()
+	if !c.isDetached() || c.IsRemoving() || c.connectionType != newConn.connectionType {
+		return nil
+	}
+
+	// Retire the new connection without closing its transport, which now belongs to the resumed connection.
+	newConn.markRemoving()
+	s.allConnections.Delete(newConn.id)
+	connectionNum.WithLabelValues(newConn.connectionType.String()).Dec()
+
+	// The goroutines of the dropped transport may still be running until they see the new epoch,
+	// but they only use the transport they started with.
+	t := newConn.getTransport()
+	compressionType := newConn.getCompressionType()
+	c.transportLock.Lock()
+	c.conn = t.conn
+	c.reader = t.reader
+	c.writer = t.writer
+	c.compressionType = compressionType
+	c.transportLock.Unlock()
+	atomic.StoreInt32(&c.detached, 0)
+	atomic.StoreInt64(&c.lastRecvTime, atomic.LoadInt64(&newConn.lastRecvTime))
+	connectionDetachedNum.WithLabelValues(c.connectionType.String()).Dec()
+	c.issueResumeToken()
+
+	startGoroutines(c)
+	return c
+}
+
+// Handled in the receiving goroutine of the new connection, not in the GLOBAL channel, as the following packets should be read by the resumed connection.
+func handleResume(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.ResumeMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a ResumeMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a ResumeMessage")
+		return
+	}
+
+	c := resumeConnection(ctx.Connection, msg.ResumeToken)
+	if c == nil {
+		ctx.Connection.Logger().Warn("failed to resume the connection as the token is invalid or expired")
+		ctx.Msg = &proto.ResumeResultMessage{Successful: false}
+		ctx.Connection.Send(ctx)
+		return
+	}
+
+	c.Logger().Info("resumed", zap.Uint32("newConnId", uint32(ctx.Connection.id)))
+	ctx.Connection = c
+	ctx.Msg = &proto.ResumeResultMessage{
+		Successful:      true,
+		ConnId:          uint32(c.id),
+		ResumeToken:     c.getResumeToken(),
+		CompressionType: c.server.Settings.CompressionType,
+	}
+	c.Send(ctx)
+}
@@ -0,0 +1,159 @@
+package channeld
+
+import (
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func resumeTestConnection(t *testing.T, token string) (*Connection, *proto.ResumeResultMessage) {
+	newConn := addTestConnection(proto.ConnectionType_CLIENT)
+	handleResume(MessageContext{
+		MsgType:    proto.MessageType_RESUME,
+		Msg:        &proto.ResumeMessage{ResumeToken: token},
+		Connection: newConn,
+		Channel:    defaultServer.globalChannel,
+	})
+	// The result is sent to the resumed connection if successful.
+	result, _ := newConn.latestMsg().(*proto.ResumeResultMessage)
+	return newConn, result
+}
+
+func TestResumeConnection(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	GlobalSettings.ResumeGracePeriodMs = 1000
+	defer func() { GlobalSettings.ResumeGracePeriodMs = 0 }()
+
+	// Server connections can't be resumed
+	s := addTestConnection(proto.ConnectionType_SERVER)
+	assert.False(t, s.canResume())
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	handleAuth(MessageContext{
+		Msg:        &proto.AuthMessage{PlayerIdentifierToken: "player1", LoginToken: "token1"},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool { return c.latestMsg() != nil }, time.Second, 10*time.Millisecond)
+	token := c.latestMsg().(*proto.AuthResultMessage).ResumeToken
+	assert.NotEmpty(t, token)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, s)
+	freezeTestChannel(testChannel)
+	c.SubscribeToChannel(testChannel, nil)
+
+	// The connection can't be resumed before it's detached
+	_, result := resumeTestConnection(t, token)
+	assert.False(t, result.Successful)
+
+	c.onTransportClosed(c.conn)
+	assert.True(t, c.isDetached())
+	assert.False(t, c.IsRemoving())
+	assert.Equal(t, c, GetConnection(c.id))
+	assert.Contains(t, testChannel.subscribedConnections, c.id)
+
+	_, result = resumeTestConnection(t, "invalid token")
+	assert.False(t, result.Successful)
+
+	newConn, _ := resumeTestConnection(t, token)
+	result = c.latestMsg().(*proto.ResumeResultMessage)
+	assert.True(t, result.Successful)
+	assert.EqualValues(t, c.id, result.ConnId)
+	assert.NotEqual(t, token, result.ResumeToken)
+	assert.False(t, c.isDetached())
+	// The new connection is retired and its transport is taken over
+	assert.True(t, newConn.IsRemoving())
+	assert.Nil(t, GetConnection(newConn.id))
+	assert.Equal(t, newConn.conn, c.conn)
+	assert.Contains(t, testChannel.subscribedConnections, c.id)
+
+	// The old token can't be used again
+	c.onTransportClosed(c.conn)
+	_, result = resumeTestConnection(t, token)
+	assert.False(t, result.Successful)
+}
+
+func TestResumeGracePeriodExpired(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	GlobalSettings.ResumeGracePeriodMs = 50
+	defer func() { GlobalSettings.ResumeGracePeriodMs = 0 }()
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	token := c.issueResumeToken()
+	c.onTransportClosed(c.conn)
+	assert.True(t, c.isDetached())
+
+	assert.Eventually(t, func() bool { return c.IsRemoving() }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, GetConnection(c.id))
+	_, result := resumeTestConnection(t, token)
+	assert.False(t, result.Successful)
+
+	// Without a resume token, the connection is removed immediately
+	c = addTestConnection(proto.ConnectionType_CLIENT)
+	c.onTransportClosed(c.conn)
+	assert.True(t, c.IsRemoving())
+}
+
+func TestResumeReplayMissedUpdates(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	GlobalSettings.ResumeGracePeriodMs = 1000
+	defer func() { GlobalSettings.ResumeGracePeriodMs = 0 }()
+
+	s := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
+	c := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, func(msg Message) (Message, error) {
+		// Let the ResumeResultMessage pass
+		if _, ok := msg.(*proto.ChannelDataUpdateMessage); !ok {
+			return msg, nil
+		}
+		return testChannelDataMessageProcessor(msg)
+	})
+	token := c.issueResumeToken()
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, s)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestChannelDataMessage{Text: "a", Num: 1}, nil)
+	c.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 50})
+
+	channelStartTime := ChannelTime(100 * int64(time.Millisecond))
+	testChannel.tickData(channelStartTime)
+	assert.Equal(t, 1, len(c.testQueue()))
+
+	c.onTransportClosed(c.conn)
+	testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Text: "b"}, channelStartTime.AddMs(10))
+	testChannel.tickData(channelStartTime.AddMs(50))
+	testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: 2}, channelStartTime.AddMs(60))
+	testChannel.tickData(channelStartTime.AddMs(100))
+	// Nothing is fanned out while detached
+	assert.Equal(t, 1, len(c.testQueue()))
+
+	resumeTestConnection(t, token)
+	assert.True(t, c.latestMsg().(*proto.ResumeResultMessage).Successful)
+	token = c.getResumeToken()
+
+	// The missed updates are fanned out at once
+	testChannel.tickData(channelStartTime.AddMs(110))
+	assert.Equal(t, 3, len(c.testQueue()))
+	assert.EqualValues(t, "b", c.latestMsg().(*proto.TestChannelDataMessage).Text)
+	assert.EqualValues(t, 2, c.latestMsg().(*proto.TestChannelDataMessage).Num)
+
+	// Detach again and let the buffer overflow
+	c.onTransportClosed(c.conn)
+	for i := 1; i <= MaxUpdateMsgBufferSize+1; i++ {
+		testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: uint32(i + 2)}, channelStartTime.AddMs(200+uint32(i)))
+	}
+	testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Text: "c"}, channelStartTime.AddMs(1000))
+
+	resumeTestConnection(t, token)
+	assert.True(t, c.latestMsg().(*proto.ResumeResultMessage).Successful)
+
+	// Some missed updates were dropped, so the whole data is fanned out
+	testChannel.tickData(channelStartTime.AddMs(1010))
+	assert.Equal(t, 5, len(c.testQueue()))
+	assert.EqualValues(t, "c", c.latestMsg().(*proto.TestChannelDataMessage).Text)
+	assert.EqualValues(t, MaxUpdateMsgBufferSize+3, c.latestMsg().(*proto.TestChannelDataMessage).Num)
+}
@@ -1,101 +1,111 @@
-package channeld
-
-import (
-	"net"
-	"net/http"
-	"strings"
-	"time"
-
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/gorilla/websocket"
-	"go.uber.org/zap"
-)
-
-type wsConn struct {
-	conn *websocket.Conn
-}
-
-func (c *wsConn) Read(b []byte) (n int, err error) {
-	_, body, err := c.conn.ReadMessage()
-	return copy(b, body), err
-}
-
-func (c *wsConn) Write(b []byte) (n int, err error) {
-	return len(b), c.conn.WriteMessage(websocket.BinaryMessage, b)
-}
-
-func (c *wsConn) Close() error {
-	return c.conn.Close()
-}
-
-func (c *wsConn) LocalAddr() net.Addr {
-	return c.conn.LocalAddr()
-}
-
-func (c *wsConn) RemoteAddr() net.Addr {
-	return c.conn.RemoteAddr()
-}
-
-func (c *wsConn) SetDeadline(t time.Time) error {
-	return c.conn.UnderlyingConn().SetDeadline(t)
-}
-
-func (c *wsConn) SetReadDeadline(t time.Time) error {
-	return c.conn.SetReadDeadline(t)
-}
-
-func (c *wsConn) SetWriteDeadline(t time.Time) error {
-	return c.conn.SetWriteDeadline(t)
-}
-
-var trustedOrigins []string
-
-func SetWebSocketTrustedOrigins(addrs []string) {
-	trustedOrigins = addrs
-}
-
-var upgrader websocket.Upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		if trustedOrigins == nil {
-			return true
-		} else {
-			for _, addr := range trustedOrigins {
-				if addr == r.RemoteAddr {
-					return true
-				}
-			}
-			return false
-		}
-	},
-}
-
-func startWebSocketServer(t proto.ConnectionType, address string) {
-	if protocolIndex := strings.Index(address, "://"); protocolIndex >= 0 {
-		address = address[protocolIndex+3:]
-	}
-
-	pattern := "/"
-	if pathIndex := strings.Index(address, "/"); pathIndex >= 0 {
-		pattern = address[pathIndex:]
-		address = address[:pathIndex-1]
-	}
-
-	mux := http.NewServeMux()
-	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			logger.Panic("Upgrade to websocket connection", zap.Error(err))
-		}
-		c := AddConnection(&wsConn{conn}, t)
-		startGoroutines(c)
-	})
-
-	server := http.Server{
-		Addr:    address,
-		Handler: mux,
-	}
-
-	defer server.Close()
-
-	logger.Error("stopped listening", zap.Error(server.ListenAndServe()))
-}
+package channeld
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+type wsConn struct {
+	conn *websocket.Conn
+}
+
+func (c *wsConn) Read(b []byte) (n int, err error) {
+	_, body, err := c.conn.ReadMessage()
+	return copy(b, body), err
+}
+
+func (c *wsConn) Write(b []byte) (n int, err error) {
+	return len(b), c.conn.WriteMessage(websocket.BinaryMessage, b)
+}
+
+func (c *wsConn) Close() error {
+	return c.conn.Close()
+}
+
+func (c *wsConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+func (c *wsConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	return c.conn.UnderlyingConn().SetDeadline(t)
+}
+
+func (c *wsConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+func (c *wsConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+func SetWebSocketTrustedOrigins(addrs []string) {
+	defaultServer.SetWebSocketTrustedOrigins(addrs)
+}
+
+// Only the WebSocket connections from the addresses are accepted. Nil means any address is accepted.
+func (s *Server) SetWebSocketTrustedOrigins(addrs []string) {
+	s.trustedOrigins = addrs
+}
+
+// The listener of the WebSocket connections. The HTTP requests to the pattern are upgraded.
+type webSocketListener struct {
+	net.Listener
+	pattern string
+}
+
+func listenWebSocket(ctx context.Context, address string) (net.Listener, error) {
+	if protocolIndex := strings.Index(address, "://"); protocolIndex >= 0 {
+		address = address[protocolIndex+3:]
+	}
+
+	pattern := "/"
+	if pathIndex := strings.Index(address, "/"); pathIndex >= 0 {
+		pattern = address[pathIndex:]
+		address = address[:pathIndex-1]
+	}
+
+	var lc net.ListenConfig
+	listener, err := lc.Listen(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	return &webSocketListener{Listener: listener, pattern: pattern}, nil
+}
+
+func (s *Server) serveWebSocket(t proto.ConnectionType, listener net.Listener) {
+	pattern := "/"
+	if l, ok := listener.(*webSocketListener); ok {
+		pattern = l.pattern
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, func(w http.ResponseWriter, r *http.Request) {
+		conn, err := s.upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			s.logger.Panic("Upgrade to websocket connection", zap.Error(err))
+		}
+		c := s.AddConnection(&wsConn{conn}, t)
+		startGoroutines(c)
+	})
+
+	server := http.Server{
+		Handler: mux,
+	}
+
+	defer server.Close()
+
+	if err := server.Serve(listener); !s.isShuttingDown() {
+		s.logger.Error("stopped listening", zap.Error(err))
+	}
+}
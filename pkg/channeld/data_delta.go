@@ -0,0 +1,425 @@
+package channeld
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/indiest/fmutils"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Sends the fields that changed since the last fan-out to the subscription with DeltaFanOut set.
+// The subscription keeps the data it received last time, and the current data is diffed against it only if there's any update since then.
+// The snapshots of the current data are shared by the subscriptions with the same field masks in the same tick.
+func (ch *Channel) fanOutDataDelta(c *Connection, cs *ChannelSubscription, foc *fanOutConnection, snapshots map[string]Message) {
+	if cs.deltaBase != nil && foc.nextSeq == ch.data.updateMsgBuffer.nextSeq {
+		return
+	}
+
+	key := strings.Join(cs.options.DataFieldMasks, ",")
+	snapshot, exists := snapshots[key]
+	if !exists {
+		snapshot = protobuf.Clone(ch.data.msg)
+		fmutils.Filter(snapshot, cs.options.DataFieldMasks)
+		snapshots[key] = snapshot
+	}
+
+	if cs.deltaBase == nil {
+		// Send the whole data for the first time
+		ch.fanOutDataUpdate(c, cs, snapshot)
+	} else {
+		delta, err := diffMessage(cs.deltaBase.ProtoReflect(), snapshot.ProtoReflect())
+		if err != nil {
+			ch.Logger().Error("failed to diff channel data", zap.Error(err))
+			return
+		}
+		if delta != nil {
+			c.Send(MessageContext{
+				MsgType:   proto.MessageType_CHANNEL_DATA_UPDATE,
+				Msg:       &proto.ChannelDataUpdateMessage{Delta: delta},
+				Channel:   ch,
+				Broadcast: proto.BroadcastType_NO_BROADCAST,
+				ChannelId: uint32(ch.id),
+			})
+		}
+	}
+	cs.deltaBase = snapshot
+}
+
+// Returns the changes from the old message to the new one, or nil if nothing changed. The messages should be of the same type.
+func diffMessage(old protoreflect.Message, new protoreflect.Message) (*proto.MessageDelta, error) {
+	if old.Descriptor().FullName() != new.Descriptor().FullName() {
+		return nil, fmt.Errorf("can't diff %s with %s", old.Descriptor().FullName(), new.Descriptor().FullName())
+	}
+
+	delta := &proto.MessageDelta{}
+	changed := false
+	set := new.New()
+	fields := new.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		oldHas, newHas := old.Has(fd), new.Has(fd)
+		if !oldHas && !newHas {
+			continue
+		}
+		num := uint32(fd.Number())
+		if !newHas {
+			delta.ClearedFields = append(delta.ClearedFields, num)
+			changed = true
+			continue
+		}
+
+		switch {
+		case fd.IsList():
+			listDelta, err := diffList(old.Get(fd).List(), new.Get(fd).List(), fd, set)
+			if err != nil {
+				return nil, err
+			}
+			if listDelta != nil {
+				if delta.Lists == nil {
+					delta.Lists = make(map[uint32]*proto.ListDelta)
+				}
+				delta.Lists[num] = listDelta
+				changed = true
+			}
+		case fd.IsMap():
+			mapDelta, mapChanged, err := diffMap(old.Get(fd).Map(), new.Get(fd).Map(), fd, set)
+			if err != nil {
+				return nil, err
+			}
+			if mapDelta != nil {
+				if delta.Maps == nil {
+					delta.Maps = make(map[uint32]*proto.MapDelta)
+				}
+				delta.Maps[num] = mapDelta
+			}
+			changed = changed || mapChanged
+		case fd.Message() != nil:
+			if !oldHas {
+				set.Set(fd, new.Get(fd))
+				changed = true
+				continue
+			}
+			sub, err := diffMessage(old.Get(fd).Message(), new.Get(fd).Message())
+			if err != nil {
+				return nil, err
+			}
+			if sub != nil {
+				if delta.ModifiedFields == nil {
+					delta.ModifiedFields = make(map[uint32]*proto.MessageDelta)
+				}
+				delta.ModifiedFields[num] = sub
+				changed = true
+			}
+		default:
+			if !oldHas || !scalarEqual(old.Get(fd), new.Get(fd)) {
+				set.Set(fd, new.Get(fd))
+				changed = true
+			}
+		}
+	}
+
+	if !changed {
+		return nil, nil
+	}
+	if hasAnyField(set) {
+		var err error
+		delta.Set, err = protobuf.MarshalOptions{Deterministic: true}.Marshal(set.Interface())
+		if err != nil {
+			return nil, err
+		}
+	}
+	return delta, nil
+}
+
+// Finds the number of the elements removed from the front that results in the fewest modified and appended elements.
+// The list is replaced if all the elements should be removed, e.g. a scalar element is changed in the middle.
+func diffList(old protoreflect.List, new protoreflect.List, fd protoreflect.FieldDescriptor, set protoreflect.Message) (*proto.ListDelta, error) {
+	isMessage := fd.Message() != nil
+	bestFront, bestCost := -1, 0
+	for front := 0; front <= old.Len(); front++ {
+		common := old.Len() - front
+		if common > new.Len() {
+			common = new.Len()
+		}
+		cost := new.Len() - common
+		for i := 0; i < common && (bestFront < 0 || cost < bestCost); i++ {
+			o, n := old.Get(front+i), new.Get(i)
+			if isMessage {
+				if !protobuf.Equal(o.Message().Interface(), n.Message().Interface()) {
+					cost++
+				}
+			} else if !scalarEqual(o, n) {
+				cost = -1
+				break
+			}
+		}
+		if cost >= 0 && (bestFront < 0 || cost < bestCost) {
+			bestFront, bestCost = front, cost
+			if cost == 0 {
+				break
+			}
+		}
+	}
+
+	if bestFront == old.Len() && old.Len() > 0 {
+		list := set.Mutable(fd).List()
+		for i := 0; i < new.Len(); i++ {
+			list.Append(new.Get(i))
+		}
+		return &proto.ListDelta{Replaced: true}, nil
+	}
+
+	common := old.Len() - bestFront
+	listDelta := &proto.ListDelta{RemovedFromFront: uint32(bestFront)}
+	if common > new.Len() {
+		listDelta.RemovedFromBack = uint32(common - new.Len())
+		common = new.Len()
+	}
+	for i := 0; i < common && isMessage; i++ {
+		sub, err := diffMessage(old.Get(bestFront+i).Message(), new.Get(i).Message())
+		if err != nil {
+			return nil, err
+		}
+		if sub != nil {
+			if listDelta.Modified == nil {
+				listDelta.Modified = make(map[uint32]*proto.MessageDelta)
+			}
+			listDelta.Modified[uint32(i)] = sub
+		}
+	}
+	if common < new.Len() {
+		list := set.Mutable(fd).List()
+		for i := common; i < new.Len(); i++ {
+			list.Append(new.Get(i))
+		}
+	}
+
+	if listDelta.RemovedFromFront == 0 && listDelta.RemovedFromBack == 0 && listDelta.Modified == nil && common == new.Len() {
+		return nil, nil
+	}
+	return listDelta, nil
+}
+
+// The added entries, and the replaced entries whose values are not messages, are put into the partial message.
+// The returned MapDelta is nil if there's no removed or modified entry.
+func diffMap(old protoreflect.Map, new protoreflect.Map, fd protoreflect.FieldDescriptor, set protoreflect.Message) (*proto.MapDelta, bool, error) {
+	mapDelta := &proto.MapDelta{}
+	changed := false
+	isMessage := fd.MapValue().Message() != nil
+
+	old.Range(func(k protoreflect.MapKey, _ protoreflect.Value) bool {
+		if !new.Has(k) {
+			intKey, stringKey, isString := encodeMapKey(k)
+			if isString {
+				mapDelta.RemovedStringKeys = append(mapDelta.RemovedStringKeys, stringKey)
+			} else {
+				mapDelta.RemovedIntKeys = append(mapDelta.RemovedIntKeys, intKey)
+			}
+		}
+		return true
+	})
+
+	var err error
+	new.Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+		if !old.Has(k) {
+			set.Mutable(fd).Map().Set(k, v)
+			changed = true
+			return true
+		}
+		oldValue := old.Get(k)
+		if !isMessage {
+			if !scalarEqual(oldValue, v) {
+				set.Mutable(fd).Map().Set(k, v)
+				changed = true
+			}
+			return true
+		}
+		var sub *proto.MessageDelta
+		sub, err = diffMessage(oldValue.Message(), v.Message())
+		if err != nil {
+			return false
+		}
+		if sub != nil {
+			intKey, stringKey, _ := encodeMapKey(k)
+			mapDelta.Modified = append(mapDelta.Modified, &proto.MapEntryDelta{IntKey: intKey, StringKey: stringKey, Delta: sub})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(mapDelta.RemovedIntKeys) == 0 && len(mapDelta.RemovedStringKeys) == 0 && len(mapDelta.Modified) == 0 {
+		return nil, changed, nil
+	}
+	// Make the output stable
+	sort.Slice(mapDelta.RemovedIntKeys, func(i, j int) bool { return mapDelta.RemovedIntKeys[i] < mapDelta.RemovedIntKeys[j] })
+	sort.Strings(mapDelta.RemovedStringKeys)
+	sort.Slice(mapDelta.Modified, func(i, j int) bool {
+		a, b := mapDelta.Modified[i], mapDelta.Modified[j]
+		return a.IntKey < b.IntKey || (a.IntKey == b.IntKey && a.StringKey < b.StringKey)
+	})
+	return mapDelta, true, nil
+}
+
+// Applies the delta fanned out by channeld to the subscriber's copy of the channel data.
+func ApplyChannelDataDelta(dst Message, delta *proto.MessageDelta) error {
+	return applyDelta(dst.ProtoReflect(), delta)
+}
+
+func applyDelta(dst protoreflect.Message, delta *proto.MessageDelta) error {
+	fields := dst.Descriptor().Fields()
+	getField := func(num uint32) (protoreflect.FieldDescriptor, error) {
+		fd := fields.ByNumber(protoreflect.FieldNumber(num))
+		if fd == nil {
+			return nil, fmt.Errorf("%s has no field %d", dst.Descriptor().FullName(), num)
+		}
+		return fd, nil
+	}
+
+	for _, num := range delta.ClearedFields {
+		fd, err := getField(num)
+		if err != nil {
+			return err
+		}
+		dst.Clear(fd)
+	}
+
+	for num, listDelta := range delta.Lists {
+		fd, err := getField(num)
+		if err != nil {
+			return err
+		}
+		if !fd.IsList() {
+			return fmt.Errorf("field %s is not a list", fd.FullName())
+		}
+		if listDelta.Replaced {
+			dst.Clear(fd)
+			continue
+		}
+		list := dst.Mutable(fd).List()
+		front, back := int(listDelta.RemovedFromFront), int(listDelta.RemovedFromBack)
+		if front+back > list.Len() {
+			return fmt.Errorf("can't remove %d elements from list %s of length %d", front+back, fd.FullName(), list.Len())
+		}
+		if front > 0 {
+			for i := 0; i < list.Len()-front; i++ {
+				list.Set(i, list.Get(i+front))
+			}
+		}
+		list.Truncate(list.Len() - front - back)
+		for index, sub := range listDelta.Modified {
+			if int(index) >= list.Len() {
+				return fmt.Errorf("index %d is out of list %s of length %d", index, fd.FullName(), list.Len())
+			}
+			if err := applyDelta(list.Get(int(index)).Message(), sub); err != nil {
+				return err
+			}
+		}
+	}
+
+	for num, mapDelta := range delta.Maps {
+		fd, err := getField(num)
+		if err != nil {
+			return err
+		}
+		if !fd.IsMap() {
+			return fmt.Errorf("field %s is not a map", fd.FullName())
+		}
+		m := dst.Mutable(fd).Map()
+		for _, k := range mapDelta.RemovedIntKeys {
+			m.Clear(decodeMapKey(fd.MapKey(), k, ""))
+		}
+		for _, k := range mapDelta.RemovedStringKeys {
+			m.Clear(decodeMapKey(fd.MapKey(), 0, k))
+		}
+		for _, entry := range mapDelta.Modified {
+			k := decodeMapKey(fd.MapKey(), entry.IntKey, entry.StringKey)
+			if !m.Has(k) {
+				return fmt.Errorf("map %s has no entry %v to modify", fd.FullName(), k.Interface())
+			}
+			if err := applyDelta(m.Mutable(k).Message(), entry.Delta); err != nil {
+				return err
+			}
+		}
+	}
+
+	for num, sub := range delta.ModifiedFields {
+		fd, err := getField(num)
+		if err != nil {
+			return err
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return fmt.Errorf("field %s is not a singular message", fd.FullName())
+		}
+		if err := applyDelta(dst.Mutable(fd).Message(), sub); err != nil {
+			return err
+		}
+	}
+
+	if len(delta.Set) > 0 {
+		return protobuf.UnmarshalOptions{Merge: true}.Unmarshal(delta.Set, dst.Interface())
+	}
+	return nil
+}
+
+func hasAnyField(m protoreflect.Message) bool {
+	has := false
+	m.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		has = true
+		return false
+	})
+	return has
+}
+
+// Compares the values of the non-message fields.
+func scalarEqual(a protoreflect.Value, b protoreflect.Value) bool {
+	if bytesA, ok := a.Interface().([]byte); ok {
+		return bytes.Equal(bytesA, b.Bytes())
+	}
+	return a.Interface() == b.Interface()
+}
+
+func encodeMapKey(k protoreflect.MapKey) (intKey uint64, stringKey string, isString bool) {
+	switch v := k.Interface().(type) {
+	case string:
+		return 0, v, true
+	case bool:
+		if v {
+			return 1, "", false
+		}
+		return 0, "", false
+	case int32:
+		return uint64(int64(v)), "", false
+	case int64:
+		return uint64(v), "", false
+	case uint32:
+		return uint64(v), "", false
+	case uint64:
+		return v, "", false
+	}
+	return 0, "", false
+}
+
+func decodeMapKey(fd protoreflect.FieldDescriptor, intKey uint64, stringKey string) protoreflect.MapKey {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(stringKey).MapKey()
+	case protoreflect.BoolKind:
+		return protoreflect.ValueOfBool(intKey != 0).MapKey()
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return protoreflect.ValueOfInt32(int32(int64(intKey))).MapKey()
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return protoreflect.ValueOfInt64(int64(intKey)).MapKey()
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return protoreflect.ValueOfUint32(uint32(intKey)).MapKey()
+	default:
+		return protoreflect.ValueOfUint64(intKey).MapKey()
+	}
+}
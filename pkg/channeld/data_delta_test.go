@@ -0,0 +1,149 @@
+package channeld
+
+import (
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func testDiffAndApply(t *testing.T, old Message, new Message) *proto.MessageDelta {
+	delta, err := diffMessage(old.ProtoReflect(), new.ProtoReflect())
+	assert.NoError(t, err)
+	if protobuf.Equal(old, new) {
+		assert.Nil(t, delta)
+		return nil
+	}
+	assert.NotNil(t, delta)
+	// The delta should survive the wire
+	bytes, err := protobuf.Marshal(delta)
+	assert.NoError(t, err)
+	delta = &proto.MessageDelta{}
+	assert.NoError(t, protobuf.Unmarshal(bytes, delta))
+
+	dst := protobuf.Clone(old)
+	assert.NoError(t, ApplyChannelDataDelta(dst, delta))
+	assert.True(t, protobuf.Equal(new, dst), "expected: %v, actual: %v", new, dst)
+	return delta
+}
+
+func TestDiffAndApplyDelta(t *testing.T) {
+	old := &proto.TestFieldMaskMessage{
+		Name: "a",
+		Msg:  &proto.TestFieldMaskMessage_NestedMessage{P1: 1, P2: 2},
+		List: []*proto.TestFieldMaskMessage_NestedMessage{{P1: 1}, {P1: 2}, {P1: 3}},
+		Kv1:  map[int64]*proto.TestFieldMaskMessage_NestedMessage{-1: {P1: 1}, 2: {P1: 2}},
+		Kv2:  map[int64]string{1: "a", 2: "b"},
+	}
+	testDiffAndApply(t, old, old)
+
+	// Singular fields
+	new := protobuf.Clone(old).(*proto.TestFieldMaskMessage)
+	new.Name = ""
+	new.Msg.P2 = 3
+	delta := testDiffAndApply(t, old, new)
+	assert.Equal(t, []uint32{1}, delta.ClearedFields)
+	assert.Contains(t, delta.ModifiedFields, uint32(2))
+	assert.Empty(t, delta.Set)
+	new.Msg = nil
+	testDiffAndApply(t, old, new)
+	testDiffAndApply(t, &proto.TestFieldMaskMessage{}, old)
+	testDiffAndApply(t, old, &proto.TestFieldMaskMessage{})
+
+	// The list of messages: remove the top, modify and append
+	new = protobuf.Clone(old).(*proto.TestFieldMaskMessage)
+	new.List = []*proto.TestFieldMaskMessage_NestedMessage{{P1: 2}, {P1: 3, P2: 3}, {P1: 4}}
+	delta = testDiffAndApply(t, old, new)
+	assert.EqualValues(t, 1, delta.Lists[3].RemovedFromFront)
+	assert.EqualValues(t, 0, delta.Lists[3].RemovedFromBack)
+	assert.Contains(t, delta.Lists[3].Modified, uint32(1))
+	assert.False(t, delta.Lists[3].Replaced)
+	new.List = new.List[:1]
+	testDiffAndApply(t, old, new)
+
+	// The maps
+	new = protobuf.Clone(old).(*proto.TestFieldMaskMessage)
+	delete(new.Kv1, -1)
+	new.Kv1[2].P2 = 2
+	new.Kv1[3] = &proto.TestFieldMaskMessage_NestedMessage{P1: 3}
+	new.Kv2[1] = "c"
+	delete(new.Kv2, 2)
+	delta = testDiffAndApply(t, old, new)
+	assert.Equal(t, []uint64{uint64(0xffffffffffffffff)}, delta.Maps[4].RemovedIntKeys)
+	assert.Equal(t, 1, len(delta.Maps[4].Modified))
+	assert.Equal(t, []uint64{2}, delta.Maps[5].RemovedIntKeys)
+
+	// The list of scalars
+	oldList := &proto.TestMergeMessage{List: []string{"a", "b", "c"}}
+	delta = testDiffAndApply(t, oldList, &proto.TestMergeMessage{List: []string{"b", "c", "d"}})
+	assert.EqualValues(t, 1, delta.Lists[1].RemovedFromFront)
+	delta = testDiffAndApply(t, oldList, &proto.TestMergeMessage{List: []string{"a", "x", "c"}})
+	assert.True(t, delta.Lists[1].Replaced)
+	testDiffAndApply(t, oldList, &proto.TestMergeMessage{List: []string{"a", "b"}})
+
+	// Only the changed entry is sent
+	oldTanks := &proto.TankGameChannelData{TransformStates: make(map[uint32]*proto.TransformState)}
+	for i := uint32(0); i < 100; i++ {
+		oldTanks.TransformStates[i] = &proto.TransformState{Position: &proto.Vector3F{X: float32(i), Y: 1, Z: 2}}
+	}
+	newTanks := protobuf.Clone(oldTanks).(*proto.TankGameChannelData)
+	newTanks.TransformStates[50].Position.X = 1000
+	delta = testDiffAndApply(t, oldTanks, newTanks)
+	assert.Equal(t, 1, len(delta.Maps[1].Modified))
+	assert.Less(t, protobuf.Size(delta), 32)
+}
+
+func TestDeltaFanOut(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c0 := addTestConnection(proto.ConnectionType_SERVER)
+	c1 := addTestConnection(proto.ConnectionType_CLIENT)
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestMapMessage{
+		Kv:  map[uint32]string{1: "a"},
+		Kv2: map[uint32]*proto.TestMapMessage_StringWrapper{1: {Content: "a", Num: 1}},
+	}, nil)
+	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 50, DeltaFanOut: true})
+
+	latestUpdate := func() *proto.ChannelDataUpdateMessage {
+		return c1.latestMsg().(*proto.ChannelDataUpdateMessage)
+	}
+
+	channelStartTime := ChannelTime(100 * int64(time.Millisecond))
+	// The whole data for the first time
+	testChannel.tickData(channelStartTime)
+	assert.Equal(t, 1, len(c1.testQueue()))
+	assert.Nil(t, latestUpdate().Delta)
+	clientData, err := latestUpdate().Data.UnmarshalNew()
+	assert.NoError(t, err)
+
+	// No update, no fan-out
+	testChannel.tickData(channelStartTime.AddMs(50))
+	assert.Equal(t, 1, len(c1.testQueue()))
+
+	// The same entry changed many times
+	for i := int64(2); i <= 10; i++ {
+		testChannel.Data().OnUpdate(&proto.TestMapMessage{
+			Kv2: map[uint32]*proto.TestMapMessage_StringWrapper{1: {Content: "a", Num: i}},
+		}, channelStartTime.AddMs(60))
+	}
+	testChannel.Data().OnUpdate(&proto.TestMapMessage{Kv: map[uint32]string{2: "b"}}, channelStartTime.AddMs(70))
+	testChannel.tickData(channelStartTime.AddMs(100))
+	assert.Equal(t, 2, len(c1.testQueue()))
+	delta := latestUpdate().Delta
+	assert.NotNil(t, delta)
+	assert.Nil(t, latestUpdate().Data)
+	assert.Equal(t, 1, len(delta.Maps[2].Modified))
+	assert.NoError(t, ApplyChannelDataDelta(clientData, delta))
+	assert.True(t, protobuf.Equal(testChannel.Data().msg, clientData))
+	assert.EqualValues(t, 10, clientData.(*proto.TestMapMessage).Kv2[1].Num)
+
+	// The update that doesn't change anything
+	testChannel.Data().OnUpdate(&proto.TestMapMessage{Kv: map[uint32]string{2: "b"}}, channelStartTime.AddMs(120))
+	testChannel.tickData(channelStartTime.AddMs(150))
+	assert.Equal(t, 2, len(c1.testQueue()))
+}
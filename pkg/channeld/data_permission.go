@@ -0,0 +1,98 @@
+package channeld
+
+import (
+	"strconv"
+
+	"github.com/indiest/fmutils"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// The field-level write permission of a subscription that is not the channel owner.
+type dataWritePermission struct {
+	// Empty means all fields are writable.
+	fieldMask fmutils.NestedMask
+	// The paths of the map fields in which only the entry keyed by connKey is writable.
+	connIdKeyedMaps map[string]bool
+	connKey         string
+}
+
+// Returns nil if the subscription can update any field of the data.
+func newDataWritePermission(cs *ChannelSubscription) *dataWritePermission {
+	if len(cs.options.WriteFieldMasks) == 0 && len(cs.options.ConnIdKeyedMapFields) == 0 {
+		return nil
+	}
+	p := &dataWritePermission{
+		fieldMask:       fmutils.NestedMaskFromPaths(cs.options.WriteFieldMasks),
+		connIdKeyedMaps: make(map[string]bool, len(cs.options.ConnIdKeyedMapFields)),
+		connKey:         strconv.FormatUint(uint64(cs.conn.id), 10),
+	}
+	for _, path := range cs.options.ConnIdKeyedMapFields {
+		p.connIdKeyedMaps[path] = true
+	}
+	return p
+}
+
+// Returns the paths of the disallowed fields (and map entries, in the form of "path[key]") that are set in the update message.
+// If strip is true, they are also cleared from the update message.
+func (p *dataWritePermission) check(updateMsg Message, strip bool) []string {
+	return p.checkMessage(updateMsg.ProtoReflect(), p.fieldMask, "", strip, nil)
+}
+
+func (p *dataWritePermission) checkMessage(msg protoreflect.Message, mask fmutils.NestedMask, prefix string, strip bool, denied []string) []string {
+	msg.Range(func(fd protoreflect.FieldDescriptor, v protoreflect.Value) bool {
+		path := string(fd.Name())
+		if prefix != "" {
+			path = prefix + "." + path
+		}
+
+		// An empty sub-mask means the whole field is writable.
+		var subMask fmutils.NestedMask
+		if len(mask) > 0 {
+			sub, ok := mask[string(fd.Name())]
+			if !ok {
+				denied = append(denied, path)
+				if strip {
+					msg.Clear(fd)
+				}
+				return true
+			}
+			subMask = sub
+		}
+		// No need to go deeper if everything under the field is writable.
+		if len(subMask) == 0 && len(p.connIdKeyedMaps) == 0 {
+			return true
+		}
+
+		if fd.IsMap() {
+			m := v.Map()
+			if p.connIdKeyedMaps[path] {
+				m.Range(func(mk protoreflect.MapKey, _ protoreflect.Value) bool {
+					if mk.String() != p.connKey {
+						denied = append(denied, path+"["+mk.String()+"]")
+						if strip {
+							m.Clear(mk)
+						}
+					}
+					return true
+				})
+			}
+			if fd.MapValue().Message() != nil {
+				m.Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+					denied = p.checkMessage(mv.Message(), subMask, path, strip, denied)
+					return true
+				})
+			}
+		} else if fd.IsList() {
+			if fd.Message() != nil {
+				list := v.List()
+				for i := 0; i < list.Len(); i++ {
+					denied = p.checkMessage(list.Get(i).Message(), subMask, path, strip, denied)
+				}
+			}
+		} else if fd.Message() != nil {
+			denied = p.checkMessage(v.Message(), subMask, path, strip, denied)
+		}
+		return true
+	})
+	return denied
+}
@@ -0,0 +1,156 @@
+package channeld
+
+import (
+	"strconv"
+	"testing"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestDataWritePermission(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	cs := &ChannelSubscription{conn: client, options: proto.ChannelSubscriptionOptions{CanUpdateData: true}}
+	assert.Nil(t, newDataWritePermission(cs))
+
+	cs.options.WriteFieldMasks = []string{"transformStates.position"}
+	cs.options.ConnIdKeyedMapFields = []string{"transformStates"}
+	p := newDataWritePermission(cs)
+	assert.NotNil(t, p)
+
+	own := uint32(client.id)
+	other := uint32(client.id) + 1
+	newUpdate := func() *proto.TankGameChannelData {
+		return &proto.TankGameChannelData{
+			TransformStates: map[uint32]*proto.TransformState{
+				own:   {Position: &proto.Vector3F{X: 1}, Rotation: &proto.Vector4F{W: 1}},
+				other: {Position: &proto.Vector3F{X: 2}},
+			},
+			TankStates: map[uint32]*proto.TankState{
+				own: {Health: 10},
+			},
+		}
+	}
+
+	// Only report the disallowed fields
+	updateMsg := newUpdate()
+	denied := p.check(updateMsg, false)
+	assert.ElementsMatch(t, []string{
+		"transformStates[" + strconv.FormatUint(uint64(other), 10) + "]",
+		"transformStates.rotation",
+		"tankStates",
+	}, denied)
+	assert.True(t, protobuf.Equal(newUpdate(), updateMsg))
+
+	// Strip the disallowed fields
+	updateMsg = newUpdate()
+	p.check(updateMsg, true)
+	assert.True(t, protobuf.Equal(&proto.TankGameChannelData{
+		TransformStates: map[uint32]*proto.TransformState{
+			own: {Position: &proto.Vector3F{X: 1}},
+		},
+	}, updateMsg))
+
+	// Nothing is denied in the allowed update
+	assert.Empty(t, p.check(updateMsg, false))
+}
+
+func TestChannelDataUpdateWritePermission(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	client.setClaims(&AuthClaims{UserId: "player1"})
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	freezeTestChannel(ch)
+	ch.InitData(&proto.TankGameChannelData{}, nil)
+	server.SubscribeToChannel(ch, nil)
+	client.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{
+		CanUpdateData:        true,
+		WriteFieldMasks:      []string{"transformStates"},
+		ConnIdKeyedMapFields: []string{"transformStates"},
+	})
+
+	own := uint32(client.id)
+	other := uint32(server.id)
+	update := func(c *Connection, updateMsg Message) {
+		anyData, _ := anypb.New(updateMsg)
+		handleChannelDataUpdate(MessageContext{
+			MsgType:    proto.MessageType_CHANNEL_DATA_UPDATE,
+			Msg:        &proto.ChannelDataUpdateMessage{Data: anyData},
+			Connection: c,
+			Channel:    ch,
+			StubId:     7,
+			ChannelId:  uint32(ch.id),
+		})
+	}
+	data := func() *proto.TankGameChannelData {
+		return ch.Data().msg.(*proto.TankGameChannelData)
+	}
+
+	// The channel owner can update any field.
+	update(server, &proto.TankGameChannelData{TankStates: map[uint32]*proto.TankState{other: {Health: 100}}})
+	assert.EqualValues(t, 100, data().TankStates[other].Health)
+	assert.Empty(t, server.testQueue())
+
+	// The allowed update is applied without any error.
+	update(client, &proto.TankGameChannelData{TransformStates: map[uint32]*proto.TransformState{own: {Position: &proto.Vector3F{X: 1}}}})
+	assert.EqualValues(t, 1, data().TransformStates[own].Position.X)
+	assert.Empty(t, client.testQueue())
+
+	// The disallowed fields are stripped.
+	update(client, &proto.TankGameChannelData{
+		TransformStates: map[uint32]*proto.TransformState{
+			own:   {Position: &proto.Vector3F{X: 2}},
+			other: {Position: &proto.Vector3F{X: 2}},
+		},
+		TankStates: map[uint32]*proto.TankState{other: {Health: 0, Removed: true}},
+	})
+	assert.EqualValues(t, 2, data().TransformStates[own].Position.X)
+	assert.NotContains(t, data().TransformStates, other)
+	assert.EqualValues(t, 100, data().TankStates[other].Health)
+	assert.False(t, data().TankStates[other].Removed)
+	errMsg, ok := client.latestMsg().(*proto.ErrorResultMessage)
+	assert.True(t, ok)
+	assert.Equal(t, proto.ErrorResultMessage_WRITE_PERMISSION_DENIED, errMsg.Code)
+	assert.EqualValues(t, proto.MessageType_CHANNEL_DATA_UPDATE, errMsg.MsgType)
+	assert.EqualValues(t, 7, errMsg.StubId)
+
+	// The update is rejected as a whole, after the channel owner changes the subscriber's options.
+	handleSubToChannel(MessageContext{
+		MsgType:    proto.MessageType_SUB_TO_CHANNEL,
+		Msg:        &proto.SubscribedToChannelMessage{ConnId: own, SubOptions: &proto.ChannelSubscriptionOptions{RejectWriteViolation: true}},
+		Connection: server,
+		Channel:    ch,
+	})
+	update(client, &proto.TankGameChannelData{
+		TransformStates: map[uint32]*proto.TransformState{
+			own:   {Position: &proto.Vector3F{X: 3}},
+			other: {Position: &proto.Vector3F{X: 3}},
+		},
+	})
+	assert.EqualValues(t, 2, data().TransformStates[own].Position.X)
+	assert.Len(t, client.testQueue(), 2)
+	assert.IsType(t, &proto.ErrorResultMessage{}, client.latestMsg())
+
+	// The subscriber can't change its own write permissions.
+	handleSubToChannel(MessageContext{
+		MsgType:    proto.MessageType_SUB_TO_CHANNEL,
+		Msg:        &proto.SubscribedToChannelMessage{ConnId: own, SubOptions: &proto.ChannelSubscriptionOptions{WriteFieldMasks: []string{"tankStates"}}},
+		Connection: client,
+		Channel:    ch,
+	})
+	assert.Equal(t, []string{"transformStates"}, ch.subscribedConnections[client.id].options.WriteFieldMasks)
+
+	// No access at all
+	ch.subscribedConnections[client.id].options.CanUpdateData = false
+	update(client, &proto.TankGameChannelData{TransformStates: map[uint32]*proto.TransformState{own: {}}})
+	assert.Len(t, client.testQueue(), 3)
+	assert.Equal(t, proto.ErrorResultMessage_WRITE_PERMISSION_DENIED, client.latestMsg().(*proto.ErrorResultMessage).Code)
+}
@@ -1,362 +1,765 @@
-package channeld
-
-import (
-	"container/list"
-	"fmt"
-	"math/rand"
-	"net"
-	"strconv"
-	"testing"
-	"time"
-
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/indiest/fmutils"
-	"github.com/stretchr/testify/assert"
-	protobuf "google.golang.org/protobuf/proto"
-	"google.golang.org/protobuf/types/known/anypb"
-)
-
-type testQueuedMessageSender struct {
-	MessageSender
-	msgQueue     []Message
-	msgProcessor func(Message) (Message, error)
-}
-
-func (s *testQueuedMessageSender) Send(c *Connection, ctx MessageContext) {
-	if s.msgProcessor != nil {
-		var err error
-		ctx.Msg, err = s.msgProcessor(ctx.Msg)
-		if err != nil {
-			panic(err)
-		}
-	}
-	s.msgQueue = append(s.msgQueue, ctx.Msg)
-}
-
-func addTestConnection(t proto.ConnectionType) *Connection {
-	return addTestConnectionWithProcessor(t, nil)
-}
-
-func addTestConnectionWithProcessor(t proto.ConnectionType, p func(Message) (Message, error)) *Connection {
-	conn1, _ := net.Pipe()
-	c := AddConnection(conn1, t)
-	c.sender = &testQueuedMessageSender{msgQueue: make([]Message, 0), msgProcessor: p}
-	return c
-}
-
-func (c *Connection) testQueue() []Message {
-	return c.sender.(*testQueuedMessageSender).msgQueue
-}
-
-func (c *Connection) latestMsg() Message {
-	queue := c.testQueue()
-	if len(queue) > 0 {
-		return queue[len(queue)-1]
-	} else {
-		return nil
-	}
-}
-
-func testChannelDataMessageProcessor(msg Message) (Message, error) {
-	// Extract the payload from the ChannelDataUpdatMessage
-	payload := msg.(*proto.ChannelDataUpdateMessage).Data
-	updateMsg, err := payload.UnmarshalNew()
-	return updateMsg, err
-}
-
-// See the test case in [the design doc](doc/design.md#fan-out)
-// TODO: add test cases with FieldMasks (no fan-out if no property is updated)
-func TestFanOutChannelData(t *testing.T) {
-	InitLogsAndMetrics()
-	InitChannels()
-
-	c0 := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
-	c1 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
-	c2 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
-
-	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
-	dataMsg := &proto.TestChannelDataMessage{
-		Text: "a",
-		Num:  1,
-	}
-	testChannel.InitData(dataMsg, nil)
-	// We need to manually tick the channel. Set the interval to a very large value.
-	testChannel.tickInterval = time.Hour
-
-	c0.SubscribeToChannel(testChannel, nil)
-	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{
-		FanOutIntervalMs: 50,
-	})
-
-	channelStartTime := ChannelTime(100 * int64(time.Millisecond))
-	// F0 = the whole data
-	testChannel.tickData(channelStartTime)
-	assert.Equal(t, 1, len(c1.testQueue()))
-	assert.Equal(t, 0, len(c2.testQueue()))
-	assert.EqualValues(t, dataMsg.Num, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
-
-	c2.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{
-		FanOutIntervalMs: 100,
-	})
-	// F1 = no data, F7 = the whole data
-	testChannel.tickData(channelStartTime.AddMs(50))
-	assert.Equal(t, 1, len(c1.testQueue()))
-	assert.Equal(t, 1, len(c2.testQueue()))
-	assert.EqualValues(t, dataMsg.Num, c2.latestMsg().(*proto.TestChannelDataMessage).Num)
-
-	// U1 arrives
-	u1 := &proto.TestChannelDataMessage{Text: "b"}
-	testChannel.Data().OnUpdate(u1, channelStartTime.AddMs(60))
-
-	// F2 = U1
-	testChannel.tickData(channelStartTime.AddMs(100))
-	assert.Equal(t, 2, len(c1.testQueue()))
-	assert.Equal(t, 1, len(c2.testQueue()))
-	// U1 doesn't have "ClientConnNum" property
-	assert.NotEqualValues(t, dataMsg.Num, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
-	assert.EqualValues(t, "b", c1.latestMsg().(*proto.TestChannelDataMessage).Text)
-	assert.EqualValues(t, "a", c2.latestMsg().(*proto.TestChannelDataMessage).Text)
-
-	// U2 arrives
-	u2 := &proto.TestChannelDataMessage{Text: "c"}
-	testChannel.Data().OnUpdate(u2, channelStartTime.AddMs(120))
-
-	// F8=U1+U2; F3 = U2
-	testChannel.tickData(channelStartTime.AddMs(150))
-	assert.Equal(t, 3, len(c1.testQueue()))
-	assert.Equal(t, 2, len(c2.testQueue()))
-	assert.EqualValues(t, "c", c1.latestMsg().(*proto.TestChannelDataMessage).Text)
-	assert.EqualValues(t, "c", c2.latestMsg().(*proto.TestChannelDataMessage).Text)
-}
-
-func BenchmarkCustomMergeMap(b *testing.B) {
-	dst := &proto.TestMergeMessage{
-		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{},
-	}
-	src := &proto.TestMergeMessage{
-		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{},
-	}
-	for i := 0; i < 100; i++ {
-		dst.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: false, Content: strconv.Itoa(rand.Int())}
-		if rand.Intn(100) < 10 {
-			src.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: true}
-		} else {
-			src.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: false, Content: strconv.Itoa(rand.Int())}
-		}
-	}
-
-	mergeOptions := &proto.ChannelDataMergeOptions{ShouldCheckRemovableMapField: true}
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		mergeWithOptions(dst, src, mergeOptions)
-	}
-
-	// Protoreflect merge:
-	// BenchmarkCustomMergeMap-12    	   26959	     43900 ns/op	    8464 B/op	     316 allocs/op
-	// BenchmarkCustomMergeMap-12    	   27038	     46457 ns/op	    8464 B/op	     316 allocs/op
-	// BenchmarkCustomMergeMap-12    	   24746	     49732 ns/op	    8464 B/op	     316 allocs/op
-
-	// Custom merge: (15x faster!!!)
-	// BenchmarkCustomMergeMap-12    	  353163	      3172 ns/op	       0 B/op	       0 allocs/op
-	// BenchmarkCustomMergeMap-12    	  457196	      2871 ns/op	       0 B/op	       0 allocs/op
-	// BenchmarkCustomMergeMap-12    	  419090	      3004 ns/op	       0 B/op	       0 allocs/op
-}
-
-func TestListRemoveElement(t *testing.T) {
-	list := list.New()
-	list.PushBack("a")
-	list.PushBack("b")
-	list.PushBack("b")
-	list.PushBack("c")
-	list.PushBack("b")
-	list.PushBack("d")
-	p := list.Front()
-	var n int = list.Len()
-	for i := 0; i < n; i++ {
-		fmt.Println(p.Value)
-		if p.Value == "b" {
-			tmp := p.Next()
-			list.Remove(p)
-			p = tmp
-			continue
-		}
-		p = p.Next()
-	}
-	assert.Equal(t, 3, list.Len())
-}
-
-func TestListMoveElement(t *testing.T) {
-	list := list.New()
-	list.PushBack("a")
-	list.PushBack("b")
-	list.PushBack("c")
-	assert.Equal(t, "a", list.Front().Value)
-
-	e := list.Front().Next()
-	assert.Equal(t, "b", e.Value)
-	temp := e.Prev()
-	list.MoveToBack(e)
-	e = temp.Next()
-	assert.Equal(t, "c", e.Value)
-}
-
-func TestDataMergeOptions(t *testing.T) {
-	InitLogsAndMetrics()
-	dstMsg := &proto.TestMergeMessage{
-		List: []string{"a", "b", "c"},
-		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{
-			1: {Content: "aa"},
-			2: {Content: "bb"},
-		},
-	}
-
-	srcMsg := &proto.TestMergeMessage{
-		List: []string{"d", "e"},
-		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{
-			1: {Removed: true},
-			2: {Content: "bbb"},
-		},
-	}
-
-	mergedMsg1 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
-	mergeOptions1 := &proto.ChannelDataMergeOptions{
-		ShouldReplaceList: true,
-	}
-	mergeWithOptions(mergedMsg1, srcMsg, mergeOptions1)
-	assert.Equal(t, 2, len(mergedMsg1.List))
-	assert.Equal(t, "e", mergedMsg1.List[1])
-
-	mergedMsg2 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
-	mergeOptions2 := &proto.ChannelDataMergeOptions{
-		ListSizeLimit: 4,
-	}
-	mergeWithOptions(mergedMsg2, srcMsg, mergeOptions2) // [a,b,c,d]
-	assert.Equal(t, 4, len(mergedMsg2.List))
-	assert.Equal(t, "d", mergedMsg2.List[3])
-	mergeOptions2.TruncateTop = true
-	mergeWithOptions(mergedMsg2, srcMsg, mergeOptions2) // [c,d,d,e]
-	assert.Equal(t, "c", mergedMsg2.List[0])
-	assert.Equal(t, "e", mergedMsg2.List[3])
-
-	mergedMsg3 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
-	mergeOptions3 := &proto.ChannelDataMergeOptions{
-		ShouldCheckRemovableMapField: true,
-	}
-	srcBytes, _ := protobuf.Marshal(srcMsg)
-	protobuf.Unmarshal(srcBytes, srcMsg)
-	mergeWithOptions(mergedMsg3, srcMsg, mergeOptions3)
-	assert.Equal(t, 1, len(mergedMsg3.Kv))
-	_, exists := mergedMsg3.Kv[1]
-	assert.False(t, exists)
-	assert.Equal(t, "bbb", mergedMsg3.Kv[2].Content)
-}
-
-func TestReflectChannelData(t *testing.T) {
-	globalData, err := ReflectChannelData(proto.ChannelType_TEST, nil)
-	assert.NoError(t, err)
-	assert.NotNil(t, globalData)
-	assert.IsType(t, &proto.TestChannelDataMessage{}, globalData.msg)
-}
-
-func TestDataFieldMasks(t *testing.T) {
-	nestedMsg := &proto.TestFieldMaskMessage_NestedMessage{
-		P1: 1,
-		P2: 2,
-	}
-	testMsg := &proto.TestFieldMaskMessage{
-		Name: "test",
-		Msg:  nestedMsg,
-		List: []*proto.TestFieldMaskMessage_NestedMessage{nestedMsg},
-		Kv1: map[int64]*proto.TestFieldMaskMessage_NestedMessage{
-			10: nestedMsg,
-		},
-		Kv2: map[int64]string{
-			100: "hello",
-		},
-	}
-
-	filteredMsg1 := protobuf.Clone(testMsg)
-	fmutils.Filter(filteredMsg1, []string{"name"})
-	t.Log(filteredMsg1.(*proto.TestFieldMaskMessage).String())
-
-	filteredMsg2 := protobuf.Clone(testMsg)
-	fmutils.Filter(filteredMsg2, []string{"msg.p1"})
-	t.Log(filteredMsg2.(*proto.TestFieldMaskMessage).String())
-
-	filteredMsg3 := protobuf.Clone(testMsg)
-	fmutils.Filter(filteredMsg3, []string{"list.p2"})
-	t.Log(filteredMsg3.(*proto.TestFieldMaskMessage).String())
-
-	filteredMsg4 := protobuf.Clone(testMsg)
-	fmutils.Filter(filteredMsg4, []string{"kv1.p1", "kv1.p2", "kv1.p3"})
-	t.Log(filteredMsg4.(*proto.TestFieldMaskMessage).String())
-	fmutils.Prune(filteredMsg4, []string{"kv1.p1"})
-	t.Log(filteredMsg4.(*proto.TestFieldMaskMessage).String())
-
-	filteredMsg5 := protobuf.Clone(testMsg)
-	fmutils.Filter(filteredMsg5, []string{"kv2.a"})
-	t.Log(filteredMsg5.(*proto.TestFieldMaskMessage).String())
-}
-
-func TestProtobufAny(t *testing.T) {
-	any1, err := anypb.New(&proto.TestAnyMessage_Type1{Value: "a"})
-	assert.NoError(t, err)
-
-	any2, err := anypb.New(&proto.TestAnyMessage_Type2{Value: 1})
-	assert.NoError(t, err)
-
-	msg1 := &proto.TestAnyMessage{Msg: any1}
-	msg2 := &proto.TestAnyMessage{Msg: any2}
-	// Can merge the any property from different type
-	protobuf.Merge(msg1, msg2)
-	assert.EqualValues(t, any2, msg1.Msg)
-	// Can be converted to a message of a unknown type
-	um, err := msg1.Msg.UnmarshalNew()
-	assert.NoError(t, err)
-	assert.EqualValues(t, 1, um.(*proto.TestAnyMessage_Type2).Value)
-
-	msg1.List = append(msg1.List, any1)
-	msg2.List = append(msg2.List, any2)
-	// Can merge the any list of different types
-	protobuf.Merge(msg1, msg2)
-	assert.Equal(t, 2, len(msg1.List))
-}
-
-func TestProtobufMapMerge(t *testing.T) {
-	testMsg := &proto.TestMapMessage{
-		Kv:  make(map[uint32]string),
-		Kv2: make(map[uint32]*proto.TestMapMessage_StringWrapper),
-	}
-	testMsg.Kv[1] = "a"
-	testMsg.Kv[2] = "b"
-	testMsg.Kv[3] = "c"
-	testMsg.Kv[4] = "d"
-
-	testMsg.Kv2[1] = &proto.TestMapMessage_StringWrapper{Content: "a"}
-	testMsg.Kv2[2] = &proto.TestMapMessage_StringWrapper{Content: "b", Num: 2}
-
-	updateMsg := &proto.TestMapMessage{
-		Kv:  make(map[uint32]string),
-		Kv2: make(map[uint32]*proto.TestMapMessage_StringWrapper),
-	}
-	updateMsg.Kv[2] = "bb"
-	updateMsg.Kv[3] = ""
-	updateMsg.Kv[4] = "dd"
-
-	updateMsg.Kv2[1] = nil
-
-	protobuf.Merge(testMsg, updateMsg)
-
-	assert.Equal(t, "a", testMsg.Kv[1])
-	assert.Equal(t, "bb", testMsg.Kv[2])
-	assert.Equal(t, "", testMsg.Kv[3])
-	assert.Equal(t, "dd", testMsg.Kv[4])
-
-	/* By default, protobuf ignores the nil value
-	assert.Equal(t, nil, testMsg.Kv2[1])
-	*/
-	assert.NotEqual(t, nil, testMsg.Kv2[1])
-	assert.Equal(t, "b", testMsg.Kv2[2].Content)
-	// The other properties should remain the same
-	assert.Equal(t, int64(2), testMsg.Kv2[2].Num)
-}
+package channeld
+
+import (
+	"container/list"
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/indiest/fmutils"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+type testQueuedMessageSender struct {
+	MessageSender
+	// The messages are sent in the channels' goroutines and read in the test's goroutine.
+	lock         sync.Mutex
+	msgQueue     []Message
+	msgProcessor func(Message) (Message, error)
+}
+
+func (s *testQueuedMessageSender) Send(c *Connection, ctx MessageContext) {
+	if s.msgProcessor != nil {
+		var err error
+		ctx.Msg, err = s.msgProcessor(ctx.Msg)
+		if err != nil {
+			panic(err)
+		}
+	}
+	s.lock.Lock()
+	s.msgQueue = append(s.msgQueue, ctx.Msg)
+	s.lock.Unlock()
+}
+
+func addTestConnection(t proto.ConnectionType) *Connection {
+	return addTestConnectionWithProcessor(t, nil)
+}
+
+func addTestConnectionWithProcessor(t proto.ConnectionType, p func(Message) (Message, error)) *Connection {
+	conn1, _ := net.Pipe()
+	c := AddConnection(conn1, t)
+	c.sender = &testQueuedMessageSender{msgQueue: make([]Message, 0), msgProcessor: p}
+	return c
+}
+
+// Returns a copy of the messages sent to the connection.
+func (c *Connection) testQueue() []Message {
+	s := c.sender.(*testQueuedMessageSender)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]Message{}, s.msgQueue...)
+}
+
+// Sets the owner in the channel's goroutine, as the channel may be ticking.
+func setTestChannelOwner(ch *Channel, owner *Connection) {
+	if !ch.executeAndWait(func(ch *Channel) { ch.assignOwner(owner) }, time.Second) {
+		panic("timed out setting the channel owner")
+	}
+}
+
+// Blocks the channel's goroutine until the channel is removed, so the test can tick the channel manually in its own goroutine.
+func freezeTestChannel(ch *Channel) {
+	frozen := make(chan struct{})
+	ch.execute(func(ch *Channel) {
+		close(frozen)
+		<-ch.removed
+	})
+	<-frozen
+}
+
+func (c *Connection) clearTestQueue() {
+	s := c.sender.(*testQueuedMessageSender)
+	s.lock.Lock()
+	s.msgQueue = nil
+	s.lock.Unlock()
+}
+
+func (c *Connection) latestMsg() Message {
+	queue := c.testQueue()
+	if len(queue) > 0 {
+		return queue[len(queue)-1]
+	} else {
+		return nil
+	}
+}
+
+func testChannelDataMessageProcessor(msg Message) (Message, error) {
+	// Extract the payload from the ChannelDataUpdatMessage
+	payload := msg.(*proto.ChannelDataUpdateMessage).Data
+	updateMsg, err := payload.UnmarshalNew()
+	return updateMsg, err
+}
+
+// See the test case in [the design doc](doc/design.md#fan-out)
+// TODO: add test cases with FieldMasks (no fan-out if no property is updated)
+func TestFanOutChannelData(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c0 := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
+	c1 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+	c2 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
+	// We need to manually tick the channel.
+	freezeTestChannel(testChannel)
+	dataMsg := &proto.TestChannelDataMessage{
+		Text: "a",
+		Num:  1,
+	}
+	testChannel.InitData(dataMsg, nil)
+
+	c0.SubscribeToChannel(testChannel, nil)
+	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{
+		FanOutIntervalMs: 50,
+	})
+
+	channelStartTime := ChannelTime(100 * int64(time.Millisecond))
+	// F0 = the whole data
+	testChannel.tickData(channelStartTime)
+	assert.Equal(t, 1, len(c1.testQueue()))
+	assert.Equal(t, 0, len(c2.testQueue()))
+	assert.EqualValues(t, dataMsg.Num, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
+
+	c2.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{
+		FanOutIntervalMs: 100,
+	})
+	// F1 = no data, F7 = the whole data
+	testChannel.tickData(channelStartTime.AddMs(50))
+	assert.Equal(t, 1, len(c1.testQueue()))
+	assert.Equal(t, 1, len(c2.testQueue()))
+	assert.EqualValues(t, dataMsg.Num, c2.latestMsg().(*proto.TestChannelDataMessage).Num)
+
+	// U1 arrives
+	u1 := &proto.TestChannelDataMessage{Text: "b"}
+	testChannel.Data().OnUpdate(u1, channelStartTime.AddMs(60))
+
+	// F2 = U1
+	testChannel.tickData(channelStartTime.AddMs(100))
+	assert.Equal(t, 2, len(c1.testQueue()))
+	assert.Equal(t, 1, len(c2.testQueue()))
+	// U1 doesn't have "ClientConnNum" property
+	assert.NotEqualValues(t, dataMsg.Num, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
+	assert.EqualValues(t, "b", c1.latestMsg().(*proto.TestChannelDataMessage).Text)
+	assert.EqualValues(t, "a", c2.latestMsg().(*proto.TestChannelDataMessage).Text)
+
+	// U2 arrives
+	u2 := &proto.TestChannelDataMessage{Text: "c"}
+	testChannel.Data().OnUpdate(u2, channelStartTime.AddMs(120))
+
+	// F8=U1+U2; F3 = U2
+	testChannel.tickData(channelStartTime.AddMs(150))
+	assert.Equal(t, 3, len(c1.testQueue()))
+	assert.Equal(t, 2, len(c2.testQueue()))
+	assert.EqualValues(t, "c", c1.latestMsg().(*proto.TestChannelDataMessage).Text)
+	assert.EqualValues(t, "c", c2.latestMsg().(*proto.TestChannelDataMessage).Text)
+}
+
+func BenchmarkCustomMergeMap(b *testing.B) {
+	dst := &proto.TestMergeMessage{
+		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{},
+	}
+	src := &proto.TestMergeMessage{
+		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{},
+	}
+	for i := 0; i < 100; i++ {
+		dst.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: false, Content: strconv.Itoa(rand.Int())}
+		if rand.Intn(100) < 10 {
+			src.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: true}
+		} else {
+			src.Kv[int64(i)] = &proto.TestMergeMessage_StringWrapper{Removed: false, Content: strconv.Itoa(rand.Int())}
+		}
+	}
+
+	mergeOptions := &proto.ChannelDataMergeOptions{ShouldCheckRemovableMapField: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mergeWithOptions(dst, src, mergeOptions, zap.NewNop())
+	}
+
+	// Protoreflect merge:
+	// BenchmarkCustomMergeMap-12    	   26959	     43900 ns/op	    8464 B/op	     316 allocs/op
+	// BenchmarkCustomMergeMap-12    	   27038	     46457 ns/op	    8464 B/op	     316 allocs/op
+	// BenchmarkCustomMergeMap-12    	   24746	     49732 ns/op	    8464 B/op	     316 allocs/op
+
+	// Custom merge: (15x faster!!!)
+	// BenchmarkCustomMergeMap-12    	  353163	      3172 ns/op	       0 B/op	       0 allocs/op
+	// BenchmarkCustomMergeMap-12    	  457196	      2871 ns/op	       0 B/op	       0 allocs/op
+	// BenchmarkCustomMergeMap-12    	  419090	      3004 ns/op	       0 B/op	       0 allocs/op
+}
+
+func benchmarkCodegenMerge(b *testing.B, merge func(dst, src *proto.TestCodegenMessage, options *proto.ChannelDataMergeOptions)) {
+	dst := &proto.TestCodegenMessage{Entries: map[uint32]*proto.TestCodegenMessage_Entry{}}
+	src := &proto.TestCodegenMessage{Entries: map[uint32]*proto.TestCodegenMessage_Entry{}}
+	for i := 0; i < 100; i++ {
+		dst.Entries[uint32(i)] = &proto.TestCodegenMessage_Entry{Content: strconv.Itoa(rand.Int())}
+		if rand.Intn(100) < 10 {
+			src.Entries[uint32(i)] = &proto.TestCodegenMessage_Entry{Removed: true}
+		} else {
+			src.Entries[uint32(i)] = &proto.TestCodegenMessage_Entry{Content: strconv.Itoa(rand.Int()), Nested: &proto.TestCodegenMessage_Nested{Num: int64(i)}}
+		}
+		src.StrList = append(src.StrList, strconv.Itoa(i))
+	}
+
+	mergeOptions := &proto.ChannelDataMergeOptions{ShouldCheckRemovableMapField: true, ListSizeLimit: 50, TruncateTop: true}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		merge(dst, src, mergeOptions)
+	}
+}
+
+func BenchmarkReflectMergeCodegenMessage(b *testing.B) {
+	benchmarkCodegenMerge(b, func(dst, src *proto.TestCodegenMessage, options *proto.ChannelDataMergeOptions) {
+		reflectMerge(dst, src, options)
+	})
+	// BenchmarkReflectMergeCodegenMessage   	   10000	    104462 ns/op	   19704 B/op	     555 allocs/op
+	// BenchmarkReflectMergeCodegenMessage   	   10000	    101579 ns/op	   20440 B/op	     555 allocs/op
+}
+
+func BenchmarkGeneratedMergeCodegenMessage(b *testing.B) {
+	benchmarkCodegenMerge(b, func(dst, src *proto.TestCodegenMessage, options *proto.ChannelDataMergeOptions) {
+		dst.Merge(src, options)
+	})
+	// Most of the time is spent on copying the map values. (3x faster)
+	// BenchmarkGeneratedMergeCodegenMessage 	   40189	     31330 ns/op	   18703 B/op	     183 allocs/op
+	// BenchmarkGeneratedMergeCodegenMessage 	   36147	     31781 ns/op	   18527 B/op	     181 allocs/op
+}
+
+func TestUpdateMsgRing(t *testing.T) {
+	ring := newUpdateMsgRing(4)
+	assert.Equal(t, 0, ring.Len())
+	assert.EqualValues(t, 1, ring.oldestSeq())
+
+	for i := 1; i <= 3; i++ {
+		ring.push(&proto.TestChannelDataMessage{Num: uint32(i)}, ChannelTime(i))
+	}
+	assert.Equal(t, 3, ring.Len())
+	assert.EqualValues(t, 1, ring.oldestSeq())
+	assert.EqualValues(t, 1, ring.get(1).updateMsg.(*proto.TestChannelDataMessage).Num)
+
+	// Overwrite the oldest
+	for i := 4; i <= 6; i++ {
+		ring.push(&proto.TestChannelDataMessage{Num: uint32(i)}, ChannelTime(i))
+	}
+	assert.Equal(t, 4, ring.Len())
+	assert.EqualValues(t, 3, ring.oldestSeq())
+	assert.EqualValues(t, 7, ring.nextSeq)
+	for seq := ring.oldestSeq(); seq < ring.nextSeq; seq++ {
+		assert.EqualValues(t, seq, ring.get(seq).updateMsg.(*proto.TestChannelDataMessage).Num)
+		assert.EqualValues(t, seq, ring.get(seq).arrivalTime)
+	}
+}
+
+func TestFanOutLaggingConnection(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c0 := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
+	c1 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+	c2 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestChannelDataMessage{Text: "a", Num: 0}, nil)
+	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 10})
+	// c2 fans out much less frequently than the buffer is refilled.
+	c2.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 10000})
+
+	channelStartTime := ChannelTime(10 * int64(time.Second))
+	testChannel.tickData(channelStartTime)
+	assert.Equal(t, 1, len(c1.testQueue()))
+	assert.Equal(t, 1, len(c2.testQueue()))
+
+	// Overflow the buffer between c2's fan-outs. c1 keeps up.
+	for i := 1; i <= MaxUpdateMsgBufferSize+8; i++ {
+		testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: uint32(i)}, channelStartTime.AddMs(uint32(i)))
+		if i%10 == 0 {
+			testChannel.tickData(channelStartTime.AddMs(uint32(i)))
+		}
+	}
+	assert.Equal(t, 1+(MaxUpdateMsgBufferSize+8)/10, len(c1.testQueue()))
+	assert.EqualValues(t, MaxUpdateMsgBufferSize+8, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
+	// The accumulated update doesn't contain the text
+	assert.Empty(t, c1.latestMsg().(*proto.TestChannelDataMessage).Text)
+	assert.Equal(t, 1, len(c2.testQueue()))
+
+	// c2 has missed the updates that were overwritten, so it receives the whole data.
+	testChannel.tickData(channelStartTime.AddMs(10000))
+	assert.Equal(t, 2, len(c2.testQueue()))
+	assert.EqualValues(t, MaxUpdateMsgBufferSize+8, c2.latestMsg().(*proto.TestChannelDataMessage).Num)
+	assert.EqualValues(t, "a", c2.latestMsg().(*proto.TestChannelDataMessage).Text)
+}
+
+// Re-initializing the data restarts the sequence of the update buffer, so the subscribers must receive the whole new data
+// instead of the updates between their old positions and the new sequence.
+func TestFanOutReinitializedData(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c0 := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
+	c1 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+	c2 := addTestConnection(proto.ConnectionType_CLIENT)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestChannelDataMessage{Text: "a", Num: 0}, nil)
+	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 10})
+	c2.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 10, DeltaFanOut: true})
+
+	channelStartTime := ChannelTime(10 * int64(time.Second))
+	testChannel.tickData(channelStartTime)
+	for i := 1; i <= 3; i++ {
+		testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: uint32(i)}, channelStartTime.AddMs(uint32(i)))
+	}
+	testChannel.tickData(channelStartTime.AddMs(10))
+	assert.Equal(t, 2, len(c1.testQueue()))
+	assert.Equal(t, 2, len(c2.testQueue()))
+	assert.NotNil(t, c2.latestMsg().(*proto.ChannelDataUpdateMessage).Delta)
+	testChannel.lastSnapshotSeq = testChannel.data.updateMsgBuffer.nextSeq
+
+	testChannel.InitData(&proto.TestChannelDataMessage{Text: "b", Num: 100}, nil)
+	assert.EqualValues(t, 0, testChannel.lastSnapshotSeq)
+	testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: 101}, channelStartTime.AddMs(11))
+	testChannel.tickData(channelStartTime.AddMs(20))
+	assert.Equal(t, 3, len(c1.testQueue()))
+	assert.EqualValues(t, 101, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
+	assert.EqualValues(t, "b", c1.latestMsg().(*proto.TestChannelDataMessage).Text)
+	// The delta subscriber receives the whole data instead of the diff against the old data.
+	assert.Equal(t, 3, len(c2.testQueue()))
+	update := c2.latestMsg().(*proto.ChannelDataUpdateMessage)
+	assert.Nil(t, update.Delta)
+	data, err := update.Data.UnmarshalNew()
+	assert.NoError(t, err)
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "b", Num: 101}, data))
+}
+
+// The updates that arrive after the subscriber is due, but before the channel ticks, are fanned out in that tick.
+// They used to be bounded by the due time (nextFanOutTime), and were lost as the next fan-out only visited the updates after the tick.
+func TestFanOutLateTick(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c0 := addTestConnectionWithProcessor(proto.ConnectionType_SERVER, testChannelDataMessageProcessor)
+	c1 := addTestConnectionWithProcessor(proto.ConnectionType_CLIENT, testChannelDataMessageProcessor)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, c0)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestChannelDataMessage{Text: "a", Num: 0}, nil)
+	c1.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 50})
+
+	channelStartTime := ChannelTime(100 * int64(time.Millisecond))
+	testChannel.tickData(channelStartTime)
+	assert.Equal(t, 1, len(c1.testQueue()))
+
+	// c1 is due at 150ms, but the channel ticks late at 170ms.
+	testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: 1}, channelStartTime.AddMs(60))
+	testChannel.tickData(channelStartTime.AddMs(70))
+	assert.Equal(t, 2, len(c1.testQueue()))
+	assert.EqualValues(t, 1, c1.latestMsg().(*proto.TestChannelDataMessage).Num)
+
+	// Nothing is fanned out twice.
+	testChannel.tickData(channelStartTime.AddMs(200))
+	assert.Equal(t, 2, len(c1.testQueue()))
+}
+
+type discardMessageSender struct {
+	MessageSender
+}
+
+func (s *discardMessageSender) Send(c *Connection, ctx MessageContext) {}
+
+func benchmarkFanOut(b *testing.B, fanOutIntervalMs func(i int) uint32) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	owner := addTestConnection(proto.ConnectionType_SERVER)
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, owner)
+	freezeTestChannel(testChannel)
+	testChannel.InitData(&proto.TestChannelDataMessage{}, nil)
+	for i := 0; i < 1000; i++ {
+		c := addTestConnection(proto.ConnectionType_CLIENT)
+		c.sender = &discardMessageSender{}
+		c.SubscribeToChannel(testChannel, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: fanOutIntervalMs(i)})
+	}
+	// Fill the buffer
+	t := ChannelTime(0)
+	for i := 0; i < MaxUpdateMsgBufferSize; i++ {
+		t = t.AddMs(1)
+		testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: uint32(i)}, t)
+	}
+	testChannel.tickData(t)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		t = t.AddMs(10)
+		testChannel.Data().OnUpdate(&proto.TestChannelDataMessage{Num: uint32(i)}, t)
+		testChannel.tickData(t)
+	}
+	b.StopTimer()
+	defaultServer.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		RemoveConnection(v.(*Connection))
+		return true
+	})
+}
+
+// All the 1k subscribers are fanned out in every tick.
+func BenchmarkFanOut1kSubscribers(b *testing.B) {
+	benchmarkFanOut(b, func(i int) uint32 { return 10 })
+
+	// Linked list, scanning the whole buffer for each subscriber:
+	// BenchmarkFanOut1kSubscribers    	     308	   4521549 ns/op	  338845 B/op	    7003 allocs/op
+	// Ring buffer with per-subscriber cursors:
+	// BenchmarkFanOut1kSubscribers    	     950	   1153304 ns/op	  339101 B/op	    7000 allocs/op
+}
+
+// The subscribers have different fan-out intervals, from 10ms to 10s. Only a few of them are due in each tick,
+// and the slow ones fall behind the buffer and are resynced.
+func BenchmarkFanOut1kSubscribersMixedIntervals(b *testing.B) {
+	benchmarkFanOut(b, func(i int) uint32 { return uint32(10 + i*10) })
+
+	// Linked list:
+	// BenchmarkFanOut1kSubscribersMixedIntervals 	    7306	    276647 ns/op	    6498 B/op	     134 allocs/op
+	// Ring buffer:
+	// BenchmarkFanOut1kSubscribersMixedIntervals 	    9591	    180010 ns/op	    6431 B/op	     132 allocs/op
+}
+
+func TestListRemoveElement(t *testing.T) {
+	list := list.New()
+	list.PushBack("a")
+	list.PushBack("b")
+	list.PushBack("b")
+	list.PushBack("c")
+	list.PushBack("b")
+	list.PushBack("d")
+	p := list.Front()
+	var n int = list.Len()
+	for i := 0; i < n; i++ {
+		fmt.Println(p.Value)
+		if p.Value == "b" {
+			tmp := p.Next()
+			list.Remove(p)
+			p = tmp
+			continue
+		}
+		p = p.Next()
+	}
+	assert.Equal(t, 3, list.Len())
+}
+
+func TestListMoveElement(t *testing.T) {
+	list := list.New()
+	list.PushBack("a")
+	list.PushBack("b")
+	list.PushBack("c")
+	assert.Equal(t, "a", list.Front().Value)
+
+	e := list.Front().Next()
+	assert.Equal(t, "b", e.Value)
+	temp := e.Prev()
+	list.MoveToBack(e)
+	e = temp.Next()
+	assert.Equal(t, "c", e.Value)
+}
+
+func TestDataMergeOptions(t *testing.T) {
+	InitLogsAndMetrics()
+	dstMsg := &proto.TestMergeMessage{
+		List: []string{"a", "b", "c"},
+		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{
+			1: {Content: "aa"},
+			2: {Content: "bb"},
+		},
+	}
+
+	srcMsg := &proto.TestMergeMessage{
+		List: []string{"d", "e"},
+		Kv: map[int64]*proto.TestMergeMessage_StringWrapper{
+			1: {Removed: true},
+			2: {Content: "bbb"},
+		},
+	}
+
+	mergedMsg1 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
+	mergeOptions1 := &proto.ChannelDataMergeOptions{
+		ShouldReplaceList: true,
+	}
+	mergeWithOptions(mergedMsg1, srcMsg, mergeOptions1, zap.NewNop())
+	assert.Equal(t, 2, len(mergedMsg1.List))
+	assert.Equal(t, "e", mergedMsg1.List[1])
+
+	mergedMsg2 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
+	mergeOptions2 := &proto.ChannelDataMergeOptions{
+		ListSizeLimit: 4,
+	}
+	mergeWithOptions(mergedMsg2, srcMsg, mergeOptions2, zap.NewNop()) // [a,b,c,d]
+	assert.Equal(t, 4, len(mergedMsg2.List))
+	assert.Equal(t, "d", mergedMsg2.List[3])
+	mergeOptions2.TruncateTop = true
+	mergeWithOptions(mergedMsg2, srcMsg, mergeOptions2, zap.NewNop()) // [c,d,d,e]
+	assert.Equal(t, "c", mergedMsg2.List[0])
+	assert.Equal(t, "e", mergedMsg2.List[3])
+
+	mergedMsg3 := protobuf.Clone(dstMsg).(*proto.TestMergeMessage)
+	mergeOptions3 := &proto.ChannelDataMergeOptions{
+		ShouldCheckRemovableMapField: true,
+	}
+	srcBytes, _ := protobuf.Marshal(srcMsg)
+	protobuf.Unmarshal(srcBytes, srcMsg)
+	mergeWithOptions(mergedMsg3, srcMsg, mergeOptions3, zap.NewNop())
+	assert.Equal(t, 1, len(mergedMsg3.Kv))
+	_, exists := mergedMsg3.Kv[1]
+	assert.False(t, exists)
+	assert.Equal(t, "bbb", mergedMsg3.Kv[2].Content)
+}
+
+func TestReflectChannelData(t *testing.T) {
+	globalData, err := ReflectChannelData(proto.ChannelType_TEST, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, globalData)
+	assert.IsType(t, &proto.TestChannelDataMessage{}, globalData.msg)
+}
+
+func TestDataFieldMasks(t *testing.T) {
+	nestedMsg := &proto.TestFieldMaskMessage_NestedMessage{
+		P1: 1,
+		P2: 2,
+	}
+	testMsg := &proto.TestFieldMaskMessage{
+		Name: "test",
+		Msg:  nestedMsg,
+		List: []*proto.TestFieldMaskMessage_NestedMessage{nestedMsg},
+		Kv1: map[int64]*proto.TestFieldMaskMessage_NestedMessage{
+			10: nestedMsg,
+		},
+		Kv2: map[int64]string{
+			100: "hello",
+		},
+	}
+
+	filteredMsg1 := protobuf.Clone(testMsg)
+	fmutils.Filter(filteredMsg1, []string{"name"})
+	t.Log(filteredMsg1.(*proto.TestFieldMaskMessage).String())
+
+	filteredMsg2 := protobuf.Clone(testMsg)
+	fmutils.Filter(filteredMsg2, []string{"msg.p1"})
+	t.Log(filteredMsg2.(*proto.TestFieldMaskMessage).String())
+
+	filteredMsg3 := protobuf.Clone(testMsg)
+	fmutils.Filter(filteredMsg3, []string{"list.p2"})
+	t.Log(filteredMsg3.(*proto.TestFieldMaskMessage).String())
+
+	filteredMsg4 := protobuf.Clone(testMsg)
+	fmutils.Filter(filteredMsg4, []string{"kv1.p1", "kv1.p2", "kv1.p3"})
+	t.Log(filteredMsg4.(*proto.TestFieldMaskMessage).String())
+	fmutils.Prune(filteredMsg4, []string{"kv1.p1"})
+	t.Log(filteredMsg4.(*proto.TestFieldMaskMessage).String())
+
+	filteredMsg5 := protobuf.Clone(testMsg)
+	fmutils.Filter(filteredMsg5, []string{"kv2.a"})
+	t.Log(filteredMsg5.(*proto.TestFieldMaskMessage).String())
+}
+
+// ShouldReplaceList only replaces the lists that the update has. The update is kept in the update message buffer,
+// so it should not be modified by the merge. The reflection used to panic when the update didn't have the list,
+// which skipped the remaining fields silently, and the truncation used to modify the update's list.
+func TestReflectMergeReplaceList(t *testing.T) {
+	newDst := func() *proto.TestCodegenMessage {
+		return &proto.TestCodegenMessage{
+			StrList: []string{"a", "b", "c"},
+			MsgList: []*proto.TestCodegenMessage_Nested{{Text: "m1"}, {Text: "m2"}},
+			Kv:      map[int64]string{1: "a"},
+		}
+	}
+	options := &proto.ChannelDataMergeOptions{ShouldReplaceList: true, ListSizeLimit: 1, TruncateTop: true}
+
+	// The lists are kept, but still truncated.
+	dst := newDst()
+	reflectMerge(dst, &proto.TestCodegenMessage{Text: "x"}, options)
+	assert.Equal(t, "x", dst.Text)
+	assert.Equal(t, []string{"c"}, dst.StrList)
+	assert.Len(t, dst.MsgList, 1)
+	assert.Equal(t, "m2", dst.MsgList[0].Text)
+
+	// Only the list in the update is replaced.
+	dst = newDst()
+	src := &proto.TestCodegenMessage{StrList: []string{"d", "e"}, Kv: map[int64]string{2: "b"}}
+	reflectMerge(dst, src, options)
+	assert.Equal(t, []string{"e"}, dst.StrList)
+	assert.Equal(t, "m2", dst.MsgList[0].Text)
+	assert.Len(t, dst.Kv, 2)
+	// The update is not modified.
+	assert.Equal(t, []string{"d", "e"}, src.StrList)
+
+	// The map of the non-message values doesn't stop the removable map fields from being checked.
+	dst = newDst()
+	reflectMerge(dst, &proto.TestCodegenMessage{
+		Kv:      map[int64]string{2: "b"},
+		Entries: map[uint32]*proto.TestCodegenMessage_Entry{1: {Removed: true}},
+	}, &proto.ChannelDataMergeOptions{ShouldCheckRemovableMapField: true})
+	assert.Empty(t, dst.Entries)
+}
+
+// The Merge method of TestCodegenMessage is generated by protoc-gen-channeld-merge. It should have the same result as reflectMerge.
+func TestGeneratedMergeMatchesReflectMerge(t *testing.T) {
+	anyData, _ := anypb.New(&proto.TestChannelDataMessage{Text: "any"})
+	newDst := func() *proto.TestCodegenMessage {
+		return &proto.TestCodegenMessage{
+			Text:      "a",
+			I32:       -1,
+			U64:       1,
+			Ratio:     0.5,
+			Raw:       []byte{1, 2},
+			Color:     proto.TestCodegenMessage_RED,
+			Nested:    &proto.TestCodegenMessage_Nested{Text: "n", List: []uint32{1}, Child: &proto.TestCodegenMessage_Nested{Num: 1}},
+			StrList:   []string{"a", "b", "c"},
+			MsgList:   []*proto.TestCodegenMessage_Nested{{Text: "m1"}, {Text: "m2", List: []uint32{2}}},
+			BytesList: [][]byte{{1}},
+			Entries: map[uint32]*proto.TestCodegenMessage_Entry{
+				1: {Content: "e1"},
+				2: {Content: "e2", Nested: &proto.TestCodegenMessage_Nested{Num: 2}},
+			},
+			NestedMap: map[string]*proto.TestCodegenMessage_Nested{"x": {Text: "x"}},
+			Choice:    &proto.TestCodegenMessage_ChoiceNested{ChoiceNested: &proto.TestCodegenMessage_Nested{Text: "c", Num: 1}},
+			Kv:        map[int64]string{1: "a"},
+		}
+	}
+
+	srcs := []*proto.TestCodegenMessage{
+		{},
+		{Text: "b", I32: 2, Flag: true, Color: proto.TestCodegenMessage_GREEN, Raw: []byte{3}},
+		{Nested: &proto.TestCodegenMessage_Nested{Num: 3, List: []uint32{3, 4}, Child: &proto.TestCodegenMessage_Nested{Text: "child"}}},
+		{Any: anyData},
+		{StrList: []string{"d", "e"}, MsgList: []*proto.TestCodegenMessage_Nested{{Text: "m3"}, nil}, BytesList: [][]byte{{2}, {}}},
+		{Entries: map[uint32]*proto.TestCodegenMessage_Entry{
+			1: {Removed: true},
+			2: {Content: "e22"},
+			3: {Content: "e3"},
+			4: {Removed: true},
+			5: nil,
+		}},
+		{NestedMap: map[string]*proto.TestCodegenMessage_Nested{"x": {Num: 1}, "y": {Text: "y"}}},
+		{Choice: &proto.TestCodegenMessage_ChoiceNested{ChoiceNested: &proto.TestCodegenMessage_Nested{Num: 2}}},
+		{Choice: &proto.TestCodegenMessage_ChoiceText{ChoiceText: "choice"}},
+		{Choice: &proto.TestCodegenMessage_ChoiceText{}},
+		{Kv: map[int64]string{1: "", 2: "b"}, RawMap: map[string][]byte{"r": {1}}},
+	}
+
+	optionsList := []*proto.ChannelDataMergeOptions{
+		{},
+		{ShouldReplaceList: true},
+		{ListSizeLimit: 2},
+		{ListSizeLimit: 2, TruncateTop: true},
+		{ShouldReplaceList: true, ListSizeLimit: 1, TruncateTop: true},
+		{ShouldCheckRemovableMapField: true},
+	}
+
+	for _, options := range optionsList {
+		for i, src := range srcs {
+			// reflectMerge may share the lists of src with dst, so each merge has its own copy.
+			expected := newDst()
+			reflectMerge(expected, protobuf.Clone(src), options)
+			actual := newDst()
+			srcCopy := protobuf.Clone(src).(*proto.TestCodegenMessage)
+			assert.NoError(t, actual.Merge(srcCopy, options))
+			assert.True(t, protobuf.Equal(expected, actual), "src %d, options %v\nexpected: %v\nactual: %v", i, options, expected, actual)
+
+			// The merged data doesn't share anything with src.
+			if srcCopy.Nested != nil {
+				srcCopy.Nested.Text = "changed"
+			}
+			for _, v := range srcCopy.MsgList {
+				if v != nil {
+					v.Text = "changed"
+				}
+			}
+			for _, v := range srcCopy.Entries {
+				if v != nil {
+					v.Content = "changed"
+				}
+			}
+			assert.True(t, protobuf.Equal(expected, actual), "src %d, options %v", i, options)
+		}
+
+		// Merge all in order
+		expected := newDst()
+		actual := newDst()
+		for _, src := range srcs {
+			reflectMerge(expected, protobuf.Clone(src), options)
+			assert.NoError(t, actual.Merge(protobuf.Clone(src), options))
+		}
+		assert.True(t, protobuf.Equal(expected, actual), "options %v\nexpected: %v\nactual: %v", options, expected, actual)
+	}
+
+	assert.Error(t, newDst().Merge(&proto.TestChannelDataMessage{}, optionsList[0]))
+}
+
+func TestProtobufAny(t *testing.T) {
+	any1, err := anypb.New(&proto.TestAnyMessage_Type1{Value: "a"})
+	assert.NoError(t, err)
+
+	any2, err := anypb.New(&proto.TestAnyMessage_Type2{Value: 1})
+	assert.NoError(t, err)
+
+	msg1 := &proto.TestAnyMessage{Msg: any1}
+	msg2 := &proto.TestAnyMessage{Msg: any2}
+	// Can merge the any property from different type
+	protobuf.Merge(msg1, msg2)
+	assert.EqualValues(t, any2, msg1.Msg)
+	// Can be converted to a message of a unknown type
+	um, err := msg1.Msg.UnmarshalNew()
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, um.(*proto.TestAnyMessage_Type2).Value)
+
+	msg1.List = append(msg1.List, any1)
+	msg2.List = append(msg2.List, any2)
+	// Can merge the any list of different types
+	protobuf.Merge(msg1, msg2)
+	assert.Equal(t, 2, len(msg1.List))
+}
+
+func TestProtobufMapMerge(t *testing.T) {
+	testMsg := &proto.TestMapMessage{
+		Kv:  make(map[uint32]string),
+		Kv2: make(map[uint32]*proto.TestMapMessage_StringWrapper),
+	}
+	testMsg.Kv[1] = "a"
+	testMsg.Kv[2] = "b"
+	testMsg.Kv[3] = "c"
+	testMsg.Kv[4] = "d"
+
+	testMsg.Kv2[1] = &proto.TestMapMessage_StringWrapper{Content: "a"}
+	testMsg.Kv2[2] = &proto.TestMapMessage_StringWrapper{Content: "b", Num: 2}
+
+	updateMsg := &proto.TestMapMessage{
+		Kv:  make(map[uint32]string),
+		Kv2: make(map[uint32]*proto.TestMapMessage_StringWrapper),
+	}
+	updateMsg.Kv[2] = "bb"
+	updateMsg.Kv[3] = ""
+	updateMsg.Kv[4] = "dd"
+
+	updateMsg.Kv2[1] = nil
+
+	protobuf.Merge(testMsg, updateMsg)
+
+	assert.Equal(t, "a", testMsg.Kv[1])
+	assert.Equal(t, "bb", testMsg.Kv[2])
+	assert.Equal(t, "", testMsg.Kv[3])
+	assert.Equal(t, "dd", testMsg.Kv[4])
+
+	/* By default, protobuf ignores the nil value
+	assert.Equal(t, nil, testMsg.Kv2[1])
+	*/
+	assert.NotEqual(t, nil, testMsg.Kv2[1])
+	assert.Equal(t, "b", testMsg.Kv2[2].Content)
+	// The other properties should remain the same
+	assert.Equal(t, int64(2), testMsg.Kv2[2].Num)
+}
@@ -0,0 +1,70 @@
+package channeld
+
+import (
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+// Replies the ErrorResultMessage of the rejected request to the connection.
+// The ctx should be the context of the rejected request, so the reply has the same channelId and stubId.
+// Nothing is replied before the connection is authenticated, so an unauthenticated peer can't probe channeld
+// or get a reply for every junk packet it sends. After that, the replies are limited by MaxErrorRepliesPerSec.
+func (c *Connection) sendError(ctx MessageContext, code proto.ErrorResultMessage_ErrorCode, message string) {
+	// Never reply an error to an error, or the two ends may bounce the errors back and forth.
+	if ctx.MsgType == proto.MessageType_ERROR {
+		return
+	}
+	if c.Claims() == nil {
+		c.Logger().Debug("not replying the error as the connection is not authenticated", zap.String("code", code.String()))
+		return
+	}
+	if !c.allowErrorReply() {
+		c.Logger().Debug("not replying the error as the rate limit is reached", zap.String("code", code.String()))
+		return
+	}
+	ctx.Msg = &proto.ErrorResultMessage{
+		Code:    code,
+		MsgType: uint32(ctx.MsgType),
+		StubId:  ctx.StubId,
+		Message: message,
+	}
+	ctx.MsgType = proto.MessageType_ERROR
+	ctx.Broadcast = proto.BroadcastType_NO_BROADCAST
+	c.Send(ctx)
+}
+
+// channeld doesn't expect any ErrorResultMessage from the connections, so it's only logged.
+func handleErrorResult(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.ErrorResultMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not an ErrorResultMessage, will not be handled.")
+		return
+	}
+	ctx.Connection.Logger().Warn("received error result",
+		zap.String("code", msg.Code.String()),
+		zap.Uint32("msgType", msg.MsgType),
+		zap.String("message", msg.Message),
+	)
+}
+
+// Counts the error replies in a one-second window. Called from any goroutine.
+func (c *Connection) allowErrorReply() bool {
+	limit := c.server.Settings.MaxErrorRepliesPerSec
+	if limit == 0 {
+		return true
+	}
+	now := time.Now().Unix()
+	c.errorReplyLock.Lock()
+	defer c.errorReplyLock.Unlock()
+	if c.errorReplySec != now {
+		c.errorReplySec = now
+		c.errorReplies = 0
+	}
+	if c.errorReplies >= limit {
+		return false
+	}
+	c.errorReplies++
+	return true
+}
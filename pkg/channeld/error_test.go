@@ -0,0 +1,101 @@
+package channeld
+
+import (
+	"testing"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceiveMessageError(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	testFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}]}`))
+	assert.NoError(t, err)
+	c.fsm = &testFsm
+
+	assertError := func(code proto.ErrorResultMessage_ErrorCode, msgType proto.MessageType, stubId uint32) {
+		errMsg, ok := c.latestMsg().(*proto.ErrorResultMessage)
+		if assert.True(t, ok) {
+			assert.Equal(t, code, errMsg.Code)
+			assert.EqualValues(t, msgType, errMsg.MsgType)
+			assert.EqualValues(t, stubId, errMsg.StubId)
+		}
+	}
+
+	// Nothing is replied before the connection is authenticated.
+	c.receiveMessage(&proto.MessagePack{ChannelId: 999, MsgType: uint32(proto.MessageType_AUTH), StubId: 1})
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: 99, StubId: 2})
+	assert.Empty(t, c.testQueue())
+
+	c.setClaims(&AuthClaims{UserId: "player1"})
+	c.receiveMessage(&proto.MessagePack{ChannelId: 999, MsgType: uint32(proto.MessageType_AUTH), StubId: 1})
+	assertError(proto.ErrorResultMessage_CHANNEL_NOT_FOUND, proto.MessageType_AUTH, 1)
+
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: 99, StubId: 2})
+	assertError(proto.ErrorResultMessage_UNDEFINED_MESSAGE_TYPE, 99, 2)
+
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_CREATE_CHANNEL), StubId: 3})
+	assertError(proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, proto.MessageType_CREATE_CHANNEL, 3)
+
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_AUTH), StubId: 4, MsgBody: []byte{0xff, 0xff}})
+	assertError(proto.ErrorResultMessage_INVALID_MESSAGE, proto.MessageType_AUTH, 4)
+	assert.Len(t, c.testQueue(), 4)
+
+	// The handlers reply the error with the original stubId.
+	handleRemoveChannel(MessageContext{
+		MsgType:    proto.MessageType_REMOVE_CHANNEL,
+		Msg:        &proto.RemoveChannelMessage{ChannelId: 999},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+		StubId:     5,
+	})
+	assertError(proto.ErrorResultMessage_CHANNEL_NOT_FOUND, proto.MessageType_REMOVE_CHANNEL, 5)
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, nil)
+	handleListChannel(MessageContext{
+		MsgType:    proto.MessageType_LIST_CHANNEL,
+		Msg:        &proto.ListChannelMessage{},
+		Connection: c,
+		Channel:    ch,
+		StubId:     6,
+		ChannelId:  uint32(ch.id),
+	})
+	assertError(proto.ErrorResultMessage_WRONG_CHANNEL, proto.MessageType_LIST_CHANNEL, 6)
+
+	// Never reply an error to an error.
+	handleErrorResult(MessageContext{
+		MsgType:    proto.MessageType_ERROR,
+		Msg:        &proto.PingMessage{},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_ERROR)})
+	assert.Len(t, c.testQueue(), 6)
+}
+
+func TestErrorReplyRateLimit(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	oldLimit := GlobalSettings.MaxErrorRepliesPerSec
+	GlobalSettings.MaxErrorRepliesPerSec = 3
+	defer func() { GlobalSettings.MaxErrorRepliesPerSec = oldLimit }()
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	c.setClaims(&AuthClaims{UserId: "player1"})
+	for i := 0; i < 5; i++ {
+		c.receiveMessage(&proto.MessagePack{ChannelId: 999, MsgType: uint32(proto.MessageType_LIST_CHANNEL), StubId: uint32(i)})
+	}
+	assert.Len(t, c.testQueue(), 3)
+
+	// The limit is reset in the next second.
+	c.errorReplyLock.Lock()
+	c.errorReplySec--
+	c.errorReplyLock.Unlock()
+	c.receiveMessage(&proto.MessagePack{ChannelId: 999, MsgType: uint32(proto.MessageType_LIST_CHANNEL), StubId: 5})
+	assert.Len(t, c.testQueue(), 4)
+	assert.EqualValues(t, 5, c.latestMsg().(*proto.ErrorResultMessage).StubId)
+}
@@ -0,0 +1,354 @@
+package channeld
+
+import (
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// The handover of an entity from a spatial channel to another one that is owned by a different server,
+// or the handover of a whole spatial channel to another server (the source and destination channels are the same).
+type spatialHandover struct {
+	id           uint32
+	wholeChannel bool
+	byBalancer   bool // Started by the load balancing, which waits for the handover to end before balancing again.
+	entityId     uint32
+	entity       *proto.SpatialEntityInfo // The whole data of the entity, including the new location.
+	srcChannel   *Channel
+	dstChannel   *Channel
+	srcOwner     *Connection
+	dstOwner     *Connection
+	// The connection that the player entity is attached to. Nil if the entity is not a player.
+	clientConn *Connection
+	// Should the client's subscription be moved from the source channel to the destination one?
+	// Not needed if the client has an interest area, as the subscriptions follow the area.
+	moveSubscription bool
+	// The options of the client's subscription to the source channel. Set when the handover is accepted.
+	subOptions *proto.ChannelSubscriptionOptions
+	// Rolls back the handover if it's not committed in time. Only stopped in the source channel's goroutine.
+	timer *time.Timer
+	// Decides whether the destination channel or the timeout resolves the handover, once it's accepted.
+	phase int32
+}
+
+const (
+	handoverPreparing int32 = iota
+	handoverAccepted
+	handoverCommitting
+	handoverResolved
+)
+
+func (h *spatialHandover) srcContext() MessageContext {
+	return MessageContext{Connection: h.srcOwner, Channel: h.srcChannel, ChannelId: uint32(h.srcChannel.id)}
+}
+
+func (h *spatialHandover) dstContext() MessageContext {
+	return MessageContext{Connection: h.dstOwner, Channel: h.dstChannel, ChannelId: uint32(h.dstChannel.id)}
+}
+
+func (h *spatialHandover) logger() *zap.Logger {
+	return h.srcChannel.Logger().With(
+		zap.Uint32("handoverId", h.id),
+		zap.Bool("wholeChannel", h.wholeChannel),
+		zap.Uint32("entityId", h.entityId),
+		zap.Uint32("dstChannelId", uint32(h.dstChannel.id)),
+	)
+}
+
+func (ch *Channel) newHandover(dstChannel *Channel, dstOwner *Connection) *spatialHandover {
+	return &spatialHandover{
+		id:         atomic.AddUint32(&ch.server.nextHandoverId, 1),
+		srcChannel: ch,
+		dstChannel: dstChannel,
+		srcOwner:   ch.ownerConnection,
+		dstOwner:   dstOwner,
+	}
+}
+
+// Freezes the entity in the channel and asks the owner of the destination channel to accept it.
+// Called in the source channel's goroutine.
+func (ch *Channel) beginHandover(entityId uint32, entity *proto.SpatialEntityInfo, dstChannel *Channel, dstOwner *Connection) {
+	ch.newEntityHandover(entityId, entity, dstChannel, dstOwner).prepare()
+}
+
+// Freezes the entity in the channel. The handover begins when it's prepared.
+func (ch *Channel) newEntityHandover(entityId uint32, entity *proto.SpatialEntityInfo, dstChannel *Channel, dstOwner *Connection) *spatialHandover {
+	h := ch.newHandover(dstChannel, dstOwner)
+	h.entityId = entityId
+	h.entity = entity
+	if v, exists := ch.server.spatialInterests.Load(entityId); exists {
+		interest := v.(*spatialInterest)
+		if !interest.conn.IsRemoving() {
+			h.clientConn = interest.conn
+			h.moveSubscription = interest.area == nil
+		}
+	}
+
+	if ch.handoverEntities == nil {
+		ch.handoverEntities = make(map[uint32]*spatialHandover)
+	}
+	ch.handoverEntities[entityId] = h
+	return h
+}
+
+// Hands over the ownership of the channel, together with all its entities, to another server.
+// Called in the channel's goroutine.
+func (ch *Channel) beginChannelHandover(dstOwner *Connection) {
+	if ch.ownerConnection == nil || ch.ownerConnection == dstOwner || dstOwner.IsRemoving() || ch.channelHandover != nil {
+		return
+	}
+	if len(ch.handoverEntities) > 0 {
+		ch.Logger().Info("can't hand over the channel while handing over the entities", zap.Int("num", len(ch.handoverEntities)))
+		return
+	}
+	h := ch.newHandover(ch, dstOwner)
+	h.wholeChannel = true
+	h.byBalancer = true
+	ch.channelHandover = h
+	// Unlike handing over an entity, the whole channel is frozen.
+	ch.state = HANDOVER
+	h.prepare()
+}
+
+// Asks the owner of the destination channel to accept the handover, and rolls it back if there's no response in time.
+// Called in the source channel's goroutine.
+func (h *spatialHandover) prepare() {
+	s := h.srcChannel.server
+	s.pendingHandovers.Store(h.id, h)
+
+	ctx := h.dstContext()
+	ctx.MsgType = proto.MessageType_HANDOVER_PREPARE
+	msg := &proto.HandoverPrepareMessage{
+		HandoverId:   h.id,
+		EntityId:     h.entityId,
+		SrcChannelId: uint32(h.srcChannel.id),
+		DstChannelId: uint32(h.dstChannel.id),
+		Entity:       h.entity,
+		WholeChannel: h.wholeChannel,
+	}
+	if h.clientConn != nil {
+		msg.ClientConnId = uint32(h.clientConn.id)
+	}
+	ctx.Msg = msg
+	h.dstOwner.Send(ctx)
+	h.logger().Info("began handover", zap.Uint32("dstOwnerConnId", uint32(h.dstOwner.id)))
+
+	h.timer = time.AfterFunc(time.Duration(s.Settings.HandoverTimeoutMs)*time.Millisecond, func() {
+		if _, exists := s.pendingHandovers.LoadAndDelete(h.id); exists {
+			h.logger().Warn("handover timed out")
+			h.srcChannel.putMessageContext(h.srcContext(), h.rollback)
+		} else if atomic.CompareAndSwapInt32(&h.phase, handoverAccepted, handoverResolved) ||
+			atomic.CompareAndSwapInt32(&h.phase, handoverCommitting, handoverResolved) {
+			// Accepted, but not committed (e.g. the source channel is busy) or the destination channel didn't add the entity.
+			h.logger().Warn("handover timed out as the destination channel didn't add the entity")
+			h.srcChannel.putMessageContext(h.srcContext(), h.rollback)
+		}
+	})
+}
+
+// Drops the updates of the entities that are being handed over, or all the updates if the channel is being handed over.
+func (ch *Channel) dropHandoverEntities(updateMsg *proto.SpatialChannelDataMessage) {
+	for entityId := range updateMsg.Entities {
+		if _, exists := ch.handoverEntities[entityId]; exists || ch.channelHandover != nil {
+			delete(updateMsg.Entities, entityId)
+			ch.Logger().Warn("dropped the update of the entity as it's being handed over", zap.Uint32("entityId", entityId))
+		}
+	}
+}
+
+func (ch *Channel) endHandover(h *spatialHandover) {
+	h.timer.Stop()
+	if !h.wholeChannel {
+		delete(ch.handoverEntities, h.entityId)
+		return
+	}
+	ch.channelHandover = nil
+	if ch.state == HANDOVER {
+		ch.state = OPEN
+	}
+}
+
+func (h *spatialHandover) sendEvent(msgType proto.MessageType) {
+	event := &proto.HandoverEventMessage{
+		HandoverId:   h.id,
+		EntityId:     h.entityId,
+		SrcChannelId: uint32(h.srcChannel.id),
+		DstChannelId: uint32(h.dstChannel.id),
+		WholeChannel: h.wholeChannel,
+	}
+	if h.clientConn != nil {
+		event.ClientConnId = uint32(h.clientConn.id)
+	}
+
+	ctx := h.srcContext()
+	ctx.MsgType = msgType
+	ctx.Msg = event
+	h.srcOwner.Send(ctx)
+
+	ctx.Channel = h.dstChannel
+	ctx.ChannelId = uint32(h.dstChannel.id)
+	h.dstOwner.Send(ctx)
+}
+
+// Called in the source channel's goroutine.
+func (h *spatialHandover) rollback(ctx MessageContext) {
+	h.srcChannel.endHandover(h)
+	h.sendEvent(proto.MessageType_HANDOVER_ROLLBACK)
+	h.logger().Info("rolled back handover")
+}
+
+// Commits the handover in two phases, so the entity is never lost: the destination channel adds the entity first,
+// then the source channel removes it. The entity stays frozen in the source channel until then,
+// and the handover is rolled back if the destination channel fails to add it (e.g. it's removed) within the timeout.
+// Called in the source channel's goroutine.
+func (h *spatialHandover) commit(ctx MessageContext) {
+	if h.wholeChannel {
+		if atomic.CompareAndSwapInt32(&h.phase, handoverAccepted, handoverResolved) {
+			h.commitChannel(ctx)
+		}
+		return
+	}
+	if !atomic.CompareAndSwapInt32(&h.phase, handoverAccepted, handoverCommitting) {
+		// Already rolled back by the timeout
+		return
+	}
+
+	if h.clientConn != nil && h.moveSubscription {
+		if cs, exists := h.srcChannel.subscribedConnections[h.clientConn.id]; exists {
+			h.subOptions = protobuf.Clone(&cs.options).(*proto.ChannelSubscriptionOptions)
+		}
+	}
+	h.dstChannel.putMessageContext(h.dstContext(), h.add)
+}
+
+// Adds the entity and the client's subscription to the destination channel, then asks the source channel to remove them.
+// Called in the destination channel's goroutine.
+func (h *spatialHandover) add(ctx MessageContext) {
+	if !atomic.CompareAndSwapInt32(&h.phase, handoverCommitting, handoverResolved) {
+		// Already rolled back by the timeout
+		return
+	}
+	ch := ctx.Channel
+	if ch.ownerConnection != h.dstOwner {
+		h.logger().Warn("the destination channel owner is changed during the handover")
+		h.srcChannel.putMessageContext(h.srcContext(), h.rollback)
+		return
+	}
+
+	if ch.Data() != nil {
+		ch.applyDataUpdate(nil, &proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{h.entityId: h.entity},
+		})
+	}
+
+	if h.subOptions != nil && ch.subscribedConnections[h.clientConn.id] == nil {
+		h.clientConn.SubscribeToChannel(ch, h.subOptions)
+		h.clientConn.sendSubscribed(ctx, ch, h.clientConn, 0, h.subOptions)
+		if ch.ownerConnection != nil && ch.ownerConnection != h.clientConn {
+			ch.ownerConnection.sendSubscribed(ctx, ch, h.clientConn, 0, h.subOptions)
+		}
+	}
+
+	h.srcChannel.putMessageContext(h.srcContext(), h.finish)
+}
+
+// Removes the entity and the client's subscription from the source channel, after the destination channel has added them.
+// Called in the source channel's goroutine.
+func (h *spatialHandover) finish(ctx MessageContext) {
+	ch := h.srcChannel
+	ch.endHandover(h)
+	if ch.Data() != nil {
+		ch.applyDataUpdate(nil, &proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{h.entityId: {Removed: true}},
+		})
+	}
+
+	if h.subOptions != nil {
+		if _, exists := ch.subscribedConnections[h.clientConn.id]; exists {
+			h.clientConn.UnsubscribeFromChannel(ch)
+			h.clientConn.sendUnsubscribed(ctx, ch, h.clientConn, 0)
+			if ch.ownerConnection != nil && ch.ownerConnection != h.clientConn {
+				ch.ownerConnection.sendUnsubscribed(ctx, ch, h.clientConn, 0)
+			}
+		}
+	}
+
+	h.sendEvent(proto.MessageType_HANDOVER_COMMIT)
+	h.logger().Info("committed handover")
+}
+
+// Replaces the owner of the channel and moves the owner's subscription. Called in the channel's goroutine.
+func (h *spatialHandover) commitChannel(ctx MessageContext) {
+	ch := h.srcChannel
+	if h.dstOwner.IsRemoving() {
+		h.logger().Warn("the destination owner is removed during the handover")
+		h.rollback(ctx)
+		return
+	}
+
+	ch.endHandover(h)
+	ch.assignOwner(h.dstOwner)
+
+	subOptions := &proto.ChannelSubscriptionOptions{CanUpdateData: true}
+	if cs, exists := ch.subscribedConnections[h.srcOwner.id]; exists {
+		subOptions = protobuf.Clone(&cs.options).(*proto.ChannelSubscriptionOptions)
+		h.srcOwner.UnsubscribeFromChannel(ch)
+		h.srcOwner.sendUnsubscribed(ctx, ch, h.srcOwner, 0)
+	}
+	if _, exists := ch.subscribedConnections[h.dstOwner.id]; !exists {
+		h.dstOwner.SubscribeToChannel(ch, subOptions)
+		h.dstOwner.sendSubscribed(ctx, ch, h.dstOwner, 0, subOptions)
+	}
+
+	h.sendEvent(proto.MessageType_HANDOVER_COMMIT)
+	h.logger().Info("committed the channel handover", zap.Uint32("dstOwnerConnId", uint32(h.dstOwner.id)))
+}
+
+func handleHandoverPrepareResult(ctx MessageContext) {
+	s := ctx.Channel.server
+	msg, ok := ctx.Msg.(*proto.HandoverPrepareResultMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a HandoverPrepareResultMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a HandoverPrepareResultMessage")
+		return
+	}
+
+	v, exists := s.pendingHandovers.Load(msg.HandoverId)
+	if !exists {
+		ctx.Connection.Logger().Warn("the handover doesn't exist or has timed out", zap.Uint32("handoverId", msg.HandoverId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_REQUEST_EXPIRED, "the handover doesn't exist or has timed out")
+		return
+	}
+	h := v.(*spatialHandover)
+	if ctx.Connection != h.dstOwner {
+		ctx.Connection.Logger().Error("illegal attemp to accept the handover as the connection is not the destination channel owner",
+			zap.Uint32("handoverId", msg.HandoverId),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the destination channel owner can accept the handover")
+		return
+	}
+	// Could be resolved by the timeout at the same time. Once accepted, the timeout rolls the handover back
+	// until the destination channel adds the entity, so mark it before it's no longer pending.
+	if msg.Accepted {
+		atomic.StoreInt32(&h.phase, handoverAccepted)
+	}
+	if _, exists := s.pendingHandovers.LoadAndDelete(msg.HandoverId); !exists {
+		return
+	}
+
+	if msg.Accepted {
+		h.srcChannel.putMessageContext(h.srcContext(), h.commit)
+	} else {
+		h.logger().Info("the destination channel owner rejected the handover")
+		h.srcChannel.putMessageContext(h.srcContext(), h.rollback)
+	}
+}
+
+// The handover events are only sent from channeld.
+func handleHandoverEvent(ctx MessageContext) {
+	ctx.Connection.Logger().Error("illegal attemp to send the handover event to channeld", zap.Uint32("msgType", uint32(ctx.MsgType)))
+	ctx.Connection.sendError(ctx, proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, "the handover events are only sent from channeld")
+}
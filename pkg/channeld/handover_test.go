@@ -0,0 +1,385 @@
+package channeld
+
+import (
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestSpatialHandover(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	defer func(timeout uint) { GlobalSettings.HandoverTimeoutMs = timeout }(GlobalSettings.HandoverTimeoutMs)
+	GlobalSettings.HandoverTimeoutMs = 200
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(channels[0], server1)
+	setTestChannelOwner(channels[1], server2)
+
+	// The player entity without an interest area, so the subscription follows the entity.
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	executeAndWait(channels[0], func(ch *Channel) {
+		client.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{CanUpdateData: true, FanOutIntervalMs: 20})
+	})
+	handleSpatialInterest(MessageContext{
+		MsgType:    proto.MessageType_SPATIAL_INTEREST,
+		Msg:        &proto.SpatialInterestMessage{ConnId: uint32(client.id), EntityId: 1, FollowEntity: true},
+		Connection: server1,
+		Channel:    defaultServer.globalChannel,
+	})
+
+	updateEntity := func(ch *Channel, entityId uint32, x float64) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{entityId: {Loc: &proto.Location{X: x}}},
+		})
+		ch.PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, ch.getOwner(), &proto.MessagePack{
+			ChannelId: uint32(ch.id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	// Reads a copy of the entities in the channel's goroutine.
+	entities := func(ch *Channel) map[uint32]*proto.SpatialEntityInfo {
+		var entities map[uint32]*proto.SpatialEntityInfo
+		executeAndWait(ch, func(ch *Channel) {
+			entities = protobuf.Clone(ch.Data().msg).(*proto.SpatialChannelDataMessage).Entities
+		})
+		return entities
+	}
+	state := func(ch *Channel) ChannelState {
+		var state ChannelState
+		executeAndWait(ch, func(ch *Channel) { state = ch.state })
+		return state
+	}
+	prepareMsg := func() *proto.HandoverPrepareMessage {
+		for _, msg := range server2.testQueue() {
+			if prepare, ok := msg.(*proto.HandoverPrepareMessage); ok {
+				return prepare
+			}
+		}
+		return nil
+	}
+	hasEvent := func(c *Connection, handoverId uint32) bool {
+		for _, msg := range c.testQueue() {
+			if event, ok := msg.(*proto.HandoverEventMessage); ok && event.HandoverId == handoverId {
+				return true
+			}
+		}
+		return false
+	}
+	reply := func(c *Connection, handoverId uint32, accepted bool) {
+		handleHandoverPrepareResult(MessageContext{
+			MsgType:    proto.MessageType_HANDOVER_PREPARE,
+			Msg:        &proto.HandoverPrepareResultMessage{HandoverId: handoverId, Accepted: accepted},
+			Connection: c,
+			Channel:    defaultServer.globalChannel,
+		})
+	}
+
+	updateEntity(channels[0], 1, 5)
+	assert.Eventually(t, func() bool { return entities(channels[0])[1] != nil }, time.Second, 10*time.Millisecond)
+
+	// Cross the boundary
+	updateEntity(channels[0], 1, 15)
+	assert.Eventually(t, func() bool { return prepareMsg() != nil }, time.Second, 10*time.Millisecond)
+	prepare := prepareMsg()
+	assert.EqualValues(t, 1, prepare.EntityId)
+	assert.EqualValues(t, channels[0].id, prepare.SrcChannelId)
+	assert.EqualValues(t, channels[1].id, prepare.DstChannelId)
+	assert.EqualValues(t, 15, prepare.Entity.Loc.X)
+	assert.EqualValues(t, client.id, prepare.ClientConnId)
+
+	// The entity is frozen in the source channel during the handover.
+	updateEntity(channels[0], 1, 6)
+	updateEntity(channels[0], 2, 1)
+	assert.Eventually(t, func() bool { return entities(channels[0])[2] != nil }, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 5, entities(channels[0])[1].Loc.X)
+	// The other entities are not affected.
+	assert.NotEqual(t, HANDOVER, state(channels[0]))
+	assert.Nil(t, entities(channels[1])[1])
+
+	// Only the destination channel owner can accept the handover.
+	reply(server1, prepare.HandoverId, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, entities(channels[1])[1])
+
+	reply(server2, prepare.HandoverId, true)
+	assert.Eventually(t, func() bool {
+		return hasEvent(server1, prepare.HandoverId) && hasEvent(server2, prepare.HandoverId)
+	}, time.Second, 10*time.Millisecond)
+	assert.Nil(t, entities(channels[0])[1])
+	assert.EqualValues(t, 15, entities(channels[1])[1].Loc.X)
+	assert.NotEqual(t, HANDOVER, state(channels[0]))
+	executeAndWait(channels[0], func(ch *Channel) { assert.NotContains(t, ch.subscribedConnections, client.id) })
+	executeAndWait(channels[1], func(ch *Channel) {
+		if assert.Contains(t, ch.subscribedConnections, client.id) {
+			assert.True(t, ch.subscribedConnections[client.id].options.CanUpdateData)
+		}
+	})
+	assert.IsType(t, &proto.HandoverEventMessage{}, server1.latestMsg())
+	_, pending := defaultServer.pendingHandovers.Load(prepare.HandoverId)
+	assert.False(t, pending)
+
+	// Rejected
+	updateEntity(channels[0], 2, 11)
+	var handoverId uint32
+	assert.Eventually(t, func() bool {
+		prepare, ok := server2.latestMsg().(*proto.HandoverPrepareMessage)
+		if ok {
+			handoverId = prepare.HandoverId
+		}
+		return ok && prepare.EntityId == 2
+	}, time.Second, 10*time.Millisecond)
+	reply(server2, handoverId, false)
+	assert.Eventually(t, func() bool { return hasEvent(server1, handoverId) }, time.Second, 10*time.Millisecond)
+	assert.IsType(t, &proto.HandoverEventMessage{}, server2.latestMsg())
+	assert.EqualValues(t, 1, entities(channels[0])[2].Loc.X)
+	assert.Nil(t, entities(channels[1])[2])
+	assert.NotEqual(t, HANDOVER, state(channels[0]))
+
+	// Timed out
+	updateEntity(channels[0], 2, 12)
+	assert.Eventually(t, func() bool {
+		prepare, ok := server2.latestMsg().(*proto.HandoverPrepareMessage)
+		if ok {
+			handoverId = prepare.HandoverId
+		}
+		return ok && prepare.EntityId == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool { return hasEvent(server1, handoverId) }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, entities(channels[1])[2])
+	// Too late to accept
+	reply(server2, handoverId, true)
+	time.Sleep(50 * time.Millisecond)
+	assert.Nil(t, entities(channels[1])[2])
+	assert.EqualValues(t, 1, entities(channels[0])[2].Loc.X)
+}
+
+// The entity should stay in the source channel if the destination channel fails to add it.
+func TestHandoverDestinationRemoved(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	defer func(timeout uint) { GlobalSettings.HandoverTimeoutMs = timeout }(GlobalSettings.HandoverTimeoutMs)
+	GlobalSettings.HandoverTimeoutMs = 200
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(channels[0], server1)
+	setTestChannelOwner(channels[1], server2)
+
+	updateEntity := func(x float64) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{1: {Loc: &proto.Location{X: x}}},
+		})
+		channels[0].PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server1, &proto.MessagePack{
+			ChannelId: uint32(channels[0].id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	updateEntity(5)
+	updateEntity(15)
+	var prepare *proto.HandoverPrepareMessage
+	assert.Eventually(t, func() bool {
+		prepare, _ = server2.latestMsg().(*proto.HandoverPrepareMessage)
+		return prepare != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// The destination channel can't add the entity before it's removed.
+	freezeTestChannel(channels[1])
+	handleHandoverPrepareResult(MessageContext{
+		MsgType:    proto.MessageType_HANDOVER_PREPARE,
+		Msg:        &proto.HandoverPrepareResultMessage{HandoverId: prepare.HandoverId, Accepted: true},
+		Connection: server2,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool {
+		event, ok := server1.latestMsg().(*proto.HandoverEventMessage)
+		return ok && event.HandoverId == prepare.HandoverId
+	}, time.Second, 10*time.Millisecond)
+	RemoveChannel(channels[1])
+
+	executeAndWait(channels[0], func(ch *Channel) {
+		assert.Empty(t, ch.handoverEntities)
+		assert.EqualValues(t, 5, ch.Data().msg.(*proto.SpatialChannelDataMessage).Entities[1].Loc.X)
+	})
+	// Only the rollback event is sent.
+	events := 0
+	for _, msg := range server1.testQueue() {
+		if _, ok := msg.(*proto.HandoverEventMessage); ok {
+			events++
+		}
+	}
+	assert.Equal(t, 1, events)
+}
+
+// The handover should be rolled back if it times out after being accepted but before being committed,
+// and the destination channel is removed in the meantime.
+func TestHandoverAcceptedDestinationRemoved(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	defer func(timeout uint) { GlobalSettings.HandoverTimeoutMs = timeout }(GlobalSettings.HandoverTimeoutMs)
+	GlobalSettings.HandoverTimeoutMs = 200
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(channels[0], server1)
+	setTestChannelOwner(channels[1], server2)
+
+	updateEntity := func(x float64) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{1: {Loc: &proto.Location{X: x}}},
+		})
+		channels[0].PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server1, &proto.MessagePack{
+			ChannelId: uint32(channels[0].id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	updateEntity(5)
+	updateEntity(15)
+	var prepare *proto.HandoverPrepareMessage
+	assert.Eventually(t, func() bool {
+		prepare, _ = server2.latestMsg().(*proto.HandoverPrepareMessage)
+		return prepare != nil
+	}, time.Second, 10*time.Millisecond)
+
+	// Keep the source channel busy, so the handover is accepted but not committed before it times out.
+	busy, release := make(chan struct{}), make(chan struct{})
+	channels[0].execute(func(ch *Channel) {
+		close(busy)
+		<-release
+	})
+	<-busy
+	handleHandoverPrepareResult(MessageContext{
+		MsgType:    proto.MessageType_HANDOVER_PREPARE,
+		Msg:        &proto.HandoverPrepareResultMessage{HandoverId: prepare.HandoverId, Accepted: true},
+		Connection: server2,
+		Channel:    defaultServer.globalChannel,
+	})
+	time.Sleep(time.Duration(GlobalSettings.HandoverTimeoutMs)*time.Millisecond + 100*time.Millisecond)
+	RemoveChannel(channels[1])
+	close(release)
+
+	assert.Eventually(t, func() bool {
+		event, ok := server1.latestMsg().(*proto.HandoverEventMessage)
+		return ok && event.HandoverId == prepare.HandoverId
+	}, time.Second, 10*time.Millisecond)
+	executeAndWait(channels[0], func(ch *Channel) {
+		assert.Empty(t, ch.handoverEntities)
+		assert.EqualValues(t, 5, ch.Data().msg.(*proto.SpatialChannelDataMessage).Entities[1].Loc.X)
+	})
+	// Only the rollback event is sent.
+	events := 0
+	for _, msg := range server1.testQueue() {
+		if _, ok := msg.(*proto.HandoverEventMessage); ok {
+			events++
+		}
+	}
+	assert.Equal(t, 1, events)
+}
+
+// The server connection should keep sending the messages after accepting a handover, with the FSM in the config.
+func TestHandoverWithConfigFsm(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	oldServerFsm := defaultServer.serverFsm
+	defer func() { defaultServer.serverFsm = oldServerFsm }()
+	serverFsm, err := loadFsm("../../config/server_authoratative_fsm.json", true)
+	assert.NoError(t, err)
+	defaultServer.serverFsm = serverFsm
+
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	executeAndWait(defaultServer.globalChannel, func(_ *Channel) {
+		server1.fsm.MoveToNextState()
+		server2.fsm.MoveToNextState()
+	})
+	// Authenticated, so any rejection would be replied.
+	server1.setClaims(&AuthClaims{UserId: "server1"})
+	server2.setClaims(&AuthClaims{UserId: "server2"})
+	setTestChannelOwner(channels[0], server1)
+	setTestChannelOwner(channels[1], server2)
+
+	receive := func(c *Connection, ch *Channel, msgType proto.MessageType, msg Message) {
+		body, err := protobuf.Marshal(msg)
+		assert.NoError(t, err)
+		c.receiveMessage(&proto.MessagePack{ChannelId: uint32(ch.id), MsgType: uint32(msgType), MsgBody: body})
+	}
+	updateEntity := func(c *Connection, ch *Channel, x float64) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{1: {Loc: &proto.Location{X: x}}},
+		})
+		receive(c, ch, proto.MessageType_CHANNEL_DATA_UPDATE, &proto.ChannelDataUpdateMessage{Data: any})
+	}
+	prepareMsg := func() *proto.HandoverPrepareMessage {
+		for _, msg := range server2.testQueue() {
+			if prepare, ok := msg.(*proto.HandoverPrepareMessage); ok {
+				return prepare
+			}
+		}
+		return nil
+	}
+	hasError := func(c *Connection) bool {
+		for _, msg := range c.testQueue() {
+			if _, ok := msg.(*proto.ErrorResultMessage); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	updateEntity(server1, channels[0], 5)
+	updateEntity(server1, channels[0], 15)
+	assert.Eventually(t, func() bool { return prepareMsg() != nil }, time.Second, 10*time.Millisecond)
+
+	receive(server2, defaultServer.globalChannel, proto.MessageType_HANDOVER_PREPARE,
+		&proto.HandoverPrepareResultMessage{HandoverId: prepareMsg().HandoverId, Accepted: true})
+	assert.Eventually(t, func() bool {
+		_, ok := server2.latestMsg().(*proto.HandoverEventMessage)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	// The destination owner updates the entity it has just accepted.
+	updateEntity(server2, channels[1], 16)
+	executeAndWait(channels[1], func(ch *Channel) {
+		assert.EqualValues(t, 16, ch.Data().msg.(*proto.SpatialChannelDataMessage).Entities[1].Loc.X)
+	})
+	assert.False(t, hasError(server2))
+	assert.Equal(t, "OPEN", server2.fsm.CurrentState().Name)
+}
@@ -0,0 +1,86 @@
+package channeld
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+)
+
+func (s *Server) setListening(t proto.ConnectionType, listening bool) {
+	s.listeningConnTypes.Store(t, listening)
+}
+
+// Returns true if the listener of the connection type of the default server has been started and not stopped yet.
+func IsListening(t proto.ConnectionType) bool {
+	return defaultServer.IsListening(t)
+}
+
+func (s *Server) IsListening(t proto.ConnectionType) bool {
+	listening, ok := s.listeningConnTypes.Load(t)
+	return ok && listening.(bool)
+}
+
+// Returns the channels that haven't ticked within the timeout, or twice their tick interval if longer.
+func (s *Server) stalledChannels(now time.Time) []*Channel {
+	stalled := make([]*Channel, 0)
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		ch := v.(*Channel)
+		if ch.IsRemoving() {
+			return true
+		}
+		timeout := time.Duration(s.Settings.ChannelStallTimeoutMs) * time.Millisecond
+		if tickInterval := ch.getTickInterval(); timeout < tickInterval*2 {
+			timeout = tickInterval * 2
+		}
+		if now.Sub(time.Unix(0, atomic.LoadInt64(&ch.lastTickTime))) > timeout {
+			stalled = append(stalled, ch)
+		}
+		return true
+	})
+	return stalled
+}
+
+func writeCheckResult(w http.ResponseWriter, problems []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, strings.Join(problems, "\n"))
+	} else {
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+// The liveness check of the default server. Fails if any channel's tick goroutine is stalled.
+func HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	defaultServer.HandleHealthz(w, r)
+}
+
+func (s *Server) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	problems := make([]string, 0)
+	for _, ch := range s.stalledChannels(now) {
+		problems = append(problems, fmt.Sprintf("%s has not ticked for %s", ch, now.Sub(time.Unix(0, atomic.LoadInt64(&ch.lastTickTime)))))
+	}
+	writeCheckResult(w, problems)
+}
+
+// The readiness check of the default server. Fails if the server listener is not up, or the GLOBAL channel has no owner (if -readyowner is set).
+func HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	defaultServer.HandleReadyz(w, r)
+}
+
+func (s *Server) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	problems := make([]string, 0)
+	if !s.IsListening(proto.ConnectionType_SERVER) {
+		problems = append(problems, "the server listener is not up")
+	}
+	if s.Settings.ReadyRequiresGlobalOwner && (s.globalChannel == nil || s.globalChannel.getOwner() == nil) {
+		problems = append(problems, "the GLOBAL channel has no owner")
+	}
+	writeCheckResult(w, problems)
+}
@@ -0,0 +1,68 @@
+package channeld
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func checkStatus(handler http.HandlerFunc) int {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/", nil))
+	return w.Code
+}
+
+func TestHealthz(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	stallTimeout := GlobalSettings.ChannelStallTimeoutMs
+	GlobalSettings.ChannelStallTimeoutMs = 100
+	defer func() { GlobalSettings.ChannelStallTimeoutMs = stallTimeout }()
+
+	c := addTestConnection(proto.ConnectionType_SERVER)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, c)
+	assert.Equal(t, http.StatusOK, checkStatus(HandleHealthz))
+
+	// Block the channel's tick goroutine
+	unblock := make(chan struct{})
+	ch.putMessageContext(MessageContext{Connection: c, Channel: ch}, func(ctx MessageContext) {
+		<-unblock
+	})
+	assert.Eventually(t, func() bool {
+		return checkStatus(HandleHealthz) == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, []*Channel{ch}, defaultServer.stalledChannels(time.Now()))
+
+	close(unblock)
+	assert.Eventually(t, func() bool {
+		return checkStatus(HandleHealthz) == http.StatusOK
+	}, time.Second, 10*time.Millisecond)
+
+	// The channel that ticks slowly is not stalled
+	atomic.StoreInt64(&ch.tickInterval, int64(time.Hour))
+	assert.NotContains(t, defaultServer.stalledChannels(time.Now().Add(time.Hour)), ch)
+}
+
+func TestReadyz(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	defer defaultServer.setListening(proto.ConnectionType_SERVER, false)
+
+	defaultServer.setListening(proto.ConnectionType_SERVER, false)
+	assert.Equal(t, http.StatusServiceUnavailable, checkStatus(HandleReadyz))
+
+	defaultServer.setListening(proto.ConnectionType_SERVER, true)
+	assert.Equal(t, http.StatusOK, checkStatus(HandleReadyz))
+
+	GlobalSettings.ReadyRequiresGlobalOwner = true
+	defer func() { GlobalSettings.ReadyRequiresGlobalOwner = false }()
+	assert.Equal(t, http.StatusServiceUnavailable, checkStatus(HandleReadyz))
+
+	setTestChannelOwner(defaultServer.globalChannel, addTestConnection(proto.ConnectionType_SERVER))
+	assert.Equal(t, http.StatusOK, checkStatus(HandleReadyz))
+}
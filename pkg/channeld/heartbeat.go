@@ -0,0 +1,119 @@
+package channeld
+
+import (
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+// How often the idle connections are checked if PING is disabled.
+const defaultHeartbeatInterval = time.Second
+
+// Starts the goroutine that sends PING to the connections of the default server and removes the idle ones.
+// Does nothing if neither PING nor the idle timeouts are enabled.
+func InitHeartbeat() {
+	defaultServer.InitHeartbeat()
+}
+
+func (s *Server) InitHeartbeat() {
+	if s.Settings.PingIntervalMs == 0 && s.Settings.ServerIdleTimeoutMs == 0 && s.Settings.ClientIdleTimeoutMs == 0 {
+		return
+	}
+
+	interval := defaultHeartbeatInterval
+	if s.Settings.PingIntervalMs > 0 {
+		interval = time.Duration(s.Settings.PingIntervalMs) * time.Millisecond
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case t := <-ticker.C:
+				s.tickHeartbeat(t)
+			}
+		}
+	}()
+}
+
+func (s *Server) tickHeartbeat(now time.Time) {
+	s.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		c := v.(*Connection)
+		// The detached connection is removed by the resume grace timer.
+		if c.IsRemoving() || c.isDetached() {
+			return true
+		}
+
+		idle := now.Sub(time.Unix(0, atomic.LoadInt64(&c.lastRecvTime)))
+		timeout := s.Settings.GetIdleTimeout(c.connectionType)
+		if timeout > 0 && idle > timeout {
+			c.Logger().Info("removing the idle connection", zap.Duration("idle", idle))
+			connectionIdleRemoved.WithLabelValues(c.connectionType.String()).Inc()
+			// The owners of the subscribed channels will be notified in the channels' next tick.
+			RemoveConnection(c)
+			return true
+		}
+
+		if s.Settings.PingIntervalMs > 0 {
+			c.Send(MessageContext{
+				MsgType:   proto.MessageType_PING,
+				Msg:       &proto.PingMessage{Timestamp: now.UnixNano()},
+				Channel:   s.globalChannel,
+				ChannelId: uint32(GlobalChannelId),
+			})
+		}
+		return true
+	})
+}
+
+// The smoothed round-trip time of the connection, measured by the PINGs sent from channeld. 0 if not measured yet.
+func (c *Connection) RTT() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rtt))
+}
+
+func (c *Connection) updateRTT(sample time.Duration) {
+	rtt := atomic.LoadInt64(&c.rtt)
+	if rtt == 0 {
+		rtt = int64(sample)
+	} else {
+		// Same as TCP's SRTT (RFC 6298)
+		rtt += (int64(sample) - rtt) / 8
+	}
+	atomic.StoreInt64(&c.rtt, rtt)
+	connectionRtt.WithLabelValues(c.connectionType.String()).Observe(float64(sample) / float64(time.Millisecond))
+}
+
+func handlePing(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.PingMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a PingMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a PingMessage")
+		return
+	}
+
+	ctx.MsgType = proto.MessageType_PONG
+	ctx.Msg = &proto.PongMessage{Timestamp: msg.Timestamp}
+	ctx.Connection.Send(ctx)
+}
+
+func handlePong(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.PongMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a PongMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a PongMessage")
+		return
+	}
+
+	sample := time.Since(time.Unix(0, msg.Timestamp))
+	if sample < 0 {
+		ctx.Connection.Logger().Warn("invalid timestamp in PongMessage", zap.Int64("timestamp", msg.Timestamp))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "invalid timestamp in PongMessage")
+		return
+	}
+	ctx.Connection.updateRTT(sample)
+}
@@ -0,0 +1,107 @@
+package channeld
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPingPong(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	handlePing(MessageContext{
+		MsgType:    proto.MessageType_PING,
+		Msg:        &proto.PingMessage{Timestamp: 123},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	pong, ok := c.latestMsg().(*proto.PongMessage)
+	assert.True(t, ok)
+	assert.EqualValues(t, 123, pong.Timestamp)
+
+	assert.Zero(t, c.RTT())
+	handlePong(MessageContext{
+		MsgType:    proto.MessageType_PONG,
+		Msg:        &proto.PongMessage{Timestamp: time.Now().Add(-80 * time.Millisecond).UnixNano()},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.GreaterOrEqual(t, c.RTT(), 80*time.Millisecond)
+
+	// The RTT is smoothed
+	rtt := c.RTT()
+	handlePong(MessageContext{
+		MsgType:    proto.MessageType_PONG,
+		Msg:        &proto.PongMessage{Timestamp: time.Now().Add(-240 * time.Millisecond).UnixNano()},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Greater(t, c.RTT(), rtt)
+	assert.Less(t, c.RTT(), 120*time.Millisecond)
+
+	// Invalid timestamp
+	rtt = c.RTT()
+	handlePong(MessageContext{
+		MsgType:    proto.MessageType_PONG,
+		Msg:        &proto.PongMessage{Timestamp: time.Now().Add(time.Hour).UnixNano()},
+		Connection: c,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Equal(t, rtt, c.RTT())
+}
+
+func TestReapIdleConnections(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	// Clear the connections added by other tests
+	defaultServer.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		RemoveConnection(v.(*Connection))
+		return true
+	})
+	GlobalSettings.PingIntervalMs = 1000
+	GlobalSettings.ClientIdleTimeoutMs = 3000
+	defer func() {
+		GlobalSettings.PingIntervalMs = 0
+		GlobalSettings.ClientIdleTimeoutMs = 0
+	}()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	client1 := addTestConnection(proto.ConnectionType_CLIENT)
+	client2 := addTestConnection(proto.ConnectionType_CLIENT)
+
+	testChannel, _ := CreateChannel(proto.ChannelType_TEST, server)
+	executeAndWait(testChannel, func(ch *Channel) {
+		server.SubscribeToChannel(ch, nil)
+		client1.SubscribeToChannel(ch, nil)
+		client2.SubscribeToChannel(ch, nil)
+	})
+
+	now := time.Now()
+	defaultServer.tickHeartbeat(now)
+	ping, ok := client1.latestMsg().(*proto.PingMessage)
+	assert.True(t, ok)
+	assert.EqualValues(t, now.UnixNano(), ping.Timestamp)
+
+	// client2 keeps receiving, client1 goes silent
+	atomic.StoreInt64(&client2.lastRecvTime, now.Add(3*time.Second).UnixNano())
+	defaultServer.tickHeartbeat(now.Add(4 * time.Second))
+	assert.True(t, client1.IsRemoving())
+	assert.False(t, client2.IsRemoving())
+	// The server connection has no idle timeout
+	assert.False(t, server.IsRemoving())
+
+	// The channel owner is notified in the channel's tick
+	assert.Eventually(t, func() bool {
+		unsub, ok := server.latestMsg().(*proto.UnsubscribedFromChannelResultMessage)
+		return ok && unsub.ConnId == uint32(client1.id)
+	}, time.Second, 10*time.Millisecond)
+	executeAndWait(testChannel, func(ch *Channel) {
+		assert.NotContains(t, ch.subscribedConnections, client1.id)
+		assert.Contains(t, ch.subscribedConnections, client2.id)
+	})
+}
@@ -1,460 +1,576 @@
-package channeld
-
-import (
-	"strings"
-
-	"channeld.clewcat.com/channeld/proto"
-	"go.uber.org/zap"
-	protobuf "google.golang.org/protobuf/proto"
-)
-
-type Message = protobuf.Message //protoreflect.ProtoMessage
-// The context of a message for both sending and receiving
-type MessageContext struct {
-	MsgType    proto.MessageType
-	Msg        Message     // The weak-typed Message object popped from the message queue
-	Connection *Connection // The connection that received the message
-	Channel    *Channel    // The channel that handling the message
-	Broadcast  proto.BroadcastType
-	StubId     uint32
-	ChannelId  uint32 // The original channelId in the Packet, could be different from Channel.id.
-}
-type MessageHandlerFunc func(ctx MessageContext)
-type messageMapEntry struct {
-	msg     Message
-	handler MessageHandlerFunc
-}
-
-var MessageMap = map[proto.MessageType]*messageMapEntry{
-	proto.MessageType_AUTH:                {&proto.AuthMessage{}, handleAuth},
-	proto.MessageType_CREATE_CHANNEL:      {&proto.CreateChannelMessage{}, handleCreateChannel},
-	proto.MessageType_REMOVE_CHANNEL:      {&proto.RemoveChannelMessage{}, handleRemoveChannel},
-	proto.MessageType_LIST_CHANNEL:        {&proto.ListChannelMessage{}, handleListChannel},
-	proto.MessageType_SUB_TO_CHANNEL:      {&proto.SubscribedToChannelMessage{}, handleSubToChannel},
-	proto.MessageType_UNSUB_FROM_CHANNEL:  {&proto.UnsubscribedFromChannelMessage{}, handleUnsubFromChannel},
-	proto.MessageType_CHANNEL_DATA_UPDATE: {&proto.ChannelDataUpdateMessage{}, handleChannelDataUpdate},
-	proto.MessageType_DISCONNECT:          {&proto.DisconnectMessage{}, handleDisconnect},
-}
-
-func RegisterMessageHandler(msgType uint32, msg Message, handler MessageHandlerFunc) {
-	MessageMap[proto.MessageType(msgType)] = &messageMapEntry{msg, handler}
-}
-
-func handleClientToServerUserMessage(ctx MessageContext) {
-	if ctx.Channel.ownerConnection != nil {
-		ctx.Channel.ownerConnection.Send(ctx)
-	} else if ctx.Broadcast != proto.BroadcastType_NO_BROADCAST {
-		if ctx.Channel.enableClientBroadcast {
-			ctx.Channel.Broadcast(ctx)
-		} else {
-			ctx.Connection.Logger().Error("illegal attempt to broadcast message as the channel's client broadcasting is disabled",
-				zap.Uint32("msgType", uint32(ctx.MsgType)),
-				zap.String("channelType", ctx.Channel.channelType.String()),
-				zap.Uint32("channelId", uint32(ctx.Channel.id)),
-			)
-		}
-	} else {
-		ctx.Channel.Logger().Error("channel has no owner to forward the user-space messaged",
-			zap.Uint32("msgType", uint32(ctx.MsgType)),
-			zap.Uint32("connId", uint32(ctx.Connection.id)),
-		)
-	}
-}
-
-func handleServerToClientUserMessage(ctx MessageContext) {
-	msg, ok := ctx.Msg.(*proto.ServerForwardMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a ServerForwardMessage, will not be handled.")
-		return
-	}
-
-	switch ctx.Broadcast {
-	case proto.BroadcastType_NO_BROADCAST:
-		if ctx.Channel.ownerConnection != nil {
-			ctx.Channel.ownerConnection.Send(ctx)
-		} else {
-			ctx.Connection.Logger().Error("cannot forward the message as the channel has no owner",
-				zap.Uint32("msgType", uint32(ctx.MsgType)),
-				zap.String("channelType", ctx.Channel.channelType.String()),
-				zap.Uint32("channelId", uint32(ctx.Channel.id)),
-			)
-		}
-
-	case proto.BroadcastType_ALL, proto.BroadcastType_ALL_BUT_SENDER:
-		ctx.Channel.Broadcast(ctx)
-
-	case proto.BroadcastType_SINGLE_CONNECTION:
-		clientConn := GetConnection(ConnectionId(msg.ClientConnId))
-		if clientConn != nil {
-			clientConn.Send(ctx)
-		} else {
-			ctx.Connection.Logger().Error("cannot forward the message as the target connection does not exist",
-				zap.Uint32("msgType", uint32(ctx.MsgType)),
-				zap.Uint32("targetConnId", msg.ClientConnId),
-			)
-		}
-	}
-}
-
-func handleAuth(ctx MessageContext) {
-	if ctx.Channel != globalChannel {
-		ctx.Connection.Logger().Error("illegal attemp to authenticate outside the GLOBAL channel")
-		return
-	}
-	_, ok := ctx.Msg.(*proto.AuthMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("mssage is not a AuthMessage, will not be handled.")
-		return
-	}
-	//log.Printf("Auth PIT: %s, LT: %s\n", msg.PlayerIdentifierToken, msg.LoginToken)
-
-	// TODO: Authentication
-
-	ctx.Connection.fsm.MoveToNextState()
-
-	ctx.Msg = &proto.AuthResultMessage{
-		Result:          proto.AuthResultMessage_SUCCESSFUL,
-		ConnId:          uint32(ctx.Connection.id),
-		CompressionType: GlobalSettings.CompressionType,
-	}
-	ctx.Connection.Send(ctx)
-
-	// Also send the respond to The GLOBAL channel owner (to handle the client's subscription if it doesn't have the authority to).
-	if globalChannel.ownerConnection != nil {
-		ctx.StubId = 0
-		globalChannel.ownerConnection.Send(ctx)
-	}
-}
-
-func handleCreateChannel(ctx MessageContext) {
-	// Only the GLOBAL channel can handle channel creation/deletion/listing
-	if ctx.Channel != globalChannel {
-		ctx.Connection.Logger().Error("illegal attemp to create channel outside the GLOBAL channel")
-		return
-	}
-
-	msg, ok := ctx.Msg.(*proto.CreateChannelMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a CreateChannelMessage, will not be handled.")
-		return
-	}
-
-	var newChannel *Channel
-	var err error
-	if msg.ChannelType == proto.ChannelType_UNKNOWN {
-		ctx.Connection.Logger().Error("illegal attemp to create the UNKNOWN channel")
-		return
-	} else if msg.ChannelType == proto.ChannelType_GLOBAL {
-		// Global channel is initially created by the system. Creating the channel will attempt to own it.
-		newChannel = globalChannel
-		if globalChannel.ownerConnection == nil {
-			globalChannel.ownerConnection = ctx.Connection
-			ctx.Connection.Logger().Info("owned the GLOBAL channel")
-		} else {
-			ctx.Connection.Logger().Error("illegal attemp to create the GLOBAL channel")
-			return
-		}
-	} else {
-		newChannel, err = CreateChannel(msg.ChannelType, ctx.Connection)
-		if err != nil {
-			ctx.Connection.Logger().Error("failed to create channel",
-				zap.Uint32("channelType", uint32(msg.ChannelType)),
-				zap.Error(err),
-			)
-			return
-		}
-		newChannel.Logger().Info("created channel with owner", zap.Uint32("ownerConnId", uint32(newChannel.ownerConnection.id)))
-	}
-
-	newChannel.metadata = msg.Metadata
-	if msg.Data != nil {
-		dataMsg, err := msg.Data.UnmarshalNew()
-		if err != nil {
-			newChannel.Logger().Error("failed to unmarshal data message for the new channel", zap.Error(err))
-			return
-		} else {
-			newChannel.InitData(dataMsg, msg.MergeOptions)
-		}
-	} else {
-		// Channel data should always be initialized
-		newChannel.InitData(nil, msg.MergeOptions)
-	}
-
-	// Make sure the response message has the channelId = newChannel.id, not always 0.
-	ctx.ChannelId = uint32(newChannel.id)
-
-	ctx.Msg = &proto.CreateChannelResultMessage{
-		ChannelType: newChannel.channelType,
-		Metadata:    newChannel.metadata,
-		OwnerConnId: uint32(ctx.Connection.id),
-	}
-	ctx.Connection.Send(ctx)
-	// Also send the response to the GLOBAL channel owner.
-	if globalChannel.ownerConnection != ctx.Connection && globalChannel.ownerConnection != nil {
-		ctx.StubId = 0
-		globalChannel.ownerConnection.Send(ctx)
-	}
-
-	// Subscribe to channel after creation
-	ctx.Connection.SubscribeToChannel(newChannel, msg.SubOptions)
-	ctx.Connection.sendSubscribed(ctx, newChannel, ctx.Connection, 0, msg.SubOptions)
-}
-
-func handleRemoveChannel(ctx MessageContext) {
-	if ctx.Channel != globalChannel {
-		ctx.Connection.Logger().Error("illegal attemp to remove channel outside the GLOBAL channel")
-		return
-	}
-
-	msg, ok := ctx.Msg.(*proto.RemoveChannelMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a RemoveChannelMessage, will not be handled.")
-		return
-	}
-
-	channelToRemove := GetChannel(ChannelId(msg.ChannelId))
-	if channelToRemove == nil {
-		ctx.Connection.Logger().Error("invalid channelId for removing", zap.Uint32("channelId", msg.ChannelId))
-		return
-	}
-	// Only the channel owner or GLOBAL owner can remove the channel
-	if !ctx.Connection.HasAuthorityOver(channelToRemove) {
-		ownerConnId := uint32(0)
-		if channelToRemove.ownerConnection != nil {
-			ownerConnId = uint32(channelToRemove.ownerConnection.id)
-		}
-		ctx.Connection.Logger().Error("illegal attemp to remove channel as the connection is not the channel owner",
-			zap.String("channelType", channelToRemove.channelType.String()),
-			zap.Uint32("channelId", uint32(channelToRemove.id)),
-			zap.Uint32("ownerConnId", ownerConnId),
-		)
-		return
-	}
-
-	for connId := range channelToRemove.subscribedConnections {
-		sc := GetConnection(connId)
-		if sc != nil {
-			//sc.sendUnsubscribed(ctx, channelToRemove, 0)
-			respond := ctx
-			respond.StubId = 0
-			sc.Send(respond)
-		}
-	}
-	RemoveChannel(channelToRemove)
-
-	ctx.Connection.Logger().Info("removed channel",
-		zap.String("channelType", channelToRemove.channelType.String()),
-		zap.Uint32("channelId", uint32(channelToRemove.id)),
-		zap.Int("subs", len(channelToRemove.subscribedConnections)),
-	)
-}
-
-func handleListChannel(ctx MessageContext) {
-	if ctx.Channel != globalChannel {
-		ctx.Connection.Logger().Error("illegal attemp to list channel outside the GLOBAL channel")
-		return
-	}
-
-	msg, ok := ctx.Msg.(*proto.ListChannelMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a ListChannelMessage, will not be handled.")
-		return
-	}
-
-	result := make([]*proto.ListChannelResultMessage_ChannelInfo, 0)
-	allChannels.Range(func(k interface{}, v interface{}) bool {
-		channel := v.(*Channel)
-		if msg.TypeFilter != proto.ChannelType_UNKNOWN && msg.TypeFilter != channel.channelType {
-			return true
-		}
-		matched := len(msg.MetadataFilters) == 0
-		for _, keyword := range msg.MetadataFilters {
-			if strings.Contains(channel.metadata, keyword) {
-				matched = true
-				break
-			}
-		}
-		if matched {
-			result = append(result, &proto.ListChannelResultMessage_ChannelInfo{
-				ChannelId:   uint32(channel.id),
-				ChannelType: channel.channelType,
-				Metadata:    channel.metadata,
-			})
-		}
-		return true
-	})
-
-	ctx.Msg = &proto.ListChannelResultMessage{
-		Channels: result,
-	}
-	ctx.Connection.Send(ctx)
-}
-
-func handleSubToChannel(ctx MessageContext) {
-	msg, ok := ctx.Msg.(*proto.SubscribedToChannelMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a SubscribedToChannelMessage, will not be handled.")
-		return
-	}
-
-	// The connection that subscribes. Could be different to the connection that sends the message.
-	connToSub := GetConnection(ConnectionId(msg.ConnId))
-	if connToSub == nil {
-		ctx.Connection.Logger().Error("invalid ConnectionId for sub", zap.Uint32("connId", msg.ConnId))
-		return
-	}
-
-	if connToSub.id != ctx.Connection.id && !connToSub.HasAuthorityOver(ctx.Channel) {
-		ctx.Connection.Logger().Error("illegal attemp to sub another connection as the sender has no authority",
-			zap.Uint32("subConnId", msg.ConnId),
-			zap.String("channelType", ctx.Channel.channelType.String()),
-			zap.Uint32("channelId", uint32(ctx.Channel.id)),
-		)
-		return
-	}
-
-	cs, exists := ctx.Channel.subscribedConnections[ctx.Connection.id]
-	if exists {
-		ctx.Connection.Logger().Info("already subscribed to channel, the subscription options will be merged",
-			zap.String("channelType", ctx.Channel.channelType.String()),
-			zap.Uint32("channelId", uint32(ctx.Channel.id)),
-		)
-		if msg.SubOptions != nil {
-			protobuf.Merge(&cs.options, msg.SubOptions)
-		}
-		// Do not send the SubscribedToChannelResultMessage if already subed.
-		return
-	}
-
-	connToSub.SubscribeToChannel(ctx.Channel, msg.SubOptions)
-
-	// Notify the sender.
-	ctx.Connection.sendSubscribed(ctx, ctx.Channel, connToSub, ctx.StubId, msg.SubOptions)
-
-	// Notify the subscribed (if not the sender).
-	if connToSub != ctx.Connection {
-		connToSub.sendSubscribed(ctx, ctx.Channel, connToSub, 0, msg.SubOptions)
-	}
-	// Notify the channel owner.
-	if ctx.Channel.ownerConnection != ctx.Connection && ctx.Channel.ownerConnection != nil {
-		ctx.Channel.ownerConnection.sendSubscribed(ctx, ctx.Channel, connToSub, 0, msg.SubOptions)
-	}
-}
-
-func handleUnsubFromChannel(ctx MessageContext) {
-	msg, ok := ctx.Msg.(*proto.UnsubscribedFromChannelMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a UnsubscribedFromChannelMessage, will not be handled.")
-		return
-	}
-
-	// The connection that unsubscribes. Could be different to the connection that sends the message.
-	connToUnsub := GetConnection(ConnectionId(msg.ConnId))
-	if connToUnsub == nil {
-		ctx.Connection.Logger().Error("invalid ConnectionId for unsub", zap.Uint32("connId", msg.ConnId))
-		return
-	}
-
-	if connToUnsub.id != ctx.Connection.id && !connToUnsub.HasAuthorityOver(ctx.Channel) {
-		ctx.Connection.Logger().Error("illegal attemp to unsub another connection as the sender has no authority",
-			zap.Uint32("unsubConnId", msg.ConnId),
-			zap.String("channelType", ctx.Channel.channelType.String()),
-			zap.Uint32("channelId", uint32(ctx.Channel.id)),
-		)
-		return
-	}
-
-	err := connToUnsub.UnsubscribeFromChannel(ctx.Channel)
-	if err != nil {
-		ctx.Connection.Logger().Error("failed to unsub from channel",
-			zap.String("channelType", ctx.Channel.channelType.String()),
-			zap.Uint32("channelId", uint32(ctx.Channel.id)),
-			zap.Error(err),
-		)
-		return
-	}
-
-	// Notify the sender.
-	ctx.Connection.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, ctx.StubId)
-
-	// Notify the unsubscribed.
-	if connToUnsub != ctx.Connection {
-		connToUnsub.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, 0)
-	}
-	// Notify the channel owner.
-	if ctx.Channel.ownerConnection != nil {
-		if ctx.Channel.ownerConnection != ctx.Connection {
-			ctx.Channel.ownerConnection.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, 0)
-		} else {
-			// Reset the owner if it unsubscribed
-			ctx.Channel.ownerConnection = nil
-		}
-	}
-}
-
-func handleChannelDataUpdate(ctx MessageContext) {
-	// Only channel owner or writable subsciptors can update the data
-	if ctx.Channel.ownerConnection != ctx.Connection {
-		cs := ctx.Channel.subscribedConnections[ctx.Connection.id]
-		if cs == nil || !cs.options.CanUpdateData {
-			ctx.Connection.Logger().Error("attempt to update channel data but has no access",
-				zap.String("channelType", ctx.Channel.channelType.String()),
-				zap.Uint32("channelId", uint32(ctx.Channel.id)),
-			)
-			return
-		}
-	}
-
-	if ctx.Channel.Data() == nil {
-		ctx.Channel.Logger().Info("channel data is not initialized - should send CreateChannelMessage before ChannelDataUpdateMessage",
-			zap.Uint32("connId", uint32(ctx.Connection.id)))
-		return
-	}
-
-	msg, ok := ctx.Msg.(*proto.ChannelDataUpdateMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a ChannelDataUpdateMessage, will not be handled.")
-		return
-	}
-	updateMsg, err := msg.Data.UnmarshalNew()
-	if err != nil {
-		ctx.Connection.Logger().Error("failed to unmarshal channel update data", zap.Error(err))
-		return
-	}
-
-	ctx.Channel.Data().OnUpdate(updateMsg, ctx.Channel.GetTime())
-}
-
-func handleDisconnect(ctx MessageContext) {
-	if ctx.Channel != globalChannel {
-		ctx.Connection.Logger().Error("illegal attemp to disconnect another connection outside the GLOBAL channel")
-		return
-	}
-
-	msg, ok := ctx.Msg.(*proto.DisconnectMessage)
-	if !ok {
-		ctx.Connection.Logger().Error("message is not a DisconnectMessage, will not be handled.")
-		return
-	}
-
-	connToDisconnect := GetConnection(ConnectionId(msg.ConnId))
-	if connToDisconnect == nil {
-		ctx.Connection.Logger().Warn("could not find the connection to disconnect",
-			zap.Uint32("targetConnId", msg.ConnId),
-		)
-		return
-	}
-
-	if err := connToDisconnect.Disconnect(); err != nil {
-		ctx.Connection.Logger().Warn("failed to disconnect a connection",
-			zap.Uint32("targetConnId", msg.ConnId),
-			zap.String("targetConnType", connToDisconnect.connectionType.String()),
-		)
-	} else {
-		ctx.Connection.Logger().Info("successfully disconnected a connection",
-			zap.Uint32("targetConnId", msg.ConnId),
-			zap.String("targetConnType", connToDisconnect.connectionType.String()),
-		)
-	}
-	RemoveConnection(connToDisconnect)
-}
+package channeld
+
+import (
+	"strings"
+	"sync/atomic"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+type Message = protobuf.Message //protoreflect.ProtoMessage
+// The context of a message for both sending and receiving
+type MessageContext struct {
+	MsgType    proto.MessageType
+	Msg        Message     // The weak-typed Message object popped from the message queue
+	Connection *Connection // The connection that received the message
+	Channel    *Channel    // The channel that handling the message
+	Broadcast  proto.BroadcastType
+	StubId     uint32
+	ChannelId  uint32 // The original channelId in the Packet, could be different from Channel.id.
+}
+type MessageHandlerFunc func(ctx MessageContext)
+type messageMapEntry struct {
+	msg     Message
+	handler MessageHandlerFunc
+}
+
+var MessageMap = map[proto.MessageType]*messageMapEntry{
+	proto.MessageType_AUTH:                {&proto.AuthMessage{}, handleAuth},
+	proto.MessageType_CREATE_CHANNEL:      {&proto.CreateChannelMessage{}, handleCreateChannel},
+	proto.MessageType_REMOVE_CHANNEL:      {&proto.RemoveChannelMessage{}, handleRemoveChannel},
+	proto.MessageType_LIST_CHANNEL:        {&proto.ListChannelMessage{}, handleListChannel},
+	proto.MessageType_SUB_TO_CHANNEL:      {&proto.SubscribedToChannelMessage{}, handleSubToChannel},
+	proto.MessageType_UNSUB_FROM_CHANNEL:  {&proto.UnsubscribedFromChannelMessage{}, handleUnsubFromChannel},
+	proto.MessageType_CHANNEL_DATA_UPDATE: {&proto.ChannelDataUpdateMessage{}, handleChannelDataUpdate},
+	proto.MessageType_DISCONNECT:          {&proto.DisconnectMessage{}, handleDisconnect},
+	proto.MessageType_AUTH_DELEGATION:     {&proto.AuthDelegationResultMessage{}, handleAuthDelegationResult},
+	proto.MessageType_PING:                {&proto.PingMessage{}, handlePing},
+	proto.MessageType_PONG:                {&proto.PongMessage{}, handlePong},
+	proto.MessageType_TRANSFER_OWNERSHIP:  {&proto.TransferOwnershipMessage{}, handleTransferOwnership},
+	proto.MessageType_ERROR:               {&proto.ErrorResultMessage{}, handleErrorResult},
+	proto.MessageType_SPATIAL_INTEREST:    {&proto.SpatialInterestMessage{}, handleSpatialInterest},
+	proto.MessageType_HANDOVER_PREPARE:    {&proto.HandoverPrepareResultMessage{}, handleHandoverPrepareResult},
+	proto.MessageType_HANDOVER_COMMIT:     {&proto.HandoverEventMessage{}, handleHandoverEvent},
+	proto.MessageType_HANDOVER_ROLLBACK:   {&proto.HandoverEventMessage{}, handleHandoverEvent},
+}
+
+func RegisterMessageHandler(msgType uint32, msg Message, handler MessageHandlerFunc) {
+	MessageMap[proto.MessageType(msgType)] = &messageMapEntry{msg, handler}
+}
+
+func handleClientToServerUserMessage(ctx MessageContext) {
+	if ctx.Channel.ownerConnection != nil {
+		ctx.Channel.ownerConnection.Send(ctx)
+	} else if ctx.Broadcast != proto.BroadcastType_NO_BROADCAST {
+		if ctx.Channel.enableClientBroadcast {
+			ctx.Channel.Broadcast(ctx)
+		} else {
+			ctx.Connection.Logger().Error("illegal attempt to broadcast message as the channel's client broadcasting is disabled",
+				zap.Uint32("msgType", uint32(ctx.MsgType)),
+				zap.String("channelType", ctx.Channel.channelType.String()),
+				zap.Uint32("channelId", uint32(ctx.Channel.id)),
+			)
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_FEATURE_DISABLED, "the channel's client broadcasting is disabled")
+		}
+	} else if !ctx.Channel.bufferOwnerlessMessage(ctx, handleClientToServerUserMessage) {
+		ctx.Channel.Logger().Error("channel has no owner to forward the user-space messaged",
+			zap.Uint32("msgType", uint32(ctx.MsgType)),
+			zap.Uint32("connId", uint32(ctx.Connection.id)),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_CHANNEL_OWNER, "the channel has no owner to forward the message to")
+	}
+}
+
+func handleServerToClientUserMessage(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.ServerForwardMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a ServerForwardMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a ServerForwardMessage")
+		return
+	}
+
+	switch ctx.Broadcast {
+	case proto.BroadcastType_NO_BROADCAST:
+		if ctx.Channel.ownerConnection != nil {
+			ctx.Channel.ownerConnection.Send(ctx)
+		} else if !ctx.Channel.bufferOwnerlessMessage(ctx, handleServerToClientUserMessage) {
+			ctx.Connection.Logger().Error("cannot forward the message as the channel has no owner",
+				zap.Uint32("msgType", uint32(ctx.MsgType)),
+				zap.String("channelType", ctx.Channel.channelType.String()),
+				zap.Uint32("channelId", uint32(ctx.Channel.id)),
+			)
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_CHANNEL_OWNER, "the channel has no owner to forward the message to")
+		}
+
+	case proto.BroadcastType_ALL, proto.BroadcastType_ALL_BUT_SENDER:
+		ctx.Channel.Broadcast(ctx)
+
+	case proto.BroadcastType_SINGLE_CONNECTION:
+		clientConn := ctx.Channel.server.GetConnection(ConnectionId(msg.ClientConnId))
+		if clientConn != nil {
+			clientConn.Send(ctx)
+		} else {
+			ctx.Connection.Logger().Error("cannot forward the message as the target connection does not exist",
+				zap.Uint32("msgType", uint32(ctx.MsgType)),
+				zap.Uint32("targetConnId", msg.ClientConnId),
+			)
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the target connection does not exist")
+		}
+	}
+}
+
+func handleAuth(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to authenticate outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should authenticate in the GLOBAL channel")
+		return
+	}
+	msg, ok := ctx.Msg.(*proto.AuthMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("mssage is not a AuthMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a AuthMessage")
+		return
+	}
+	//log.Printf("Auth PIT: %s, LT: %s\n", msg.PlayerIdentifierToken, msg.LoginToken)
+
+	// Reject the AUTH before the previous one is resolved, otherwise the results may arrive out of order, and the failures are miscounted.
+	if !atomic.CompareAndSwapInt32(&ctx.Connection.authPending, 0, 1) {
+		ctx.Connection.Logger().Warn("the previous authentication is still pending")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_MESSAGE_NOT_ALLOWED, "the previous authentication is still pending")
+		return
+	}
+
+	// The authenticator may block, so don't run it in the GLOBAL channel's goroutine.
+	// The result is handled back in the GLOBAL channel.
+	a := s.getAuthenticator(ctx.Connection.connectionType)
+	go func() {
+		result, claims, err := a.Authenticate(ctx.Connection.id, msg.PlayerIdentifierToken, msg.LoginToken)
+		if err != nil {
+			ctx.Connection.Logger().Warn("error authenticating", zap.Error(err))
+		}
+		ctx.Channel.putMessageContext(ctx, func(ctx MessageContext) {
+			onAuthenticated(ctx, result, claims)
+		})
+	}()
+}
+
+func handleCreateChannel(ctx MessageContext) {
+	s := ctx.Channel.server
+	// Only the GLOBAL channel can handle channel creation/deletion/listing
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to create channel outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should create channel in the GLOBAL channel")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.CreateChannelMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a CreateChannelMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a CreateChannelMessage")
+		return
+	}
+
+	if msg.ChannelType == proto.ChannelType_UNKNOWN {
+		ctx.Connection.Logger().Error("illegal attemp to create the UNKNOWN channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_CHANNEL_TYPE, "can't create the UNKNOWN channel")
+		return
+	}
+	if msg.ChannelType == proto.ChannelType_SPATIAL && s.spatialController != nil {
+		// The SPATIAL channels are created by the spatial controller at startup. Creating the channel will attempt to own them.
+		claimSpatialChannels(ctx, msg)
+		return
+	}
+
+	// Channel data should always be initialized
+	var dataMsg Message
+	if msg.Data != nil {
+		var err error
+		dataMsg, err = msg.Data.UnmarshalNew()
+		if err != nil {
+			ctx.Connection.Logger().Error("failed to unmarshal data message for the new channel", zap.Error(err))
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "failed to unmarshal the channel data")
+			return
+		}
+	}
+	initChannel := func(ctx MessageContext) {
+		ctx.Channel.InitData(dataMsg, msg.MergeOptions)
+		// The data in the message is overridden by the snapshot of the channel with the same metadata.
+		ctx.Channel.restoreData()
+		ctx.Channel.sendCreateChannelResult(ctx, msg.SubOptions)
+	}
+
+	if msg.ChannelType == proto.ChannelType_GLOBAL {
+		// Global channel is initially created by the system. Creating the channel will attempt to own it.
+		if s.globalChannel.ownerConnection == nil {
+			s.globalChannel.assignOwner(ctx.Connection)
+			ctx.Connection.Logger().Info("owned the GLOBAL channel")
+			s.globalChannel.flushOwnerlessMessages()
+		} else {
+			ctx.Connection.Logger().Error("illegal attemp to create the GLOBAL channel")
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CHANNEL_ALREADY_EXISTS, "the GLOBAL channel already has an owner")
+			return
+		}
+		// Already in the GLOBAL channel's goroutine
+		s.globalChannel.metadata = msg.Metadata
+		initChannel(ctx)
+		return
+	}
+
+	newChannel, err := s.createChannel(msg.ChannelType, ctx.Connection, msg.Metadata)
+	if err != nil {
+		ctx.Connection.Logger().Error("failed to create channel",
+			zap.Uint32("channelType", uint32(msg.ChannelType)),
+			zap.Error(err),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INTERNAL_ERROR, err.Error())
+		return
+	}
+	newChannel.Logger().Info("created channel with owner", zap.Uint32("ownerConnId", uint32(ctx.Connection.id)))
+	// The data is initialized in the new channel's goroutine, as the channel is already ticking.
+	// The messages to the new channel are queued after the initialization, so they always see the data.
+	newCtx := ctx
+	newCtx.Channel = newChannel
+	newCtx.ChannelId = uint32(newChannel.id)
+	newChannel.putMessageContext(newCtx, initChannel)
+}
+
+// Sends the CreateChannelResultMessage to the creator of the channel (ctx.Connection) and the GLOBAL channel owner,
+// then subscribes the creator to the channel. Called in the channel's goroutine.
+func (ch *Channel) sendCreateChannelResult(ctx MessageContext, subOptions *proto.ChannelSubscriptionOptions) {
+	// Make sure the response message has the channelId = ch.id, not always 0.
+	ctx.ChannelId = uint32(ch.id)
+	ctx.MsgType = proto.MessageType_CREATE_CHANNEL
+	ctx.Msg = &proto.CreateChannelResultMessage{
+		ChannelType: ch.channelType,
+		Metadata:    ch.metadata,
+		OwnerConnId: uint32(ctx.Connection.id),
+	}
+	ctx.Connection.Send(ctx)
+	// Also send the response to the GLOBAL channel owner.
+	if globalOwner := ch.server.globalChannel.getOwner(); globalOwner != ctx.Connection && globalOwner != nil {
+		globalCtx := ctx
+		globalCtx.StubId = 0
+		globalOwner.Send(globalCtx)
+	}
+
+	// Subscribe to channel after creation
+	ctx.Connection.SubscribeToChannel(ch, subOptions)
+	ctx.Connection.sendSubscribed(ctx, ch, ctx.Connection, 0, subOptions)
+}
+
+func handleRemoveChannel(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to remove channel outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should remove channel in the GLOBAL channel")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.RemoveChannelMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a RemoveChannelMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a RemoveChannelMessage")
+		return
+	}
+
+	channelToRemove := s.GetChannel(ChannelId(msg.ChannelId))
+	if channelToRemove == nil {
+		ctx.Connection.Logger().Error("invalid channelId for removing", zap.Uint32("channelId", msg.ChannelId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CHANNEL_NOT_FOUND, "the channel to remove does not exist")
+		return
+	}
+	// Only the channel owner or GLOBAL owner can remove the channel
+	if !ctx.Connection.HasAuthorityOver(channelToRemove) {
+		ownerConnId := uint32(0)
+		if owner := channelToRemove.getOwner(); owner != nil {
+			ownerConnId = uint32(owner.id)
+		}
+		ctx.Connection.Logger().Error("illegal attemp to remove channel as the connection is not the channel owner",
+			zap.String("channelType", channelToRemove.channelType.String()),
+			zap.Uint32("channelId", uint32(channelToRemove.id)),
+			zap.Uint32("ownerConnId", ownerConnId),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the channel owner or the GLOBAL owner can remove the channel")
+		return
+	}
+
+	for connId := range channelToRemove.subscribedConnections {
+		sc := s.GetConnection(connId)
+		if sc != nil {
+			//sc.sendUnsubscribed(ctx, channelToRemove, 0)
+			respond := ctx
+			respond.StubId = 0
+			sc.Send(respond)
+		}
+	}
+	RemoveChannel(channelToRemove)
+
+	ctx.Connection.Logger().Info("removed channel",
+		zap.String("channelType", channelToRemove.channelType.String()),
+		zap.Uint32("channelId", uint32(channelToRemove.id)),
+		zap.Int("subs", len(channelToRemove.subscribedConnections)),
+	)
+}
+
+func handleListChannel(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to list channel outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should list channel in the GLOBAL channel")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.ListChannelMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a ListChannelMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a ListChannelMessage")
+		return
+	}
+
+	result := make([]*proto.ListChannelResultMessage_ChannelInfo, 0)
+	s.allChannels.Range(func(k interface{}, v interface{}) bool {
+		channel := v.(*Channel)
+		if msg.TypeFilter != proto.ChannelType_UNKNOWN && msg.TypeFilter != channel.channelType {
+			return true
+		}
+		matched := len(msg.MetadataFilters) == 0
+		for _, keyword := range msg.MetadataFilters {
+			if strings.Contains(channel.metadata, keyword) {
+				matched = true
+				break
+			}
+		}
+		if matched {
+			result = append(result, &proto.ListChannelResultMessage_ChannelInfo{
+				ChannelId:   uint32(channel.id),
+				ChannelType: channel.channelType,
+				Metadata:    channel.metadata,
+			})
+		}
+		return true
+	})
+
+	ctx.Msg = &proto.ListChannelResultMessage{
+		Channels: result,
+	}
+	ctx.Connection.Send(ctx)
+}
+
+func handleSubToChannel(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.SubscribedToChannelMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a SubscribedToChannelMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a SubscribedToChannelMessage")
+		return
+	}
+
+	// The connection that subscribes. Could be different to the connection that sends the message.
+	connToSub := ctx.Channel.server.GetConnection(ConnectionId(msg.ConnId))
+	if connToSub == nil {
+		ctx.Connection.Logger().Error("invalid ConnectionId for sub", zap.Uint32("connId", msg.ConnId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the connection to sub does not exist")
+		return
+	}
+
+	if connToSub.id != ctx.Connection.id && !ctx.Connection.HasAuthorityOver(ctx.Channel) {
+		ctx.Connection.Logger().Error("illegal attemp to sub another connection as the sender has no authority",
+			zap.Uint32("subConnId", msg.ConnId),
+			zap.String("channelType", ctx.Channel.channelType.String()),
+			zap.Uint32("channelId", uint32(ctx.Channel.id)),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the channel owner or the GLOBAL owner can sub another connection")
+		return
+	}
+
+	cs, exists := ctx.Channel.subscribedConnections[connToSub.id]
+	if exists {
+		ctx.Connection.Logger().Info("already subscribed to channel, the subscription options will be merged",
+			zap.String("channelType", ctx.Channel.channelType.String()),
+			zap.Uint32("channelId", uint32(ctx.Channel.id)),
+		)
+		if msg.SubOptions != nil {
+			writeFieldMasks, connIdKeyedMapFields, rejectWriteViolation := cs.options.WriteFieldMasks, cs.options.ConnIdKeyedMapFields, cs.options.RejectWriteViolation
+			protobuf.Merge(&cs.options, msg.SubOptions)
+			// Only the connection that has authority over the channel can change the write permissions.
+			if !ctx.Connection.HasAuthorityOver(ctx.Channel) {
+				cs.options.WriteFieldMasks = writeFieldMasks
+				cs.options.ConnIdKeyedMapFields = connIdKeyedMapFields
+				cs.options.RejectWriteViolation = rejectWriteViolation
+			}
+		}
+		// Do not send the SubscribedToChannelResultMessage if already subed.
+		return
+	}
+
+	connToSub.SubscribeToChannel(ctx.Channel, msg.SubOptions)
+
+	// Notify the sender.
+	ctx.Connection.sendSubscribed(ctx, ctx.Channel, connToSub, ctx.StubId, msg.SubOptions)
+
+	// Notify the subscribed (if not the sender).
+	if connToSub != ctx.Connection {
+		connToSub.sendSubscribed(ctx, ctx.Channel, connToSub, 0, msg.SubOptions)
+	}
+	// Notify the channel owner.
+	if ctx.Channel.ownerConnection != ctx.Connection && ctx.Channel.ownerConnection != nil {
+		ctx.Channel.ownerConnection.sendSubscribed(ctx, ctx.Channel, connToSub, 0, msg.SubOptions)
+	}
+}
+
+func handleUnsubFromChannel(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.UnsubscribedFromChannelMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a UnsubscribedFromChannelMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a UnsubscribedFromChannelMessage")
+		return
+	}
+
+	// The connection that unsubscribes. Could be different to the connection that sends the message.
+	connToUnsub := ctx.Channel.server.GetConnection(ConnectionId(msg.ConnId))
+	if connToUnsub == nil {
+		ctx.Connection.Logger().Error("invalid ConnectionId for unsub", zap.Uint32("connId", msg.ConnId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the connection to unsub does not exist")
+		return
+	}
+
+	if connToUnsub.id != ctx.Connection.id && !ctx.Connection.HasAuthorityOver(ctx.Channel) {
+		ctx.Connection.Logger().Error("illegal attemp to unsub another connection as the sender has no authority",
+			zap.Uint32("unsubConnId", msg.ConnId),
+			zap.String("channelType", ctx.Channel.channelType.String()),
+			zap.Uint32("channelId", uint32(ctx.Channel.id)),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the channel owner or the GLOBAL owner can unsub another connection")
+		return
+	}
+
+	err := connToUnsub.UnsubscribeFromChannel(ctx.Channel)
+	if err != nil {
+		ctx.Connection.Logger().Error("failed to unsub from channel",
+			zap.String("channelType", ctx.Channel.channelType.String()),
+			zap.Uint32("channelId", uint32(ctx.Channel.id)),
+			zap.Error(err),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NOT_SUBSCRIBED, err.Error())
+		return
+	}
+
+	// Notify the sender.
+	ctx.Connection.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, ctx.StubId)
+
+	// Notify the unsubscribed.
+	if connToUnsub != ctx.Connection {
+		connToUnsub.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, 0)
+	}
+	// Notify the channel owner.
+	if ctx.Channel.ownerConnection != nil {
+		if ctx.Channel.ownerConnection == connToUnsub {
+			// Reset the owner if it unsubscribed
+			ctx.Channel.onOwnerLost()
+		} else if ctx.Channel.ownerConnection != ctx.Connection {
+			ctx.Channel.ownerConnection.sendUnsubscribed(ctx, ctx.Channel, connToUnsub, 0)
+		}
+	}
+}
+
+func handleChannelDataUpdate(ctx MessageContext) {
+	// Only channel owner or writable subsciptors can update the data
+	var writePermission *dataWritePermission
+	var rejectWriteViolation bool
+	if ctx.Channel.ownerConnection != ctx.Connection {
+		cs := ctx.Channel.subscribedConnections[ctx.Connection.id]
+		if cs == nil || !cs.options.CanUpdateData {
+			ctx.Connection.Logger().Error("attempt to update channel data but has no access",
+				zap.String("channelType", ctx.Channel.channelType.String()),
+				zap.Uint32("channelId", uint32(ctx.Channel.id)),
+			)
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRITE_PERMISSION_DENIED, "no access to update the channel data")
+			return
+		}
+		writePermission = newDataWritePermission(cs)
+		rejectWriteViolation = cs.options.RejectWriteViolation
+	}
+
+	if ctx.Channel.Data() == nil {
+		ctx.Channel.Logger().Info("channel data is not initialized - should send CreateChannelMessage before ChannelDataUpdateMessage",
+			zap.Uint32("connId", uint32(ctx.Connection.id)))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CHANNEL_DATA_NOT_INITIALIZED, "the channel data is not initialized")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.ChannelDataUpdateMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a ChannelDataUpdateMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a ChannelDataUpdateMessage")
+		return
+	}
+	updateMsg, err := msg.Data.UnmarshalNew()
+	if err != nil {
+		ctx.Connection.Logger().Error("failed to unmarshal channel update data", zap.Error(err))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "failed to unmarshal the channel data")
+		return
+	}
+
+	if writePermission != nil {
+		if denied := writePermission.check(updateMsg, !rejectWriteViolation); len(denied) > 0 {
+			ctx.Connection.Logger().Warn("attempt to update the channel data fields that have no access",
+				zap.String("channelType", ctx.Channel.channelType.String()),
+				zap.Uint32("channelId", uint32(ctx.Channel.id)),
+				zap.Strings("fields", denied),
+				zap.Bool("rejected", rejectWriteViolation),
+			)
+			if rejectWriteViolation {
+				ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRITE_PERMISSION_DENIED,
+					"update rejected as it has no access to: "+strings.Join(denied, ", "))
+				return
+			}
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRITE_PERMISSION_DENIED,
+				"update stripped as it has no access to: "+strings.Join(denied, ", "))
+			// Nothing left to update
+			if protobuf.Size(updateMsg) == 0 {
+				return
+			}
+		}
+	}
+
+	if ctx.Channel.channelType == proto.ChannelType_SPATIAL {
+		if spatialMsg, ok := updateMsg.(*proto.SpatialChannelDataMessage); ok {
+			ctx.Channel.dropHandoverEntities(spatialMsg)
+			// Should be called before the moved entities are marked as removed.
+			ctx.Channel.updateSpatialInterests(spatialMsg)
+			ctx.Channel.moveSpatialEntities(ctx, spatialMsg)
+		}
+	}
+
+	ctx.Channel.applyDataUpdate(ctx.Connection, updateMsg)
+}
+
+func handleDisconnect(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to disconnect another connection outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should disconnect in the GLOBAL channel")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.DisconnectMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a DisconnectMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a DisconnectMessage")
+		return
+	}
+
+	connToDisconnect := s.GetConnection(ConnectionId(msg.ConnId))
+	if connToDisconnect == nil {
+		ctx.Connection.Logger().Warn("could not find the connection to disconnect",
+			zap.Uint32("targetConnId", msg.ConnId),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the connection to disconnect does not exist")
+		return
+	}
+
+	if err := connToDisconnect.Disconnect(); err != nil {
+		ctx.Connection.Logger().Warn("failed to disconnect a connection",
+			zap.Uint32("targetConnId", msg.ConnId),
+			zap.String("targetConnType", connToDisconnect.connectionType.String()),
+		)
+	} else {
+		ctx.Connection.Logger().Info("successfully disconnected a connection",
+			zap.Uint32("targetConnId", msg.ConnId),
+			zap.String("targetConnType", connToDisconnect.connectionType.String()),
+		)
+	}
+	RemoveConnection(connToDisconnect)
+}
@@ -1,110 +1,192 @@
-package channeld
-
-import (
-	"strings"
-	"time"
-
-	"github.com/prometheus/client_golang/prometheus"
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
-)
-
-var logger *zap.Logger
-
-var msgReceived = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "messages_in",
-		Help: "Received messages",
-	},
-	[]string{"connType" /*, "channel", "msgType"*/},
-)
-
-var msgSent = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "messages_out",
-		Help: "Sent messages",
-	},
-	[]string{"connType" /*, "channel", "msgType"*/},
-)
-var packetReceived = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "packets_in",
-		Help: "Received packets",
-	},
-	[]string{"connType"},
-)
-
-var packetSent = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "packets_out",
-		Help: "Sent packets",
-	},
-	[]string{"connType"},
-)
-
-var bytesReceived = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "bytes_in",
-		Help: "Received bytes",
-	},
-	[]string{"connType"},
-)
-
-var bytesSent = prometheus.NewCounterVec(
-	prometheus.CounterOpts{
-		Name: "bytes_out",
-		Help: "Sent bytes",
-	},
-	[]string{"connType"},
-)
-
-var connectionNum = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "connection_num",
-		Help: "Number of connections",
-	},
-	[]string{"type"},
-)
-
-var channelNum = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "channel_num",
-		Help: "Number of channels",
-	},
-	[]string{"type"},
-)
-
-var channelTickDuration = prometheus.NewGaugeVec(
-	prometheus.GaugeOpts{
-		Name: "channel_tick_duration",
-		Help: "How long it takes to Channel.Tick()",
-	},
-	[]string{"type"},
-)
-
-func InitLogsAndMetrics() {
-	var cfg zap.Config
-	if GlobalSettings.Development {
-		cfg = zap.NewDevelopmentConfig()
-	} else {
-		cfg = zap.NewProductionConfig()
-	}
-	if GlobalSettings.LogLevel.HasValue {
-		cfg.Level = zap.NewAtomicLevelAt(zapcore.Level(GlobalSettings.LogLevel.Value))
-	}
-	if GlobalSettings.LogFile.HasValue {
-		cfg.OutputPaths = append(cfg.OutputPaths, strings.ReplaceAll(GlobalSettings.LogFile.Value, "{time}", time.Now().Format("20060102150405")))
-	}
-	logger, _ = cfg.Build()
-	defer logger.Sync()
-
-	prometheus.MustRegister(msgReceived)
-	prometheus.MustRegister(msgSent)
-	prometheus.MustRegister(packetReceived)
-	prometheus.MustRegister(packetSent)
-	prometheus.MustRegister(bytesReceived)
-	prometheus.MustRegister(bytesSent)
-	prometheus.MustRegister(connectionNum)
-	prometheus.MustRegister(channelNum)
-	prometheus.MustRegister(channelTickDuration)
-}
+package channeld
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// The logger created by InitLogsAndMetrics, which is also the default server's logger.
+var logger *zap.Logger
+
+// The metrics are process-wide, shared by all the servers in the process.
+var registerMetricsOnce sync.Once
+
+var msgReceived = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "messages_in",
+		Help: "Received messages",
+	},
+	[]string{"connType" /*, "channel", "msgType"*/},
+)
+
+var msgSent = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "messages_out",
+		Help: "Sent messages",
+	},
+	[]string{"connType" /*, "channel", "msgType"*/},
+)
+var packetReceived = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "packets_in",
+		Help: "Received packets",
+	},
+	[]string{"connType"},
+)
+
+var packetSent = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "packets_out",
+		Help: "Sent packets",
+	},
+	[]string{"connType"},
+)
+
+var bytesReceived = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytes_in",
+		Help: "Received bytes",
+	},
+	[]string{"connType"},
+)
+
+var bytesSent = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "bytes_out",
+		Help: "Sent bytes",
+	},
+	[]string{"connType"},
+)
+
+var connectionNum = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "connection_num",
+		Help: "Number of connections",
+	},
+	[]string{"type"},
+)
+
+var connectionDetachedNum = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "connection_detached_num",
+		Help: "Number of connections waiting to be resumed",
+	},
+	[]string{"type"},
+)
+
+var connectionIdleRemoved = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "connection_idle_removed",
+		Help: "Connections removed for being idle longer than the timeout",
+	},
+	[]string{"type"},
+)
+
+var connectionFsmTimeouts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "connection_fsm_timeouts",
+		Help: "FSM states of the connections that timed out",
+	},
+	[]string{"type", "state"},
+)
+
+var connectionRtt = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "connection_rtt",
+		Help:    "Round-trip time of the connections in milliseconds",
+		Buckets: []float64{1, 5, 10, 20, 50, 100, 200, 500, 1000},
+	},
+	[]string{"type"},
+)
+
+var channelNum = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "channel_num",
+		Help: "Number of channels",
+	},
+	[]string{"type"},
+)
+
+var channelTickDuration = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "channel_tick_duration",
+		Help: "How long it takes to Channel.Tick()",
+	},
+	[]string{"type"},
+)
+
+var fanOutResynced = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "fan_out_resynced",
+		Help: "Number of the whole channel data sent to the connections that fell behind the update buffer",
+	},
+	[]string{"type"},
+)
+
+var channelOwnerFailover = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "channel_owner_failover",
+		Help: "Number of standby owners taking over the lost channel owners",
+	},
+	[]string{"type"},
+)
+
+var channelSnapshotTaken = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "channel_snapshot_taken",
+		Help: "Number of the channel data snapshots taken",
+	},
+	[]string{"channelType"},
+)
+
+var spatialRebalanced = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "spatial_rebalanced",
+		Help: "Number of the spatial regions split or merged by the load balancing",
+	},
+	[]string{"op"},
+)
+
+func InitLogsAndMetrics() {
+	var cfg zap.Config
+	if GlobalSettings.Development {
+		cfg = zap.NewDevelopmentConfig()
+	} else {
+		cfg = zap.NewProductionConfig()
+	}
+	if GlobalSettings.LogLevel.HasValue {
+		cfg.Level = zap.NewAtomicLevelAt(zapcore.Level(GlobalSettings.LogLevel.Value))
+	}
+	if GlobalSettings.LogFile.HasValue {
+		cfg.OutputPaths = append(cfg.OutputPaths, strings.ReplaceAll(GlobalSettings.LogFile.Value, "{time}", time.Now().Format("20060102150405")))
+	}
+	logger, _ = cfg.Build()
+	defer logger.Sync()
+	defaultServer.logger = logger
+
+	// The tests call InitLogsAndMetrics() multiple times, but the collectors can only be registered once.
+	registerMetricsOnce.Do(func() {
+		prometheus.MustRegister(msgReceived)
+		prometheus.MustRegister(msgSent)
+		prometheus.MustRegister(packetReceived)
+		prometheus.MustRegister(packetSent)
+		prometheus.MustRegister(bytesReceived)
+		prometheus.MustRegister(bytesSent)
+		prometheus.MustRegister(connectionNum)
+		prometheus.MustRegister(connectionDetachedNum)
+		prometheus.MustRegister(connectionIdleRemoved)
+		prometheus.MustRegister(connectionFsmTimeouts)
+		prometheus.MustRegister(connectionRtt)
+		prometheus.MustRegister(channelNum)
+		prometheus.MustRegister(channelTickDuration)
+		prometheus.MustRegister(fanOutResynced)
+		prometheus.MustRegister(channelOwnerFailover)
+		prometheus.MustRegister(spatialRebalanced)
+		prometheus.MustRegister(channelSnapshotTaken)
+	})
+}
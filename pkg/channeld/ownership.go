@@ -0,0 +1,149 @@
+package channeld
+
+import (
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+func handleTransferOwnership(ctx MessageContext) {
+	msg, ok := ctx.Msg.(*proto.TransferOwnershipMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a TransferOwnershipMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a TransferOwnershipMessage")
+		return
+	}
+
+	if !ctx.Connection.HasAuthorityOver(ctx.Channel) {
+		ctx.Connection.Logger().Error("illegal attemp to transfer the ownership as the connection is not the channel owner or the GLOBAL owner",
+			zap.String("channelType", ctx.Channel.channelType.String()),
+			zap.Uint32("channelId", uint32(ctx.Channel.id)),
+		)
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_NO_AUTHORITY, "only the channel owner or the GLOBAL owner can transfer the ownership")
+		return
+	}
+
+	var newOwner *Connection
+	if msg.NewOwnerConnId != 0 {
+		newOwner = ctx.Channel.server.GetConnection(ConnectionId(msg.NewOwnerConnId))
+		if newOwner == nil || newOwner.IsRemoving() {
+			ctx.Connection.Logger().Error("invalid ConnectionId for the new owner", zap.Uint32("newOwnerConnId", msg.NewOwnerConnId))
+			ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the new owner does not exist")
+			return
+		}
+	}
+
+	if msg.ClearStandbyOwners {
+		ctx.Channel.standbyOwners = nil
+	}
+	if len(msg.StandbyOwnerConnIds) > 0 {
+		ctx.Channel.standbyOwners = make([]ConnectionId, len(msg.StandbyOwnerConnIds))
+		for i, connId := range msg.StandbyOwnerConnIds {
+			ctx.Channel.standbyOwners[i] = ConnectionId(connId)
+		}
+		ctx.Channel.Logger().Info("set standby owners", zap.Uint32s("connIds", msg.StandbyOwnerConnIds))
+	}
+
+	if newOwner != nil {
+		ctx.Channel.setOwner(newOwner, false)
+	}
+}
+
+// Sets the owner of the channel, subscribes the new owner to the channel if not yet, notifies the connections in the channel
+// and the GLOBAL owner, then forwards the messages buffered while the channel had no owner.
+// Called in the channel's goroutine.
+func (ch *Channel) setOwner(newOwner *Connection, failover bool) {
+	s := ch.server
+	oldOwner := ch.ownerConnection
+	if oldOwner == newOwner {
+		return
+	}
+	ch.assignOwner(newOwner)
+
+	msg := &proto.OwnershipChangedMessage{
+		Failover:    failover,
+		ChannelType: ch.channelType,
+	}
+	if oldOwner != nil {
+		msg.OldOwnerConnId = uint32(oldOwner.id)
+	}
+	ctx := MessageContext{
+		MsgType:    proto.MessageType_TRANSFER_OWNERSHIP,
+		Msg:        msg,
+		Connection: newOwner,
+		Channel:    ch,
+		ChannelId:  uint32(ch.id),
+	}
+	if newOwner != nil {
+		msg.NewOwnerConnId = uint32(newOwner.id)
+		if _, exists := ch.subscribedConnections[newOwner.id]; !exists {
+			newOwner.SubscribeToChannel(ch, nil)
+			newOwner.sendSubscribed(ctx, ch, newOwner, 0, &ch.subscribedConnections[newOwner.id].options)
+		}
+	}
+
+	globalOwner := s.globalChannel.getOwner()
+	globalOwnerNotified := false
+	for connId := range ch.subscribedConnections {
+		c := ch.server.GetConnection(connId)
+		if c == nil {
+			continue
+		}
+		c.Send(ctx)
+		if c == globalOwner {
+			globalOwnerNotified = true
+		}
+	}
+	if !globalOwnerNotified && globalOwner != nil {
+		globalOwner.Send(ctx)
+	}
+
+	ch.Logger().Info("channel ownership changed",
+		zap.Uint32("oldOwnerConnId", msg.OldOwnerConnId),
+		zap.Uint32("newOwnerConnId", msg.NewOwnerConnId),
+		zap.Bool("failover", failover),
+	)
+
+	if newOwner != nil {
+		ch.flushOwnerlessMessages()
+	}
+}
+
+// Promotes the first standby owner that is still connected, or leaves the channel without owner.
+// Called in the channel's goroutine.
+func (ch *Channel) onOwnerLost() {
+	for len(ch.standbyOwners) > 0 {
+		c := ch.server.GetConnection(ch.standbyOwners[0])
+		ch.standbyOwners = ch.standbyOwners[1:]
+		if c != nil && !c.IsRemoving() && c != ch.ownerConnection {
+			channelOwnerFailover.WithLabelValues(ch.channelType.String()).Inc()
+			ch.setOwner(c, true)
+			return
+		}
+	}
+	ch.setOwner(nil, false)
+}
+
+// Buffers the message to the owner until the channel has an owner again.
+// Returns false if the buffer is full or disabled (see ChannelSettingsType.OwnerlessBufferSize).
+func (ch *Channel) bufferOwnerlessMessage(ctx MessageContext, handler MessageHandlerFunc) bool {
+	if len(ch.ownerlessMessages) >= int(ch.server.GetChannelSettings(ch.channelType).OwnerlessBufferSize) {
+		return false
+	}
+	ch.ownerlessMessages = append(ch.ownerlessMessages, channelMessage{ctx: ctx, handler: handler})
+	return true
+}
+
+func (ch *Channel) flushOwnerlessMessages() {
+	if len(ch.ownerlessMessages) == 0 {
+		return
+	}
+	messages := ch.ownerlessMessages
+	ch.ownerlessMessages = nil
+	ch.Logger().Info("forwarding the messages buffered while the channel had no owner", zap.Int("num", len(messages)))
+	for _, cm := range messages {
+		if cm.ctx.Connection.IsRemoving() {
+			continue
+		}
+		cm.handler(cm.ctx)
+	}
+}
@@ -0,0 +1,97 @@
+package channeld
+
+import (
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferOwnership(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	owner := addTestConnection(proto.ConnectionType_SERVER)
+	standby1 := addTestConnection(proto.ConnectionType_SERVER)
+	standby2 := addTestConnection(proto.ConnectionType_SERVER)
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	ch, _ := CreateChannel(proto.ChannelType_SUBWORLD, owner)
+	owner.SubscribeToChannel(ch, nil)
+	client.SubscribeToChannel(ch, nil)
+
+	transfer := func(sender *Connection, msg *proto.TransferOwnershipMessage) {
+		handleTransferOwnership(MessageContext{
+			MsgType:    proto.MessageType_TRANSFER_OWNERSHIP,
+			Msg:        msg,
+			Connection: sender,
+			Channel:    ch,
+			ChannelId:  uint32(ch.id),
+		})
+	}
+	ownershipChanged := func(c *Connection) *proto.OwnershipChangedMessage {
+		for i := len(c.testQueue()) - 1; i >= 0; i-- {
+			if msg, ok := c.testQueue()[i].(*proto.OwnershipChangedMessage); ok {
+				return msg
+			}
+		}
+		return nil
+	}
+
+	// Only the owner or the GLOBAL owner can transfer the ownership.
+	transfer(client, &proto.TransferOwnershipMessage{NewOwnerConnId: uint32(client.id)})
+	assert.Equal(t, owner, ch.getOwner())
+
+	transfer(owner, &proto.TransferOwnershipMessage{StandbyOwnerConnIds: []uint32{uint32(standby1.id), uint32(standby2.id)}})
+	assert.Equal(t, owner, ch.getOwner())
+	assert.Equal(t, []ConnectionId{standby1.id, standby2.id}, ch.standbyOwners)
+
+	transfer(owner, &proto.TransferOwnershipMessage{NewOwnerConnId: uint32(standby2.id)})
+	assert.Equal(t, standby2, ch.getOwner())
+	// The new owner is subscribed
+	assert.Contains(t, ch.subscribedConnections, standby2.id)
+	changed := ownershipChanged(client)
+	assert.EqualValues(t, owner.id, changed.OldOwnerConnId)
+	assert.EqualValues(t, standby2.id, changed.NewOwnerConnId)
+	assert.False(t, changed.Failover)
+	assert.NotNil(t, ownershipChanged(owner))
+	assert.NotNil(t, ownershipChanged(standby2))
+
+	// Fail over to the first standby owner
+	RemoveConnection(standby2)
+	assert.Eventually(t, func() bool { return ch.getOwner() == standby1 }, time.Second, 10*time.Millisecond)
+	changed = ownershipChanged(client)
+	assert.EqualValues(t, standby2.id, changed.OldOwnerConnId)
+	assert.EqualValues(t, standby1.id, changed.NewOwnerConnId)
+	assert.True(t, changed.Failover)
+
+	// No standby owner left. The messages to the owner are buffered.
+	RemoveConnection(standby1)
+	assert.Eventually(t, func() bool { return ch.getOwner() == nil }, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 0, ownershipChanged(client).NewOwnerConnId)
+
+	forwardMsg := &proto.ServerForwardMessage{Payload: []byte("hello")}
+	ch.PutMessage(forwardMsg, handleClientToServerUserMessage, client, &proto.MessagePack{
+		ChannelId: uint32(ch.id),
+		MsgType:   uint32(proto.MessageType_USER_SPACE_START),
+	})
+	assert.Eventually(t, func() bool {
+		done := make(chan bool)
+		ch.putMessageContext(MessageContext{Connection: client}, func(ctx MessageContext) {
+			done <- len(ch.ownerlessMessages) == 1
+		})
+		return <-done
+	}, time.Second, 10*time.Millisecond)
+
+	// The GLOBAL owner can set the owner of any channel.
+	globalOwner := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(defaultServer.globalChannel, globalOwner)
+	defer setTestChannelOwner(defaultServer.globalChannel, nil)
+	newOwner := addTestConnection(proto.ConnectionType_SERVER)
+	ch.putMessageContext(MessageContext{Connection: globalOwner}, func(ctx MessageContext) {
+		transfer(globalOwner, &proto.TransferOwnershipMessage{NewOwnerConnId: uint32(newOwner.id)})
+	})
+	assert.Eventually(t, func() bool { return newOwner.latestMsg() == forwardMsg }, time.Second, 10*time.Millisecond)
+	assert.Equal(t, newOwner, ch.getOwner())
+	assert.NotNil(t, ownershipChanged(globalOwner))
+}
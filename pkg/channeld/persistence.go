@@ -0,0 +1,490 @@
+package channeld
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	bolt "go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Stores the snapshots of the channel data. The key is made of the channel type and the metadata,
+// so a channel that is re-created with the same metadata (e.g. after channeld restarts) can restore its data.
+type ChannelDataStore interface {
+	Save(key string, data *anypb.Any) error
+	// Returns nil data and nil error if the key doesn't exist.
+	Load(key string) (*anypb.Any, error)
+	Delete(key string) error
+	Close() error
+}
+
+type persistenceTask struct {
+	key string
+	// Saves the snapshot, and then truncates the write-ahead log if the snapshot is saved.
+	snapshot    *anypb.Any
+	truncateLog bool
+	// Appends the record to the write-ahead log.
+	logRecord *proto.ChannelDataLogRecord
+	// Closes the write-ahead log file, e.g. when the channel is removed.
+	closeLog bool
+	// Flushes the appended log records of all the channels to the disk.
+	syncLog bool
+}
+
+// Creates the channel data store of the default server from GlobalSettings.ChannelDataStore. Does nothing if it's not specified.
+func InitChannelDataStore() error {
+	return defaultServer.InitChannelDataStore()
+}
+
+func (s *Server) InitChannelDataStore() error {
+	store, err := newChannelDataStore(s.Settings.ChannelDataStore, s.Settings.ChannelDataStorePath)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return nil
+	}
+	var log *channelDataLogWriter
+	if s.Settings.ChannelDataLogDir != "" {
+		log, err = newChannelDataLogWriter(s.Settings.ChannelDataLogDir)
+		if err != nil {
+			store.Close()
+			return err
+		}
+	}
+	s.startPersistenceWriter(store, log)
+
+	s.logger.Info("initialized channel data store",
+		zap.String("store", s.Settings.ChannelDataStore),
+		zap.String("path", s.Settings.ChannelDataStorePath),
+		zap.String("logDir", s.Settings.ChannelDataLogDir),
+	)
+	return nil
+}
+
+func (s *Server) startPersistenceWriter(store ChannelDataStore, log *channelDataLogWriter) {
+	// The channels may be ticking already.
+	s.persistenceQueueLock.Lock()
+	s.channelDataStore = store
+	s.channelDataLog = log
+	s.persistenceQueued = sync.NewCond(&s.persistenceQueueLock)
+	s.persistenceQueueLock.Unlock()
+
+	syncInterval := time.Duration(s.Settings.ChannelDataLogSyncIntervalMs) * time.Millisecond
+	stopSync := make(chan struct{})
+	if log != nil && syncInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(syncInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.queuePersistenceTask(persistenceTask{syncLog: true})
+				case <-stopSync:
+					return
+				}
+			}
+		}()
+	}
+
+	s.persistenceWriterDone.Add(1)
+	go func() {
+		defer s.persistenceWriterDone.Done()
+		defer close(stopSync)
+		for {
+			s.persistenceQueueLock.Lock()
+			for len(s.persistenceTasks) == 0 && s.channelDataStore != nil {
+				s.persistenceQueued.Wait()
+			}
+			tasks := s.persistenceTasks
+			s.persistenceTasks = nil
+			// No task is queued after the store is closed, so the taken tasks are the last ones.
+			closed := s.channelDataStore == nil
+			s.persistenceQueueLock.Unlock()
+
+			for _, task := range tasks {
+				s.doPersistenceTask(store, log, task)
+			}
+			// Group commit: the records appended in the same batch are flushed at once.
+			if log != nil && syncInterval <= 0 {
+				if err := log.sync(); err != nil {
+					s.logger.Error("failed to flush the channel data log", zap.Error(err))
+				}
+			}
+			if closed {
+				break
+			}
+		}
+		if log != nil {
+			// The dirty files are flushed before they are closed.
+			log.closeAll()
+		}
+	}()
+}
+
+func (s *Server) doPersistenceTask(store ChannelDataStore, log *channelDataLogWriter, task persistenceTask) {
+	if task.snapshot != nil {
+		if err := store.Save(task.key, task.snapshot); err != nil {
+			s.logger.Error("failed to save the channel data snapshot", zap.String("key", task.key), zap.Error(err))
+			// Keep the log, as the updates are not in any snapshot yet.
+			return
+		}
+	}
+	if log == nil {
+		return
+	}
+	if task.truncateLog {
+		if err := log.truncate(task.key); err != nil {
+			s.logger.Error("failed to truncate the channel data log", zap.String("key", task.key), zap.Error(err))
+		}
+	}
+	if task.logRecord != nil {
+		if err := log.append(task.key, task.logRecord); err != nil {
+			s.logger.Error("failed to append to the channel data log", zap.String("key", task.key), zap.Error(err))
+		}
+	}
+	if task.closeLog {
+		log.close(task.key)
+	}
+	if task.syncLog {
+		if err := log.sync(); err != nil {
+			s.logger.Error("failed to flush the channel data log", zap.Error(err))
+		}
+	}
+}
+
+// Returns false if the store is closed.
+func (s *Server) queuePersistenceTask(task persistenceTask) bool {
+	s.persistenceQueueLock.Lock()
+	defer s.persistenceQueueLock.Unlock()
+	if s.channelDataStore == nil {
+		return false
+	}
+	s.persistenceTasks = append(s.persistenceTasks, task)
+	s.persistenceQueued.Signal()
+	return true
+}
+
+// Returns the store and the write-ahead log writer, which are set and cleared in other goroutines. They are nil if closed.
+func (s *Server) getChannelDataStore() (ChannelDataStore, *channelDataLogWriter) {
+	s.persistenceQueueLock.RLock()
+	defer s.persistenceQueueLock.RUnlock()
+	return s.channelDataStore, s.channelDataLog
+}
+
+// Waits for the queued snapshots and log records to be written, and then closes the store of the default server.
+func CloseChannelDataStore() error {
+	return defaultServer.CloseChannelDataStore()
+}
+
+func (s *Server) CloseChannelDataStore() error {
+	s.persistenceQueueLock.Lock()
+	store := s.channelDataStore
+	if store == nil {
+		s.persistenceQueueLock.Unlock()
+		return nil
+	}
+	s.channelDataStore = nil
+	s.channelDataLog = nil
+	s.persistenceQueued.Signal()
+	s.persistenceQueueLock.Unlock()
+
+	s.persistenceWriterDone.Wait()
+	return store.Close()
+}
+
+func newChannelDataStore(storeType string, path string) (ChannelDataStore, error) {
+	switch storeType {
+	case "", "none":
+		return nil, nil
+	case "file":
+		return NewFileChannelDataStore(path)
+	case "bolt":
+		return NewBoltChannelDataStore(path)
+	default:
+		return nil, fmt.Errorf("unknown channel data store: %s", storeType)
+	}
+}
+
+func channelDataKey(channelType proto.ChannelType, metadata string) string {
+	return channelType.String() + "/" + metadata
+}
+
+// The channel without metadata can't be told apart from the others of the same type, so it's not persistent.
+// Should be called in the channel's goroutine.
+func (ch *Channel) isPersistent() bool {
+	if ch.metadata == "" {
+		return false
+	}
+	store, _ := ch.server.getChannelDataStore()
+	return store != nil && ch.server.GetChannelSettings(ch.channelType).Persistent && ch.claimDataKey()
+}
+
+// Claims the data key for the channel, so no other channel saves to or restores from the same key while the channel exists.
+// The channel that fails to claim is never persistent, otherwise its data would overwrite the data of the holder after the holder is removed.
+func (ch *Channel) claimDataKey() bool {
+	if ch.dataKeyClaimed {
+		return true
+	}
+	if ch.dataKeyRejected {
+		return false
+	}
+	if holder, loaded := ch.server.channelDataKeys.LoadOrStore(ch.dataKey(), ch.id); loaded {
+		ch.Logger().Warn("the channel is not persistent as another channel has the same metadata",
+			zap.String("key", ch.dataKey()),
+			zap.Uint32("holderChannelId", uint32(holder.(ChannelId))),
+		)
+		ch.dataKeyRejected = true
+		return false
+	}
+	ch.dataKeyClaimed = true
+	return true
+}
+
+// Should be called in the channel's goroutine, after the final snapshot is queued.
+func (ch *Channel) releaseDataKey() {
+	if ch.dataKeyClaimed {
+		ch.server.channelDataKeys.Delete(ch.dataKey())
+		ch.dataKeyClaimed = false
+	}
+}
+
+// Should be called in the channel's goroutine.
+func (ch *Channel) tickSnapshot(now time.Time) {
+	if !ch.isPersistent() {
+		return
+	}
+	interval := time.Duration(ch.server.GetChannelSettings(ch.channelType).SnapshotIntervalMs) * time.Millisecond
+	if interval <= 0 || now.Sub(ch.lastSnapshotTime) < interval {
+		return
+	}
+	ch.takeSnapshot(now)
+}
+
+// Queues the snapshot of the channel data to be saved, if the data has changed since the last snapshot.
+// Should be called in the channel's goroutine.
+func (ch *Channel) takeSnapshot(now time.Time) {
+	if ch.data == nil || ch.data.msg == nil {
+		return
+	}
+	ch.lastSnapshotTime = now
+	if ch.data.updateMsgBuffer.nextSeq == ch.lastSnapshotSeq {
+		return
+	}
+
+	anyData, err := anypb.New(ch.data.msg)
+	if err != nil {
+		ch.Logger().Error("failed to marshal the channel data snapshot", zap.Error(err))
+		return
+	}
+	ch.lastSnapshotSeq = ch.data.updateMsgBuffer.nextSeq
+	if ch.server.queuePersistenceTask(persistenceTask{key: ch.dataKey(), snapshot: anyData, truncateLog: true}) {
+		channelSnapshotTaken.WithLabelValues(ch.channelType.String()).Inc()
+	}
+}
+
+func (ch *Channel) dataKey() string {
+	return channelDataKey(ch.channelType, ch.metadata)
+}
+
+// Replaces the channel data with the latest snapshot of the channel that has the same type and metadata,
+// and then replays the write-ahead log on top of it if enabled.
+// Returns false if the channel is not persistent, or there's nothing to restore.
+func (ch *Channel) restoreData() bool {
+	if !ch.isPersistent() {
+		return false
+	}
+	restored := ch.loadSnapshot()
+	if ch.isLoggingData() {
+		if ch.server.GetChannelSettings(ch.channelType).ReplayWriteAheadLog {
+			if ch.replayDataLog() > 0 {
+				restored = true
+			}
+		} else {
+			// The records are not replayed, so they should not be replayed after the next restart either.
+			ch.server.queuePersistenceTask(persistenceTask{key: ch.dataKey(), truncateLog: true})
+		}
+	}
+	return restored
+}
+
+func (ch *Channel) loadSnapshot() bool {
+	key := ch.dataKey()
+	store, _ := ch.server.getChannelDataStore()
+	if store == nil {
+		return false
+	}
+	anyData, err := store.Load(key)
+	if err != nil {
+		ch.Logger().Error("failed to load the channel data snapshot", zap.String("key", key), zap.Error(err))
+		return false
+	}
+	if anyData == nil {
+		return false
+	}
+	dataMsg, err := anyData.UnmarshalNew()
+	if err != nil {
+		ch.Logger().Error("failed to unmarshal the channel data snapshot", zap.String("key", key), zap.Error(err))
+		return false
+	}
+	if ch.data != nil && ch.data.msg != nil && ch.data.msg.ProtoReflect().Descriptor() != dataMsg.ProtoReflect().Descriptor() {
+		ch.Logger().Error("the type of the channel data snapshot mismatches",
+			zap.String("key", key),
+			zap.String("snapshotType", string(dataMsg.ProtoReflect().Descriptor().FullName())),
+		)
+		return false
+	}
+
+	var mergeOptions *proto.ChannelDataMergeOptions
+	if ch.data != nil {
+		mergeOptions = ch.data.mergeOptions
+	}
+	ch.InitData(dataMsg, mergeOptions)
+	// The restored data doesn't need to be saved again until it's updated.
+	ch.lastSnapshotSeq = ch.data.updateMsgBuffer.nextSeq
+	ch.lastSnapshotTime = time.Now()
+	ch.Logger().Info("restored channel data from the snapshot", zap.String("key", key))
+	return true
+}
+
+// Saves each snapshot in a file under the directory. The file name is the escaped key.
+type FileChannelDataStore struct {
+	dir string
+}
+
+func NewFileChannelDataStore(dir string) (*FileChannelDataStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the channel data directory: %w", err)
+	}
+	return &FileChannelDataStore{dir: dir}, nil
+}
+
+func (s *FileChannelDataStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".snapshot")
+}
+
+func (s *FileChannelDataStore) Save(key string, data *anypb.Any) error {
+	bytes, err := protobuf.Marshal(data)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file first, so a crash in the middle doesn't corrupt the last snapshot.
+	// The file is flushed to the disk before it replaces the last snapshot, as the write-ahead log is truncated after saving.
+	tmpPath := s.path(key) + ".tmp"
+	f, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(bytes)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, s.path(key))
+}
+
+func (s *FileChannelDataStore) Load(key string) (*anypb.Any, error) {
+	bytes, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	data := &anypb.Any{}
+	if err := protobuf.Unmarshal(bytes, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *FileChannelDataStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (s *FileChannelDataStore) Close() error {
+	return nil
+}
+
+var boltChannelDataBucket = []byte("channel_data")
+
+// Saves the snapshots in an embedded bbolt database file.
+type BoltChannelDataStore struct {
+	db *bolt.DB
+}
+
+func NewBoltChannelDataStore(path string) (*BoltChannelDataStore, error) {
+	if dir := filepath.Dir(path); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create the channel data directory: %w", err)
+		}
+	}
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the channel data database: %w", err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltChannelDataBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltChannelDataStore{db: db}, nil
+}
+
+func (s *BoltChannelDataStore) Save(key string, data *anypb.Any) error {
+	bytes, err := protobuf.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltChannelDataBucket).Put([]byte(key), bytes)
+	})
+}
+
+func (s *BoltChannelDataStore) Load(key string) (*anypb.Any, error) {
+	var data *anypb.Any
+	err := s.db.View(func(tx *bolt.Tx) error {
+		bytes := tx.Bucket(boltChannelDataBucket).Get([]byte(key))
+		if bytes == nil {
+			return nil
+		}
+		// The bytes are only valid in the transaction.
+		data = &anypb.Any{}
+		return protobuf.Unmarshal(bytes, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *BoltChannelDataStore) Delete(key string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltChannelDataBucket).Delete([]byte(key))
+	})
+}
+
+func (s *BoltChannelDataStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,234 @@
+package channeld
+
+import (
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func testChannelDataStore(t *testing.T, store ChannelDataStore) {
+	data, err := store.Load("SUBWORLD/a")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+
+	anyData, _ := anypb.New(&proto.TestChannelDataMessage{Text: "a", Num: 1})
+	assert.NoError(t, store.Save("SUBWORLD/a", anyData))
+	anyData, _ = anypb.New(&proto.TestChannelDataMessage{Text: "b", Num: 2})
+	assert.NoError(t, store.Save("SUBWORLD/b/../c", anyData))
+	// Overwrite
+	anyData, _ = anypb.New(&proto.TestChannelDataMessage{Text: "aa", Num: 11})
+	assert.NoError(t, store.Save("SUBWORLD/a", anyData))
+
+	data, err = store.Load("SUBWORLD/a")
+	assert.NoError(t, err)
+	msg, err := data.UnmarshalNew()
+	assert.NoError(t, err)
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "aa", Num: 11}, msg))
+
+	data, err = store.Load("SUBWORLD/b/../c")
+	assert.NoError(t, err)
+	msg, _ = data.UnmarshalNew()
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "b", Num: 2}, msg))
+
+	assert.NoError(t, store.Delete("SUBWORLD/a"))
+	data, err = store.Load("SUBWORLD/a")
+	assert.NoError(t, err)
+	assert.Nil(t, data)
+	// Deleting the missing key is not an error
+	assert.NoError(t, store.Delete("SUBWORLD/a"))
+
+	assert.NoError(t, store.Close())
+}
+
+func TestFileChannelDataStore(t *testing.T) {
+	store, err := NewFileChannelDataStore(filepath.Join(t.TempDir(), "channels"))
+	assert.NoError(t, err)
+	testChannelDataStore(t, store)
+}
+
+func TestBoltChannelDataStore(t *testing.T) {
+	store, err := NewBoltChannelDataStore(filepath.Join(t.TempDir(), "channels.db"))
+	assert.NoError(t, err)
+	testChannelDataStore(t, store)
+}
+
+func setTestChannelDataStore(t *testing.T, storeType string, path string) {
+	GlobalSettings.ChannelDataStore = storeType
+	GlobalSettings.ChannelDataStorePath = path
+	assert.NoError(t, InitChannelDataStore())
+}
+
+// Sets the settings of the SUBWORLD channel type for the test. Returns the function to reset the settings.
+func setTestSubworldSettings(settings ChannelSettingsType) func() {
+	oldSettings, exists := GlobalSettings.ChannelSettings[proto.ChannelType_SUBWORLD]
+	GlobalSettings.ChannelSettings[proto.ChannelType_SUBWORLD] = settings
+	return func() {
+		if exists {
+			GlobalSettings.ChannelSettings[proto.ChannelType_SUBWORLD] = oldSettings
+		} else {
+			delete(GlobalSettings.ChannelSettings, proto.ChannelType_SUBWORLD)
+		}
+	}
+}
+
+// Blocks the saving until unblocked.
+type blockingChannelDataStore struct {
+	FileChannelDataStore
+	unblock chan struct{}
+	saved   int32
+}
+
+func (s *blockingChannelDataStore) Save(key string, data *anypb.Any) error {
+	<-s.unblock
+	atomic.AddInt32(&s.saved, 1)
+	return nil
+}
+
+// The channel goroutines should not be blocked by the slow store.
+func TestPersistenceQueueNotBlocking(t *testing.T) {
+	s := NewServer(newTestServerSettings(), zap.NewNop())
+	store := &blockingChannelDataStore{unblock: make(chan struct{})}
+	s.startPersistenceWriter(store, nil)
+
+	anyData, _ := anypb.New(&proto.TestChannelDataMessage{Text: "a"})
+	queued := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			s.queuePersistenceTask(persistenceTask{key: "SUBWORLD/a", snapshot: anyData})
+		}
+		close(queued)
+	}()
+	select {
+	case <-queued:
+	case <-time.After(time.Second):
+		assert.Fail(t, "queuing the tasks is blocked by the store")
+	}
+
+	// The queued tasks are still done before the store is closed.
+	close(store.unblock)
+	assert.NoError(t, s.CloseChannelDataStore())
+	assert.EqualValues(t, 1000, atomic.LoadInt32(&store.saved))
+	assert.False(t, s.queuePersistenceTask(persistenceTask{key: "SUBWORLD/a", snapshot: anyData}))
+}
+
+func createTestSubworldChannel(owner *Connection, metadata string) *Channel {
+	dataAny, _ := anypb.New(&proto.TestChannelDataMessage{Text: "initial"})
+	handleCreateChannel(MessageContext{
+		MsgType:    proto.MessageType_CREATE_CHANNEL,
+		Msg:        &proto.CreateChannelMessage{ChannelType: proto.ChannelType_SUBWORLD, Metadata: metadata, Data: dataAny},
+		Connection: owner,
+		Channel:    defaultServer.globalChannel,
+	})
+	// The new channel has the largest id.
+	ch := GetChannel(defaultServer.nextChannelId - 1)
+	// The data is initialized in the channel's goroutine before it's frozen.
+	freezeTestChannel(ch)
+	return ch
+}
+
+func TestRestoreChannelData(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	defer setTestSubworldSettings(ChannelSettingsType{
+		// Prevent the channel goroutine from taking snapshots
+		TickIntervalMs:          3600000,
+		DefaultFanOutIntervalMs: 20,
+		Persistent:              true,
+		SnapshotIntervalMs:      1000,
+	})()
+	path := filepath.Join(t.TempDir(), "channels.db")
+	setTestChannelDataStore(t, "bolt", path)
+	defer func() {
+		CloseChannelDataStore()
+		GlobalSettings.ChannelDataStore = ""
+	}()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	createChannel := func(metadata string) *Channel {
+		return createTestSubworldChannel(server, metadata)
+	}
+	ch := createChannel("room1")
+	// Nothing to restore yet
+	assert.Equal(t, "initial", ch.data.msg.(*proto.TestChannelDataMessage).Text)
+
+	now := time.Now().Add(time.Second)
+	// The initial data is saved in the first snapshot
+	ch.tickSnapshot(now)
+	assert.EqualValues(t, 1, ch.lastSnapshotSeq)
+
+	ch.data.OnUpdate(&proto.TestChannelDataMessage{Text: "updated", Num: 1}, ch.GetTime())
+	// Not changed before the interval
+	ch.tickSnapshot(now.Add(500 * time.Millisecond))
+	assert.EqualValues(t, 1, ch.lastSnapshotSeq)
+	ch.tickSnapshot(now.Add(1000 * time.Millisecond))
+	assert.EqualValues(t, 2, ch.lastSnapshotSeq)
+
+	// The data is not changed, so no snapshot is taken.
+	ch.tickSnapshot(now.Add(2000 * time.Millisecond))
+	assert.EqualValues(t, 2, ch.lastSnapshotSeq)
+
+	// The final snapshot before the removal
+	ch.data.OnUpdate(&proto.TestChannelDataMessage{Num: 2}, ch.GetTime())
+	ch.takeSnapshot(now.Add(2500 * time.Millisecond))
+	RemoveChannel(ch)
+
+	// Restart channeld
+	assert.NoError(t, CloseChannelDataStore())
+	InitChannels()
+	setTestChannelDataStore(t, "bolt", path)
+
+	server = addTestConnection(proto.ConnectionType_SERVER)
+	ch = createChannel("room1")
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "updated", Num: 2}, ch.data.msg))
+	// The restored data is not saved again until it's updated.
+	assert.Equal(t, ch.data.updateMsgBuffer.nextSeq, ch.lastSnapshotSeq)
+
+	// The channel with different metadata is not restored.
+	room1 := ch
+	ch = createChannel("room2")
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "initial"}, ch.data.msg))
+
+	// Another channel with the same metadata neither restores nor saves the data of the existing one.
+	ch = createChannel("room1")
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "initial"}, ch.data.msg))
+	assert.False(t, ch.isPersistent())
+	// Nor does the channel without metadata.
+	assert.False(t, createChannel("").isPersistent())
+
+	// The data key is released after the channel is removed.
+	RemoveChannel(room1)
+	assert.Eventually(t, func() bool {
+		_, claimed := defaultServer.channelDataKeys.Load(room1.dataKey())
+		return !claimed
+	}, time.Second, 10*time.Millisecond)
+	ch = createChannel("room1")
+	assert.True(t, ch.isPersistent())
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "updated", Num: 2}, ch.data.msg))
+}
+
+func TestNonPersistentChannelData(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	setTestChannelDataStore(t, "file", t.TempDir())
+	defer func() {
+		CloseChannelDataStore()
+		GlobalSettings.ChannelDataStore = ""
+	}()
+
+	ch, _ := CreateChannel(proto.ChannelType_TEST, nil)
+	freezeTestChannel(ch)
+	ch.InitData(&proto.TestChannelDataMessage{Text: "a"}, nil)
+	assert.False(t, ch.isPersistent())
+	ch.tickSnapshot(time.Now().Add(time.Hour))
+	assert.EqualValues(t, 0, ch.lastSnapshotSeq)
+	assert.False(t, ch.restoreData())
+}
@@ -0,0 +1,216 @@
+package channeld
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+// Appends the accepted channel data updates to a file per channel, so the updates since the last snapshot
+// can be replayed after channeld crashes. Each record is the size (uvarint) followed by the marshalled ChannelDataLogRecord.
+// The appended records are not durable until sync() is called, so the records written together are flushed to the disk at once.
+// Only accessed in the persistence goroutine, except for reading the log when the channel is restored.
+type channelDataLogWriter struct {
+	dir   string
+	files map[string]*os.File
+	// The keys of the files that have been written since the last sync.
+	dirty map[string]bool
+}
+
+func newChannelDataLogWriter(dir string) (*channelDataLogWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create the channel data log directory: %w", err)
+	}
+	return &channelDataLogWriter{dir: dir, files: make(map[string]*os.File), dirty: make(map[string]bool)}, nil
+}
+
+func (l *channelDataLogWriter) path(key string) string {
+	return filepath.Join(l.dir, url.PathEscape(key)+".wal")
+}
+
+func (l *channelDataLogWriter) append(key string, record *proto.ChannelDataLogRecord) error {
+	f, exists := l.files[key]
+	if !exists {
+		var err error
+		f, err = os.OpenFile(l.path(key), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		l.files[key] = f
+	}
+
+	bytes, err := protobuf.Marshal(record)
+	if err != nil {
+		return err
+	}
+	l.dirty[key] = true
+	return writeSizePrefixed(f, bytes)
+}
+
+// Flushes the files that have been written since the last sync to the disk.
+func (l *channelDataLogWriter) sync() error {
+	var firstErr error
+	for key := range l.dirty {
+		if err := l.files[key].Sync(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to sync the channel data log %s: %w", key, err)
+		}
+		delete(l.dirty, key)
+	}
+	return firstErr
+}
+
+// Writes the size (uvarint) and the marshalled record at once, so a crash leaves at most one incomplete record at the end.
+func writeSizePrefixed(w io.Writer, bytes []byte) error {
+	buf := make([]byte, binary.MaxVarintLen64, binary.MaxVarintLen64+len(bytes))
+	n := binary.PutUvarint(buf, uint64(len(bytes)))
+	_, err := w.Write(append(buf[:n], bytes...))
+	return err
+}
+
+// Reads the size-prefixed records in order, until the end or onRecord returns an error.
+// The incomplete record at the end (e.g. channeld crashed while writing it) is ignored.
+func readSizePrefixed(r io.Reader, onRecord func(bytes []byte) error) error {
+	reader := bufio.NewReader(r)
+	for {
+		size, err := binary.ReadUvarint(reader)
+		if err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		bytes := make([]byte, size)
+		if _, err := io.ReadFull(reader, bytes); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return nil
+			}
+			return err
+		}
+		if err := onRecord(bytes); err != nil {
+			return err
+		}
+	}
+}
+
+func (l *channelDataLogWriter) truncate(key string) error {
+	if f, exists := l.files[key]; exists {
+		// The file is opened with O_APPEND, so the following records are written from the start.
+		l.dirty[key] = true
+		return f.Truncate(0)
+	}
+	err := os.Truncate(l.path(key), 0)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+func (l *channelDataLogWriter) close(key string) {
+	if f, exists := l.files[key]; exists {
+		if l.dirty[key] {
+			f.Sync()
+			delete(l.dirty, key)
+		}
+		f.Close()
+		delete(l.files, key)
+	}
+}
+
+func (l *channelDataLogWriter) closeAll() {
+	for key := range l.files {
+		l.close(key)
+	}
+}
+
+// Reads the records in order. The incomplete record at the end (e.g. channeld crashed while writing it) is ignored.
+func readChannelDataLog(path string) ([]*proto.ChannelDataLogRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	records := make([]*proto.ChannelDataLogRecord, 0)
+	err = readSizePrefixed(f, func(bytes []byte) error {
+		record := &proto.ChannelDataLogRecord{}
+		if err := protobuf.Unmarshal(bytes, record); err != nil {
+			return err
+		}
+		records = append(records, record)
+		return nil
+	})
+	return records, err
+}
+
+func (ch *Channel) isLoggingData() bool {
+	_, log := ch.server.getChannelDataStore()
+	return log != nil && ch.isPersistent() && ch.server.GetChannelSettings(ch.channelType).WriteAheadLog
+}
+
+// Queues the accepted update to be appended to the write-ahead log. Should be called in the channel's goroutine.
+func (ch *Channel) logDataUpdate(sender *Connection, updateMsg Message) {
+	if !ch.isLoggingData() {
+		return
+	}
+	anyData, err := anypb.New(updateMsg)
+	if err != nil {
+		ch.Logger().Error("failed to marshal the channel data log record", zap.Error(err))
+		return
+	}
+	record := &proto.ChannelDataLogRecord{
+		ChannelId:   uint32(ch.id),
+		ChannelTime: int64(ch.GetTime()),
+		Data:        anyData,
+	}
+	if sender != nil {
+		record.SenderConnId = uint32(sender.id)
+	}
+	ch.server.queuePersistenceTask(persistenceTask{key: ch.dataKey(), logRecord: record})
+}
+
+// Applies the updates in the write-ahead log to the channel data. Returns the number of the applied records.
+func (ch *Channel) replayDataLog() int {
+	_, log := ch.server.getChannelDataStore()
+	if log == nil {
+		return 0
+	}
+	path := log.path(ch.dataKey())
+	records, err := readChannelDataLog(path)
+	if err != nil {
+		// Still replay the records before the corrupted one.
+		ch.Logger().Error("failed to read the channel data log", zap.String("path", path), zap.Error(err))
+	}
+	if len(records) == 0 {
+		return 0
+	}
+	if ch.data == nil {
+		ch.InitData(nil, nil)
+	}
+
+	replayed := 0
+	for _, record := range records {
+		updateMsg, err := record.Data.UnmarshalNew()
+		if err != nil {
+			ch.Logger().Error("failed to unmarshal the channel data log record", zap.Error(err))
+			continue
+		}
+		ch.data.OnUpdate(updateMsg, ch.GetTime())
+		replayed++
+	}
+	// The replayed records are truncated after the next snapshot.
+	ch.Logger().Info("replayed the channel data log", zap.String("path", path), zap.Int("records", replayed))
+	return replayed
+}
@@ -0,0 +1,218 @@
+package channeld
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestChannelDataLogWriter(t *testing.T) {
+	log, err := newChannelDataLogWriter(t.TempDir())
+	assert.NoError(t, err)
+	path := log.path("SUBWORLD/a")
+
+	records, err := readChannelDataLog(path)
+	assert.NoError(t, err)
+	assert.Empty(t, records)
+
+	for i := 1; i <= 3; i++ {
+		anyData, _ := anypb.New(&proto.TestChannelDataMessage{Num: uint32(i)})
+		assert.NoError(t, log.append("SUBWORLD/a", &proto.ChannelDataLogRecord{ChannelId: 1, ChannelTime: int64(i), SenderConnId: 2, Data: anyData}))
+	}
+	records, err = readChannelDataLog(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.EqualValues(t, 3, records[2].ChannelTime)
+	assert.EqualValues(t, 2, records[2].SenderConnId)
+	// The appended records are flushed at once.
+	assert.True(t, log.dirty["SUBWORLD/a"])
+	assert.NoError(t, log.sync())
+	assert.Empty(t, log.dirty)
+
+	// The incomplete record at the end is ignored.
+	log.close("SUBWORLD/a")
+	stat, _ := os.Stat(path)
+	assert.NoError(t, os.Truncate(path, stat.Size()-1))
+	records, err = readChannelDataLog(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// The records are appended after the truncation.
+	assert.NoError(t, log.truncate("SUBWORLD/a"))
+	anyData, _ := anypb.New(&proto.TestChannelDataMessage{Num: 4})
+	assert.NoError(t, log.append("SUBWORLD/a", &proto.ChannelDataLogRecord{ChannelTime: 4, Data: anyData}))
+	assert.NoError(t, log.truncate("SUBWORLD/a"))
+	anyData, _ = anypb.New(&proto.TestChannelDataMessage{Num: 5})
+	assert.NoError(t, log.append("SUBWORLD/a", &proto.ChannelDataLogRecord{ChannelTime: 5, Data: anyData}))
+	records, err = readChannelDataLog(path)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.EqualValues(t, 5, records[0].ChannelTime)
+
+	log.closeAll()
+	assert.Empty(t, log.files)
+	assert.Empty(t, log.dirty)
+}
+
+func TestReplayChannelDataLog(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	settings := ChannelSettingsType{
+		// Prevent the channel goroutine from taking snapshots
+		TickIntervalMs:          3600000,
+		DefaultFanOutIntervalMs: 20,
+		Persistent:              true,
+		SnapshotIntervalMs:      1000,
+		WriteAheadLog:           true,
+		ReplayWriteAheadLog:     true,
+	}
+	defer setTestSubworldSettings(settings)()
+	dir := t.TempDir()
+	GlobalSettings.ChannelDataLogDir = filepath.Join(dir, "wal")
+	setTestChannelDataStore(t, "file", filepath.Join(dir, "channels"))
+	defer func() {
+		CloseChannelDataStore()
+		GlobalSettings.ChannelDataStore = ""
+		GlobalSettings.ChannelDataLogDir = ""
+	}()
+	logPath := defaultServer.channelDataLog.path(channelDataKey(proto.ChannelType_SUBWORLD, "room1"))
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	ch := createTestSubworldChannel(server, "room1")
+	update := func(updateMsg Message) {
+		anyData, _ := anypb.New(updateMsg)
+		handleChannelDataUpdate(MessageContext{
+			MsgType:    proto.MessageType_CHANNEL_DATA_UPDATE,
+			Msg:        &proto.ChannelDataUpdateMessage{Data: anyData},
+			Connection: server,
+			Channel:    ch,
+			ChannelId:  uint32(ch.id),
+		})
+	}
+	update(&proto.TestChannelDataMessage{Text: "a"})
+	// The log is truncated after the snapshot.
+	ch.takeSnapshot(time.Now())
+	update(&proto.TestChannelDataMessage{Text: "b"})
+	update(&proto.TestChannelDataMessage{Num: 2})
+
+	// Crash without taking the final snapshot
+	assert.NoError(t, CloseChannelDataStore())
+	records, err := readChannelDataLog(logPath)
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.EqualValues(t, ch.id, records[0].ChannelId)
+	assert.EqualValues(t, server.id, records[0].SenderConnId)
+	assert.LessOrEqual(t, records[0].ChannelTime, records[1].ChannelTime)
+
+	InitChannels()
+	setTestChannelDataStore(t, "file", filepath.Join(dir, "channels"))
+	server = addTestConnection(proto.ConnectionType_SERVER)
+	ch = createTestSubworldChannel(server, "room1")
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "b", Num: 2}, ch.data.msg))
+	// The replayed data should be saved in the next snapshot.
+	assert.NotEqual(t, ch.data.updateMsgBuffer.nextSeq, ch.lastSnapshotSeq)
+	ch.takeSnapshot(time.Now())
+	update(&proto.TestChannelDataMessage{Num: 3})
+	assert.NoError(t, CloseChannelDataStore())
+	records, _ = readChannelDataLog(logPath)
+	assert.Len(t, records, 1)
+
+	// Disable the replay. The log is truncated when the channel is restored.
+	settings.ReplayWriteAheadLog = false
+	GlobalSettings.ChannelSettings[proto.ChannelType_SUBWORLD] = settings
+	InitChannels()
+	setTestChannelDataStore(t, "file", filepath.Join(dir, "channels"))
+	server = addTestConnection(proto.ConnectionType_SERVER)
+	ch = createTestSubworldChannel(server, "room1")
+	assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "b", Num: 2}, ch.data.msg))
+	assert.NoError(t, CloseChannelDataStore())
+	records, _ = readChannelDataLog(logPath)
+	assert.Empty(t, records)
+}
+
+// The entity moved into the SPATIAL channel by channeld is logged as well, otherwise it's lost if channeld crashes before the next snapshot.
+func TestLogMovedSpatialEntity(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	oldSettings, exists := GlobalSettings.ChannelSettings[proto.ChannelType_SPATIAL]
+	GlobalSettings.ChannelSettings[proto.ChannelType_SPATIAL] = ChannelSettingsType{
+		TickIntervalMs:          10,
+		DefaultFanOutIntervalMs: 20,
+		Persistent:              true,
+		WriteAheadLog:           true,
+	}
+	dir := t.TempDir()
+	GlobalSettings.ChannelDataLogDir = filepath.Join(dir, "wal")
+	setTestChannelDataStore(t, "file", filepath.Join(dir, "channels"))
+	defer func() {
+		CloseChannelDataStore()
+		GlobalSettings.ChannelDataStore = ""
+		GlobalSettings.ChannelDataLogDir = ""
+		// Stop the SPATIAL channels from reading the settings.
+		InitChannels()
+		if exists {
+			GlobalSettings.ChannelSettings[proto.ChannelType_SPATIAL] = oldSettings
+		} else {
+			delete(GlobalSettings.ChannelSettings, proto.ChannelType_SPATIAL)
+		}
+	}()
+
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, err := controller.CreateChannels()
+	assert.NoError(t, err)
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	for _, ch := range channels {
+		setTestChannelOwner(ch, server)
+	}
+
+	update := func(x float64) {
+		anyData, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{1: {Loc: &proto.Location{X: x}}},
+		})
+		channels[0].PutMessage(&proto.ChannelDataUpdateMessage{Data: anyData}, handleChannelDataUpdate, server, &proto.MessagePack{
+			ChannelId: uint32(channels[0].id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	update(5)
+	// Move to the second cell
+	update(15)
+	assert.Eventually(t, func() bool {
+		moved := false
+		executeAndWait(channels[1], func(ch *Channel) {
+			moved = ch.data.msg.(*proto.SpatialChannelDataMessage).Entities[1] != nil
+		})
+		return moved
+	}, time.Second, 10*time.Millisecond)
+	assert.NoError(t, CloseChannelDataStore())
+
+	logDir := filepath.Join(dir, "wal")
+	records, err := readChannelDataLog(filepath.Join(logDir, url.PathEscape(channels[0].dataKey())+".wal"))
+	assert.NoError(t, err)
+	if assert.Len(t, records, 2) {
+		assert.EqualValues(t, server.id, records[1].SenderConnId)
+	}
+	records, err = readChannelDataLog(filepath.Join(logDir, url.PathEscape(channels[1].dataKey())+".wal"))
+	assert.NoError(t, err)
+	if assert.Len(t, records, 1) {
+		assert.EqualValues(t, 0, records[0].SenderConnId)
+		data, err := records[0].Data.UnmarshalNew()
+		assert.NoError(t, err)
+		assert.EqualValues(t, 15, data.(*proto.SpatialChannelDataMessage).Entities[1].Loc.X)
+	}
+}
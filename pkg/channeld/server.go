@@ -0,0 +1,308 @@
+package channeld
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// Server owns the state of a channeld instance: the channels, the connections, the FSM templates, the authenticator,
+// the channel data store, the spatial controller and the captures. Multiple servers can run in the same process,
+// e.g. in the tests, as long as they listen on different addresses.
+// The package-level functions (InitChannels, CreateChannel, GetConnection, StartListening, ...) operate on the default server.
+// The Prometheus metrics are not per server: they have no label of the server, so they add up all the servers in the process.
+type Server struct {
+	// Accessed atomically, so it's the first field to be 64-bit aligned.
+	nextConnectionId uint64
+
+	Settings *GlobalSettingsType
+	logger   *zap.Logger
+	// Guards Settings.ChannelSettings, as it can be replaced by reloading the settings.
+	channelSettingsLock sync.RWMutex
+
+	nextChannelId ChannelId
+	allChannels   sync.Map // map[ChannelId]*Channel
+	globalChannel *Channel
+	// Every channel's tick goroutine, so Shutdown can wait for the final snapshots.
+	channelsRunning sync.WaitGroup
+
+	allConnections sync.Map // map[ConnectionId]*Connection
+	serverFsm      fsm.FiniteStateMachine
+	clientFsm      fsm.FiniteStateMachine
+	// Guards serverFsm and clientFsm, as they can be replaced by reloading the settings.
+	fsmTemplatesLock sync.RWMutex
+	resumeTokens     sync.Map // map[string]*Connection
+	// Guards the transitions between attached, detached and removed, as they can happen in the receiving goroutines and the expiry timers.
+	resumeLock     sync.Mutex
+	authenticator  Authenticator
+	trustedOrigins []string
+	upgrader       websocket.Upgrader
+	// The authenticator of the server connections. Nil means the same as authenticator.
+	serverAuthenticator Authenticator
+
+	listeningConnTypes sync.Map // map[proto.ConnectionType]bool
+	listeners          map[proto.ConnectionType]net.Listener
+	listenersLock      sync.Mutex
+
+	channelDataStore ChannelDataStore
+	channelDataLog   *channelDataLogWriter
+	// The data keys that are claimed by the existing persistent channels.
+	channelDataKeys sync.Map // map[string]ChannelId
+	// The snapshots and the write-ahead logs are written in a single goroutine, so the channel goroutines are not blocked by the IO,
+	// and the tasks of the same channel are done in order (e.g. the log records accepted after the snapshot are not truncated).
+	// The queue is unbounded, so queuing never blocks the channel goroutines even if the writer falls behind.
+	persistenceTasks      []persistenceTask
+	persistenceWriterDone sync.WaitGroup
+	// Guards the tasks, the store and the log writer. Prevents the task from being queued while the store is being closed.
+	persistenceQueueLock sync.RWMutex
+	// Signaled when a task is queued or the store is closed.
+	persistenceQueued *sync.Cond
+
+	spatialController SpatialController
+	// The server connections that have attempted to own the SPATIAL channels. The ones that own no channel are idle.
+	spatialServers   sync.Map // map[ConnectionId]*Connection
+	spatialInterests sync.Map // map[uint32]*spatialInterest, indexed by the entity id
+	nextHandoverId   uint32
+	pendingHandovers sync.Map // map[uint32]*spatialHandover
+
+	captures map[uint32]*packetCapture
+	// Guards captures. The recording only takes the read lock.
+	capturesLock sync.RWMutex
+	// The number of the captures, to skip the lock when nothing is being captured.
+	activeCaptures int32
+	nextCaptureId  uint32
+
+	// Closed by Shutdown to stop the background goroutines, e.g. the heartbeat and the settings reloading.
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Creates a server with the settings. A nil logger means the logs are discarded.
+// The server does nothing until Start is called, or its Init* methods are called one by one.
+func NewServer(settings *GlobalSettingsType, logger *zap.Logger) *Server {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+	s := &Server{
+		Settings:      settings,
+		logger:        logger,
+		nextChannelId: GlobalChannelId,
+		authenticator: &noAuthenticator{},
+		listeners:     make(map[proto.ConnectionType]net.Listener),
+		captures:      make(map[uint32]*packetCapture),
+		done:          make(chan struct{}),
+	}
+	s.upgrader = websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool {
+			if s.trustedOrigins == nil {
+				return true
+			}
+			for _, addr := range s.trustedOrigins {
+				if addr == r.RemoteAddr {
+					return true
+				}
+			}
+			return false
+		},
+	}
+	return s
+}
+
+// The server that the package-level functions operate on. It uses GlobalSettings, and the logger created by InitLogsAndMetrics.
+var defaultServer = NewServer(&GlobalSettings, nil)
+
+func DefaultServer() *Server {
+	return defaultServer
+}
+
+func (s *Server) Logger() *zap.Logger {
+	return s.logger
+}
+
+// Initializes the server in the same order as the package-level Init* functions, and starts listening for the server
+// and the client connections. Returns once the listeners are up; the connections are accepted in the background.
+func (s *Server) Start(ctx context.Context) error {
+	if err := s.InitConnections(s.Settings.ServerFSM, s.Settings.ClientFSM); err != nil {
+		return err
+	}
+	if err := s.InitAuthenticator(); err != nil {
+		return fmt.Errorf("failed to initialize the authenticator: %w", err)
+	}
+	if err := s.InitChannelDataStore(); err != nil {
+		return fmt.Errorf("failed to initialize the channel data store: %w", err)
+	}
+	s.InitChannels()
+	if err := s.InitSpatialController(); err != nil {
+		return fmt.Errorf("failed to initialize the spatial controller: %w", err)
+	}
+	s.InitHeartbeat()
+	s.InitSettingsReload()
+
+	// FIXME: After all the server connections are established, the client connection should be listened.
+	for _, l := range []struct {
+		t       proto.ConnectionType
+		network string
+		address string
+	}{
+		{proto.ConnectionType_SERVER, s.Settings.ServerNetwork, s.Settings.ServerAddress},
+		{proto.ConnectionType_CLIENT, s.Settings.ClientNetwork, s.Settings.ClientAddress},
+	} {
+		listener, err := s.listen(ctx, l.t, l.network, l.address)
+		if err != nil {
+			// Stop what has been started, e.g. the other listener and the channels.
+			s.Shutdown(ctx)
+			return fmt.Errorf("failed to listen for the %s connections: %w", l.t, err)
+		}
+		go s.serve(l.t, l.network, listener)
+	}
+	return nil
+}
+
+// Returns the address of the listener of the connection type, or nil if it's not listening.
+// Useful when the server listens on port 0.
+func (s *Server) ListenAddr(t proto.ConnectionType) net.Addr {
+	s.listenersLock.Lock()
+	defer s.listenersLock.Unlock()
+	if listener, exists := s.listeners[t]; exists {
+		return listener.Addr()
+	}
+	return nil
+}
+
+func (s *Server) isShuttingDown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Server) closeListeners() {
+	s.listenersLock.Lock()
+	listeners := s.listeners
+	s.listeners = make(map[proto.ConnectionType]net.Listener)
+	s.listenersLock.Unlock()
+	for _, listener := range listeners {
+		listener.Close()
+	}
+}
+
+// The reason in the DISCONNECT notice that is sent to the connections when the server shuts down.
+const ShutdownReason = "channeld is shutting down"
+
+// Stops the server in order:
+//  1. Closes the listeners, so no new connection is accepted.
+//  2. Sends the DISCONNECT notice (with Settings.ReconnectAddress) to the client connections, and removes them once their send queues are flushed.
+//  3. Sends the DISCONNECT notice to the server connections, and waits for Settings.ShutdownSaveWindowMs, or until they all disconnect,
+//     so the channel owners can save their states while the channels are still running.
+//  4. Removes the channels, and waits for them to take the final snapshots if the persistence is configured.
+//  5. Removes the server connections once their send queues are flushed.
+//  6. Stops the captures, and closes the authenticator and the channel data store.
+//
+// If the context is done before the connections are flushed or the channels stop, the remaining steps are done without waiting,
+// and the context's error is returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.stopOnce.Do(func() {
+		close(s.done)
+	})
+	s.closeListeners()
+	s.logger.Info("shutting down")
+
+	clients := s.getConnections(proto.ConnectionType_CLIENT)
+	for _, c := range clients {
+		c.disconnectWithNotice(ShutdownReason, s.Settings.ReconnectAddress)
+	}
+	err := waitConnectionsFlushed(ctx, clients)
+
+	servers := s.getConnections(proto.ConnectionType_SERVER)
+	for _, c := range servers {
+		c.sendDisconnectNotice(ShutdownReason, s.Settings.ReconnectAddress)
+	}
+	saveCtx, cancelSave := context.WithTimeout(ctx, time.Duration(s.Settings.ShutdownSaveWindowMs)*time.Millisecond)
+	waitConnectionsRemoved(saveCtx, servers)
+	cancelSave()
+
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		// The channel with a full queue is left running if the context is done first.
+		v.(*Channel).executeContext(ctx, func(ch *Channel) {
+			RemoveChannel(ch)
+		})
+		return true
+	})
+	channelsStopped := make(chan struct{})
+	go func() {
+		s.channelsRunning.Wait()
+		close(channelsStopped)
+	}()
+	select {
+	case <-channelsStopped:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	for _, c := range servers {
+		c.closeGracefully()
+	}
+	if closeErr := waitConnectionsFlushed(ctx, servers); err == nil {
+		err = closeErr
+	}
+
+	s.stopCaptures(func(pc *packetCapture) bool { return true })
+	for _, a := range []Authenticator{s.authenticator, s.serverAuthenticator} {
+		if closer, ok := a.(interface{ Close() }); ok {
+			closer.Close()
+		}
+	}
+	if closeErr := s.CloseChannelDataStore(); closeErr != nil && err == nil {
+		err = fmt.Errorf("failed to close the channel data store: %w", closeErr)
+	}
+	s.logger.Info("server stopped", zap.Error(err))
+	return err
+}
+
+func (s *Server) getConnections(t proto.ConnectionType) []*Connection {
+	var conns []*Connection
+	s.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		if c := v.(*Connection); c.connectionType == t {
+			conns = append(conns, c)
+		}
+		return true
+	})
+	return conns
+}
+
+// Waits for the closing connections to be removed after flushing. If the context is done first, the remaining connections
+// are removed without flushing.
+func waitConnectionsFlushed(ctx context.Context, conns []*Connection) error {
+	if waitConnectionsRemoved(ctx, conns) {
+		return nil
+	}
+	for _, c := range conns {
+		if !c.IsRemoving() {
+			c.Logger().Warn("removed before the send queue is flushed")
+			RemoveConnection(c)
+		}
+	}
+	return ctx.Err()
+}
+
+// Returns false if the context is done before all the connections are removed.
+func waitConnectionsRemoved(ctx context.Context, conns []*Connection) bool {
+	for _, c := range conns {
+		select {
+		case <-c.removed:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,291 @@
+package channeld
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+func newTestServerSettings() *GlobalSettingsType {
+	return &GlobalSettingsType{
+		ServerNetwork:   "tcp",
+		ServerAddress:   "127.0.0.1:0",
+		ServerFSM:       "../../config/server_authoratative_fsm.json",
+		ClientNetwork:   "tcp",
+		ClientAddress:   "127.0.0.1:0",
+		ClientFSM:       "../../config/client_non_authoratative_fsm.json",
+		LogLevel:        &NullableInt{},
+		LogFile:         &NullableString{},
+		CaptureDir:      "captures",
+		ChannelSettings: map[proto.ChannelType]ChannelSettingsType{proto.ChannelType_UNKNOWN: defaultChannelSettings},
+	}
+}
+
+func TestServerIsolation(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	s1 := NewServer(newTestServerSettings(), zap.NewNop())
+	s2 := NewServer(newTestServerSettings(), zap.NewNop())
+	s1.InitChannels()
+	s2.InitChannels()
+	assert.NotEqual(t, s1.globalChannel, s2.globalChannel)
+	assert.NotEqual(t, defaultServer.globalChannel, s1.globalChannel)
+
+	ch1, err := s1.CreateChannel(proto.ChannelType_SUBWORLD, nil)
+	assert.NoError(t, err)
+	ch2, err := s2.CreateChannel(proto.ChannelType_SUBWORLD, nil)
+	assert.NoError(t, err)
+	// The channel ids are allocated per server.
+	assert.Equal(t, ch1.id, ch2.id)
+	assert.Equal(t, ch1, s1.GetChannel(ch1.id))
+	assert.Equal(t, ch2, s2.GetChannel(ch2.id))
+	assert.Equal(t, s1, ch1.server)
+
+	conn1, peer1 := net.Pipe()
+	c1 := s1.AddConnection(conn1, proto.ConnectionType_CLIENT)
+	// Reads the DISCONNECT notice, so the connection is flushed and removed when shutting down.
+	startGoroutines(c1)
+	go io.Copy(ioutil.Discard, peer1)
+	assert.Equal(t, c1, s1.GetConnection(c1.id))
+	assert.Nil(t, s2.GetConnection(c1.id))
+	assert.NotEqual(t, c1, GetConnection(c1.id))
+
+	// Changing the settings of one server doesn't affect the other.
+	s1.Settings.ChannelSettings = map[proto.ChannelType]ChannelSettingsType{proto.ChannelType_UNKNOWN: {TickIntervalMs: 50}}
+	assert.EqualValues(t, 50, s1.GetChannelSettings(proto.ChannelType_SUBWORLD).TickIntervalMs)
+	assert.EqualValues(t, defaultChannelSettings.TickIntervalMs, s2.GetChannelSettings(proto.ChannelType_SUBWORLD).TickIntervalMs)
+
+	assert.NoError(t, s1.Shutdown(context.Background()))
+	assert.NoError(t, s2.Shutdown(context.Background()))
+	assert.True(t, c1.IsRemoving())
+	assert.True(t, ch1.IsRemoving())
+	assert.True(t, ch2.IsRemoving())
+	// The default server is not touched.
+	assert.False(t, defaultServer.globalChannel.IsRemoving())
+}
+
+// The channel data whose custom merge always fails.
+type failingMergeData struct {
+	*proto.TestChannelDataMessage
+}
+
+func (d failingMergeData) Merge(src Message, options *proto.ChannelDataMergeOptions) error {
+	return errors.New("merge failed")
+}
+
+func TestServerMergeLogger(t *testing.T) {
+	// The package-level logger is not created by InitLogsAndMetrics, as channeld is embedded.
+	core, logs := observer.New(zap.ErrorLevel)
+	s := NewServer(newTestServerSettings(), zap.New(core))
+	s.InitChannels()
+	ch, err := s.CreateChannel(proto.ChannelType_SUBWORLD, nil)
+	assert.NoError(t, err)
+	assert.True(t, ch.executeAndWait(func(ch *Channel) {
+		ch.InitData(failingMergeData{&proto.TestChannelDataMessage{}}, nil)
+		ch.data.OnUpdate(&proto.TestChannelDataMessage{Num: 1}, ch.GetTime())
+	}, time.Second))
+
+	// The error goes to the channel's logger of the server.
+	entries := logs.FilterMessage("custom merge error").All()
+	if assert.Len(t, entries, 1) {
+		assert.EqualValues(t, ch.id, entries[0].ContextMap()["channelId"])
+	}
+}
+
+func TestServerStartShutdown(t *testing.T) {
+	settings := newTestServerSettings()
+	settings.ReconnectAddress = "127.0.0.1:12345"
+	s := NewServer(settings, zap.NewNop())
+	assert.NoError(t, s.Start(context.Background()))
+	assert.Eventually(t, func() bool {
+		return s.IsListening(proto.ConnectionType_SERVER) && s.IsListening(proto.ConnectionType_CLIENT)
+	}, time.Second, 10*time.Millisecond)
+
+	clientAddr := s.ListenAddr(proto.ConnectionType_CLIENT)
+	if !assert.NotNil(t, clientAddr) {
+		return
+	}
+	conn, err := net.Dial("tcp", clientAddr.String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	var c *Connection
+	assert.Eventually(t, func() bool {
+		c = s.GetConnection(1)
+		return c != nil
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, proto.ConnectionType_CLIENT, c.connectionType)
+
+	// Another server can't listen on the same address.
+	settings = newTestServerSettings()
+	settings.ServerAddress = s.ListenAddr(proto.ConnectionType_SERVER).String()
+	assert.Error(t, NewServer(settings, nil).Start(context.Background()))
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, s.Shutdown(ctx))
+	assert.True(t, c.IsRemoving())
+	// The client receives the DISCONNECT notice before the connection is closed.
+	msg := &proto.DisconnectMessage{}
+	assert.NoError(t, readTestMessage(conn, proto.MessageType_DISCONNECT, msg))
+	assert.EqualValues(t, 1, msg.ConnId)
+	assert.Equal(t, ShutdownReason, msg.Reason)
+	assert.Equal(t, "127.0.0.1:12345", msg.ReconnectAddress)
+	assert.Nil(t, s.ListenAddr(proto.ConnectionType_CLIENT))
+	assert.Eventually(t, func() bool {
+		return !s.IsListening(proto.ConnectionType_SERVER) && !s.IsListening(proto.ConnectionType_CLIENT)
+	}, time.Second, 10*time.Millisecond)
+	_, err = net.Dial("tcp", clientAddr.String())
+	assert.Error(t, err)
+}
+
+// Reads the messages sent by channeld until the one of the type is found.
+func readTestMessage(conn net.Conn, msgType proto.MessageType, msg Message) error {
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	for {
+		tag := make([]byte, 5)
+		if _, err := io.ReadFull(conn, tag); err != nil {
+			return err
+		}
+		size := int(tag[3])
+		if tag[1] != 72 {
+			size = size | int(tag[1])<<16 | int(tag[2])<<8
+		} else if tag[2] != 78 {
+			size = size | int(tag[2])<<8
+		}
+		bytes := make([]byte, size)
+		if _, err := io.ReadFull(conn, bytes); err != nil {
+			return err
+		}
+		p := &proto.Packet{}
+		if err := protobuf.Unmarshal(bytes, p); err != nil {
+			return err
+		}
+		for _, mp := range p.Messages {
+			if mp.MsgType == uint32(msgType) {
+				return protobuf.Unmarshal(mp.MsgBody, msg)
+			}
+		}
+	}
+}
+
+func TestServerShutdownOrder(t *testing.T) {
+	settings := newTestServerSettings()
+	settings.ChannelDataStore = "file"
+	settings.ChannelDataStorePath = t.TempDir()
+	settings.ChannelSettings = map[proto.ChannelType]ChannelSettingsType{
+		proto.ChannelType_UNKNOWN:  defaultChannelSettings,
+		proto.ChannelType_SUBWORLD: {TickIntervalMs: 10, DefaultFanOutIntervalMs: 20, Persistent: true},
+	}
+	settings.ShutdownSaveWindowMs = 5000
+	s := NewServer(settings, zap.NewNop())
+	assert.NoError(t, s.InitChannelDataStore())
+	s.InitChannels()
+
+	serverConn, serverPeer := net.Pipe()
+	server := s.AddConnection(serverConn, proto.ConnectionType_SERVER)
+	startGoroutines(server)
+	clientConn, clientPeer := net.Pipe()
+	client := s.AddConnection(clientConn, proto.ConnectionType_CLIENT)
+	startGoroutines(client)
+
+	ch, err := s.CreateChannel(proto.ChannelType_SUBWORLD, server)
+	assert.NoError(t, err)
+	assert.True(t, ch.executeAndWait(func(ch *Channel) {
+		ch.metadata = "world1"
+		ch.InitData(&proto.TestChannelDataMessage{Text: "abc"}, nil)
+		ch.data.OnUpdate(&proto.TestChannelDataMessage{Num: 1}, ch.GetTime())
+	}, time.Second))
+
+	shutdownErr := make(chan error)
+	go func() {
+		shutdownErr <- s.Shutdown(context.Background())
+	}()
+
+	// The client is notified and closed first.
+	msg := &proto.DisconnectMessage{}
+	assert.NoError(t, readTestMessage(clientPeer, proto.MessageType_DISCONNECT, msg))
+	assert.EqualValues(t, client.id, msg.ConnId)
+	assert.Equal(t, ShutdownReason, msg.Reason)
+	assert.Empty(t, msg.ReconnectAddress)
+	assert.Eventually(t, client.IsRemoving, time.Second, 10*time.Millisecond)
+
+	// The server connection is notified before the channel is removed, so it can still save the state.
+	assert.NoError(t, readTestMessage(serverPeer, proto.MessageType_DISCONNECT, msg))
+	assert.EqualValues(t, server.id, msg.ConnId)
+	assert.False(t, ch.IsRemoving())
+	assert.True(t, ch.executeAndWait(func(ch *Channel) {
+		ch.data.OnUpdate(&proto.TestChannelDataMessage{Num: 2}, ch.GetTime())
+	}, time.Second))
+
+	// The shutdown goes on once the server disconnects, without waiting for the rest of the window.
+	serverPeer.Close()
+	select {
+	case err := <-shutdownErr:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("the shutdown waited for the whole window")
+	}
+	assert.True(t, ch.IsRemoving())
+	assert.True(t, server.IsRemoving())
+
+	store, err := NewFileChannelDataStore(settings.ChannelDataStorePath)
+	assert.NoError(t, err)
+	snapshot, err := store.Load(ch.dataKey())
+	if assert.NoError(t, err) && assert.NotNil(t, snapshot) {
+		data, err := snapshot.UnmarshalNew()
+		assert.NoError(t, err)
+		assert.True(t, protobuf.Equal(&proto.TestChannelDataMessage{Text: "abc", Num: 2}, data))
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	s := NewServer(newTestServerSettings(), zap.NewNop())
+	s.InitChannels()
+
+	// Nobody reads from the other end, so the notice can't be flushed.
+	conn, _ := net.Pipe()
+	c := s.AddConnection(conn, proto.ConnectionType_CLIENT)
+	startGoroutines(c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, s.Shutdown(ctx), context.DeadlineExceeded)
+	// The connection is removed anyway.
+	assert.True(t, c.IsRemoving())
+	assert.Nil(t, s.GetConnection(c.id))
+}
+
+func TestServerShutdownSaveWindow(t *testing.T) {
+	settings := newTestServerSettings()
+	settings.ShutdownSaveWindowMs = 100
+	s := NewServer(settings, zap.NewNop())
+	s.InitChannels()
+
+	// The server stays connected after the notice.
+	conn, peer := net.Pipe()
+	go io.Copy(io.Discard, peer)
+	server := s.AddConnection(conn, proto.ConnectionType_SERVER)
+	startGoroutines(server)
+	ch, err := s.CreateChannel(proto.ChannelType_SUBWORLD, server)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	assert.NoError(t, s.Shutdown(ctx))
+	// The channels are removed after the window, then the server connection is closed.
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(100*time.Millisecond))
+	assert.True(t, ch.IsRemoving())
+	assert.True(t, server.IsRemoving())
+}
@@ -1,145 +1,302 @@
-package channeld
-
-import (
-	"encoding/json"
-	"flag"
-	"fmt"
-	"io/ioutil"
-	"strconv"
-	"strings"
-
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/pkg/profile"
-)
-
-type GlobalSettingsType struct {
-	Development   bool
-	LogLevel      *NullableInt // zapcore.Level
-	LogFile       *NullableString
-	ProfileOption func(*profile.Profile)
-	ProfilePath   string
-
-	ServerNetwork string
-	ServerAddress string
-	ServerFSM     string
-
-	ClientNetwork string
-	ClientAddress string
-	ClientFSM     string
-
-	CompressionType proto.CompressionType
-
-	ChannelSettings map[proto.ChannelType]ChannelSettingsType
-}
-
-type ChannelSettingsType struct {
-	TickIntervalMs          uint
-	DefaultFanOutIntervalMs uint32
-}
-
-var GlobalSettings = GlobalSettingsType{
-	LogLevel:        &NullableInt{},
-	LogFile:         &NullableString{},
-	CompressionType: proto.CompressionType_NO_COMPRESSION,
-	ChannelSettings: map[proto.ChannelType]ChannelSettingsType{
-		proto.ChannelType_GLOBAL: {
-			TickIntervalMs:          10,
-			DefaultFanOutIntervalMs: 20,
-		},
-	},
-}
-
-type NullableInt struct {
-	Value    int
-	HasValue bool
-}
-
-func (i NullableInt) String() string {
-	if i.HasValue {
-		return strconv.Itoa(i.Value)
-	} else {
-		return ""
-	}
-}
-
-func (i *NullableInt) Set(s string) error {
-	val, err := strconv.Atoi(s)
-	if err == nil {
-		i.Value = val
-		i.HasValue = true
-	}
-	return err
-}
-
-type NullableString struct {
-	Value    string
-	HasValue bool
-}
-
-func (ns NullableString) String() string {
-	return ns.Value
-}
-
-func (ns *NullableString) Set(s string) error {
-	ns.Value = s
-	ns.HasValue = true
-	return nil
-}
-
-func (s *GlobalSettingsType) ParseFlag() error {
-	flag.BoolVar(&s.Development, "dev", false, "run in development mode?")
-	flag.Var(s.LogLevel, "loglevel", "the log level, -1 = Debug, 0 = Info, 1= Warn, 2 = Error, 3 = Panic")
-	//flag.Var(stringPtrFlag{s.LogFile, fmt.Sprintf("logs/%s.log", time.Now().Format("20060102150405"))}, "logfile", "file path to store the log")
-	flag.Var(s.LogFile, "logfile", "file path to store the log")
-	flag.Func("profile", "available options: cpu, mem, goroutine", func(str string) error {
-		switch strings.ToLower(str) {
-		case "cpu":
-			s.ProfileOption = profile.CPUProfile
-		case "mem":
-			s.ProfileOption = profile.MemProfile
-		case "goroutine":
-			s.ProfileOption = profile.GoroutineProfile
-		default:
-			return fmt.Errorf("invalid profile type: %s", str)
-		}
-		return nil
-	})
-	flag.StringVar(&s.ProfilePath, "profilepath", "profiles", "the path to store the profile output files")
-
-	flag.StringVar(&s.ServerNetwork, "sn", "tcp", "the network type for the server connections")
-	flag.StringVar(&s.ServerAddress, "sa", ":11288", "the network address for the server connections")
-	flag.StringVar(&s.ServerFSM, "sfsm", "config/server_authoratative_fsm.json", "the path to the server FSM config")
-
-	flag.StringVar(&s.ClientNetwork, "cn", "tcp", "the network type for the client connections")
-	flag.StringVar(&s.ClientAddress, "ca", ":12108", "the network address for the client connections")
-	flag.StringVar(&s.ClientFSM, "cfsm", "config/client_non_authoratative_fsm.json", "the path to the client FSM config")
-
-	ct := flag.Uint("ct", 0, "the compression type, 0 = No, 1 = Snappy")
-
-	chs := flag.String("chs", "config/channel_settings_hifi.json", "the path to the channel settings file")
-
-	flag.Parse()
-
-	if ct != nil {
-		s.CompressionType = proto.CompressionType(*ct)
-	}
-
-	chsData, err := ioutil.ReadFile(*chs)
-	if err == nil {
-		if err := json.Unmarshal(chsData, &GlobalSettings.ChannelSettings); err != nil {
-			return fmt.Errorf("failed to unmarshall channel settings: %v", err)
-		}
-	} else {
-		return fmt.Errorf("failed to read channel settings: %v", err)
-	}
-
-	return nil
-}
-
-func (s GlobalSettingsType) GetChannelSettings(t proto.ChannelType) ChannelSettingsType {
-	settings, exists := s.ChannelSettings[t]
-	if !exists {
-		settings = s.ChannelSettings[proto.ChannelType_GLOBAL]
-	}
-	return settings
-}
+package channeld
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/pkg/profile"
+)
+
+type GlobalSettingsType struct {
+	Development   bool
+	LogLevel      *NullableInt // zapcore.Level
+	LogFile       *NullableString
+	ProfileOption func(*profile.Profile)
+	ProfilePath   string
+
+	ServerNetwork string
+	ServerAddress string
+	ServerFSM     string
+
+	ClientNetwork string
+	ClientAddress string
+	ClientFSM     string
+	StrictFSM     bool // Fail to load the FSM config if there's any error in it, instead of logging and ignoring the error.
+
+	CompressionType proto.CompressionType
+
+	AuthProvider    string // none, static, hmac, delegate, jwt
+	AuthFile        string // The token file for the static provider
+	AuthSecret      string // The shared secret for the hmac provider
+	AuthTimeoutMs   uint   // How long the delegate provider waits for the GLOBAL owner's verdict
+	MaxAuthFailures uint32 // Disconnect the connection after the number of failed attempts. 0 = unlimited.
+	JWKSFile        string // The JWKS file for the jwt provider. It's reloaded when modified.
+	JWTAudience     string // If not empty, the 'aud' claim must contain the audience.
+	JWTIssuer       string // If not empty, the 'iss' claim must match the issuer.
+	JWTUserIdClaim  string
+	JWTRolesClaim   string
+
+	// The provider for the server connections. Empty means the same as AuthProvider. It can't be delegate, as the servers
+	// are authenticated before any of them owns the GLOBAL channel. So it's required if AuthProvider is delegate.
+	ServerAuthProvider string
+
+	// The max number of ErrorResultMessage replied to an authenticated connection per second. The rest are only logged. 0 = unlimited.
+	MaxErrorRepliesPerSec uint
+
+	// How long a client connection is kept after its transport dropped, waiting to be resumed. 0 = resuming is disabled.
+	ResumeGracePeriodMs uint
+
+	PingIntervalMs      uint // How often channeld sends PING to each connection. 0 = no PING.
+	ServerIdleTimeoutMs uint // Remove the server connection if nothing is received within the timeout. 0 = never.
+	ClientIdleTimeoutMs uint // Remove the client connection if nothing is received within the timeout. 0 = never.
+
+	SpatialGridFile   string // The settings of the spatial controller. Empty means the spatial controller is disabled.
+	HandoverTimeoutMs uint   // How long channeld waits for the destination channel owner to accept the handover.
+
+	// The bearer token of the admin HTTP API. Empty means the admin API is disabled.
+	AdminToken string
+	// The directory of the packet capture files. The captures are started by the admin API.
+	CaptureDir string
+
+	ChannelStallTimeoutMs    uint // /healthz fails if any channel hasn't ticked within the timeout (or twice its tick interval if longer).
+	ReadyRequiresGlobalOwner bool // /readyz fails until the GLOBAL channel has an owner.
+
+	ChannelDataStore     string // none, file, bolt
+	ChannelDataStorePath string // The directory for the file store, or the database file for the bolt store.
+	ChannelDataLogDir    string // The directory for the write-ahead logs of the channel data updates. Empty means the logs are disabled.
+	// How often the appended write-ahead log records are flushed to the disk (fsync). 0 = after each batch of the records written together.
+	ChannelDataLogSyncIntervalMs uint
+
+	ChannelSettingsFile string
+	// How often the FSM and channel settings files are checked for changes. 0 = only reloaded on SIGHUP.
+	SettingsReloadIntervalMs uint
+	// Migrate the existing connections to the reloaded FSM if their current state still exists in it.
+	MigrateConnectionFSM bool
+
+	ShutdownTimeoutMs uint   // How long the graceful shutdown waits for the connections to be flushed and the channels to take the final snapshots.
+	ReconnectAddress  string // Sent to the connections in the DISCONNECT notice when shutting down. Empty means no reconnect address.
+	// How long the server connections have to save the states of the channels they own after the DISCONNECT notice, before the channels are removed.
+	ShutdownSaveWindowMs uint
+
+	ChannelSettings map[proto.ChannelType]ChannelSettingsType
+}
+
+type ChannelSettingsType struct {
+	TickIntervalMs          uint
+	DefaultFanOutIntervalMs uint32
+	// The max number of the messages to the owner that are buffered while the channel has no owner. 0 = the messages are dropped.
+	OwnerlessBufferSize uint
+	// Is the channel data saved to the channel data store, and restored when the channel is re-created with the same metadata?
+	Persistent bool
+	// How often the snapshot of the channel data is taken, if the data has changed. 0 = only when the channel is removed.
+	SnapshotIntervalMs uint
+	// Are the accepted channel data updates appended to the write-ahead log? The log is truncated after each snapshot. Requires Persistent.
+	WriteAheadLog bool
+	// Are the updates in the write-ahead log replayed on top of the snapshot when the channel is restored?
+	ReplayWriteAheadLog bool
+}
+
+var GlobalSettings = GlobalSettingsType{
+	LogLevel:              &NullableInt{},
+	LogFile:               &NullableString{},
+	CompressionType:       proto.CompressionType_NO_COMPRESSION,
+	ChannelStallTimeoutMs: 5000,
+	HandoverTimeoutMs:     3000,
+	CaptureDir:            "captures",
+	ShutdownTimeoutMs:     10000,
+	ShutdownSaveWindowMs:  3000,
+	MaxErrorRepliesPerSec: 10,
+	ChannelSettings: map[proto.ChannelType]ChannelSettingsType{
+		proto.ChannelType_UNKNOWN: defaultChannelSettings,
+	},
+}
+
+// The settings of the channel types that are not in GlobalSettings.ChannelSettings are keyed by UNKNOWN ("0" in the channel settings file).
+// Used if the channel settings file doesn't have the "0" entry.
+var defaultChannelSettings = ChannelSettingsType{
+	TickIntervalMs:          10,
+	DefaultFanOutIntervalMs: 20,
+	OwnerlessBufferSize:     100,
+}
+
+type NullableInt struct {
+	Value    int
+	HasValue bool
+}
+
+func (i NullableInt) String() string {
+	if i.HasValue {
+		return strconv.Itoa(i.Value)
+	} else {
+		return ""
+	}
+}
+
+func (i *NullableInt) Set(s string) error {
+	val, err := strconv.Atoi(s)
+	if err == nil {
+		i.Value = val
+		i.HasValue = true
+	}
+	return err
+}
+
+type NullableString struct {
+	Value    string
+	HasValue bool
+}
+
+func (ns NullableString) String() string {
+	return ns.Value
+}
+
+func (ns *NullableString) Set(s string) error {
+	ns.Value = s
+	ns.HasValue = true
+	return nil
+}
+
+func (s *GlobalSettingsType) ParseFlag() error {
+	flag.BoolVar(&s.Development, "dev", false, "run in development mode?")
+	flag.Var(s.LogLevel, "loglevel", "the log level, -1 = Debug, 0 = Info, 1= Warn, 2 = Error, 3 = Panic")
+	//flag.Var(stringPtrFlag{s.LogFile, fmt.Sprintf("logs/%s.log", time.Now().Format("20060102150405"))}, "logfile", "file path to store the log")
+	flag.Var(s.LogFile, "logfile", "file path to store the log")
+	flag.Func("profile", "available options: cpu, mem, goroutine", func(str string) error {
+		switch strings.ToLower(str) {
+		case "cpu":
+			s.ProfileOption = profile.CPUProfile
+		case "mem":
+			s.ProfileOption = profile.MemProfile
+		case "goroutine":
+			s.ProfileOption = profile.GoroutineProfile
+		default:
+			return fmt.Errorf("invalid profile type: %s", str)
+		}
+		return nil
+	})
+	flag.StringVar(&s.ProfilePath, "profilepath", "profiles", "the path to store the profile output files")
+
+	flag.StringVar(&s.ServerNetwork, "sn", "tcp", "the network type for the server connections")
+	flag.StringVar(&s.ServerAddress, "sa", ":11288", "the network address for the server connections")
+	flag.StringVar(&s.ServerFSM, "sfsm", "config/server_authoratative_fsm.json", "the path to the server FSM config")
+
+	flag.StringVar(&s.ClientNetwork, "cn", "tcp", "the network type for the client connections")
+	flag.StringVar(&s.ClientAddress, "ca", ":12108", "the network address for the client connections")
+	flag.StringVar(&s.ClientFSM, "cfsm", "config/client_non_authoratative_fsm.json", "the path to the client FSM config")
+
+	flag.BoolVar(&s.StrictFSM, "strictfsm", false, "fail to load the FSM configs if there's any invalid state, transition or message type in them?")
+
+	ct := flag.Uint("ct", 0, "the compression type, 0 = No, 1 = Snappy")
+
+	flag.StringVar(&s.AuthProvider, "auth", "none", "the authentication provider, available options: none, static, hmac, delegate, jwt")
+	flag.StringVar(&s.ServerAuthProvider, "serverauth", "", "the authentication provider of the server connections, empty = the same as -auth, required if -auth is delegate")
+	flag.StringVar(&s.AuthFile, "authfile", "", "the path to the JSON token file for the static authentication provider")
+	flag.StringVar(&s.AuthSecret, "authsecret", "", "the shared secret for the hmac authentication provider")
+	flag.UintVar(&s.AuthTimeoutMs, "authtimeout", 5000, "the timeout in milliseconds of the delegate authentication provider")
+	flag.UintVar(&s.ResumeGracePeriodMs, "resume", 0, "how long in milliseconds a client connection waits to be resumed after its transport dropped, 0 = resuming is disabled")
+	flag.UintVar(&s.PingIntervalMs, "ping", 0, "the interval in milliseconds of sending PING to the connections, 0 = no PING")
+	flag.UintVar(&s.ServerIdleTimeoutMs, "sit", 0, "remove the server connection if nothing is received within the timeout in milliseconds, 0 = never")
+	flag.UintVar(&s.ClientIdleTimeoutMs, "cit", 0, "remove the client connection if nothing is received within the timeout in milliseconds, 0 = never")
+	maf := flag.Uint("maf", 3, "the max number of failed authentication attempts before the connection is closed, 0 = unlimited")
+	flag.UintVar(&s.MaxErrorRepliesPerSec, "maxerr", 10, "the max number of error replies sent to an authenticated connection per second, 0 = unlimited")
+	flag.StringVar(&s.JWKSFile, "jwks", "config/jwks.json", "the path to the JWKS file for the jwt authentication provider")
+	flag.StringVar(&s.JWTAudience, "jwtaud", "", "the expected audience of the JWT login token")
+	flag.StringVar(&s.JWTIssuer, "jwtiss", "", "the expected issuer of the JWT login token")
+	flag.StringVar(&s.JWTUserIdClaim, "jwtuid", "sub", "the claim of the JWT login token that contains the user id")
+	flag.StringVar(&s.JWTRolesClaim, "jwtroles", "roles", "the claim of the JWT login token that contains the roles")
+
+	flag.UintVar(&s.HandoverTimeoutMs, "hotimeout", 3000, "the timeout in milliseconds of the destination channel owner accepting the handover")
+	flag.StringVar(&s.SpatialGridFile, "spatial", "", "the path to the spatial grid settings file, empty = the spatial controller is disabled")
+
+	flag.StringVar(&s.AdminToken, "admintoken", "", "the bearer token of the admin HTTP API, empty = the admin API is disabled")
+	flag.StringVar(&s.CaptureDir, "capturedir", "captures", "the directory of the packet capture files")
+
+	flag.UintVar(&s.ChannelStallTimeoutMs, "stall", 5000, "the health check fails if any channel hasn't ticked within the timeout in milliseconds")
+	flag.BoolVar(&s.ReadyRequiresGlobalOwner, "readyowner", false, "is the GLOBAL channel owner required for the readiness check?")
+
+	flag.StringVar(&s.ChannelDataStore, "store", "none", "the store of the persistent channel data, available options: none, file, bolt")
+	flag.StringVar(&s.ChannelDataStorePath, "storepath", "data/channels", "the directory of the file store, or the database file of the bolt store")
+	flag.StringVar(&s.ChannelDataLogDir, "wal", "", "the directory of the write-ahead logs of the channel data updates, empty = the logs are disabled")
+	flag.UintVar(&s.ChannelDataLogSyncIntervalMs, "walsync", 0, "the interval in milliseconds of flushing the write-ahead logs to the disk, 0 = after each batch of the records")
+
+	flag.StringVar(&s.ChannelSettingsFile, "chs", "config/channel_settings_hifi.json", "the path to the channel settings file")
+	flag.UintVar(&s.SettingsReloadIntervalMs, "reload", 0, "the interval in milliseconds of checking the FSM and channel settings files for changes, 0 = only reloaded on SIGHUP")
+	flag.BoolVar(&s.MigrateConnectionFSM, "migratefsm", false, "migrate the existing connections to the reloaded FSM if their current state still exists?")
+
+	flag.UintVar(&s.ShutdownTimeoutMs, "shutdowntimeout", 10000, "the timeout in milliseconds of the graceful shutdown on SIGINT, SIGTERM or SIGQUIT")
+	flag.UintVar(&s.ShutdownSaveWindowMs, "shutdownsave", 3000, "the time in milliseconds for the server connections to save the channels' states after the shutdown notice, before the channels are removed")
+	flag.StringVar(&s.ReconnectAddress, "reconnectaddr", "", "the address that the connections are told to reconnect to when shutting down, empty = no reconnect address")
+
+	flag.Parse()
+
+	if ct != nil {
+		s.CompressionType = proto.CompressionType(*ct)
+	}
+
+	if maf != nil {
+		s.MaxAuthFailures = uint32(*maf)
+	}
+
+	channelSettings, err := loadChannelSettings(s.ChannelSettingsFile)
+	if err != nil {
+		return err
+	}
+	s.ChannelSettings = channelSettings
+
+	return nil
+}
+
+// Reads and validates the channel settings file. The default settings are added if the file doesn't have the "0" entry.
+func loadChannelSettings(path string) (map[proto.ChannelType]ChannelSettingsType, error) {
+	chsData, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read channel settings: %v", err)
+	}
+	settings := map[proto.ChannelType]ChannelSettingsType{
+		proto.ChannelType_UNKNOWN: defaultChannelSettings,
+	}
+	if err := json.Unmarshal(chsData, &settings); err != nil {
+		return nil, fmt.Errorf("failed to unmarshall channel settings: %v", err)
+	}
+	for t, cs := range settings {
+		if _, defined := proto.ChannelType_name[int32(t)]; !defined {
+			return nil, fmt.Errorf("invalid channel settings: undefined channel type %d", t)
+		}
+		if cs.TickIntervalMs == 0 {
+			return nil, fmt.Errorf("invalid channel settings: TickIntervalMs of %s should be greater than 0", t)
+		}
+		if cs.WriteAheadLog && !cs.Persistent {
+			return nil, fmt.Errorf("invalid channel settings: WriteAheadLog of %s requires Persistent", t)
+		}
+	}
+	return settings, nil
+}
+
+func (s GlobalSettingsType) GetIdleTimeout(t proto.ConnectionType) time.Duration {
+	switch t {
+	case proto.ConnectionType_SERVER:
+		return time.Duration(s.ServerIdleTimeoutMs) * time.Millisecond
+	case proto.ConnectionType_CLIENT:
+		return time.Duration(s.ClientIdleTimeoutMs) * time.Millisecond
+	}
+	return 0
+}
+
+// Not guarded against reloading the settings. Use Server.GetChannelSettings while the server is running.
+func (s *GlobalSettingsType) GetChannelSettings(t proto.ChannelType) ChannelSettingsType {
+	return getChannelSettings(s.ChannelSettings, t)
+}
+
+func getChannelSettings(settings map[proto.ChannelType]ChannelSettingsType, t proto.ChannelType) ChannelSettingsType {
+	cs, exists := settings[t]
+	if !exists {
+		cs = settings[proto.ChannelType_UNKNOWN]
+	}
+	return cs
+}
@@ -0,0 +1,198 @@
+package channeld
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+// Reloads the FSM and channel settings files of the default server on SIGHUP, and when they are modified if -reload is set.
+// The connections and channels are kept, so the settings can be tuned without restarting channeld.
+func InitSettingsReload() {
+	defaultServer.InitSettingsReload()
+}
+
+func (s *Server) InitSettingsReload() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+
+	var ticker <-chan time.Time
+	if s.Settings.SettingsReloadIntervalMs > 0 {
+		ticker = time.NewTicker(time.Duration(s.Settings.SettingsReloadIntervalMs) * time.Millisecond).C
+	}
+
+	go func() {
+		defer signal.Stop(sighup)
+		modTimes := s.settingsFileModTimes()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-sighup:
+				s.logger.Info("caught SIGHUP, reloading the settings")
+			case <-ticker:
+				newModTimes := s.settingsFileModTimes()
+				modified := false
+				for path, t := range newModTimes {
+					if !t.Equal(modTimes[path]) {
+						modified = true
+						break
+					}
+				}
+				if !modified {
+					continue
+				}
+				modTimes = newModTimes
+				s.logger.Info("settings file modified, reloading the settings")
+			}
+
+			if err := s.ReloadSettings(); err != nil {
+				// Keep running with the current settings.
+				s.logger.Error("failed to reload the settings", zap.Error(err))
+			}
+		}
+	}()
+}
+
+func (s *Server) settingsFileModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time, 3)
+	for _, path := range []string{s.Settings.ServerFSM, s.Settings.ClientFSM, s.Settings.ChannelSettingsFile} {
+		// The file that fails to stat is treated as unmodified. Reloading reports the error if it's gone.
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// Loads and validates the FSM and channel settings files of the default server, then applies them.
+// Nothing is applied if any of the files is invalid.
+func ReloadSettings() error {
+	return defaultServer.ReloadSettings()
+}
+
+func (s *Server) ReloadSettings() error {
+	// Always strict regardless of -strictfsm, as a broken FSM config would otherwise be applied to the running connections.
+	newServerFsm, err := loadFsm(s.Settings.ServerFSM, true)
+	if err != nil {
+		return fmt.Errorf("failed to load server FSM: %w", err)
+	}
+	newClientFsm, err := loadFsm(s.Settings.ClientFSM, true)
+	if err != nil {
+		return fmt.Errorf("failed to load client FSM: %w", err)
+	}
+	newChannelSettings, err := loadChannelSettings(s.Settings.ChannelSettingsFile)
+	if err != nil {
+		return err
+	}
+
+	s.applyFsms(newServerFsm, newClientFsm, s.Settings.MigrateConnectionFSM)
+	s.applyChannelSettings(newChannelSettings)
+	s.logger.Info("reloaded the settings",
+		zap.String("serverFsm", s.Settings.ServerFSM),
+		zap.String("clientFsm", s.Settings.ClientFSM),
+		zap.String("channelSettings", s.Settings.ChannelSettingsFile),
+		zap.Bool("migrateFsm", s.Settings.MigrateConnectionFSM),
+	)
+	return nil
+}
+
+// The new FSMs apply to the new connections. If migrate is true, the existing connections are also migrated.
+func (s *Server) applyFsms(newServerFsm fsm.FiniteStateMachine, newClientFsm fsm.FiniteStateMachine, migrate bool) {
+	s.fsmTemplatesLock.Lock()
+	s.serverFsm = newServerFsm
+	s.clientFsm = newClientFsm
+	s.fsmTemplatesLock.Unlock()
+
+	if !migrate {
+		return
+	}
+	s.allConnections.Range(func(_ interface{}, v interface{}) bool {
+		c := v.(*Connection)
+		// IMPORTANT: always make a value copy
+		var newFsm fsm.FiniteStateMachine
+		switch c.connectionType {
+		case proto.ConnectionType_SERVER:
+			newFsm = newServerFsm
+		case proto.ConnectionType_CLIENT:
+			newFsm = newClientFsm
+		default:
+			return true
+		}
+		c.pendingFsmLock.Lock()
+		c.pendingFsm = &newFsm
+		c.pendingFsmLock.Unlock()
+		return true
+	})
+}
+
+// Switches to the reloaded FSM, keeping the current state. The old FSM is kept if the state doesn't exist in the reloaded FSM.
+// Called in the receiving goroutine, before the message is checked by the FSM.
+func (c *Connection) applyPendingFsm() {
+	c.pendingFsmLock.Lock()
+	newFsm := c.pendingFsm
+	c.pendingFsm = nil
+	c.pendingFsmLock.Unlock()
+	if newFsm == nil {
+		return
+	}
+
+	// Locked while swapping, as the GLOBAL channel's goroutine may be moving the current state at the same time.
+	c.fsmLock.Lock()
+	defer c.fsmLock.Unlock()
+	stateName := c.fsm.CurrentState().Name
+	if err := newFsm.ChangeState(stateName); err != nil {
+		c.Logger().Warn("keeps the old FSM as the current state doesn't exist in the reloaded FSM", zap.String("connState", stateName))
+		return
+	}
+	// The timer of the current state keeps running, so the migration doesn't extend the timeout.
+	c.replaceFsm(newFsm)
+	c.Logger().Info("migrated to the reloaded FSM", zap.String("connState", stateName))
+}
+
+// Returns the settings of the channel type, which can be replaced by reloading the settings at any time.
+func (s *Server) GetChannelSettings(t proto.ChannelType) ChannelSettingsType {
+	s.channelSettingsLock.RLock()
+	defer s.channelSettingsLock.RUnlock()
+	return getChannelSettings(s.Settings.ChannelSettings, t)
+}
+
+// Replaces the channel settings, and applies the tick and fan-out intervals to the existing channels.
+func (s *Server) applyChannelSettings(newSettings map[proto.ChannelType]ChannelSettingsType) {
+	s.channelSettingsLock.Lock()
+	oldSettings := s.Settings.ChannelSettings
+	s.Settings.ChannelSettings = newSettings
+	s.channelSettingsLock.Unlock()
+
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		ch := v.(*Channel)
+		oldCs := getChannelSettings(oldSettings, ch.channelType)
+		newCs := getChannelSettings(newSettings, ch.channelType)
+		ch.execute(func(ch *Channel) {
+			ch.applySettings(oldCs, newCs)
+		})
+		return true
+	})
+}
+
+// Called in the channel's goroutine.
+func (ch *Channel) applySettings(oldCs ChannelSettingsType, newCs ChannelSettingsType) {
+	atomic.StoreInt64(&ch.tickInterval, int64(time.Duration(newCs.TickIntervalMs)*time.Millisecond))
+	if oldCs.DefaultFanOutIntervalMs == newCs.DefaultFanOutIntervalMs {
+		return
+	}
+	// Only the subscriptions that use the default fan-out interval are changed.
+	// The intervals set in the ChannelSubscriptionOptions or by the spatial interest are kept.
+	for _, cs := range ch.subscribedConnections {
+		if cs.options.FanOutIntervalMs == oldCs.DefaultFanOutIntervalMs {
+			cs.options.FanOutIntervalMs = newCs.DefaultFanOutIntervalMs
+		}
+	}
+}
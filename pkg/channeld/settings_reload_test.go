@@ -0,0 +1,164 @@
+package channeld
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/pkg/fsm"
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTestFile(t *testing.T, path string, content string) {
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestLoadChannelSettings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "channel_settings.json")
+
+	_, err := loadChannelSettings(path)
+	assert.Error(t, err)
+
+	writeTestFile(t, path, `{"0": {"TickIntervalMs": 10`)
+	_, err = loadChannelSettings(path)
+	assert.Error(t, err)
+
+	writeTestFile(t, path, `{"0": {"TickIntervalMs": 0}}`)
+	_, err = loadChannelSettings(path)
+	assert.Error(t, err)
+
+	writeTestFile(t, path, `{"0": {"TickIntervalMs": 10}, "999": {"TickIntervalMs": 10}}`)
+	_, err = loadChannelSettings(path)
+	assert.Error(t, err)
+
+	writeTestFile(t, path, `{"0": {"TickIntervalMs": 10, "WriteAheadLog": true}}`)
+	_, err = loadChannelSettings(path)
+	assert.Error(t, err)
+
+	// The default settings are added if missing.
+	writeTestFile(t, path, `{"3": {"TickIntervalMs": 50, "DefaultFanOutIntervalMs": 100}}`)
+	settings, err := loadChannelSettings(path)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultChannelSettings, settings[proto.ChannelType_UNKNOWN])
+	assert.EqualValues(t, 50, settings[proto.ChannelType_SUBWORLD].TickIntervalMs)
+}
+
+// Runs the function in the channel's goroutine and waits for it to return.
+func executeAndWait(ch *Channel, f func(ch *Channel)) {
+	ch.executeAndWait(f, 10*time.Second)
+}
+
+func TestReloadSettings(t *testing.T) {
+	InitLogsAndMetrics()
+
+	oldSettings, oldServerFsm, oldClientFsm := GlobalSettings, defaultServer.serverFsm, defaultServer.clientFsm
+	defer func() {
+		GlobalSettings = oldSettings
+		defaultServer.serverFsm, defaultServer.clientFsm = oldServerFsm, oldClientFsm
+	}()
+	dir := t.TempDir()
+	GlobalSettings.ServerFSM = filepath.Join(dir, "server_fsm.json")
+	GlobalSettings.ClientFSM = filepath.Join(dir, "client_fsm.json")
+	GlobalSettings.ChannelSettingsFile = filepath.Join(dir, "channel_settings.json")
+	writeTestFile(t, GlobalSettings.ServerFSM, `{"States": [{"Name": "OPEN", "MsgTypeWhitelist": "1-100"}]}`)
+	writeTestFile(t, GlobalSettings.ClientFSM, `{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "3"}]}`)
+	writeTestFile(t, GlobalSettings.ChannelSettingsFile, `{"0": {"TickIntervalMs": 10, "DefaultFanOutIntervalMs": 20}}`)
+	InitConnections(GlobalSettings.ServerFSM, GlobalSettings.ClientFSM)
+	settings, err := loadChannelSettings(GlobalSettings.ChannelSettingsFile)
+	assert.NoError(t, err)
+	GlobalSettings.ChannelSettings = settings
+	InitChannels()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	client1 := addTestConnection(proto.ConnectionType_CLIENT)
+	client1.fsm.MoveToNextState()
+	client2 := addTestConnection(proto.ConnectionType_CLIENT)
+	client2.fsm.MoveToNextState()
+	executeAndWait(ch, func(ch *Channel) {
+		client1.SubscribeToChannel(ch, nil)
+		client2.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 100})
+	})
+	assert.True(t, client1.fsm.IsAllowed(uint32(proto.MessageType_CREATE_CHANNEL)))
+
+	// The invalid settings are not applied.
+	writeTestFile(t, GlobalSettings.ChannelSettingsFile, `{"0": {"TickIntervalMs": 0}}`)
+	assert.Error(t, ReloadSettings())
+	assert.EqualValues(t, 10, defaultServer.GetChannelSettings(proto.ChannelType_TEST).TickIntervalMs)
+	writeTestFile(t, GlobalSettings.ClientFSM, `{"States": []}`)
+	writeTestFile(t, GlobalSettings.ChannelSettingsFile, `{"0": {"TickIntervalMs": 30, "DefaultFanOutIntervalMs": 40}}`)
+	assert.Error(t, ReloadSettings())
+	assert.EqualValues(t, 10, defaultServer.GetChannelSettings(proto.ChannelType_TEST).TickIntervalMs)
+
+	// The FSM is always loaded strictly when reloading, even if -strictfsm is not set.
+	GlobalSettings.StrictFSM = false
+	writeTestFile(t, GlobalSettings.ClientFSM, `{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1,x"}, {"Name": "OPEN", "MsgTypeWhitelist": "4"}]}`)
+	assert.Error(t, ReloadSettings())
+	assert.EqualValues(t, 10, defaultServer.GetChannelSettings(proto.ChannelType_TEST).TickIntervalMs)
+
+	writeTestFile(t, GlobalSettings.ClientFSM, `{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "4"}]}`)
+	GlobalSettings.MigrateConnectionFSM = true
+	assert.NoError(t, ReloadSettings())
+	assert.EqualValues(t, 30, defaultServer.GetChannelSettings(proto.ChannelType_TEST).TickIntervalMs)
+	assert.Eventually(t, func() bool {
+		return ch.getTickInterval() == 30*time.Millisecond
+	}, time.Second, 10*time.Millisecond)
+	executeAndWait(ch, func(ch *Channel) {
+		assert.EqualValues(t, 40, ch.subscribedConnections[client1.id].options.FanOutIntervalMs)
+		// The interval set in the options is kept.
+		assert.EqualValues(t, 100, ch.subscribedConnections[client2.id].options.FanOutIntervalMs)
+	})
+
+	// The new FSM applies to the new connections.
+	client3 := addTestConnection(proto.ConnectionType_CLIENT)
+	client3.fsm.MoveToNextState()
+	assert.True(t, client3.fsm.IsAllowed(uint32(proto.MessageType_REMOVE_CHANNEL)))
+
+	// The existing connections are migrated when they receive the next message.
+	assert.True(t, client1.fsm.IsAllowed(uint32(proto.MessageType_CREATE_CHANNEL)))
+	client1.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)})
+	assert.Equal(t, "OPEN", client1.fsm.CurrentState().Name)
+	assert.False(t, client1.fsm.IsAllowed(uint32(proto.MessageType_CREATE_CHANNEL)))
+	assert.True(t, client1.fsm.IsAllowed(uint32(proto.MessageType_REMOVE_CHANNEL)))
+
+	writeTestFile(t, GlobalSettings.ClientFSM, `{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "AUTHENTICATED", "MsgTypeWhitelist": "5"}]}`)
+	assert.NoError(t, ReloadSettings())
+	// client2 keeps the FSM before the reloads, as the OPEN state is gone.
+	client2.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)})
+	assert.Equal(t, "OPEN", client2.fsm.CurrentState().Name)
+	assert.True(t, client2.fsm.IsAllowed(uint32(proto.MessageType_CREATE_CHANNEL)))
+}
+
+func TestMigrateFsmWhileMoving(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	c := addTestConnection(proto.ConnectionType_CLIENT)
+	oldFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "1-10"}]}`))
+	assert.NoError(t, err)
+	c.setFsm(&oldFsm)
+	newFsm, err := fsm.Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1"}, {"Name": "OPEN", "MsgTypeWhitelist": "1-100"}]}`))
+	assert.NoError(t, err)
+	c.pendingFsmLock.Lock()
+	c.pendingFsm = &newFsm
+	c.pendingFsmLock.Unlock()
+
+	// The authentication moves the state in the GLOBAL channel's goroutine, while the receiving goroutine migrates the FSM.
+	moved := make(chan struct{})
+	defaultServer.globalChannel.execute(func(_ *Channel) {
+		c.withFsm(func(f *fsm.FiniteStateMachine) {
+			f.MoveToNextState()
+		})
+		close(moved)
+	})
+	c.receiveMessage(&proto.MessagePack{ChannelId: 0, MsgType: uint32(proto.MessageType_PING)})
+	<-moved
+
+	// Either way, the move is not lost.
+	assert.Equal(t, "OPEN", c.fsmState().Name)
+	c.withFsm(func(f *fsm.FiniteStateMachine) {
+		assert.Same(t, &newFsm, f)
+	})
+}
@@ -0,0 +1,481 @@
+package channeld
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sync"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// Maps the locations in the world to the SPATIAL channels.
+type SpatialController interface {
+	// Creates the SPATIAL channels. Called once at startup.
+	CreateChannels() ([]*Channel, error)
+	// Returns the id of the SPATIAL channel that contains the location.
+	GetChannelId(loc *proto.Location) (ChannelId, error)
+	// Returns the SPATIAL channels in the interest area around the location, and their distances to the location in number of cells.
+	QueryChannelIds(center *proto.Location, area *proto.SpatialInterestArea) (map[ChannelId]uint, error)
+}
+
+func SetSpatialController(controller SpatialController) {
+	defaultServer.SetSpatialController(controller)
+}
+
+func (s *Server) SetSpatialController(controller SpatialController) {
+	s.spatialController = controller
+}
+
+// Creates the spatial controller of the default server from the grid settings file (-spatial) and the SPATIAL channels.
+// Does nothing if the file is not specified.
+func InitSpatialController() error {
+	return defaultServer.InitSpatialController()
+}
+
+func (s *Server) InitSpatialController() error {
+	if s.Settings.SpatialGridFile == "" {
+		return nil
+	}
+
+	bytes, err := os.ReadFile(s.Settings.SpatialGridFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the spatial grid settings: %w", err)
+	}
+	controller := &StaticGridSpatialController{server: s}
+	if err := json.Unmarshal(bytes, controller); err != nil {
+		return fmt.Errorf("failed to unmarshal the spatial grid settings: %w", err)
+	}
+	channels, err := controller.CreateChannels()
+	if err != nil {
+		return err
+	}
+	s.spatialController = controller
+	s.logger.Info("created spatial channels", zap.Int("num", len(channels)), zap.String("path", s.Settings.SpatialGridFile))
+	if controller.Balance != nil && controller.Balance.IntervalMs > 0 {
+		controller.startBalancing()
+	}
+	return nil
+}
+
+// Splits the world's AABB into a grid of the same-sized cells. Each cell is a SPATIAL channel at first.
+// An axis with only one cell is not bounded, e.g. the vertical axis of a 2D grid.
+// The load balancing may subdivide a cell into the zones of different SPATIAL channels (see subdivide()).
+type StaticGridSpatialController struct {
+	WorldMin  *proto.Location
+	WorldMax  *proto.Location
+	CellCount [3]uint // The number of cells on the X, Y, and Z axis.
+	// Nil means the load balancing is disabled, and the regions never change after the SPATIAL channels are claimed.
+	Balance *SpatialBalanceSettings
+
+	channelIds []ChannelId // The channels created for the cells. Indexed by cellIndex()
+	// The zones of all the SPATIAL channels, including the ones created by the subdivisions.
+	zones map[ChannelId]*spatialZone
+	// Guards the zones, as the SPATIAL channels look up the locations in their own goroutines while the load balancing subdivides the zones.
+	zonesLock sync.RWMutex
+	server    *Server // Nil means the default server, e.g. the controller is created in the tests.
+
+	// The channel created to subdivide a zone, until the split zone is registered. Only accessed in the GLOBAL channel's goroutine.
+	subdividingChannel *Channel
+}
+
+// The part of a cell that a SPATIAL channel covers. The zone is the whole cell, unless the cell is subdivided.
+type spatialZone struct {
+	channelId ChannelId
+	cell      [3]uint
+	metadata  string
+	min, max  [3]float64 // The unbounded axes are infinite.
+	depth     uint       // The number of the subdivisions to get the zone from the cell.
+	// The zones split off from this one, in the order of the subdivisions.
+	splits []spatialSplit
+}
+
+// The locations at or above pos on the axis, which were in the zone when the split happened, belong to the split zone.
+type spatialSplit struct {
+	axis int
+	pos  float64
+	zone *spatialZone
+}
+
+// Returns the zone that contains the location, which is in this zone before any split.
+func (z *spatialZone) locate(coords [3]float64) *spatialZone {
+	for i := 0; i < len(z.splits); i++ {
+		if split := z.splits[i]; coords[split.axis] >= split.pos {
+			return split.zone.locate(coords)
+		}
+	}
+	return z
+}
+
+// Calls the function for the zone and all the zones split off from it.
+func (z *spatialZone) walk(f func(z *spatialZone)) {
+	f(z)
+	for _, split := range z.splits {
+		split.zone.walk(f)
+	}
+}
+
+func (c *StaticGridSpatialController) cellNum() int {
+	return int(c.CellCount[0] * c.CellCount[1] * c.CellCount[2])
+}
+
+func (c *StaticGridSpatialController) CreateChannels() ([]*Channel, error) {
+	if c.WorldMin == nil || c.WorldMax == nil {
+		return nil, fmt.Errorf("the world AABB is not specified")
+	}
+	if c.cellNum() == 0 {
+		return nil, fmt.Errorf("invalid cell count: %v", c.CellCount)
+	}
+	mins := [3]float64{c.WorldMin.X, c.WorldMin.Y, c.WorldMin.Z}
+	maxs := [3]float64{c.WorldMax.X, c.WorldMax.Y, c.WorldMax.Z}
+	for axis := 0; axis < 3; axis++ {
+		if c.CellCount[axis] > 1 && mins[axis] >= maxs[axis] {
+			return nil, fmt.Errorf("invalid world AABB on axis %d: [%f, %f]", axis, mins[axis], maxs[axis])
+		}
+	}
+
+	channels := make([]*Channel, c.cellNum())
+	c.channelIds = make([]ChannelId, c.cellNum())
+	c.zones = make(map[ChannelId]*spatialZone, c.cellNum())
+	for z := uint(0); z < c.CellCount[2]; z++ {
+		for y := uint(0); y < c.CellCount[1]; y++ {
+			for x := uint(0); x < c.CellCount[0]; x++ {
+				cell := [3]uint{x, y, z}
+				zone := &spatialZone{cell: cell, metadata: fmt.Sprintf("%d,%d,%d", x, y, z)}
+				for axis := 0; axis < 3; axis++ {
+					zone.min[axis], zone.max[axis] = math.Inf(-1), math.Inf(1)
+					if c.CellCount[axis] > 1 {
+						zone.min[axis] = mins[axis] + float64(cell[axis])*c.cellSize(axis)
+						zone.max[axis] = zone.min[axis] + c.cellSize(axis)
+					}
+				}
+				ch, err := c.createZoneChannel(zone, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				// The grid should be complete before any location is looked up, so the zones of the cells are registered right away.
+				c.zonesLock.Lock()
+				c.zones[ch.id] = zone
+				c.zonesLock.Unlock()
+				index := c.cellIndex(cell)
+				channels[index] = ch
+				c.channelIds[index] = ch.id
+			}
+		}
+	}
+	return channels, nil
+}
+
+// Creates the SPATIAL channel for the zone. The channel data is initialized and restored in the channel's goroutine without waiting,
+// as the channel is already ticking, then onInit is called in the same goroutine. The messages queued to the channel afterwards always see the data.
+// The zone is not registered, as the caller decides when the locations in it go to the new channel.
+func (c *StaticGridSpatialController) createZoneChannel(zone *spatialZone, owner *Connection, onInit func(ch *Channel)) (*Channel, error) {
+	ch, err := c.getServer().createChannel(proto.ChannelType_SPATIAL, owner, zone.metadata)
+	if err != nil {
+		return nil, err
+	}
+	zone.channelId = ch.id
+	ch.execute(func(ch *Channel) {
+		ch.InitData(&proto.SpatialChannelDataMessage{Entities: make(map[uint32]*proto.SpatialEntityInfo)},
+			&proto.ChannelDataMergeOptions{ShouldCheckRemovableMapField: true})
+		ch.restoreData()
+		if onInit != nil {
+			onInit(ch)
+		}
+	})
+	return ch, nil
+}
+
+func (c *StaticGridSpatialController) getServer() *Server {
+	if c.server == nil {
+		return defaultServer
+	}
+	return c.server
+}
+
+func (c *StaticGridSpatialController) cellSize(axis int) float64 {
+	mins := [3]float64{c.WorldMin.X, c.WorldMin.Y, c.WorldMin.Z}
+	maxs := [3]float64{c.WorldMax.X, c.WorldMax.Y, c.WorldMax.Z}
+	return (maxs[axis] - mins[axis]) / float64(c.CellCount[axis])
+}
+
+func (c *StaticGridSpatialController) cellIndex(cell [3]uint) uint {
+	return cell[0] + cell[1]*c.CellCount[0] + cell[2]*c.CellCount[0]*c.CellCount[1]
+}
+
+// Returns the coordinates of the cell that contains the location.
+func (c *StaticGridSpatialController) getCell(loc *proto.Location) ([3]uint, error) {
+	var cell [3]uint
+	if loc == nil {
+		return cell, fmt.Errorf("location is nil")
+	}
+	if len(c.channelIds) == 0 {
+		return cell, fmt.Errorf("the spatial channels are not created")
+	}
+
+	coords := [3]float64{loc.X, loc.Y, loc.Z}
+	mins := [3]float64{c.WorldMin.X, c.WorldMin.Y, c.WorldMin.Z}
+	maxs := [3]float64{c.WorldMax.X, c.WorldMax.Y, c.WorldMax.Z}
+	for axis := 0; axis < 3; axis++ {
+		if c.CellCount[axis] > 1 {
+			if coords[axis] < mins[axis] || coords[axis] > maxs[axis] {
+				return cell, fmt.Errorf("location (%f, %f, %f) is out of the world", loc.X, loc.Y, loc.Z)
+			}
+			cell[axis] = uint(math.Floor((coords[axis] - mins[axis]) / c.cellSize(axis)))
+			// The max bound belongs to the last cell.
+			if cell[axis] >= c.CellCount[axis] {
+				cell[axis] = c.CellCount[axis] - 1
+			}
+		}
+	}
+	return cell, nil
+}
+
+func (c *StaticGridSpatialController) GetChannelId(loc *proto.Location) (ChannelId, error) {
+	cell, err := c.getCell(loc)
+	if err != nil {
+		return 0, err
+	}
+	c.zonesLock.RLock()
+	defer c.zonesLock.RUnlock()
+	return c.zones[c.channelIds[c.cellIndex(cell)]].locate([3]float64{loc.X, loc.Y, loc.Z}).channelId, nil
+}
+
+func (c *StaticGridSpatialController) QueryChannelIds(center *proto.Location, area *proto.SpatialInterestArea) (map[ChannelId]uint, error) {
+	centerCell, err := c.getCell(center)
+	if err != nil {
+		return nil, err
+	}
+
+	// The number of cells to check on each side of the center cell.
+	var reach [3]uint
+	var radius float64
+	switch {
+	case area.GetBorder() != nil:
+		n := uint(area.GetBorder().CellNum)
+		reach = [3]uint{n, n, n}
+	case area.GetSphere() != nil:
+		radius = area.GetSphere().Radius
+	case area.GetCone() != nil:
+		radius = area.GetCone().Radius
+	default:
+		return nil, fmt.Errorf("the interest area is not specified")
+	}
+	if radius > 0 {
+		for axis := 0; axis < 3; axis++ {
+			if c.CellCount[axis] > 1 {
+				reach[axis] = uint(math.Ceil(radius / c.cellSize(axis)))
+			}
+		}
+	}
+
+	var from, to [3]uint
+	for axis := 0; axis < 3; axis++ {
+		if centerCell[axis] > reach[axis] {
+			from[axis] = centerCell[axis] - reach[axis]
+		}
+		to[axis] = centerCell[axis] + reach[axis]
+		if to[axis] >= c.CellCount[axis] {
+			to[axis] = c.CellCount[axis] - 1
+		}
+	}
+
+	c.zonesLock.RLock()
+	defer c.zonesLock.RUnlock()
+	result := make(map[ChannelId]uint)
+	var cell [3]uint
+	for cell[2] = from[2]; cell[2] <= to[2]; cell[2]++ {
+		for cell[1] = from[1]; cell[1] <= to[1]; cell[1]++ {
+			for cell[0] = from[0]; cell[0] <= to[0]; cell[0]++ {
+				if cell != centerCell && !c.isCellInArea(cell, center, area) {
+					continue
+				}
+				// Chebyshev distance
+				distance := uint(0)
+				for axis := 0; axis < 3; axis++ {
+					d := cell[axis] - centerCell[axis]
+					if cell[axis] < centerCell[axis] {
+						d = centerCell[axis] - cell[axis]
+					}
+					if d > distance {
+						distance = d
+					}
+				}
+				// All the zones in a subdivided cell have the same distance as the cell.
+				c.zones[c.channelIds[c.cellIndex(cell)]].walk(func(z *spatialZone) {
+					result[z.channelId] = distance
+				})
+			}
+		}
+	}
+	return result, nil
+}
+
+func (c *StaticGridSpatialController) isCellInArea(cell [3]uint, center *proto.Location, area *proto.SpatialInterestArea) bool {
+	if area.GetBorder() != nil {
+		return true
+	}
+
+	p := [3]float64{center.X, center.Y, center.Z}
+	mins := [3]float64{c.WorldMin.X, c.WorldMin.Y, c.WorldMin.Z}
+	// The points in the cell to test against the area: the closest point to the center, the cell center, and the corners.
+	// Testing the points is an approximation for the cone, which is good enough for the interest management.
+	points := make([][3]float64, 10)
+	for axis := 0; axis < 3; axis++ {
+		cellMin, cellMax := p[axis], p[axis]
+		// The axis with only one cell is not bounded.
+		if c.CellCount[axis] > 1 {
+			cellMin = mins[axis] + float64(cell[axis])*c.cellSize(axis)
+			cellMax = cellMin + c.cellSize(axis)
+		}
+		points[0][axis] = math.Max(cellMin, math.Min(p[axis], cellMax))
+		points[1][axis] = (cellMin + cellMax) / 2
+		for corner := 0; corner < 8; corner++ {
+			if corner&(1<<axis) == 0 {
+				points[2+corner][axis] = cellMin
+			} else {
+				points[2+corner][axis] = cellMax
+			}
+		}
+	}
+
+	if sphere := area.GetSphere(); sphere != nil {
+		return distance(p, points[0]) <= sphere.Radius
+	}
+
+	cone := area.GetCone()
+	if distance(p, points[0]) > cone.Radius {
+		return false
+	}
+	if cone.Direction == nil {
+		return true
+	}
+	dir := [3]float64{cone.Direction.X, cone.Direction.Y, cone.Direction.Z}
+	dirLen := distance([3]float64{}, dir)
+	for _, point := range points {
+		v := [3]float64{point[0] - p[0], point[1] - p[1], point[2] - p[2]}
+		vLen := distance([3]float64{}, v)
+		if vLen > cone.Radius {
+			continue
+		}
+		if vLen == 0 || dirLen == 0 {
+			return true
+		}
+		cos := (v[0]*dir[0] + v[1]*dir[1] + v[2]*dir[2]) / (vLen * dirLen)
+		if math.Acos(math.Max(-1, math.Min(1, cos))) <= cone.Angle {
+			return true
+		}
+	}
+	return false
+}
+
+func distance(a [3]float64, b [3]float64) float64 {
+	return math.Sqrt((a[0]-b[0])*(a[0]-b[0]) + (a[1]-b[1])*(a[1]-b[1]) + (a[2]-b[2])*(a[2]-b[2]))
+}
+
+// Moves the entities whose new locations are outside of the channel to the SPATIAL channels that contain them.
+// The moved entities are marked as removed in the update message, so the subscribers of this channel will remove them.
+func (ch *Channel) moveSpatialEntities(ctx MessageContext, updateMsg *proto.SpatialChannelDataMessage) {
+	s := ch.server
+	if s.spatialController == nil {
+		return
+	}
+
+	var data *proto.SpatialChannelDataMessage
+	if ch.data != nil {
+		data, _ = ch.data.msg.(*proto.SpatialChannelDataMessage)
+	}
+
+	for entityId, info := range updateMsg.Entities {
+		if info.Removed || info.Loc == nil {
+			continue
+		}
+		dstChannelId, err := s.spatialController.GetChannelId(info.Loc)
+		if err != nil {
+			ch.Logger().Warn("failed to locate the entity", zap.Uint32("entityId", entityId), zap.Error(err))
+			continue
+		}
+		if dstChannelId == ch.id {
+			continue
+		}
+		dstChannel := s.GetChannel(dstChannelId)
+		if dstChannel == nil {
+			continue
+		}
+
+		// Move the whole entity, not only the updated fields.
+		entity := info
+		if data != nil {
+			if oldInfo, exists := data.Entities[entityId]; exists {
+				entity = protobuf.Clone(oldInfo).(*proto.SpatialEntityInfo)
+				protobuf.Merge(entity, info)
+			}
+		}
+
+		// The destination channel is owned by another server. The entity stays in this channel until the handover is committed.
+		if dstOwner := dstChannel.getOwner(); ch.ownerConnection != nil && dstOwner != nil && dstOwner != ch.ownerConnection {
+			delete(updateMsg.Entities, entityId)
+			ch.beginHandover(entityId, entity, dstChannel, dstOwner)
+			continue
+		}
+
+		updateMsg.Entities[entityId] = &proto.SpatialEntityInfo{Removed: true}
+
+		ctx.MsgType = proto.MessageType_CHANNEL_DATA_UPDATE
+		ctx.Channel = dstChannel
+		ctx.ChannelId = uint32(dstChannelId)
+		dstChannel.putMessageContext(ctx, func(ctx MessageContext) {
+			if ctx.Channel.Data() == nil {
+				ctx.Channel.Logger().Warn("failed to move in the entity as the channel data is not initialized", zap.Uint32("entityId", entityId))
+				return
+			}
+			ctx.Channel.applyDataUpdate(nil, &proto.SpatialChannelDataMessage{
+				Entities: map[uint32]*proto.SpatialEntityInfo{entityId: entity},
+			})
+		})
+
+		ch.Logger().Debug("moved the entity to another spatial channel",
+			zap.Uint32("entityId", entityId),
+			zap.Uint32("dstChannelId", uint32(dstChannelId)),
+		)
+	}
+}
+
+// Gives the ownership of all the SPATIAL channels that have no owner to the connection.
+// Sends a CreateChannelResultMessage for each of the channels, as if they were created by the connection.
+// The connection becomes an idle spatial server if there's no channel to own.
+func claimSpatialChannels(ctx MessageContext, msg *proto.CreateChannelMessage) {
+	s := ctx.Channel.server
+	s.spatialServers.Store(ctx.Connection.id, ctx.Connection)
+	s.allChannels.Range(func(_ interface{}, v interface{}) bool {
+		ch := v.(*Channel)
+		if ch.channelType != proto.ChannelType_SPATIAL {
+			return true
+		}
+		respond := ctx
+		respond.Channel = ch
+		respond.ChannelId = uint32(ch.id)
+		// The owner is checked and changed in the channel's goroutine, as another server may claim the channel at the same time.
+		ch.putMessageContext(respond, func(ctx MessageContext) {
+			if ctx.Channel.ownerConnection != nil {
+				return
+			}
+			ctx.Channel.assignOwner(ctx.Connection)
+			ctx.Channel.state = OPEN
+			ctx.Channel.onSpatialChannelOwned(ctx, msg.SubOptions)
+		})
+		return true
+	})
+	// The connection stands by for the load balancing if it doesn't own any channel.
+}
+
+// Sends the CreateChannelResultMessage to the new owner of the SPATIAL channel (ctx.Connection), as if it created the channel,
+// then subscribes it to the channel. Called in the channel's goroutine.
+func (ch *Channel) onSpatialChannelOwned(ctx MessageContext, subOptions *proto.ChannelSubscriptionOptions) {
+	ch.sendCreateChannelResult(ctx, subOptions)
+	ch.flushOwnerlessMessages()
+	ctx.Connection.Logger().Info("owned the SPATIAL channel", zap.Uint32("channelId", uint32(ch.id)))
+}
@@ -0,0 +1,373 @@
+package channeld
+
+import (
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+	protobuf "google.golang.org/protobuf/proto"
+)
+
+// The settings of the dynamic load balancing between the spatial servers. Part of the spatial grid settings.
+// The region of a spatial server is the set of the SPATIAL channels it owns.
+type SpatialBalanceSettings struct {
+	IntervalMs uint
+	// A region is overloaded if the number of the entities in it, or the average tick duration of its channels, exceeds the limit.
+	// Half of an overloaded region is handed over to an idle spatial server.
+	SplitEntityNum      uint
+	SplitTickDurationMs float64
+	// Two neighboring regions are merged if the total number of the entities in them is below the limit.
+	MergeEntityNum uint
+	// The max number of times a cell can be subdivided. When an overloaded region has only one SPATIAL channel,
+	// its zone is subdivided into two, and the upper half goes to a new channel owned by an idle spatial server. 0 means never.
+	// The subdivided zones are not joined back. Merging the regions only changes the owners of the channels.
+	MaxSubdivisionDepth uint
+}
+
+type spatialRegion struct {
+	owner          *Connection
+	cells          [][3]uint
+	channels       []*Channel
+	entityNum      uint
+	tickDurationMs float64 // The average of the channels
+}
+
+func (r *spatialRegion) isOverloaded(settings *SpatialBalanceSettings) bool {
+	return (settings.SplitEntityNum > 0 && r.entityNum > settings.SplitEntityNum) ||
+		(settings.SplitTickDurationMs > 0 && r.tickDurationMs > settings.SplitTickDurationMs)
+}
+
+// Records the load of the SPATIAL channel for the load balancing. Called in the channel's goroutine.
+func (ch *Channel) updateSpatialLoad() {
+	if ch.channelType != proto.ChannelType_SPATIAL || ch.data == nil {
+		return
+	}
+	if data, ok := ch.data.msg.(*proto.SpatialChannelDataMessage); ok {
+		atomic.StoreInt32(&ch.spatialEntityNum, int32(len(data.Entities)))
+	}
+}
+
+func (c *StaticGridSpatialController) startBalancing() {
+	go func() {
+		ticker := time.NewTicker(time.Duration(c.Balance.IntervalMs) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.getServer().done:
+				return
+			case <-ticker.C:
+				// Subdividing creates the channels, which should only be done in the GLOBAL channel's goroutine.
+				c.getServer().globalChannel.execute(func(_ *Channel) { c.balance() })
+			}
+		}
+	}()
+}
+
+// Groups the SPATIAL channels by their owners. The regions are sorted by the owners' connection id.
+// The channels of a subdivided cell all have the cell's coordinates.
+func (c *StaticGridSpatialController) getRegions() []*spatialRegion {
+	c.zonesLock.RLock()
+	defer c.zonesLock.RUnlock()
+	regionMap := make(map[*Connection]*spatialRegion)
+	regions := make([]*spatialRegion, 0)
+	for _, chId := range c.channelIds {
+		c.zones[chId].walk(func(zone *spatialZone) {
+			ch := c.getServer().GetChannel(zone.channelId)
+			if ch == nil {
+				return
+			}
+			// The owner is read from the snapshot, as the channel may change it in its own goroutine at the same time.
+			owner := ch.getOwner()
+			if owner == nil || owner.IsRemoving() {
+				return
+			}
+			region, exists := regionMap[owner]
+			if !exists {
+				region = &spatialRegion{owner: owner}
+				regionMap[owner] = region
+				regions = append(regions, region)
+			}
+			region.cells = append(region.cells, zone.cell)
+			region.channels = append(region.channels, ch)
+			region.entityNum += uint(atomic.LoadInt32(&ch.spatialEntityNum))
+			region.tickDurationMs += float64(atomic.LoadInt64(&ch.lastTickDuration)) / float64(time.Millisecond)
+		})
+	}
+	for _, region := range regions {
+		region.tickDurationMs /= float64(len(region.channels))
+	}
+	sort.Slice(regions, func(i, j int) bool { return regions[i].owner.id < regions[j].owner.id })
+	return regions
+}
+
+func (s *Server) getIdleSpatialServers(regions []*spatialRegion) []*Connection {
+	owners := make(map[*Connection]bool, len(regions))
+	for _, region := range regions {
+		owners[region.owner] = true
+	}
+	idle := make([]*Connection, 0)
+	s.spatialServers.Range(func(k interface{}, v interface{}) bool {
+		conn := v.(*Connection)
+		if conn.IsRemoving() {
+			s.spatialServers.Delete(k)
+		} else if !owners[conn] {
+			idle = append(idle, conn)
+		}
+		return true
+	})
+	sort.Slice(idle, func(i, j int) bool { return idle[i].id < idle[j].id })
+	return idle
+}
+
+func (s *Server) isBalancingHandoverPending() bool {
+	pending := false
+	s.pendingHandovers.Range(func(_ interface{}, v interface{}) bool {
+		pending = v.(*spatialHandover).byBalancer
+		return !pending
+	})
+	return pending
+}
+
+// Splits or subdivides an overloaded region, or merges two underloaded neighboring regions. At most one of them happens each time,
+// and nothing happens while the channels or the entities of the previous one are still being handed over.
+func (c *StaticGridSpatialController) balance() {
+	if c.Balance == nil || c.getServer().isBalancingHandoverPending() {
+		return
+	}
+	if ch := c.subdividingChannel; ch != nil {
+		c.zonesLock.RLock()
+		_, registered := c.zones[ch.id]
+		c.zonesLock.RUnlock()
+		// The channel may be removed before its data is initialized, then the zone is never registered.
+		if !registered && !ch.IsRemoving() {
+			return
+		}
+		c.subdividingChannel = nil
+	}
+
+	regions := c.getRegions()
+	idleServers := c.getServer().getIdleSpatialServers(regions)
+	if len(idleServers) > 0 {
+		for _, region := range regions {
+			if !region.isOverloaded(c.Balance) {
+				continue
+			}
+			if len(region.channels) > 1 {
+				c.split(region, idleServers[0])
+				return
+			}
+			if c.subdivide(region, idleServers[0]) {
+				return
+			}
+		}
+	}
+
+	if c.Balance.MergeEntityNum > 0 {
+		for i, a := range regions {
+			for _, b := range regions[i+1:] {
+				if a.entityNum+b.entityNum >= c.Balance.MergeEntityNum || a.isOverloaded(c.Balance) || b.isOverloaded(c.Balance) {
+					continue
+				}
+				if !areRegionsAdjacent(a, b) {
+					continue
+				}
+				// Merge the region with fewer entities into the other one.
+				if b.entityNum > a.entityNum {
+					a, b = b, a
+				}
+				c.merge(b, a)
+				return
+			}
+		}
+	}
+}
+
+// Hands over the half of the region along its longest axis to the idle server.
+func (c *StaticGridSpatialController) split(region *spatialRegion, idleServer *Connection) {
+	var mins, maxs [3]uint
+	for i, cell := range region.cells {
+		for axis := 0; axis < 3; axis++ {
+			if i == 0 || cell[axis] < mins[axis] {
+				mins[axis] = cell[axis]
+			}
+			if cell[axis] > maxs[axis] {
+				maxs[axis] = cell[axis]
+			}
+		}
+	}
+	longestAxis := 0
+	for axis := 1; axis < 3; axis++ {
+		if maxs[axis]-mins[axis] > maxs[longestAxis]-mins[longestAxis] {
+			longestAxis = axis
+		}
+	}
+
+	indexes := make([]int, len(region.cells))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	sort.SliceStable(indexes, func(i, j int) bool {
+		return region.cells[indexes[i]][longestAxis] > region.cells[indexes[j]][longestAxis]
+	})
+
+	// Take the channels from the far end of the axis until half of the entities (or half of the channels if there's no entity) are taken.
+	channels := make([]*Channel, 0)
+	entityNum := uint(0)
+	for _, i := range indexes[:len(indexes)-1] {
+		ch := region.channels[i]
+		if region.entityNum > 0 && entityNum*2 >= region.entityNum {
+			break
+		}
+		if region.entityNum == 0 && len(channels)*2 >= len(indexes) {
+			break
+		}
+		channels = append(channels, ch)
+		entityNum += uint(atomic.LoadInt32(&ch.spatialEntityNum))
+	}
+
+	c.getServer().logger.Info("splitting the overloaded spatial region",
+		zap.Uint32("ownerConnId", uint32(region.owner.id)),
+		zap.Uint32("idleConnId", uint32(idleServer.id)),
+		zap.Uint("entityNum", region.entityNum),
+		zap.Float64("tickDurationMs", region.tickDurationMs),
+		zap.Int("channelNum", len(channels)),
+	)
+	spatialRebalanced.WithLabelValues("split").Inc()
+	handOverChannels(channels, idleServer)
+}
+
+func (c *StaticGridSpatialController) merge(src *spatialRegion, dst *spatialRegion) {
+	c.getServer().logger.Info("merging the underloaded spatial regions",
+		zap.Uint32("srcOwnerConnId", uint32(src.owner.id)),
+		zap.Uint32("dstOwnerConnId", uint32(dst.owner.id)),
+		zap.Uint("entityNum", src.entityNum+dst.entityNum),
+	)
+	spatialRebalanced.WithLabelValues("merge").Inc()
+	handOverChannels(src.channels, dst.owner)
+}
+
+// Subdivides the zone of the region's only channel into two halves along its longest axis.
+// The channel keeps the lower half, and a new channel owned by the idle server takes the upper half, together with the entities in it.
+// The split is registered in the new channel's goroutine once its data is initialized, and the balancing waits for it.
+// Returns false if the zone can't be subdivided any more.
+func (c *StaticGridSpatialController) subdivide(region *spatialRegion, idleServer *Connection) bool {
+	ch := region.channels[0]
+	// Only the subdivision changes the zones, and it doesn't happen again until the split is registered,
+	// so the zone is not changed after the read lock is released.
+	c.zonesLock.RLock()
+	zone := c.zones[ch.id]
+	c.zonesLock.RUnlock()
+	if zone == nil || zone.depth >= c.Balance.MaxSubdivisionDepth {
+		return false
+	}
+	axis := -1
+	for a := 0; a < 3; a++ {
+		if c.CellCount[a] > 1 && (axis < 0 || zone.max[a]-zone.min[a] > zone.max[axis]-zone.min[axis]) {
+			axis = a
+		}
+	}
+	if axis < 0 {
+		return false
+	}
+
+	pos := (zone.min[axis] + zone.max[axis]) / 2
+	newZone := &spatialZone{
+		cell:     zone.cell,
+		metadata: fmt.Sprintf("%s/%d", zone.metadata, len(zone.splits)+1),
+		min:      zone.min,
+		max:      zone.max,
+		depth:    zone.depth + 1,
+	}
+	newZone.min[axis] = pos
+	newChannel, err := c.createZoneChannel(newZone, idleServer, func(newChannel *Channel) {
+		c.zonesLock.Lock()
+		c.zones[newChannel.id] = newZone
+		zone.max[axis] = pos
+		zone.depth++
+		zone.splits = append(zone.splits, spatialSplit{axis: axis, pos: pos, zone: newZone})
+		c.zonesLock.Unlock()
+
+		// The idle server should know it owns the new channel before the entities are handed over to it.
+		ctx := MessageContext{Connection: idleServer, Channel: newChannel, ChannelId: uint32(newChannel.id)}
+		newChannel.onSpatialChannelOwned(ctx, &proto.ChannelSubscriptionOptions{CanUpdateData: true})
+		ch.execute(func(ch *Channel) {
+			ch.handOverEntitiesTo(newChannel, idleServer)
+		})
+	})
+	if err != nil {
+		c.getServer().logger.Error("failed to create the channel to subdivide the spatial zone", zap.Error(err))
+		return false
+	}
+	c.subdividingChannel = newChannel
+
+	c.getServer().logger.Info("subdividing the overloaded spatial zone",
+		zap.Uint32("channelId", uint32(ch.id)),
+		zap.Uint32("newChannelId", uint32(newChannel.id)),
+		zap.Uint32("ownerConnId", uint32(region.owner.id)),
+		zap.Uint32("idleConnId", uint32(idleServer.id)),
+		zap.Uint("entityNum", region.entityNum),
+		zap.Float64("tickDurationMs", region.tickDurationMs),
+		zap.Int("axis", axis),
+		zap.Float64("pos", pos),
+	)
+	spatialRebalanced.WithLabelValues("subdivide").Inc()
+	return true
+}
+
+// Hands over the entities that are located in the zone of the destination channel. Called in the source channel's goroutine.
+func (ch *Channel) handOverEntitiesTo(dstChannel *Channel, dstOwner *Connection) {
+	if ch.Data() == nil || ch.channelHandover != nil || ch.ownerConnection == nil || ch.ownerConnection == dstOwner {
+		return
+	}
+	data, ok := ch.Data().msg.(*proto.SpatialChannelDataMessage)
+	if !ok {
+		return
+	}
+	for entityId, entity := range data.Entities {
+		if _, exists := ch.handoverEntities[entityId]; exists || entity.Loc == nil {
+			continue
+		}
+		if chId, err := ch.server.spatialController.GetChannelId(entity.Loc); err != nil || chId != dstChannel.id {
+			continue
+		}
+		h := ch.newEntityHandover(entityId, protobuf.Clone(entity).(*proto.SpatialEntityInfo), dstChannel, dstOwner)
+		h.byBalancer = true
+		h.prepare()
+	}
+}
+
+func handOverChannels(channels []*Channel, dstOwner *Connection) {
+	for _, ch := range channels {
+		ch.putMessageContext(MessageContext{
+			MsgType:    proto.MessageType_HANDOVER_PREPARE,
+			Connection: dstOwner,
+			Channel:    ch,
+			ChannelId:  uint32(ch.id),
+		}, func(ctx MessageContext) {
+			ctx.Channel.beginChannelHandover(ctx.Connection)
+		})
+	}
+}
+
+// Two regions are adjacent if any of their cells share a face, or are the same subdivided cell.
+func areRegionsAdjacent(a *spatialRegion, b *spatialRegion) bool {
+	for _, cellA := range a.cells {
+		for _, cellB := range b.cells {
+			diff := uint(0)
+			for axis := 0; axis < 3; axis++ {
+				if cellA[axis] > cellB[axis] {
+					diff += cellA[axis] - cellB[axis]
+				} else {
+					diff += cellB[axis] - cellA[axis]
+				}
+			}
+			if diff <= 1 {
+				return true
+			}
+		}
+	}
+	return false
+}
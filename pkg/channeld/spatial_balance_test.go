@@ -0,0 +1,263 @@
+package channeld
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestSpatialBalance(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 40},
+		CellCount: [3]uint{4, 1, 1},
+		Balance: &SpatialBalanceSettings{
+			SplitEntityNum: 8,
+			MergeEntityNum: 4,
+		},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	createSpatialChannel := func(c *Connection) {
+		handleCreateChannel(MessageContext{
+			MsgType:    proto.MessageType_CREATE_CHANNEL,
+			Msg:        &proto.CreateChannelMessage{ChannelType: proto.ChannelType_SPATIAL, SubOptions: &proto.ChannelSubscriptionOptions{CanUpdateData: true}},
+			Connection: c,
+			Channel:    defaultServer.globalChannel,
+		})
+	}
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	createSpatialChannel(server1)
+	// No channel left to own
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	createSpatialChannel(server2)
+	for _, ch := range channels {
+		executeAndWait(ch, func(ch *Channel) { assert.Equal(t, server1, ch.ownerConnection) })
+	}
+
+	updateEntities := func(ch *Channel, entities map[uint32]*proto.SpatialEntityInfo) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{Entities: entities})
+		ch.PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, ch.getOwner(), &proto.MessagePack{
+			ChannelId: uint32(ch.id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	for i, ch := range channels {
+		entities := make(map[uint32]*proto.SpatialEntityInfo)
+		for j := 0; j < 3; j++ {
+			entities[uint32(i*10+j+1)] = &proto.SpatialEntityInfo{Loc: &proto.Location{X: float64(i*10 + j + 1)}}
+		}
+		updateEntities(ch, entities)
+	}
+	assert.Eventually(t, func() bool {
+		for _, ch := range channels {
+			if atomic.LoadInt32(&ch.spatialEntityNum) != 3 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+
+	prepareNum := func(c *Connection) int {
+		num := 0
+		for _, msg := range c.testQueue() {
+			if _, ok := msg.(*proto.HandoverPrepareMessage); ok {
+				num++
+			}
+		}
+		return num
+	}
+	acceptAll := func(c *Connection) int {
+		accepted := 0
+		for _, msg := range c.testQueue() {
+			if prepare, ok := msg.(*proto.HandoverPrepareMessage); ok {
+				assert.True(t, prepare.WholeChannel)
+				assert.Equal(t, prepare.SrcChannelId, prepare.DstChannelId)
+				handleHandoverPrepareResult(MessageContext{
+					MsgType:    proto.MessageType_HANDOVER_PREPARE,
+					Msg:        &proto.HandoverPrepareResultMessage{HandoverId: prepare.HandoverId, Accepted: true},
+					Connection: c,
+					Channel:    defaultServer.globalChannel,
+				})
+				accepted++
+			}
+		}
+		return accepted
+	}
+
+	// 12 entities in server1's region. Split the upper half on the X axis to server2.
+	controller.balance()
+	assert.Eventually(t, func() bool {
+		return prepareNum(server2) == 2
+	}, time.Second, 10*time.Millisecond)
+	// Don't split again while handing over
+	controller.balance()
+	assert.Equal(t, 2, acceptAll(server2))
+	assert.Eventually(t, func() bool {
+		return channels[2].getOwner() == server2 && channels[3].getOwner() == server2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, server1, channels[0].getOwner())
+	assert.Equal(t, server1, channels[1].getOwner())
+	executeAndWait(channels[3], func(ch *Channel) {
+		assert.NotContains(t, ch.subscribedConnections, server1.id)
+		if assert.Contains(t, ch.subscribedConnections, server2.id) {
+			assert.True(t, ch.subscribedConnections[server2.id].options.CanUpdateData)
+		}
+		assert.Equal(t, OPEN, ch.state)
+	})
+
+	// Not overloaded any more
+	controller.balance()
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, server1, channels[1].getOwner())
+
+	// Remove the entities in server1's region and merge it into server2's.
+	for i, ch := range channels[:2] {
+		entities := make(map[uint32]*proto.SpatialEntityInfo)
+		for j := 0; j < 3; j++ {
+			entities[uint32(i*10+j+1)] = &proto.SpatialEntityInfo{Removed: true}
+		}
+		updateEntities(ch, entities)
+	}
+	updateEntities(channels[3], map[uint32]*proto.SpatialEntityInfo{31: {Removed: true}, 32: {Removed: true}, 33: {Removed: true}})
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&channels[0].spatialEntityNum) == 0 && atomic.LoadInt32(&channels[1].spatialEntityNum) == 0 && atomic.LoadInt32(&channels[3].spatialEntityNum) == 0
+	}, time.Second, 10*time.Millisecond)
+	server2.clearTestQueue()
+	controller.balance()
+	assert.Eventually(t, func() bool {
+		return prepareNum(server2) == 2
+	}, time.Second, 10*time.Millisecond)
+	assert.Equal(t, 2, acceptAll(server2))
+	assert.Eventually(t, func() bool {
+		for _, ch := range channels {
+			if ch.getOwner() != server2 {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSpatialSubdivide(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+		Balance: &SpatialBalanceSettings{
+			SplitEntityNum:      4,
+			MaxSubdivisionDepth: 1,
+		},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server1 := addTestConnection(proto.ConnectionType_SERVER)
+	server2 := addTestConnection(proto.ConnectionType_SERVER)
+	setTestChannelOwner(channels[0], server1)
+	setTestChannelOwner(channels[1], server2)
+	// Stands by as there's no channel to own.
+	idleServer := addTestConnection(proto.ConnectionType_SERVER)
+	handleCreateChannel(MessageContext{
+		MsgType:    proto.MessageType_CREATE_CHANNEL,
+		Msg:        &proto.CreateChannelMessage{ChannelType: proto.ChannelType_SPATIAL},
+		Connection: idleServer,
+		Channel:    defaultServer.globalChannel,
+	})
+
+	// 6 entities in the first cell: 2 in the lower half, 4 in the upper half.
+	entities := make(map[uint32]*proto.SpatialEntityInfo)
+	for i, x := range []float64{1, 2, 6, 7, 8, 9} {
+		entities[uint32(i+1)] = &proto.SpatialEntityInfo{Loc: &proto.Location{X: x}}
+	}
+	any, _ := anypb.New(&proto.SpatialChannelDataMessage{Entities: entities})
+	channels[0].PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server1, &proto.MessagePack{
+		ChannelId: uint32(channels[0].id),
+		MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+	})
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&channels[0].spatialEntityNum) == 6
+	}, time.Second, 10*time.Millisecond)
+
+	// The region of server1 has only one channel, so the channel's zone is subdivided.
+	executeAndWait(defaultServer.globalChannel, func(_ *Channel) { controller.balance() })
+	// The split is registered once the new channel's data is initialized.
+	var newChannelId ChannelId
+	assert.Eventually(t, func() bool {
+		newChannelId, _ = controller.GetChannelId(&proto.Location{X: 5})
+		return newChannelId != channels[0].id
+	}, time.Second, 10*time.Millisecond)
+	id, _ := controller.GetChannelId(&proto.Location{X: 4.9})
+	assert.Equal(t, channels[0].id, id)
+	id, _ = controller.GetChannelId(&proto.Location{X: 15})
+	assert.Equal(t, channels[1].id, id)
+	result, err := controller.QueryChannelIds(&proto.Location{X: 15}, &proto.SpatialInterestArea{
+		Area: &proto.SpatialInterestArea_Border_{Border: &proto.SpatialInterestArea_Border{CellNum: 1}},
+	})
+	assert.NoError(t, err)
+	assert.EqualValues(t, 1, result[newChannelId])
+	newChannel := defaultServer.GetChannel(newChannelId)
+	assert.Equal(t, idleServer, newChannel.getOwner())
+	assert.Equal(t, "0,0,0/1", newChannel.metadata)
+
+	// The entities in the upper half are handed over to the idle server.
+	prepares := func() []*proto.HandoverPrepareMessage {
+		result := make([]*proto.HandoverPrepareMessage, 0)
+		for _, msg := range idleServer.testQueue() {
+			if prepare, ok := msg.(*proto.HandoverPrepareMessage); ok {
+				result = append(result, prepare)
+			}
+		}
+		return result
+	}
+	assert.Eventually(t, func() bool { return len(prepares()) == 4 }, time.Second, 10*time.Millisecond)
+	// The idle server knows it owns the new channel before the handovers.
+	_, ok := idleServer.testQueue()[0].(*proto.CreateChannelResultMessage)
+	assert.True(t, ok)
+	// Don't balance again while handing over
+	executeAndWait(defaultServer.globalChannel, func(_ *Channel) { controller.balance() })
+	assert.Len(t, prepares(), 4)
+
+	for _, prepare := range prepares() {
+		assert.False(t, prepare.WholeChannel)
+		assert.EqualValues(t, newChannelId, prepare.DstChannelId)
+		handleHandoverPrepareResult(MessageContext{
+			MsgType:    proto.MessageType_HANDOVER_PREPARE,
+			Msg:        &proto.HandoverPrepareResultMessage{HandoverId: prepare.HandoverId, Accepted: true},
+			Connection: idleServer,
+			Channel:    defaultServer.globalChannel,
+		})
+	}
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&channels[0].spatialEntityNum) == 2 && atomic.LoadInt32(&newChannel.spatialEntityNum) == 4
+	}, time.Second, 10*time.Millisecond)
+
+	// Can't be subdivided any more
+	any, _ = anypb.New(&proto.SpatialChannelDataMessage{Entities: map[uint32]*proto.SpatialEntityInfo{
+		11: {Loc: &proto.Location{X: 1}}, 12: {Loc: &proto.Location{X: 2}}, 13: {Loc: &proto.Location{X: 3}},
+	}})
+	channels[0].PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server1, &proto.MessagePack{
+		ChannelId: uint32(channels[0].id),
+		MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+	})
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&channels[0].spatialEntityNum) == 5
+	}, time.Second, 10*time.Millisecond)
+	idleServer2 := addTestConnection(proto.ConnectionType_SERVER)
+	defaultServer.spatialServers.Store(idleServer2.id, idleServer2)
+	executeAndWait(defaultServer.globalChannel, func(_ *Channel) { controller.balance() })
+	id, _ = controller.GetChannelId(&proto.Location{X: 1})
+	assert.Equal(t, channels[0].id, id)
+	assert.Empty(t, idleServer2.testQueue())
+}
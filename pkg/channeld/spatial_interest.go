@@ -0,0 +1,206 @@
+package channeld
+
+import (
+	"sync"
+
+	"channeld.clewcat.com/channeld/proto"
+	"go.uber.org/zap"
+)
+
+// The player entity attached to a connection, and its interest area.
+type spatialInterest struct {
+	conn     *Connection
+	entityId uint32
+	area     *proto.SpatialInterestArea // Nil means the spatial channels are not subscribed automatically (followEntity).
+	// Guards the fields below, as the entity can be updated in different spatial channels' goroutines.
+	lock     sync.Mutex
+	channels map[ChannelId]uint32 // The spatial channels subscribed by the interest, and their fan-out intervals.
+	retired  bool                 // Replaced by another interest of the connection.
+}
+
+func handleSpatialInterest(ctx MessageContext) {
+	s := ctx.Channel.server
+	if ctx.Channel != s.globalChannel {
+		ctx.Connection.Logger().Error("illegal attemp to set spatial interest outside the GLOBAL channel")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_WRONG_CHANNEL, "should set spatial interest in the GLOBAL channel")
+		return
+	}
+
+	msg, ok := ctx.Msg.(*proto.SpatialInterestMessage)
+	if !ok {
+		ctx.Connection.Logger().Error("message is not a SpatialInterestMessage, will not be handled.")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_INVALID_MESSAGE, "message is not a SpatialInterestMessage")
+		return
+	}
+
+	if s.spatialController == nil {
+		ctx.Connection.Logger().Error("failed to set spatial interest as the spatial controller is not enabled")
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_FEATURE_DISABLED, "the spatial controller is not enabled")
+		return
+	}
+
+	conn := s.GetConnection(ConnectionId(msg.ConnId))
+	if conn == nil {
+		ctx.Connection.Logger().Error("invalid ConnectionId for spatial interest", zap.Uint32("connId", msg.ConnId))
+		ctx.Connection.sendError(ctx, proto.ErrorResultMessage_CONNECTION_NOT_FOUND, "the connection does not exist")
+		return
+	}
+
+	// Retire the old interest and take over its subscriptions.
+	channels := make(map[ChannelId]uint32)
+	if old := conn.spatialInterest; old != nil {
+		s.spatialInterests.Delete(old.entityId)
+		old.lock.Lock()
+		channels = old.channels
+		old.retired = true
+		old.lock.Unlock()
+	}
+
+	if msg.Area == nil && !msg.FollowEntity {
+		conn.spatialInterest = nil
+		for chId := range channels {
+			conn.unsubscribeFromSpatialChannel(chId)
+		}
+		conn.Logger().Info("detached the player entity", zap.Int("unsubscribed", len(channels)))
+		return
+	}
+
+	conn.spatialInterest = &spatialInterest{
+		conn:     conn,
+		entityId: msg.EntityId,
+		area:     msg.Area,
+		channels: channels,
+	}
+	s.spatialInterests.Store(msg.EntityId, conn.spatialInterest)
+	conn.Logger().Info("attached the player entity", zap.Uint32("entityId", msg.EntityId), zap.Bool("hasArea", msg.Area != nil))
+}
+
+// Updates the subscriptions of the connections whose player entities' locations are changed in the update message.
+func (ch *Channel) updateSpatialInterests(updateMsg *proto.SpatialChannelDataMessage) {
+	s := ch.server
+	if s.spatialController == nil {
+		return
+	}
+	for entityId, info := range updateMsg.Entities {
+		if info.Removed || info.Loc == nil {
+			continue
+		}
+		v, exists := s.spatialInterests.Load(entityId)
+		if !exists {
+			continue
+		}
+		v.(*spatialInterest).update(info.Loc)
+	}
+}
+
+// Interpolates the fan-out interval between the near and far ones by the distance.
+func (i *spatialInterest) fanOutIntervalMs(distance uint, maxDistance uint) uint32 {
+	near := int64(i.area.NearFanOutIntervalMs)
+	far := int64(i.area.FarFanOutIntervalMs)
+	if far == 0 {
+		far = near
+	}
+	if maxDistance == 0 {
+		return uint32(near)
+	}
+	return uint32(near + (far-near)*int64(distance)/int64(maxDistance))
+}
+
+func (i *spatialInterest) update(loc *proto.Location) {
+	s := i.conn.server
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	if i.retired || i.area == nil {
+		return
+	}
+	if i.conn.IsRemoving() {
+		s.spatialInterests.Delete(i.entityId)
+		return
+	}
+
+	distances, err := s.spatialController.QueryChannelIds(loc, i.area)
+	if err != nil {
+		i.conn.Logger().Warn("failed to query the spatial channels in the interest area", zap.Uint32("entityId", i.entityId), zap.Error(err))
+		return
+	}
+
+	maxDistance := uint(0)
+	for _, d := range distances {
+		if d > maxDistance {
+			maxDistance = d
+		}
+	}
+
+	channels := make(map[ChannelId]uint32, len(distances))
+	for chId, d := range distances {
+		interval := i.fanOutIntervalMs(d, maxDistance)
+		channels[chId] = interval
+		if oldInterval, exists := i.channels[chId]; !exists || oldInterval != interval {
+			i.conn.subscribeToSpatialChannel(chId, interval)
+		}
+	}
+	for chId := range i.channels {
+		if _, exists := channels[chId]; !exists {
+			i.conn.unsubscribeFromSpatialChannel(chId)
+		}
+	}
+	i.channels = channels
+}
+
+// Subscribes the connection to the spatial channel in the channel's goroutine, or updates the fan-out interval if already subscribed.
+func (c *Connection) subscribeToSpatialChannel(chId ChannelId, fanOutIntervalMs uint32) {
+	ch := c.server.GetChannel(chId)
+	if ch == nil {
+		return
+	}
+
+	ch.putMessageContext(MessageContext{
+		MsgType:    proto.MessageType_SUB_TO_CHANNEL,
+		Connection: c,
+		Channel:    ch,
+		ChannelId:  uint32(chId),
+	}, func(ctx MessageContext) {
+		if fanOutIntervalMs == 0 {
+			fanOutIntervalMs = c.server.GetChannelSettings(ctx.Channel.channelType).DefaultFanOutIntervalMs
+		}
+
+		if cs, exists := ctx.Channel.subscribedConnections[c.id]; exists {
+			cs.options.FanOutIntervalMs = fanOutIntervalMs
+			return
+		}
+
+		// The connection can only receive the updates of the spatial channel.
+		subOptions := &proto.ChannelSubscriptionOptions{
+			CanUpdateData:    false,
+			FanOutIntervalMs: fanOutIntervalMs,
+		}
+		c.SubscribeToChannel(ctx.Channel, subOptions)
+		c.sendSubscribed(ctx, ctx.Channel, c, 0, subOptions)
+		if ctx.Channel.ownerConnection != nil && ctx.Channel.ownerConnection != c {
+			ctx.Channel.ownerConnection.sendSubscribed(ctx, ctx.Channel, c, 0, subOptions)
+		}
+	})
+}
+
+func (c *Connection) unsubscribeFromSpatialChannel(chId ChannelId) {
+	ch := c.server.GetChannel(chId)
+	if ch == nil {
+		return
+	}
+
+	ch.putMessageContext(MessageContext{
+		MsgType:    proto.MessageType_UNSUB_FROM_CHANNEL,
+		Connection: c,
+		Channel:    ch,
+		ChannelId:  uint32(chId),
+	}, func(ctx MessageContext) {
+		if err := c.UnsubscribeFromChannel(ctx.Channel); err != nil {
+			return
+		}
+		c.sendUnsubscribed(ctx, ctx.Channel, c, 0)
+		if ctx.Channel.ownerConnection != nil && ctx.Channel.ownerConnection != c {
+			ctx.Channel.ownerConnection.sendUnsubscribed(ctx, ctx.Channel, c, 0)
+		}
+	})
+}
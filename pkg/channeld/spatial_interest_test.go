@@ -0,0 +1,156 @@
+package channeld
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestQuerySpatialChannels(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0, Z: 0},
+		WorldMax:  &proto.Location{X: 50, Z: 50},
+		CellCount: [3]uint{5, 1, 5},
+	}
+	channels, _ := controller.CreateChannels()
+	cellChannel := func(x uint, z uint) ChannelId {
+		return channels[controller.cellIndex([3]uint{x, 0, z})].id
+	}
+	center := &proto.Location{X: 25, Y: 100, Z: 25}
+
+	result, err := controller.QueryChannelIds(center, &proto.SpatialInterestArea{
+		Area: &proto.SpatialInterestArea_Border_{Border: &proto.SpatialInterestArea_Border{CellNum: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 9, len(result))
+	assert.EqualValues(t, 0, result[cellChannel(2, 2)])
+	assert.EqualValues(t, 1, result[cellChannel(1, 1)])
+	assert.EqualValues(t, 1, result[cellChannel(3, 2)])
+
+	// The border is clipped by the world
+	result, _ = controller.QueryChannelIds(&proto.Location{X: 0, Z: 0}, &proto.SpatialInterestArea{
+		Area: &proto.SpatialInterestArea_Border_{Border: &proto.SpatialInterestArea_Border{CellNum: 1}},
+	})
+	assert.Equal(t, 4, len(result))
+
+	result, _ = controller.QueryChannelIds(center, &proto.SpatialInterestArea{
+		Area: &proto.SpatialInterestArea_Sphere_{Sphere: &proto.SpatialInterestArea_Sphere{Radius: 5}},
+	})
+	assert.Equal(t, 5, len(result))
+	assert.Contains(t, result, cellChannel(1, 2))
+	assert.NotContains(t, result, cellChannel(1, 1))
+
+	result, _ = controller.QueryChannelIds(center, &proto.SpatialInterestArea{
+		Area: &proto.SpatialInterestArea_Cone_{Cone: &proto.SpatialInterestArea_Cone{
+			Direction: &proto.Location{X: 1},
+			Angle:     math.Pi / 3,
+			Radius:    15,
+		}},
+	})
+	assert.Contains(t, result, cellChannel(2, 2))
+	assert.Contains(t, result, cellChannel(3, 2))
+	assert.Contains(t, result, cellChannel(3, 1))
+	assert.EqualValues(t, 2, result[cellChannel(4, 2)])
+	// Behind the entity
+	assert.NotContains(t, result, cellChannel(1, 2))
+	// Out of the radius
+	assert.NotContains(t, result, cellChannel(4, 1))
+
+	_, err = controller.QueryChannelIds(center, &proto.SpatialInterestArea{})
+	assert.Error(t, err)
+}
+
+func TestSpatialInterest(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 30},
+		CellCount: [3]uint{3, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	handleCreateChannel(MessageContext{
+		MsgType:    proto.MessageType_CREATE_CHANNEL,
+		Msg:        &proto.CreateChannelMessage{ChannelType: proto.ChannelType_SPATIAL},
+		Connection: server,
+		Channel:    defaultServer.globalChannel,
+	})
+
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	handleSpatialInterest(MessageContext{
+		MsgType: proto.MessageType_SPATIAL_INTEREST,
+		Msg: &proto.SpatialInterestMessage{
+			ConnId:   uint32(client.id),
+			EntityId: 1,
+			Area: &proto.SpatialInterestArea{
+				Area:                 &proto.SpatialInterestArea_Sphere_{Sphere: &proto.SpatialInterestArea_Sphere{Radius: 5}},
+				NearFanOutIntervalMs: 10,
+				FarFanOutIntervalMs:  50,
+			},
+		},
+		Connection: server,
+		Channel:    defaultServer.globalChannel,
+	})
+
+	updateEntity := func(ch *Channel, x float64) {
+		any, _ := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{1: {Loc: &proto.Location{X: x}}},
+		})
+		ch.PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server, &proto.MessagePack{
+			ChannelId: uint32(ch.id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	fanOutInterval := func(ch *Channel) uint32 {
+		cs, exists := ch.subscribedConnections[client.id]
+		if !exists {
+			return 0
+		}
+		return cs.options.FanOutIntervalMs
+	}
+
+	updateEntity(channels[0], 5)
+	assert.Eventually(t, func() bool {
+		return fanOutInterval(channels[0]) == 10 && fanOutInterval(channels[1]) == 50
+	}, time.Second, 10*time.Millisecond)
+	assert.False(t, channels[0].subscribedConnections[client.id].options.CanUpdateData)
+	assert.NotContains(t, channels[2].subscribedConnections, client.id)
+
+	// Move to the third cell
+	updateEntity(channels[0], 25)
+	assert.Eventually(t, func() bool {
+		return fanOutInterval(channels[2]) == 10 && fanOutInterval(channels[1]) == 50
+	}, time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		_, exists := channels[0].subscribedConnections[client.id]
+		return !exists
+	}, time.Second, 10*time.Millisecond)
+
+	// Clear the interest with a null area
+	handleSpatialInterest(MessageContext{
+		MsgType:    proto.MessageType_SPATIAL_INTEREST,
+		Msg:        &proto.SpatialInterestMessage{ConnId: uint32(client.id), EntityId: 1},
+		Connection: server,
+		Channel:    defaultServer.globalChannel,
+	})
+	assert.Eventually(t, func() bool {
+		for _, ch := range channels {
+			if _, exists := ch.subscribedConnections[client.id]; exists {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 10*time.Millisecond)
+	_, exists := defaultServer.spatialInterests.Load(uint32(1))
+	assert.False(t, exists)
+}
@@ -0,0 +1,129 @@
+package channeld
+
+import (
+	"testing"
+	"time"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+	protobuf "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+)
+
+func TestStaticGridSpatialController(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	// 2D grid on the XZ plane
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: -100, Z: -100},
+		WorldMax:  &proto.Location{X: 100, Z: 100},
+		CellCount: [3]uint{2, 1, 2},
+	}
+	channels, err := controller.CreateChannels()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(channels))
+	for _, ch := range channels {
+		assert.Equal(t, proto.ChannelType_SPATIAL, ch.channelType)
+		// The data is initialized in the channel's goroutine.
+		executeAndWait(ch, func(ch *Channel) { assert.NotNil(t, ch.Data()) })
+	}
+	assert.Equal(t, "1,0,1", channels[3].metadata)
+
+	id, err := controller.GetChannelId(&proto.Location{X: -50, Y: 1000, Z: -50})
+	assert.NoError(t, err)
+	assert.Equal(t, channels[0].id, id)
+	id, _ = controller.GetChannelId(&proto.Location{X: 50, Z: -50})
+	assert.Equal(t, channels[1].id, id)
+	id, _ = controller.GetChannelId(&proto.Location{X: -50, Z: 50})
+	assert.Equal(t, channels[2].id, id)
+	// The max bound belongs to the last cell
+	id, _ = controller.GetChannelId(&proto.Location{X: 100, Z: 100})
+	assert.Equal(t, channels[3].id, id)
+	_, err = controller.GetChannelId(&proto.Location{X: 101, Z: 0})
+	assert.Error(t, err)
+
+	// 3D grid
+	controller = &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0, Y: 0, Z: 0},
+		WorldMax:  &proto.Location{X: 30, Y: 20, Z: 10},
+		CellCount: [3]uint{3, 2, 1},
+	}
+	channels, err = controller.CreateChannels()
+	assert.NoError(t, err)
+	assert.Equal(t, 6, len(channels))
+	id, _ = controller.GetChannelId(&proto.Location{X: 25, Y: 15, Z: 5})
+	assert.Equal(t, channels[5].id, id)
+	id, _ = controller.GetChannelId(&proto.Location{X: 15, Y: 5, Z: 5})
+	assert.Equal(t, channels[1].id, id)
+
+	_, err = (&StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 0},
+		CellCount: [3]uint{2, 1, 1},
+	}).CreateChannels()
+	assert.Error(t, err)
+}
+
+func TestMoveSpatialEntity(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+	controller := &StaticGridSpatialController{
+		WorldMin:  &proto.Location{X: 0},
+		WorldMax:  &proto.Location{X: 20},
+		CellCount: [3]uint{2, 1, 1},
+	}
+	channels, _ := controller.CreateChannels()
+	SetSpatialController(controller)
+	defer SetSpatialController(nil)
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	handleCreateChannel(MessageContext{
+		MsgType:    proto.MessageType_CREATE_CHANNEL,
+		Msg:        &proto.CreateChannelMessage{ChannelType: proto.ChannelType_SPATIAL},
+		Connection: server,
+		Channel:    defaultServer.globalChannel,
+	})
+	// The channels are claimed in their own goroutines.
+	for _, ch := range channels {
+		executeAndWait(ch, func(ch *Channel) {
+			assert.Equal(t, server, ch.ownerConnection)
+			assert.NotNil(t, ch.subscribedConnections[server.id])
+		})
+	}
+
+	updateEntity := func(ch *Channel, entityId uint32, x float64) {
+		any, err := anypb.New(&proto.SpatialChannelDataMessage{
+			Entities: map[uint32]*proto.SpatialEntityInfo{entityId: {Loc: &proto.Location{X: x}}},
+		})
+		assert.NoError(t, err)
+		ch.PutMessage(&proto.ChannelDataUpdateMessage{Data: any}, handleChannelDataUpdate, server, &proto.MessagePack{
+			ChannelId: uint32(ch.id),
+			MsgType:   uint32(proto.MessageType_CHANNEL_DATA_UPDATE),
+		})
+	}
+	// Reads the entity in the channel's goroutine, as the channel merges the updates into the same map.
+	entity := func(ch *Channel, entityId uint32) *proto.SpatialEntityInfo {
+		var info *proto.SpatialEntityInfo
+		executeAndWait(ch, func(ch *Channel) {
+			if e := ch.Data().msg.(*proto.SpatialChannelDataMessage).Entities[entityId]; e != nil {
+				info = protobuf.Clone(e).(*proto.SpatialEntityInfo)
+			}
+		})
+		return info
+	}
+
+	updateEntity(channels[0], 1, 5)
+	assert.Eventually(t, func() bool { return entity(channels[0], 1) != nil }, time.Second, 10*time.Millisecond)
+
+	// Move to the second cell
+	updateEntity(channels[0], 1, 15)
+	assert.Eventually(t, func() bool { return entity(channels[1], 1) != nil }, time.Second, 10*time.Millisecond)
+	assert.EqualValues(t, 15, entity(channels[1], 1).Loc.X)
+	assert.Eventually(t, func() bool { return entity(channels[0], 1) == nil }, time.Second, 10*time.Millisecond)
+
+	// Out of the world
+	updateEntity(channels[1], 1, 100)
+	assert.Eventually(t, func() bool { e := entity(channels[1], 1); return e != nil && e.Loc.X == 100 }, time.Second, 10*time.Millisecond)
+	assert.Nil(t, entity(channels[0], 1))
+}
@@ -1,28 +1,99 @@
-package channeld
-
-import (
-	"testing"
-
-	"channeld.clewcat.com/channeld/proto"
-	"github.com/stretchr/testify/assert"
-)
-
-func TestSubscribeToChannel(t *testing.T) {
-	InitLogsAndMetrics()
-	c1 := &Connection{id: 1, connectionType: proto.ConnectionType_SERVER}
-	//c2 := &Connection{id: 2, connectionType: SERVER}
-	//c3 := &Connection{id: 3, connectionType: CLIENT}
-
-	InitChannels()
-	assert.NotNil(t, globalChannel)
-	// Can't create the GLOBAL channel
-	_, err := CreateChannel(proto.ChannelType_GLOBAL, nil)
-	assert.Error(t, err)
-	// By default, the GLOBAL channel has no owner
-	assert.Nil(t, globalChannel.ownerConnection)
-
-	globalChannel.ownerConnection = c1
-	c1.SubscribeToChannel(globalChannel, nil)
-	assert.Contains(t, globalChannel.subscribedConnections, c1.id)
-
-}
+package channeld
+
+import (
+	"testing"
+
+	"channeld.clewcat.com/channeld/proto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscribeToChannel(t *testing.T) {
+	InitLogsAndMetrics()
+	c1 := &Connection{id: 1, connectionType: proto.ConnectionType_SERVER}
+	//c2 := &Connection{id: 2, connectionType: SERVER}
+	//c3 := &Connection{id: 3, connectionType: CLIENT}
+
+	InitChannels()
+	assert.NotNil(t, defaultServer.globalChannel)
+	// Can't create the GLOBAL channel
+	_, err := CreateChannel(proto.ChannelType_GLOBAL, nil)
+	assert.Error(t, err)
+	// By default, the GLOBAL channel has no owner
+	assert.Nil(t, defaultServer.globalChannel.getOwner())
+
+	setTestChannelOwner(defaultServer.globalChannel, c1)
+	c1.SubscribeToChannel(defaultServer.globalChannel, nil)
+	assert.Contains(t, defaultServer.globalChannel.subscribedConnections, c1.id)
+
+}
+
+func TestSubOtherConnectionAuthority(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	client1 := addTestConnection(proto.ConnectionType_CLIENT)
+	client2 := addTestConnection(proto.ConnectionType_CLIENT)
+	client1.setClaims(&AuthClaims{UserId: "player1"})
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	freezeTestChannel(ch)
+
+	sub := func(sender *Connection, connToSub *Connection) {
+		handleSubToChannel(MessageContext{
+			MsgType:    proto.MessageType_SUB_TO_CHANNEL,
+			Msg:        &proto.SubscribedToChannelMessage{ConnId: uint32(connToSub.id)},
+			Connection: sender,
+			Channel:    ch,
+		})
+	}
+	unsub := func(sender *Connection, connToUnsub *Connection) {
+		handleUnsubFromChannel(MessageContext{
+			MsgType:    proto.MessageType_UNSUB_FROM_CHANNEL,
+			Msg:        &proto.UnsubscribedFromChannelMessage{ConnId: uint32(connToUnsub.id)},
+			Connection: sender,
+			Channel:    ch,
+		})
+	}
+
+	// A client can't sub the channel owner, even though the owner has authority over the channel.
+	sub(client1, server)
+	assert.NotContains(t, ch.subscribedConnections, server.id)
+	assert.Equal(t, proto.ErrorResultMessage_NO_AUTHORITY, client1.latestMsg().(*proto.ErrorResultMessage).Code)
+
+	// The channel owner can sub another connection.
+	sub(server, client2)
+	assert.Contains(t, ch.subscribedConnections, client2.id)
+
+	// A client can't unsub another connection.
+	sub(client1, client1)
+	assert.Contains(t, ch.subscribedConnections, client1.id)
+	unsub(client1, client2)
+	assert.Contains(t, ch.subscribedConnections, client2.id)
+	assert.Equal(t, proto.ErrorResultMessage_NO_AUTHORITY, client1.latestMsg().(*proto.ErrorResultMessage).Code)
+
+	// The channel owner can unsub another connection.
+	unsub(server, client1)
+	assert.NotContains(t, ch.subscribedConnections, client1.id)
+}
+
+func TestSubOtherConnectionMergeOptions(t *testing.T) {
+	InitLogsAndMetrics()
+	InitChannels()
+
+	server := addTestConnection(proto.ConnectionType_SERVER)
+	client := addTestConnection(proto.ConnectionType_CLIENT)
+	ch, _ := CreateChannel(proto.ChannelType_TEST, server)
+	freezeTestChannel(ch)
+	server.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 20})
+	client.SubscribeToChannel(ch, &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 50})
+
+	// The options are merged into the subscription of the subbed connection, not the sender's.
+	handleSubToChannel(MessageContext{
+		MsgType:    proto.MessageType_SUB_TO_CHANNEL,
+		Msg:        &proto.SubscribedToChannelMessage{ConnId: uint32(client.id), SubOptions: &proto.ChannelSubscriptionOptions{FanOutIntervalMs: 100}},
+		Connection: server,
+		Channel:    ch,
+	})
+	assert.EqualValues(t, 100, ch.subscribedConnections[client.id].options.FanOutIntervalMs)
+	assert.EqualValues(t, 20, ch.subscribedConnections[server.id].options.FanOutIntervalMs)
+}
@@ -0,0 +1,80 @@
+package fsm
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+func (opts *Options) msgTypeLabel(msgType uint32) string {
+	if opts.MsgTypeName != nil {
+		if name := opts.MsgTypeName(msgType); name != "" {
+			return fmt.Sprintf("%s (%d)", name, msgType)
+		}
+	}
+	return strconv.FormatUint(uint64(msgType), 10)
+}
+
+// Writes the FSM as a Graphviz DOT graph. The initial state is pointed by an arrow, and the terminal states have double borders.
+// The transitions are solid edges, the timeouts are dashed edges, and the moves by the NextStateMsgTypes are dotted edges.
+func (fsm *FiniteStateMachine) WriteDOT(w io.Writer, opts Options) error {
+	var sb strings.Builder
+	sb.WriteString("digraph FSM {\n")
+	sb.WriteString("\trankdir=LR;\n")
+	sb.WriteString("\tnode [shape=box];\n")
+	sb.WriteString("\t__init [shape=point];\n")
+	fmt.Fprintf(&sb, "\t__init -> %s;\n", strconv.Quote(fsm.currentState.Name))
+
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		label := state.Name
+		if state.MsgTypeWhitelist != "" {
+			label += "\nallow: " + state.MsgTypeWhitelist
+		}
+		if state.MsgTypeBlacklist != "" {
+			label += "\ndeny: " + state.MsgTypeBlacklist
+		}
+		for _, rule := range state.RoleRules {
+			label += "\n" + rule.Role + " only: " + rule.MsgTypes
+		}
+		attrs := "label=" + strconv.Quote(label)
+		if state.Terminal {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(&sb, "\t%s [%s];\n", strconv.Quote(state.Name), attrs)
+	}
+
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		// Sorts the transitions by the message type, so the output is stable.
+		msgTypes := make([]uint32, 0, len(state.transitions))
+		for msgType := range state.transitions {
+			msgTypes = append(msgTypes, msgType)
+		}
+		sort.Slice(msgTypes, func(i, j int) bool {
+			return msgTypes[i] < msgTypes[j]
+		})
+		for _, msgType := range msgTypes {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=%s];\n", strconv.Quote(state.Name), strconv.Quote(state.transitions[msgType].Name), strconv.Quote(opts.msgTypeLabel(msgType)))
+		}
+
+		if state.timeoutState != nil {
+			fmt.Fprintf(&sb, "\t%s -> %s [label=%s, style=dashed];\n", strconv.Quote(state.Name), strconv.Quote(state.timeoutState.Name), strconv.Quote(fmt.Sprintf("timeout %dms", state.TimeoutMs)))
+		}
+
+		if next := fsm.stateAfter(state); next != nil {
+			for _, msgType := range opts.NextStateMsgTypes {
+				// Skips the same move as the transition.
+				if state.allowedMsgTypes[msgType] && state.transitions[msgType] != next {
+					fmt.Fprintf(&sb, "\t%s -> %s [label=%s, style=dotted];\n", strconv.Quote(state.Name), strconv.Quote(next.Name), strconv.Quote(opts.msgTypeLabel(msgType)))
+				}
+			}
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
@@ -1,151 +1,287 @@
-package fsm
-
-import (
-	"encoding/json"
-	"errors"
-	"strconv"
-	"strings"
-
-	"go.uber.org/zap"
-)
-
-type State struct {
-	Name             string
-	MsgTypeWhitelist string // example: "1, 2-10, 30"
-	MsgTypeBlacklist string
-
-	allowedMsgTypes map[uint32]bool
-	transitions     map[uint32]*State
-}
-
-type StateTransition struct {
-	FromState string
-	ToState   string
-	MsgType   uint32
-}
-
-type FiniteStateMachine struct {
-	InitState   *string
-	States      []State
-	Transitions []StateTransition
-
-	currentState *State
-	stateNameMap map[string]*State
-}
-
-func parseMsgTypes(s string, f func(msgType uint32)) {
-	if len(s) == 0 {
-		return
-	}
-
-	for _, seg := range strings.Split(s, ",") {
-		seg = strings.Trim(seg, " ")
-		fromTo := strings.Split(seg, "-")
-		if len(fromTo) == 1 {
-			msgType, err := strconv.ParseUint(fromTo[0], 10, 32)
-			if err != nil {
-				logger.Errorf("Can't convert '%s' to uint32\n", fromTo[0])
-			} else {
-				f(uint32(msgType))
-			}
-		} else {
-			fromType, err := strconv.ParseUint(fromTo[0], 10, 32)
-			if err != nil {
-				logger.Errorf("Can't convert '%s' to uint32\n", fromTo[0])
-			} else {
-				toType, err := strconv.ParseUint(fromTo[1], 10, 32)
-				if err != nil {
-					logger.Errorf("Can't convert '%s' to uint32\n", fromTo[1])
-				} else {
-					for i := fromType; i <= toType; i += 1 {
-						f(uint32(i))
-					}
-				}
-
-			}
-		}
-	}
-}
-
-var logger *zap.SugaredLogger
-
-func Load(bytes []byte) (FiniteStateMachine, error) {
-	if logger == nil {
-		l, _ := zap.NewProduction()
-		defer l.Sync()
-		logger = l.Sugar()
-	}
-
-	var fsm FiniteStateMachine
-	err := json.Unmarshal(bytes, &fsm)
-	if err == nil {
-		fsm.currentState = &fsm.States[0]
-		fsm.stateNameMap = make(map[string]*State, len(fsm.States))
-
-		for idx := range fsm.States {
-			state := &fsm.States[idx]
-			state.allowedMsgTypes = make(map[uint32]bool)
-			state.transitions = make(map[uint32]*State)
-			fsm.stateNameMap[state.Name] = state
-			parseMsgTypes(state.MsgTypeWhitelist, func(msgType uint32) {
-				state.allowedMsgTypes[msgType] = true
-			})
-			parseMsgTypes(state.MsgTypeBlacklist, func(msgType uint32) {
-				state.allowedMsgTypes[msgType] = false
-			})
-		}
-
-		for _, transition := range fsm.Transitions {
-			fromState, exists := fsm.stateNameMap[transition.FromState]
-			if !exists {
-				logger.Errorf("invalid FromState in StateTransition: %s -> %s (%d)\n", transition.FromState, transition.ToState, transition.MsgType)
-				continue
-			}
-			toState, exists := fsm.stateNameMap[transition.ToState]
-			if !exists {
-				logger.Errorf("invalid ToState in StateTransition: %s -> %s (%d)\n", transition.FromState, transition.ToState, transition.MsgType)
-				continue
-			}
-			fromState.transitions[transition.MsgType] = toState
-		}
-
-		if fsm.InitState != nil {
-			err = fsm.ChangeState(*fsm.InitState)
-		}
-	}
-	return fsm, err
-}
-
-func (fsm *FiniteStateMachine) IsAllowed(msgType uint32) bool {
-	return fsm.currentState.allowedMsgTypes[msgType]
-}
-
-func (fsm *FiniteStateMachine) OnReceived(msgType uint32) {
-	newState := fsm.currentState.transitions[msgType]
-	if newState != nil {
-		fsm.currentState = newState
-	}
-}
-
-func (fsm *FiniteStateMachine) CurrentState() *State {
-	return fsm.currentState
-}
-
-func (fsm *FiniteStateMachine) ChangeState(name string) error {
-	state, exists := fsm.stateNameMap[name]
-	if exists {
-		fsm.currentState = state
-		return nil
-	}
-	return errors.New("Invalid state name: " + name)
-}
-
-func (fsm *FiniteStateMachine) MoveToNextState() bool {
-	for i := 0; i < len(fsm.States)-1; i++ {
-		if fsm.currentState == &fsm.States[i] {
-			fsm.currentState = &fsm.States[i+1]
-			return true
-		}
-	}
-	return false
-}
+package fsm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type State struct {
+	Name             string
+	MsgTypeWhitelist string // example: "1, 2-10, 30"
+	MsgTypeBlacklist string
+	TimeoutMs        uint32 // How long the FSM can stay in the state before moving to TimeoutState. 0 means no timeout.
+	TimeoutState     string
+	Terminal         bool // The connection is closed when the FSM enters the state.
+	RoleRules        []RoleRule
+
+	allowedMsgTypes map[uint32]bool
+	requiredRoles   map[uint32][]string // Any of the roles is required. Parsed from RoleRules.
+	transitions     map[uint32]*State
+	timeoutState    *State
+}
+
+// Only allows the message types to the connections that have the role in their verified claims, e.g. {"MsgTypes": "3, 4", "Role": "admin"}.
+// The message types should also be allowed by the whitelist of the state. If multiple rules have the same message type, any of the roles is required.
+type RoleRule struct {
+	MsgTypes string
+	Role     string
+}
+
+// The verified identity of the connection, which the RoleRules are checked against.
+type Claims interface {
+	HasRole(role string) bool
+}
+
+type StateTransition struct {
+	FromState string
+	ToState   string
+	MsgType   uint32
+}
+
+type FiniteStateMachine struct {
+	InitState   *string
+	States      []State
+	Transitions []StateTransition
+
+	currentState *State
+	stateNameMap map[string]*State
+	onChanged    func(oldState *State, newState *State)
+}
+
+// An inclusive range of message types, parsed from a segment of the whitelist or blacklist.
+type msgTypeRange struct {
+	from uint32
+	to   uint32
+	seg  string
+}
+
+func parseMsgTypeRanges(s string) ([]msgTypeRange, []error) {
+	if len(s) == 0 {
+		return nil, nil
+	}
+
+	var ranges []msgTypeRange
+	var errs []error
+	for _, seg := range strings.Split(s, ",") {
+		seg = strings.Trim(seg, " ")
+		fromTo := strings.Split(seg, "-")
+		if len(fromTo) > 2 {
+			errs = append(errs, fmt.Errorf("invalid message type range '%s'", seg))
+			continue
+		}
+		fromType, err := strconv.ParseUint(strings.Trim(fromTo[0], " "), 10, 32)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't convert '%s' to uint32", fromTo[0]))
+			continue
+		}
+		toType := fromType
+		if len(fromTo) == 2 {
+			toType, err = strconv.ParseUint(strings.Trim(fromTo[1], " "), 10, 32)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("can't convert '%s' to uint32", fromTo[1]))
+				continue
+			}
+			if toType < fromType {
+				errs = append(errs, fmt.Errorf("invalid message type range '%s'", seg))
+				continue
+			}
+		}
+		ranges = append(ranges, msgTypeRange{from: uint32(fromType), to: uint32(toType), seg: seg})
+	}
+	return ranges, errs
+}
+
+func parseMsgTypes(s string, f func(msgType uint32)) []error {
+	ranges, errs := parseMsgTypeRanges(s)
+	for _, r := range ranges {
+		for i := uint64(r.from); i <= uint64(r.to); i++ {
+			f(uint32(i))
+		}
+	}
+	return errs
+}
+
+var logger *zap.SugaredLogger
+
+// Loads the FSM from the JSON config. The invalid message types and transitions in the config are logged and ignored.
+// Use LoadStrict to fail on them.
+func Load(bytes []byte) (FiniteStateMachine, error) {
+	if logger == nil {
+		l, _ := zap.NewProduction()
+		defer l.Sync()
+		logger = l.Sugar()
+	}
+
+	fsm, configErrs, err := load(bytes)
+	for _, configErr := range configErrs {
+		logger.Error(configErr.Error())
+	}
+	return fsm, err
+}
+
+// Returns the errors in the config that Load ignores, and the error that fails Load.
+func load(bytes []byte) (fsm FiniteStateMachine, configErrs []error, err error) {
+	err = json.Unmarshal(bytes, &fsm)
+	if err == nil && len(fsm.States) == 0 {
+		err = errors.New("the FSM has no state")
+	}
+	if err != nil {
+		return
+	}
+
+	fsm.currentState = &fsm.States[0]
+	fsm.stateNameMap = make(map[string]*State, len(fsm.States))
+
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		state.allowedMsgTypes = make(map[uint32]bool)
+		state.transitions = make(map[uint32]*State)
+		fsm.stateNameMap[state.Name] = state
+		for _, parseErr := range parseMsgTypes(state.MsgTypeWhitelist, func(msgType uint32) {
+			state.allowedMsgTypes[msgType] = true
+		}) {
+			configErrs = append(configErrs, fmt.Errorf("state %s MsgTypeWhitelist: %w", state.Name, parseErr))
+		}
+		for _, parseErr := range parseMsgTypes(state.MsgTypeBlacklist, func(msgType uint32) {
+			state.allowedMsgTypes[msgType] = false
+		}) {
+			configErrs = append(configErrs, fmt.Errorf("state %s MsgTypeBlacklist: %w", state.Name, parseErr))
+		}
+		for _, rule := range state.RoleRules {
+			role := rule.Role
+			if state.requiredRoles == nil {
+				state.requiredRoles = make(map[uint32][]string)
+			}
+			for _, parseErr := range parseMsgTypes(rule.MsgTypes, func(msgType uint32) {
+				state.requiredRoles[msgType] = append(state.requiredRoles[msgType], role)
+			}) {
+				configErrs = append(configErrs, fmt.Errorf("state %s RoleRules[%s]: %w", state.Name, role, parseErr))
+			}
+		}
+	}
+
+	for _, transition := range fsm.Transitions {
+		fromState, exists := fsm.stateNameMap[transition.FromState]
+		if !exists {
+			configErrs = append(configErrs, fmt.Errorf("invalid FromState in StateTransition: %s -> %s (%d)", transition.FromState, transition.ToState, transition.MsgType))
+			continue
+		}
+		toState, exists := fsm.stateNameMap[transition.ToState]
+		if !exists {
+			configErrs = append(configErrs, fmt.Errorf("invalid ToState in StateTransition: %s -> %s (%d)", transition.FromState, transition.ToState, transition.MsgType))
+			continue
+		}
+		fromState.transitions[transition.MsgType] = toState
+	}
+
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		if state.TimeoutMs == 0 && state.TimeoutState == "" {
+			continue
+		}
+		if state.TimeoutMs == 0 || state.TimeoutState == "" {
+			err = fmt.Errorf("state %s should have both TimeoutMs and TimeoutState", state.Name)
+			return
+		}
+		timeoutState, exists := fsm.stateNameMap[state.TimeoutState]
+		if !exists {
+			err = fmt.Errorf("invalid TimeoutState of state %s: %s", state.Name, state.TimeoutState)
+			return
+		}
+		state.timeoutState = timeoutState
+	}
+
+	if fsm.InitState != nil {
+		if changeErr := fsm.ChangeState(*fsm.InitState); changeErr != nil {
+			err = fmt.Errorf("invalid InitState: %w", changeErr)
+		}
+	}
+	return
+}
+
+// 0 means the state never times out.
+func (s *State) Timeout() time.Duration {
+	return time.Duration(s.TimeoutMs) * time.Millisecond
+}
+
+// Sets the function to call when the current state is changed. As the FSM is copied by value, the function should be set after the copy.
+func (fsm *FiniteStateMachine) SetOnStateChanged(f func(oldState *State, newState *State)) {
+	fsm.onChanged = f
+}
+
+func (fsm *FiniteStateMachine) setState(state *State) {
+	oldState := fsm.currentState
+	fsm.currentState = state
+	if state != oldState && fsm.onChanged != nil {
+		fsm.onChanged(oldState, state)
+	}
+}
+
+// Returns if the message type is allowed in the current state, for a connection without any role.
+func (fsm *FiniteStateMachine) IsAllowed(msgType uint32) bool {
+	return fsm.IsAllowedFor(msgType, nil)
+}
+
+// Returns if the message type is allowed in the current state, for a connection with the claims. The claims can be nil.
+func (fsm *FiniteStateMachine) IsAllowedFor(msgType uint32, claims Claims) bool {
+	if !fsm.currentState.allowedMsgTypes[msgType] {
+		return false
+	}
+	roles, exists := fsm.currentState.requiredRoles[msgType]
+	if !exists {
+		return true
+	}
+	if claims == nil {
+		return false
+	}
+	for _, role := range roles {
+		if claims.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (fsm *FiniteStateMachine) OnReceived(msgType uint32) {
+	newState := fsm.currentState.transitions[msgType]
+	if newState != nil {
+		fsm.setState(newState)
+	}
+}
+
+// Moves to the TimeoutState of the current state. Returns false if the current state doesn't time out.
+// The FSM doesn't keep the time; the caller is responsible for calling it when the Timeout() of the current state elapses.
+func (fsm *FiniteStateMachine) OnTimeout() bool {
+	if fsm.currentState.timeoutState == nil {
+		return false
+	}
+	fsm.setState(fsm.currentState.timeoutState)
+	return true
+}
+
+func (fsm *FiniteStateMachine) CurrentState() *State {
+	return fsm.currentState
+}
+
+func (fsm *FiniteStateMachine) ChangeState(name string) error {
+	state, exists := fsm.stateNameMap[name]
+	if exists {
+		fsm.setState(state)
+		return nil
+	}
+	return errors.New("Invalid state name: " + name)
+}
+
+func (fsm *FiniteStateMachine) MoveToNextState() bool {
+	if next := fsm.stateAfter(fsm.currentState); next != nil {
+		fsm.setState(next)
+		return true
+	}
+	return false
+}
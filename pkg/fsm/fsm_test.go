@@ -1,66 +1,263 @@
-package fsm
-
-import (
-	"io/ioutil"
-	"testing"
-
-	"github.com/stretchr/testify/assert"
-)
-
-func loadServerFSM(t *testing.T) FiniteStateMachine {
-	bytes, err := ioutil.ReadFile("../../config/server_conn_fsm_test.json")
-	if err != nil {
-		t.Error(err)
-	}
-	serverFSM, err := Load(bytes)
-	if err != nil {
-		t.Error(err)
-	}
-	return serverFSM
-}
-
-func TestLoad(t *testing.T) {
-	serverFSM := loadServerFSM(t)
-	assert.Equal(t, 3, len(serverFSM.States))
-	assert.Equal(t, 3, len(serverFSM.Transitions))
-	assert.Equal(t, &serverFSM.States[0], serverFSM.CurrentState())
-}
-
-func TestChange(t *testing.T) {
-	serverFSM := loadServerFSM(t)
-	assert.NoError(t, serverFSM.ChangeState("OPEN"))
-	assert.Error(t, serverFSM.ChangeState("BLAH"))
-}
-
-func TestTransitionAndMsgAllowence(t *testing.T) {
-	serverFSM := loadServerFSM(t)
-	assert.Equal(t, "INIT", serverFSM.CurrentState().Name)
-	assert.True(t, serverFSM.IsAllowed(1))
-	assert.False(t, serverFSM.IsAllowed(2))
-	assert.False(t, serverFSM.IsAllowed(9))
-	assert.False(t, serverFSM.IsAllowed(21))
-
-	serverFSM.OnReceived(1)
-	assert.Equal(t, "OPEN", serverFSM.CurrentState().Name)
-	assert.False(t, serverFSM.IsAllowed(1))
-	assert.True(t, serverFSM.IsAllowed(2))
-	assert.False(t, serverFSM.IsAllowed(9))
-	assert.True(t, serverFSM.IsAllowed(20))
-	assert.False(t, serverFSM.IsAllowed(21))
-
-	serverFSM.OnReceived(20)
-	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
-	assert.False(t, serverFSM.IsAllowed(1))
-	assert.False(t, serverFSM.IsAllowed(2))
-	assert.True(t, serverFSM.IsAllowed(21))
-	assert.False(t, serverFSM.IsAllowed(100))
-
-	serverFSM.OnReceived(1)
-	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
-
-	serverFSM.OnReceived(21)
-	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
-
-	serverFSM.OnReceived(22)
-	assert.Equal(t, "OPEN", serverFSM.CurrentState().Name)
-}
+package fsm
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadServerFSM(t *testing.T) FiniteStateMachine {
+	bytes, err := ioutil.ReadFile("../../config/server_conn_fsm_test.json")
+	if err != nil {
+		t.Error(err)
+	}
+	serverFSM, err := Load(bytes)
+	if err != nil {
+		t.Error(err)
+	}
+	return serverFSM
+}
+
+func TestLoad(t *testing.T) {
+	serverFSM := loadServerFSM(t)
+	assert.Equal(t, 3, len(serverFSM.States))
+	assert.Equal(t, 3, len(serverFSM.Transitions))
+	assert.Equal(t, &serverFSM.States[0], serverFSM.CurrentState())
+}
+
+func TestChange(t *testing.T) {
+	serverFSM := loadServerFSM(t)
+	assert.NoError(t, serverFSM.ChangeState("OPEN"))
+	assert.Error(t, serverFSM.ChangeState("BLAH"))
+}
+
+func TestTransitionAndMsgAllowence(t *testing.T) {
+	serverFSM := loadServerFSM(t)
+	assert.Equal(t, "INIT", serverFSM.CurrentState().Name)
+	assert.True(t, serverFSM.IsAllowed(1))
+	assert.False(t, serverFSM.IsAllowed(2))
+	assert.False(t, serverFSM.IsAllowed(9))
+	assert.False(t, serverFSM.IsAllowed(21))
+
+	serverFSM.OnReceived(1)
+	assert.Equal(t, "OPEN", serverFSM.CurrentState().Name)
+	assert.False(t, serverFSM.IsAllowed(1))
+	assert.True(t, serverFSM.IsAllowed(2))
+	assert.False(t, serverFSM.IsAllowed(9))
+	assert.True(t, serverFSM.IsAllowed(20))
+	assert.False(t, serverFSM.IsAllowed(21))
+
+	serverFSM.OnReceived(20)
+	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
+	assert.False(t, serverFSM.IsAllowed(1))
+	assert.False(t, serverFSM.IsAllowed(2))
+	assert.True(t, serverFSM.IsAllowed(21))
+	assert.False(t, serverFSM.IsAllowed(100))
+
+	serverFSM.OnReceived(1)
+	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
+
+	serverFSM.OnReceived(21)
+	assert.Equal(t, "HANDOVER", serverFSM.CurrentState().Name)
+
+	serverFSM.OnReceived(22)
+	assert.Equal(t, "OPEN", serverFSM.CurrentState().Name)
+}
+
+func TestTimeoutAndTerminal(t *testing.T) {
+	_, err := Load([]byte(`{"States": [{"Name": "INIT", "TimeoutMs": 10000}]}`))
+	assert.Error(t, err)
+	_, err = Load([]byte(`{"States": [{"Name": "INIT", "TimeoutState": "INIT"}]}`))
+	assert.Error(t, err)
+	_, err = Load([]byte(`{"States": [{"Name": "INIT", "TimeoutMs": 10000, "TimeoutState": "BLAH"}]}`))
+	assert.Error(t, err)
+
+	clientFSM, err := Load([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1", "TimeoutMs": 10000, "TimeoutState": "KICKED"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-10"},
+			{"Name": "KICKED", "Terminal": true}
+		]
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, 10*time.Second, clientFSM.CurrentState().Timeout())
+	assert.Zero(t, clientFSM.States[1].Timeout())
+	assert.True(t, clientFSM.States[2].Terminal)
+
+	var changes []string
+	clientFSM.SetOnStateChanged(func(oldState *State, newState *State) {
+		changes = append(changes, oldState.Name+"->"+newState.Name)
+	})
+	assert.True(t, clientFSM.OnTimeout())
+	assert.Equal(t, "KICKED", clientFSM.CurrentState().Name)
+	// KICKED doesn't time out
+	assert.False(t, clientFSM.OnTimeout())
+	assert.Equal(t, "KICKED", clientFSM.CurrentState().Name)
+
+	assert.NoError(t, clientFSM.ChangeState("INIT"))
+	assert.True(t, clientFSM.MoveToNextState())
+	// Changing to the current state is not a change.
+	assert.NoError(t, clientFSM.ChangeState("OPEN"))
+	assert.Equal(t, []string{"INIT->KICKED", "KICKED->INIT", "INIT->OPEN"}, changes)
+}
+
+type testClaims []string
+
+func (c testClaims) HasRole(role string) bool {
+	for _, r := range c {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRoleRules(t *testing.T) {
+	clientFSM, err := LoadStrict([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-10", "RoleRules": [
+				{"MsgTypes": "3, 4", "Role": "admin"},
+				{"MsgTypes": "4", "Role": "moderator"}
+			]}
+		]
+	}`), testOptions)
+	assert.NoError(t, err)
+	assert.True(t, clientFSM.MoveToNextState())
+
+	assert.True(t, clientFSM.IsAllowed(2))
+	assert.False(t, clientFSM.IsAllowed(3))
+	assert.False(t, clientFSM.IsAllowedFor(3, nil))
+	assert.False(t, clientFSM.IsAllowedFor(3, testClaims{"moderator"}))
+	assert.True(t, clientFSM.IsAllowedFor(3, testClaims{"admin"}))
+	assert.True(t, clientFSM.IsAllowedFor(4, testClaims{"moderator"}))
+	assert.True(t, clientFSM.IsAllowedFor(4, testClaims{"admin"}))
+	// The role doesn't override the whitelist
+	assert.False(t, clientFSM.IsAllowedFor(11, testClaims{"admin"}))
+
+	_, err = LoadStrict([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1-5", "MsgTypeBlacklist": "5", "RoleRules": [
+				{"MsgTypes": "2"},
+				{"MsgTypes": "5-7, 17, x", "Role": "admin"}
+			]}
+		]
+	}`), testOptions)
+	errs, ok := err.(ValidationErrors)
+	if assert.True(t, ok) {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		assert.ElementsMatch(t, []string{
+			"state INIT RoleRules[admin]: can't convert 'x' to uint32",
+			"state INIT RoleRules[]: empty role",
+			"state INIT RoleRules[admin]: undefined message type '17'",
+			"state INIT RoleRules[admin]: '5-7' is not allowed by the state",
+			"state INIT RoleRules[admin]: '17' is not allowed by the state",
+		}, msgs)
+	}
+}
+
+var testOptions = Options{
+	MsgTypeName: func(msgType uint32) string {
+		switch {
+		case msgType == 1:
+			return "AUTH"
+		case msgType >= 2 && msgType <= 10:
+			return "MSG" + strconv.Itoa(int(msgType))
+		case msgType >= 100:
+			return "USER_SPACE"
+		}
+		return ""
+	},
+	NextStateMsgTypes: []uint32{1},
+}
+
+func TestLoadStrict(t *testing.T) {
+	_, err := LoadStrict([]byte(`{"States": []}`), testOptions)
+	assert.Error(t, err)
+
+	_, err = LoadStrict([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1", "TimeoutMs": 1000, "TimeoutState": "KICKED"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-20, 100-65535", "MsgTypeBlacklist": "9"},
+			{"Name": "KICKED", "Terminal": true}
+		],
+		"Transitions": [{"FromState": "OPEN", "ToState": "INIT", "MsgType": 2}]
+	}`), testOptions)
+	assert.NoError(t, err)
+
+	// Load only logs the errors
+	_, err = Load([]byte(`{"States": [{"Name": "INIT", "MsgTypeWhitelist": "1, x"}, {"Name": "LOST"}]}`))
+	assert.NoError(t, err)
+
+	_, err = LoadStrict([]byte(`{
+		"InitState": "BLAH",
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1, 1-3, 17, x", "MsgTypeBlacklist": "5-2"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "3-10"},
+			{"Name": "LOST", "MsgTypeWhitelist": "11-20"}
+		],
+		"Transitions": [
+			{"FromState": "INIT", "ToState": "OPEN", "MsgType": 5},
+			{"FromState": "OPEN", "ToState": "NOPE", "MsgType": 4},
+			{"FromState": "OPEN", "ToState": "INIT", "MsgType": 18}
+		]
+	}`), testOptions)
+	errs, ok := err.(ValidationErrors)
+	if assert.True(t, ok) {
+		msgs := make([]string, len(errs))
+		for i, e := range errs {
+			msgs[i] = e.Error()
+		}
+		assert.ElementsMatch(t, []string{
+			"invalid InitState: Invalid state name: BLAH",
+			"state INIT MsgTypeWhitelist: can't convert 'x' to uint32",
+			"state INIT MsgTypeBlacklist: invalid message type range '5-2'",
+			"invalid ToState in StateTransition: OPEN -> NOPE (4)",
+			"state INIT MsgTypeWhitelist: undefined message type '17'",
+			"state LOST MsgTypeWhitelist: undefined message type '11-20'",
+			"state INIT MsgTypeWhitelist: '1-3' overlaps '1'",
+			"state INIT doesn't allow the message type of StateTransition: INIT -> OPEN (5)",
+			"undefined message type in StateTransition: OPEN -> INIT (18)",
+			"state LOST is unreachable from the initial state INIT",
+		}, msgs)
+	}
+
+	_, err = LoadStrict([]byte(`{"States": [{"Name": "INIT"}, {"Name": "INIT"}]}`), testOptions)
+	assert.Error(t, err)
+}
+
+func TestWriteDOT(t *testing.T) {
+	clientFSM, err := LoadStrict([]byte(`{
+		"States": [
+			{"Name": "INIT", "MsgTypeWhitelist": "1", "TimeoutMs": 1000, "TimeoutState": "KICKED"},
+			{"Name": "OPEN", "MsgTypeWhitelist": "2-10", "MsgTypeBlacklist": "9", "RoleRules": [{"MsgTypes": "3-4", "Role": "admin"}]},
+			{"Name": "KICKED", "Terminal": true}
+		],
+		"Transitions": [{"FromState": "OPEN", "ToState": "KICKED", "MsgType": 9}]
+	}`), Options{NextStateMsgTypes: []uint32{1}})
+	// OPEN doesn't allow 9
+	assert.Error(t, err)
+
+	var sb strings.Builder
+	assert.NoError(t, clientFSM.WriteDOT(&sb, testOptions))
+	assert.Equal(t, `digraph FSM {
+	rankdir=LR;
+	node [shape=box];
+	__init [shape=point];
+	__init -> "INIT";
+	"INIT" [label="INIT\nallow: 1"];
+	"OPEN" [label="OPEN\nallow: 2-10\ndeny: 9\nadmin only: 3-4"];
+	"KICKED" [label="KICKED", peripheries=2];
+	"INIT" -> "KICKED" [label="timeout 1000ms", style=dashed];
+	"INIT" -> "OPEN" [label="AUTH (1)", style=dotted];
+	"OPEN" -> "KICKED" [label="MSG9 (9)"];
+}
+`, sb.String())
+}
@@ -0,0 +1,191 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Describes the message types of the application that uses the FSM, for validating and visualizing the config.
+type Options struct {
+	// Returns the name of the message type, or "" if the message type is undefined. All message types are considered defined if not set.
+	MsgTypeName func(msgType uint32) string
+	// The message types that move the FSM to the next state when they are handled (see MoveToNextState), e.g. the authentication.
+	NextStateMsgTypes []uint32
+}
+
+func (opts *Options) isDefined(msgType uint32) bool {
+	return opts.MsgTypeName == nil || opts.MsgTypeName(msgType) != ""
+}
+
+// The aggregated errors found by LoadStrict.
+type ValidationErrors []error
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d error(s) in the FSM config:\n%s", len(errs), strings.Join(msgs, "\n"))
+}
+
+// Loads the FSM like Load, but fails with ValidationErrors if there's any error in the config, including:
+//   - unparsable message types, and the transitions between the states that don't exist;
+//   - unknown InitState, and duplicate state names;
+//   - undefined message types. A range (e.g. "2-20") may include the undefined ones but not only the undefined ones;
+//   - overlapping ranges in the same whitelist or blacklist. The blacklist overriding the whitelist is not an error;
+//   - transitions on the message types that the source state doesn't allow;
+//   - RoleRules without a role, or on the message types that the state doesn't allow;
+//   - states that can't be reached from the initial state.
+func LoadStrict(bytes []byte, opts Options) (FiniteStateMachine, error) {
+	fsm, configErrs, err := load(bytes)
+	if len(fsm.States) == 0 {
+		return fsm, err
+	}
+	var errs ValidationErrors
+	if err != nil {
+		errs = append(errs, err)
+	}
+	errs = append(errs, configErrs...)
+	errs = append(errs, fsm.validate(&opts)...)
+	if len(errs) > 0 {
+		return fsm, errs
+	}
+	return fsm, nil
+}
+
+func (fsm *FiniteStateMachine) validate(opts *Options) []error {
+	var errs []error
+
+	names := make(map[string]bool, len(fsm.States))
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		if names[state.Name] {
+			errs = append(errs, fmt.Errorf("duplicate state name: %s", state.Name))
+		}
+		names[state.Name] = true
+		errs = append(errs, validateMsgTypes(state.Name, "MsgTypeWhitelist", state.MsgTypeWhitelist, opts)...)
+		errs = append(errs, validateMsgTypes(state.Name, "MsgTypeBlacklist", state.MsgTypeBlacklist, opts)...)
+		for _, rule := range state.RoleRules {
+			listName := "RoleRules[" + rule.Role + "]"
+			if rule.Role == "" {
+				errs = append(errs, fmt.Errorf("state %s %s: empty role", state.Name, listName))
+			}
+			errs = append(errs, validateMsgTypes(state.Name, listName, rule.MsgTypes, opts)...)
+			// The parse errors are reported by load().
+			ranges, _ := parseMsgTypeRanges(rule.MsgTypes)
+			for _, r := range ranges {
+				if !state.allowsAny(r, opts) {
+					errs = append(errs, fmt.Errorf("state %s %s: '%s' is not allowed by the state", state.Name, listName, r.seg))
+				}
+			}
+		}
+	}
+
+	for _, transition := range fsm.Transitions {
+		if !opts.isDefined(transition.MsgType) {
+			errs = append(errs, fmt.Errorf("undefined message type in StateTransition: %s -> %s (%d)", transition.FromState, transition.ToState, transition.MsgType))
+			continue
+		}
+		// The transitions between the states that don't exist are reported by load().
+		fromState, fromExists := fsm.stateNameMap[transition.FromState]
+		_, toExists := fsm.stateNameMap[transition.ToState]
+		if fromExists && toExists && !fromState.allowedMsgTypes[transition.MsgType] {
+			errs = append(errs, fmt.Errorf("state %s doesn't allow the message type of StateTransition: %s -> %s (%d)", transition.FromState, transition.FromState, transition.ToState, transition.MsgType))
+		}
+	}
+
+	reached := fsm.reachableStates(opts)
+	for idx := range fsm.States {
+		state := &fsm.States[idx]
+		if !reached[state] {
+			errs = append(errs, fmt.Errorf("state %s is unreachable from the initial state %s", state.Name, fsm.currentState.Name))
+		}
+	}
+
+	return errs
+}
+
+func validateMsgTypes(stateName string, listName string, s string, opts *Options) []error {
+	var errs []error
+	// The parse errors are reported by load().
+	ranges, _ := parseMsgTypeRanges(s)
+	for _, r := range ranges {
+		defined := false
+		for i := uint64(r.from); i <= uint64(r.to); i++ {
+			if opts.isDefined(uint32(i)) {
+				defined = true
+				break
+			}
+		}
+		if !defined {
+			errs = append(errs, fmt.Errorf("state %s %s: undefined message type '%s'", stateName, listName, r.seg))
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].from < ranges[j].from
+	})
+	for i := 1; i < len(ranges); i++ {
+		if ranges[i].from <= ranges[i-1].to {
+			errs = append(errs, fmt.Errorf("state %s %s: '%s' overlaps '%s'", stateName, listName, ranges[i].seg, ranges[i-1].seg))
+		}
+	}
+	return errs
+}
+
+// Returns if the state allows any defined message type in the range, so the RoleRule on the range takes effect.
+func (state *State) allowsAny(r msgTypeRange, opts *Options) bool {
+	for i := uint64(r.from); i <= uint64(r.to); i++ {
+		if state.allowedMsgTypes[uint32(i)] && opts.isDefined(uint32(i)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the states that can be reached from the current state by the transitions, the timeouts, and the NextStateMsgTypes.
+func (fsm *FiniteStateMachine) reachableStates(opts *Options) map[*State]bool {
+	reached := map[*State]bool{fsm.currentState: true}
+	queue := []*State{fsm.currentState}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		for _, next := range fsm.nextStates(state, opts) {
+			if !reached[next] {
+				reached[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return reached
+}
+
+func (fsm *FiniteStateMachine) nextStates(state *State, opts *Options) []*State {
+	var states []*State
+	for _, next := range state.transitions {
+		states = append(states, next)
+	}
+	if state.timeoutState != nil {
+		states = append(states, state.timeoutState)
+	}
+	if next := fsm.stateAfter(state); next != nil {
+		for _, msgType := range opts.NextStateMsgTypes {
+			if state.allowedMsgTypes[msgType] {
+				states = append(states, next)
+				break
+			}
+		}
+	}
+	return states
+}
+
+// Returns the state that MoveToNextState moves to from the state, or nil if it's the last state.
+func (fsm *FiniteStateMachine) stateAfter(state *State) *State {
+	for i := 0; i < len(fsm.States)-1; i++ {
+		if state == &fsm.States[i] {
+			return &fsm.States[i+1]
+		}
+	}
+	return nil
+}
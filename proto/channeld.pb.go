@@ -210,6 +210,16 @@ const (
 	MessageType_UNSUB_FROM_CHANNEL  MessageType = 7
 	MessageType_CHANNEL_DATA_UPDATE MessageType = 8
 	MessageType_DISCONNECT          MessageType = 9
+	MessageType_AUTH_DELEGATION     MessageType = 10
+	MessageType_RESUME              MessageType = 11
+	MessageType_PING                MessageType = 12
+	MessageType_PONG                MessageType = 13
+	MessageType_TRANSFER_OWNERSHIP  MessageType = 14
+	MessageType_ERROR               MessageType = 15
+	MessageType_SPATIAL_INTEREST    MessageType = 16
+	MessageType_HANDOVER_PREPARE    MessageType = 20
+	MessageType_HANDOVER_COMMIT     MessageType = 21
+	MessageType_HANDOVER_ROLLBACK   MessageType = 22
 	MessageType_USER_SPACE_START    MessageType = 100
 )
 
@@ -225,6 +235,16 @@ var (
 		7:   "UNSUB_FROM_CHANNEL",
 		8:   "CHANNEL_DATA_UPDATE",
 		9:   "DISCONNECT",
+		10:  "AUTH_DELEGATION",
+		11:  "RESUME",
+		12:  "PING",
+		13:  "PONG",
+		14:  "TRANSFER_OWNERSHIP",
+		15:  "ERROR",
+		16:  "SPATIAL_INTEREST",
+		20:  "HANDOVER_PREPARE",
+		21:  "HANDOVER_COMMIT",
+		22:  "HANDOVER_ROLLBACK",
 		100: "USER_SPACE_START",
 	}
 	MessageType_value = map[string]int32{
@@ -237,6 +257,16 @@ var (
 		"UNSUB_FROM_CHANNEL":  7,
 		"CHANNEL_DATA_UPDATE": 8,
 		"DISCONNECT":          9,
+		"AUTH_DELEGATION":     10,
+		"RESUME":              11,
+		"PING":                12,
+		"PONG":                13,
+		"TRANSFER_OWNERSHIP":  14,
+		"ERROR":               15,
+		"SPATIAL_INTEREST":    16,
+		"HANDOVER_PREPARE":    20,
+		"HANDOVER_COMMIT":     21,
+		"HANDOVER_ROLLBACK":   22,
 		"USER_SPACE_START":    100,
 	}
 )
@@ -364,6 +394,153 @@ func (AuthResultMessage_AuthResult) EnumDescriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{4, 0}
 }
 
+type CaptureRecord_Direction int32
+
+const (
+	CaptureRecord_INBOUND  CaptureRecord_Direction = 0 // Received from the connection.
+	CaptureRecord_OUTBOUND CaptureRecord_Direction = 1 // Sent to the connection.
+)
+
+// Enum value maps for CaptureRecord_Direction.
+var (
+	CaptureRecord_Direction_name = map[int32]string{
+		0: "INBOUND",
+		1: "OUTBOUND",
+	}
+	CaptureRecord_Direction_value = map[string]int32{
+		"INBOUND":  0,
+		"OUTBOUND": 1,
+	}
+)
+
+func (x CaptureRecord_Direction) Enum() *CaptureRecord_Direction {
+	p := new(CaptureRecord_Direction)
+	*p = x
+	return p
+}
+
+func (x CaptureRecord_Direction) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (CaptureRecord_Direction) Descriptor() protoreflect.EnumDescriptor {
+	return file_channeld_proto_enumTypes[6].Descriptor()
+}
+
+func (CaptureRecord_Direction) Type() protoreflect.EnumType {
+	return &file_channeld_proto_enumTypes[6]
+}
+
+func (x CaptureRecord_Direction) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use CaptureRecord_Direction.Descriptor instead.
+func (CaptureRecord_Direction) EnumDescriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{28, 0}
+}
+
+type ErrorResultMessage_ErrorCode int32
+
+const (
+	ErrorResultMessage_UNKNOWN ErrorResultMessage_ErrorCode = 0
+	// The subscriber has no permission to update some (or all) of the channel data.
+	ErrorResultMessage_WRITE_PERMISSION_DENIED ErrorResultMessage_ErrorCode = 1
+	// The message body can't be unmarshalled, or has invalid values.
+	ErrorResultMessage_INVALID_MESSAGE ErrorResultMessage_ErrorCode = 2
+	// The msgType (< USER_SPACE_START) is not defined by channeld.
+	ErrorResultMessage_UNDEFINED_MESSAGE_TYPE ErrorResultMessage_ErrorCode = 3
+	// The msgType is not allowed for the sender, e.g. by the current state of the connection's FSM.
+	ErrorResultMessage_MESSAGE_NOT_ALLOWED ErrorResultMessage_ErrorCode = 4
+	// The message should be sent in another channel, e.g. the GLOBAL channel.
+	ErrorResultMessage_WRONG_CHANNEL        ErrorResultMessage_ErrorCode = 5
+	ErrorResultMessage_CHANNEL_NOT_FOUND    ErrorResultMessage_ErrorCode = 6
+	ErrorResultMessage_CONNECTION_NOT_FOUND ErrorResultMessage_ErrorCode = 7
+	// The sender is neither the channel owner nor the GLOBAL channel owner.
+	ErrorResultMessage_NO_AUTHORITY           ErrorResultMessage_ErrorCode = 8
+	ErrorResultMessage_INVALID_CHANNEL_TYPE   ErrorResultMessage_ErrorCode = 9
+	ErrorResultMessage_CHANNEL_ALREADY_EXISTS ErrorResultMessage_ErrorCode = 10
+	ErrorResultMessage_NOT_SUBSCRIBED         ErrorResultMessage_ErrorCode = 11
+	// The channel has no owner to forward the message to, and the message can't be buffered.
+	ErrorResultMessage_NO_CHANNEL_OWNER ErrorResultMessage_ErrorCode = 12
+	// The requested feature is disabled, e.g. the client broadcasting or the spatial controller.
+	ErrorResultMessage_FEATURE_DISABLED ErrorResultMessage_ErrorCode = 13
+	// The pending request (e.g. the handover or the delegated authentication) doesn't exist or has timed out.
+	ErrorResultMessage_REQUEST_EXPIRED              ErrorResultMessage_ErrorCode = 14
+	ErrorResultMessage_CHANNEL_DATA_NOT_INITIALIZED ErrorResultMessage_ErrorCode = 15
+	// channeld failed to handle the request.
+	ErrorResultMessage_INTERNAL_ERROR ErrorResultMessage_ErrorCode = 16
+)
+
+// Enum value maps for ErrorResultMessage_ErrorCode.
+var (
+	ErrorResultMessage_ErrorCode_name = map[int32]string{
+		0:  "UNKNOWN",
+		1:  "WRITE_PERMISSION_DENIED",
+		2:  "INVALID_MESSAGE",
+		3:  "UNDEFINED_MESSAGE_TYPE",
+		4:  "MESSAGE_NOT_ALLOWED",
+		5:  "WRONG_CHANNEL",
+		6:  "CHANNEL_NOT_FOUND",
+		7:  "CONNECTION_NOT_FOUND",
+		8:  "NO_AUTHORITY",
+		9:  "INVALID_CHANNEL_TYPE",
+		10: "CHANNEL_ALREADY_EXISTS",
+		11: "NOT_SUBSCRIBED",
+		12: "NO_CHANNEL_OWNER",
+		13: "FEATURE_DISABLED",
+		14: "REQUEST_EXPIRED",
+		15: "CHANNEL_DATA_NOT_INITIALIZED",
+		16: "INTERNAL_ERROR",
+	}
+	ErrorResultMessage_ErrorCode_value = map[string]int32{
+		"UNKNOWN":                      0,
+		"WRITE_PERMISSION_DENIED":      1,
+		"INVALID_MESSAGE":              2,
+		"UNDEFINED_MESSAGE_TYPE":       3,
+		"MESSAGE_NOT_ALLOWED":          4,
+		"WRONG_CHANNEL":                5,
+		"CHANNEL_NOT_FOUND":            6,
+		"CONNECTION_NOT_FOUND":         7,
+		"NO_AUTHORITY":                 8,
+		"INVALID_CHANNEL_TYPE":         9,
+		"CHANNEL_ALREADY_EXISTS":       10,
+		"NOT_SUBSCRIBED":               11,
+		"NO_CHANNEL_OWNER":             12,
+		"FEATURE_DISABLED":             13,
+		"REQUEST_EXPIRED":              14,
+		"CHANNEL_DATA_NOT_INITIALIZED": 15,
+		"INTERNAL_ERROR":               16,
+	}
+)
+
+func (x ErrorResultMessage_ErrorCode) Enum() *ErrorResultMessage_ErrorCode {
+	p := new(ErrorResultMessage_ErrorCode)
+	*p = x
+	return p
+}
+
+func (x ErrorResultMessage_ErrorCode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ErrorResultMessage_ErrorCode) Descriptor() protoreflect.EnumDescriptor {
+	return file_channeld_proto_enumTypes[7].Descriptor()
+}
+
+func (ErrorResultMessage_ErrorCode) Type() protoreflect.EnumType {
+	return &file_channeld_proto_enumTypes[7]
+}
+
+func (x ErrorResultMessage_ErrorCode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ErrorResultMessage_ErrorCode.Descriptor instead.
+func (ErrorResultMessage_ErrorCode) EnumDescriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{32, 0}
+}
+
 // The data packet that is sent between the endpoints. A packet can have multiple messages in the payload in one trip to improve the efficiency.
 type Packet struct {
 	state         protoimpl.MessageState
@@ -627,6 +804,8 @@ type AuthResultMessage struct {
 	// However, because the compression type is specified per packet, the client has its freedom to control which compression type to use.
 	// It's useful when the client has too much CPU load for the compression, or the network debug is needed.
 	CompressionType CompressionType `protobuf:"varint,3,opt,name=compressionType,proto3,enum=channeld.CompressionType" json:"compressionType,omitempty"`
+	// The token to resume the connection after its transport dropped. See @ResumeMessage. Empty if resuming is disabled.
+	ResumeToken string `protobuf:"bytes,4,opt,name=resumeToken,proto3" json:"resumeToken,omitempty"`
 }
 
 func (x *AuthResultMessage) Reset() {
@@ -682,18 +861,27 @@ func (x *AuthResultMessage) GetCompressionType() CompressionType {
 	return CompressionType_NO_COMPRESSION
 }
 
-type ChannelSubscriptionOptions struct {
+func (x *AuthResultMessage) GetResumeToken() string {
+	if x != nil {
+		return x.ResumeToken
+	}
+	return ""
+}
+
+// Attach a new transport to the connection that was detached because its transport dropped (e.g. a mobile client switching networks).
+// The packet should have channelId = 0, and the message should be sent via the new transport instead of @AuthMessage.
+// Only the client connections can be resumed. The server connections should use the owner failover instead, so RESUME is not allowed by the server FSM.
+// Response: @ResumeResultMessage. If succeeded, the channel data updates that the connection missed during the detachment will be fanned out to it.
+type ResumeMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	CanUpdateData    bool     `protobuf:"varint,1,opt,name=CanUpdateData,proto3" json:"CanUpdateData,omitempty"`
-	DataFieldMasks   []string `protobuf:"bytes,2,rep,name=DataFieldMasks,proto3" json:"DataFieldMasks,omitempty"`
-	FanOutIntervalMs uint32   `protobuf:"varint,3,opt,name=FanOutIntervalMs,proto3" json:"FanOutIntervalMs,omitempty"`
+	ResumeToken string `protobuf:"bytes,1,opt,name=resumeToken,proto3" json:"resumeToken,omitempty"`
 }
 
-func (x *ChannelSubscriptionOptions) Reset() {
-	*x = ChannelSubscriptionOptions{}
+func (x *ResumeMessage) Reset() {
+	*x = ResumeMessage{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_channeld_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -701,13 +889,13 @@ func (x *ChannelSubscriptionOptions) Reset() {
 	}
 }
 
-func (x *ChannelSubscriptionOptions) String() string {
+func (x *ResumeMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ChannelSubscriptionOptions) ProtoMessage() {}
+func (*ResumeMessage) ProtoMessage() {}
 
-func (x *ChannelSubscriptionOptions) ProtoReflect() protoreflect.Message {
+func (x *ResumeMessage) ProtoReflect() protoreflect.Message {
 	mi := &file_channeld_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -719,52 +907,33 @@ func (x *ChannelSubscriptionOptions) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ChannelSubscriptionOptions.ProtoReflect.Descriptor instead.
-func (*ChannelSubscriptionOptions) Descriptor() ([]byte, []int) {
+// Deprecated: Use ResumeMessage.ProtoReflect.Descriptor instead.
+func (*ResumeMessage) Descriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{5}
 }
 
-func (x *ChannelSubscriptionOptions) GetCanUpdateData() bool {
-	if x != nil {
-		return x.CanUpdateData
-	}
-	return false
-}
-
-func (x *ChannelSubscriptionOptions) GetDataFieldMasks() []string {
-	if x != nil {
-		return x.DataFieldMasks
-	}
-	return nil
-}
-
-func (x *ChannelSubscriptionOptions) GetFanOutIntervalMs() uint32 {
+func (x *ResumeMessage) GetResumeToken() string {
 	if x != nil {
-		return x.FanOutIntervalMs
+		return x.ResumeToken
 	}
-	return 0
+	return ""
 }
 
-// Defines how two @ChannelDataUpdateMessage.data are merged.
-// The custom merge function should always be implemented for the sake of performance. Otherwise,
-// the default merge that based on Protobuf's reflection will be used, and it's >10 times slower.
-type ChannelDataMergeOptions struct {
+type ResumeResultMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	// By default, Protobuf appends the src list to the dst list. Setting this option to true will replace the dst list with the src list.
-	ShouldReplaceList bool `protobuf:"varint,1,opt,name=shouldReplaceList,proto3" json:"shouldReplaceList,omitempty"`
-	// If the value is greater than 0, truncate the the list when oversized.
-	ListSizeLimit uint32 `protobuf:"varint,2,opt,name=listSizeLimit,proto3" json:"listSizeLimit,omitempty"`
-	// If true, the top elements of the list will be truncated instead of the end. It's useful for scenarios like chat message list.
-	TruncateTop bool `protobuf:"varint,3,opt,name=truncateTop,proto3" json:"truncateTop,omitempty"`
-	// If true, the merge method will remove any map entry that has removed=true in its value.
-	ShouldCheckRemovableMapField bool `protobuf:"varint,4,opt,name=shouldCheckRemovableMapField,proto3" json:"shouldCheckRemovableMapField,omitempty"`
+	Successful bool `protobuf:"varint,1,opt,name=successful,proto3" json:"successful,omitempty"`
+	// The id of the resumed connection. It's the same as the id before the transport dropped.
+	ConnId uint32 `protobuf:"varint,2,opt,name=connId,proto3" json:"connId,omitempty"`
+	// The new resume token. The old one is no longer valid.
+	ResumeToken     string          `protobuf:"bytes,3,opt,name=resumeToken,proto3" json:"resumeToken,omitempty"`
+	CompressionType CompressionType `protobuf:"varint,4,opt,name=compressionType,proto3,enum=channeld.CompressionType" json:"compressionType,omitempty"`
 }
 
-func (x *ChannelDataMergeOptions) Reset() {
-	*x = ChannelDataMergeOptions{}
+func (x *ResumeResultMessage) Reset() {
+	*x = ResumeResultMessage{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_channeld_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -772,13 +941,13 @@ func (x *ChannelDataMergeOptions) Reset() {
 	}
 }
 
-func (x *ChannelDataMergeOptions) String() string {
+func (x *ResumeResultMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ChannelDataMergeOptions) ProtoMessage() {}
+func (*ResumeResultMessage) ProtoMessage() {}
 
-func (x *ChannelDataMergeOptions) ProtoReflect() protoreflect.Message {
+func (x *ResumeResultMessage) ProtoReflect() protoreflect.Message {
 	mi := &file_channeld_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -790,55 +959,54 @@ func (x *ChannelDataMergeOptions) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ChannelDataMergeOptions.ProtoReflect.Descriptor instead.
-func (*ChannelDataMergeOptions) Descriptor() ([]byte, []int) {
+// Deprecated: Use ResumeResultMessage.ProtoReflect.Descriptor instead.
+func (*ResumeResultMessage) Descriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{6}
 }
 
-func (x *ChannelDataMergeOptions) GetShouldReplaceList() bool {
+func (x *ResumeResultMessage) GetSuccessful() bool {
 	if x != nil {
-		return x.ShouldReplaceList
+		return x.Successful
 	}
 	return false
 }
 
-func (x *ChannelDataMergeOptions) GetListSizeLimit() uint32 {
+func (x *ResumeResultMessage) GetConnId() uint32 {
 	if x != nil {
-		return x.ListSizeLimit
+		return x.ConnId
 	}
 	return 0
 }
 
-func (x *ChannelDataMergeOptions) GetTruncateTop() bool {
+func (x *ResumeResultMessage) GetResumeToken() string {
 	if x != nil {
-		return x.TruncateTop
+		return x.ResumeToken
 	}
-	return false
+	return ""
 }
 
-func (x *ChannelDataMergeOptions) GetShouldCheckRemovableMapField() bool {
+func (x *ResumeResultMessage) GetCompressionType() CompressionType {
 	if x != nil {
-		return x.ShouldCheckRemovableMapField
+		return x.CompressionType
 	}
-	return false
+	return CompressionType_NO_COMPRESSION
 }
 
-// The packet should have channelId = 0 in order to be handled.
-// Response: @CreateChannelResultMessage. The channelId in the response MessagePack corresponds to the created channel. The GLOBAL channel owner will also receive this message.
-type CreateChannelMessage struct {
+// Sent from channeld to the GLOBAL channel owner when the authentication is delegated to it (-auth=delegate).
+// Response: @AuthDelegationResultMessage. The owner verifies the tokens and sends the result back with the same msgType.
+type AuthDelegationMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ChannelType  ChannelType                 `protobuf:"varint,1,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
-	Metadata     string                      `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
-	SubOptions   *ChannelSubscriptionOptions `protobuf:"bytes,3,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
-	Data         *anypb.Any                  `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
-	MergeOptions *ChannelDataMergeOptions    `protobuf:"bytes,5,opt,name=mergeOptions,proto3" json:"mergeOptions,omitempty"`
+	// The connection that is being authenticated.
+	ConnId                uint32 `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	PlayerIdentifierToken string `protobuf:"bytes,2,opt,name=playerIdentifierToken,proto3" json:"playerIdentifierToken,omitempty"`
+	LoginToken            string `protobuf:"bytes,3,opt,name=loginToken,proto3" json:"loginToken,omitempty"`
 }
 
-func (x *CreateChannelMessage) Reset() {
-	*x = CreateChannelMessage{}
+func (x *AuthDelegationMessage) Reset() {
+	*x = AuthDelegationMessage{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_channeld_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -846,13 +1014,13 @@ func (x *CreateChannelMessage) Reset() {
 	}
 }
 
-func (x *CreateChannelMessage) String() string {
+func (x *AuthDelegationMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CreateChannelMessage) ProtoMessage() {}
+func (*AuthDelegationMessage) ProtoMessage() {}
 
-func (x *CreateChannelMessage) ProtoReflect() protoreflect.Message {
+func (x *AuthDelegationMessage) ProtoReflect() protoreflect.Message {
 	mi := &file_channeld_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -864,58 +1032,43 @@ func (x *CreateChannelMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CreateChannelMessage.ProtoReflect.Descriptor instead.
-func (*CreateChannelMessage) Descriptor() ([]byte, []int) {
+// Deprecated: Use AuthDelegationMessage.ProtoReflect.Descriptor instead.
+func (*AuthDelegationMessage) Descriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{7}
 }
 
-func (x *CreateChannelMessage) GetChannelType() ChannelType {
+func (x *AuthDelegationMessage) GetConnId() uint32 {
 	if x != nil {
-		return x.ChannelType
+		return x.ConnId
 	}
-	return ChannelType_UNKNOWN
+	return 0
 }
 
-func (x *CreateChannelMessage) GetMetadata() string {
+func (x *AuthDelegationMessage) GetPlayerIdentifierToken() string {
 	if x != nil {
-		return x.Metadata
+		return x.PlayerIdentifierToken
 	}
 	return ""
 }
 
-func (x *CreateChannelMessage) GetSubOptions() *ChannelSubscriptionOptions {
-	if x != nil {
-		return x.SubOptions
-	}
-	return nil
-}
-
-func (x *CreateChannelMessage) GetData() *anypb.Any {
-	if x != nil {
-		return x.Data
-	}
-	return nil
-}
-
-func (x *CreateChannelMessage) GetMergeOptions() *ChannelDataMergeOptions {
+func (x *AuthDelegationMessage) GetLoginToken() string {
 	if x != nil {
-		return x.MergeOptions
+		return x.LoginToken
 	}
-	return nil
+	return ""
 }
 
-type CreateChannelResultMessage struct {
+type AuthDelegationResultMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ChannelType ChannelType `protobuf:"varint,1,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
-	Metadata    string      `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
-	OwnerConnId uint32      `protobuf:"varint,3,opt,name=ownerConnId,proto3" json:"ownerConnId,omitempty"`
+	ConnId uint32                       `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	Result AuthResultMessage_AuthResult `protobuf:"varint,2,opt,name=result,proto3,enum=channeld.AuthResultMessage_AuthResult" json:"result,omitempty"`
 }
 
-func (x *CreateChannelResultMessage) Reset() {
-	*x = CreateChannelResultMessage{}
+func (x *AuthDelegationResultMessage) Reset() {
+	*x = AuthDelegationResultMessage{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_channeld_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -923,13 +1076,13 @@ func (x *CreateChannelResultMessage) Reset() {
 	}
 }
 
-func (x *CreateChannelResultMessage) String() string {
+func (x *AuthDelegationResultMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*CreateChannelResultMessage) ProtoMessage() {}
+func (*AuthDelegationResultMessage) ProtoMessage() {}
 
-func (x *CreateChannelResultMessage) ProtoReflect() protoreflect.Message {
+func (x *AuthDelegationResultMessage) ProtoReflect() protoreflect.Message {
 	mi := &file_channeld_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -941,44 +1094,49 @@ func (x *CreateChannelResultMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use CreateChannelResultMessage.ProtoReflect.Descriptor instead.
-func (*CreateChannelResultMessage) Descriptor() ([]byte, []int) {
+// Deprecated: Use AuthDelegationResultMessage.ProtoReflect.Descriptor instead.
+func (*AuthDelegationResultMessage) Descriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{8}
 }
 
-func (x *CreateChannelResultMessage) GetChannelType() ChannelType {
-	if x != nil {
-		return x.ChannelType
-	}
-	return ChannelType_UNKNOWN
-}
-
-func (x *CreateChannelResultMessage) GetMetadata() string {
+func (x *AuthDelegationResultMessage) GetConnId() uint32 {
 	if x != nil {
-		return x.Metadata
+		return x.ConnId
 	}
-	return ""
+	return 0
 }
 
-func (x *CreateChannelResultMessage) GetOwnerConnId() uint32 {
+func (x *AuthDelegationResultMessage) GetResult() AuthResultMessage_AuthResult {
 	if x != nil {
-		return x.OwnerConnId
+		return x.Result
 	}
-	return 0
+	return AuthResultMessage_SUCCESSFUL
 }
 
-// The packet should have channelId = 0 in order to be handled.
-// Response: all connections in the channel will receive @RemoveChannelMessage. The GLOBAL channel owner will also receive this message.
-type RemoveChannelMessage struct {
+type ChannelSubscriptionOptions struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ChannelId uint32 `protobuf:"varint,1,opt,name=channelId,proto3" json:"channelId,omitempty"`
+	CanUpdateData    bool     `protobuf:"varint,1,opt,name=CanUpdateData,proto3" json:"CanUpdateData,omitempty"`
+	DataFieldMasks   []string `protobuf:"bytes,2,rep,name=DataFieldMasks,proto3" json:"DataFieldMasks,omitempty"`
+	FanOutIntervalMs uint32   `protobuf:"varint,3,opt,name=FanOutIntervalMs,proto3" json:"FanOutIntervalMs,omitempty"`
+	// Receive only the fields that changed since the last fan-out, in @ChannelDataUpdateMessage.delta.
+	// The first fan-out still sends the whole data in @ChannelDataUpdateMessage.data.
+	DeltaFanOut bool `protobuf:"varint,4,opt,name=DeltaFanOut,proto3" json:"DeltaFanOut,omitempty"`
+	// The field masks of the data that the subscriber can update, in the same format as DataFieldMasks. Empty means all fields.
+	// Only applies when CanUpdateData is true and the subscriber is not the channel owner.
+	WriteFieldMasks []string `protobuf:"bytes,5,rep,name=WriteFieldMasks,proto3" json:"WriteFieldMasks,omitempty"`
+	// The map fields (e.g. "tankStates") in which the subscriber can only update the entry whose key equals its connection id.
+	ConnIdKeyedMapFields []string `protobuf:"bytes,6,rep,name=ConnIdKeyedMapFields,proto3" json:"ConnIdKeyedMapFields,omitempty"`
+	// If true, the update that touches any disallowed field is rejected as a whole.
+	// Otherwise, the disallowed fields are stripped and the rest of the update is applied.
+	// Either way, an @ErrorResultMessage is sent to the subscriber.
+	RejectWriteViolation bool `protobuf:"varint,7,opt,name=RejectWriteViolation,proto3" json:"RejectWriteViolation,omitempty"`
 }
 
-func (x *RemoveChannelMessage) Reset() {
-	*x = RemoveChannelMessage{}
+func (x *ChannelSubscriptionOptions) Reset() {
+	*x = ChannelSubscriptionOptions{}
 	if protoimpl.UnsafeEnabled {
 		mi := &file_channeld_proto_msgTypes[9]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -986,13 +1144,13 @@ func (x *RemoveChannelMessage) Reset() {
 	}
 }
 
-func (x *RemoveChannelMessage) String() string {
+func (x *ChannelSubscriptionOptions) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*RemoveChannelMessage) ProtoMessage() {}
+func (*ChannelSubscriptionOptions) ProtoMessage() {}
 
-func (x *RemoveChannelMessage) ProtoReflect() protoreflect.Message {
+func (x *ChannelSubscriptionOptions) ProtoReflect() protoreflect.Message {
 	mi := &file_channeld_proto_msgTypes[9]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
@@ -1004,48 +1162,1544 @@ func (x *RemoveChannelMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use RemoveChannelMessage.ProtoReflect.Descriptor instead.
-func (*RemoveChannelMessage) Descriptor() ([]byte, []int) {
+// Deprecated: Use ChannelSubscriptionOptions.ProtoReflect.Descriptor instead.
+func (*ChannelSubscriptionOptions) Descriptor() ([]byte, []int) {
 	return file_channeld_proto_rawDescGZIP(), []int{9}
 }
 
-func (x *RemoveChannelMessage) GetChannelId() uint32 {
+func (x *ChannelSubscriptionOptions) GetCanUpdateData() bool {
 	if x != nil {
-		return x.ChannelId
+		return x.CanUpdateData
 	}
-	return 0
+	return false
 }
 
-// The packet should have channelId = 0 in order to be handled.
-// Response: @ListChannelResultMessage
-type ListChannelMessage struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
+func (x *ChannelSubscriptionOptions) GetDataFieldMasks() []string {
+	if x != nil {
+		return x.DataFieldMasks
+	}
+	return nil
+}
 
-	TypeFilter      ChannelType `protobuf:"varint,1,opt,name=typeFilter,proto3,enum=channeld.ChannelType" json:"typeFilter,omitempty"`
-	MetadataFilters []string    `protobuf:"bytes,2,rep,name=metadataFilters,proto3" json:"metadataFilters,omitempty"`
+func (x *ChannelSubscriptionOptions) GetFanOutIntervalMs() uint32 {
+	if x != nil {
+		return x.FanOutIntervalMs
+	}
+	return 0
 }
 
-func (x *ListChannelMessage) Reset() {
-	*x = ListChannelMessage{}
-	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[10]
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		ms.StoreMessageInfo(mi)
+func (x *ChannelSubscriptionOptions) GetDeltaFanOut() bool {
+	if x != nil {
+		return x.DeltaFanOut
 	}
+	return false
 }
 
-func (x *ListChannelMessage) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *ChannelSubscriptionOptions) GetWriteFieldMasks() []string {
+	if x != nil {
+		return x.WriteFieldMasks
+	}
+	return nil
 }
 
-func (*ListChannelMessage) ProtoMessage() {}
+func (x *ChannelSubscriptionOptions) GetConnIdKeyedMapFields() []string {
+	if x != nil {
+		return x.ConnIdKeyedMapFields
+	}
+	return nil
+}
 
-func (x *ListChannelMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[10]
-	if protoimpl.UnsafeEnabled && x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+func (x *ChannelSubscriptionOptions) GetRejectWriteViolation() bool {
+	if x != nil {
+		return x.RejectWriteViolation
+	}
+	return false
+}
+
+// Defines how two @ChannelDataUpdateMessage.data are merged.
+// The custom merge function should always be implemented for the sake of performance. Otherwise,
+// the default merge that based on Protobuf's reflection will be used, and it's >10 times slower.
+type ChannelDataMergeOptions struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// By default, Protobuf appends the src list to the dst list. Setting this option to true will replace the dst list with the src list.
+	// The dst list is kept if the src doesn't have the list, so the update of the other fields doesn't clear it.
+	ShouldReplaceList bool `protobuf:"varint,1,opt,name=shouldReplaceList,proto3" json:"shouldReplaceList,omitempty"`
+	// If the value is greater than 0, truncate the the list when oversized.
+	ListSizeLimit uint32 `protobuf:"varint,2,opt,name=listSizeLimit,proto3" json:"listSizeLimit,omitempty"`
+	// If true, the top elements of the list will be truncated instead of the end. It's useful for scenarios like chat message list.
+	TruncateTop bool `protobuf:"varint,3,opt,name=truncateTop,proto3" json:"truncateTop,omitempty"`
+	// If true, the merge method will remove any map entry that has removed=true in its value.
+	ShouldCheckRemovableMapField bool `protobuf:"varint,4,opt,name=shouldCheckRemovableMapField,proto3" json:"shouldCheckRemovableMapField,omitempty"`
+}
+
+func (x *ChannelDataMergeOptions) Reset() {
+	*x = ChannelDataMergeOptions{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ChannelDataMergeOptions) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChannelDataMergeOptions) ProtoMessage() {}
+
+func (x *ChannelDataMergeOptions) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChannelDataMergeOptions.ProtoReflect.Descriptor instead.
+func (*ChannelDataMergeOptions) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ChannelDataMergeOptions) GetShouldReplaceList() bool {
+	if x != nil {
+		return x.ShouldReplaceList
+	}
+	return false
+}
+
+func (x *ChannelDataMergeOptions) GetListSizeLimit() uint32 {
+	if x != nil {
+		return x.ListSizeLimit
+	}
+	return 0
+}
+
+func (x *ChannelDataMergeOptions) GetTruncateTop() bool {
+	if x != nil {
+		return x.TruncateTop
+	}
+	return false
+}
+
+func (x *ChannelDataMergeOptions) GetShouldCheckRemovableMapField() bool {
+	if x != nil {
+		return x.ShouldCheckRemovableMapField
+	}
+	return false
+}
+
+// The packet should have channelId = 0 in order to be handled.
+// Response: @CreateChannelResultMessage. The channelId in the response MessagePack corresponds to the created channel. The GLOBAL channel owner will also receive this message.
+type CreateChannelMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ChannelType  ChannelType                 `protobuf:"varint,1,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+	Metadata     string                      `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	SubOptions   *ChannelSubscriptionOptions `protobuf:"bytes,3,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
+	Data         *anypb.Any                  `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+	MergeOptions *ChannelDataMergeOptions    `protobuf:"bytes,5,opt,name=mergeOptions,proto3" json:"mergeOptions,omitempty"`
+}
+
+func (x *CreateChannelMessage) Reset() {
+	*x = CreateChannelMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateChannelMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateChannelMessage) ProtoMessage() {}
+
+func (x *CreateChannelMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateChannelMessage.ProtoReflect.Descriptor instead.
+func (*CreateChannelMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *CreateChannelMessage) GetChannelType() ChannelType {
+	if x != nil {
+		return x.ChannelType
+	}
+	return ChannelType_UNKNOWN
+}
+
+func (x *CreateChannelMessage) GetMetadata() string {
+	if x != nil {
+		return x.Metadata
+	}
+	return ""
+}
+
+func (x *CreateChannelMessage) GetSubOptions() *ChannelSubscriptionOptions {
+	if x != nil {
+		return x.SubOptions
+	}
+	return nil
+}
+
+func (x *CreateChannelMessage) GetData() *anypb.Any {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *CreateChannelMessage) GetMergeOptions() *ChannelDataMergeOptions {
+	if x != nil {
+		return x.MergeOptions
+	}
+	return nil
+}
+
+type CreateChannelResultMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ChannelType ChannelType `protobuf:"varint,1,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+	Metadata    string      `protobuf:"bytes,2,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	OwnerConnId uint32      `protobuf:"varint,3,opt,name=ownerConnId,proto3" json:"ownerConnId,omitempty"`
+}
+
+func (x *CreateChannelResultMessage) Reset() {
+	*x = CreateChannelResultMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CreateChannelResultMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CreateChannelResultMessage) ProtoMessage() {}
+
+func (x *CreateChannelResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CreateChannelResultMessage.ProtoReflect.Descriptor instead.
+func (*CreateChannelResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *CreateChannelResultMessage) GetChannelType() ChannelType {
+	if x != nil {
+		return x.ChannelType
+	}
+	return ChannelType_UNKNOWN
+}
+
+func (x *CreateChannelResultMessage) GetMetadata() string {
+	if x != nil {
+		return x.Metadata
+	}
+	return ""
+}
+
+func (x *CreateChannelResultMessage) GetOwnerConnId() uint32 {
+	if x != nil {
+		return x.OwnerConnId
+	}
+	return 0
+}
+
+// The packet should have channelId = 0 in order to be handled.
+// Response: all connections in the channel will receive @RemoveChannelMessage. The GLOBAL channel owner will also receive this message.
+type RemoveChannelMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ChannelId uint32 `protobuf:"varint,1,opt,name=channelId,proto3" json:"channelId,omitempty"`
+}
+
+func (x *RemoveChannelMessage) Reset() {
+	*x = RemoveChannelMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RemoveChannelMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RemoveChannelMessage) ProtoMessage() {}
+
+func (x *RemoveChannelMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RemoveChannelMessage.ProtoReflect.Descriptor instead.
+func (*RemoveChannelMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *RemoveChannelMessage) GetChannelId() uint32 {
+	if x != nil {
+		return x.ChannelId
+	}
+	return 0
+}
+
+// The packet should have channelId = 0 in order to be handled.
+// Response: @ListChannelResultMessage
+type ListChannelMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TypeFilter      ChannelType `protobuf:"varint,1,opt,name=typeFilter,proto3,enum=channeld.ChannelType" json:"typeFilter,omitempty"`
+	MetadataFilters []string    `protobuf:"bytes,2,rep,name=metadataFilters,proto3" json:"metadataFilters,omitempty"`
+}
+
+func (x *ListChannelMessage) Reset() {
+	*x = ListChannelMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListChannelMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChannelMessage) ProtoMessage() {}
+
+func (x *ListChannelMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListChannelMessage.ProtoReflect.Descriptor instead.
+func (*ListChannelMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *ListChannelMessage) GetTypeFilter() ChannelType {
+	if x != nil {
+		return x.TypeFilter
+	}
+	return ChannelType_UNKNOWN
+}
+
+func (x *ListChannelMessage) GetMetadataFilters() []string {
+	if x != nil {
+		return x.MetadataFilters
+	}
+	return nil
+}
+
+type ListChannelResultMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Channels []*ListChannelResultMessage_ChannelInfo `protobuf:"bytes,1,rep,name=channels,proto3" json:"channels,omitempty"`
+}
+
+func (x *ListChannelResultMessage) Reset() {
+	*x = ListChannelResultMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListChannelResultMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListChannelResultMessage) ProtoMessage() {}
+
+func (x *ListChannelResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListChannelResultMessage.ProtoReflect.Descriptor instead.
+func (*ListChannelResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ListChannelResultMessage) GetChannels() []*ListChannelResultMessage_ChannelInfo {
+	if x != nil {
+		return x.Channels
+	}
+	return nil
+}
+
+// Response: @SubscribedToChannelResultMessage. The message sender, the subscribed connection (if not the sender), and the channel owner will receive the message respectively.
+// If the connection has already been subscripbed to the channel, the subOptions will be merged, but no response message will be sent.
+type SubscribedToChannelMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The connection to be added to the channel is not necessarily the one sends the message
+	ConnId     uint32                      `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	SubOptions *ChannelSubscriptionOptions `protobuf:"bytes,2,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
+}
+
+func (x *SubscribedToChannelMessage) Reset() {
+	*x = SubscribedToChannelMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[16]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribedToChannelMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribedToChannelMessage) ProtoMessage() {}
+
+func (x *SubscribedToChannelMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[16]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribedToChannelMessage.ProtoReflect.Descriptor instead.
+func (*SubscribedToChannelMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *SubscribedToChannelMessage) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *SubscribedToChannelMessage) GetSubOptions() *ChannelSubscriptionOptions {
+	if x != nil {
+		return x.SubOptions
+	}
+	return nil
+}
+
+type SubscribedToChannelResultMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The connection that subsribed.
+	ConnId      uint32                      `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	SubOptions  *ChannelSubscriptionOptions `protobuf:"bytes,2,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
+	ConnType    ConnectionType              `protobuf:"varint,3,opt,name=connType,proto3,enum=channeld.ConnectionType" json:"connType,omitempty"`
+	ChannelType ChannelType                 `protobuf:"varint,4,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+}
+
+func (x *SubscribedToChannelResultMessage) Reset() {
+	*x = SubscribedToChannelResultMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[17]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SubscribedToChannelResultMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SubscribedToChannelResultMessage) ProtoMessage() {}
+
+func (x *SubscribedToChannelResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[17]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SubscribedToChannelResultMessage.ProtoReflect.Descriptor instead.
+func (*SubscribedToChannelResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *SubscribedToChannelResultMessage) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *SubscribedToChannelResultMessage) GetSubOptions() *ChannelSubscriptionOptions {
+	if x != nil {
+		return x.SubOptions
+	}
+	return nil
+}
+
+func (x *SubscribedToChannelResultMessage) GetConnType() ConnectionType {
+	if x != nil {
+		return x.ConnType
+	}
+	return ConnectionType_NO_CONNECTION
+}
+
+func (x *SubscribedToChannelResultMessage) GetChannelType() ChannelType {
+	if x != nil {
+		return x.ChannelType
+	}
+	return ChannelType_UNKNOWN
+}
+
+// Response: @UnsubscribedFromChannelResultMessage. The message sender, the subscribed connection, and the channel owner will receive the message respectively.
+type UnsubscribedFromChannelMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ConnId uint32 `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+}
+
+func (x *UnsubscribedFromChannelMessage) Reset() {
+	*x = UnsubscribedFromChannelMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[18]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UnsubscribedFromChannelMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnsubscribedFromChannelMessage) ProtoMessage() {}
+
+func (x *UnsubscribedFromChannelMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[18]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnsubscribedFromChannelMessage.ProtoReflect.Descriptor instead.
+func (*UnsubscribedFromChannelMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *UnsubscribedFromChannelMessage) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+type UnsubscribedFromChannelResultMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The connection that unsubsribed.
+	ConnId      uint32         `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	ConnType    ConnectionType `protobuf:"varint,2,opt,name=connType,proto3,enum=channeld.ConnectionType" json:"connType,omitempty"`
+	ChannelType ChannelType    `protobuf:"varint,3,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+}
+
+func (x *UnsubscribedFromChannelResultMessage) Reset() {
+	*x = UnsubscribedFromChannelResultMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[19]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *UnsubscribedFromChannelResultMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnsubscribedFromChannelResultMessage) ProtoMessage() {}
+
+func (x *UnsubscribedFromChannelResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[19]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnsubscribedFromChannelResultMessage.ProtoReflect.Descriptor instead.
+func (*UnsubscribedFromChannelResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *UnsubscribedFromChannelResultMessage) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *UnsubscribedFromChannelResultMessage) GetConnType() ConnectionType {
+	if x != nil {
+		return x.ConnType
+	}
+	return ConnectionType_NO_CONNECTION
+}
+
+func (x *UnsubscribedFromChannelResultMessage) GetChannelType() ChannelType {
+	if x != nil {
+		return x.ChannelType
+	}
+	return ChannelType_UNKNOWN
+}
+
+// Only the channel owner or the GLOBAL channel owner can send it.
+// Response: all connections in the channel, the new owner, and the GLOBAL channel owner will receive @OwnershipChangedMessage with the same msgType, if the owner is changed.
+type TransferOwnershipMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The connection to become the owner of the channel. It will be subscribed to the channel if not yet. 0 means the owner is not changed.
+	NewOwnerConnId uint32 `protobuf:"varint,1,opt,name=newOwnerConnId,proto3" json:"newOwnerConnId,omitempty"`
+	// If not empty, replaces the standby owners of the channel, in the order of priority.
+	// When the owner is lost (disconnected or unsubscribed), the first standby owner that is still connected becomes the new owner.
+	StandbyOwnerConnIds []uint32 `protobuf:"varint,2,rep,packed,name=standbyOwnerConnIds,proto3" json:"standbyOwnerConnIds,omitempty"`
+	// Clears the standby owners of the channel.
+	ClearStandbyOwners bool `protobuf:"varint,3,opt,name=clearStandbyOwners,proto3" json:"clearStandbyOwners,omitempty"`
+}
+
+func (x *TransferOwnershipMessage) Reset() {
+	*x = TransferOwnershipMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[20]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TransferOwnershipMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TransferOwnershipMessage) ProtoMessage() {}
+
+func (x *TransferOwnershipMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[20]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TransferOwnershipMessage.ProtoReflect.Descriptor instead.
+func (*TransferOwnershipMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *TransferOwnershipMessage) GetNewOwnerConnId() uint32 {
+	if x != nil {
+		return x.NewOwnerConnId
+	}
+	return 0
+}
+
+func (x *TransferOwnershipMessage) GetStandbyOwnerConnIds() []uint32 {
+	if x != nil {
+		return x.StandbyOwnerConnIds
+	}
+	return nil
+}
+
+func (x *TransferOwnershipMessage) GetClearStandbyOwners() bool {
+	if x != nil {
+		return x.ClearStandbyOwners
+	}
+	return false
+}
+
+type OwnershipChangedMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// 0 if the channel had no owner.
+	OldOwnerConnId uint32 `protobuf:"varint,1,opt,name=oldOwnerConnId,proto3" json:"oldOwnerConnId,omitempty"`
+	// 0 if the owner is lost and there's no standby owner to take over.
+	// The messages to the owner are buffered until the next owner is set (see ChannelSettingsType.OwnerlessBufferSize).
+	NewOwnerConnId uint32 `protobuf:"varint,2,opt,name=newOwnerConnId,proto3" json:"newOwnerConnId,omitempty"`
+	// The standby owner took over as the old owner was lost.
+	Failover    bool        `protobuf:"varint,3,opt,name=failover,proto3" json:"failover,omitempty"`
+	ChannelType ChannelType `protobuf:"varint,4,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+}
+
+func (x *OwnershipChangedMessage) Reset() {
+	*x = OwnershipChangedMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[21]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OwnershipChangedMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OwnershipChangedMessage) ProtoMessage() {}
+
+func (x *OwnershipChangedMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[21]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OwnershipChangedMessage.ProtoReflect.Descriptor instead.
+func (*OwnershipChangedMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *OwnershipChangedMessage) GetOldOwnerConnId() uint32 {
+	if x != nil {
+		return x.OldOwnerConnId
+	}
+	return 0
+}
+
+func (x *OwnershipChangedMessage) GetNewOwnerConnId() uint32 {
+	if x != nil {
+		return x.NewOwnerConnId
+	}
+	return 0
+}
+
+func (x *OwnershipChangedMessage) GetFailover() bool {
+	if x != nil {
+		return x.Failover
+	}
+	return false
+}
+
+func (x *OwnershipChangedMessage) GetChannelType() ChannelType {
+	if x != nil {
+		return x.ChannelType
+	}
+	return ChannelType_UNKNOWN
+}
+
+// Response: no. Each connection in the channel receives the @ChannelDataUpdateMessage in every @ChannelSubscriptionOptions.FanOutIntervalMs
+type ChannelDataUpdateMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Data *anypb.Any `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// Only sent from channeld to the subscriptions with @ChannelSubscriptionOptions.DeltaFanOut set. Applies to the data that the subscriber has received.
+	Delta *MessageDelta `protobuf:"bytes,2,opt,name=delta,proto3" json:"delta,omitempty"`
+}
+
+func (x *ChannelDataUpdateMessage) Reset() {
+	*x = ChannelDataUpdateMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[22]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ChannelDataUpdateMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChannelDataUpdateMessage) ProtoMessage() {}
+
+func (x *ChannelDataUpdateMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[22]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChannelDataUpdateMessage.ProtoReflect.Descriptor instead.
+func (*ChannelDataUpdateMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *ChannelDataUpdateMessage) GetData() *anypb.Any {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *ChannelDataUpdateMessage) GetDelta() *MessageDelta {
+	if x != nil {
+		return x.Delta
+	}
+	return nil
+}
+
+// The changes of a message. Applied in the order of: clearedFields, lists, maps, modifiedFields, then set.
+type MessageDelta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The partial message of the same type that contains the new values of the changed singular fields (except the modified message fields),
+	// the message fields that were not set before, the elements appended to the lists, and the added or replaced map entries.
+	// Applied by merging (e.g. proto.UnmarshalOptions{Merge: true}).
+	Set []byte `protobuf:"bytes,1,opt,name=set,proto3" json:"set,omitempty"`
+	// The numbers of the fields that are cleared, or reset to the default values.
+	ClearedFields []uint32 `protobuf:"varint,2,rep,packed,name=clearedFields,proto3" json:"clearedFields,omitempty"`
+	// The changed singular message fields, by field number.
+	ModifiedFields map[uint32]*MessageDelta `protobuf:"bytes,3,rep,name=modifiedFields,proto3" json:"modifiedFields,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// The changed repeated fields, by field number.
+	Lists map[uint32]*ListDelta `protobuf:"bytes,4,rep,name=lists,proto3" json:"lists,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// The changed map fields, by field number.
+	Maps map[uint32]*MapDelta `protobuf:"bytes,5,rep,name=maps,proto3" json:"maps,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *MessageDelta) Reset() {
+	*x = MessageDelta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[23]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MessageDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageDelta) ProtoMessage() {}
+
+func (x *MessageDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[23]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageDelta.ProtoReflect.Descriptor instead.
+func (*MessageDelta) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *MessageDelta) GetSet() []byte {
+	if x != nil {
+		return x.Set
+	}
+	return nil
+}
+
+func (x *MessageDelta) GetClearedFields() []uint32 {
+	if x != nil {
+		return x.ClearedFields
+	}
+	return nil
+}
+
+func (x *MessageDelta) GetModifiedFields() map[uint32]*MessageDelta {
+	if x != nil {
+		return x.ModifiedFields
+	}
+	return nil
+}
+
+func (x *MessageDelta) GetLists() map[uint32]*ListDelta {
+	if x != nil {
+		return x.Lists
+	}
+	return nil
+}
+
+func (x *MessageDelta) GetMaps() map[uint32]*MapDelta {
+	if x != nil {
+		return x.Maps
+	}
+	return nil
+}
+
+// The changes of a repeated field, besides the elements appended in @MessageDelta.set.
+type ListDelta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The whole list is in @MessageDelta.set. The list should be cleared first.
+	Replaced bool `protobuf:"varint,1,opt,name=replaced,proto3" json:"replaced,omitempty"`
+	// The number of the elements removed from the front.
+	RemovedFromFront uint32 `protobuf:"varint,2,opt,name=removedFromFront,proto3" json:"removedFromFront,omitempty"`
+	// The number of the elements removed from the back, after removing from the front.
+	RemovedFromBack uint32 `protobuf:"varint,3,opt,name=removedFromBack,proto3" json:"removedFromBack,omitempty"`
+	// The modified message elements, indexed after the removal.
+	Modified map[uint32]*MessageDelta `protobuf:"bytes,4,rep,name=modified,proto3" json:"modified,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *ListDelta) Reset() {
+	*x = ListDelta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[24]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ListDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListDelta) ProtoMessage() {}
+
+func (x *ListDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[24]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListDelta.ProtoReflect.Descriptor instead.
+func (*ListDelta) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *ListDelta) GetReplaced() bool {
+	if x != nil {
+		return x.Replaced
+	}
+	return false
+}
+
+func (x *ListDelta) GetRemovedFromFront() uint32 {
+	if x != nil {
+		return x.RemovedFromFront
+	}
+	return 0
+}
+
+func (x *ListDelta) GetRemovedFromBack() uint32 {
+	if x != nil {
+		return x.RemovedFromBack
+	}
+	return 0
+}
+
+func (x *ListDelta) GetModified() map[uint32]*MessageDelta {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+// The changes of a map field, besides the entries added or replaced in @MessageDelta.set.
+type MapDelta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The keys of the removed entries. The integer and bool keys are in intKeys (signed values are cast to uint64), the string keys are in stringKeys.
+	RemovedIntKeys    []uint64 `protobuf:"varint,1,rep,packed,name=removedIntKeys,proto3" json:"removedIntKeys,omitempty"`
+	RemovedStringKeys []string `protobuf:"bytes,2,rep,name=removedStringKeys,proto3" json:"removedStringKeys,omitempty"`
+	// The modified entries whose values are messages.
+	Modified []*MapEntryDelta `protobuf:"bytes,3,rep,name=modified,proto3" json:"modified,omitempty"`
+}
+
+func (x *MapDelta) Reset() {
+	*x = MapDelta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[25]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MapDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MapDelta) ProtoMessage() {}
+
+func (x *MapDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[25]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MapDelta.ProtoReflect.Descriptor instead.
+func (*MapDelta) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *MapDelta) GetRemovedIntKeys() []uint64 {
+	if x != nil {
+		return x.RemovedIntKeys
+	}
+	return nil
+}
+
+func (x *MapDelta) GetRemovedStringKeys() []string {
+	if x != nil {
+		return x.RemovedStringKeys
+	}
+	return nil
+}
+
+func (x *MapDelta) GetModified() []*MapEntryDelta {
+	if x != nil {
+		return x.Modified
+	}
+	return nil
+}
+
+type MapEntryDelta struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	IntKey    uint64        `protobuf:"varint,1,opt,name=intKey,proto3" json:"intKey,omitempty"`
+	StringKey string        `protobuf:"bytes,2,opt,name=stringKey,proto3" json:"stringKey,omitempty"`
+	Delta     *MessageDelta `protobuf:"bytes,3,opt,name=delta,proto3" json:"delta,omitempty"`
+}
+
+func (x *MapEntryDelta) Reset() {
+	*x = MapEntryDelta{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[26]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *MapEntryDelta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MapEntryDelta) ProtoMessage() {}
+
+func (x *MapEntryDelta) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[26]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MapEntryDelta.ProtoReflect.Descriptor instead.
+func (*MapEntryDelta) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *MapEntryDelta) GetIntKey() uint64 {
+	if x != nil {
+		return x.IntKey
+	}
+	return 0
+}
+
+func (x *MapEntryDelta) GetStringKey() string {
+	if x != nil {
+		return x.StringKey
+	}
+	return ""
+}
+
+func (x *MapEntryDelta) GetDelta() *MessageDelta {
+	if x != nil {
+		return x.Delta
+	}
+	return nil
+}
+
+// A record in the write-ahead log of the channel data updates. Only used by channeld internally, not sent over the network.
+type ChannelDataLogRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The id of the channel when the update was accepted. It may differ from the id of the channel that replays the log.
+	ChannelId uint32 `protobuf:"varint,1,opt,name=channelId,proto3" json:"channelId,omitempty"`
+	// The @ChannelTime when the update was accepted.
+	ChannelTime int64 `protobuf:"varint,2,opt,name=channelTime,proto3" json:"channelTime,omitempty"`
+	// 0 if the update was made by channeld, e.g. moving the entity between the SPATIAL channels.
+	SenderConnId uint32     `protobuf:"varint,3,opt,name=senderConnId,proto3" json:"senderConnId,omitempty"`
+	Data         *anypb.Any `protobuf:"bytes,4,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *ChannelDataLogRecord) Reset() {
+	*x = ChannelDataLogRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[27]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ChannelDataLogRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChannelDataLogRecord) ProtoMessage() {}
+
+func (x *ChannelDataLogRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[27]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChannelDataLogRecord.ProtoReflect.Descriptor instead.
+func (*ChannelDataLogRecord) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ChannelDataLogRecord) GetChannelId() uint32 {
+	if x != nil {
+		return x.ChannelId
+	}
+	return 0
+}
+
+func (x *ChannelDataLogRecord) GetChannelTime() int64 {
+	if x != nil {
+		return x.ChannelTime
+	}
+	return 0
+}
+
+func (x *ChannelDataLogRecord) GetSenderConnId() uint32 {
+	if x != nil {
+		return x.SenderConnId
+	}
+	return 0
+}
+
+func (x *ChannelDataLogRecord) GetData() *anypb.Any {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// A message received from or sent to a connection, captured for debugging. Only used by channeld and channeld-replay, not sent over the network.
+type CaptureRecord struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// When the message was received or sent, in Unix nanoseconds.
+	Time      int64                   `protobuf:"varint,1,opt,name=time,proto3" json:"time,omitempty"`
+	Direction CaptureRecord_Direction `protobuf:"varint,2,opt,name=direction,proto3,enum=channeld.CaptureRecord_Direction" json:"direction,omitempty"`
+	ConnId    uint32                  `protobuf:"varint,3,opt,name=connId,proto3" json:"connId,omitempty"`
+	ConnType  ConnectionType          `protobuf:"varint,4,opt,name=connType,proto3,enum=channeld.ConnectionType" json:"connType,omitempty"`
+	Pack      *MessagePack            `protobuf:"bytes,5,opt,name=pack,proto3" json:"pack,omitempty"`
+	// The full name of the outbound message's type, e.g. "channeld.CreateChannelResultMessage", as the response to a request can be of another type.
+	// Empty for the inbound messages, which are resolved by the msgType.
+	MsgName string `protobuf:"bytes,6,opt,name=msgName,proto3" json:"msgName,omitempty"`
+}
+
+func (x *CaptureRecord) Reset() {
+	*x = CaptureRecord{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[28]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *CaptureRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CaptureRecord) ProtoMessage() {}
+
+func (x *CaptureRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[28]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CaptureRecord.ProtoReflect.Descriptor instead.
+func (*CaptureRecord) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *CaptureRecord) GetTime() int64 {
+	if x != nil {
+		return x.Time
+	}
+	return 0
+}
+
+func (x *CaptureRecord) GetDirection() CaptureRecord_Direction {
+	if x != nil {
+		return x.Direction
+	}
+	return CaptureRecord_INBOUND
+}
+
+func (x *CaptureRecord) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *CaptureRecord) GetConnType() ConnectionType {
+	if x != nil {
+		return x.ConnType
+	}
+	return ConnectionType_NO_CONNECTION
+}
+
+func (x *CaptureRecord) GetPack() *MessagePack {
+	if x != nil {
+		return x.Pack
+	}
+	return nil
+}
+
+func (x *CaptureRecord) GetMsgName() string {
+	if x != nil {
+		return x.MsgName
+	}
+	return ""
+}
+
+// Disconnect another connection from channeld.
+// This message should only be sent by the server connection in a server-authoratative environment.
+// The packet should have channelId = 0 in order to be handled.
+// Response: no.
+// channeld also sends it to the connection (connId = the connection's own id) as a notice before closing it, e.g. when shutting down or kicked by the admin API.
+// The server connections receive the notice after the client connections are closed and the channels are removed.
+type DisconnectMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ConnId uint32 `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	// Why channeld closes the connection. Only set in the notice.
+	Reason string `protobuf:"bytes,2,opt,name=reason,proto3" json:"reason,omitempty"`
+	// The address that the connection can reconnect to, e.g. another channeld instance. Empty means no reconnect address.
+	ReconnectAddress string `protobuf:"bytes,3,opt,name=reconnectAddress,proto3" json:"reconnectAddress,omitempty"`
+}
+
+func (x *DisconnectMessage) Reset() {
+	*x = DisconnectMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[29]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *DisconnectMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DisconnectMessage) ProtoMessage() {}
+
+func (x *DisconnectMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[29]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DisconnectMessage.ProtoReflect.Descriptor instead.
+func (*DisconnectMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *DisconnectMessage) GetConnId() uint32 {
+	if x != nil {
+		return x.ConnId
+	}
+	return 0
+}
+
+func (x *DisconnectMessage) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *DisconnectMessage) GetReconnectAddress() string {
+	if x != nil {
+		return x.ReconnectAddress
+	}
+	return ""
+}
+
+// Measures the round-trip time and keeps the connection alive. Both channeld and the connection can send it.
+// channeld sends it to every connection at the interval of -ping, and removes the connection that hasn't sent anything within the idle timeout.
+// The packet should have channelId = 0 in order to be handled.
+// Response: @PongMessage with msgType = PONG.
+type PingMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The local time of the sender, in nanoseconds. The receiver should send it back as it is.
+	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *PingMessage) Reset() {
+	*x = PingMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[30]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PingMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PingMessage) ProtoMessage() {}
+
+func (x *PingMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[30]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PingMessage.ProtoReflect.Descriptor instead.
+func (*PingMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *PingMessage) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+type PongMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// The timestamp in the @PingMessage that is being replied.
+	Timestamp int64 `protobuf:"varint,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+}
+
+func (x *PongMessage) Reset() {
+	*x = PongMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[31]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PongMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PongMessage) ProtoMessage() {}
+
+func (x *PongMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[31]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PongMessage.ProtoReflect.Descriptor instead.
+func (*PongMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *PongMessage) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// Sent by channeld with msgType = ERROR when a request is rejected.
+// The packet has the same channelId and stubId as the rejected request, so the stub-based RPC can be resolved.
+// channeld never replies an ErrorResultMessage to an ErrorResultMessage.
+// Not sent before the connection is authenticated, and limited by the -maxerr setting per second.
+type ErrorResultMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Code ErrorResultMessage_ErrorCode `protobuf:"varint,1,opt,name=code,proto3,enum=channeld.ErrorResultMessage_ErrorCode" json:"code,omitempty"`
+	// The msgType of the rejected request.
+	MsgType uint32 `protobuf:"varint,2,opt,name=msgType,proto3" json:"msgType,omitempty"`
+	// The stubId of the rejected request.
+	StubId  uint32 `protobuf:"varint,3,opt,name=stubId,proto3" json:"stubId,omitempty"`
+	Message string `protobuf:"bytes,4,opt,name=message,proto3" json:"message,omitempty"`
+}
+
+func (x *ErrorResultMessage) Reset() {
+	*x = ErrorResultMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[32]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ErrorResultMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorResultMessage) ProtoMessage() {}
+
+func (x *ErrorResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[32]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
 			ms.StoreMessageInfo(mi)
 		}
@@ -1054,50 +2708,66 @@ func (x *ListChannelMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListChannelMessage.ProtoReflect.Descriptor instead.
-func (*ListChannelMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{10}
+// Deprecated: Use ErrorResultMessage.ProtoReflect.Descriptor instead.
+func (*ErrorResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{32}
 }
 
-func (x *ListChannelMessage) GetTypeFilter() ChannelType {
+func (x *ErrorResultMessage) GetCode() ErrorResultMessage_ErrorCode {
 	if x != nil {
-		return x.TypeFilter
+		return x.Code
 	}
-	return ChannelType_UNKNOWN
+	return ErrorResultMessage_UNKNOWN
 }
 
-func (x *ListChannelMessage) GetMetadataFilters() []string {
+func (x *ErrorResultMessage) GetMsgType() uint32 {
 	if x != nil {
-		return x.MetadataFilters
+		return x.MsgType
 	}
-	return nil
+	return 0
 }
 
-type ListChannelResultMessage struct {
+func (x *ErrorResultMessage) GetStubId() uint32 {
+	if x != nil {
+		return x.StubId
+	}
+	return 0
+}
+
+func (x *ErrorResultMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type Location struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Channels []*ListChannelResultMessage_ChannelInfo `protobuf:"bytes,1,rep,name=channels,proto3" json:"channels,omitempty"`
+	X float64 `protobuf:"fixed64,1,opt,name=x,proto3" json:"x,omitempty"`
+	Y float64 `protobuf:"fixed64,2,opt,name=y,proto3" json:"y,omitempty"`
+	Z float64 `protobuf:"fixed64,3,opt,name=z,proto3" json:"z,omitempty"`
 }
 
-func (x *ListChannelResultMessage) Reset() {
-	*x = ListChannelResultMessage{}
+func (x *Location) Reset() {
+	*x = Location{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[11]
+		mi := &file_channeld_proto_msgTypes[33]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *ListChannelResultMessage) String() string {
+func (x *Location) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListChannelResultMessage) ProtoMessage() {}
+func (*Location) ProtoMessage() {}
 
-func (x *ListChannelResultMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[11]
+func (x *Location) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[33]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1108,47 +2778,59 @@ func (x *ListChannelResultMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListChannelResultMessage.ProtoReflect.Descriptor instead.
-func (*ListChannelResultMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{11}
+// Deprecated: Use Location.ProtoReflect.Descriptor instead.
+func (*Location) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{33}
 }
 
-func (x *ListChannelResultMessage) GetChannels() []*ListChannelResultMessage_ChannelInfo {
+func (x *Location) GetX() float64 {
 	if x != nil {
-		return x.Channels
+		return x.X
 	}
-	return nil
+	return 0
 }
 
-// Response: @SubscribedToChannelResultMessage. The message sender, the subscribed connection (if not the sender), and the channel owner will receive the message respectively.
-// If the connection has already been subscripbed to the channel, the subOptions will be merged, but no response message will be sent.
-type SubscribedToChannelMessage struct {
+func (x *Location) GetY() float64 {
+	if x != nil {
+		return x.Y
+	}
+	return 0
+}
+
+func (x *Location) GetZ() float64 {
+	if x != nil {
+		return x.Z
+	}
+	return 0
+}
+
+type SpatialEntityInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	// The connection to be added to the channel is not necessarily the one sends the message
-	ConnId     uint32                      `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
-	SubOptions *ChannelSubscriptionOptions `protobuf:"bytes,2,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
+	Loc *Location `protobuf:"bytes,1,opt,name=loc,proto3" json:"loc,omitempty"`
+	// Set when the entity leaves the channel, e.g. moved into another spatial channel.
+	Removed bool `protobuf:"varint,2,opt,name=removed,proto3" json:"removed,omitempty"`
 }
 
-func (x *SubscribedToChannelMessage) Reset() {
-	*x = SubscribedToChannelMessage{}
+func (x *SpatialEntityInfo) Reset() {
+	*x = SpatialEntityInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[12]
+		mi := &file_channeld_proto_msgTypes[34]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *SubscribedToChannelMessage) String() string {
+func (x *SpatialEntityInfo) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SubscribedToChannelMessage) ProtoMessage() {}
+func (*SpatialEntityInfo) ProtoMessage() {}
 
-func (x *SubscribedToChannelMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[12]
+func (x *SpatialEntityInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[34]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1159,54 +2841,52 @@ func (x *SubscribedToChannelMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SubscribedToChannelMessage.ProtoReflect.Descriptor instead.
-func (*SubscribedToChannelMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{12}
+// Deprecated: Use SpatialEntityInfo.ProtoReflect.Descriptor instead.
+func (*SpatialEntityInfo) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{34}
 }
 
-func (x *SubscribedToChannelMessage) GetConnId() uint32 {
+func (x *SpatialEntityInfo) GetLoc() *Location {
 	if x != nil {
-		return x.ConnId
+		return x.Loc
 	}
-	return 0
+	return nil
 }
 
-func (x *SubscribedToChannelMessage) GetSubOptions() *ChannelSubscriptionOptions {
+func (x *SpatialEntityInfo) GetRemoved() bool {
 	if x != nil {
-		return x.SubOptions
+		return x.Removed
 	}
-	return nil
+	return false
 }
 
-type SubscribedToChannelResultMessage struct {
+// The data of the SPATIAL channels. If the spatial controller is enabled (-spatial), channeld moves the entity to the
+// spatial channel that contains its new location when the channel data update changes the location.
+type SpatialChannelDataMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	// The connection that subsribed.
-	ConnId      uint32                      `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
-	SubOptions  *ChannelSubscriptionOptions `protobuf:"bytes,2,opt,name=subOptions,proto3" json:"subOptions,omitempty"`
-	ConnType    ConnectionType              `protobuf:"varint,3,opt,name=connType,proto3,enum=channeld.ConnectionType" json:"connType,omitempty"`
-	ChannelType ChannelType                 `protobuf:"varint,4,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+	Entities map[uint32]*SpatialEntityInfo `protobuf:"bytes,1,rep,name=entities,proto3" json:"entities,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
 }
 
-func (x *SubscribedToChannelResultMessage) Reset() {
-	*x = SubscribedToChannelResultMessage{}
+func (x *SpatialChannelDataMessage) Reset() {
+	*x = SpatialChannelDataMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[13]
+		mi := &file_channeld_proto_msgTypes[35]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *SubscribedToChannelResultMessage) String() string {
+func (x *SpatialChannelDataMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SubscribedToChannelResultMessage) ProtoMessage() {}
+func (*SpatialChannelDataMessage) ProtoMessage() {}
 
-func (x *SubscribedToChannelResultMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[13]
+func (x *SpatialChannelDataMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[35]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1217,65 +2897,169 @@ func (x *SubscribedToChannelResultMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SubscribedToChannelResultMessage.ProtoReflect.Descriptor instead.
-func (*SubscribedToChannelResultMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{13}
+// Deprecated: Use SpatialChannelDataMessage.ProtoReflect.Descriptor instead.
+func (*SpatialChannelDataMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{35}
 }
 
-func (x *SubscribedToChannelResultMessage) GetConnId() uint32 {
+func (x *SpatialChannelDataMessage) GetEntities() map[uint32]*SpatialEntityInfo {
 	if x != nil {
-		return x.ConnId
+		return x.Entities
 	}
-	return 0
+	return nil
 }
 
-func (x *SubscribedToChannelResultMessage) GetSubOptions() *ChannelSubscriptionOptions {
-	if x != nil {
-		return x.SubOptions
+// The area of interest around the player entity of a connection. Only one of sphere, cone and border should be set.
+type SpatialInterestArea struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	// Types that are assignable to Area:
+	//	*SpatialInterestArea_Sphere_
+	//	*SpatialInterestArea_Cone_
+	//	*SpatialInterestArea_Border_
+	Area isSpatialInterestArea_Area `protobuf_oneof:"area"`
+	// The fan-out interval of the spatial channel that contains the entity. 0 = the channel's default.
+	NearFanOutIntervalMs uint32 `protobuf:"varint,4,opt,name=nearFanOutIntervalMs,proto3" json:"nearFanOutIntervalMs,omitempty"`
+	// The fan-out interval of the farthest spatial channels in the area. The channels in between are interpolated.
+	FarFanOutIntervalMs uint32 `protobuf:"varint,5,opt,name=farFanOutIntervalMs,proto3" json:"farFanOutIntervalMs,omitempty"`
+}
+
+func (x *SpatialInterestArea) Reset() {
+	*x = SpatialInterestArea{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_channeld_proto_msgTypes[36]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SpatialInterestArea) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SpatialInterestArea) ProtoMessage() {}
+
+func (x *SpatialInterestArea) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[36]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SpatialInterestArea.ProtoReflect.Descriptor instead.
+func (*SpatialInterestArea) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{36}
+}
+
+func (m *SpatialInterestArea) GetArea() isSpatialInterestArea_Area {
+	if m != nil {
+		return m.Area
 	}
 	return nil
 }
 
-func (x *SubscribedToChannelResultMessage) GetConnType() ConnectionType {
+func (x *SpatialInterestArea) GetSphere() *SpatialInterestArea_Sphere {
+	if x, ok := x.GetArea().(*SpatialInterestArea_Sphere_); ok {
+		return x.Sphere
+	}
+	return nil
+}
+
+func (x *SpatialInterestArea) GetCone() *SpatialInterestArea_Cone {
+	if x, ok := x.GetArea().(*SpatialInterestArea_Cone_); ok {
+		return x.Cone
+	}
+	return nil
+}
+
+func (x *SpatialInterestArea) GetBorder() *SpatialInterestArea_Border {
+	if x, ok := x.GetArea().(*SpatialInterestArea_Border_); ok {
+		return x.Border
+	}
+	return nil
+}
+
+func (x *SpatialInterestArea) GetNearFanOutIntervalMs() uint32 {
 	if x != nil {
-		return x.ConnType
+		return x.NearFanOutIntervalMs
 	}
-	return ConnectionType_NO_CONNECTION
+	return 0
 }
 
-func (x *SubscribedToChannelResultMessage) GetChannelType() ChannelType {
+func (x *SpatialInterestArea) GetFarFanOutIntervalMs() uint32 {
 	if x != nil {
-		return x.ChannelType
+		return x.FarFanOutIntervalMs
 	}
-	return ChannelType_UNKNOWN
+	return 0
 }
 
-// Response: @UnsubscribedFromChannelResultMessage. The message sender, the subscribed connection, and the channel owner will receive the message respectively.
-type UnsubscribedFromChannelMessage struct {
+type isSpatialInterestArea_Area interface {
+	isSpatialInterestArea_Area()
+}
+
+type SpatialInterestArea_Sphere_ struct {
+	Sphere *SpatialInterestArea_Sphere `protobuf:"bytes,1,opt,name=sphere,proto3,oneof"`
+}
+
+type SpatialInterestArea_Cone_ struct {
+	Cone *SpatialInterestArea_Cone `protobuf:"bytes,2,opt,name=cone,proto3,oneof"`
+}
+
+type SpatialInterestArea_Border_ struct {
+	Border *SpatialInterestArea_Border `protobuf:"bytes,3,opt,name=border,proto3,oneof"`
+}
+
+func (*SpatialInterestArea_Sphere_) isSpatialInterestArea_Area() {}
+
+func (*SpatialInterestArea_Cone_) isSpatialInterestArea_Area() {}
+
+func (*SpatialInterestArea_Border_) isSpatialInterestArea_Area() {}
+
+// Attaches the player entity and its interest area to a connection. As the entity moves, channeld subscribes the connection
+// to the spatial channels in the area, and unsubscribes it from the ones out of the area.
+// This message should only be sent by the server connection. It requires the spatial controller to be enabled (-spatial).
+// The packet should have channelId = 0 in order to be handled.
+// Response: no. The subscriptions are notified as @SubscribedToChannelResultMessage and @UnsubscribedFromChannelResultMessage.
+type SpatialInterestMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	ConnId uint32 `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
-}
-
-func (x *UnsubscribedFromChannelMessage) Reset() {
-	*x = UnsubscribedFromChannelMessage{}
+	// The key of the entity in @SpatialChannelDataMessage.entities.
+	EntityId uint32 `protobuf:"varint,2,opt,name=entityId,proto3" json:"entityId,omitempty"`
+	// Null means the player entity is detached, and the connection will be unsubscribed from all the spatial channels in its current interest area,
+	// unless followEntity is true.
+	Area *SpatialInterestArea `protobuf:"bytes,3,opt,name=area,proto3" json:"area,omitempty"`
+	// Only used when the area is null. If true, the player entity is attached without an interest area: the spatial channels are not subscribed automatically,
+	// but the connection's subscription follows the entity when it's handed over to another spatial channel.
+	FollowEntity bool `protobuf:"varint,4,opt,name=followEntity,proto3" json:"followEntity,omitempty"`
+}
+
+func (x *SpatialInterestMessage) Reset() {
+	*x = SpatialInterestMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[14]
+		mi := &file_channeld_proto_msgTypes[37]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *UnsubscribedFromChannelMessage) String() string {
+func (x *SpatialInterestMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UnsubscribedFromChannelMessage) ProtoMessage() {}
+func (*SpatialInterestMessage) ProtoMessage() {}
 
-func (x *UnsubscribedFromChannelMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[14]
+func (x *SpatialInterestMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[37]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1286,46 +3070,79 @@ func (x *UnsubscribedFromChannelMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UnsubscribedFromChannelMessage.ProtoReflect.Descriptor instead.
-func (*UnsubscribedFromChannelMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{14}
+// Deprecated: Use SpatialInterestMessage.ProtoReflect.Descriptor instead.
+func (*SpatialInterestMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{37}
 }
 
-func (x *UnsubscribedFromChannelMessage) GetConnId() uint32 {
+func (x *SpatialInterestMessage) GetConnId() uint32 {
 	if x != nil {
 		return x.ConnId
 	}
 	return 0
 }
 
-type UnsubscribedFromChannelResultMessage struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
+func (x *SpatialInterestMessage) GetEntityId() uint32 {
+	if x != nil {
+		return x.EntityId
+	}
+	return 0
+}
 
-	// The connection that unsubsribed.
-	ConnId      uint32         `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
-	ConnType    ConnectionType `protobuf:"varint,2,opt,name=connType,proto3,enum=channeld.ConnectionType" json:"connType,omitempty"`
-	ChannelType ChannelType    `protobuf:"varint,3,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+func (x *SpatialInterestMessage) GetArea() *SpatialInterestArea {
+	if x != nil {
+		return x.Area
+	}
+	return nil
 }
 
-func (x *UnsubscribedFromChannelResultMessage) Reset() {
-	*x = UnsubscribedFromChannelResultMessage{}
+func (x *SpatialInterestMessage) GetFollowEntity() bool {
+	if x != nil {
+		return x.FollowEntity
+	}
+	return false
+}
+
+// Sent from channeld to the owner of the destination spatial channel, when an entity moves into the channel from the one owned by another server.
+// The entity is frozen in the source channel (the updates of it are dropped) until the handover is committed or rolled back.
+// Also sent when the load balancing hands over the whole spatial channel to another server. In that case, wholeChannel is true, srcChannelId equals dstChannelId,
+// and all the entities in the channel are frozen. The new owner receives the entities from the channel data after it's subscribed on commit.
+// Response: @HandoverPrepareResultMessage with the same msgType. If no response is received within the timeout (-hotimeout), the handover is rolled back.
+type HandoverPrepareMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	HandoverId uint32 `protobuf:"varint,1,opt,name=handoverId,proto3" json:"handoverId,omitempty"`
+	// Not used if wholeChannel is true.
+	EntityId     uint32 `protobuf:"varint,2,opt,name=entityId,proto3" json:"entityId,omitempty"`
+	SrcChannelId uint32 `protobuf:"varint,3,opt,name=srcChannelId,proto3" json:"srcChannelId,omitempty"`
+	DstChannelId uint32 `protobuf:"varint,4,opt,name=dstChannelId,proto3" json:"dstChannelId,omitempty"`
+	// The whole data of the entity, including the new location.
+	Entity *SpatialEntityInfo `protobuf:"bytes,5,opt,name=entity,proto3" json:"entity,omitempty"`
+	// The connection whose player entity is being handed over (see @SpatialInterestMessage). 0 if the entity is not a player.
+	ClientConnId uint32 `protobuf:"varint,6,opt,name=clientConnId,proto3" json:"clientConnId,omitempty"`
+	// Is the whole channel handed over, instead of an entity?
+	WholeChannel bool `protobuf:"varint,7,opt,name=wholeChannel,proto3" json:"wholeChannel,omitempty"`
+}
+
+func (x *HandoverPrepareMessage) Reset() {
+	*x = HandoverPrepareMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[15]
+		mi := &file_channeld_proto_msgTypes[38]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *UnsubscribedFromChannelResultMessage) String() string {
+func (x *HandoverPrepareMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*UnsubscribedFromChannelResultMessage) ProtoMessage() {}
+func (*HandoverPrepareMessage) ProtoMessage() {}
 
-func (x *UnsubscribedFromChannelResultMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[15]
+func (x *HandoverPrepareMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[38]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1336,58 +3153,86 @@ func (x *UnsubscribedFromChannelResultMessage) ProtoReflect() protoreflect.Messa
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use UnsubscribedFromChannelResultMessage.ProtoReflect.Descriptor instead.
-func (*UnsubscribedFromChannelResultMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{15}
+// Deprecated: Use HandoverPrepareMessage.ProtoReflect.Descriptor instead.
+func (*HandoverPrepareMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{38}
 }
 
-func (x *UnsubscribedFromChannelResultMessage) GetConnId() uint32 {
+func (x *HandoverPrepareMessage) GetHandoverId() uint32 {
 	if x != nil {
-		return x.ConnId
+		return x.HandoverId
 	}
 	return 0
 }
 
-func (x *UnsubscribedFromChannelResultMessage) GetConnType() ConnectionType {
+func (x *HandoverPrepareMessage) GetEntityId() uint32 {
 	if x != nil {
-		return x.ConnType
+		return x.EntityId
 	}
-	return ConnectionType_NO_CONNECTION
+	return 0
 }
 
-func (x *UnsubscribedFromChannelResultMessage) GetChannelType() ChannelType {
+func (x *HandoverPrepareMessage) GetSrcChannelId() uint32 {
 	if x != nil {
-		return x.ChannelType
+		return x.SrcChannelId
 	}
-	return ChannelType_UNKNOWN
+	return 0
 }
 
-// Response: no. Each connection in the channel receives the @ChannelDataUpdateMessage in every @ChannelSubscriptionOptions.FanOutIntervalMs
-type ChannelDataUpdateMessage struct {
+func (x *HandoverPrepareMessage) GetDstChannelId() uint32 {
+	if x != nil {
+		return x.DstChannelId
+	}
+	return 0
+}
+
+func (x *HandoverPrepareMessage) GetEntity() *SpatialEntityInfo {
+	if x != nil {
+		return x.Entity
+	}
+	return nil
+}
+
+func (x *HandoverPrepareMessage) GetClientConnId() uint32 {
+	if x != nil {
+		return x.ClientConnId
+	}
+	return 0
+}
+
+func (x *HandoverPrepareMessage) GetWholeChannel() bool {
+	if x != nil {
+		return x.WholeChannel
+	}
+	return false
+}
+
+type HandoverPrepareResultMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Data *anypb.Any `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	HandoverId uint32 `protobuf:"varint,1,opt,name=handoverId,proto3" json:"handoverId,omitempty"`
+	Accepted   bool   `protobuf:"varint,2,opt,name=accepted,proto3" json:"accepted,omitempty"`
 }
 
-func (x *ChannelDataUpdateMessage) Reset() {
-	*x = ChannelDataUpdateMessage{}
+func (x *HandoverPrepareResultMessage) Reset() {
+	*x = HandoverPrepareResultMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[16]
+		mi := &file_channeld_proto_msgTypes[39]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *ChannelDataUpdateMessage) String() string {
+func (x *HandoverPrepareResultMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ChannelDataUpdateMessage) ProtoMessage() {}
+func (*HandoverPrepareResultMessage) ProtoMessage() {}
 
-func (x *ChannelDataUpdateMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[16]
+func (x *HandoverPrepareResultMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[39]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1398,47 +3243,58 @@ func (x *ChannelDataUpdateMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ChannelDataUpdateMessage.ProtoReflect.Descriptor instead.
-func (*ChannelDataUpdateMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{16}
+// Deprecated: Use HandoverPrepareResultMessage.ProtoReflect.Descriptor instead.
+func (*HandoverPrepareResultMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{39}
 }
 
-func (x *ChannelDataUpdateMessage) GetData() *anypb.Any {
+func (x *HandoverPrepareResultMessage) GetHandoverId() uint32 {
 	if x != nil {
-		return x.Data
+		return x.HandoverId
 	}
-	return nil
+	return 0
 }
 
-// Disconnect another connection from channeld.
-// This message should only be sent by the server connection in a server-authoratative environment.
-// The packet should have channelId = 0 in order to be handled.
-// Response: no.
-type DisconnectMessage struct {
+func (x *HandoverPrepareResultMessage) GetAccepted() bool {
+	if x != nil {
+		return x.Accepted
+	}
+	return false
+}
+
+// Sent from channeld to both the source and the destination channel owners with msgType = HANDOVER_COMMIT or HANDOVER_ROLLBACK.
+// If committed, the entity has been moved from the source channel's data to the destination channel's, and the player's subscription has been moved as well.
+// If rolled back, the entity stays in the source channel with its data before the handover.
+type HandoverEventMessage struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ConnId uint32 `protobuf:"varint,1,opt,name=connId,proto3" json:"connId,omitempty"`
+	HandoverId   uint32 `protobuf:"varint,1,opt,name=handoverId,proto3" json:"handoverId,omitempty"`
+	EntityId     uint32 `protobuf:"varint,2,opt,name=entityId,proto3" json:"entityId,omitempty"`
+	SrcChannelId uint32 `protobuf:"varint,3,opt,name=srcChannelId,proto3" json:"srcChannelId,omitempty"`
+	DstChannelId uint32 `protobuf:"varint,4,opt,name=dstChannelId,proto3" json:"dstChannelId,omitempty"`
+	ClientConnId uint32 `protobuf:"varint,5,opt,name=clientConnId,proto3" json:"clientConnId,omitempty"`
+	WholeChannel bool   `protobuf:"varint,6,opt,name=wholeChannel,proto3" json:"wholeChannel,omitempty"`
 }
 
-func (x *DisconnectMessage) Reset() {
-	*x = DisconnectMessage{}
+func (x *HandoverEventMessage) Reset() {
+	*x = HandoverEventMessage{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[17]
+		mi := &file_channeld_proto_msgTypes[40]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *DisconnectMessage) String() string {
+func (x *HandoverEventMessage) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*DisconnectMessage) ProtoMessage() {}
+func (*HandoverEventMessage) ProtoMessage() {}
 
-func (x *DisconnectMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[17]
+func (x *HandoverEventMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[40]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1449,45 +3305,80 @@ func (x *DisconnectMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use DisconnectMessage.ProtoReflect.Descriptor instead.
-func (*DisconnectMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{17}
+// Deprecated: Use HandoverEventMessage.ProtoReflect.Descriptor instead.
+func (*HandoverEventMessage) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{40}
 }
 
-func (x *DisconnectMessage) GetConnId() uint32 {
+func (x *HandoverEventMessage) GetHandoverId() uint32 {
 	if x != nil {
-		return x.ConnId
+		return x.HandoverId
 	}
 	return 0
 }
 
-type Location struct {
+func (x *HandoverEventMessage) GetEntityId() uint32 {
+	if x != nil {
+		return x.EntityId
+	}
+	return 0
+}
+
+func (x *HandoverEventMessage) GetSrcChannelId() uint32 {
+	if x != nil {
+		return x.SrcChannelId
+	}
+	return 0
+}
+
+func (x *HandoverEventMessage) GetDstChannelId() uint32 {
+	if x != nil {
+		return x.DstChannelId
+	}
+	return 0
+}
+
+func (x *HandoverEventMessage) GetClientConnId() uint32 {
+	if x != nil {
+		return x.ClientConnId
+	}
+	return 0
+}
+
+func (x *HandoverEventMessage) GetWholeChannel() bool {
+	if x != nil {
+		return x.WholeChannel
+	}
+	return false
+}
+
+type ListChannelResultMessage_ChannelInfo struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	X float64 `protobuf:"fixed64,1,opt,name=x,proto3" json:"x,omitempty"`
-	Y float64 `protobuf:"fixed64,2,opt,name=y,proto3" json:"y,omitempty"`
-	Z float64 `protobuf:"fixed64,3,opt,name=z,proto3" json:"z,omitempty"`
+	ChannelId   uint32      `protobuf:"varint,1,opt,name=channelId,proto3" json:"channelId,omitempty"`
+	ChannelType ChannelType `protobuf:"varint,2,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
+	Metadata    string      `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`
 }
 
-func (x *Location) Reset() {
-	*x = Location{}
+func (x *ListChannelResultMessage_ChannelInfo) Reset() {
+	*x = ListChannelResultMessage_ChannelInfo{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[18]
+		mi := &file_channeld_proto_msgTypes[41]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *Location) String() string {
+func (x *ListChannelResultMessage_ChannelInfo) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Location) ProtoMessage() {}
+func (*ListChannelResultMessage_ChannelInfo) ProtoMessage() {}
 
-func (x *Location) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[18]
+func (x *ListChannelResultMessage_ChannelInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[41]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1498,57 +3389,57 @@ func (x *Location) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Location.ProtoReflect.Descriptor instead.
-func (*Location) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{18}
+// Deprecated: Use ListChannelResultMessage_ChannelInfo.ProtoReflect.Descriptor instead.
+func (*ListChannelResultMessage_ChannelInfo) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{15, 0}
 }
 
-func (x *Location) GetX() float64 {
+func (x *ListChannelResultMessage_ChannelInfo) GetChannelId() uint32 {
 	if x != nil {
-		return x.X
+		return x.ChannelId
 	}
 	return 0
 }
 
-func (x *Location) GetY() float64 {
+func (x *ListChannelResultMessage_ChannelInfo) GetChannelType() ChannelType {
 	if x != nil {
-		return x.Y
+		return x.ChannelType
 	}
-	return 0
+	return ChannelType_UNKNOWN
 }
 
-func (x *Location) GetZ() float64 {
+func (x *ListChannelResultMessage_ChannelInfo) GetMetadata() string {
 	if x != nil {
-		return x.Z
+		return x.Metadata
 	}
-	return 0
+	return ""
 }
 
-type SpatialEntityInfo struct {
+type SpatialInterestArea_Sphere struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Loc *Location `protobuf:"bytes,1,opt,name=loc,proto3" json:"loc,omitempty"`
+	Radius float64 `protobuf:"fixed64,1,opt,name=radius,proto3" json:"radius,omitempty"`
 }
 
-func (x *SpatialEntityInfo) Reset() {
-	*x = SpatialEntityInfo{}
+func (x *SpatialInterestArea_Sphere) Reset() {
+	*x = SpatialInterestArea_Sphere{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[19]
+		mi := &file_channeld_proto_msgTypes[47]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *SpatialEntityInfo) String() string {
+func (x *SpatialInterestArea_Sphere) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SpatialEntityInfo) ProtoMessage() {}
+func (*SpatialInterestArea_Sphere) ProtoMessage() {}
 
-func (x *SpatialEntityInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[19]
+func (x *SpatialInterestArea_Sphere) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[47]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1559,43 +3450,47 @@ func (x *SpatialEntityInfo) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SpatialEntityInfo.ProtoReflect.Descriptor instead.
-func (*SpatialEntityInfo) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{19}
+// Deprecated: Use SpatialInterestArea_Sphere.ProtoReflect.Descriptor instead.
+func (*SpatialInterestArea_Sphere) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{36, 0}
 }
 
-func (x *SpatialEntityInfo) GetLoc() *Location {
+func (x *SpatialInterestArea_Sphere) GetRadius() float64 {
 	if x != nil {
-		return x.Loc
+		return x.Radius
 	}
-	return nil
+	return 0
 }
 
-type SpatialChannelDataMessage struct {
+type SpatialInterestArea_Cone struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Entities map[uint32]*SpatialEntityInfo `protobuf:"bytes,1,rep,name=entities,proto3" json:"entities,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// The direction that the player entity faces.
+	Direction *Location `protobuf:"bytes,1,opt,name=direction,proto3" json:"direction,omitempty"`
+	// The half angle of the cone, in radians.
+	Angle  float64 `protobuf:"fixed64,2,opt,name=angle,proto3" json:"angle,omitempty"`
+	Radius float64 `protobuf:"fixed64,3,opt,name=radius,proto3" json:"radius,omitempty"`
 }
 
-func (x *SpatialChannelDataMessage) Reset() {
-	*x = SpatialChannelDataMessage{}
+func (x *SpatialInterestArea_Cone) Reset() {
+	*x = SpatialInterestArea_Cone{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[20]
+		mi := &file_channeld_proto_msgTypes[48]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *SpatialChannelDataMessage) String() string {
+func (x *SpatialInterestArea_Cone) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SpatialChannelDataMessage) ProtoMessage() {}
+func (*SpatialInterestArea_Cone) ProtoMessage() {}
 
-func (x *SpatialChannelDataMessage) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[20]
+func (x *SpatialInterestArea_Cone) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[48]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1606,45 +3501,58 @@ func (x *SpatialChannelDataMessage) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SpatialChannelDataMessage.ProtoReflect.Descriptor instead.
-func (*SpatialChannelDataMessage) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{20}
+// Deprecated: Use SpatialInterestArea_Cone.ProtoReflect.Descriptor instead.
+func (*SpatialInterestArea_Cone) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{36, 1}
 }
 
-func (x *SpatialChannelDataMessage) GetEntities() map[uint32]*SpatialEntityInfo {
+func (x *SpatialInterestArea_Cone) GetDirection() *Location {
 	if x != nil {
-		return x.Entities
+		return x.Direction
 	}
 	return nil
 }
 
-type ListChannelResultMessage_ChannelInfo struct {
+func (x *SpatialInterestArea_Cone) GetAngle() float64 {
+	if x != nil {
+		return x.Angle
+	}
+	return 0
+}
+
+func (x *SpatialInterestArea_Cone) GetRadius() float64 {
+	if x != nil {
+		return x.Radius
+	}
+	return 0
+}
+
+// The cells within N cells of the cell that contains the entity.
+type SpatialInterestArea_Border struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	ChannelId   uint32      `protobuf:"varint,1,opt,name=channelId,proto3" json:"channelId,omitempty"`
-	ChannelType ChannelType `protobuf:"varint,2,opt,name=channelType,proto3,enum=channeld.ChannelType" json:"channelType,omitempty"`
-	Metadata    string      `protobuf:"bytes,3,opt,name=metadata,proto3" json:"metadata,omitempty"`
+	CellNum uint32 `protobuf:"varint,1,opt,name=cellNum,proto3" json:"cellNum,omitempty"`
 }
 
-func (x *ListChannelResultMessage_ChannelInfo) Reset() {
-	*x = ListChannelResultMessage_ChannelInfo{}
+func (x *SpatialInterestArea_Border) Reset() {
+	*x = SpatialInterestArea_Border{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_channeld_proto_msgTypes[21]
+		mi := &file_channeld_proto_msgTypes[49]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *ListChannelResultMessage_ChannelInfo) String() string {
+func (x *SpatialInterestArea_Border) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*ListChannelResultMessage_ChannelInfo) ProtoMessage() {}
+func (*SpatialInterestArea_Border) ProtoMessage() {}
 
-func (x *ListChannelResultMessage_ChannelInfo) ProtoReflect() protoreflect.Message {
-	mi := &file_channeld_proto_msgTypes[21]
+func (x *SpatialInterestArea_Border) ProtoReflect() protoreflect.Message {
+	mi := &file_channeld_proto_msgTypes[49]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1655,32 +3563,18 @@ func (x *ListChannelResultMessage_ChannelInfo) ProtoReflect() protoreflect.Messa
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use ListChannelResultMessage_ChannelInfo.ProtoReflect.Descriptor instead.
-func (*ListChannelResultMessage_ChannelInfo) Descriptor() ([]byte, []int) {
-	return file_channeld_proto_rawDescGZIP(), []int{11, 0}
+// Deprecated: Use SpatialInterestArea_Border.ProtoReflect.Descriptor instead.
+func (*SpatialInterestArea_Border) Descriptor() ([]byte, []int) {
+	return file_channeld_proto_rawDescGZIP(), []int{36, 2}
 }
 
-func (x *ListChannelResultMessage_ChannelInfo) GetChannelId() uint32 {
+func (x *SpatialInterestArea_Border) GetCellNum() uint32 {
 	if x != nil {
-		return x.ChannelId
+		return x.CellNum
 	}
 	return 0
 }
 
-func (x *ListChannelResultMessage_ChannelInfo) GetChannelType() ChannelType {
-	if x != nil {
-		return x.ChannelType
-	}
-	return ChannelType_UNKNOWN
-}
-
-func (x *ListChannelResultMessage_ChannelInfo) GetMetadata() string {
-	if x != nil {
-		return x.Metadata
-	}
-	return ""
-}
-
 var File_channeld_proto protoreflect.FileDescriptor
 
 var file_channeld_proto_rawDesc = []byte{
@@ -1713,8 +3607,8 @@ var file_channeld_proto_rawDesc = []byte{
 	0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x15, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x49,
 	0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x1e,
 	0x0a, 0x0a, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01,
-	0x28, 0x09, 0x52, 0x0a, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x22, 0xef,
-	0x01, 0x0a, 0x11, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73,
+	0x28, 0x09, 0x52, 0x0a, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x22, 0x91,
+	0x02, 0x0a, 0x11, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73,
 	0x73, 0x61, 0x67, 0x65, 0x12, 0x3e, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x01,
 	0x20, 0x01, 0x28, 0x0e, 0x32, 0x26, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e,
 	0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
@@ -1725,186 +3619,487 @@ var file_channeld_proto_rawDesc = []byte{
 	0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x19, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64,
 	0x2e, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65,
 	0x52, 0x0f, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70,
-	0x65, 0x22, 0x3d, 0x0a, 0x0a, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12,
-	0x0e, 0x0a, 0x0a, 0x53, 0x55, 0x43, 0x43, 0x45, 0x53, 0x53, 0x46, 0x55, 0x4c, 0x10, 0x00, 0x12,
-	0x0f, 0x0a, 0x0b, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x50, 0x49, 0x54, 0x10, 0x01,
-	0x12, 0x0e, 0x0a, 0x0a, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x4c, 0x54, 0x10, 0x02,
-	0x22, 0x96, 0x01, 0x0a, 0x1a, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x75, 0x62, 0x73,
-	0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12,
-	0x24, 0x0a, 0x0d, 0x43, 0x61, 0x6e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x44, 0x61, 0x74, 0x61,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x43, 0x61, 0x6e, 0x55, 0x70, 0x64, 0x61, 0x74,
-	0x65, 0x44, 0x61, 0x74, 0x61, 0x12, 0x26, 0x0a, 0x0e, 0x44, 0x61, 0x74, 0x61, 0x46, 0x69, 0x65,
-	0x6c, 0x64, 0x4d, 0x61, 0x73, 0x6b, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x44,
-	0x61, 0x74, 0x61, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4d, 0x61, 0x73, 0x6b, 0x73, 0x12, 0x2a, 0x0a,
-	0x10, 0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d,
-	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x10, 0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49,
-	0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73, 0x22, 0xd3, 0x01, 0x0a, 0x17, 0x43, 0x68,
-	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70,
-	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x2c, 0x0a, 0x11, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x52,
-	0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08,
-	0x52, 0x11, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x4c,
-	0x69, 0x73, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x6c, 0x69, 0x73, 0x74, 0x53, 0x69, 0x7a, 0x65, 0x4c,
-	0x69, 0x6d, 0x69, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x6c, 0x69, 0x73, 0x74,
-	0x53, 0x69, 0x7a, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x74, 0x72, 0x75,
-	0x6e, 0x63, 0x61, 0x74, 0x65, 0x54, 0x6f, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b,
-	0x74, 0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x54, 0x6f, 0x70, 0x12, 0x42, 0x0a, 0x1c, 0x73,
-	0x68, 0x6f, 0x75, 0x6c, 0x64, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x61,
-	0x62, 0x6c, 0x65, 0x4d, 0x61, 0x70, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x08, 0x52, 0x1c, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65,
-	0x6d, 0x6f, 0x76, 0x61, 0x62, 0x6c, 0x65, 0x4d, 0x61, 0x70, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x22,
-	0xa2, 0x02, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
-	0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e,
-	0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e,
-	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70,
-	0x65, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x44, 0x0a,
-	0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x24, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61,
-	0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e,
-	0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69,
-	0x6f, 0x6e, 0x73, 0x12, 0x28, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28,
-	0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f,
-	0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x45, 0x0a,
-	0x0c, 0x6d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x05, 0x20,
-	0x01, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43,
-	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x72, 0x67, 0x65, 0x4f,
-	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0c, 0x6d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70, 0x74,
-	0x69, 0x6f, 0x6e, 0x73, 0x22, 0x93, 0x01, 0x0a, 0x1a, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x43,
-	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79,
-	0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e,
-	0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52,
-	0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08,
-	0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
-	0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x20, 0x0a, 0x0b, 0x6f, 0x77, 0x6e, 0x65,
-	0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6f,
-	0x77, 0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x22, 0x34, 0x0a, 0x14, 0x52, 0x65,
-	0x6d, 0x6f, 0x76, 0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61,
-	0x67, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64,
-	0x22, 0x75, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x35, 0x0a, 0x0a, 0x74, 0x79, 0x70, 0x65, 0x46, 0x69,
-	0x6c, 0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61,
-	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70,
-	0x65, 0x52, 0x0a, 0x74, 0x79, 0x70, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x28, 0x0a,
-	0x0f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73,
-	0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61,
-	0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x22, 0xe9, 0x01, 0x0a, 0x18, 0x4c, 0x69, 0x73, 0x74,
-	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73,
-	0x73, 0x61, 0x67, 0x65, 0x12, 0x4a, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73,
-	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2e, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x64, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73,
-	0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e,
-	0x65, 0x6c, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73,
-	0x1a, 0x80, 0x01, 0x0a, 0x0b, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x6e, 0x66, 0x6f,
-	0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0d, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x37,
-	0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43,
-	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e,
-	0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64,
-	0x61, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64,
-	0x61, 0x74, 0x61, 0x22, 0x7a, 0x0a, 0x1a, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65,
-	0x64, 0x54, 0x6f, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
-	0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x44, 0x0a, 0x0a, 0x73, 0x75, 0x62,
-	0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x24, 0x2e,
-	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69,
-	0x6f, 0x6e, 0x73, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x22,
-	0xef, 0x01, 0x0a, 0x20, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x54, 0x6f,
-	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73,
-	0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x44, 0x0a, 0x0a,
-	0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x65, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54, 0x6f, 0x6b, 0x65, 0x6e,
+	0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54, 0x6f,
+	0x6b, 0x65, 0x6e, 0x22, 0x3d, 0x0a, 0x0a, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x12, 0x0e, 0x0a, 0x0a, 0x53, 0x55, 0x43, 0x43, 0x45, 0x53, 0x53, 0x46, 0x55, 0x4c, 0x10,
+	0x00, 0x12, 0x0f, 0x0a, 0x0b, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x50, 0x49, 0x54,
+	0x10, 0x01, 0x12, 0x0e, 0x0a, 0x0a, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x5f, 0x4c, 0x54,
+	0x10, 0x02, 0x22, 0x31, 0x0a, 0x0d, 0x52, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54, 0x6f, 0x6b,
+	0x65, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65,
+	0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x22, 0xb4, 0x01, 0x0a, 0x13, 0x52, 0x65, 0x73, 0x75, 0x6d, 0x65,
+	0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a,
+	0x0a, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x66, 0x75, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0a, 0x73, 0x75, 0x63, 0x63, 0x65, 0x73, 0x73, 0x66, 0x75, 0x6c, 0x12, 0x16, 0x0a,
+	0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63,
+	0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x20, 0x0a, 0x0b, 0x72, 0x65, 0x73, 0x75, 0x6d, 0x65, 0x54,
+	0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x72, 0x65, 0x73, 0x75,
+	0x6d, 0x65, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x43, 0x0a, 0x0f, 0x63, 0x6f, 0x6d, 0x70, 0x72,
+	0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x19, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x6f, 0x6d, 0x70,
+	0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0f, 0x63, 0x6f, 0x6d,
+	0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x22, 0x85, 0x01, 0x0a,
+	0x15, 0x41, 0x75, 0x74, 0x68, 0x44, 0x65, 0x6c, 0x65, 0x67, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x34,
+	0x0a, 0x15, 0x70, 0x6c, 0x61, 0x79, 0x65, 0x72, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69,
+	0x65, 0x72, 0x54, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x15, 0x70,
+	0x6c, 0x61, 0x79, 0x65, 0x72, 0x49, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x66, 0x69, 0x65, 0x72, 0x54,
+	0x6f, 0x6b, 0x65, 0x6e, 0x12, 0x1e, 0x0a, 0x0a, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x54, 0x6f, 0x6b,
+	0x65, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x6c, 0x6f, 0x67, 0x69, 0x6e, 0x54,
+	0x6f, 0x6b, 0x65, 0x6e, 0x22, 0x75, 0x0a, 0x1b, 0x41, 0x75, 0x74, 0x68, 0x44, 0x65, 0x6c, 0x65,
+	0x67, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x3e, 0x0a, 0x06, 0x72,
+	0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x26, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x41, 0x75, 0x74, 0x68, 0x52, 0x65, 0x73,
+	0x75, 0x6c, 0x74, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22, 0xca, 0x02, 0x0a, 0x1a,
+	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x24, 0x0a, 0x0d, 0x43, 0x61,
+	0x6e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x44, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x08, 0x52, 0x0d, 0x43, 0x61, 0x6e, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x44, 0x61, 0x74, 0x61,
+	0x12, 0x26, 0x0a, 0x0e, 0x44, 0x61, 0x74, 0x61, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4d, 0x61, 0x73,
+	0x6b, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x44, 0x61, 0x74, 0x61, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x4d, 0x61, 0x73, 0x6b, 0x73, 0x12, 0x2a, 0x0a, 0x10, 0x46, 0x61, 0x6e, 0x4f,
+	0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x10, 0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76,
+	0x61, 0x6c, 0x4d, 0x73, 0x12, 0x20, 0x0a, 0x0b, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x46, 0x61, 0x6e,
+	0x4f, 0x75, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x44, 0x65, 0x6c, 0x74, 0x61,
+	0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x12, 0x28, 0x0a, 0x0f, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46,
+	0x69, 0x65, 0x6c, 0x64, 0x4d, 0x61, 0x73, 0x6b, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x0f, 0x57, 0x72, 0x69, 0x74, 0x65, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x4d, 0x61, 0x73, 0x6b, 0x73,
+	0x12, 0x32, 0x0a, 0x14, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x4b, 0x65, 0x79, 0x65, 0x64, 0x4d,
+	0x61, 0x70, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x14,
+	0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x4b, 0x65, 0x79, 0x65, 0x64, 0x4d, 0x61, 0x70, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x73, 0x12, 0x32, 0x0a, 0x14, 0x52, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x57, 0x72,
+	0x69, 0x74, 0x65, 0x56, 0x69, 0x6f, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01,
+	0x28, 0x08, 0x52, 0x14, 0x52, 0x65, 0x6a, 0x65, 0x63, 0x74, 0x57, 0x72, 0x69, 0x74, 0x65, 0x56,
+	0x69, 0x6f, 0x6c, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xd3, 0x01, 0x0a, 0x17, 0x43, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70, 0x74,
+	0x69, 0x6f, 0x6e, 0x73, 0x12, 0x2c, 0x0a, 0x11, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x52, 0x65,
+	0x70, 0x6c, 0x61, 0x63, 0x65, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x11, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x52, 0x65, 0x70, 0x6c, 0x61, 0x63, 0x65, 0x4c, 0x69,
+	0x73, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x6c, 0x69, 0x73, 0x74, 0x53, 0x69, 0x7a, 0x65, 0x4c, 0x69,
+	0x6d, 0x69, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x6c, 0x69, 0x73, 0x74, 0x53,
+	0x69, 0x7a, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x20, 0x0a, 0x0b, 0x74, 0x72, 0x75, 0x6e,
+	0x63, 0x61, 0x74, 0x65, 0x54, 0x6f, 0x70, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0b, 0x74,
+	0x72, 0x75, 0x6e, 0x63, 0x61, 0x74, 0x65, 0x54, 0x6f, 0x70, 0x12, 0x42, 0x0a, 0x1c, 0x73, 0x68,
+	0x6f, 0x75, 0x6c, 0x64, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x61, 0x62,
+	0x6c, 0x65, 0x4d, 0x61, 0x70, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x1c, 0x73, 0x68, 0x6f, 0x75, 0x6c, 0x64, 0x43, 0x68, 0x65, 0x63, 0x6b, 0x52, 0x65, 0x6d,
+	0x6f, 0x76, 0x61, 0x62, 0x6c, 0x65, 0x4d, 0x61, 0x70, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x22, 0xa2,
+	0x02, 0x0a, 0x14, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e,
+	0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54,
+	0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x44, 0x0a, 0x0a,
+	0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b,
 	0x32, 0x24, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e,
 	0x6e, 0x65, 0x6c, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x4f,
 	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f,
-	0x6e, 0x73, 0x12, 0x34, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x03,
-	0x20, 0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e,
-	0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x08,
-	0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e,
-	0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e,
-	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70,
-	0x65, 0x22, 0x38, 0x0a, 0x1e, 0x55, 0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65,
-	0x64, 0x46, 0x72, 0x6f, 0x6d, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73,
-	0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x22, 0xad, 0x01, 0x0a, 0x24,
-	0x55, 0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d,
-	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73,
-	0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x34, 0x0a, 0x08,
-	0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x18,
-	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63,
-	0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79,
-	0x70, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70,
-	0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6e, 0x73, 0x12, 0x28, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62,
+	0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x45, 0x0a, 0x0c,
+	0x6d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x05, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x21, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0c, 0x6d, 0x65, 0x72, 0x67, 0x65, 0x4f, 0x70, 0x74, 0x69,
+	0x6f, 0x6e, 0x73, 0x22, 0x93, 0x01, 0x0a, 0x1a, 0x43, 0x72, 0x65, 0x61, 0x74, 0x65, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65,
 	0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0b,
-	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x22, 0x44, 0x0a, 0x18, 0x43,
-	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65,
-	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x28, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x6d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6d,
+	0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x12, 0x20, 0x0a, 0x0b, 0x6f, 0x77, 0x6e, 0x65, 0x72,
+	0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6f, 0x77,
+	0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x22, 0x34, 0x0a, 0x14, 0x52, 0x65, 0x6d,
+	0x6f, 0x76, 0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x22,
+	0x75, 0x0a, 0x12, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x35, 0x0a, 0x0a, 0x74, 0x79, 0x70, 0x65, 0x46, 0x69, 0x6c,
+	0x74, 0x65, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e,
+	0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65,
+	0x52, 0x0a, 0x74, 0x79, 0x70, 0x65, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x12, 0x28, 0x0a, 0x0f,
+	0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x46, 0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x18,
+	0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61, 0x74, 0x61, 0x46,
+	0x69, 0x6c, 0x74, 0x65, 0x72, 0x73, 0x22, 0xe9, 0x01, 0x0a, 0x18, 0x4c, 0x69, 0x73, 0x74, 0x43,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x4a, 0x0a, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x18,
+	0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2e, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64,
+	0x2e, 0x4c, 0x69, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6c, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x73, 0x1a,
+	0x80, 0x01, 0x0a, 0x0b, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x6e, 0x66, 0x6f, 0x12,
+	0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x37, 0x0a,
+	0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e,
+	0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61,
+	0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x6d, 0x65, 0x74, 0x61, 0x64, 0x61,
+	0x74, 0x61, 0x22, 0x7a, 0x0a, 0x1a, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64,
+	0x54, 0x6f, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x44, 0x0a, 0x0a, 0x73, 0x75, 0x62, 0x4f,
+	0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x53,
+	0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x70, 0x74, 0x69, 0x6f,
+	0x6e, 0x73, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x22, 0xef,
+	0x01, 0x0a, 0x20, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x54, 0x6f, 0x43,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x44, 0x0a, 0x0a, 0x73,
+	0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32,
+	0x24, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e,
+	0x65, 0x6c, 0x53, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x4f, 0x70,
+	0x74, 0x69, 0x6f, 0x6e, 0x73, 0x52, 0x0a, 0x73, 0x75, 0x62, 0x4f, 0x70, 0x74, 0x69, 0x6f, 0x6e,
+	0x73, 0x12, 0x34, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43,
+	0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x08, 0x63,
+	0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e,
+	0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54,
+	0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65,
+	0x22, 0x38, 0x0a, 0x1e, 0x55, 0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64,
+	0x46, 0x72, 0x6f, 0x6d, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x22, 0xad, 0x01, 0x0a, 0x24, 0x55,
+	0x6e, 0x73, 0x75, 0x62, 0x73, 0x63, 0x72, 0x69, 0x62, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x43,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x34, 0x0a, 0x08, 0x63,
+	0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x18, 0x2e,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74,
+	0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
+	0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x22, 0xa4, 0x01, 0x0a, 0x18, 0x54,
+	0x72, 0x61, 0x6e, 0x73, 0x66, 0x65, 0x72, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x73, 0x68, 0x69, 0x70,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x26, 0x0a, 0x0e, 0x6e, 0x65, 0x77, 0x4f, 0x77,
+	0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0e, 0x6e, 0x65, 0x77, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12,
+	0x30, 0x0a, 0x13, 0x73, 0x74, 0x61, 0x6e, 0x64, 0x62, 0x79, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43,
+	0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x13, 0x73, 0x74,
+	0x61, 0x6e, 0x64, 0x62, 0x79, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
+	0x73, 0x12, 0x2e, 0x0a, 0x12, 0x63, 0x6c, 0x65, 0x61, 0x72, 0x53, 0x74, 0x61, 0x6e, 0x64, 0x62,
+	0x79, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x12, 0x63,
+	0x6c, 0x65, 0x61, 0x72, 0x53, 0x74, 0x61, 0x6e, 0x64, 0x62, 0x79, 0x4f, 0x77, 0x6e, 0x65, 0x72,
+	0x73, 0x22, 0xbe, 0x01, 0x0a, 0x17, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x73, 0x68, 0x69, 0x70, 0x43,
+	0x68, 0x61, 0x6e, 0x67, 0x65, 0x64, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x26, 0x0a,
+	0x0e, 0x6f, 0x6c, 0x64, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x6f, 0x6c, 0x64, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43,
+	0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x26, 0x0a, 0x0e, 0x6e, 0x65, 0x77, 0x4f, 0x77, 0x6e, 0x65,
+	0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0e, 0x6e,
+	0x65, 0x77, 0x4f, 0x77, 0x6e, 0x65, 0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x1a, 0x0a,
+	0x08, 0x66, 0x61, 0x69, 0x6c, 0x6f, 0x76, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x08, 0x66, 0x61, 0x69, 0x6c, 0x6f, 0x76, 0x65, 0x72, 0x12, 0x37, 0x0a, 0x0b, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x15,
+	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6c, 0x54, 0x79, 0x70, 0x65, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79,
+	0x70, 0x65, 0x22, 0x72, 0x0a, 0x18, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74,
+	0x61, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x28,
+	0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67,
+	0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41,
+	0x6e, 0x79, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x2c, 0x0a, 0x05, 0x64, 0x65, 0x6c, 0x74,
+	0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x52,
+	0x05, 0x64, 0x65, 0x6c, 0x74, 0x61, 0x22, 0x80, 0x04, 0x0a, 0x0c, 0x4d, 0x65, 0x73, 0x73, 0x61,
+	0x67, 0x65, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x12, 0x10, 0x0a, 0x03, 0x73, 0x65, 0x74, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x73, 0x65, 0x74, 0x12, 0x24, 0x0a, 0x0d, 0x63, 0x6c, 0x65,
+	0x61, 0x72, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0d,
+	0x52, 0x0d, 0x63, 0x6c, 0x65, 0x61, 0x72, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x12,
+	0x52, 0x0a, 0x0e, 0x6d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64,
+	0x73, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x2a, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x2e,
+	0x4d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x46, 0x69, 0x65, 0x6c, 0x64, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x52, 0x0e, 0x6d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x46, 0x69, 0x65,
+	0x6c, 0x64, 0x73, 0x12, 0x37, 0x0a, 0x05, 0x6c, 0x69, 0x73, 0x74, 0x73, 0x18, 0x04, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x21, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x73,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x05, 0x6c, 0x69, 0x73, 0x74, 0x73, 0x12, 0x34, 0x0a, 0x04,
+	0x6d, 0x61, 0x70, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x20, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c,
+	0x74, 0x61, 0x2e, 0x4d, 0x61, 0x70, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x04, 0x6d, 0x61,
+	0x70, 0x73, 0x1a, 0x59, 0x0a, 0x13, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x46, 0x69,
+	0x65, 0x6c, 0x64, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x2c, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c,
+	0x74, 0x61, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x4d, 0x0a,
+	0x0a, 0x4c, 0x69, 0x73, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x29, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x13, 0x2e, 0x63,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x65, 0x6c, 0x74,
+	0x61, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x4b, 0x0a, 0x09,
+	0x4d, 0x61, 0x70, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x28, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x61, 0x70, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x52, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x91, 0x02, 0x0a, 0x09, 0x4c, 0x69,
+	0x73, 0x74, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x12, 0x1a, 0x0a, 0x08, 0x72, 0x65, 0x70, 0x6c, 0x61,
+	0x63, 0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x72, 0x65, 0x70, 0x6c, 0x61,
+	0x63, 0x65, 0x64, 0x12, 0x2a, 0x0a, 0x10, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x46, 0x72,
+	0x6f, 0x6d, 0x46, 0x72, 0x6f, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x10, 0x72,
+	0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x46, 0x72, 0x6f, 0x6e, 0x74, 0x12,
+	0x28, 0x0a, 0x0f, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x46, 0x72, 0x6f, 0x6d, 0x42, 0x61,
+	0x63, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65,
+	0x64, 0x46, 0x72, 0x6f, 0x6d, 0x42, 0x61, 0x63, 0x6b, 0x12, 0x3d, 0x0a, 0x08, 0x6d, 0x6f, 0x64,
+	0x69, 0x66, 0x69, 0x65, 0x64, 0x18, 0x04, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x21, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x44, 0x65, 0x6c, 0x74, 0x61,
+	0x2e, 0x4d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x08,
+	0x6d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x1a, 0x53, 0x0a, 0x0d, 0x4d, 0x6f, 0x64, 0x69,
+	0x66, 0x69, 0x65, 0x64, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x2c, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65, 0x6c,
+	0x74, 0x61, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x95, 0x01,
+	0x0a, 0x08, 0x4d, 0x61, 0x70, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x12, 0x26, 0x0a, 0x0e, 0x72, 0x65,
+	0x6d, 0x6f, 0x76, 0x65, 0x64, 0x49, 0x6e, 0x74, 0x4b, 0x65, 0x79, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x04, 0x52, 0x0e, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x49, 0x6e, 0x74, 0x4b, 0x65,
+	0x79, 0x73, 0x12, 0x2c, 0x0a, 0x11, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x53, 0x74, 0x72,
+	0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x09, 0x52, 0x11, 0x72,
+	0x65, 0x6d, 0x6f, 0x76, 0x65, 0x64, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x73,
+	0x12, 0x33, 0x0a, 0x08, 0x6d, 0x6f, 0x64, 0x69, 0x66, 0x69, 0x65, 0x64, 0x18, 0x03, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x17, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x61,
+	0x70, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x52, 0x08, 0x6d, 0x6f, 0x64,
+	0x69, 0x66, 0x69, 0x65, 0x64, 0x22, 0x73, 0x0a, 0x0d, 0x4d, 0x61, 0x70, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x44, 0x65, 0x6c, 0x74, 0x61, 0x12, 0x16, 0x0a, 0x06, 0x69, 0x6e, 0x74, 0x4b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x69, 0x6e, 0x74, 0x4b, 0x65, 0x79, 0x12, 0x1c,
+	0x0a, 0x09, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x09, 0x73, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x4b, 0x65, 0x79, 0x12, 0x2c, 0x0a, 0x05,
+	0x64, 0x65, 0x6c, 0x74, 0x61, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x44, 0x65,
+	0x6c, 0x74, 0x61, 0x52, 0x05, 0x64, 0x65, 0x6c, 0x74, 0x61, 0x22, 0xa4, 0x01, 0x0a, 0x14, 0x43,
+	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4c, 0x6f, 0x67, 0x52, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x12, 0x1c, 0x0a, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49,
+	0x64, 0x12, 0x20, 0x0a, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x69, 0x6d, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x0b, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54,
+	0x69, 0x6d, 0x65, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x65, 0x6e, 0x64, 0x65, 0x72, 0x43, 0x6f, 0x6e,
+	0x6e, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x73, 0x65, 0x6e, 0x64, 0x65,
+	0x72, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x28, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e, 0x70,
 	0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x52, 0x04, 0x64, 0x61, 0x74,
-	0x61, 0x22, 0x2b, 0x0a, 0x11, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x4d,
-	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x22, 0x34,
-	0x0a, 0x08, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0c, 0x0a, 0x01, 0x78, 0x18,
-	0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x78, 0x12, 0x0c, 0x0a, 0x01, 0x79, 0x18, 0x02, 0x20,
-	0x01, 0x28, 0x01, 0x52, 0x01, 0x79, 0x12, 0x0c, 0x0a, 0x01, 0x7a, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x01, 0x52, 0x01, 0x7a, 0x22, 0x39, 0x0a, 0x11, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x45,
-	0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x12, 0x24, 0x0a, 0x03, 0x6c, 0x6f, 0x63,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c,
-	0x64, 0x2e, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x03, 0x6c, 0x6f, 0x63, 0x22,
-	0xc4, 0x01, 0x0a, 0x19, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x43, 0x68, 0x61, 0x6e, 0x6e,
-	0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x4d, 0x0a,
-	0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x31, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74, 0x69,
-	0x61, 0x6c, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x73,
-	0x73, 0x61, 0x67, 0x65, 0x2e, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45, 0x6e, 0x74,
-	0x72, 0x79, 0x52, 0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x1a, 0x58, 0x0a, 0x0d,
-	0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a,
-	0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12,
-	0x31, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b,
+	0x61, 0x22, 0x9f, 0x02, 0x0a, 0x0d, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x52, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x03, 0x52, 0x04, 0x74, 0x69, 0x6d, 0x65, 0x12, 0x3f, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63,
+	0x74, 0x69, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x21, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x61, 0x70, 0x74, 0x75, 0x72, 0x65, 0x52, 0x65, 0x63,
+	0x6f, 0x72, 0x64, 0x2e, 0x44, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x52, 0x09, 0x64,
+	0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e,
+	0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
+	0x12, 0x34, 0x0a, 0x08, 0x63, 0x6f, 0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0e, 0x32, 0x18, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x43, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x08, 0x63, 0x6f,
+	0x6e, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12, 0x29, 0x0a, 0x04, 0x70, 0x61, 0x63, 0x6b, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x50, 0x61, 0x63, 0x6b, 0x52, 0x04, 0x70, 0x61, 0x63,
+	0x6b, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x73, 0x67, 0x4e, 0x61, 0x6d, 0x65, 0x18, 0x06, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x6d, 0x73, 0x67, 0x4e, 0x61, 0x6d, 0x65, 0x22, 0x26, 0x0a, 0x09, 0x44,
+	0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x42, 0x4f,
+	0x55, 0x4e, 0x44, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x4f, 0x55, 0x54, 0x42, 0x4f, 0x55, 0x4e,
+	0x44, 0x10, 0x01, 0x22, 0x6f, 0x0a, 0x11, 0x44, 0x69, 0x73, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63,
+	0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e,
+	0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
+	0x12, 0x16, 0x0a, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x06, 0x72, 0x65, 0x61, 0x73, 0x6f, 0x6e, 0x12, 0x2a, 0x0a, 0x10, 0x72, 0x65, 0x63, 0x6f,
+	0x6e, 0x6e, 0x65, 0x63, 0x74, 0x41, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x10, 0x72, 0x65, 0x63, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x41, 0x64, 0x64,
+	0x72, 0x65, 0x73, 0x73, 0x22, 0x2b, 0x0a, 0x0b, 0x50, 0x69, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73,
+	0x61, 0x67, 0x65, 0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d,
+	0x70, 0x22, 0x2b, 0x0a, 0x0b, 0x50, 0x6f, 0x6e, 0x67, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x1c, 0x0a, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x09, 0x74, 0x69, 0x6d, 0x65, 0x73, 0x74, 0x61, 0x6d, 0x70, 0x22, 0xb5,
+	0x04, 0x0a, 0x12, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65,
+	0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x3a, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x26, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x45,
+	0x72, 0x72, 0x6f, 0x72, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x2e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x52, 0x04, 0x63, 0x6f, 0x64,
+	0x65, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x07, 0x6d, 0x73, 0x67, 0x54, 0x79, 0x70, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x73,
+	0x74, 0x75, 0x62, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x73, 0x74, 0x75,
+	0x62, 0x49, 0x64, 0x12, 0x18, 0x0a, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x6d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x22, 0x96, 0x03,
+	0x0a, 0x09, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55,
+	0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x1b, 0x0a, 0x17, 0x57, 0x52, 0x49, 0x54,
+	0x45, 0x5f, 0x50, 0x45, 0x52, 0x4d, 0x49, 0x53, 0x53, 0x49, 0x4f, 0x4e, 0x5f, 0x44, 0x45, 0x4e,
+	0x49, 0x45, 0x44, 0x10, 0x01, 0x12, 0x13, 0x0a, 0x0f, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44,
+	0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x10, 0x02, 0x12, 0x1a, 0x0a, 0x16, 0x55, 0x4e,
+	0x44, 0x45, 0x46, 0x49, 0x4e, 0x45, 0x44, 0x5f, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47, 0x45, 0x5f,
+	0x54, 0x59, 0x50, 0x45, 0x10, 0x03, 0x12, 0x17, 0x0a, 0x13, 0x4d, 0x45, 0x53, 0x53, 0x41, 0x47,
+	0x45, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x41, 0x4c, 0x4c, 0x4f, 0x57, 0x45, 0x44, 0x10, 0x04, 0x12,
+	0x11, 0x0a, 0x0d, 0x57, 0x52, 0x4f, 0x4e, 0x47, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c,
+	0x10, 0x05, 0x12, 0x15, 0x0a, 0x11, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x4e, 0x4f,
+	0x54, 0x5f, 0x46, 0x4f, 0x55, 0x4e, 0x44, 0x10, 0x06, 0x12, 0x18, 0x0a, 0x14, 0x43, 0x4f, 0x4e,
+	0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x46, 0x4f, 0x55, 0x4e,
+	0x44, 0x10, 0x07, 0x12, 0x10, 0x0a, 0x0c, 0x4e, 0x4f, 0x5f, 0x41, 0x55, 0x54, 0x48, 0x4f, 0x52,
+	0x49, 0x54, 0x59, 0x10, 0x08, 0x12, 0x18, 0x0a, 0x14, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44,
+	0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x54, 0x59, 0x50, 0x45, 0x10, 0x09, 0x12,
+	0x1a, 0x0a, 0x16, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x41, 0x4c, 0x52, 0x45, 0x41,
+	0x44, 0x59, 0x5f, 0x45, 0x58, 0x49, 0x53, 0x54, 0x53, 0x10, 0x0a, 0x12, 0x12, 0x0a, 0x0e, 0x4e,
+	0x4f, 0x54, 0x5f, 0x53, 0x55, 0x42, 0x53, 0x43, 0x52, 0x49, 0x42, 0x45, 0x44, 0x10, 0x0b, 0x12,
+	0x14, 0x0a, 0x10, 0x4e, 0x4f, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x4f, 0x57,
+	0x4e, 0x45, 0x52, 0x10, 0x0c, 0x12, 0x14, 0x0a, 0x10, 0x46, 0x45, 0x41, 0x54, 0x55, 0x52, 0x45,
+	0x5f, 0x44, 0x49, 0x53, 0x41, 0x42, 0x4c, 0x45, 0x44, 0x10, 0x0d, 0x12, 0x13, 0x0a, 0x0f, 0x52,
+	0x45, 0x51, 0x55, 0x45, 0x53, 0x54, 0x5f, 0x45, 0x58, 0x50, 0x49, 0x52, 0x45, 0x44, 0x10, 0x0e,
+	0x12, 0x20, 0x0a, 0x1c, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x44, 0x41, 0x54, 0x41,
+	0x5f, 0x4e, 0x4f, 0x54, 0x5f, 0x49, 0x4e, 0x49, 0x54, 0x49, 0x41, 0x4c, 0x49, 0x5a, 0x45, 0x44,
+	0x10, 0x0f, 0x12, 0x12, 0x0a, 0x0e, 0x49, 0x4e, 0x54, 0x45, 0x52, 0x4e, 0x41, 0x4c, 0x5f, 0x45,
+	0x52, 0x52, 0x4f, 0x52, 0x10, 0x10, 0x22, 0x34, 0x0a, 0x08, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x12, 0x0c, 0x0a, 0x01, 0x78, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x78,
+	0x12, 0x0c, 0x0a, 0x01, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x79, 0x12, 0x0c,
+	0x0a, 0x01, 0x7a, 0x18, 0x03, 0x20, 0x01, 0x28, 0x01, 0x52, 0x01, 0x7a, 0x22, 0x53, 0x0a, 0x11,
+	0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x6e, 0x66,
+	0x6f, 0x12, 0x24, 0x0a, 0x03, 0x6c, 0x6f, 0x63, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12,
+	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69,
+	0x6f, 0x6e, 0x52, 0x03, 0x6c, 0x6f, 0x63, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76,
+	0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65,
+	0x64, 0x22, 0xc4, 0x01, 0x0a, 0x19, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x43, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12,
+	0x4d, 0x0a, 0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x31, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61,
+	0x74, 0x69, 0x61, 0x6c, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x44, 0x61, 0x74, 0x61, 0x4d,
+	0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x1a, 0x58,
+	0x0a, 0x0d, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x69, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12,
+	0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65,
+	0x79, 0x12, 0x31, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x1b, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74,
+	0x69, 0x61, 0x6c, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0xeb, 0x03, 0x0a, 0x13, 0x53, 0x70, 0x61,
+	0x74, 0x69, 0x61, 0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x73, 0x74, 0x41, 0x72, 0x65, 0x61,
+	0x12, 0x3e, 0x0a, 0x06, 0x73, 0x70, 0x68, 0x65, 0x72, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x24, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74,
+	0x69, 0x61, 0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x73, 0x74, 0x41, 0x72, 0x65, 0x61, 0x2e,
+	0x53, 0x70, 0x68, 0x65, 0x72, 0x65, 0x48, 0x00, 0x52, 0x06, 0x73, 0x70, 0x68, 0x65, 0x72, 0x65,
+	0x12, 0x38, 0x0a, 0x04, 0x63, 0x6f, 0x6e, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22,
 	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61,
-	0x6c, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x05, 0x76, 0x61, 0x6c,
-	0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x2a, 0x55, 0x0a, 0x0d, 0x42, 0x72, 0x6f, 0x61, 0x64, 0x63,
-	0x61, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x10, 0x0a, 0x0c, 0x4e, 0x4f, 0x5f, 0x42, 0x52,
-	0x4f, 0x41, 0x44, 0x43, 0x41, 0x53, 0x54, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x4c, 0x4c,
-	0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x41, 0x4c, 0x4c, 0x5f, 0x42, 0x55, 0x54, 0x5f, 0x53, 0x45,
-	0x4e, 0x44, 0x45, 0x52, 0x10, 0x02, 0x12, 0x15, 0x0a, 0x11, 0x53, 0x49, 0x4e, 0x47, 0x4c, 0x45,
-	0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x10, 0x03, 0x2a, 0x3b, 0x0a,
-	0x0e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65, 0x12,
-	0x11, 0x0a, 0x0d, 0x4e, 0x4f, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e,
-	0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x10, 0x01, 0x12, 0x0a,
-	0x0a, 0x06, 0x43, 0x4c, 0x49, 0x45, 0x4e, 0x54, 0x10, 0x02, 0x2a, 0x84, 0x01, 0x0a, 0x0b, 0x43,
-	0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x4e,
-	0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x47, 0x4c, 0x4f, 0x42, 0x41,
-	0x4c, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54, 0x45, 0x10, 0x02,
-	0x12, 0x0c, 0x0a, 0x08, 0x53, 0x55, 0x42, 0x57, 0x4f, 0x52, 0x4c, 0x44, 0x10, 0x03, 0x12, 0x0b,
-	0x0a, 0x07, 0x53, 0x50, 0x41, 0x54, 0x49, 0x41, 0x4c, 0x10, 0x04, 0x12, 0x08, 0x0a, 0x04, 0x54,
-	0x45, 0x53, 0x54, 0x10, 0x64, 0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53, 0x54, 0x31, 0x10, 0x65,
-	0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53, 0x54, 0x32, 0x10, 0x66, 0x12, 0x09, 0x0a, 0x05, 0x54,
-	0x45, 0x53, 0x54, 0x33, 0x10, 0x67, 0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53, 0x54, 0x34, 0x10,
-	0x68, 0x2a, 0xc9, 0x01, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x54, 0x79, 0x70,
-	0x65, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x10, 0x00, 0x12, 0x08,
-	0x0a, 0x04, 0x41, 0x55, 0x54, 0x48, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x43, 0x52, 0x45, 0x41,
-	0x54, 0x45, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x03, 0x12, 0x12, 0x0a, 0x0e,
-	0x52, 0x45, 0x4d, 0x4f, 0x56, 0x45, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x04,
-	0x12, 0x10, 0x0a, 0x0c, 0x4c, 0x49, 0x53, 0x54, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c,
-	0x10, 0x05, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x55, 0x42, 0x5f, 0x54, 0x4f, 0x5f, 0x43, 0x48, 0x41,
-	0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x06, 0x12, 0x16, 0x0a, 0x12, 0x55, 0x4e, 0x53, 0x55, 0x42, 0x5f,
-	0x46, 0x52, 0x4f, 0x4d, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x07, 0x12, 0x17,
-	0x0a, 0x13, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x44, 0x41, 0x54, 0x41, 0x5f, 0x55,
-	0x50, 0x44, 0x41, 0x54, 0x45, 0x10, 0x08, 0x12, 0x0e, 0x0a, 0x0a, 0x44, 0x49, 0x53, 0x43, 0x4f,
-	0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x09, 0x12, 0x14, 0x0a, 0x10, 0x55, 0x53, 0x45, 0x52, 0x5f,
-	0x53, 0x50, 0x41, 0x43, 0x45, 0x5f, 0x53, 0x54, 0x41, 0x52, 0x54, 0x10, 0x64, 0x2a, 0x31, 0x0a,
-	0x0f, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x79, 0x70, 0x65,
-	0x12, 0x12, 0x0a, 0x0e, 0x4e, 0x4f, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45, 0x53, 0x53, 0x49,
-	0x4f, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x4e, 0x41, 0x50, 0x50, 0x59, 0x10, 0x01,
-	0x42, 0x08, 0x5a, 0x06, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74,
-	0x6f, 0x33,
+	0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x73, 0x74, 0x41, 0x72, 0x65, 0x61, 0x2e, 0x43, 0x6f,
+	0x6e, 0x65, 0x48, 0x00, 0x52, 0x04, 0x63, 0x6f, 0x6e, 0x65, 0x12, 0x3e, 0x0a, 0x06, 0x62, 0x6f,
+	0x72, 0x64, 0x65, 0x72, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x63, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x49, 0x6e, 0x74,
+	0x65, 0x72, 0x65, 0x73, 0x74, 0x41, 0x72, 0x65, 0x61, 0x2e, 0x42, 0x6f, 0x72, 0x64, 0x65, 0x72,
+	0x48, 0x00, 0x52, 0x06, 0x62, 0x6f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x32, 0x0a, 0x14, 0x6e, 0x65,
+	0x61, 0x72, 0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c,
+	0x4d, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x14, 0x6e, 0x65, 0x61, 0x72, 0x46, 0x61,
+	0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73, 0x12, 0x30,
+	0x0a, 0x13, 0x66, 0x61, 0x72, 0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72,
+	0x76, 0x61, 0x6c, 0x4d, 0x73, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x13, 0x66, 0x61, 0x72,
+	0x46, 0x61, 0x6e, 0x4f, 0x75, 0x74, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x4d, 0x73,
+	0x1a, 0x20, 0x0a, 0x06, 0x53, 0x70, 0x68, 0x65, 0x72, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x61,
+	0x64, 0x69, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x01, 0x52, 0x06, 0x72, 0x61, 0x64, 0x69,
+	0x75, 0x73, 0x1a, 0x66, 0x0a, 0x04, 0x43, 0x6f, 0x6e, 0x65, 0x12, 0x30, 0x0a, 0x09, 0x64, 0x69,
+	0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x4c, 0x6f, 0x63, 0x61, 0x74, 0x69, 0x6f,
+	0x6e, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14, 0x0a, 0x05,
+	0x61, 0x6e, 0x67, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x61, 0x6e, 0x67,
+	0x6c, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x72, 0x61, 0x64, 0x69, 0x75, 0x73, 0x18, 0x03, 0x20, 0x01,
+	0x28, 0x01, 0x52, 0x06, 0x72, 0x61, 0x64, 0x69, 0x75, 0x73, 0x1a, 0x22, 0x0a, 0x06, 0x42, 0x6f,
+	0x72, 0x64, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x65, 0x6c, 0x6c, 0x4e, 0x75, 0x6d, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x63, 0x65, 0x6c, 0x6c, 0x4e, 0x75, 0x6d, 0x42, 0x06,
+	0x0a, 0x04, 0x61, 0x72, 0x65, 0x61, 0x22, 0xa3, 0x01, 0x0a, 0x16, 0x53, 0x70, 0x61, 0x74, 0x69,
+	0x61, 0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x73, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x06, 0x63, 0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x49, 0x64, 0x12, 0x31, 0x0a, 0x04, 0x61, 0x72, 0x65, 0x61, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53,
+	0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x65, 0x73, 0x74, 0x41, 0x72,
+	0x65, 0x61, 0x52, 0x04, 0x61, 0x72, 0x65, 0x61, 0x12, 0x22, 0x0a, 0x0c, 0x66, 0x6f, 0x6c, 0x6c,
+	0x6f, 0x77, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c,
+	0x66, 0x6f, 0x6c, 0x6c, 0x6f, 0x77, 0x45, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x22, 0x99, 0x02, 0x0a,
+	0x16, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x76, 0x65, 0x72, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x68, 0x61, 0x6e, 0x64, 0x6f,
+	0x76, 0x65, 0x72, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x68, 0x61, 0x6e,
+	0x64, 0x6f, 0x76, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x65, 0x6e, 0x74, 0x69, 0x74,
+	0x79, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x65, 0x6e, 0x74, 0x69, 0x74,
+	0x79, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x72, 0x63, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65,
+	0x6c, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x73, 0x72, 0x63, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x64, 0x73, 0x74, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x64,
+	0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x33, 0x0a, 0x06, 0x65,
+	0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x53, 0x70, 0x61, 0x74, 0x69, 0x61, 0x6c, 0x45, 0x6e,
+	0x74, 0x69, 0x74, 0x79, 0x49, 0x6e, 0x66, 0x6f, 0x52, 0x06, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79,
+	0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x6e, 0x49, 0x64,
+	0x18, 0x06, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f,
+	0x6e, 0x6e, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x77, 0x68, 0x6f, 0x6c, 0x65, 0x43, 0x68, 0x61,
+	0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x07, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x77, 0x68, 0x6f, 0x6c,
+	0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x22, 0x5a, 0x0a, 0x1c, 0x48, 0x61, 0x6e, 0x64,
+	0x6f, 0x76, 0x65, 0x72, 0x50, 0x72, 0x65, 0x70, 0x61, 0x72, 0x65, 0x52, 0x65, 0x73, 0x75, 0x6c,
+	0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x68, 0x61, 0x6e, 0x64,
+	0x6f, 0x76, 0x65, 0x72, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x68, 0x61,
+	0x6e, 0x64, 0x6f, 0x76, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x63, 0x63, 0x65,
+	0x70, 0x74, 0x65, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x08, 0x61, 0x63, 0x63, 0x65,
+	0x70, 0x74, 0x65, 0x64, 0x22, 0xe2, 0x01, 0x0a, 0x14, 0x48, 0x61, 0x6e, 0x64, 0x6f, 0x76, 0x65,
+	0x72, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x12, 0x1e, 0x0a,
+	0x0a, 0x68, 0x61, 0x6e, 0x64, 0x6f, 0x76, 0x65, 0x72, 0x49, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x0a, 0x68, 0x61, 0x6e, 0x64, 0x6f, 0x76, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1a, 0x0a,
+	0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x08, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x73, 0x72, 0x63,
+	0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0c, 0x73, 0x72, 0x63, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x12, 0x22, 0x0a,
+	0x0c, 0x64, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49, 0x64, 0x18, 0x04, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0c, 0x64, 0x73, 0x74, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x49,
+	0x64, 0x12, 0x22, 0x0a, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43, 0x6f, 0x6e, 0x6e, 0x49,
+	0x64, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x43,
+	0x6f, 0x6e, 0x6e, 0x49, 0x64, 0x12, 0x22, 0x0a, 0x0c, 0x77, 0x68, 0x6f, 0x6c, 0x65, 0x43, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x77, 0x68, 0x6f,
+	0x6c, 0x65, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x2a, 0x55, 0x0a, 0x0d, 0x42, 0x72, 0x6f,
+	0x61, 0x64, 0x63, 0x61, 0x73, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x10, 0x0a, 0x0c, 0x4e, 0x4f,
+	0x5f, 0x42, 0x52, 0x4f, 0x41, 0x44, 0x43, 0x41, 0x53, 0x54, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03,
+	0x41, 0x4c, 0x4c, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x41, 0x4c, 0x4c, 0x5f, 0x42, 0x55, 0x54,
+	0x5f, 0x53, 0x45, 0x4e, 0x44, 0x45, 0x52, 0x10, 0x02, 0x12, 0x15, 0x0a, 0x11, 0x53, 0x49, 0x4e,
+	0x47, 0x4c, 0x45, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x49, 0x4f, 0x4e, 0x10, 0x03,
+	0x2a, 0x3b, 0x0a, 0x0e, 0x43, 0x6f, 0x6e, 0x6e, 0x65, 0x63, 0x74, 0x69, 0x6f, 0x6e, 0x54, 0x79,
+	0x70, 0x65, 0x12, 0x11, 0x0a, 0x0d, 0x4e, 0x4f, 0x5f, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54,
+	0x49, 0x4f, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x45, 0x52, 0x56, 0x45, 0x52, 0x10,
+	0x01, 0x12, 0x0a, 0x0a, 0x06, 0x43, 0x4c, 0x49, 0x45, 0x4e, 0x54, 0x10, 0x02, 0x2a, 0x84, 0x01,
+	0x0a, 0x0b, 0x43, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a,
+	0x07, 0x55, 0x4e, 0x4b, 0x4e, 0x4f, 0x57, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x47, 0x4c,
+	0x4f, 0x42, 0x41, 0x4c, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x50, 0x52, 0x49, 0x56, 0x41, 0x54,
+	0x45, 0x10, 0x02, 0x12, 0x0c, 0x0a, 0x08, 0x53, 0x55, 0x42, 0x57, 0x4f, 0x52, 0x4c, 0x44, 0x10,
+	0x03, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x50, 0x41, 0x54, 0x49, 0x41, 0x4c, 0x10, 0x04, 0x12, 0x08,
+	0x0a, 0x04, 0x54, 0x45, 0x53, 0x54, 0x10, 0x64, 0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53, 0x54,
+	0x31, 0x10, 0x65, 0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53, 0x54, 0x32, 0x10, 0x66, 0x12, 0x09,
+	0x0a, 0x05, 0x54, 0x45, 0x53, 0x54, 0x33, 0x10, 0x67, 0x12, 0x09, 0x0a, 0x05, 0x54, 0x45, 0x53,
+	0x54, 0x34, 0x10, 0x68, 0x2a, 0xf9, 0x02, 0x0a, 0x0b, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x54, 0x79, 0x70, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x49, 0x4e, 0x56, 0x41, 0x4c, 0x49, 0x44, 0x10,
+	0x00, 0x12, 0x08, 0x0a, 0x04, 0x41, 0x55, 0x54, 0x48, 0x10, 0x01, 0x12, 0x12, 0x0a, 0x0e, 0x43,
+	0x52, 0x45, 0x41, 0x54, 0x45, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x03, 0x12,
+	0x12, 0x0a, 0x0e, 0x52, 0x45, 0x4d, 0x4f, 0x56, 0x45, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45,
+	0x4c, 0x10, 0x04, 0x12, 0x10, 0x0a, 0x0c, 0x4c, 0x49, 0x53, 0x54, 0x5f, 0x43, 0x48, 0x41, 0x4e,
+	0x4e, 0x45, 0x4c, 0x10, 0x05, 0x12, 0x12, 0x0a, 0x0e, 0x53, 0x55, 0x42, 0x5f, 0x54, 0x4f, 0x5f,
+	0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10, 0x06, 0x12, 0x16, 0x0a, 0x12, 0x55, 0x4e, 0x53,
+	0x55, 0x42, 0x5f, 0x46, 0x52, 0x4f, 0x4d, 0x5f, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x10,
+	0x07, 0x12, 0x17, 0x0a, 0x13, 0x43, 0x48, 0x41, 0x4e, 0x4e, 0x45, 0x4c, 0x5f, 0x44, 0x41, 0x54,
+	0x41, 0x5f, 0x55, 0x50, 0x44, 0x41, 0x54, 0x45, 0x10, 0x08, 0x12, 0x0e, 0x0a, 0x0a, 0x44, 0x49,
+	0x53, 0x43, 0x4f, 0x4e, 0x4e, 0x45, 0x43, 0x54, 0x10, 0x09, 0x12, 0x13, 0x0a, 0x0f, 0x41, 0x55,
+	0x54, 0x48, 0x5f, 0x44, 0x45, 0x4c, 0x45, 0x47, 0x41, 0x54, 0x49, 0x4f, 0x4e, 0x10, 0x0a, 0x12,
+	0x0a, 0x0a, 0x06, 0x52, 0x45, 0x53, 0x55, 0x4d, 0x45, 0x10, 0x0b, 0x12, 0x08, 0x0a, 0x04, 0x50,
+	0x49, 0x4e, 0x47, 0x10, 0x0c, 0x12, 0x08, 0x0a, 0x04, 0x50, 0x4f, 0x4e, 0x47, 0x10, 0x0d, 0x12,
+	0x16, 0x0a, 0x12, 0x54, 0x52, 0x41, 0x4e, 0x53, 0x46, 0x45, 0x52, 0x5f, 0x4f, 0x57, 0x4e, 0x45,
+	0x52, 0x53, 0x48, 0x49, 0x50, 0x10, 0x0e, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x52, 0x52, 0x4f, 0x52,
+	0x10, 0x0f, 0x12, 0x14, 0x0a, 0x10, 0x53, 0x50, 0x41, 0x54, 0x49, 0x41, 0x4c, 0x5f, 0x49, 0x4e,
+	0x54, 0x45, 0x52, 0x45, 0x53, 0x54, 0x10, 0x10, 0x12, 0x14, 0x0a, 0x10, 0x48, 0x41, 0x4e, 0x44,
+	0x4f, 0x56, 0x45, 0x52, 0x5f, 0x50, 0x52, 0x45, 0x50, 0x41, 0x52, 0x45, 0x10, 0x14, 0x12, 0x13,
+	0x0a, 0x0f, 0x48, 0x41, 0x4e, 0x44, 0x4f, 0x56, 0x45, 0x52, 0x5f, 0x43, 0x4f, 0x4d, 0x4d, 0x49,
+	0x54, 0x10, 0x15, 0x12, 0x15, 0x0a, 0x11, 0x48, 0x41, 0x4e, 0x44, 0x4f, 0x56, 0x45, 0x52, 0x5f,
+	0x52, 0x4f, 0x4c, 0x4c, 0x42, 0x41, 0x43, 0x4b, 0x10, 0x16, 0x12, 0x14, 0x0a, 0x10, 0x55, 0x53,
+	0x45, 0x52, 0x5f, 0x53, 0x50, 0x41, 0x43, 0x45, 0x5f, 0x53, 0x54, 0x41, 0x52, 0x54, 0x10, 0x64,
+	0x2a, 0x31, 0x0a, 0x0f, 0x43, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x12, 0x0a, 0x0e, 0x4e, 0x4f, 0x5f, 0x43, 0x4f, 0x4d, 0x50, 0x52, 0x45,
+	0x53, 0x53, 0x49, 0x4f, 0x4e, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x4e, 0x41, 0x50, 0x50,
+	0x59, 0x10, 0x01, 0x42, 0x08, 0x5a, 0x06, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -1919,8 +4114,8 @@ func file_channeld_proto_rawDescGZIP() []byte {
 	return file_channeld_proto_rawDescData
 }
 
-var file_channeld_proto_enumTypes = make([]protoimpl.EnumInfo, 6)
-var file_channeld_proto_msgTypes = make([]protoimpl.MessageInfo, 23)
+var file_channeld_proto_enumTypes = make([]protoimpl.EnumInfo, 8)
+var file_channeld_proto_msgTypes = make([]protoimpl.MessageInfo, 50)
 var file_channeld_proto_goTypes = []interface{}{
 	(BroadcastType)(0),                           // 0: channeld.BroadcastType
 	(ConnectionType)(0),                          // 1: channeld.ConnectionType
@@ -1928,59 +4123,113 @@ var file_channeld_proto_goTypes = []interface{}{
 	(MessageType)(0),                             // 3: channeld.MessageType
 	(CompressionType)(0),                         // 4: channeld.CompressionType
 	(AuthResultMessage_AuthResult)(0),            // 5: channeld.AuthResultMessage.AuthResult
-	(*Packet)(nil),                               // 6: channeld.Packet
-	(*MessagePack)(nil),                          // 7: channeld.MessagePack
-	(*ServerForwardMessage)(nil),                 // 8: channeld.ServerForwardMessage
-	(*AuthMessage)(nil),                          // 9: channeld.AuthMessage
-	(*AuthResultMessage)(nil),                    // 10: channeld.AuthResultMessage
-	(*ChannelSubscriptionOptions)(nil),           // 11: channeld.ChannelSubscriptionOptions
-	(*ChannelDataMergeOptions)(nil),              // 12: channeld.ChannelDataMergeOptions
-	(*CreateChannelMessage)(nil),                 // 13: channeld.CreateChannelMessage
-	(*CreateChannelResultMessage)(nil),           // 14: channeld.CreateChannelResultMessage
-	(*RemoveChannelMessage)(nil),                 // 15: channeld.RemoveChannelMessage
-	(*ListChannelMessage)(nil),                   // 16: channeld.ListChannelMessage
-	(*ListChannelResultMessage)(nil),             // 17: channeld.ListChannelResultMessage
-	(*SubscribedToChannelMessage)(nil),           // 18: channeld.SubscribedToChannelMessage
-	(*SubscribedToChannelResultMessage)(nil),     // 19: channeld.SubscribedToChannelResultMessage
-	(*UnsubscribedFromChannelMessage)(nil),       // 20: channeld.UnsubscribedFromChannelMessage
-	(*UnsubscribedFromChannelResultMessage)(nil), // 21: channeld.UnsubscribedFromChannelResultMessage
-	(*ChannelDataUpdateMessage)(nil),             // 22: channeld.ChannelDataUpdateMessage
-	(*DisconnectMessage)(nil),                    // 23: channeld.DisconnectMessage
-	(*Location)(nil),                             // 24: channeld.Location
-	(*SpatialEntityInfo)(nil),                    // 25: channeld.SpatialEntityInfo
-	(*SpatialChannelDataMessage)(nil),            // 26: channeld.SpatialChannelDataMessage
-	(*ListChannelResultMessage_ChannelInfo)(nil), // 27: channeld.ListChannelResultMessage.ChannelInfo
-	nil,               // 28: channeld.SpatialChannelDataMessage.EntitiesEntry
-	(*anypb.Any)(nil), // 29: google.protobuf.Any
+	(CaptureRecord_Direction)(0),                 // 6: channeld.CaptureRecord.Direction
+	(ErrorResultMessage_ErrorCode)(0),            // 7: channeld.ErrorResultMessage.ErrorCode
+	(*Packet)(nil),                               // 8: channeld.Packet
+	(*MessagePack)(nil),                          // 9: channeld.MessagePack
+	(*ServerForwardMessage)(nil),                 // 10: channeld.ServerForwardMessage
+	(*AuthMessage)(nil),                          // 11: channeld.AuthMessage
+	(*AuthResultMessage)(nil),                    // 12: channeld.AuthResultMessage
+	(*ResumeMessage)(nil),                        // 13: channeld.ResumeMessage
+	(*ResumeResultMessage)(nil),                  // 14: channeld.ResumeResultMessage
+	(*AuthDelegationMessage)(nil),                // 15: channeld.AuthDelegationMessage
+	(*AuthDelegationResultMessage)(nil),          // 16: channeld.AuthDelegationResultMessage
+	(*ChannelSubscriptionOptions)(nil),           // 17: channeld.ChannelSubscriptionOptions
+	(*ChannelDataMergeOptions)(nil),              // 18: channeld.ChannelDataMergeOptions
+	(*CreateChannelMessage)(nil),                 // 19: channeld.CreateChannelMessage
+	(*CreateChannelResultMessage)(nil),           // 20: channeld.CreateChannelResultMessage
+	(*RemoveChannelMessage)(nil),                 // 21: channeld.RemoveChannelMessage
+	(*ListChannelMessage)(nil),                   // 22: channeld.ListChannelMessage
+	(*ListChannelResultMessage)(nil),             // 23: channeld.ListChannelResultMessage
+	(*SubscribedToChannelMessage)(nil),           // 24: channeld.SubscribedToChannelMessage
+	(*SubscribedToChannelResultMessage)(nil),     // 25: channeld.SubscribedToChannelResultMessage
+	(*UnsubscribedFromChannelMessage)(nil),       // 26: channeld.UnsubscribedFromChannelMessage
+	(*UnsubscribedFromChannelResultMessage)(nil), // 27: channeld.UnsubscribedFromChannelResultMessage
+	(*TransferOwnershipMessage)(nil),             // 28: channeld.TransferOwnershipMessage
+	(*OwnershipChangedMessage)(nil),              // 29: channeld.OwnershipChangedMessage
+	(*ChannelDataUpdateMessage)(nil),             // 30: channeld.ChannelDataUpdateMessage
+	(*MessageDelta)(nil),                         // 31: channeld.MessageDelta
+	(*ListDelta)(nil),                            // 32: channeld.ListDelta
+	(*MapDelta)(nil),                             // 33: channeld.MapDelta
+	(*MapEntryDelta)(nil),                        // 34: channeld.MapEntryDelta
+	(*ChannelDataLogRecord)(nil),                 // 35: channeld.ChannelDataLogRecord
+	(*CaptureRecord)(nil),                        // 36: channeld.CaptureRecord
+	(*DisconnectMessage)(nil),                    // 37: channeld.DisconnectMessage
+	(*PingMessage)(nil),                          // 38: channeld.PingMessage
+	(*PongMessage)(nil),                          // 39: channeld.PongMessage
+	(*ErrorResultMessage)(nil),                   // 40: channeld.ErrorResultMessage
+	(*Location)(nil),                             // 41: channeld.Location
+	(*SpatialEntityInfo)(nil),                    // 42: channeld.SpatialEntityInfo
+	(*SpatialChannelDataMessage)(nil),            // 43: channeld.SpatialChannelDataMessage
+	(*SpatialInterestArea)(nil),                  // 44: channeld.SpatialInterestArea
+	(*SpatialInterestMessage)(nil),               // 45: channeld.SpatialInterestMessage
+	(*HandoverPrepareMessage)(nil),               // 46: channeld.HandoverPrepareMessage
+	(*HandoverPrepareResultMessage)(nil),         // 47: channeld.HandoverPrepareResultMessage
+	(*HandoverEventMessage)(nil),                 // 48: channeld.HandoverEventMessage
+	(*ListChannelResultMessage_ChannelInfo)(nil), // 49: channeld.ListChannelResultMessage.ChannelInfo
+	nil,                                // 50: channeld.MessageDelta.ModifiedFieldsEntry
+	nil,                                // 51: channeld.MessageDelta.ListsEntry
+	nil,                                // 52: channeld.MessageDelta.MapsEntry
+	nil,                                // 53: channeld.ListDelta.ModifiedEntry
+	nil,                                // 54: channeld.SpatialChannelDataMessage.EntitiesEntry
+	(*SpatialInterestArea_Sphere)(nil), // 55: channeld.SpatialInterestArea.Sphere
+	(*SpatialInterestArea_Cone)(nil),   // 56: channeld.SpatialInterestArea.Cone
+	(*SpatialInterestArea_Border)(nil), // 57: channeld.SpatialInterestArea.Border
+	(*anypb.Any)(nil),                  // 58: google.protobuf.Any
 }
 var file_channeld_proto_depIdxs = []int32{
-	7,  // 0: channeld.Packet.messages:type_name -> channeld.MessagePack
+	9,  // 0: channeld.Packet.messages:type_name -> channeld.MessagePack
 	0,  // 1: channeld.MessagePack.broadcast:type_name -> channeld.BroadcastType
 	5,  // 2: channeld.AuthResultMessage.result:type_name -> channeld.AuthResultMessage.AuthResult
 	4,  // 3: channeld.AuthResultMessage.compressionType:type_name -> channeld.CompressionType
-	2,  // 4: channeld.CreateChannelMessage.channelType:type_name -> channeld.ChannelType
-	11, // 5: channeld.CreateChannelMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
-	29, // 6: channeld.CreateChannelMessage.data:type_name -> google.protobuf.Any
-	12, // 7: channeld.CreateChannelMessage.mergeOptions:type_name -> channeld.ChannelDataMergeOptions
-	2,  // 8: channeld.CreateChannelResultMessage.channelType:type_name -> channeld.ChannelType
-	2,  // 9: channeld.ListChannelMessage.typeFilter:type_name -> channeld.ChannelType
-	27, // 10: channeld.ListChannelResultMessage.channels:type_name -> channeld.ListChannelResultMessage.ChannelInfo
-	11, // 11: channeld.SubscribedToChannelMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
-	11, // 12: channeld.SubscribedToChannelResultMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
-	1,  // 13: channeld.SubscribedToChannelResultMessage.connType:type_name -> channeld.ConnectionType
-	2,  // 14: channeld.SubscribedToChannelResultMessage.channelType:type_name -> channeld.ChannelType
-	1,  // 15: channeld.UnsubscribedFromChannelResultMessage.connType:type_name -> channeld.ConnectionType
-	2,  // 16: channeld.UnsubscribedFromChannelResultMessage.channelType:type_name -> channeld.ChannelType
-	29, // 17: channeld.ChannelDataUpdateMessage.data:type_name -> google.protobuf.Any
-	24, // 18: channeld.SpatialEntityInfo.loc:type_name -> channeld.Location
-	28, // 19: channeld.SpatialChannelDataMessage.entities:type_name -> channeld.SpatialChannelDataMessage.EntitiesEntry
-	2,  // 20: channeld.ListChannelResultMessage.ChannelInfo.channelType:type_name -> channeld.ChannelType
-	25, // 21: channeld.SpatialChannelDataMessage.EntitiesEntry.value:type_name -> channeld.SpatialEntityInfo
-	22, // [22:22] is the sub-list for method output_type
-	22, // [22:22] is the sub-list for method input_type
-	22, // [22:22] is the sub-list for extension type_name
-	22, // [22:22] is the sub-list for extension extendee
-	0,  // [0:22] is the sub-list for field type_name
+	4,  // 4: channeld.ResumeResultMessage.compressionType:type_name -> channeld.CompressionType
+	5,  // 5: channeld.AuthDelegationResultMessage.result:type_name -> channeld.AuthResultMessage.AuthResult
+	2,  // 6: channeld.CreateChannelMessage.channelType:type_name -> channeld.ChannelType
+	17, // 7: channeld.CreateChannelMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
+	58, // 8: channeld.CreateChannelMessage.data:type_name -> google.protobuf.Any
+	18, // 9: channeld.CreateChannelMessage.mergeOptions:type_name -> channeld.ChannelDataMergeOptions
+	2,  // 10: channeld.CreateChannelResultMessage.channelType:type_name -> channeld.ChannelType
+	2,  // 11: channeld.ListChannelMessage.typeFilter:type_name -> channeld.ChannelType
+	49, // 12: channeld.ListChannelResultMessage.channels:type_name -> channeld.ListChannelResultMessage.ChannelInfo
+	17, // 13: channeld.SubscribedToChannelMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
+	17, // 14: channeld.SubscribedToChannelResultMessage.subOptions:type_name -> channeld.ChannelSubscriptionOptions
+	1,  // 15: channeld.SubscribedToChannelResultMessage.connType:type_name -> channeld.ConnectionType
+	2,  // 16: channeld.SubscribedToChannelResultMessage.channelType:type_name -> channeld.ChannelType
+	1,  // 17: channeld.UnsubscribedFromChannelResultMessage.connType:type_name -> channeld.ConnectionType
+	2,  // 18: channeld.UnsubscribedFromChannelResultMessage.channelType:type_name -> channeld.ChannelType
+	2,  // 19: channeld.OwnershipChangedMessage.channelType:type_name -> channeld.ChannelType
+	58, // 20: channeld.ChannelDataUpdateMessage.data:type_name -> google.protobuf.Any
+	31, // 21: channeld.ChannelDataUpdateMessage.delta:type_name -> channeld.MessageDelta
+	50, // 22: channeld.MessageDelta.modifiedFields:type_name -> channeld.MessageDelta.ModifiedFieldsEntry
+	51, // 23: channeld.MessageDelta.lists:type_name -> channeld.MessageDelta.ListsEntry
+	52, // 24: channeld.MessageDelta.maps:type_name -> channeld.MessageDelta.MapsEntry
+	53, // 25: channeld.ListDelta.modified:type_name -> channeld.ListDelta.ModifiedEntry
+	34, // 26: channeld.MapDelta.modified:type_name -> channeld.MapEntryDelta
+	31, // 27: channeld.MapEntryDelta.delta:type_name -> channeld.MessageDelta
+	58, // 28: channeld.ChannelDataLogRecord.data:type_name -> google.protobuf.Any
+	6,  // 29: channeld.CaptureRecord.direction:type_name -> channeld.CaptureRecord.Direction
+	1,  // 30: channeld.CaptureRecord.connType:type_name -> channeld.ConnectionType
+	9,  // 31: channeld.CaptureRecord.pack:type_name -> channeld.MessagePack
+	7,  // 32: channeld.ErrorResultMessage.code:type_name -> channeld.ErrorResultMessage.ErrorCode
+	41, // 33: channeld.SpatialEntityInfo.loc:type_name -> channeld.Location
+	54, // 34: channeld.SpatialChannelDataMessage.entities:type_name -> channeld.SpatialChannelDataMessage.EntitiesEntry
+	55, // 35: channeld.SpatialInterestArea.sphere:type_name -> channeld.SpatialInterestArea.Sphere
+	56, // 36: channeld.SpatialInterestArea.cone:type_name -> channeld.SpatialInterestArea.Cone
+	57, // 37: channeld.SpatialInterestArea.border:type_name -> channeld.SpatialInterestArea.Border
+	44, // 38: channeld.SpatialInterestMessage.area:type_name -> channeld.SpatialInterestArea
+	42, // 39: channeld.HandoverPrepareMessage.entity:type_name -> channeld.SpatialEntityInfo
+	2,  // 40: channeld.ListChannelResultMessage.ChannelInfo.channelType:type_name -> channeld.ChannelType
+	31, // 41: channeld.MessageDelta.ModifiedFieldsEntry.value:type_name -> channeld.MessageDelta
+	32, // 42: channeld.MessageDelta.ListsEntry.value:type_name -> channeld.ListDelta
+	33, // 43: channeld.MessageDelta.MapsEntry.value:type_name -> channeld.MapDelta
+	31, // 44: channeld.ListDelta.ModifiedEntry.value:type_name -> channeld.MessageDelta
+	42, // 45: channeld.SpatialChannelDataMessage.EntitiesEntry.value:type_name -> channeld.SpatialEntityInfo
+	41, // 46: channeld.SpatialInterestArea.Cone.direction:type_name -> channeld.Location
+	47, // [47:47] is the sub-list for method output_type
+	47, // [47:47] is the sub-list for method input_type
+	47, // [47:47] is the sub-list for extension type_name
+	47, // [47:47] is the sub-list for extension extendee
+	0,  // [0:47] is the sub-list for field type_name
 }
 
 func init() { file_channeld_proto_init() }
@@ -2001,8 +4250,44 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*MessagePack); i {
+		file_channeld_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MessagePack); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ServerForwardMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AuthMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AuthResultMessage); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2013,8 +4298,8 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ServerForwardMessage); i {
+		file_channeld_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResumeMessage); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2025,8 +4310,8 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AuthMessage); i {
+		file_channeld_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ResumeResultMessage); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2037,8 +4322,8 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AuthResultMessage); i {
+		file_channeld_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AuthDelegationMessage); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -2049,7 +4334,19 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*AuthDelegationResultMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ChannelSubscriptionOptions); i {
 			case 0:
 				return &v.state
@@ -2061,7 +4358,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ChannelDataMergeOptions); i {
 			case 0:
 				return &v.state
@@ -2073,7 +4370,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*CreateChannelMessage); i {
 			case 0:
 				return &v.state
@@ -2085,7 +4382,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*CreateChannelResultMessage); i {
 			case 0:
 				return &v.state
@@ -2097,7 +4394,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*RemoveChannelMessage); i {
 			case 0:
 				return &v.state
@@ -2109,7 +4406,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ListChannelMessage); i {
 			case 0:
 				return &v.state
@@ -2121,7 +4418,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ListChannelResultMessage); i {
 			case 0:
 				return &v.state
@@ -2133,7 +4430,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SubscribedToChannelMessage); i {
 			case 0:
 				return &v.state
@@ -2145,7 +4442,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SubscribedToChannelResultMessage); i {
 			case 0:
 				return &v.state
@@ -2157,7 +4454,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*UnsubscribedFromChannelMessage); i {
 			case 0:
 				return &v.state
@@ -2169,7 +4466,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*UnsubscribedFromChannelResultMessage); i {
 			case 0:
 				return &v.state
@@ -2181,7 +4478,31 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TransferOwnershipMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OwnershipChangedMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[22].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ChannelDataUpdateMessage); i {
 			case 0:
 				return &v.state
@@ -2193,7 +4514,79 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[17].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[23].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MessageDelta); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[24].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ListDelta); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[25].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MapDelta); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[26].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*MapEntryDelta); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[27].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ChannelDataLogRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[28].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*CaptureRecord); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[29].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*DisconnectMessage); i {
 			case 0:
 				return &v.state
@@ -2205,7 +4598,43 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[18].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[30].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PingMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[31].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PongMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[32].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ErrorResultMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[33].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*Location); i {
 			case 0:
 				return &v.state
@@ -2217,7 +4646,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[19].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[34].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SpatialEntityInfo); i {
 			case 0:
 				return &v.state
@@ -2229,7 +4658,7 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[20].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[35].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SpatialChannelDataMessage); i {
 			case 0:
 				return &v.state
@@ -2241,7 +4670,67 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
-		file_channeld_proto_msgTypes[21].Exporter = func(v interface{}, i int) interface{} {
+		file_channeld_proto_msgTypes[36].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpatialInterestArea); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[37].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpatialInterestMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[38].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoverPrepareMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[39].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoverPrepareResultMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[40].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*HandoverEventMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[41].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*ListChannelResultMessage_ChannelInfo); i {
 			case 0:
 				return &v.state
@@ -2253,14 +4742,55 @@ func file_channeld_proto_init() {
 				return nil
 			}
 		}
+		file_channeld_proto_msgTypes[47].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpatialInterestArea_Sphere); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[48].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpatialInterestArea_Cone); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_channeld_proto_msgTypes[49].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SpatialInterestArea_Border); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_channeld_proto_msgTypes[36].OneofWrappers = []interface{}{
+		(*SpatialInterestArea_Sphere_)(nil),
+		(*SpatialInterestArea_Cone_)(nil),
+		(*SpatialInterestArea_Border_)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_channeld_proto_rawDesc,
-			NumEnums:      6,
-			NumMessages:   23,
+			NumEnums:      8,
+			NumMessages:   50,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
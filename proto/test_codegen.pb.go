@@ -0,0 +1,625 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.26.0
+// 	protoc        v3.18.0
+// source: test_codegen.proto
+
+package proto
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	anypb "google.golang.org/protobuf/types/known/anypb"
+	reflect "reflect"
+	sync "sync"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type TestCodegenMessage_Color int32
+
+const (
+	TestCodegenMessage_NONE  TestCodegenMessage_Color = 0
+	TestCodegenMessage_RED   TestCodegenMessage_Color = 1
+	TestCodegenMessage_GREEN TestCodegenMessage_Color = 2
+)
+
+// Enum value maps for TestCodegenMessage_Color.
+var (
+	TestCodegenMessage_Color_name = map[int32]string{
+		0: "NONE",
+		1: "RED",
+		2: "GREEN",
+	}
+	TestCodegenMessage_Color_value = map[string]int32{
+		"NONE":  0,
+		"RED":   1,
+		"GREEN": 2,
+	}
+)
+
+func (x TestCodegenMessage_Color) Enum() *TestCodegenMessage_Color {
+	p := new(TestCodegenMessage_Color)
+	*p = x
+	return p
+}
+
+func (x TestCodegenMessage_Color) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (TestCodegenMessage_Color) Descriptor() protoreflect.EnumDescriptor {
+	return file_test_codegen_proto_enumTypes[0].Descriptor()
+}
+
+func (TestCodegenMessage_Color) Type() protoreflect.EnumType {
+	return &file_test_codegen_proto_enumTypes[0]
+}
+
+func (x TestCodegenMessage_Color) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use TestCodegenMessage_Color.Descriptor instead.
+func (TestCodegenMessage_Color) EnumDescriptor() ([]byte, []int) {
+	return file_test_codegen_proto_rawDescGZIP(), []int{0, 0}
+}
+
+// Covers the field kinds that protoc-gen-channeld-merge handles. The Merge method is generated in test_codegen_merge.pb.go.
+type TestCodegenMessage struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Text      string                                `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	I32       int32                                 `protobuf:"varint,2,opt,name=i32,proto3" json:"i32,omitempty"`
+	U64       uint64                                `protobuf:"varint,3,opt,name=u64,proto3" json:"u64,omitempty"`
+	Ratio     float64                               `protobuf:"fixed64,4,opt,name=ratio,proto3" json:"ratio,omitempty"`
+	Flag      bool                                  `protobuf:"varint,5,opt,name=flag,proto3" json:"flag,omitempty"`
+	Raw       []byte                                `protobuf:"bytes,6,opt,name=raw,proto3" json:"raw,omitempty"`
+	Color     TestCodegenMessage_Color              `protobuf:"varint,7,opt,name=color,proto3,enum=channeld.TestCodegenMessage_Color" json:"color,omitempty"`
+	Nested    *TestCodegenMessage_Nested            `protobuf:"bytes,8,opt,name=nested,proto3" json:"nested,omitempty"`
+	Any       *anypb.Any                            `protobuf:"bytes,9,opt,name=any,proto3" json:"any,omitempty"`
+	StrList   []string                              `protobuf:"bytes,10,rep,name=strList,proto3" json:"strList,omitempty"`
+	MsgList   []*TestCodegenMessage_Nested          `protobuf:"bytes,11,rep,name=msgList,proto3" json:"msgList,omitempty"`
+	BytesList [][]byte                              `protobuf:"bytes,12,rep,name=bytesList,proto3" json:"bytesList,omitempty"`
+	Entries   map[uint32]*TestCodegenMessage_Entry  `protobuf:"bytes,13,rep,name=entries,proto3" json:"entries,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	NestedMap map[string]*TestCodegenMessage_Nested `protobuf:"bytes,14,rep,name=nestedMap,proto3" json:"nestedMap,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Types that are assignable to Choice:
+	//	*TestCodegenMessage_ChoiceText
+	//	*TestCodegenMessage_ChoiceNested
+	Choice isTestCodegenMessage_Choice `protobuf_oneof:"choice"`
+	Kv     map[int64]string            `protobuf:"bytes,17,rep,name=kv,proto3" json:"kv,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	RawMap map[string][]byte           `protobuf:"bytes,18,rep,name=rawMap,proto3" json:"rawMap,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *TestCodegenMessage) Reset() {
+	*x = TestCodegenMessage{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_test_codegen_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TestCodegenMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestCodegenMessage) ProtoMessage() {}
+
+func (x *TestCodegenMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_test_codegen_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestCodegenMessage.ProtoReflect.Descriptor instead.
+func (*TestCodegenMessage) Descriptor() ([]byte, []int) {
+	return file_test_codegen_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *TestCodegenMessage) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *TestCodegenMessage) GetI32() int32 {
+	if x != nil {
+		return x.I32
+	}
+	return 0
+}
+
+func (x *TestCodegenMessage) GetU64() uint64 {
+	if x != nil {
+		return x.U64
+	}
+	return 0
+}
+
+func (x *TestCodegenMessage) GetRatio() float64 {
+	if x != nil {
+		return x.Ratio
+	}
+	return 0
+}
+
+func (x *TestCodegenMessage) GetFlag() bool {
+	if x != nil {
+		return x.Flag
+	}
+	return false
+}
+
+func (x *TestCodegenMessage) GetRaw() []byte {
+	if x != nil {
+		return x.Raw
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetColor() TestCodegenMessage_Color {
+	if x != nil {
+		return x.Color
+	}
+	return TestCodegenMessage_NONE
+}
+
+func (x *TestCodegenMessage) GetNested() *TestCodegenMessage_Nested {
+	if x != nil {
+		return x.Nested
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetAny() *anypb.Any {
+	if x != nil {
+		return x.Any
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetStrList() []string {
+	if x != nil {
+		return x.StrList
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetMsgList() []*TestCodegenMessage_Nested {
+	if x != nil {
+		return x.MsgList
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetBytesList() [][]byte {
+	if x != nil {
+		return x.BytesList
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetEntries() map[uint32]*TestCodegenMessage_Entry {
+	if x != nil {
+		return x.Entries
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetNestedMap() map[string]*TestCodegenMessage_Nested {
+	if x != nil {
+		return x.NestedMap
+	}
+	return nil
+}
+
+func (m *TestCodegenMessage) GetChoice() isTestCodegenMessage_Choice {
+	if m != nil {
+		return m.Choice
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetChoiceText() string {
+	if x, ok := x.GetChoice().(*TestCodegenMessage_ChoiceText); ok {
+		return x.ChoiceText
+	}
+	return ""
+}
+
+func (x *TestCodegenMessage) GetChoiceNested() *TestCodegenMessage_Nested {
+	if x, ok := x.GetChoice().(*TestCodegenMessage_ChoiceNested); ok {
+		return x.ChoiceNested
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetKv() map[int64]string {
+	if x != nil {
+		return x.Kv
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage) GetRawMap() map[string][]byte {
+	if x != nil {
+		return x.RawMap
+	}
+	return nil
+}
+
+type isTestCodegenMessage_Choice interface {
+	isTestCodegenMessage_Choice()
+}
+
+type TestCodegenMessage_ChoiceText struct {
+	ChoiceText string `protobuf:"bytes,15,opt,name=choiceText,proto3,oneof"`
+}
+
+type TestCodegenMessage_ChoiceNested struct {
+	ChoiceNested *TestCodegenMessage_Nested `protobuf:"bytes,16,opt,name=choiceNested,proto3,oneof"`
+}
+
+func (*TestCodegenMessage_ChoiceText) isTestCodegenMessage_Choice() {}
+
+func (*TestCodegenMessage_ChoiceNested) isTestCodegenMessage_Choice() {}
+
+type TestCodegenMessage_Nested struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Text  string                     `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Num   int64                      `protobuf:"varint,2,opt,name=num,proto3" json:"num,omitempty"`
+	List  []uint32                   `protobuf:"varint,3,rep,packed,name=list,proto3" json:"list,omitempty"`
+	Child *TestCodegenMessage_Nested `protobuf:"bytes,4,opt,name=child,proto3" json:"child,omitempty"`
+}
+
+func (x *TestCodegenMessage_Nested) Reset() {
+	*x = TestCodegenMessage_Nested{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_test_codegen_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TestCodegenMessage_Nested) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestCodegenMessage_Nested) ProtoMessage() {}
+
+func (x *TestCodegenMessage_Nested) ProtoReflect() protoreflect.Message {
+	mi := &file_test_codegen_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestCodegenMessage_Nested.ProtoReflect.Descriptor instead.
+func (*TestCodegenMessage_Nested) Descriptor() ([]byte, []int) {
+	return file_test_codegen_proto_rawDescGZIP(), []int{0, 0}
+}
+
+func (x *TestCodegenMessage_Nested) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *TestCodegenMessage_Nested) GetNum() int64 {
+	if x != nil {
+		return x.Num
+	}
+	return 0
+}
+
+func (x *TestCodegenMessage_Nested) GetList() []uint32 {
+	if x != nil {
+		return x.List
+	}
+	return nil
+}
+
+func (x *TestCodegenMessage_Nested) GetChild() *TestCodegenMessage_Nested {
+	if x != nil {
+		return x.Child
+	}
+	return nil
+}
+
+type TestCodegenMessage_Entry struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Removed bool                       `protobuf:"varint,1,opt,name=removed,proto3" json:"removed,omitempty"`
+	Content string                     `protobuf:"bytes,2,opt,name=content,proto3" json:"content,omitempty"`
+	Nested  *TestCodegenMessage_Nested `protobuf:"bytes,3,opt,name=nested,proto3" json:"nested,omitempty"`
+}
+
+func (x *TestCodegenMessage_Entry) Reset() {
+	*x = TestCodegenMessage_Entry{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_test_codegen_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TestCodegenMessage_Entry) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TestCodegenMessage_Entry) ProtoMessage() {}
+
+func (x *TestCodegenMessage_Entry) ProtoReflect() protoreflect.Message {
+	mi := &file_test_codegen_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TestCodegenMessage_Entry.ProtoReflect.Descriptor instead.
+func (*TestCodegenMessage_Entry) Descriptor() ([]byte, []int) {
+	return file_test_codegen_proto_rawDescGZIP(), []int{0, 1}
+}
+
+func (x *TestCodegenMessage_Entry) GetRemoved() bool {
+	if x != nil {
+		return x.Removed
+	}
+	return false
+}
+
+func (x *TestCodegenMessage_Entry) GetContent() string {
+	if x != nil {
+		return x.Content
+	}
+	return ""
+}
+
+func (x *TestCodegenMessage_Entry) GetNested() *TestCodegenMessage_Nested {
+	if x != nil {
+		return x.Nested
+	}
+	return nil
+}
+
+var File_test_codegen_proto protoreflect.FileDescriptor
+
+var file_test_codegen_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x74, 0x65, 0x73, 0x74, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x08, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x1a, 0x19,
+	0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2f,
+	0x61, 0x6e, 0x79, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xf2, 0x0a, 0x0a, 0x12, 0x54, 0x65,
+	0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x78, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04,
+	0x74, 0x65, 0x78, 0x74, 0x12, 0x10, 0x0a, 0x03, 0x69, 0x33, 0x32, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x05, 0x52, 0x03, 0x69, 0x33, 0x32, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x36, 0x34, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x04, 0x52, 0x03, 0x75, 0x36, 0x34, 0x12, 0x14, 0x0a, 0x05, 0x72, 0x61, 0x74, 0x69,
+	0x6f, 0x18, 0x04, 0x20, 0x01, 0x28, 0x01, 0x52, 0x05, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x12, 0x12,
+	0x0a, 0x04, 0x66, 0x6c, 0x61, 0x67, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x66, 0x6c,
+	0x61, 0x67, 0x12, 0x10, 0x0a, 0x03, 0x72, 0x61, 0x77, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x03, 0x72, 0x61, 0x77, 0x12, 0x38, 0x0a, 0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x18, 0x07, 0x20,
+	0x01, 0x28, 0x0e, 0x32, 0x22, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54,
+	0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x2e, 0x43, 0x6f, 0x6c, 0x6f, 0x72, 0x52, 0x05, 0x63, 0x6f, 0x6c, 0x6f, 0x72, 0x12, 0x3b,
+	0x0a, 0x06, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x23,
+	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f,
+	0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4e, 0x65, 0x73,
+	0x74, 0x65, 0x64, 0x52, 0x06, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x12, 0x26, 0x0a, 0x03, 0x61,
+	0x6e, 0x79, 0x18, 0x09, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c,
+	0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x41, 0x6e, 0x79, 0x52, 0x03,
+	0x61, 0x6e, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x73, 0x74, 0x72, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x0a,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x73, 0x74, 0x72, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x3d, 0x0a,
+	0x07, 0x6d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x0b, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x23,
+	0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f,
+	0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4e, 0x65, 0x73,
+	0x74, 0x65, 0x64, 0x52, 0x07, 0x6d, 0x73, 0x67, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x1c, 0x0a, 0x09,
+	0x62, 0x79, 0x74, 0x65, 0x73, 0x4c, 0x69, 0x73, 0x74, 0x18, 0x0c, 0x20, 0x03, 0x28, 0x0c, 0x52,
+	0x09, 0x62, 0x79, 0x74, 0x65, 0x73, 0x4c, 0x69, 0x73, 0x74, 0x12, 0x43, 0x0a, 0x07, 0x65, 0x6e,
+	0x74, 0x72, 0x69, 0x65, 0x73, 0x18, 0x0d, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x29, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67,
+	0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x45, 0x6e, 0x74, 0x72, 0x69, 0x65,
+	0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x07, 0x65, 0x6e, 0x74, 0x72, 0x69, 0x65, 0x73, 0x12,
+	0x49, 0x0a, 0x09, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x4d, 0x61, 0x70, 0x18, 0x0e, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x2b, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65,
+	0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x4d, 0x61, 0x70, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52,
+	0x09, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x4d, 0x61, 0x70, 0x12, 0x20, 0x0a, 0x0a, 0x63, 0x68,
+	0x6f, 0x69, 0x63, 0x65, 0x54, 0x65, 0x78, 0x74, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x09, 0x48, 0x00,
+	0x52, 0x0a, 0x63, 0x68, 0x6f, 0x69, 0x63, 0x65, 0x54, 0x65, 0x78, 0x74, 0x12, 0x49, 0x0a, 0x0c,
+	0x63, 0x68, 0x6f, 0x69, 0x63, 0x65, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x18, 0x10, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65,
+	0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x48, 0x00, 0x52, 0x0c, 0x63, 0x68, 0x6f, 0x69, 0x63,
+	0x65, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x12, 0x34, 0x0a, 0x02, 0x6b, 0x76, 0x18, 0x11, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x24, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54,
+	0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67,
+	0x65, 0x2e, 0x4b, 0x76, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x02, 0x6b, 0x76, 0x12, 0x40, 0x0a,
+	0x06, 0x72, 0x61, 0x77, 0x4d, 0x61, 0x70, 0x18, 0x12, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x28, 0x2e,
+	0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x64,
+	0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x52, 0x61, 0x77, 0x4d,
+	0x61, 0x70, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x06, 0x72, 0x61, 0x77, 0x4d, 0x61, 0x70, 0x1a,
+	0x7d, 0x0a, 0x06, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x74, 0x65, 0x78,
+	0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x74, 0x65, 0x78, 0x74, 0x12, 0x10, 0x0a,
+	0x03, 0x6e, 0x75, 0x6d, 0x18, 0x02, 0x20, 0x01, 0x28, 0x03, 0x52, 0x03, 0x6e, 0x75, 0x6d, 0x12,
+	0x12, 0x0a, 0x04, 0x6c, 0x69, 0x73, 0x74, 0x18, 0x03, 0x20, 0x03, 0x28, 0x0d, 0x52, 0x04, 0x6c,
+	0x69, 0x73, 0x74, 0x12, 0x39, 0x0a, 0x05, 0x63, 0x68, 0x69, 0x6c, 0x64, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68, 0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65,
+	0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65,
+	0x2e, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x52, 0x05, 0x63, 0x68, 0x69, 0x6c, 0x64, 0x1a, 0x78,
+	0x0a, 0x05, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x18, 0x0a, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76,
+	0x65, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65,
+	0x64, 0x12, 0x18, 0x0a, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x07, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x12, 0x3b, 0x0a, 0x06, 0x6e,
+	0x65, 0x73, 0x74, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67,
+	0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64,
+	0x52, 0x06, 0x6e, 0x65, 0x73, 0x74, 0x65, 0x64, 0x1a, 0x5e, 0x0a, 0x0c, 0x45, 0x6e, 0x74, 0x72,
+	0x69, 0x65, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18,
+	0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x38, 0x0a, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x22, 0x2e, 0x63, 0x68, 0x61, 0x6e,
+	0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67, 0x65, 0x6e,
+	0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x61, 0x0a, 0x0e, 0x4e, 0x65, 0x73, 0x74,
+	0x65, 0x64, 0x4d, 0x61, 0x70, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x39, 0x0a, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x23, 0x2e, 0x63, 0x68,
+	0x61, 0x6e, 0x6e, 0x65, 0x6c, 0x64, 0x2e, 0x54, 0x65, 0x73, 0x74, 0x43, 0x6f, 0x64, 0x65, 0x67,
+	0x65, 0x6e, 0x4d, 0x65, 0x73, 0x73, 0x61, 0x67, 0x65, 0x2e, 0x4e, 0x65, 0x73, 0x74, 0x65, 0x64,
+	0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a, 0x35, 0x0a, 0x07, 0x4b,
+	0x76, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20,
+	0x01, 0x28, 0x03, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02,
+	0x38, 0x01, 0x1a, 0x39, 0x0a, 0x0b, 0x52, 0x61, 0x77, 0x4d, 0x61, 0x70, 0x45, 0x6e, 0x74, 0x72,
+	0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03,
+	0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x25, 0x0a,
+	0x05, 0x43, 0x6f, 0x6c, 0x6f, 0x72, 0x12, 0x08, 0x0a, 0x04, 0x4e, 0x4f, 0x4e, 0x45, 0x10, 0x00,
+	0x12, 0x07, 0x0a, 0x03, 0x52, 0x45, 0x44, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x47, 0x52, 0x45,
+	0x45, 0x4e, 0x10, 0x02, 0x42, 0x08, 0x0a, 0x06, 0x63, 0x68, 0x6f, 0x69, 0x63, 0x65, 0x42, 0x08,
+	0x5a, 0x06, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+}
+
+var (
+	file_test_codegen_proto_rawDescOnce sync.Once
+	file_test_codegen_proto_rawDescData = file_test_codegen_proto_rawDesc
+)
+
+func file_test_codegen_proto_rawDescGZIP() []byte {
+	file_test_codegen_proto_rawDescOnce.Do(func() {
+		file_test_codegen_proto_rawDescData = protoimpl.X.CompressGZIP(file_test_codegen_proto_rawDescData)
+	})
+	return file_test_codegen_proto_rawDescData
+}
+
+var file_test_codegen_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_test_codegen_proto_msgTypes = make([]protoimpl.MessageInfo, 7)
+var file_test_codegen_proto_goTypes = []interface{}{
+	(TestCodegenMessage_Color)(0),     // 0: channeld.TestCodegenMessage.Color
+	(*TestCodegenMessage)(nil),        // 1: channeld.TestCodegenMessage
+	(*TestCodegenMessage_Nested)(nil), // 2: channeld.TestCodegenMessage.Nested
+	(*TestCodegenMessage_Entry)(nil),  // 3: channeld.TestCodegenMessage.Entry
+	nil,                               // 4: channeld.TestCodegenMessage.EntriesEntry
+	nil,                               // 5: channeld.TestCodegenMessage.NestedMapEntry
+	nil,                               // 6: channeld.TestCodegenMessage.KvEntry
+	nil,                               // 7: channeld.TestCodegenMessage.RawMapEntry
+	(*anypb.Any)(nil),                 // 8: google.protobuf.Any
+}
+var file_test_codegen_proto_depIdxs = []int32{
+	0,  // 0: channeld.TestCodegenMessage.color:type_name -> channeld.TestCodegenMessage.Color
+	2,  // 1: channeld.TestCodegenMessage.nested:type_name -> channeld.TestCodegenMessage.Nested
+	8,  // 2: channeld.TestCodegenMessage.any:type_name -> google.protobuf.Any
+	2,  // 3: channeld.TestCodegenMessage.msgList:type_name -> channeld.TestCodegenMessage.Nested
+	4,  // 4: channeld.TestCodegenMessage.entries:type_name -> channeld.TestCodegenMessage.EntriesEntry
+	5,  // 5: channeld.TestCodegenMessage.nestedMap:type_name -> channeld.TestCodegenMessage.NestedMapEntry
+	2,  // 6: channeld.TestCodegenMessage.choiceNested:type_name -> channeld.TestCodegenMessage.Nested
+	6,  // 7: channeld.TestCodegenMessage.kv:type_name -> channeld.TestCodegenMessage.KvEntry
+	7,  // 8: channeld.TestCodegenMessage.rawMap:type_name -> channeld.TestCodegenMessage.RawMapEntry
+	2,  // 9: channeld.TestCodegenMessage.Nested.child:type_name -> channeld.TestCodegenMessage.Nested
+	2,  // 10: channeld.TestCodegenMessage.Entry.nested:type_name -> channeld.TestCodegenMessage.Nested
+	3,  // 11: channeld.TestCodegenMessage.EntriesEntry.value:type_name -> channeld.TestCodegenMessage.Entry
+	2,  // 12: channeld.TestCodegenMessage.NestedMapEntry.value:type_name -> channeld.TestCodegenMessage.Nested
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
+}
+
+func init() { file_test_codegen_proto_init() }
+func file_test_codegen_proto_init() {
+	if File_test_codegen_proto != nil {
+		return
+	}
+	if !protoimpl.UnsafeEnabled {
+		file_test_codegen_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TestCodegenMessage); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_test_codegen_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TestCodegenMessage_Nested); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_test_codegen_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TestCodegenMessage_Entry); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+	}
+	file_test_codegen_proto_msgTypes[0].OneofWrappers = []interface{}{
+		(*TestCodegenMessage_ChoiceText)(nil),
+		(*TestCodegenMessage_ChoiceNested)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_test_codegen_proto_rawDesc,
+			NumEnums:      1,
+			NumMessages:   7,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_test_codegen_proto_goTypes,
+		DependencyIndexes: file_test_codegen_proto_depIdxs,
+		EnumInfos:         file_test_codegen_proto_enumTypes,
+		MessageInfos:      file_test_codegen_proto_msgTypes,
+	}.Build()
+	File_test_codegen_proto = out.File
+	file_test_codegen_proto_rawDesc = nil
+	file_test_codegen_proto_goTypes = nil
+	file_test_codegen_proto_depIdxs = nil
+}